@@ -0,0 +1,105 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Page sizes of item history and list activity
+const (
+	defaultEventsPage = 50
+	MaxEventsPage     = 200
+)
+
+// GetItemHistory returns the recorded changes of an item, newest first, also after it was deleted
+func GetItemHistory(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	limit, offset, err := eventsPage(c)
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+
+	// A deleted item belongs to the list of its last event
+	listID, err := db.GetItemListID(int64(id))
+	if err == sql.ErrNoRows {
+		listID, err = db.ItemEventListID(int64(id))
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	if !requireListAccess(c, listID) {
+		return listForbidden(c)
+	}
+
+	events, total, err := db.GetItemEvents(int64(id), limit, offset)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	return c.JSON(eventsResponse(events, total, limit, offset))
+}
+
+// GetListActivity returns the recorded changes of the items of a list, newest first
+func GetListActivity(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+	limit, offset, err := eventsPage(c)
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+
+	if _, err := db.GetListByID(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	events, total, err := db.GetListActivity(int64(id), limit, offset)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	return c.JSON(eventsResponse(events, total, limit, offset))
+}
+
+// eventsPage reads the limit and offset of GET /items/:id/history and /lists/:id/activity
+// The error describes an invalid value
+func eventsPage(c *fiber.Ctx) (limit, offset int, err error) {
+	limit = defaultEventsPage
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > MaxEventsPage {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", MaxEventsPage)
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+// eventsResponse wraps a page of events with the offset of the next one
+func eventsResponse(events []db.ItemEvent, total, limit, offset int) ItemEventsResponse {
+	resp := ItemEventsResponse{Events: events, Total: total}
+	if next := offset + len(events); next < total && len(events) == limit {
+		resp.NextOffset = &next
+	}
+	return resp
+}
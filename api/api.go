@@ -2,6 +2,7 @@ package api
 
 import (
 	"log"
+	"shopping-list/handlers"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -12,55 +13,120 @@ func Register(app *fiber.App) {
 		log.Println("REST API is disabled (API_TOKEN not set)")
 		// Register catch-all handler that returns 503 for all API requests
 		app.All("/api/v1/*", func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusServiceUnavailable).JSON(ErrorResponse{
-				Error:   "api_disabled",
-				Message: "API is not enabled on this server",
-			})
+			return apiError(c, handlers.ErrCodeAPIDisabled, "api_disabled")
+		})
+		app.Post("/api/export/link", func(c *fiber.Ctx) error {
+			return apiError(c, handlers.ErrCodeAPIDisabled, "api_disabled")
 		})
 		return
 	}
 
 	log.Println("REST API is enabled")
 
+	// Signed export download links, for browsers that cannot send the token
+	app.Post("/api/export/link", TokenAuthMiddleware, CreateExportLink)
+
 	// Create API group with version prefix and token auth middleware
 	v1 := app.Group("/api/v1", TokenAuthMiddleware)
 
+	// Creating endpoints replay the stored response for retries with the same Idempotency-Key
+	idempotent := handlers.Idempotent(tokenIdempotencyScope)
+
+	// Identity and capabilities of the calling token
+	v1.Get("/me", GetMe)
+
 	// Lists endpoints
 	v1.Get("/lists", GetLists)
 	v1.Get("/lists/:id", GetList)
-	v1.Post("/lists", CreateList)
+	v1.Post("/lists", idempotent, CreateList)
 	v1.Put("/lists/:id", UpdateList)
 	v1.Delete("/lists/:id", DeleteList)
 	v1.Get("/lists/:id/sections", GetListSections)
+	v1.Post("/lists/:id/clear-completed", ClearCompletedItems)
+	v1.Put("/lists/:id/sections/order", SetListSectionsOrder)
+	v1.Get("/lists/:id/activity", GetListActivity)
+	v1.Get("/lists/:id/trash", GetListTrash)
+	v1.Delete("/lists/:id/trash", PurgeListTrash)
 	v1.Post("/lists/:id/move-up", MoveListUp)
 	v1.Post("/lists/:id/move-down", MoveListDown)
 
 	// Sections endpoints
 	v1.Get("/sections/:id", GetSection)
-	v1.Post("/sections", CreateSection)
+	v1.Post("/sections", idempotent, CreateSection)
 	v1.Put("/sections/:id", UpdateSection)
 	v1.Delete("/sections/:id", DeleteSection)
 	v1.Get("/sections/:id/items", GetSectionItems)
+	v1.Put("/sections/:id/items/order", SetSectionItemsOrder)
 	v1.Post("/sections/:id/move-up", MoveSectionUp)
 	v1.Post("/sections/:id/move-down", MoveSectionDown)
 
 	// Items endpoints
+	v1.Get("/items/due", GetDueItems)
+	v1.Post("/items/batch-delete", BatchDeleteItems)
+	v1.Post("/items/batch-complete", BatchCompleteItems)
 	v1.Get("/items/:id", GetItem)
-	v1.Post("/items", CreateItem)
+	v1.Post("/items", idempotent, CreateItem)
 	v1.Put("/items/:id", UpdateItem)
 	v1.Delete("/items/:id", DeleteItem)
 	v1.Post("/items/:id/toggle", ToggleItemCompleted)
 	v1.Post("/items/:id/uncertain", ToggleItemUncertain)
 	v1.Post("/items/:id/move", MoveItem)
+	v1.Post("/items/:id/move-to-list", MoveItemToList)
 	v1.Post("/items/:id/move-up", MoveItemUp)
 	v1.Post("/items/:id/move-down", MoveItemDown)
+	v1.Post("/items/:id/photo", UploadItemPhoto)
+	v1.Get("/items/:id/photo", GetItemPhoto)
+	v1.Delete("/items/:id/photo", DeleteItemPhoto)
+	v1.Get("/items/:id/history", GetItemHistory)
+	v1.Post("/items/:id/restore", RestoreItem)
+
+	// Item search across lists
+	v1.Get("/search", SearchItems)
+
+	// Product names for scanned barcodes
+	v1.Get("/products/lookup", LookupProduct)
 
 	// Batch endpoint
-	v1.Post("/batch", BatchCreate)
+	v1.Post("/batch", idempotent, BatchCreate)
+
+	// History endpoints (suggestions), shared across all lists
+	v1.Get("/history", unscopedOnly, GetHistory)
+	v1.Post("/history", unscopedOnly, CreateHistory)
+	v1.Delete("/history/:id", unscopedOnly, DeleteHistory)
+	v1.Post("/history/batch-delete", unscopedOnly, BatchDeleteHistory)
+
+	// List token endpoints (admin only)
+	v1.Get("/lists/:id/tokens", GetListTokens)
+	v1.Post("/lists/:id/tokens", CreateListToken)
+	v1.Delete("/lists/:id/tokens/:tokenId", DeleteListToken)
 
-	// History endpoints (suggestions)
-	v1.Get("/history", GetHistory)
-	v1.Post("/history", CreateHistory)
-	v1.Delete("/history/:id", DeleteHistory)
-	v1.Post("/history/batch-delete", BatchDeleteHistory)
+	// Admin endpoints
+	v1.Get("/admin/tokens", GetAllTokens)
+	v1.Post("/admin/tokens/:id/rotate", RotateToken)
+	v1.Get("/admin/maintenance", GetMaintenance)
+	v1.Post("/admin/maintenance", SetMaintenance)
+	v1.Get("/admin/settings", GetSettings)
+	v1.Put("/admin/settings", UpdateSettings)
+	v1.Get("/admin/i18n/overrides", GetTranslationOverrides)
+	v1.Post("/admin/i18n/reload", ReloadTranslations)
+	v1.Get("/admin/connectivity-check", CheckConnectivity)
+	v1.Get("/admin/backup", GetBackup)
+	v1.Get("/admin/backups", GetBackups)
+	v1.Post("/admin/restore", RestoreBackup)
+	v1.Post("/admin/clear", ClearData)
+	v1.Post("/admin/cleanup/run", RunCleanup)
+	v1.Post("/admin/cleanup/files", CleanupFiles)
+	v1.Get("/admin/integrity", GetIntegrity)
+	v1.Post("/admin/integrity/repair", RepairIntegrity)
+	v1.Post("/admin/repair-ordering", RepairOrdering)
+	v1.Get("/admin/db-stats", GetDBStats)
+	v1.Get("/admin/migrations", GetMigrations)
+	v1.Post("/admin/seed-demo", SeedDemo)
+	v1.Get("/admin/optimize", GetOptimizeStatus)
+	v1.Post("/admin/optimize", Optimize)
+	v1.Get("/admin/operations", GetOperations)
+	v1.Delete("/admin/operations/lock", ClearOperationLock)
+	v1.Get("/admin/shares", GetShares)
+	v1.Post("/admin/shares", CreateShare)
+	v1.Delete("/admin/shares/:id", RevokeShare)
 }
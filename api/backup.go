@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tempBackupFile removes the snapshot and its temp directory once the response body has been sent
+// or the client went away
+type tempBackupFile struct {
+	*os.File
+}
+
+func (f tempBackupFile) Close() error {
+	err := f.File.Close()
+	if rmErr := os.RemoveAll(filepath.Dir(f.Name())); rmErr != nil {
+		log.Printf("[BACKUP] Failed to remove temp directory of %s: %v", f.Name(), rmErr)
+	}
+	return err
+}
+
+// GetBackup streams a consistent SQLite snapshot of the database
+func GetBackup(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	dir, err := os.MkdirTemp("", "koffan-backup-")
+	if err != nil {
+		return apiError(c, handlers.ErrCodeBackupFailed, "backup_failed")
+	}
+	path := filepath.Join(dir, "backup.db")
+
+	end, err := handlers.BeginOperation(handlers.OperationBackup)
+	var busy *handlers.OperationBusyError
+	if errors.As(err, &busy) {
+		os.RemoveAll(dir)
+		return handlers.OperationConflict(c, busy)
+	}
+	size, err := db.BackupTo(path)
+	end(err)
+	if err != nil {
+		log.Printf("[BACKUP] VACUUM INTO failed: %v", err)
+		os.RemoveAll(dir)
+		return apiError(c, handlers.ErrCodeBackupFailed, "backup_failed")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return apiError(c, handlers.ErrCodeBackupFailed, "backup_failed")
+	}
+
+	auditAdmin(c, "backup", fmt.Sprintf("size=%d", size))
+
+	filename := fmt.Sprintf("koffan-backup-%s.db", time.Now().Format("2006-01-02-150405"))
+	if err := db.AddBackupRecord(db.BackupKindDownload, "", filename, size); err != nil {
+		log.Printf("[BACKUP] Failed to record backup %s: %v", filename, err)
+	}
+	c.Set(fiber.HeaderContentType, "application/x-sqlite3")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// fasthttp closes the stream after sending, including on client disconnect, which removes the directory
+	return c.SendStream(tempBackupFile{f}, int(size))
+}
+
+// maxBackupRecords is how many of the most recent backups GetBackups lists
+const maxBackupRecords = 100
+
+// BackupsResponse lists the backups that were taken
+type BackupsResponse struct {
+	Backups []db.BackupRecord `json:"backups"`
+}
+
+// GetBackups lists the most recent downloaded, pushed and command-line backups, newest first,
+// with their dates formatted for the request language
+func GetBackups(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	records, err := db.GetBackupRecords(maxBackupRecords)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	lang, now := handlers.RequestLang(c), time.Now()
+	for i := range records {
+		created := time.Unix(records[i].CreatedAt, 0)
+		records[i].CreatedAtDisplay = i18n.FormatDate(lang, created, i18n.DateLong)
+		records[i].CreatedAtRelative = i18n.FormatRelative(lang, created, now)
+	}
+	return c.JSON(BackupsResponse{Backups: records})
+}
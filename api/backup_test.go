@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// backupTempDirs returns the backup temp directories left in dir
+func backupTempDirs(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "koffan-backup-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestBackupRemovesTempDirectory(t *testing.T) {
+	app := setupTestAPI(t)
+	createTestItem(t, "Groceries", "Milk")
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	for i := 0; i < 3; i++ {
+		status, body := apiRequest(t, app, "GET", "/api/v1/admin/backup", testMasterToken, nil)
+		if status != fiber.StatusOK {
+			t.Fatalf("backup: got %d %s", status, body)
+		}
+		if !bytes.HasPrefix(body, []byte("SQLite format 3\x00")) {
+			t.Fatalf("backup is not a SQLite database: %q", body[:min(len(body), 16)])
+		}
+	}
+
+	// The stream is closed right after the body was written, which may be just after the client read it
+	deadline := time.Now().Add(2 * time.Second)
+	for len(backupTempDirs(t, tmp)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if left := backupTempDirs(t, tmp); len(left) > 0 {
+		t.Errorf("temp directories left after the backups were sent: %v", left)
+	}
+}
+
+func TestTempBackupFileCloseRemovesDirectory(t *testing.T) {
+	dir, err := os.MkdirTemp(t.TempDir(), "koffan-backup-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "backup.db")
+	if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (tempBackupFile{f}).Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temp directory still exists after Close: %v", err)
+	}
+}
+
+func decodeBackups(t *testing.T, body []byte) []db.BackupRecord {
+	t.Helper()
+	var resp BackupsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode backups %q: %v", body, err)
+	}
+	return resp.Backups
+}
+
+func TestListBackups(t *testing.T) {
+	app := setupTestAPI(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := apiRequest(t, app, http.MethodGet, "/api/v1/admin/backups", testMasterToken, nil)
+	if status != http.StatusOK || string(body) != `{"backups":[]}` {
+		t.Fatalf("no backups: status %d, body %s, want an empty list", status, body)
+	}
+
+	// A push three days ago, then a download now
+	if err := db.AddBackupRecord(db.BackupKindPush, "webdav", "koffan-export.json", 42); err != nil {
+		t.Fatal(err)
+	}
+	pushedAt := time.Now().AddDate(0, 0, -3)
+	if _, err := db.DB.Exec("UPDATE backups SET created_at = ?", pushedAt.Unix()); err != nil {
+		t.Fatal(err)
+	}
+	status, download := apiRequest(t, app, http.MethodGet, "/api/v1/admin/backup", testMasterToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("backup: status %d", status)
+	}
+
+	status, body = apiRequest(t, app, http.MethodGet, "/api/v1/admin/backups?lang=pl", testMasterToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("backups: status %d, body %s", status, body)
+	}
+	backups := decodeBackups(t, body)
+	if len(backups) != 2 {
+		t.Fatalf("backups = %+v, want the download and the push", backups)
+	}
+	if b := backups[0]; b.Kind != db.BackupKindDownload || b.Size != int64(len(download)) || b.Name == "" || b.CreatedAtRelative != "przed chwilą" {
+		t.Errorf("newest backup = %+v, want the download from just now", b)
+	}
+	b := backups[1]
+	if b.Kind != db.BackupKindPush || b.Target != "webdav" || b.Name != "koffan-export.json" || b.Size != 42 {
+		t.Errorf("oldest backup = %+v, want the WebDAV push", b)
+	}
+	if want := i18n.FormatDate("pl", time.Unix(pushedAt.Unix(), 0), i18n.DateLong); b.CreatedAtDisplay != want || b.CreatedAtRelative != "3 dni temu" {
+		t.Errorf("push dates = %q, %q, want %q, \"3 dni temu\"", b.CreatedAtDisplay, b.CreatedAtRelative, want)
+	}
+}
+
+func TestListBackupsRequiresAdmin(t *testing.T) {
+	app := setupTestAPI(t)
+	status, body := apiRequest(t, app, http.MethodGet, "/api/v1/admin/backups", "", nil)
+	if status != http.StatusUnauthorized && status != http.StatusForbidden {
+		t.Errorf("backups without a token: status %d, body %s", status, body)
+	}
+}
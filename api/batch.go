@@ -8,14 +8,25 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-// BatchCreate handles batch creation of lists, sections, and items
+// BatchCreate handles batch creation of lists, sections, and items, or a transactional batch of operations
 func BatchCreate(c *fiber.Ctx) error {
 	var req BatchCreateRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	// Operations check list access one by one, see batchApplyOperations
+	if len(req.Operations) > 0 {
+		return batchApplyOperations(c, req.Operations)
+	}
+
+	// List-scoped tokens may only add to their own list
+	if isListScoped(c) {
+		if req.List != nil ||
+			(req.ListID != 0 && !requireListAccess(c, req.ListID)) ||
+			(req.SectionID != 0 && !requireSectionAccess(c, req.SectionID)) {
+			return listForbidden(c)
+		}
 	}
 
 	// Determine which variant we're handling
@@ -27,71 +38,56 @@ func BatchCreate(c *fiber.Ctx) error {
 		return batchAddToSection(c, req)
 	}
 
-	return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-		Error:   "validation_error",
-		Message: "Request must contain either: list (new list), list_id + sections (add to existing list), or section_id + items (add to existing section)",
-	})
+	return apiError(c, handlers.ErrCodeValidation, "validation_error.batch_request")
 }
 
 // batchCreateNewList creates a new list with sections and items
 func batchCreateNewList(c *fiber.Ctx, req BatchCreateRequest) error {
 	if req.List.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "List name is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "list.name"})
 	}
 
-	if len(req.List.Name) > MaxListNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "List name exceeds maximum length of 100 characters",
+	if tooLong(req.List.Name, MaxListNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "list.name", "max": MaxListNameLength,
 		})
 	}
 
 	// Validate sections and items
 	for _, s := range req.List.Sections {
 		if s.Name == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "validation_error",
-				Message: "Section name is required",
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{
+				"field": "sections.name",
 			})
 		}
-		if len(s.Name) > MaxSectionNameLength {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "validation_error",
-				Message: "Section name exceeds maximum length of 100 characters",
+		if tooLong(s.Name, MaxSectionNameLength) {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+				"field": "sections.name", "max": MaxSectionNameLength,
 			})
 		}
 		for _, item := range s.Items {
 			if item.Name == "" {
-				return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-					Error:   "validation_error",
-					Message: "Item name is required",
+				return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{
+					"field": "items.name",
 				})
 			}
-			if len(item.Name) > MaxItemNameLength {
-				return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-					Error:   "validation_error",
-					Message: "Item name exceeds maximum length of 200 characters",
+			if tooLong(item.Name, MaxItemNameLength) {
+				return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+					"field": "items.name", "max": MaxItemNameLength,
 				})
 			}
-			if len(item.Description) > MaxDescriptionLength {
-				return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-					Error:   "validation_error",
-					Message: "Item description exceeds maximum length of 500 characters",
+			if tooLong(item.Description, MaxDescriptionLength) {
+				return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+					"field": "items.description", "max": MaxDescriptionLength,
 				})
 			}
 		}
 	}
 
 	// Start transaction
-	tx, err := db.DB.Begin()
+	tx, err := db.BeginWrite()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to start transaction",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 	defer tx.Rollback()
 
@@ -99,10 +95,7 @@ func batchCreateNewList(c *fiber.Ctx, req BatchCreateRequest) error {
 	icon := NormalizeIcon(req.List.Icon)
 	list, err := db.CreateListTx(tx, req.List.Name, icon)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to create list",
-		})
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
 	}
 
 	var sections []db.Section
@@ -112,9 +105,8 @@ func batchCreateNewList(c *fiber.Ctx, req BatchCreateRequest) error {
 	for sectionOrder, sectionInput := range req.List.Sections {
 		section, err := db.CreateSectionForListTx(tx, list.ID, sectionInput.Name, sectionOrder)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-				Error:   "create_failed",
-				Message: "Failed to create section: " + sectionInput.Name,
+			return apiErrorF(c, handlers.ErrCodeCreateFailed, "batch_create_failed", map[string]any{
+				"name": sectionInput.Name,
 			})
 		}
 
@@ -122,9 +114,8 @@ func batchCreateNewList(c *fiber.Ctx, req BatchCreateRequest) error {
 		for itemOrder, itemInput := range sectionInput.Items {
 			item, err := db.CreateItemTx(tx, section.ID, itemInput.Name, itemInput.Description, itemInput.Quantity, itemOrder)
 			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-					Error:   "create_failed",
-					Message: "Failed to create item: " + itemInput.Name,
+				return apiErrorF(c, handlers.ErrCodeCreateFailed, "batch_create_failed", map[string]any{
+					"name": itemInput.Name,
 				})
 			}
 			sectionItems = append(sectionItems, *item)
@@ -140,17 +131,14 @@ func batchCreateNewList(c *fiber.Ctx, req BatchCreateRequest) error {
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "commit_failed",
-			Message: "Failed to commit transaction",
-		})
+		return apiError(c, handlers.ErrCodeCommitFailed, "commit_failed")
 	}
 
 	// Get list with stats
 	list.Stats = db.GetListStats(list.ID)
 
 	// Broadcast WebSocket update
-	handlers.BroadcastUpdate("batch_created", map[string]interface{}{
+	handlers.BroadcastFrom(c, "batch_created", map[string]interface{}{
 		"list_id": list.ID,
 	})
 
@@ -167,54 +155,41 @@ func batchAddToList(c *fiber.Ctx, req BatchCreateRequest) error {
 	_, err := db.GetListByID(req.ListID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	// Validate sections and items
 	for _, s := range req.Sections {
 		if s.Name == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "validation_error",
-				Message: "Section name is required",
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{
+				"field": "sections.name",
 			})
 		}
-		if len(s.Name) > MaxSectionNameLength {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "validation_error",
-				Message: "Section name exceeds maximum length of 100 characters",
+		if tooLong(s.Name, MaxSectionNameLength) {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+				"field": "sections.name", "max": MaxSectionNameLength,
 			})
 		}
 		for _, item := range s.Items {
 			if item.Name == "" {
-				return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-					Error:   "validation_error",
-					Message: "Item name is required",
+				return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{
+					"field": "items.name",
 				})
 			}
-			if len(item.Name) > MaxItemNameLength {
-				return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-					Error:   "validation_error",
-					Message: "Item name exceeds maximum length of 200 characters",
+			if tooLong(item.Name, MaxItemNameLength) {
+				return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+					"field": "items.name", "max": MaxItemNameLength,
 				})
 			}
 		}
 	}
 
 	// Start transaction
-	tx, err := db.DB.Begin()
+	tx, err := db.BeginWrite()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to start transaction",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 	defer tx.Rollback()
 
@@ -228,9 +203,8 @@ func batchAddToList(c *fiber.Ctx, req BatchCreateRequest) error {
 	for i, sectionInput := range req.Sections {
 		section, err := db.CreateSectionForListTx(tx, req.ListID, sectionInput.Name, baseSectionOrder+i)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-				Error:   "create_failed",
-				Message: "Failed to create section: " + sectionInput.Name,
+			return apiErrorF(c, handlers.ErrCodeCreateFailed, "batch_create_failed", map[string]any{
+				"name": sectionInput.Name,
 			})
 		}
 
@@ -238,9 +212,8 @@ func batchAddToList(c *fiber.Ctx, req BatchCreateRequest) error {
 		for itemOrder, itemInput := range sectionInput.Items {
 			item, err := db.CreateItemTx(tx, section.ID, itemInput.Name, itemInput.Description, itemInput.Quantity, itemOrder)
 			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-					Error:   "create_failed",
-					Message: "Failed to create item: " + itemInput.Name,
+				return apiErrorF(c, handlers.ErrCodeCreateFailed, "batch_create_failed", map[string]any{
+					"name": itemInput.Name,
 				})
 			}
 			sectionItems = append(sectionItems, *item)
@@ -255,14 +228,11 @@ func batchAddToList(c *fiber.Ctx, req BatchCreateRequest) error {
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "commit_failed",
-			Message: "Failed to commit transaction",
-		})
+		return apiError(c, handlers.ErrCodeCommitFailed, "commit_failed")
 	}
 
 	// Broadcast WebSocket update
-	handlers.BroadcastUpdate("batch_created", map[string]interface{}{
+	handlers.BroadcastFrom(c, "batch_created", map[string]interface{}{
 		"list_id": req.ListID,
 	})
 
@@ -278,40 +248,29 @@ func batchAddToSection(c *fiber.Ctx, req BatchCreateRequest) error {
 	_, err := db.GetSectionByID(req.SectionID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	// Validate items
 	for _, item := range req.Items {
 		if item.Name == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "validation_error",
-				Message: "Item name is required",
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{
+				"field": "items.name",
 			})
 		}
-		if len(item.Name) > MaxItemNameLength {
-			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-				Error:   "validation_error",
-				Message: "Item name exceeds maximum length of 200 characters",
+		if tooLong(item.Name, MaxItemNameLength) {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+				"field": "items.name", "max": MaxItemNameLength,
 			})
 		}
 	}
 
 	// Start transaction
-	tx, err := db.DB.Begin()
+	tx, err := db.BeginWrite()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to start transaction",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 	defer tx.Rollback()
 
@@ -324,9 +283,8 @@ func batchAddToSection(c *fiber.Ctx, req BatchCreateRequest) error {
 	for i, itemInput := range req.Items {
 		item, err := db.CreateItemTx(tx, req.SectionID, itemInput.Name, itemInput.Description, itemInput.Quantity, baseItemOrder+i)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-				Error:   "create_failed",
-				Message: "Failed to create item: " + itemInput.Name,
+			return apiErrorF(c, handlers.ErrCodeCreateFailed, "batch_create_failed", map[string]any{
+				"name": itemInput.Name,
 			})
 		}
 		items = append(items, *item)
@@ -336,14 +294,11 @@ func batchAddToSection(c *fiber.Ctx, req BatchCreateRequest) error {
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "commit_failed",
-			Message: "Failed to commit transaction",
-		})
+		return apiError(c, handlers.ErrCodeCommitFailed, "commit_failed")
 	}
 
 	// Broadcast WebSocket update
-	handlers.BroadcastUpdate("batch_created", map[string]interface{}{
+	handlers.BroadcastFrom(c, "batch_created", map[string]interface{}{
 		"section_id": req.SectionID,
 	})
 
@@ -0,0 +1,527 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxBatchOperations limits the operations of one batch, they all run in a single write transaction
+const MaxBatchOperations = 100
+
+// batchOpError is the failure of one operation, rendered like apiErrorF
+type batchOpError struct {
+	code string
+	key  string
+	args map[string]any
+}
+
+func (e *batchOpError) Error() string {
+	return e.code + ": " + e.key
+}
+
+func opError(code, key string, args map[string]any) *batchOpError {
+	return &batchOpError{code: code, key: key, args: args}
+}
+
+func opRequired(field string) *batchOpError {
+	return opError(handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": field})
+}
+
+func opTooLong(field string, max int) *batchOpError {
+	return opError(handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{"field": field, "max": max})
+}
+
+// batchTx is the state shared by the operations of one batch
+type batchTx struct {
+	c     *fiber.Ctx
+	tx    *sql.Tx
+	lists map[int64]bool // lists changed by the batch, for the event sent after commit
+}
+
+// batchOps are the operations allowed in a batch, each decodes its body and applies it within the transaction
+var batchOps = map[string]func(b *batchTx, body []byte) (any, error){
+	"create_list":      batchCreateList,
+	"create_section":   batchCreateSection,
+	"update_section":   batchUpdateSection,
+	"create_item":      batchCreateItem,
+	"update_item":      batchUpdateItem,
+	"toggle_item":      batchToggleItem,
+	"toggle_uncertain": batchToggleUncertain,
+	"move_item":        batchMoveItem,
+}
+
+// Bodies of operations on an existing section or item, the endpoint body plus the id from the URL
+type (
+	batchTarget struct {
+		ID int64 `json:"id"`
+	}
+	batchSectionUpdate struct {
+		ID int64 `json:"id"`
+		UpdateSectionRequest
+	}
+	batchItemUpdate struct {
+		ID int64 `json:"id"`
+		UpdateItemRequest
+	}
+	batchItemMove struct {
+		ID int64 `json:"id"`
+		MoveItemRequest
+	}
+)
+
+// batchApplyOperations runs the operations in order within one transaction
+// The first failing operation rolls back the whole batch and is named in the error response
+func batchApplyOperations(c *fiber.Ctx, ops []BatchOperation) error {
+	if len(ops) > MaxBatchOperations {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_many", map[string]any{
+			"field": "operations", "max": MaxBatchOperations,
+		})
+	}
+
+	seen := map[string]bool{}
+	for i, op := range ops {
+		if _, ok := batchOps[op.Op]; !ok {
+			return batchOperationFailed(c, i, op.Op, opError(handlers.ErrCodeValidation, "validation_error.one_of", map[string]any{
+				"field": "op", "valid": strings.Join(batchOperationNames(), ", "),
+			}))
+		}
+		if op.Ref == "" {
+			continue
+		}
+		if seen[op.Ref] || strings.Contains(op.Ref, ".") {
+			return batchOperationFailed(c, i, op.Op, opError(handlers.ErrCodeValidation, "validation_error.invalid_ref", map[string]any{
+				"ref": op.Ref,
+			}))
+		}
+		seen[op.Ref] = true
+	}
+
+	tx, err := db.BeginWrite()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	defer tx.Rollback()
+
+	b := &batchTx{c: c, tx: tx, lists: map[int64]bool{}}
+	refs := map[string]any{}
+	results := make([]BatchOperationResult, 0, len(ops))
+	for i, op := range ops {
+		body, err := resolveBatchRefs(op.Body, refs)
+		if err != nil {
+			return batchOperationFailed(c, i, op.Op, err)
+		}
+		result, err := batchOps[op.Op](b, body)
+		if err != nil {
+			return batchOperationFailed(c, i, op.Op, err)
+		}
+		if op.Ref != "" {
+			if refs[op.Ref], err = batchRefValue(result); err != nil {
+				return batchOperationFailed(c, i, op.Op, err)
+			}
+		}
+		results = append(results, BatchOperationResult{Op: op.Op, Ref: op.Ref, Result: result})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apiError(c, handlers.ErrCodeCommitFailed, "commit_failed")
+	}
+
+	// One event for the whole batch, clients refresh once instead of per operation
+	listIDs := make([]int64, 0, len(b.lists))
+	for id := range b.lists {
+		listIDs = append(listIDs, id)
+	}
+	sort.Slice(listIDs, func(i, j int) bool { return listIDs[i] < listIDs[j] })
+	handlers.BroadcastFrom(c, "batch_applied", map[string]interface{}{
+		"list_ids": listIDs,
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(BatchCreateResponse{Results: results})
+}
+
+// batchOperationFailed sends the error of the operation at index
+func batchOperationFailed(c *fiber.Ctx, index int, op string, err error) error {
+	var opErr *batchOpError
+	if !errors.As(err, &opErr) {
+		log.Printf("[API] Batch operation %d (%s) failed: %v", index, op, err)
+		opErr = opError(handlers.ErrCodeDB, "db_error", nil)
+	}
+	message := i18n.GetF(handlers.RequestLang(c), "api_errors."+opErr.key, opErr.args)
+	return c.Status(handlers.StatusForCode(opErr.code)).JSON(BatchOperationError{
+		ErrorResponse: handlers.NewErrorResponse(c, opErr.code, message),
+		Operation:     index,
+		Op:            op,
+	})
+}
+
+func batchOperationNames() []string {
+	names := make([]string, 0, len(batchOps))
+	for name := range batchOps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveBatchRefs replaces every {"$ref": "<ref>.<field>"} in body by the referenced result field
+func resolveBatchRefs(body json.RawMessage, refs map[string]any) ([]byte, error) {
+	if len(body) == 0 {
+		return []byte("{}"), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, opError(handlers.ErrCodeInvalidJSON, "invalid_json", nil)
+	}
+	v, err := resolveBatchRef(v, refs)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func resolveBatchRef(v any, refs map[string]any) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		if ref, ok := t["$ref"].(string); ok && len(t) == 1 {
+			return lookupBatchRef(ref, refs)
+		}
+		for k, e := range t {
+			r, err := resolveBatchRef(e, refs)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = r
+		}
+	case []any:
+		for i, e := range t {
+			r, err := resolveBatchRef(e, refs)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = r
+		}
+	}
+	return v, nil
+}
+
+// lookupBatchRef resolves "<ref>.<field>", nested fields are separated by further dots
+func lookupBatchRef(ref string, refs map[string]any) (any, error) {
+	name, path, _ := strings.Cut(ref, ".")
+	v, ok := refs[name]
+	if ok && path != "" {
+		for _, field := range strings.Split(path, ".") {
+			var m map[string]any
+			if m, ok = v.(map[string]any); !ok {
+				break
+			}
+			if v, ok = m[field]; !ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.unknown_ref", map[string]any{"ref": ref})
+	}
+	return v, nil
+}
+
+// batchRefValue converts a result to the generic JSON form refs are looked up in
+func batchRefValue(result any) (any, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func decodeBatchBody(body []byte, v any) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return opError(handlers.ErrCodeInvalidJSON, "invalid_json", nil)
+	}
+	return nil
+}
+
+// list loads a list within the batch and checks the token may change it
+func (b *batchTx) list(id int64) (*db.List, error) {
+	list, err := db.GetListByIDTx(b.tx, id)
+	if err == sql.ErrNoRows {
+		return nil, opError(handlers.ErrCodeNotFound, "not_found.list", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !requireListAccess(b.c, list.ID) {
+		return nil, opError(handlers.ErrCodeListForbidden, "list_forbidden", nil)
+	}
+	b.lists[list.ID] = true
+	return list, nil
+}
+
+// section loads a section within the batch, notFound is the not_found variant to report
+func (b *batchTx) section(id int64, notFound string) (*db.Section, error) {
+	section, err := db.GetSectionByIDTx(b.tx, id)
+	if err == sql.ErrNoRows {
+		return nil, opError(handlers.ErrCodeNotFound, "not_found."+notFound, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !requireListAccess(b.c, section.ListID) {
+		return nil, opError(handlers.ErrCodeListForbidden, "list_forbidden", nil)
+	}
+	b.lists[section.ListID] = true
+	return section, nil
+}
+
+// item loads an item within the batch and checks access through its section
+func (b *batchTx) item(id int64) (*db.Item, error) {
+	if id == 0 {
+		return nil, opRequired("id")
+	}
+	item, err := db.GetItemByIDTx(b.tx, id)
+	if err == sql.ErrNoRows {
+		return nil, opError(handlers.ErrCodeNotFound, "not_found.item", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.section(item.SectionID, "section"); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func batchCreateList(b *batchTx, body []byte) (any, error) {
+	if isListScoped(b.c) {
+		return nil, opError(handlers.ErrCodeListForbidden, "list_forbidden", nil)
+	}
+	var req CreateListRequest
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	switch {
+	case req.Name == "":
+		return nil, opRequired("name")
+	case tooLong(req.Name, MaxListNameLength):
+		return nil, opTooLong("name", MaxListNameLength)
+	case len(req.Icon) > MaxIconLength:
+		return nil, opTooLong("icon", MaxIconLength)
+	case req.Name == "[HISTORY]":
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.reserved_name", nil)
+	}
+
+	exists, err := db.ListNameExistsTx(b.tx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, opError(handlers.ErrCodeListNameExists, "list_name_exists", nil)
+	}
+
+	list, err := db.CreateListTx(b.tx, req.Name, NormalizeIcon(req.Icon))
+	if err != nil {
+		return nil, opError(handlers.ErrCodeCreateFailed, "create_failed", nil)
+	}
+	b.lists[list.ID] = true
+	return list, nil
+}
+
+func batchCreateSection(b *batchTx, body []byte) (any, error) {
+	var req CreateSectionRequest
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	switch {
+	case req.Name == "":
+		return nil, opRequired("name")
+	case req.ListID == 0:
+		return nil, opRequired("list_id")
+	case tooLong(req.Name, MaxSectionNameLength):
+		return nil, opTooLong("name", MaxSectionNameLength)
+	case req.Name == "[HISTORY]":
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.reserved_name", nil)
+	}
+
+	if _, err := b.list(req.ListID); err != nil {
+		return nil, err
+	}
+	section, err := db.CreateSectionForListTx(b.tx, req.ListID, req.Name, db.GetMaxSectionOrderTx(b.tx, req.ListID)+1)
+	if err != nil {
+		return nil, opError(handlers.ErrCodeCreateFailed, "create_failed", nil)
+	}
+	return section, nil
+}
+
+func batchUpdateSection(b *batchTx, body []byte) (any, error) {
+	var req batchSectionUpdate
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	switch {
+	case req.ID == 0:
+		return nil, opRequired("id")
+	case req.Name == "":
+		return nil, opRequired("name")
+	case tooLong(req.Name, MaxSectionNameLength):
+		return nil, opTooLong("name", MaxSectionNameLength)
+	case req.Name == "[HISTORY]":
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.reserved_name", nil)
+	}
+
+	if _, err := b.section(req.ID, "section"); err != nil {
+		return nil, err
+	}
+	section, err := db.UpdateSectionTx(b.tx, req.ID, req.Name)
+	if err != nil {
+		return nil, opError(handlers.ErrCodeUpdateFailed, "update_failed", nil)
+	}
+	return section, nil
+}
+
+func batchCreateItem(b *batchTx, body []byte) (any, error) {
+	var req CreateItemRequest
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	switch {
+	case req.Name == "":
+		return nil, opRequired("name")
+	case req.SectionID == 0:
+		return nil, opRequired("section_id")
+	case tooLong(req.Name, MaxItemNameLength):
+		return nil, opTooLong("name", MaxItemNameLength)
+	case tooLong(req.Description, MaxDescriptionLength):
+		return nil, opTooLong("description", MaxDescriptionLength)
+	}
+
+	priceCents, currency, _, detail := mergeItemPrice(&db.Item{}, req.Price, req.Currency)
+	if detail != "" {
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": detail})
+	}
+	dueDate, err := handlers.ParseDueDate(req.DueDate)
+	if err != nil {
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+
+	if _, err := b.section(req.SectionID, "section"); err != nil {
+		return nil, err
+	}
+	item, err := db.CreateItemWithFieldsTx(b.tx, req.SectionID, db.ItemFields{
+		Name: req.Name, Description: req.Description, Quantity: req.Quantity,
+		Price: &db.ItemPrice{Cents: priceCents, Currency: currency}, DueDate: &dueDate,
+	})
+	if err != nil {
+		return nil, opError(handlers.ErrCodeCreateFailed, "create_failed", nil)
+	}
+	db.SaveItemHistoryTx(b.tx, req.Name, req.SectionID)
+	return ItemResponse{Item: *item, Warnings: dueDateWarnings(b.c, dueDate)}, nil
+}
+
+func batchUpdateItem(b *batchTx, body []byte) (any, error) {
+	var req batchItemUpdate
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	existing, err := b.item(req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Same merging as UpdateItem
+	name, description, quantity, key, args := mergeItemFields(existing, req.UpdateItemRequest)
+	if key != "" {
+		return nil, opError(handlers.ErrCodeValidation, key, args)
+	}
+
+	priceCents, currency, priceChanged, detail := mergeItemPrice(existing, req.Price, req.Currency)
+	if detail != "" {
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": detail})
+	}
+	var warnings []ValidationWarning
+	if req.DueDate != nil {
+		dueDate, err := handlers.ParseDueDate(*req.DueDate)
+		if err != nil {
+			return nil, opError(handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+		}
+		req.DueDate, warnings = &dueDate, dueDateWarnings(b.c, dueDate)
+	}
+
+	fields := db.ItemFields{Name: name, Description: description, Quantity: quantity, DueDate: req.DueDate}
+	if priceChanged {
+		fields.Price = &db.ItemPrice{Cents: priceCents, Currency: currency}
+	}
+	item, err := db.UpdateItemWithFieldsTx(b.tx, req.ID, fields)
+	if err != nil {
+		return nil, opError(handlers.ErrCodeUpdateFailed, "update_failed", nil)
+	}
+	return ItemResponse{Item: *item, Warnings: warnings}, nil
+}
+
+func batchToggleItem(b *batchTx, body []byte) (any, error) {
+	var req batchTarget
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	if _, err := b.item(req.ID); err != nil {
+		return nil, err
+	}
+	item, err := db.ToggleItemCompletedTx(b.tx, req.ID)
+	if err != nil {
+		return nil, opError(handlers.ErrCodeToggleFailed, "toggle_failed", nil)
+	}
+	return item, nil
+}
+
+func batchToggleUncertain(b *batchTx, body []byte) (any, error) {
+	var req batchTarget
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	if _, err := b.item(req.ID); err != nil {
+		return nil, err
+	}
+	item, err := db.ToggleItemUncertainTx(b.tx, req.ID)
+	if err != nil {
+		return nil, opError(handlers.ErrCodeToggleFailed, "toggle_failed", nil)
+	}
+	return item, nil
+}
+
+func batchMoveItem(b *batchTx, body []byte) (any, error) {
+	var req batchItemMove
+	if err := decodeBatchBody(body, &req); err != nil {
+		return nil, err
+	}
+	if req.SectionID == 0 {
+		return nil, opRequired("section_id")
+	}
+	if _, err := b.item(req.ID); err != nil {
+		return nil, err
+	}
+	if _, err := b.section(req.SectionID, "target_section"); err != nil {
+		return nil, err
+	}
+	item, err := db.MoveItemToSectionTx(b.tx, req.ID, req.SectionID)
+	if err != nil {
+		return nil, opError(handlers.ErrCodeMoveFailed, "move_failed", nil)
+	}
+	return item, nil
+}
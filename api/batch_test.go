@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// batchOp builds one step of an operations batch
+func batchOp(op, ref string, body any) map[string]any {
+	return map[string]any{"op": op, "ref": ref, "body": body}
+}
+
+// ref is a {"$ref": ...} value of a batch body
+func ref(path string) map[string]any {
+	return map[string]any{"$ref": path}
+}
+
+// sendBatch posts operations to the batch endpoint with token
+func sendBatch(t *testing.T, app *fiber.App, token string, ops []map[string]any) (int, []byte) {
+	t.Helper()
+	return apiRequest(t, app, http.MethodPost, "/api/v1/batch", token, map[string]any{"operations": ops})
+}
+
+// listNamed returns the list named name, nil if there is none
+func listNamed(t *testing.T, name string) *db.List {
+	t.Helper()
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range lists {
+		if lists[i].Name == name {
+			return &lists[i]
+		}
+	}
+	return nil
+}
+
+func TestBatchOperations(t *testing.T) {
+	app := setupTestAPI(t)
+	groceries, food, bread := createTestItem(t, "Groceries", "Bread")
+	conn := dialEvents(t)
+
+	status, body := sendBatch(t, app, testMasterToken, []map[string]any{
+		batchOp("create_list", "bbq", map[string]any{"name": "BBQ", "icon": "🔥"}),
+		batchOp("create_section", "grill", map[string]any{"list_id": ref("bbq.id"), "name": "Grill"}),
+		batchOp("create_item", "charcoal", map[string]any{"section_id": ref("grill.id"), "name": "Charcoal", "quantity": 2}),
+		batchOp("create_item", "tongs", map[string]any{"section_id": ref("grill.id"), "name": "Tongs"}),
+		batchOp("update_item", "", map[string]any{"id": ref("tongs.id"), "description": "long ones"}),
+		batchOp("toggle_item", "", map[string]any{"id": ref("charcoal.id")}),
+		batchOp("toggle_uncertain", "", map[string]any{"id": bread.ID}),
+		batchOp("move_item", "", map[string]any{"id": bread.ID, "section_id": ref("grill.id")}),
+		batchOp("update_section", "", map[string]any{"id": ref("grill.id"), "name": "Fire"}),
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("batch: status %d, body %s", status, body)
+	}
+	var resp struct {
+		Results []struct {
+			Op     string          `json:"op"`
+			Ref    string          `json:"ref"`
+			Result json.RawMessage `json:"result"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	var ops []string
+	for _, r := range resp.Results {
+		ops = append(ops, r.Op+":"+r.Ref)
+	}
+	want := []string{"create_list:bbq", "create_section:grill", "create_item:charcoal", "create_item:tongs",
+		"update_item:", "toggle_item:", "toggle_uncertain:", "move_item:", "update_section:"}
+	if !reflect.DeepEqual(ops, want) {
+		t.Fatalf("results = %v, want %v", ops, want)
+	}
+
+	// Every step saw the results of the ones before it
+	bbq := listNamed(t, "BBQ")
+	if bbq == nil || bbq.Icon != "🔥" {
+		t.Fatalf("BBQ list = %+v, want it created with its icon", bbq)
+	}
+	sections, err := db.GetSectionsByList(bbq.ID)
+	if err != nil || len(sections) != 1 || sections[0].Name != "Fire" {
+		t.Fatalf("BBQ sections = %+v, %v, want the renamed Fire", sections, err)
+	}
+	items := map[string]db.Item{}
+	for _, item := range sections[0].Items {
+		items[item.Name] = item
+	}
+	if charcoal := items["Charcoal"]; !charcoal.Completed || charcoal.Quantity != 2 {
+		t.Errorf("charcoal = %+v, want completed with quantity 2", charcoal)
+	}
+	if tongs := items["Tongs"]; tongs.Description != "long ones" {
+		t.Errorf("tongs = %+v, want the updated description", tongs)
+	}
+	if moved := items["Bread"]; moved.ID != bread.ID || !moved.Uncertain {
+		t.Errorf("bread = %+v, want it uncertain and moved into Fire", moved)
+	}
+	if got := sectionItemIDs(t, food.ID); len(got) != 0 {
+		t.Errorf("Food still holds %v", got)
+	}
+
+	// One event for the whole batch, naming every list it touched
+	event := readEvent(t, conn)
+	var data struct {
+		ListIDs []int64 `json:"list_ids"`
+	}
+	json.Unmarshal(event.Data, &data)
+	if event.Type != "batch_applied" || !reflect.DeepEqual(data.ListIDs, []int64{groceries.ID, bbq.ID}) {
+		t.Errorf("event = %s %s, want batch_applied for both lists", event.Type, event.Data)
+	}
+	noEvent(t, conn)
+}
+
+func TestBatchOperationsRollBack(t *testing.T) {
+	app := setupTestAPI(t)
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	_, food, bread := createTestItem(t, "Groceries", "Bread")
+	conn := dialEvents(t)
+
+	createBBQ := batchOp("create_list", "bbq", map[string]any{"name": "BBQ"})
+	toggleBread := batchOp("toggle_item", "", map[string]any{"id": bread.ID})
+	cases := []struct {
+		name      string
+		ops       []map[string]any
+		code      string
+		operation int
+		op        string
+	}{
+		{"validation failure mid-batch", []map[string]any{createBBQ, toggleBread,
+			batchOp("create_section", "", map[string]any{"list_id": ref("bbq.id"), "name": ""})},
+			handlers.ErrCodeValidation, 2, "create_section"},
+		{"unknown ref", []map[string]any{createBBQ,
+			batchOp("create_section", "", map[string]any{"list_id": ref("grill.id"), "name": "Grill"})},
+			handlers.ErrCodeValidation, 1, "create_section"},
+		{"unknown field of a ref", []map[string]any{createBBQ,
+			batchOp("create_section", "", map[string]any{"list_id": ref("bbq.owner"), "name": "Grill"})},
+			handlers.ErrCodeValidation, 1, "create_section"},
+		{"ref to a later operation", []map[string]any{
+			batchOp("create_section", "", map[string]any{"list_id": ref("bbq.id"), "name": "Grill"}), createBBQ},
+			handlers.ErrCodeValidation, 0, "create_section"},
+		{"unknown op", []map[string]any{createBBQ, batchOp("delete_list", "", map[string]any{"id": 1})},
+			handlers.ErrCodeValidation, 1, "delete_list"},
+		{"duplicate ref", []map[string]any{createBBQ, batchOp("create_list", "bbq", map[string]any{"name": "Other"})},
+			handlers.ErrCodeValidation, 1, "create_list"},
+		{"dotted ref", []map[string]any{batchOp("create_list", "bbq.list", map[string]any{"name": "BBQ"})},
+			handlers.ErrCodeValidation, 0, "create_list"},
+		{"missing item", []map[string]any{createBBQ, batchOp("toggle_item", "", map[string]any{"id": 9999})},
+			handlers.ErrCodeNotFound, 1, "toggle_item"},
+		{"missing target section", []map[string]any{toggleBread,
+			batchOp("move_item", "", map[string]any{"id": bread.ID, "section_id": 9999})},
+			handlers.ErrCodeNotFound, 1, "move_item"},
+		{"existing list name", []map[string]any{createBBQ, batchOp("create_list", "", map[string]any{"name": "Groceries"})},
+			handlers.ErrCodeListNameExists, 1, "create_list"},
+		{"body that is not an object", []map[string]any{createBBQ, batchOp("create_item", "", "Milk")},
+			handlers.ErrCodeInvalidJSON, 1, "create_item"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := sendBatch(t, app, testMasterToken, tc.ops)
+			var resp BatchOperationError
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+			if status != handlers.StatusForCode(tc.code) || resp.Error != tc.code || resp.Operation != tc.operation || resp.Op != tc.op {
+				t.Errorf("status %d, body %s, want %s at operation %d (%s)", status, body, tc.code, tc.operation, tc.op)
+			}
+			if resp.Message == "" || strings.HasPrefix(resp.Message, "api_errors.") {
+				t.Errorf("body %s, want a translated message", body)
+			}
+
+			// Nothing of the batch is applied
+			if list := listNamed(t, "BBQ"); list != nil {
+				t.Errorf("a failed batch created %+v", list)
+			}
+			if item, err := db.GetItemByID(bread.ID); err != nil || item.Completed || item.SectionID != food.ID {
+				t.Errorf("a failed batch changed bread: %+v, %v", item, err)
+			}
+		})
+	}
+
+	tooMany := make([]map[string]any, MaxBatchOperations+1)
+	for i := range tooMany {
+		tooMany[i] = batchOp("create_list", "", map[string]any{"name": fmt.Sprintf("List %d", i)})
+	}
+	if status, body := sendBatch(t, app, testMasterToken, tooMany); status != http.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeValidation {
+		t.Errorf("%d operations: status %d, body %s, want 400", len(tooMany), status, body)
+	}
+	if lists, _ := db.GetAllLists(); len(lists) != 1 {
+		t.Errorf("%d lists after the rejected batches, want 1", len(lists))
+	}
+	noEvent(t, conn)
+}
+
+func TestBatchOperationsListToken(t *testing.T) {
+	app := setupTestAPI(t)
+	groceries, food, bread := createTestItem(t, "Groceries", "Bread")
+	_, tools, nails := createTestItem(t, "Hardware", "Nails")
+	token := createListToken(t, app, groceries.ID, "write").Token
+
+	// Within its own list the token may do everything
+	status, body := sendBatch(t, app, token, []map[string]any{
+		batchOp("create_section", "bakery", map[string]any{"list_id": groceries.ID, "name": "Bakery"}),
+		batchOp("move_item", "", map[string]any{"id": bread.ID, "section_id": ref("bakery.id")}),
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("batch within its list: status %d, body %s", status, body)
+	}
+
+	// Access is checked per operation, a step outside the list fails the whole batch
+	cases := []struct {
+		name      string
+		ops       []map[string]any
+		operation int
+	}{
+		{"new list", []map[string]any{batchOp("create_list", "", map[string]any{"name": "Mine"})}, 0},
+		{"item into a foreign section", []map[string]any{
+			batchOp("create_item", "milk", map[string]any{"section_id": food.ID, "name": "Milk"}),
+			batchOp("move_item", "", map[string]any{"id": ref("milk.id"), "section_id": tools.ID})}, 1},
+		{"foreign item", []map[string]any{
+			batchOp("create_item", "", map[string]any{"section_id": food.ID, "name": "Milk"}),
+			batchOp("toggle_item", "", map[string]any{"id": nails.ID})}, 1},
+		{"foreign section", []map[string]any{batchOp("update_section", "", map[string]any{"id": tools.ID, "name": "Mine"})}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := sendBatch(t, app, token, tc.ops)
+			var resp BatchOperationError
+			json.Unmarshal(body, &resp)
+			if status != http.StatusForbidden || resp.Error != handlers.ErrCodeListForbidden || resp.Operation != tc.operation {
+				t.Errorf("status %d, body %s, want 403 at operation %d", status, body, tc.operation)
+			}
+		})
+	}
+	if got := sectionItemIDs(t, food.ID); len(got) != 0 {
+		t.Errorf("forbidden batches left items %v in Food", got)
+	}
+	if item, err := db.GetItemByID(nails.ID); err != nil || item.Completed {
+		t.Errorf("nails = %+v, %v, want them untouched", item, err)
+	}
+}
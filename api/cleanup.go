@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"shopping-list/handlers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CleanupRequest for manually running the completed-items cleanup
+type CleanupRequest struct {
+	DryRun bool `json:"dry_run"`
+	Days   *int `json:"days,omitempty"`
+}
+
+// RunCleanup removes completed items older than the configured age, or reports them with dry_run
+func RunCleanup(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req CleanupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+		}
+	}
+
+	days := handlers.AutoCleanupDays()
+	if req.Days != nil {
+		days = *req.Days
+	}
+	if days < 1 {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.min", map[string]any{"field": "days", "min": 1})
+	}
+
+	report, err := handlers.RunCleanup(time.Now(), days, req.DryRun)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeCleanupFailed, "cleanup_failed")
+	}
+
+	return c.JSON(report)
+}
+
+// FileCleanupRequest for removing orphaned files
+type FileCleanupRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// CleanupFiles removes files in the data directory no longer referenced by the database
+func CleanupFiles(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req FileCleanupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+		}
+	}
+
+	report, err := handlers.CleanupFiles(req.DryRun)
+	var busy *handlers.OperationBusyError
+	if errors.As(err, &busy) {
+		return handlers.OperationConflict(c, busy)
+	}
+	if err != nil {
+		return apiError(c, handlers.ErrCodeCleanupFailed, "cleanup_failed")
+	}
+
+	if !req.DryRun {
+		auditAdmin(c, "cleanup_files", fmt.Sprintf("files=%d freed_bytes=%d", len(report.Files), report.FreedBytes))
+	}
+
+	return c.JSON(report)
+}
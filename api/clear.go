@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClearRequest selects which data to delete
+type ClearRequest struct {
+	Targets      []string `json:"targets"`
+	Confirmation string   `json:"confirmation"`
+}
+
+// ClearData deletes only the selected kinds of data in one transaction
+func ClearData(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req ClearRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	if req.Confirmation != "DELETE" {
+		return apiErrorF(c, handlers.ErrCodeInvalidConfirmation, "invalid_confirmation.clear", map[string]any{
+			"word": "DELETE",
+		})
+	}
+
+	if len(req.Targets) == 0 {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required_one_of", map[string]any{
+			"field": "targets", "valid": strings.Join(db.AllClearTargets(), ", "),
+		})
+	}
+	for _, t := range req.Targets {
+		if !db.IsClearTarget(t) {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.unknown_value", map[string]any{
+				"field": "targets", "value": t, "valid": strings.Join(db.AllClearTargets(), ", "),
+			})
+		}
+	}
+
+	cleared, err := handlers.ClearData(req.Targets)
+	var busy *handlers.OperationBusyError
+	if errors.As(err, &busy) {
+		return handlers.OperationConflict(c, busy)
+	}
+	if err != nil {
+		return apiError(c, handlers.ErrCodeClearFailed, "clear_failed")
+	}
+
+	auditAdmin(c, "clear", strings.Join(req.Targets, ","))
+
+	return c.JSON(cleared)
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetDBStats returns the database pragmas in effect and connection pool usage
+func GetDBStats(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	stats, err := db.GetConnStats()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	return c.JSON(stats)
+}
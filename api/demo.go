@@ -0,0 +1,55 @@
+package api
+
+import (
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SeedDemoRequest confirms replacing existing data when force=true
+type SeedDemoRequest struct {
+	Confirmation string `json:"confirmation"`
+}
+
+// SeedDemo fills an empty database with localized example data
+// With force=true and the DELETE confirmation existing data is cleared first
+func SeedDemo(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req SeedDemoRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+		}
+	}
+
+	force := c.QueryBool("force")
+	if force && req.Confirmation != "DELETE" {
+		return apiErrorF(c, handlers.ErrCodeInvalidConfirmation, "invalid_confirmation.replace", map[string]any{
+			"word": "DELETE",
+		})
+	}
+
+	if !force {
+		empty, err := handlers.IsDatabaseEmpty()
+		if err != nil {
+			return apiError(c, handlers.ErrCodeDB, "db_error")
+		}
+		if !empty {
+			return apiError(c, handlers.ErrCodeNotEmpty, "not_empty")
+		}
+	} else if _, err := handlers.ClearData(db.ClearTargets); err != nil {
+		return apiError(c, handlers.ErrCodeClearFailed, "clear_failed")
+	}
+
+	result, err := handlers.SeedDemo(handlers.RequestLang(c))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeSeedFailed, "seed_failed")
+	}
+
+	auditAdmin(c, "seed_demo", result.Lang)
+	return c.Status(fiber.StatusCreated).JSON(result)
+}
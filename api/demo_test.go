@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSeedDemoEndpoint(t *testing.T) {
+	app := setupTestAPI(t)
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := apiRequest(t, app, "POST", "/api/v1/admin/seed-demo?lang=pl", testMasterToken, nil)
+	var result handlers.SeedResult
+	if status != fiber.StatusCreated || json.Unmarshal(body, &result) != nil {
+		t.Fatalf("seed an empty database: %d %s", status, body)
+	}
+	if result.Lang != "pl" || result.Lists == 0 || result.Items == 0 || result.Templates != 1 {
+		t.Errorf("result = %+v, want Polish lists, items and a template", result)
+	}
+	if e := lastAudit(t); e.Action != "seed_demo" || e.Details != "pl" {
+		t.Errorf("audit entry = %+v, want the seed", e)
+	}
+
+	// Seeding again needs force and the confirmation, and then replaces the data
+	status, body = apiRequest(t, app, "POST", "/api/v1/admin/seed-demo?lang=en", testMasterToken, nil)
+	if status != fiber.StatusConflict || errorCode(t, body) != handlers.ErrCodeNotEmpty {
+		t.Errorf("seed a database with data: %d %s, want 409", status, body)
+	}
+	status, body = apiRequest(t, app, "POST", "/api/v1/admin/seed-demo?lang=en&force=true", testMasterToken, SeedDemoRequest{Confirmation: "delete"})
+	if status != fiber.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeInvalidConfirmation {
+		t.Errorf("force without the confirmation: %d %s, want 400", status, body)
+	}
+	status, body = apiRequest(t, app, "POST", "/api/v1/admin/seed-demo?lang=en&force=true", testMasterToken, SeedDemoRequest{Confirmation: "DELETE"})
+	if status != fiber.StatusCreated || json.Unmarshal(body, &result) != nil || result.Lang != "en" {
+		t.Fatalf("forced seed: %d %s", status, body)
+	}
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != result.Lists || lists[0].Name != "Weekly groceries" {
+		t.Errorf("%d lists starting with %q, want only the English examples", len(lists), lists[0].Name)
+	}
+}
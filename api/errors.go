@@ -0,0 +1,20 @@
+package api
+
+import (
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiError sends an ErrorResponse with the api_errors.<key> message in the request language
+// The status follows from the code, see handlers.StatusForCode.
+// By convention key is the code itself, or "<code>.<variant>" for codes with several messages
+func apiError(c *fiber.Ctx, code, key string) error {
+	return apiErrorF(c, code, key, nil)
+}
+
+// apiErrorF is apiError with {{name}} placeholders in the message filled from args
+func apiErrorF(c *fiber.Ctx, code, key string, args map[string]any) error {
+	return handlers.Fail(c, code, i18n.GetF(handlers.RequestLang(c), "api_errors."+key, args))
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+)
+
+func TestValidationErrorsInRequestLanguage(t *testing.T) {
+	app := setupTestAPI(t)
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	longName := strings.Repeat("x", MaxListNameLength+1)
+
+	cases := []struct {
+		name, query, acceptLanguage, body, want string
+	}{
+		{"English by default", "", "", `{"name":""}`, "name is required"},
+		{"Ukrainian by query", "?lang=uk", "", `{"name":""}`, "name є обов'язковим"},
+		{"Ukrainian by Accept-Language", "", "uk-UA,uk;q=0.9,en;q=0.5", `{"name":""}`, "name є обов'язковим"},
+		{"Ukrainian with a limit", "?lang=uk", "", `{"name":"` + longName + `"}`, "name перевищує максимальну довжину 100 символів"},
+		{"Ukrainian invalid JSON", "?lang=uk", "", `{`, "Не вдалося розібрати тіло запиту"},
+		{"Polish reserved name", "?lang=pl", "", `{"name":"[HISTORY]"}`, "Ta nazwa jest zarezerwowana dla systemu"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/lists"+tc.query, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+testMasterToken)
+			if tc.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tc.acceptLanguage)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			var body handlers.ErrorResponse
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("decode %q: %v", data, err)
+			}
+
+			// The code is the machine contract and never translated
+			wantCode := handlers.ErrCodeValidation
+			if tc.body == `{` {
+				wantCode = handlers.ErrCodeInvalidJSON
+			}
+			if resp.StatusCode != http.StatusBadRequest || body.Error != wantCode {
+				t.Errorf("got %d %q, want 400 %q", resp.StatusCode, body.Error, wantCode)
+			}
+			if body.Message != tc.want {
+				t.Errorf("message = %q, want %q", body.Message, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"database/sql"
+	"net/url"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Lifetimes of export download links in seconds
+const (
+	defaultExportLinkTTL = 3600
+	maxExportLinkTTL     = 7 * 24 * 3600
+)
+
+// CreateExportLinkRequest asks for a download link of the full export, or of one list with list_id
+type CreateExportLinkRequest struct {
+	ListID    int64             `json:"list_id,omitempty"`
+	Format    string            `json:"format,omitempty"`     // Format of the export, json by default
+	Params    map[string]string `json:"params,omitempty"`     // Further query parameters of the export, such as delimiter or include_history
+	ExpiresIn int               `json:"expires_in,omitempty"` // Seconds the link stays valid, 3600 by default and at most 604800
+}
+
+// CreateExportLinkResponse is a signed link that downloads the export without a session or token
+type CreateExportLinkResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateExportLink returns a signed, expiring URL of GET /export/download for browsers that cannot send
+// the Authorization header. List-scoped tokens may only link their list
+func CreateExportLink(c *fiber.Ctx) error {
+	var req CreateExportLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	if req.Format == "" {
+		req.Format = "json"
+	}
+	formats := handlers.ExportLinkFormats
+	if req.ListID != 0 {
+		formats = handlers.ExportListLinkFormats
+	}
+	if !slices.Contains(formats, req.Format) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.unknown_value", map[string]any{
+			"field": "format", "value": req.Format, "valid": strings.Join(formats, ", "),
+		})
+	}
+
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = defaultExportLinkTTL
+	}
+	if req.ExpiresIn < 1 || req.ExpiresIn > maxExportLinkTTL {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{
+			"detail": "expires_in must be between 1 and " + strconv.Itoa(maxExportLinkTTL) + " seconds",
+		})
+	}
+
+	if req.ListID == 0 && isListScoped(c) {
+		return listForbidden(c)
+	}
+	if req.ListID != 0 {
+		if !requireListAccess(c, req.ListID) {
+			return listForbidden(c)
+		}
+		if _, err := db.GetListByID(req.ListID); err != nil {
+			if err == sql.ErrNoRows {
+				return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+			}
+			return apiError(c, handlers.ErrCodeDB, "db_error")
+		}
+	}
+
+	query := url.Values{}
+	for key, value := range req.Params {
+		switch key {
+		case "format", "list_id", "exp", "sig":
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{
+				"detail": "params may not set " + key,
+			})
+		}
+		query.Set(key, value)
+	}
+	query.Set("format", req.Format)
+	if req.ListID != 0 {
+		query.Set("list_id", strconv.FormatInt(req.ListID, 10))
+	}
+
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second).Truncate(time.Second)
+	return c.Status(fiber.StatusCreated).JSON(CreateExportLinkResponse{
+		URL:       c.BaseURL() + handlers.SignExportLink(query, expiresAt),
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
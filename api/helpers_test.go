@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// testMasterToken is the API_TOKEN of the test app
+const testMasterToken = "test-master-token"
+
+// setupTestAPI opens a fresh database and returns an app with the API routes registered
+func setupTestAPI(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("API_TOKEN", testMasterToken)
+	db.Init()
+	t.Cleanup(db.Close)
+
+	// Token IDs start over with every database, so must the last-used throttle
+	lastUsedMu.Lock()
+	lastUsedWritten = make(map[int64]time.Time)
+	lastUsedMu.Unlock()
+
+	app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+	Register(app)
+	return app
+}
+
+// apiRequest sends a request with token as Bearer token and body encoded as JSON
+// It returns the status and the raw response body
+func apiRequest(t *testing.T, app *fiber.App, method, path, token string, body any) (int, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return resp.StatusCode, data
+}
+
+// errorCode returns the error code of an ErrorResponse body
+func errorCode(t *testing.T, body []byte) string {
+	t.Helper()
+	var resp handlers.ErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode error response %q: %v", body, err)
+	}
+	return resp.Error
+}
+
+// createTestItem creates a list with one section holding one item
+func createTestItem(t *testing.T, listName, itemName string) (*db.List, *db.Section, *db.Item) {
+	t.Helper()
+	list, err := db.CreateList(listName, "")
+	if err != nil {
+		t.Fatalf("create list: %v", err)
+	}
+	section, err := db.CreateSectionForList(list.ID, "Section")
+	if err != nil {
+		t.Fatalf("create section: %v", err)
+	}
+	item, err := db.CreateItem(section.ID, itemName, "", 1)
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	return list, section, item
+}
+
+// testEvent is a broadcast read by a client from dialEvents, with its data left encoded
+type testEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// dialEvents connects a WebSocket client that receives the broadcasts of the handlers
+func dialEvents(t *testing.T) *fastws.Conn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", websocket.New(handlers.WebSocketHandler))
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	conn, _, err := fastws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// The handler answers pings once the client is registered for broadcasts
+	if err := conn.WriteJSON(map[string]string{"type": "ping"}); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if event := readEvent(t, conn); event.Type != "pong" {
+		t.Fatalf("first message = %q, want pong", event.Type)
+	}
+	return conn
+}
+
+// readEvent reads the next broadcast, failing the test if none arrives within two seconds
+func readEvent(t *testing.T, conn *fastws.Conn) testEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	var event testEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("decode event %s: %v", data, err)
+	}
+	return event
+}
+
+// noEvent fails the test if a broadcast arrives within a short wait, conn cannot be read after it
+func noEvent(t *testing.T, conn *fastws.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := conn.ReadMessage(); err == nil {
+		t.Errorf("unexpected event %s", data)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"shopping-list/db"
+	"shopping-list/handlers"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -24,18 +25,25 @@ type BatchDeleteHistoryRequest struct {
 
 // GetHistory returns all history items
 func GetHistory(c *fiber.Ctx) error {
+	version, err := db.HistoryVersion()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	lang := handlers.RequestLang(c)
+	if handlers.NotModified(c, version, lang) {
+		return handlers.NotModifiedResponse(c)
+	}
+
 	items, err := db.GetItemHistoryList()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch history",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if items == nil {
 		items = []db.HistoryItem{}
 	}
 
+	handlers.LocalizeHistory(items, lang)
 	return c.JSON(HistoryResponse{Items: items})
 }
 
@@ -43,23 +51,16 @@ func GetHistory(c *fiber.Ctx) error {
 func CreateHistory(c *fiber.Ctx) error {
 	var req CreateHistoryRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "name"})
 	}
 
-	if len(req.Name) > MaxItemNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 200 characters",
+	if tooLong(req.Name, MaxItemNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "name", "max": MaxItemNameLength,
 		})
 	}
 
@@ -67,18 +68,12 @@ func CreateHistory(c *fiber.Ctx) error {
 	if req.SectionID != 0 {
 		_, err := db.GetSectionByID(req.SectionID)
 		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
 	}
 
 	if err := db.SaveItemHistory(req.Name, req.SectionID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to save history",
-		})
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -91,17 +86,11 @@ func CreateHistory(c *fiber.Ctx) error {
 func DeleteHistory(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid history ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "history_id"})
 	}
 
 	if err := db.DeleteItemHistory(int64(id)); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-			Error:   "not_found",
-			Message: "History entry not found",
-		})
+		return apiError(c, handlers.ErrCodeNotFound, "not_found.history")
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
@@ -111,25 +100,16 @@ func DeleteHistory(c *fiber.Ctx) error {
 func BatchDeleteHistory(c *fiber.Ctx) error {
 	var req BatchDeleteHistoryRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	if len(req.IDs) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "IDs array is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "ids"})
 	}
 
 	deleted, err := db.DeleteItemHistoryBatch(req.IDs)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete history entries",
-		})
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
 	}
 
 	return c.JSON(fiber.Map{
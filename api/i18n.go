@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTranslationOverrides lists the overridden translation keys per language
+func GetTranslationOverrides(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	return c.JSON(fiber.Map{"overrides": i18n.Overrides()})
+}
+
+// ReloadTranslations re-reads the translation override files and reports problems per file
+func ReloadTranslations(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	report, err := handlers.ReloadTranslationOverrides()
+	if errors.Is(err, handlers.ErrOverridesDisabled) {
+		return apiError(c, handlers.ErrCodeNotConfigured, "not_configured")
+	}
+	if err != nil {
+		return apiError(c, handlers.ErrCodeReloadFailed, "reload_failed")
+	}
+
+	applied := 0
+	for _, f := range report.Files {
+		applied += f.Applied
+	}
+	auditAdmin(c, "i18n_reload", fmt.Sprintf("files=%d applied=%d", len(report.Files), applied))
+
+	return c.JSON(report)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RepairRequest selects the repair action per orphan category
+type RepairRequest struct {
+	Actions map[string]string `json:"actions"`
+}
+
+// RepairResponse lists what was fixed per category
+type RepairResponse struct {
+	Repaired []db.RepairResult `json:"repaired"`
+}
+
+// GetIntegrity runs database integrity checks and reports orphaned rows
+func GetIntegrity(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	report, err := db.CheckIntegrity()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	auditAdmin(c, "integrity_check", fmt.Sprintf("ok=%v orphans=%d", report.OK, report.TotalOrphans))
+	return c.JSON(report)
+}
+
+// RepairIntegrity deletes or reattaches orphaned rows in one transaction
+func RepairIntegrity(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req RepairRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+		}
+	}
+
+	for category, action := range req.Actions {
+		allowed := db.ValidRepairActions(category)
+		if allowed == nil {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.unknown_value", map[string]any{
+				"field": "category", "value": category, "valid": strings.Join(db.OrphanCategories, ", "),
+			})
+		}
+		valid := false
+		for _, a := range allowed {
+			valid = valid || a == action
+		}
+		if !valid {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.unknown_value", map[string]any{
+				"field": "actions." + category, "value": action, "valid": strings.Join(allowed, ", "),
+			})
+		}
+	}
+
+	results, err := db.RepairOrphans(req.Actions)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeRepairFailed, "repair_failed")
+	}
+
+	var details []string
+	for _, r := range results {
+		if r.Count > 0 {
+			details = append(details, fmt.Sprintf("%s:%s=%d", r.Category, r.Action, r.Count))
+		}
+	}
+	auditAdmin(c, "integrity_repair", strings.Join(details, " "))
+	if len(details) > 0 {
+		handlers.BroadcastFrom(c, "integrity_repaired", results)
+	}
+
+	return c.JSON(RepairResponse{Repaired: results})
+}
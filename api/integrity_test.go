@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// seedOrphanedRows writes a section without a list and an item without a section, as a crash would leave them
+func seedOrphanedRows(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, stmt := range []string{
+		"PRAGMA foreign_keys = OFF",
+		"INSERT INTO sections (id, list_id, name, sort_order) VALUES (9001, 999, 'Lost section', 0)",
+		"INSERT INTO items (id, section_id, name, sort_order) VALUES (9102, 998, 'Eggs', 0)",
+		"PRAGMA foreign_keys = ON",
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+// lastAudit returns the newest audit log entry
+func lastAudit(t *testing.T) db.AuditEntry {
+	t.Helper()
+	entries, err := db.GetAuditLog(1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("audit log = %+v, %v, want an entry", entries, err)
+	}
+	return entries[0]
+}
+
+func TestIntegrityEndpoints(t *testing.T) {
+	app := setupTestAPI(t)
+	list, _, _ := createTestItem(t, "Groceries", "Milk")
+	writeToken := createListToken(t, app, list.ID, ScopeWrite).Token
+	seedOrphanedRows(t)
+	conn := dialEvents(t)
+
+	// Both endpoints are admin only
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/api/v1/admin/integrity"},
+		{"POST", "/api/v1/admin/integrity/repair"},
+	} {
+		status, body := apiRequest(t, app, route.method, route.path, writeToken, nil)
+		if status != fiber.StatusForbidden || errorCode(t, body) != handlers.ErrCodeInsufficientScope {
+			t.Errorf("%s %s with a write token: %d %s, want 403", route.method, route.path, status, body)
+		}
+	}
+
+	status, body := apiRequest(t, app, "GET", "/api/v1/admin/integrity", testMasterToken, nil)
+	var report db.IntegrityReport
+	if status != fiber.StatusOK || json.Unmarshal(body, &report) != nil {
+		t.Fatalf("GET integrity: %d %s", status, body)
+	}
+	if report.OK || report.TotalOrphans != 2 || report.Orphans[0].SampleIDs[0] != 9001 || report.Orphans[1].SampleIDs[0] != 9102 {
+		t.Errorf("report = %+v, want the lost section and item", report)
+	}
+	if e := lastAudit(t); e.Action != "integrity_check" || e.Details != "ok=false orphans=2" || e.Actor != "master" {
+		t.Errorf("audit entry = %+v, want the integrity check", e)
+	}
+
+	// An invalid action is rejected before anything is changed
+	status, body = apiRequest(t, app, "POST", "/api/v1/admin/integrity/repair", testMasterToken,
+		RepairRequest{Actions: map[string]string{db.OrphanTemplateItems: db.RepairMove}})
+	if status != fiber.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeValidation {
+		t.Errorf("repair with an invalid action: %d %s, want 400", status, body)
+	}
+
+	status, body = apiRequest(t, app, "POST", "/api/v1/admin/integrity/repair", testMasterToken,
+		RepairRequest{Actions: map[string]string{db.OrphanSections: db.RepairMove}})
+	var repaired RepairResponse
+	if status != fiber.StatusOK || json.Unmarshal(body, &repaired) != nil {
+		t.Fatalf("repair: %d %s", status, body)
+	}
+	if r := repaired.Repaired; r[0].Action != db.RepairMove || r[0].Count != 1 || r[1].Action != db.RepairDelete || r[1].Count != 1 {
+		t.Errorf("repaired = %+v, want the section moved and the item deleted", r)
+	}
+	if e := lastAudit(t); e.Action != "integrity_repair" || e.Details != "sections:move=1 items:delete=1" {
+		t.Errorf("audit entry = %+v, want the repair", e)
+	}
+	if event := readEvent(t, conn); event.Type != "integrity_repaired" {
+		t.Errorf("event = %s, want integrity_repaired", event.Type)
+	}
+
+	// Once repaired the check passes, and a repair with nothing to fix broadcasts nothing
+	status, body = apiRequest(t, app, "GET", "/api/v1/admin/integrity", testMasterToken, nil)
+	if status != fiber.StatusOK || json.Unmarshal(body, &report) != nil || !report.OK {
+		t.Errorf("GET integrity after repair: %d %s, want ok", status, body)
+	}
+	if status, body := apiRequest(t, app, "POST", "/api/v1/admin/integrity/repair", testMasterToken, nil); status != fiber.StatusOK {
+		t.Errorf("empty repair: %d %s", status, body)
+	}
+	noEvent(t, conn)
+}
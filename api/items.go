@@ -2,8 +2,12 @@ package api
 
 import (
 	"database/sql"
+	"encoding/json"
 	"shopping-list/db"
 	"shopping-list/handlers"
+	"shopping-list/i18n"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -11,30 +15,140 @@ import (
 const (
 	MaxItemNameLength    = 200
 	MaxDescriptionLength = 500
+
+	// defaultDueDays is how far ahead GET /items/due looks without before
+	defaultDueDays = 7
+
+	// MaxBatchItems caps the ids of one POST /items/batch-delete or /items/batch-complete
+	MaxBatchItems = 500
 )
 
+// mergeItemFields applies the name, description and quantity of a request to those of an item, see UpdateItemRequest
+// key and args describe an invalid value, key is empty when they are valid
+func mergeItemFields(item *db.Item, req UpdateItemRequest) (name, description string, quantity int, key string, args map[string]any) {
+	name, description, quantity = item.Name, item.Description, item.Quantity
+	if req.Name != nil {
+		if *req.Name == "" {
+			return "", "", 0, "validation_error.required", map[string]any{"field": "name"}
+		}
+		name = *req.Name
+	}
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if req.Quantity != nil {
+		quantity = *req.Quantity
+	}
+	if tooLong(name, MaxItemNameLength) {
+		return "", "", 0, "validation_error.too_long", map[string]any{"field": "name", "max": MaxItemNameLength}
+	}
+	if tooLong(description, MaxDescriptionLength) {
+		return "", "", 0, "validation_error.too_long", map[string]any{"field": "description", "max": MaxDescriptionLength}
+	}
+	return name, description, quantity, "", nil
+}
+
+// mergeItemPrice applies the price and currency of a request to those of an item, see UpdateItemRequest
+// changed reports whether the request touched them, detail describes an invalid price or currency
+func mergeItemPrice(item *db.Item, price PriceInput, currency *string) (priceCents *int64, code string, changed bool, detail string) {
+	priceCents, code = item.PriceCents, item.Currency
+	if len(price) > 0 {
+		changed = true
+		priceCents = nil
+		if string(price) != "null" {
+			value := string(price)
+			if price[0] == '"' {
+				if err := json.Unmarshal(price, &value); err != nil {
+					return nil, "", false, "price must be a number or a decimal string"
+				}
+			}
+			cents, err := handlers.ParsePrice(value)
+			if err != nil {
+				return nil, "", false, err.Error()
+			}
+			priceCents = &cents
+		}
+	}
+	if currency != nil {
+		changed = true
+		var err error
+		if code, err = handlers.ParseCurrency(*currency); err != nil {
+			return nil, "", false, err.Error()
+		}
+	}
+	return priceCents, code, changed, ""
+}
+
+// dueDateWarnings warns about a due date that was set in the past, which is allowed
+func dueDateWarnings(c *fiber.Ctx, dueDate string) []ValidationWarning {
+	if !handlers.DueDatePast(dueDate) {
+		return nil
+	}
+	return []ValidationWarning{{
+		Field:   "due_date",
+		Code:    "past",
+		Message: i18n.GetF(handlers.RequestLang(c), "api_errors.validation_error.past", map[string]any{"field": "due_date"}),
+	}}
+}
+
+// GetDueItems returns the uncompleted items due before the date in before, by default a week from today,
+// overdue ones included and grouped by list. List-scoped tokens only get the items of their list
+func GetDueItems(c *fiber.Ctx) error {
+	before := time.Now().AddDate(0, 0, defaultDueDays).Format(time.DateOnly)
+	if value := c.Query("before"); value != "" {
+		var err error
+		if before, err = handlers.ParseDueDate(value); err != nil {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": "before must be a date like 2024-05-31"})
+		}
+	}
+
+	lists, err := db.GetDueItems(before, scopedListID(c))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	return c.JSON(DueItemsResponse{Before: before, Lists: lists})
+}
+
+// SearchItems finds items by a part of their name or description across lists, see db.SearchItems
+// List-scoped tokens search their list
+func SearchItems(c *fiber.Ctx) error {
+	opts, err := handlers.ItemSearchQuery(c)
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+	if opts.Query == "" {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "q"})
+	}
+	if scoped := scopedListID(c); scoped != 0 {
+		if opts.ListID != 0 && opts.ListID != scoped {
+			return listForbidden(c)
+		}
+		opts.ListID = scoped
+	}
+
+	results, err := db.SearchItems(opts)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	return c.JSON(results)
+}
+
 // GetItem returns a single item by ID
 func GetItem(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	item, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	return c.JSON(item)
@@ -44,214 +158,290 @@ func GetItem(c *fiber.Ctx) error {
 func CreateItem(c *fiber.Ctx) error {
 	var req CreateItemRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "name"})
 	}
 
 	if req.SectionID == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "section_id is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "section_id"})
 	}
 
-	if len(req.Name) > MaxItemNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 200 characters",
+	if tooLong(req.Name, MaxItemNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "name", "max": MaxItemNameLength,
 		})
 	}
 
-	if len(req.Description) > MaxDescriptionLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Description exceeds maximum length of 500 characters",
+	if tooLong(req.Description, MaxDescriptionLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "description", "max": MaxDescriptionLength,
 		})
 	}
 
+	priceCents, currency, _, detail := mergeItemPrice(&db.Item{}, req.Price, req.Currency)
+	if detail != "" {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": detail})
+	}
+	dueDate, err := handlers.ParseDueDate(req.DueDate)
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+	barcode, err := handlers.ParseBarcode(req.Barcode)
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+
+	if !requireSectionAccess(c, req.SectionID) {
+		return listForbidden(c)
+	}
+
 	// Check if section exists
-	_, err := db.GetSectionByID(req.SectionID)
+	_, err = db.GetSectionByID(req.SectionID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	// The item and its price, due date and barcode are written in one INSERT
+	tx, err := db.BeginWrite()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	defer tx.Rollback()
+
+	// A scanned product still on the list is returned instead of added twice.
+	// The check runs in the write transaction so a concurrent scan cannot slip in before the insert
+	if barcode != "" {
+		if existing, err := openItemWithBarcodeTx(tx, req.SectionID, barcode); err != nil {
+			return apiError(c, handlers.ErrCodeDB, "db_error")
+		} else if existing != nil {
+			return c.Status(handlers.StatusForCode(handlers.ErrCodeDuplicateBarcode)).JSON(BarcodeConflictError{
+				ErrorResponse: handlers.NewErrorResponse(c, handlers.ErrCodeDuplicateBarcode, i18n.Get(handlers.RequestLang(c), "api_errors.duplicate_barcode")),
+				Item:          *existing,
 			})
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
 	}
 
-	item, err := db.CreateItem(req.SectionID, req.Name, req.Description, req.Quantity)
+	item, err := db.CreateItemWithFieldsTx(tx, req.SectionID, db.ItemFields{
+		Name: req.Name, Description: req.Description, Quantity: req.Quantity,
+		Price: &db.ItemPrice{Cents: priceCents, Currency: currency}, DueDate: &dueDate, Barcode: &barcode,
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to create item",
-		})
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
+	}
+	if err := tx.Commit(); err != nil {
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
 	}
 
 	// Save to item history for suggestions
 	db.SaveItemHistory(req.Name, req.SectionID)
+	handlers.RecordItemEvent(c, db.ItemEventCreate, nil, item)
 
-	handlers.BroadcastUpdate("item_created", item)
-	return c.Status(fiber.StatusCreated).JSON(item)
+	handlers.BroadcastFrom(c, "item_created", item)
+	return c.Status(fiber.StatusCreated).JSON(ItemResponse{Item: *item, Warnings: dueDateWarnings(c, dueDate)})
 }
 
 // UpdateItem updates an item
 func UpdateItem(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	var req UpdateItemRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	// Get existing item
 	existing, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
-	name := req.Name
-	if name == "" {
-		name = existing.Name
-	}
-	description := req.Description
-	if description == "" && req.Name != "" {
-		description = existing.Description
+	name, description, quantity, key, args := mergeItemFields(existing, req)
+	if key != "" {
+		return apiErrorF(c, handlers.ErrCodeValidation, key, args)
 	}
 
-	// Use existing quantity if not provided in request
-	quantity := existing.Quantity
-	if req.Quantity != nil {
-		quantity = *req.Quantity
+	priceCents, currency, priceChanged, detail := mergeItemPrice(existing, req.Price, req.Currency)
+	if detail != "" {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": detail})
 	}
-
-	if len(name) > MaxItemNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 200 characters",
-		})
+	var warnings []ValidationWarning
+	if req.DueDate != nil {
+		dueDate, err := handlers.ParseDueDate(*req.DueDate)
+		if err != nil {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+		}
+		req.DueDate, warnings = &dueDate, dueDateWarnings(c, dueDate)
 	}
-
-	if len(description) > MaxDescriptionLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Description exceeds maximum length of 500 characters",
-		})
+	if req.Barcode != nil {
+		barcode, err := handlers.ParseBarcode(*req.Barcode)
+		if err != nil {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+		}
+		req.Barcode = &barcode
 	}
 
-	item, err := db.UpdateItem(int64(id), name, description, quantity)
+	fields := db.ItemFields{Name: name, Description: description, Quantity: quantity, DueDate: req.DueDate, Barcode: req.Barcode}
+	if priceChanged {
+		fields.Price = &db.ItemPrice{Cents: priceCents, Currency: currency}
+	}
+	item, err := db.UpdateItemWithFields(int64(id), fields)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "update_failed",
-			Message: "Failed to update item",
-		})
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
 	}
 
-	handlers.BroadcastUpdate("item_updated", item)
-	return c.JSON(item)
+	handlers.RecordItemEvent(c, db.ItemEventUpdate, existing, item)
+	handlers.BroadcastFrom(c, "item_updated", item)
+	return c.JSON(ItemResponse{Item: *item, Warnings: warnings})
 }
 
 // DeleteItem deletes an item
 func DeleteItem(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
+	existing, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
-	if err := db.DeleteItem(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete item",
-		})
+	// The event is recorded with the delete, in the same transaction
+	if err := db.DeleteItemWithEvent(int64(id), handlers.ItemEventFor(c, db.ItemEventDelete, existing, nil)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
 	}
 
-	handlers.BroadcastUpdate("item_deleted", map[string]int64{"id": int64(id)})
+	handlers.BroadcastFrom(c, "item_deleted", map[string]int64{"id": int64(id)})
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// batchItemIDs checks the ids of a request on several items and drops repeated ones, keeping the order
+func batchItemIDs(ids []int64) ([]int64, *batchOpError) {
+	if len(ids) == 0 {
+		return nil, opRequired("ids")
+	}
+	if len(ids) > MaxBatchItems {
+		return nil, opError(handlers.ErrCodeValidation, "validation_error.too_many", map[string]any{"field": "ids", "max": MaxBatchItems})
+	}
+	unique := make([]int64, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique, nil
+}
+
+// BatchDeleteItems deletes several items in one transaction. IDs without an item are reported in
+// not_found rather than failing the request, for list-scoped tokens so are items of other lists
+func BatchDeleteItems(c *fiber.Ctx) error {
+	var req BatchDeleteItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	ids, invalid := batchItemIDs(req.IDs)
+	if invalid != nil {
+		return apiErrorF(c, invalid.code, invalid.key, invalid.args)
+	}
+
+	deleted, notFound, err := db.DeleteItemsBatch(ids, scopedListID(c))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
+	}
+
+	if len(deleted) > 0 {
+		handlers.BroadcastFrom(c, "items_deleted", map[string]any{"items": deleted})
+	}
+	return c.JSON(BatchDeleteItemsResponse{Deleted: len(deleted), NotFound: notFound})
+}
+
+// BatchCompleteItems sets the completed flag of several items in one transaction, for checking out
+// at once. Unlike toggling, items already in that state stay so and are counted as unchanged
+func BatchCompleteItems(c *fiber.Ctx) error {
+	var req BatchCompleteItemsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+	if req.Completed == nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "completed"})
+	}
+	ids, invalid := batchItemIDs(req.IDs)
+	if invalid != nil {
+		return apiErrorF(c, invalid.code, invalid.key, invalid.args)
+	}
+
+	items, unchanged, notFound, err := db.SetItemsCompleted(ids, *req.Completed, scopedListID(c))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
+	}
+
+	if len(items) > 0 {
+		refs := make([]map[string]int64, len(items))
+		for i, item := range items {
+			refs[i] = map[string]int64{"id": item.ID, "section_id": item.SectionID}
+		}
+		handlers.BroadcastFrom(c, "items_completed", map[string]any{"completed": *req.Completed, "items": refs})
+	}
+	return c.JSON(BatchCompleteItemsResponse{Items: items, Unchanged: unchanged, NotFound: notFound})
+}
+
 // ToggleItemCompleted toggles the completed status
 func ToggleItemCompleted(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
+	existing, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	item, err := db.ToggleItemCompleted(int64(id))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "toggle_failed",
-			Message: "Failed to toggle item",
-		})
+		return apiError(c, handlers.ErrCodeToggleFailed, "toggle_failed")
 	}
+	handlers.RecordItemEvent(c, db.ItemEventToggle, existing, item)
 
-	handlers.BroadcastUpdate("item_toggled", item)
+	handlers.BroadcastFrom(c, "item_toggled", item)
 	return c.JSON(item)
 }
 
@@ -259,36 +449,28 @@ func ToggleItemCompleted(c *fiber.Ctx) error {
 func ToggleItemUncertain(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
+	existing, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	item, err := db.ToggleItemUncertain(int64(id))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "toggle_failed",
-			Message: "Failed to toggle item",
-		})
+		return apiError(c, handlers.ErrCodeToggleFailed, "toggle_failed")
 	}
+	handlers.RecordItemEvent(c, db.ItemEventToggle, existing, item)
 
-	handlers.BroadcastUpdate("item_updated", item)
+	handlers.BroadcastFrom(c, "item_updated", item)
 	return c.JSON(item)
 }
 
@@ -296,102 +478,144 @@ func ToggleItemUncertain(c *fiber.Ctx) error {
 func MoveItem(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	var req MoveItemRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	if req.SectionID == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "section_id is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "section_id"})
+	}
+
+	if !requireSectionAccess(c, req.SectionID) {
+		return listForbidden(c)
 	}
 
 	// Check if item exists
-	_, err = db.GetItemByID(int64(id))
+	existing, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	// Check if target section exists
 	_, err = db.GetSectionByID(req.SectionID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Target section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.target_section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	item, err := db.MoveItemToSection(int64(id), req.SectionID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move item",
-		})
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
 	}
+	handlers.RecordItemEvent(c, db.ItemEventMove, existing, item)
 
-	handlers.BroadcastUpdate("item_moved", item)
+	handlers.BroadcastFrom(c, "item_moved", item)
 	return c.JSON(item)
 }
 
+// MoveItemToList moves an item to the end of a section of another list, found or created by section_name
+// Without a name the item goes to the list's first section, in its own list it stays in its section
+func MoveItemToList(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	var req MoveItemToListRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	if req.ListID == 0 {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "list_id"})
+	}
+	req.SectionName = strings.TrimSpace(req.SectionName)
+	if tooLong(req.SectionName, MaxSectionNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "section_name", "max": MaxSectionNameLength,
+		})
+	}
+	if req.SectionName == "[HISTORY]" {
+		return apiError(c, handlers.ErrCodeValidation, "validation_error.reserved_name")
+	}
+
+	if !requireListAccess(c, req.ListID) {
+		return listForbidden(c)
+	}
+
+	// Check if target list exists
+	if _, err := db.GetListByID(req.ListID); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	move, err := db.MoveItemToList(int64(id), req.ListID, req.SectionName, handlers.DefaultSection(handlers.RequestLang(c)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
+	}
+
+	before := *move.Item
+	before.SectionID = move.From.SectionID
+	handlers.RecordItemEvent(c, db.ItemEventMove, &before, move.Item)
+
+	if move.CreatedSection != nil {
+		handlers.BroadcastFrom(c, "section_created", move.CreatedSection)
+	}
+	moved := ItemMovedResponse{
+		Item:           *move.Item,
+		ListID:         move.ListID,
+		FromSectionID:  move.From.SectionID,
+		FromListID:     move.From.ListID,
+		CreatedSection: move.CreatedSection,
+	}
+	handlers.BroadcastFrom(c, "item_moved", moved)
+	return c.JSON(moved)
+}
+
 // MoveItemUp moves an item up in sort order
 func MoveItemUp(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if item exists
 	item, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.MoveItemUp(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move item",
-		})
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
 	}
 
-	handlers.BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
+	handlers.BroadcastFrom(c, "items_reordered", map[string]int64{"section_id": item.SectionID})
 
 	updatedItem, _ := db.GetItemByID(int64(id))
 	return c.JSON(updatedItem)
@@ -401,35 +625,26 @@ func MoveItemUp(c *fiber.Ctx) error {
 func MoveItemDown(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid item ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if item exists
 	item, err := db.GetItemByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Item not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch item",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.MoveItemDown(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move item",
-		})
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
 	}
 
-	handlers.BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
+	handlers.BroadcastFrom(c, "items_reordered", map[string]int64{"section_id": item.SectionID})
 
 	updatedItem, _ := db.GetItemByID(int64(id))
 	return c.JSON(updatedItem)
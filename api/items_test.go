@@ -0,0 +1,977 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+)
+
+const testBarcode = "4006381333931"
+
+// failBarcodeWrites makes every write that sets a new barcode on an item fail
+func failBarcodeWrites(t *testing.T) {
+	t.Helper()
+	_, err := db.DB.Exec(`
+		CREATE TRIGGER fail_barcode_insert BEFORE INSERT ON items WHEN NEW.barcode != ''
+		BEGIN SELECT RAISE(ABORT, 'barcode write failed'); END;
+		CREATE TRIGGER fail_barcode_update BEFORE UPDATE ON items WHEN NEW.barcode != OLD.barcode
+		BEGIN SELECT RAISE(ABORT, 'barcode write failed'); END;
+	`)
+	if err != nil {
+		t.Fatalf("create triggers: %v", err)
+	}
+}
+
+// itemWrite is one INSERT or UPDATE of an items row, with the values it wrote
+type itemWrite struct {
+	kind              string
+	priceCents        *int64
+	currency, dueDate string
+	barcode           string
+}
+
+// logItemWrites records every statement that writes an items row, see itemWrites
+func logItemWrites(t *testing.T) {
+	t.Helper()
+	_, err := db.DB.Exec(`
+		CREATE TABLE item_writes (kind TEXT, price_cents INTEGER, currency TEXT, due_date TEXT, barcode TEXT);
+		CREATE TRIGGER log_item_insert AFTER INSERT ON items
+		BEGIN INSERT INTO item_writes VALUES ('insert', NEW.price_cents, NEW.currency, NEW.due_date, NEW.barcode); END;
+		CREATE TRIGGER log_item_update AFTER UPDATE ON items
+		BEGIN INSERT INTO item_writes VALUES ('update', NEW.price_cents, NEW.currency, NEW.due_date, NEW.barcode); END;
+	`)
+	if err != nil {
+		t.Fatalf("create triggers: %v", err)
+	}
+}
+
+// itemWrites returns the writes recorded by logItemWrites in order
+func itemWrites(t *testing.T) []itemWrite {
+	t.Helper()
+	rows, err := db.DB.Query("SELECT kind, price_cents, currency, due_date, barcode FROM item_writes ORDER BY rowid")
+	if err != nil {
+		t.Fatalf("query writes: %v", err)
+	}
+	defer rows.Close()
+	var writes []itemWrite
+	for rows.Next() {
+		var w itemWrite
+		if err := rows.Scan(&w.kind, &w.priceCents, &w.currency, &w.dueDate, &w.barcode); err != nil {
+			t.Fatalf("scan write: %v", err)
+		}
+		writes = append(writes, w)
+	}
+	return writes
+}
+
+func decodeItem(t *testing.T, body []byte) ItemResponse {
+	t.Helper()
+	var item ItemResponse
+	if err := json.Unmarshal(body, &item); err != nil {
+		t.Fatalf("decode item %q: %v", body, err)
+	}
+	return item
+}
+
+func TestCreateItemWithAllFields(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, _ := createTestItem(t, "Groceries", "Bread")
+	due := time.Now().AddDate(0, 0, 3).Format("2006-01-02")
+
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, map[string]any{
+		"section_id": section.ID, "name": "Milk", "quantity": 2,
+		"price": "3,49", "currency": "EUR", "due_date": due, "barcode": testBarcode,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+	item := decodeItem(t, body)
+	if item.PriceCents == nil || *item.PriceCents != 349 || item.Currency != "EUR" || item.DueDate != due || item.Barcode != testBarcode {
+		t.Errorf("created item = %+v, want price 349 EUR, due %s and barcode %s", item.Item, due, testBarcode)
+	}
+	if item.SortOrder != 1 {
+		t.Errorf("sort order = %d, want 1 after the existing item", item.SortOrder)
+	}
+
+	stored, err := db.GetItemByID(item.ID)
+	if err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+	if stored.PriceCents == nil || *stored.PriceCents != 349 || stored.DueDate != due || stored.Barcode != testBarcode {
+		t.Errorf("stored item = %+v, fields missing", stored)
+	}
+}
+
+func TestCreateItemIsAtomic(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, _ := createTestItem(t, "Groceries", "Bread")
+	failBarcodeWrites(t)
+
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, map[string]any{
+		"section_id": section.ID, "name": "Milk", "price": 1.99, "due_date": "2030-01-01", "barcode": testBarcode,
+	})
+	if status != http.StatusInternalServerError || errorCode(t, body) != handlers.ErrCodeCreateFailed {
+		t.Fatalf("create: status %d, body %s, want create_failed", status, body)
+	}
+
+	var count int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ?", section.ID).Scan(&count); err != nil {
+		t.Fatalf("count items: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("section has %d items after a failed create, want only the existing one", count)
+	}
+}
+
+func TestUpdateItemIsAtomic(t *testing.T) {
+	app := setupTestAPI(t)
+	_, _, item := createTestItem(t, "Groceries", "Bread")
+	failBarcodeWrites(t)
+
+	path := fmt.Sprintf("/api/v1/items/%d", item.ID)
+	status, body := apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{
+		"name": "Rye bread", "price": 2.5, "currency": "EUR", "due_date": "2030-01-01", "barcode": testBarcode,
+	})
+	if status != http.StatusInternalServerError || errorCode(t, body) != handlers.ErrCodeUpdateFailed {
+		t.Fatalf("update: status %d, body %s, want update_failed", status, body)
+	}
+
+	stored, err := db.GetItemByID(item.ID)
+	if err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+	if stored.Name != "Bread" || stored.PriceCents != nil || stored.DueDate != "" || stored.Barcode != "" {
+		t.Errorf("item after a failed update = %+v, want it unchanged", stored)
+	}
+
+	// Without the barcode the same update goes through
+	status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{
+		"name": "Rye bread", "price": 2.5, "currency": "EUR", "due_date": "2030-01-01",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", status, body)
+	}
+	updated := decodeItem(t, body)
+	if updated.Name != "Rye bread" || updated.PriceCents == nil || *updated.PriceCents != 250 || updated.DueDate != "2030-01-01" {
+		t.Errorf("updated item = %+v", updated.Item)
+	}
+}
+
+func TestCreateItemWritesOneInsert(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, _ := createTestItem(t, "Groceries", "Bread")
+	logItemWrites(t)
+
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, map[string]any{
+		"section_id": section.ID, "name": "Milk", "price": "3.49", "currency": "EUR", "due_date": "2030-01-01", "barcode": testBarcode,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+	writes := itemWrites(t)
+	if len(writes) != 1 {
+		t.Fatalf("create wrote the item %d times (%+v), want one INSERT", len(writes), writes)
+	}
+	w := writes[0]
+	if w.kind != "insert" || w.priceCents == nil || *w.priceCents != 349 || w.currency != "EUR" || w.dueDate != "2030-01-01" || w.barcode != testBarcode {
+		t.Errorf("write = %+v, want an INSERT carrying the price, due date and barcode", w)
+	}
+}
+
+func TestUpdateItemWritesOneUpdate(t *testing.T) {
+	app := setupTestAPI(t)
+	_, _, item := createTestItem(t, "Groceries", "Bread")
+	logItemWrites(t)
+
+	status, body := apiRequest(t, app, http.MethodPut, fmt.Sprintf("/api/v1/items/%d", item.ID), testMasterToken, map[string]any{
+		"name": "Rye bread", "price": 2.5, "currency": "PLN", "due_date": "2030-01-01", "barcode": testBarcode,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("update: status %d, body %s", status, body)
+	}
+	writes := itemWrites(t)
+	if len(writes) != 1 {
+		t.Fatalf("update wrote the item %d times (%+v), want one UPDATE", len(writes), writes)
+	}
+	w := writes[0]
+	if w.kind != "update" || w.priceCents == nil || *w.priceCents != 250 || w.currency != "PLN" || w.dueDate != "2030-01-01" || w.barcode != testBarcode {
+		t.Errorf("write = %+v, want an UPDATE carrying the price, due date and barcode", w)
+	}
+}
+
+func TestUpdateItemKeepsOmittedFields(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, _ := createTestItem(t, "Groceries", "Bread")
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, map[string]any{
+		"section_id": section.ID, "name": "Milk", "price": 1.99, "currency": "EUR", "due_date": "2030-01-01", "barcode": testBarcode,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+	path := fmt.Sprintf("/api/v1/items/%d", decodeItem(t, body).ID)
+
+	status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"name": "Oat milk"})
+	if status != http.StatusOK {
+		t.Fatalf("rename: status %d, body %s", status, body)
+	}
+	item := decodeItem(t, body)
+	if item.Name != "Oat milk" || item.PriceCents == nil || *item.PriceCents != 199 || item.Currency != "EUR" || item.DueDate != "2030-01-01" || item.Barcode != testBarcode {
+		t.Errorf("renamed item = %+v, want the other fields kept", item.Item)
+	}
+
+	// A null price clears the currency with it, an empty due date and barcode clear those
+	status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"price": nil, "due_date": "", "barcode": ""})
+	if status != http.StatusOK {
+		t.Fatalf("clear: status %d, body %s", status, body)
+	}
+	item = decodeItem(t, body)
+	if item.Name != "Oat milk" || item.PriceCents != nil || item.Currency != "" || item.DueDate != "" || item.Barcode != "" {
+		t.Errorf("cleared item = %+v, want no price, currency, due date or barcode", item.Item)
+	}
+}
+
+func TestUpdateItemDescription(t *testing.T) {
+	app := setupTestAPI(t)
+	_, _, created := createTestItem(t, "Groceries", "Milk")
+	path := fmt.Sprintf("/api/v1/items/%d", created.ID)
+
+	steps := []struct {
+		name            string
+		body            map[string]any
+		wantName, wantD string
+	}{
+		{"set", map[string]any{"description": "2L"}, "Milk", "2L"},
+		{"change", map[string]any{"description": "1L, lactose free"}, "Milk", "1L, lactose free"},
+		{"omit", map[string]any{"name": "Oat milk"}, "Oat milk", "1L, lactose free"},
+		{"null is omitted", map[string]any{"description": nil, "quantity": 2}, "Oat milk", "1L, lactose free"},
+		{"clear", map[string]any{"description": ""}, "Oat milk", ""},
+		{"set again", map[string]any{"description": "barista"}, "Oat milk", "barista"},
+	}
+	for _, step := range steps {
+		status, body := apiRequest(t, app, http.MethodPut, path, testMasterToken, step.body)
+		if status != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", step.name, status, body)
+		}
+		item := decodeItem(t, body)
+		if item.Name != step.wantName || item.Description != step.wantD {
+			t.Errorf("%s: item %q %q, want %q %q", step.name, item.Name, item.Description, step.wantName, step.wantD)
+		}
+		stored, err := db.GetItemByID(created.ID)
+		if err != nil || stored.Description != step.wantD {
+			t.Errorf("%s: stored description %q, %v, want %q", step.name, stored.Description, err, step.wantD)
+		}
+	}
+
+	// The name may be left out but not emptied
+	status, body := apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"name": ""})
+	if status != http.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeValidation {
+		t.Errorf("empty name: status %d, body %s, want 400 validation_error", status, body)
+	}
+	if stored, _ := db.GetItemByID(created.ID); stored.Name != "Oat milk" || stored.Description != "barista" {
+		t.Errorf("rejected update changed the item to %q %q", stored.Name, stored.Description)
+	}
+}
+
+// itemEventActions returns the actions recorded for an item, oldest first
+func itemEventActions(t *testing.T, itemID int64) []string {
+	t.Helper()
+	events, _, err := db.GetItemEvents(itemID, 50, 0)
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	actions := make([]string, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		actions = append(actions, events[i].Action)
+	}
+	return actions
+}
+
+func TestDeleteItemRecordsEventWithDelete(t *testing.T) {
+	app := setupTestAPI(t)
+	_, _, item := createTestItem(t, "Groceries", "Milk")
+	path := fmt.Sprintf("/api/v1/items/%d", item.ID)
+
+	// A delete that fails records nothing
+	if _, err := db.DB.Exec(`
+		CREATE TRIGGER fail_delete BEFORE UPDATE OF deleted_at ON items
+		BEGIN SELECT RAISE(ABORT, 'delete failed'); END
+	`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	status, body := apiRequest(t, app, http.MethodDelete, path, testMasterToken, nil)
+	if status != http.StatusInternalServerError || errorCode(t, body) != handlers.ErrCodeDeleteFailed {
+		t.Fatalf("failing delete: status %d, body %s, want delete_failed", status, body)
+	}
+	if actions := itemEventActions(t, item.ID); len(actions) != 0 {
+		t.Errorf("events after a failed delete = %v, want none", actions)
+	}
+
+	// An event that cannot be recorded keeps the item
+	if _, err := db.DB.Exec(`
+		DROP TRIGGER fail_delete;
+		CREATE TRIGGER fail_event BEFORE INSERT ON item_events
+		BEGIN SELECT RAISE(ABORT, 'event failed'); END
+	`); err != nil {
+		t.Fatalf("swap triggers: %v", err)
+	}
+	if status, body := apiRequest(t, app, http.MethodDelete, path, testMasterToken, nil); status != http.StatusInternalServerError {
+		t.Fatalf("delete with a failing event: status %d, body %s, want 500", status, body)
+	}
+	if _, err := db.GetItemByID(item.ID); err != nil {
+		t.Errorf("item was deleted without its event: %v", err)
+	}
+
+	if _, err := db.DB.Exec("DROP TRIGGER fail_event"); err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	if status, body := apiRequest(t, app, http.MethodDelete, path, testMasterToken, nil); status != http.StatusNoContent {
+		t.Fatalf("delete: status %d, body %s", status, body)
+	}
+	if actions := itemEventActions(t, item.ID); len(actions) != 1 || actions[0] != db.ItemEventDelete {
+		t.Errorf("events after the delete = %v, want one delete", actions)
+	}
+}
+
+// dueDate returns the date days from today as YYYY-MM-DD
+func dueDate(days int) string {
+	return time.Now().AddDate(0, 0, days).Format(time.DateOnly)
+}
+
+func TestItemDueDates(t *testing.T) {
+	app := setupTestAPI(t)
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	list, section, _ := createTestItem(t, "Pharmacy", "Plasters")
+
+	// A past date is accepted with a warning in the request language, and the item is overdue
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items?lang=de", testMasterToken, map[string]any{
+		"section_id": section.ID, "name": "Prescription", "due_date": "2020-01-02",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create with a past date: status %d, body %s", status, body)
+	}
+	item := decodeItem(t, body)
+	want := []ValidationWarning{{Field: "due_date", Code: "past", Message: "due_date liegt in der Vergangenheit"}}
+	if !reflect.DeepEqual(item.Warnings, want) || item.DueDate != "2020-01-02" || !item.Overdue {
+		t.Errorf("created item = %+v with warnings %+v, want overdue with %+v", item.Item, item.Warnings, want)
+	}
+
+	// The sections of the list flag it too
+	status, body = apiRequest(t, app, http.MethodGet, fmt.Sprintf("/api/v1/lists/%d/sections", list.ID), testMasterToken, nil)
+	var sections SectionsResponse
+	if status != http.StatusOK || json.Unmarshal(body, &sections) != nil {
+		t.Fatalf("get sections: status %d, body %s", status, body)
+	}
+	overdue := map[string]bool{}
+	for _, s := range sections.Sections {
+		for _, i := range s.Items {
+			overdue[i.Name] = i.Overdue
+		}
+	}
+	if !overdue["Prescription"] || overdue["Plasters"] {
+		t.Errorf("overdue flags = %v, want only Prescription", overdue)
+	}
+
+	path := fmt.Sprintf("/api/v1/items/%d", item.ID)
+	cases := []struct {
+		name     string
+		dueDate  string
+		want     string
+		warnings int
+	}{
+		{"future date", dueDate(3), dueDate(3), 0},
+		{"today is not past", dueDate(0), dueDate(0), 0},
+		{"past date", dueDate(-1), dueDate(-1), 1},
+		{"padded", " 2030-05-31 ", "2030-05-31", 0},
+		{"cleared", "", "", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"due_date": tc.dueDate})
+			if status != http.StatusOK {
+				t.Fatalf("update: status %d, body %s", status, body)
+			}
+			item := decodeItem(t, body)
+			if item.DueDate != tc.want || len(item.Warnings) != tc.warnings || item.Overdue != (tc.warnings > 0) {
+				t.Errorf("item = %q overdue %v with %d warnings, want %q with %d", item.DueDate, item.Overdue, len(item.Warnings), tc.want, tc.warnings)
+			}
+		})
+	}
+
+	// Dates that are not YYYY-MM-DD are refused on create and update
+	for _, bad := range []string{"31.12.2030", "2030-02-30", "tomorrow", "2030-1-5"} {
+		status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, map[string]any{
+			"section_id": section.ID, "name": "Bad", "due_date": bad,
+		})
+		if status != http.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeValidation {
+			t.Errorf("create with due date %q: status %d, body %s, want a validation error", bad, status, body)
+		}
+		status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"due_date": bad})
+		if status != http.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeValidation {
+			t.Errorf("update to due date %q: status %d, body %s, want a validation error", bad, status, body)
+		}
+	}
+}
+
+func TestGetDueItems(t *testing.T) {
+	app := setupTestAPI(t)
+	home, homeSection, _ := createTestItem(t, "Home", "No date")
+	work, workSection, _ := createTestItem(t, "Work", "No date either")
+	create := func(sectionID int64, name, due string) int64 {
+		t.Helper()
+		status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, map[string]any{
+			"section_id": sectionID, "name": name, "due_date": due,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create %s: status %d, body %s", name, status, body)
+		}
+		return decodeItem(t, body).ID
+	}
+	create(homeSection.ID, "In three days", dueDate(3))
+	create(homeSection.ID, "Overdue", dueDate(-2))
+	create(homeSection.ID, "Next month", dueDate(30))
+	done := create(homeSection.ID, "Done", dueDate(-1))
+	if _, err := db.ToggleItemCompleted(done); err != nil {
+		t.Fatal(err)
+	}
+	create(workSection.ID, "Tomorrow", dueDate(1))
+
+	due := func(query, token string) DueItemsResponse {
+		t.Helper()
+		status, body := apiRequest(t, app, http.MethodGet, "/api/v1/items/due"+query, token, nil)
+		if status != http.StatusOK {
+			t.Fatalf("GET /items/due%s: status %d, body %s", query, status, body)
+		}
+		var resp DueItemsResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("decode %s: %v", body, err)
+		}
+		return resp
+	}
+	// outline returns the item names by list, in the order of the response
+	outline := func(resp DueItemsResponse) []string {
+		var got []string
+		for _, l := range resp.Lists {
+			for _, i := range l.Items {
+				got = append(got, fmt.Sprintf("%d:%s:%v", l.ListID, i.Name, i.Overdue))
+			}
+		}
+		return got
+	}
+
+	// A week ahead by default, overdue items first and completed ones left out
+	resp := due("", testMasterToken)
+	want := []string{
+		fmt.Sprintf("%d:Overdue:true", home.ID), fmt.Sprintf("%d:In three days:false", home.ID),
+		fmt.Sprintf("%d:Tomorrow:false", work.ID),
+	}
+	if resp.Before != dueDate(7) || !reflect.DeepEqual(outline(resp), want) {
+		t.Errorf("due items before %s = %v, want before %s %v", resp.Before, outline(resp), dueDate(7), want)
+	}
+	if len(resp.Lists) != 2 || resp.Lists[0].ListName != "Home" || resp.Lists[1].ListName != "Work" {
+		t.Errorf("lists = %+v, want Home and Work", resp.Lists)
+	}
+
+	// A later date includes next month, an earlier one only the overdue item
+	if got := outline(due("?before="+dueDate(31), testMasterToken)); len(got) != 4 {
+		t.Errorf("due items within 31 days = %v, want 4", got)
+	}
+	if got := outline(due("?before="+dueDate(0), testMasterToken)); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("due items before today = %v, want %v", got, want[:1])
+	}
+	if resp := due("?before=2000-01-01", testMasterToken); resp.Lists == nil || len(resp.Lists) != 0 {
+		t.Errorf("due items before 2000 = %+v, want an empty array", resp.Lists)
+	}
+
+	// A list-scoped token only sees its list
+	token := createListToken(t, app, work.ID, "read")
+	if got := outline(due("", token.Token)); !reflect.DeepEqual(got, want[2:]) {
+		t.Errorf("due items for the Work token = %v, want %v", got, want[2:])
+	}
+
+	status, body := apiRequest(t, app, http.MethodGet, "/api/v1/items/due?before=next-week", testMasterToken, nil)
+	if status != http.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeValidation {
+		t.Errorf("invalid before: status %d, body %s, want a validation error", status, body)
+	}
+}
+
+// itemExists reports whether an item is there and not in the trash
+func itemExists(t *testing.T, id int64) bool {
+	t.Helper()
+	_, err := db.GetItemByID(id)
+	return err == nil
+}
+
+func TestBatchDeleteItems(t *testing.T) {
+	app := setupTestAPI(t)
+	groceries, dairy, milk := createTestItem(t, "Groceries", "Milk")
+	bakery, err := db.CreateSectionForList(groceries.ID, "Bakery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bread, err := db.CreateItem(bakery.ID, "Bread", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheese, err := db.CreateItem(dairy.ID, "Cheese", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hardware, tools, nails := createTestItem(t, "Hardware", "Nails")
+	token := createListToken(t, app, groceries.ID, "write")
+	conn := dialEvents(t)
+
+	batchDelete := func(token string, body any) (int, []byte) {
+		t.Helper()
+		return apiRequest(t, app, http.MethodPost, "/api/v1/items/batch-delete", token, body)
+	}
+
+	// Items across lists go at once, unknown and repeated IDs do not fail the request
+	status, body := batchDelete(testMasterToken, map[string]any{"ids": []int64{milk.ID, nails.ID, 9999, milk.ID, bread.ID}})
+	var resp BatchDeleteItemsResponse
+	if status != http.StatusOK || json.Unmarshal(body, &resp) != nil {
+		t.Fatalf("batch delete: status %d, body %s", status, body)
+	}
+	if resp.Deleted != 3 || !reflect.DeepEqual(resp.NotFound, []int64{9999}) {
+		t.Errorf("response = %+v, want 3 deleted and 9999 not found", resp)
+	}
+	if itemExists(t, milk.ID) || itemExists(t, nails.ID) || itemExists(t, bread.ID) || !itemExists(t, cheese.ID) {
+		t.Error("batch delete removed the wrong items")
+	}
+
+	// One event names every deleted item with its section and list
+	event := readEvent(t, conn)
+	var deleted struct {
+		Items []db.ItemRef `json:"items"`
+	}
+	json.Unmarshal(event.Data, &deleted)
+	wantRefs := []db.ItemRef{
+		{ID: milk.ID, SectionID: dairy.ID, ListID: groceries.ID},
+		{ID: nails.ID, SectionID: tools.ID, ListID: hardware.ID},
+		{ID: bread.ID, SectionID: bakery.ID, ListID: groceries.ID},
+	}
+	if event.Type != "items_deleted" || !reflect.DeepEqual(deleted.Items, wantRefs) {
+		t.Errorf("event = %s %s, want items_deleted with %+v", event.Type, event.Data, wantRefs)
+	}
+
+	// Deleted items are not found again, and a batch that deletes nothing succeeds without an event
+	status, body = batchDelete(testMasterToken, map[string]any{"ids": []int64{milk.ID}})
+	if status != http.StatusOK || json.Unmarshal(body, &resp) != nil || resp.Deleted != 0 || !reflect.DeepEqual(resp.NotFound, []int64{milk.ID}) {
+		t.Errorf("repeated delete: status %d, body %s, want milk not found", status, body)
+	}
+
+	// A list-scoped token cannot see items of other lists
+	other, err := db.CreateItem(tools.ID, "Screws", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body = batchDelete(token.Token, map[string]any{"ids": []int64{cheese.ID, other.ID}})
+	if status != http.StatusOK || json.Unmarshal(body, &resp) != nil || resp.Deleted != 1 || !reflect.DeepEqual(resp.NotFound, []int64{other.ID}) {
+		t.Errorf("scoped delete: status %d, body %s, want cheese deleted and screws not found", status, body)
+	}
+	if !itemExists(t, other.ID) {
+		t.Error("a list-scoped token deleted an item of another list")
+	}
+	// The next event is that of the scoped delete, the repeated one sent none
+	event = readEvent(t, conn)
+	json.Unmarshal(event.Data, &deleted)
+	if want := []db.ItemRef{{ID: cheese.ID, SectionID: dairy.ID, ListID: groceries.ID}}; event.Type != "items_deleted" || !reflect.DeepEqual(deleted.Items, want) {
+		t.Errorf("event after the scoped delete = %s %s, want items_deleted with %+v", event.Type, event.Data, want)
+	}
+
+	tooMany := make([]int64, MaxBatchItems+1)
+	for i := range tooMany {
+		tooMany[i] = int64(i + 1)
+	}
+	for _, tc := range []struct {
+		name string
+		body any
+		code string
+	}{
+		{"no ids", map[string]any{}, handlers.ErrCodeValidation},
+		{"empty ids", map[string]any{"ids": []int64{}}, handlers.ErrCodeValidation},
+		{"too many ids", map[string]any{"ids": tooMany}, handlers.ErrCodeValidation},
+		{"ids that are not numbers", map[string]any{"ids": []string{"a"}}, handlers.ErrCodeInvalidJSON},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, body := batchDelete(testMasterToken, tc.body); status != http.StatusBadRequest || errorCode(t, body) != tc.code {
+				t.Errorf("status %d, body %s, want 400 %s", status, body, tc.code)
+			}
+		})
+	}
+	noEvent(t, conn)
+}
+
+func TestBatchDeleteItemsIsAtomic(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, milk := createTestItem(t, "Groceries", "Milk")
+	broken, err := db.CreateItem(section.ID, "Broken", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec(`
+		CREATE TRIGGER fail_delete BEFORE UPDATE OF deleted_at ON items WHEN OLD.name = 'Broken'
+		BEGIN SELECT RAISE(ABORT, 'delete failed'); END
+	`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items/batch-delete", testMasterToken, map[string]any{"ids": []int64{milk.ID, broken.ID}})
+	if status != http.StatusInternalServerError || errorCode(t, body) != handlers.ErrCodeDeleteFailed {
+		t.Fatalf("status %d, body %s, want delete_failed", status, body)
+	}
+	if !itemExists(t, milk.ID) {
+		t.Error("the failed batch deleted the item before the one that failed")
+	}
+}
+
+func TestBatchCompleteItems(t *testing.T) {
+	app := setupTestAPI(t)
+	groceries, dairy, milk := createTestItem(t, "Groceries", "Milk")
+	cheese, err := db.CreateItem(dairy.ID, "Cheese", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	butter, err := db.CreateItem(dairy.ID, "Butter", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ToggleItemCompleted(butter.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, tools, nails := createTestItem(t, "Hardware", "Nails")
+	token := createListToken(t, app, groceries.ID, "write")
+	conn := dialEvents(t)
+
+	type completedEvent struct {
+		Completed bool               `json:"completed"`
+		Items     []map[string]int64 `json:"items"`
+	}
+	batchComplete := func(token string, body any) (int, BatchCompleteItemsResponse, []byte) {
+		t.Helper()
+		status, data := apiRequest(t, app, http.MethodPost, "/api/v1/items/batch-complete", token, body)
+		var resp BatchCompleteItemsResponse
+		if status == http.StatusOK {
+			if err := json.Unmarshal(data, &resp); err != nil {
+				t.Fatalf("decode %s: %v", data, err)
+			}
+		}
+		return status, resp, data
+	}
+	changedIDs := func(items []db.Item) []int64 {
+		ids := []int64{}
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	// Butter is already completed and stays so, it is not toggled back
+	status, resp, body := batchComplete(testMasterToken, map[string]any{"ids": []int64{milk.ID, butter.ID, nails.ID, 9999, milk.ID}, "completed": true})
+	if status != http.StatusOK {
+		t.Fatalf("complete: status %d, body %s", status, body)
+	}
+	if got := changedIDs(resp.Items); !reflect.DeepEqual(got, []int64{milk.ID, nails.ID}) || resp.Unchanged != 1 || !reflect.DeepEqual(resp.NotFound, []int64{9999}) {
+		t.Errorf("response = changed %v, %d unchanged, not found %v, want milk and nails, 1 and 9999", got, resp.Unchanged, resp.NotFound)
+	}
+	for _, item := range resp.Items {
+		if !item.Completed || item.CompletedAt == nil {
+			t.Errorf("returned %s completed %v at %v, want completed with a time", item.Name, item.Completed, item.CompletedAt)
+		}
+	}
+	for id, want := range map[int64]bool{milk.ID: true, butter.ID: true, nails.ID: true, cheese.ID: false} {
+		if item, err := db.GetItemByID(id); err != nil || item.Completed != want {
+			t.Errorf("item %d completed = %v, want %v", id, item.Completed, want)
+		}
+	}
+
+	// One event carries the flag and the changed items with their sections
+	event := readEvent(t, conn)
+	var completed completedEvent
+	json.Unmarshal(event.Data, &completed)
+	wantItems := []map[string]int64{{"id": milk.ID, "section_id": dairy.ID}, {"id": nails.ID, "section_id": tools.ID}}
+	if event.Type != "items_completed" || !completed.Completed || !reflect.DeepEqual(completed.Items, wantItems) {
+		t.Errorf("event = %s %s, want items_completed with %v", event.Type, event.Data, wantItems)
+	}
+
+	// Completing again changes nothing and sends no event
+	status, resp, body = batchComplete(testMasterToken, map[string]any{"ids": []int64{milk.ID, butter.ID}, "completed": true})
+	if status != http.StatusOK || len(resp.Items) != 0 || resp.Unchanged != 2 {
+		t.Errorf("repeat: status %d, body %s, want 2 unchanged", status, body)
+	}
+
+	// Un-completing with a list-scoped token reopens its items and cannot reach other lists
+	status, resp, body = batchComplete(token.Token, map[string]any{"ids": []int64{milk.ID, cheese.ID, nails.ID}, "completed": false})
+	if status != http.StatusOK || !reflect.DeepEqual(changedIDs(resp.Items), []int64{milk.ID}) || resp.Unchanged != 1 || !reflect.DeepEqual(resp.NotFound, []int64{nails.ID}) {
+		t.Errorf("scoped reopen: status %d, body %s, want milk changed, cheese unchanged and nails not found", status, body)
+	}
+	if len(resp.Items) == 1 && (resp.Items[0].Completed || resp.Items[0].CompletedAt != nil) {
+		t.Errorf("reopened item = %+v, want open without a completed time", resp.Items[0])
+	}
+	if item, _ := db.GetItemByID(nails.ID); !item.Completed {
+		t.Error("a list-scoped token reopened an item of another list")
+	}
+	event = readEvent(t, conn)
+	json.Unmarshal(event.Data, &completed)
+	if want := []map[string]int64{{"id": milk.ID, "section_id": dairy.ID}}; event.Type != "items_completed" || completed.Completed || !reflect.DeepEqual(completed.Items, want) {
+		t.Errorf("event after reopening = %s %s, want items_completed false with %v", event.Type, event.Data, want)
+	}
+
+	for _, tc := range []struct {
+		name string
+		body any
+		code string
+	}{
+		{"no completed", map[string]any{"ids": []int64{milk.ID}}, handlers.ErrCodeValidation},
+		{"no ids", map[string]any{"completed": true}, handlers.ErrCodeValidation},
+		{"too many ids", map[string]any{"ids": make([]int64, MaxBatchItems+1), "completed": true}, handlers.ErrCodeValidation},
+		{"completed that is not a bool", map[string]any{"ids": []int64{milk.ID}, "completed": "yes"}, handlers.ErrCodeInvalidJSON},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, _, body := batchComplete(testMasterToken, tc.body); status != http.StatusBadRequest || errorCode(t, body) != tc.code {
+				t.Errorf("status %d, body %s, want 400 %s", status, body, tc.code)
+			}
+		})
+	}
+	noEvent(t, conn)
+}
+
+func TestBatchCompleteItemsIsAtomic(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, milk := createTestItem(t, "Groceries", "Milk")
+	broken, err := db.CreateItem(section.ID, "Broken", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec(`
+		CREATE TRIGGER fail_complete BEFORE UPDATE OF completed ON items WHEN OLD.name = 'Broken'
+		BEGIN SELECT RAISE(ABORT, 'update failed'); END
+	`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items/batch-complete", testMasterToken,
+		map[string]any{"ids": []int64{milk.ID, broken.ID}, "completed": true})
+	if status != http.StatusInternalServerError || errorCode(t, body) != handlers.ErrCodeUpdateFailed {
+		t.Fatalf("status %d, body %s, want update_failed", status, body)
+	}
+	if item, _ := db.GetItemByID(milk.ID); item.Completed {
+		t.Error("the failed batch completed the item before the one that failed")
+	}
+}
+
+func TestMoveItemToList(t *testing.T) {
+	app := setupTestAPI(t)
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	groceries, food, bread := createTestItem(t, "Groceries", "Bread")
+	charcoal, err := db.CreateItem(food.ID, "Charcoal", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	milk, err := db.CreateItem(food.ID, "Milk", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bbq, grill, tongs := createTestItem(t, "BBQ", "Tongs")
+	if _, err := db.UpdateSection(grill.ID, "Grill"); err != nil {
+		t.Fatal(err)
+	}
+	empty, err := db.CreateList("Empty", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialEvents(t)
+
+	move := func(itemID int64, body map[string]any, query string) ItemMovedResponse {
+		t.Helper()
+		status, data := apiRequest(t, app, http.MethodPost, fmt.Sprintf("/api/v1/items/%d/move-to-list%s", itemID, query), testMasterToken, body)
+		if status != http.StatusOK {
+			t.Fatalf("move %d with %v: status %d, body %s", itemID, body, status, data)
+		}
+		var moved ItemMovedResponse
+		if err := json.Unmarshal(data, &moved); err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+		return moved
+	}
+	// movedEvent reads the item_moved broadcast of a move, after the section_created one of a created section
+	movedEvent := func(created bool) ItemMovedResponse {
+		t.Helper()
+		event := readEvent(t, conn)
+		if created {
+			if event.Type != "section_created" {
+				t.Errorf("event = %s, want section_created first", event.Type)
+			}
+			event = readEvent(t, conn)
+		}
+		var moved ItemMovedResponse
+		json.Unmarshal(event.Data, &moved)
+		if event.Type != "item_moved" {
+			t.Errorf("event = %s, want item_moved", event.Type)
+		}
+		return moved
+	}
+
+	// A section is matched by name regardless of case, the item goes last and its old section is renumbered
+	moved := move(charcoal.ID, map[string]any{"list_id": bbq.ID, "section_name": "grill"}, "")
+	if moved.SectionID != grill.ID || moved.SortOrder != 1 || moved.ListID != bbq.ID || moved.FromSectionID != food.ID ||
+		moved.FromListID != groceries.ID || moved.CreatedSection != nil {
+		t.Errorf("moved = %+v, want last in Grill of BBQ, from Food of Groceries", moved)
+	}
+	if event := movedEvent(false); !reflect.DeepEqual(event, moved) {
+		t.Errorf("item_moved = %+v, want the response %+v", event, moved)
+	}
+	if got := sectionItemIDs(t, food.ID); !reflect.DeepEqual(got, []int64{bread.ID, milk.ID}) {
+		t.Errorf("Food after the move = %v, want bread and milk renumbered", got)
+	}
+
+	// A missing section is created at the end of the list
+	moved = move(milk.ID, map[string]any{"list_id": bbq.ID, "section_name": " Drinks "}, "")
+	if moved.CreatedSection == nil || moved.CreatedSection.Name != "Drinks" || moved.CreatedSection.ListID != bbq.ID ||
+		moved.CreatedSection.SortOrder != 1 || moved.SectionID != moved.CreatedSection.ID || moved.SortOrder != 0 {
+		t.Errorf("moved = %+v with section %+v, want a new Drinks section after Grill", moved, moved.CreatedSection)
+	}
+	movedEvent(true)
+
+	// Without a name the first section of the list is used
+	moved = move(bread.ID, map[string]any{"list_id": bbq.ID}, "")
+	if moved.SectionID != grill.ID || moved.SortOrder != 2 || moved.CreatedSection != nil {
+		t.Errorf("moved = %+v, want last in Grill", moved)
+	}
+	movedEvent(false)
+
+	// A list without sections gets a default one in the request language
+	moved = move(tongs.ID, map[string]any{"list_id": empty.ID}, "?lang=de")
+	if moved.CreatedSection == nil || moved.CreatedSection.Name != "Allgemein" || moved.ListID != empty.ID || moved.FromListID != bbq.ID {
+		t.Errorf("moved = %+v with section %+v, want a new Allgemein section", moved, moved.CreatedSection)
+	}
+	movedEvent(true)
+
+	// Within its own list the item stays in its section unless another is named
+	moved = move(charcoal.ID, map[string]any{"list_id": bbq.ID}, "")
+	if moved.SectionID != grill.ID || moved.FromSectionID != grill.ID || moved.CreatedSection != nil {
+		t.Errorf("moved within its list = %+v, want it kept in Grill", moved)
+	}
+	movedEvent(false)
+	moved = move(charcoal.ID, map[string]any{"list_id": bbq.ID, "section_name": "drinks"}, "")
+	if moved.SectionID == grill.ID || moved.FromSectionID != grill.ID || moved.ListID != bbq.ID || moved.FromListID != bbq.ID {
+		t.Errorf("moved within its list = %+v, want it in Drinks", moved)
+	}
+	movedEvent(false)
+	if got := sectionItemIDs(t, grill.ID); !reflect.DeepEqual(got, []int64{bread.ID}) {
+		t.Errorf("Grill after the moves = %v, want bread", got)
+	}
+
+	groceriesToken := createListToken(t, app, groceries.ID, "write")
+	kept, err := db.CreateItem(food.ID, "Eggs", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := func(id int64) string { return fmt.Sprintf("/api/v1/items/%d/move-to-list", id) }
+	for _, tc := range []struct {
+		name, path, token string
+		body              map[string]any
+		status            int
+		code              string
+	}{
+		{"no list", path(kept.ID), testMasterToken, map[string]any{}, http.StatusBadRequest, handlers.ErrCodeValidation},
+		{"unknown list", path(kept.ID), testMasterToken, map[string]any{"list_id": 9999}, http.StatusNotFound, handlers.ErrCodeNotFound},
+		{"unknown item", path(9999), testMasterToken, map[string]any{"list_id": bbq.ID}, http.StatusNotFound, handlers.ErrCodeNotFound},
+		{"reserved section name", path(kept.ID), testMasterToken, map[string]any{"list_id": bbq.ID, "section_name": "[HISTORY]"}, http.StatusBadRequest, handlers.ErrCodeValidation},
+		{"section name too long", path(kept.ID), testMasterToken, map[string]any{"list_id": bbq.ID, "section_name": strings.Repeat("x", MaxSectionNameLength+1)}, http.StatusBadRequest, handlers.ErrCodeValidation},
+		{"token moving out of its list", path(kept.ID), groceriesToken.Token, map[string]any{"list_id": bbq.ID}, http.StatusForbidden, handlers.ErrCodeListForbidden},
+		{"token moving into its list", path(charcoal.ID), groceriesToken.Token, map[string]any{"list_id": groceries.ID}, http.StatusForbidden, handlers.ErrCodeListForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, body := apiRequest(t, app, http.MethodPost, tc.path, tc.token, tc.body); status != tc.status || errorCode(t, body) != tc.code {
+				t.Errorf("status %d, body %s, want %d %s", status, body, tc.status, tc.code)
+			}
+		})
+	}
+	if item, err := db.GetItemByID(kept.ID); err != nil || item.SectionID != food.ID {
+		t.Errorf("a refused move moved the item: %+v, %v", item, err)
+	}
+	noEvent(t, conn)
+
+	// The token moves items between the sections of its own list
+	status, body := apiRequest(t, app, http.MethodPost, path(kept.ID), groceriesToken.Token, map[string]any{"list_id": groceries.ID, "section_name": "Dairy"})
+	if status != http.StatusOK || decodeItem(t, body).SectionID == food.ID {
+		t.Errorf("token moving within its list: status %d, body %s", status, body)
+	}
+}
+
+func TestCreateItemIdempotencyKey(t *testing.T) {
+	app := setupTestAPI(t)
+	_, food, _ := createTestItem(t, "Groceries", "Bread")
+	other := createListToken(t, app, food.ListID, "write")
+	create := func(token, key, name string) (int, string, string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/items", strings.NewReader(fmt.Sprintf(`{"section_id":%d,"name":%q}`, food.ID, name)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(handlers.HeaderIdempotencyKey, key)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			return 0, err.Error(), ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), resp.Header.Get(handlers.HeaderIdempotentReplayed)
+	}
+	countMilk := func() int {
+		t.Helper()
+		var n int
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM items WHERE name = 'Milk'").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// Parallel retries of one create make one item, each gets the created item or is told to retry
+	var wg sync.WaitGroup
+	statuses := make([]int, 12)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _, _ = create(testMasterToken, "create-milk", "Milk")
+		}(i)
+	}
+	wg.Wait()
+	for i, status := range statuses {
+		if status != http.StatusCreated && status != http.StatusConflict {
+			t.Errorf("parallel create %d: status %d, want 201 or 409", i, status)
+		}
+	}
+	if n := countMilk(); n != 1 {
+		t.Fatalf("parallel creates with one key made %d items", n)
+	}
+
+	status, first, replayed := create(testMasterToken, "create-milk", "Milk")
+	if status != http.StatusCreated || replayed != "true" {
+		t.Errorf("retry: %d %s, replayed %q, want the stored 201", status, first, replayed)
+	}
+	if status, body, _ := create(testMasterToken, "create-milk", "Cream"); status != http.StatusUnprocessableEntity {
+		t.Errorf("changed body: %d %s, want 422", status, body)
+	}
+	// Keys are scoped to the token
+	if status, body, replayed := create(other.Token, "create-milk", "Milk"); status != http.StatusCreated || replayed != "" {
+		t.Errorf("same key with another token: %d %s, replayed %q, want a new item", status, body, replayed)
+	}
+	if n := countMilk(); n != 2 {
+		t.Errorf("%d items named Milk, want 2", n)
+	}
+}
@@ -17,10 +17,18 @@ const (
 func GetLists(c *fiber.Ctx) error {
 	lists, err := db.GetAllLists()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch lists",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	// List-scoped tokens only see their own list
+	if isListScoped(c) {
+		filtered := lists[:0]
+		for _, l := range lists {
+			if requireListAccess(c, l.ID) {
+				filtered = append(filtered, l)
+			}
+		}
+		lists = filtered
 	}
 	return c.JSON(ListsResponse{Lists: lists})
 }
@@ -29,24 +37,29 @@ func GetLists(c *fiber.Ctx) error {
 func GetList(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid list ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	version, err := db.ListVersion(int64(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	if handlers.NotModified(c, version) {
+		return handlers.NotModifiedResponse(c)
 	}
 
 	list, err := db.GetListByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	return c.JSON(list)
@@ -54,67 +67,51 @@ func GetList(c *fiber.Ctx) error {
 
 // CreateList creates a new list
 func CreateList(c *fiber.Ctx) error {
+	if isListScoped(c) {
+		return listForbidden(c)
+	}
+
 	var req CreateListRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "name"})
 	}
 
-	if len(req.Name) > MaxListNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
+	if tooLong(req.Name, MaxListNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "name", "max": MaxListNameLength,
 		})
 	}
 
 	if len(req.Icon) > MaxIconLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Icon exceeds maximum length of 20 characters",
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "icon", "max": MaxIconLength,
 		})
 	}
 
 	if req.Name == "[HISTORY]" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "This name is reserved for system use",
-		})
+		return apiError(c, handlers.ErrCodeValidation, "validation_error.reserved_name")
 	}
 
 	// Check for duplicate name
 	exists, err := db.ListNameExists(req.Name, 0)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to check list name",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 	if exists {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "list_name_exists",
-			Message: "A list with this name already exists",
-		})
+		return apiError(c, handlers.ErrCodeListNameExists, "list_name_exists")
 	}
 
 	icon := NormalizeIcon(req.Icon)
 	list, err := db.CreateList(req.Name, icon)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to create list",
-		})
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
 	}
 
-	handlers.BroadcastUpdate("list_created", list)
+	handlers.BroadcastFrom(c, "list_created", list)
 	return c.Status(fiber.StatusCreated).JSON(list)
 }
 
@@ -122,33 +119,24 @@ func CreateList(c *fiber.Ctx) error {
 func UpdateList(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid list ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	var req UpdateListRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	// Get existing list to check if it exists and for default values
 	existing, err := db.GetListByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	name := req.Name
@@ -162,44 +150,31 @@ func UpdateList(c *fiber.Ctx) error {
 		icon = NormalizeIcon(icon)
 	}
 
-	if len(name) > MaxListNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
+	if tooLong(name, MaxListNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "name", "max": MaxListNameLength,
 		})
 	}
 
 	if name == "[HISTORY]" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "This name is reserved for system use",
-		})
+		return apiError(c, handlers.ErrCodeValidation, "validation_error.reserved_name")
 	}
 
 	// Check for duplicate name (excluding current list)
 	exists, err := db.ListNameExists(name, int64(id))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to check list name",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 	if exists {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "list_name_exists",
-			Message: "A list with this name already exists",
-		})
+		return apiError(c, handlers.ErrCodeListNameExists, "list_name_exists")
 	}
 
-	list, err := db.UpdateList(int64(id), name, icon)
+	list, err := db.UpdateList(int64(id), name, icon, req.Archived)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "update_failed",
-			Message: "Failed to update list",
-		})
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
 	}
 
-	handlers.BroadcastUpdate("list_updated", list)
+	handlers.BroadcastFrom(c, "list_updated", list)
 	return c.JSON(list)
 }
 
@@ -207,107 +182,162 @@ func UpdateList(c *fiber.Ctx) error {
 func DeleteList(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid list ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if list exists
 	_, err = db.GetListByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.DeleteList(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete list",
-		})
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
 	}
 
-	handlers.BroadcastUpdate("list_deleted", map[string]int64{"id": int64(id)})
+	handlers.BroadcastFrom(c, "list_deleted", map[string]int64{"id": int64(id)})
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// ClearCompletedItems deletes the completed items of a list after a shopping trip, with archive=true
+// recording them as completions in history and with prune_sections=true removing the sections left empty.
+// A list without completed items is not an error, it answers with removed 0
+func ClearCompletedItems(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	if _, err := db.GetListByID(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	result, err := db.ClearCompletedItems(int64(id), c.Query("archive") == "true", c.Query("prune_sections") == "true")
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
+	}
+
+	if result.Removed > 0 {
+		handlers.BroadcastFrom(c, "completed_items_cleared", map[string]any{
+			"list_id":         id,
+			"item_ids":        result.ItemIDs,
+			"pruned_sections": result.PrunedSections,
+		})
+	}
+	return c.JSON(result)
+}
+
+// SetListSectionsOrder puts the sections of a list in the order of section_ids, like SetSectionItemsOrder
+func SetListSectionsOrder(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	var req OrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+	if len(req.SectionIDs) == 0 {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "section_ids"})
+	}
+
+	if _, err := db.GetListByID(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	foreign, err := db.SetSectionsOrder(int64(id), req.SectionIDs)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
+	}
+	if len(foreign) > 0 {
+		return orderFailed(c, "not_in_list", "section_ids", foreign)
+	}
+
+	sections, err := db.GetSectionsByList(int64(id))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	ids := make([]int64, 0, len(sections))
+	for _, section := range sections {
+		ids = append(ids, section.ID)
+	}
+	handlers.BroadcastFrom(c, "sections_reordered", map[string]any{"list_id": id, "section_ids": ids})
+	return c.JSON(SectionsResponse{Sections: sections, Totals: db.PriceTotals(sections)})
+}
+
 // GetListSections returns all sections for a list
 func GetListSections(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid list ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
-	// Check if list exists
-	_, err = db.GetListByID(int64(id))
+	// The version query also checks that the list exists
+	version, err := db.ListVersion(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	if handlers.NotModified(c, version) {
+		return handlers.NotModifiedResponse(c)
 	}
 
 	sections, err := db.GetSectionsByList(int64(id))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch sections",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
-	return c.JSON(SectionsResponse{Sections: sections})
+	return c.JSON(SectionsResponse{Sections: sections, Totals: db.PriceTotals(sections)})
 }
 
 // MoveListUp moves a list up in sort order
 func MoveListUp(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid list ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if list exists
 	_, err = db.GetListByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.MoveListUp(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move list",
-		})
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
 	}
 
-	handlers.BroadcastUpdate("lists_reordered", nil)
+	handlers.BroadcastFrom(c, "lists_reordered", nil)
 
 	list, _ := db.GetListByID(int64(id))
 	return c.JSON(list)
@@ -317,35 +347,26 @@ func MoveListUp(c *fiber.Ctx) error {
 func MoveListDown(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid list ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if list exists
 	_, err = db.GetListByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.MoveListDown(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move list",
-		})
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
 	}
 
-	handlers.BroadcastUpdate("lists_reordered", nil)
+	handlers.BroadcastFrom(c, "lists_reordered", nil)
 
 	list, _ := db.GetListByID(int64(id))
 	return c.JSON(list)
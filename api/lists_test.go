@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// decodeList decodes a list response
+func decodeList(t *testing.T, body []byte) db.List {
+	t.Helper()
+	var list db.List
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatalf("decode list %q: %v", body, err)
+	}
+	return list
+}
+
+func TestUpdateListArchived(t *testing.T) {
+	app := setupTestAPI(t)
+	list, _, _ := createTestItem(t, "Attic", "Box")
+	path := fmt.Sprintf("/api/v1/lists/%d", list.ID)
+
+	status, body := apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"archived": true})
+	if status != http.StatusOK {
+		t.Fatalf("archive: status %d, body %s", status, body)
+	}
+	if got := decodeList(t, body); !got.Archived || got.Name != "Attic" {
+		t.Errorf("archived list = %+v", got)
+	}
+
+	// A rename without the flag keeps the list archived
+	status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"name": "Loft"})
+	if status != http.StatusOK {
+		t.Fatalf("rename: status %d, body %s", status, body)
+	}
+	if got := decodeList(t, body); !got.Archived || got.Name != "Loft" {
+		t.Errorf("renamed list = %+v, want Loft still archived", got)
+	}
+
+	_, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, map[string]any{"archived": false})
+	if got := decodeList(t, body); got.Archived {
+		t.Errorf("unarchived list = %+v", got)
+	}
+}
+
+// clearFixture is a list with completed items in some sections and an empty section, and another list
+type clearFixture struct {
+	list                               db.List
+	dairy, bakery, empty, produce      db.Section
+	milk, cheese, bread, apples, pears db.Item
+	otherList                          db.List
+	nails                              db.Item
+}
+
+// newClearFixture creates Groceries with Dairy (Milk done, Cheese), Bakery (Bread done), Empty and
+// Produce (Apples and Pears done), and Hardware with Nails done
+func newClearFixture(t *testing.T) clearFixture {
+	t.Helper()
+	var f clearFixture
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	section := func(list *db.List, name string) db.Section {
+		t.Helper()
+		s, err := db.CreateSectionForList(list.ID, name)
+		must(err)
+		return *s
+	}
+	item := func(section db.Section, name string, completed bool) db.Item {
+		t.Helper()
+		i, err := db.CreateItem(section.ID, name, "", 1)
+		must(err)
+		if completed {
+			_, err = db.ToggleItemCompleted(i.ID)
+			must(err)
+		}
+		return *i
+	}
+
+	list, err := db.CreateList("Groceries", "")
+	must(err)
+	f.list = *list
+	f.dairy, f.bakery, f.empty, f.produce = section(list, "Dairy"), section(list, "Bakery"), section(list, "Empty"), section(list, "Produce")
+	f.milk, f.cheese = item(f.dairy, "Milk", true), item(f.dairy, "Cheese", false)
+	f.bread = item(f.bakery, "Bread", true)
+	f.apples, f.pears = item(f.produce, "Apples", true), item(f.produce, "Pears", true)
+
+	other, err := db.CreateList("Hardware", "")
+	must(err)
+	f.otherList = *other
+	f.nails = item(section(other, "Tools"), "Nails", true)
+	return f
+}
+
+// historyCompletions returns the completed_count of the history entries by name
+func historyCompletions(t *testing.T) map[string]int {
+	t.Helper()
+	entries, err := db.GetItemHistoryList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, h := range entries {
+		counts[h.Name] = h.CompletedCount
+		if h.CompletedCount > 0 && h.LastCompletedAt == nil {
+			t.Errorf("history of %s has %d completions without a time", h.Name, h.CompletedCount)
+		}
+	}
+	return counts
+}
+
+func TestClearCompletedItems(t *testing.T) {
+	cases := []struct {
+		name            string
+		query           string
+		pruned          func(f clearFixture) []int64
+		wantCompletions int
+	}{
+		{"delete", "", func(clearFixture) []int64 { return []int64{} }, 0},
+		{"archive", "?archive=true", func(clearFixture) []int64 { return []int64{} }, 1},
+		// Empty was empty before the clear and is kept, Dairy still has Cheese
+		{"prune sections", "?prune_sections=true", func(f clearFixture) []int64 { return []int64{f.bakery.ID, f.produce.ID} }, 0},
+		{"archive and prune sections", "?archive=true&prune_sections=true", func(f clearFixture) []int64 { return []int64{f.bakery.ID, f.produce.ID} }, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := setupTestAPI(t)
+			f := newClearFixture(t)
+			conn := dialEvents(t)
+			path := fmt.Sprintf("/api/v1/lists/%d/clear-completed", f.list.ID)
+
+			status, body := apiRequest(t, app, http.MethodPost, path+tc.query, testMasterToken, nil)
+			var result db.ClearCompletedResult
+			if status != http.StatusOK || json.Unmarshal(body, &result) != nil {
+				t.Fatalf("clear: status %d, body %s", status, body)
+			}
+			wantSections := []db.ClearedSection{
+				{SectionID: f.dairy.ID, Name: "Dairy", Removed: 1},
+				{SectionID: f.bakery.ID, Name: "Bakery", Removed: 1},
+				{SectionID: f.produce.ID, Name: "Produce", Removed: 2},
+			}
+			pruned := tc.pruned(f)
+			if result.Removed != 4 || result.Archived != (tc.wantCompletions > 0) || !reflect.DeepEqual(result.Sections, wantSections) ||
+				!reflect.DeepEqual(result.PrunedSections, pruned) {
+				t.Errorf("result = %+v, want 4 removed from %+v and %v pruned", result, wantSections, pruned)
+			}
+
+			// Only the completed items of the list are gone
+			for _, item := range []db.Item{f.milk, f.bread, f.apples, f.pears} {
+				if itemExists(t, item.ID) {
+					t.Errorf("%s was not removed", item.Name)
+				}
+			}
+			if !itemExists(t, f.cheese.ID) || !itemExists(t, f.nails.ID) {
+				t.Error("the clear removed an open item or one of another list")
+			}
+			sections, err := db.GetSectionsByList(f.list.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 4 - len(pruned); len(sections) != want {
+				t.Errorf("list has %d sections, want %d", len(sections), want)
+			}
+
+			completions := historyCompletions(t)
+			for _, name := range []string{"Milk", "Bread", "Apples", "Pears"} {
+				if completions[name] != tc.wantCompletions {
+					t.Errorf("history of %s has %d completions, want %d", name, completions[name], tc.wantCompletions)
+				}
+			}
+			if completions["Cheese"] != 0 || completions["Nails"] != 0 {
+				t.Errorf("completions = %v, recorded items that were not cleared", completions)
+			}
+
+			// Other clients drop the items and pruned sections of the list
+			event := readEvent(t, conn)
+			var cleared struct {
+				ListID         int64   `json:"list_id"`
+				ItemIDs        []int64 `json:"item_ids"`
+				PrunedSections []int64 `json:"pruned_sections"`
+			}
+			json.Unmarshal(event.Data, &cleared)
+			wantIDs := []int64{f.milk.ID, f.bread.ID, f.apples.ID, f.pears.ID}
+			if event.Type != "completed_items_cleared" || cleared.ListID != f.list.ID || !reflect.DeepEqual(cleared.ItemIDs, wantIDs) ||
+				!reflect.DeepEqual(cleared.PrunedSections, pruned) {
+				t.Errorf("event = %s %s, want completed_items_cleared of %v", event.Type, event.Data, wantIDs)
+			}
+
+			// Nothing left to clear is not an error and sends no event
+			status, body = apiRequest(t, app, http.MethodPost, path+tc.query, testMasterToken, nil)
+			if status != http.StatusOK || json.Unmarshal(body, &result) != nil || result.Removed != 0 || len(result.Sections) != 0 {
+				t.Errorf("second clear: status %d, body %s, want 200 with removed 0", status, body)
+			}
+			noEvent(t, conn)
+		})
+	}
+}
+
+func TestClearCompletedItemsAccess(t *testing.T) {
+	app := setupTestAPI(t)
+	f := newClearFixture(t)
+	token := createListToken(t, app, f.otherList.ID, "write")
+
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/lists/9999/clear-completed", testMasterToken, nil)
+	if status != http.StatusNotFound || errorCode(t, body) != handlers.ErrCodeNotFound {
+		t.Errorf("unknown list: status %d, body %s, want 404", status, body)
+	}
+	status, body = apiRequest(t, app, http.MethodPost, fmt.Sprintf("/api/v1/lists/%d/clear-completed", f.list.ID), token.Token, nil)
+	if status != http.StatusForbidden || errorCode(t, body) != handlers.ErrCodeListForbidden {
+		t.Errorf("token of another list: status %d, body %s, want 403", status, body)
+	}
+	if !itemExists(t, f.milk.ID) {
+		t.Error("a refused clear removed items")
+	}
+
+	// The token clears its own list
+	status, body = apiRequest(t, app, http.MethodPost, fmt.Sprintf("/api/v1/lists/%d/clear-completed", f.otherList.ID), token.Token, nil)
+	if status != http.StatusOK || itemExists(t, f.nails.ID) {
+		t.Errorf("token of the list: status %d, body %s, want nails cleared", status, body)
+	}
+}
+
+func TestSetListSectionsOrder(t *testing.T) {
+	app := setupTestAPI(t)
+	list, first, _ := createTestItem(t, "Groceries", "Milk")
+	ids := []int64{first.ID}
+	for _, name := range []string{"Bakery", "Produce"} {
+		section, err := db.CreateSectionForList(list.ID, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, section.ID)
+	}
+	_, foreign, _ := createTestItem(t, "Hardware", "Nails")
+	conn := dialEvents(t)
+	path := fmt.Sprintf("/api/v1/lists/%d/sections/order", list.ID)
+
+	// Produce first, the others follow in their previous order
+	status, body := apiRequest(t, app, http.MethodPut, path, testMasterToken, OrderRequest{SectionIDs: []int64{ids[2]}})
+	var resp SectionsResponse
+	if status != http.StatusOK || json.Unmarshal(body, &resp) != nil {
+		t.Fatalf("order: status %d, body %s", status, body)
+	}
+	want := []int64{ids[2], ids[0], ids[1]}
+	got := []int64{}
+	for i, section := range resp.Sections {
+		got = append(got, section.ID)
+		if section.SortOrder != i {
+			t.Errorf("%s has sort order %d at position %d", section.Name, section.SortOrder, i)
+		}
+	}
+	if !reflect.DeepEqual(got, want) || len(resp.Sections[1].Items) != 1 {
+		t.Errorf("returned sections %v, want %v with their items", got, want)
+	}
+
+	event := readEvent(t, conn)
+	var reordered struct {
+		ListID     int64   `json:"list_id"`
+		SectionIDs []int64 `json:"section_ids"`
+	}
+	json.Unmarshal(event.Data, &reordered)
+	if event.Type != "sections_reordered" || reordered.ListID != list.ID || !reflect.DeepEqual(reordered.SectionIDs, want) {
+		t.Errorf("event = %s %s, want sections_reordered with %v", event.Type, event.Data, want)
+	}
+
+	// A section of another list is refused and listed
+	status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, OrderRequest{SectionIDs: []int64{ids[0], foreign.ID}})
+	var orderErr OrderError
+	json.Unmarshal(body, &orderErr)
+	if status != http.StatusBadRequest || orderErr.Error != handlers.ErrCodeValidation || !reflect.DeepEqual(orderErr.InvalidIDs, []int64{foreign.ID}) {
+		t.Errorf("foreign section: status %d, body %s, want 400 listing %d", status, body, foreign.ID)
+	}
+	sections, err := db.GetSectionsByList(list.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 3 || sections[0].ID != want[0] || sections[1].ID != want[1] || sections[2].ID != want[2] {
+		t.Errorf("sections after the refused order = %+v, want %v", sections, want)
+	}
+
+	token := createListToken(t, app, foreign.ListID, "write")
+	for _, tc := range []struct {
+		name, path, token string
+		body              any
+		status            int
+		code              string
+	}{
+		{"no ids", path, testMasterToken, OrderRequest{}, http.StatusBadRequest, handlers.ErrCodeValidation},
+		// item_ids order the items of a section, not sections
+		{"item ids only", path, testMasterToken, OrderRequest{ItemIDs: []int64{ids[0]}}, http.StatusBadRequest, handlers.ErrCodeValidation},
+		{"unknown list", "/api/v1/lists/9999/sections/order", testMasterToken, OrderRequest{SectionIDs: []int64{ids[0]}}, http.StatusNotFound, handlers.ErrCodeNotFound},
+		{"token of another list", path, token.Token, OrderRequest{SectionIDs: []int64{ids[0]}}, http.StatusForbidden, handlers.ErrCodeListForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, body := apiRequest(t, app, http.MethodPut, tc.path, tc.token, tc.body); status != tc.status || errorCode(t, body) != tc.code {
+				t.Errorf("status %d, body %s, want %d %s", status, body, tc.status, tc.code)
+			}
+		})
+	}
+	noEvent(t, conn)
+}
+
+// etagRequest sends a GET with If-None-Match set to ifNoneMatch and returns the status and the ETag
+func etagRequest(t *testing.T, app *fiber.App, path, ifNoneMatch string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testMasterToken)
+	if ifNoneMatch != "" {
+		req.Header.Set(fiber.HeaderIfNoneMatch, ifNoneMatch)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotModified && len(body) != 0 {
+		t.Errorf("GET %s: 304 with body %q", path, body)
+	}
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderETag)
+}
+
+func TestListETag(t *testing.T) {
+	app := setupTestAPI(t)
+	groceries, food, bread := createTestItem(t, "Groceries", "Bread")
+	hardware, tools, _ := createTestItem(t, "Hardware", "Nails")
+	resources := []struct {
+		name, path string
+		toggled    bool // Whether the resource holds the toggled item
+	}{
+		{"groceries", fmt.Sprintf("/api/v1/lists/%d", groceries.ID), true},
+		{"groceries sections", fmt.Sprintf("/api/v1/lists/%d/sections", groceries.ID), true},
+		{"food items", fmt.Sprintf("/api/v1/sections/%d/items", food.ID), true},
+		{"hardware", fmt.Sprintf("/api/v1/lists/%d", hardware.ID), false},
+		{"hardware sections", fmt.Sprintf("/api/v1/lists/%d/sections", hardware.ID), false},
+		{"tools items", fmt.Sprintf("/api/v1/sections/%d/items", tools.ID), false},
+	}
+	before := make(map[string]string)
+	for _, r := range resources {
+		name, path := r.name, r.path
+		status, etag := etagRequest(t, app, path, "")
+		if status != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+			t.Fatalf("%s: status %d, ETag %q, want 200 with a weak ETag", name, status, etag)
+		}
+		before[name] = etag
+
+		// A matching tag, also in a list of tags, gets an empty 304, a stale one the full response
+		if status, _ := etagRequest(t, app, path, etag); status != http.StatusNotModified {
+			t.Errorf("%s with its ETag: status %d, want 304", name, status)
+		}
+		if status, _ := etagRequest(t, app, path, `W/"stale", `+etag); status != http.StatusNotModified {
+			t.Errorf("%s with its ETag among others: status %d, want 304", name, status)
+		}
+		if status, _ := etagRequest(t, app, path, `W/"stale"`); status != http.StatusOK {
+			t.Errorf("%s with a stale ETag: status %d, want 200", name, status)
+		}
+	}
+
+	// Toggling within the same second as the creation still changes the tags of its list
+	if status, body := apiRequest(t, app, http.MethodPost, fmt.Sprintf("/api/v1/items/%d/toggle", bread.ID), testMasterToken, nil); status != http.StatusOK {
+		t.Fatalf("toggle: status %d, body %s", status, body)
+	}
+	for _, r := range resources {
+		status, etag := etagRequest(t, app, r.path, before[r.name])
+		switch {
+		case r.toggled && (status != http.StatusOK || etag == before[r.name]):
+			t.Errorf("%s after the toggle: status %d, ETag %q, want 200 with a new ETag", r.name, status, etag)
+		case !r.toggled && (status != http.StatusNotModified || etag != before[r.name]):
+			t.Errorf("%s after a toggle in another list: status %d, ETag %q, want 304 with %q", r.name, status, etag, before[r.name])
+		}
+	}
+}
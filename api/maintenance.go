@@ -0,0 +1,50 @@
+package api
+
+import (
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	MaxMaintenanceMessageLength = 200
+)
+
+// MaintenanceRequest for toggling read-only maintenance mode
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// GetMaintenance returns the current maintenance state
+func GetMaintenance(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+	return c.JSON(handlers.GetMaintenance())
+}
+
+// SetMaintenance enables or disables read-only maintenance mode
+func SetMaintenance(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req MaintenanceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	if tooLong(req.Message, MaxMaintenanceMessageLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "message", "max": MaxMaintenanceMessageLength,
+		})
+	}
+
+	state, err := handlers.SetMaintenance(req.Enabled, req.Message)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
+	}
+
+	return c.JSON(state)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MeResponse describes the caller's identity, capabilities and server features
+type MeResponse struct {
+	Name         string          `json:"name"`
+	Scope        string          `json:"scope"`
+	ListID       int64           `json:"list_id,omitempty"`
+	Capabilities map[string]bool `json:"capabilities"`
+	Features     map[string]bool `json:"features"`
+}
+
+// GetMe returns the resolved token identity and what it is allowed to do
+func GetMe(c *fiber.Ctx) error {
+	token := currentToken(c)
+	if token == nil {
+		return apiError(c, handlers.ErrCodeMissingToken, "missing_token")
+	}
+
+	canWrite := token.Scope == ScopeWrite || token.Scope == ScopeAdmin
+	canAdmin := token.Scope == ScopeAdmin
+
+	return c.JSON(MeResponse{
+		Name:   token.Name,
+		Scope:  token.Scope,
+		ListID: token.ListID,
+		Capabilities: map[string]bool{
+			"can_write":  canWrite,
+			"can_admin":  canAdmin && handlers.IsAdminIPAllowed(c, "/api/v1/admin/"),
+			"can_import": canWrite && !isListScoped(c),
+			"can_clear":  canAdmin && handlers.IsAdminIPAllowed(c, "/api/database/clear"),
+		},
+		Features: handlers.FeatureFlags(),
+	})
+}
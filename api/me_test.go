@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPermissionDenialCodes(t *testing.T) {
+	app := setupTestAPI(t)
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	own, _, ownItem := createTestItem(t, "Own", "Milk")
+	foreign, _, _ := createTestItem(t, "Foreign", "Bread")
+	readToken := createListToken(t, app, own.ID, ScopeRead).Token
+	writeToken := createListToken(t, app, own.ID, ScopeWrite).Token
+
+	cases := []struct {
+		name, method, path, token string
+		status                    int
+		code                      string
+	}{
+		{"read scope writing", "POST", fmt.Sprintf("/api/v1/items/%d/toggle", ownItem.ID), readToken, fiber.StatusForbidden, handlers.ErrCodeInsufficientScope},
+		{"write scope on an admin route", "GET", "/api/v1/admin/tokens", writeToken, fiber.StatusForbidden, handlers.ErrCodeInsufficientScope},
+		{"foreign list", "GET", fmt.Sprintf("/api/v1/lists/%d", foreign.ID), writeToken, fiber.StatusForbidden, handlers.ErrCodeListForbidden},
+		{"all-lists route", "GET", "/api/v1/history", readToken, fiber.StatusForbidden, handlers.ErrCodeListForbidden},
+		{"no token", "GET", "/api/v1/me", "", fiber.StatusUnauthorized, handlers.ErrCodeMissingToken},
+		{"unknown token", "GET", "/api/v1/me", "not-a-token", fiber.StatusUnauthorized, handlers.ErrCodeInvalidToken},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := apiRequest(t, app, tc.method, tc.path, tc.token, nil)
+			var resp handlers.ErrorResponse
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+			if status != tc.status || resp.Error != tc.code {
+				t.Errorf("%s %s: got %d %s, want %d %s", tc.method, tc.path, status, body, tc.status, tc.code)
+			}
+			if resp.Message == "" || strings.HasPrefix(resp.Message, "api_errors.") {
+				t.Errorf("body %s, want a translated message", body)
+			}
+		})
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	app := setupTestAPI(t)
+	own, _, _ := createTestItem(t, "Own", "Milk")
+	readToken := createListToken(t, app, own.ID, ScopeRead).Token
+	writeToken := createListToken(t, app, own.ID, ScopeWrite).Token
+
+	cases := []struct {
+		name, token string
+		scope       string
+		listID      int64
+		want        map[string]bool
+	}{
+		{"master token", testMasterToken, ScopeAdmin, 0,
+			map[string]bool{"can_write": true, "can_admin": true, "can_import": true, "can_clear": true}},
+		{"list write token", writeToken, ScopeWrite, own.ID,
+			map[string]bool{"can_write": true, "can_admin": false, "can_import": false, "can_clear": false}},
+		{"list read token", readToken, ScopeRead, own.ID,
+			map[string]bool{"can_write": false, "can_admin": false, "can_import": false, "can_clear": false}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := apiRequest(t, app, "GET", "/api/v1/me", tc.token, nil)
+			if status != fiber.StatusOK {
+				t.Fatalf("GET /me: %d %s", status, body)
+			}
+			var me MeResponse
+			if err := json.Unmarshal(body, &me); err != nil {
+				t.Fatalf("decode %s: %v", body, err)
+			}
+			if me.Scope != tc.scope || me.ListID != tc.listID || !reflect.DeepEqual(me.Capabilities, tc.want) {
+				t.Errorf("GET /me = %+v, want scope %s, list %d, capabilities %v", me, tc.scope, tc.listID, tc.want)
+			}
+			if _, ok := me.Features["admin_allowlist"]; !ok {
+				t.Errorf("features = %v, want the server's feature flags", me.Features)
+			}
+		})
+	}
+}
@@ -1,12 +1,29 @@
 package api
 
 import (
+	"crypto/subtle"
+	"log"
 	"os"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// Token scopes
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// tokenLocalsKey is the fiber Locals key holding the resolved *db.APIToken
+const tokenLocalsKey = "api_token"
+
 // GetAPIToken returns the API token from environment, empty if not set
 func GetAPIToken() string {
 	return os.Getenv("API_TOKEN")
@@ -18,38 +35,178 @@ func IsAPIEnabled() bool {
 }
 
 // TokenAuthMiddleware validates Bearer token in Authorization header
+// The API_TOKEN from environment has full admin access, database-backed
+// tokens are resolved to their scope and optional list restriction
 func TokenAuthMiddleware(c *fiber.Ctx) error {
 	expectedToken := GetAPIToken()
 	if expectedToken == "" {
-		return c.Status(fiber.StatusServiceUnavailable).JSON(ErrorResponse{
-			Error:   "api_disabled",
-			Message: "API is not enabled on this server",
-		})
+		return apiError(c, handlers.ErrCodeAPIDisabled, "api_disabled")
 	}
 
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-			Error:   "missing_token",
-			Message: "Authorization header is required",
-		})
+		return apiError(c, handlers.ErrCodeMissingToken, "missing_token")
 	}
 
 	// Expect "Bearer <token>"
 	parts := strings.SplitN(authHeader, " ", 2)
 	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-			Error:   "invalid_format",
-			Message: "Authorization header must be in format: Bearer <token>",
-		})
+		return apiError(c, handlers.ErrCodeInvalidFormat, "invalid_format")
 	}
 
-	if parts[1] != expectedToken {
-		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
-			Error:   "invalid_token",
-			Message: "Invalid API token",
-		})
+	var token *db.APIToken
+	if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(expectedToken)) == 1 {
+		token = &db.APIToken{Name: "master", Scope: ScopeAdmin}
+	} else {
+		dbToken, err := db.GetAPITokenBySecret(parts[1])
+		if err != nil {
+			return apiError(c, handlers.ErrCodeInvalidToken, "invalid_token")
+		}
+		if dbToken.IsExpired() {
+			return apiError(c, handlers.ErrCodeTokenExpired, "token_expired")
+		}
+		touchToken(dbToken.ID)
+		token = dbToken
 	}
+	c.Locals(handlers.LocalsTokenName, token.Name)
 
+	// Read-only tokens may not mutate anything
+	if token.Scope == ScopeRead && isMutatingMethod(c.Method()) {
+		return apiError(c, handlers.ErrCodeInsufficientScope, "insufficient_scope.read_only")
+	}
+
+	c.Locals(tokenLocalsKey, token)
 	return c.Next()
 }
+
+// lastUsedInterval limits last_used_at writes to one per token per interval
+const lastUsedInterval = time.Minute
+
+var (
+	lastUsedMu      sync.Mutex
+	lastUsedWritten = make(map[int64]time.Time)
+)
+
+// touchToken updates last_used_at, throttled to avoid a write per request
+func touchToken(id int64) {
+	lastUsedMu.Lock()
+	if time.Since(lastUsedWritten[id]) < lastUsedInterval {
+		lastUsedMu.Unlock()
+		return
+	}
+	lastUsedWritten[id] = time.Now()
+	lastUsedMu.Unlock()
+
+	if err := db.TouchAPIToken(id); err != nil {
+		log.Printf("[API] Failed to update last_used_at for token %d: %v", id, err)
+	}
+}
+
+// currentToken returns the token resolved by TokenAuthMiddleware
+func currentToken(c *fiber.Ctx) *db.APIToken {
+	token, _ := c.Locals(tokenLocalsKey).(*db.APIToken)
+	return token
+}
+
+// tokenIdempotencyScope keeps Idempotency-Key values of different tokens apart
+func tokenIdempotencyScope(c *fiber.Ctx) string {
+	token := currentToken(c)
+	if token == nil {
+		return "token"
+	}
+	return "token:" + strconv.FormatInt(token.ID, 10)
+}
+
+// auditAdmin records an admin action attributed to the current token
+func auditAdmin(c *fiber.Ctx, action, details string) {
+	actor := ""
+	if token := currentToken(c); token != nil {
+		actor = token.Name
+	}
+	if err := db.AddAuditLog(action, actor, handlers.ClientIP(c).String(), details, handlers.RequestID(c)); err != nil {
+		log.Printf("[AUDIT] Failed to write audit log: %v", err)
+	}
+}
+
+// isMutatingMethod returns true for HTTP methods that change state
+func isMutatingMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// requireListAccess returns true if the current token may access the given list
+// Tokens without a list restriction may access every list
+func requireListAccess(c *fiber.Ctx, listID int64) bool {
+	token := currentToken(c)
+	if token == nil || token.ListID == 0 {
+		return true
+	}
+	return token.ListID == listID
+}
+
+// requireSectionAccess resolves the owning list of a section and checks access to it
+func requireSectionAccess(c *fiber.Ctx, sectionID int64) bool {
+	token := currentToken(c)
+	if token == nil || token.ListID == 0 {
+		return true
+	}
+	listID, err := db.GetSectionListID(sectionID)
+	if err != nil {
+		return false
+	}
+	return token.ListID == listID
+}
+
+// requireItemAccess resolves the owning list of an item and checks access to it
+func requireItemAccess(c *fiber.Ctx, itemID int64) bool {
+	token := currentToken(c)
+	if token == nil || token.ListID == 0 {
+		return true
+	}
+	listID, err := db.GetItemListID(itemID)
+	if err != nil {
+		return false
+	}
+	return token.ListID == listID
+}
+
+// isListScoped returns true if the current token is restricted to a single list
+func isListScoped(c *fiber.Ctx) bool {
+	token := currentToken(c)
+	return token != nil && token.ListID != 0
+}
+
+// scopedListID returns the list a list-scoped token is restricted to, 0 for other requests
+func scopedListID(c *fiber.Ctx) int64 {
+	if token := currentToken(c); token != nil {
+		return token.ListID
+	}
+	return 0
+}
+
+// unscopedOnly rejects list-scoped tokens on endpoints that span all lists
+func unscopedOnly(c *fiber.Ctx) error {
+	if isListScoped(c) {
+		return listForbidden(c)
+	}
+	return c.Next()
+}
+
+// listForbidden sends the response for access to a list outside the token's scope
+func listForbidden(c *fiber.Ctx) error {
+	return apiError(c, handlers.ErrCodeListForbidden, "list_forbidden")
+}
+
+// requireAdmin returns true if the current token has admin scope
+func requireAdmin(c *fiber.Ctx) bool {
+	token := currentToken(c)
+	return token != nil && token.Scope == ScopeAdmin
+}
+
+// adminRequired sends the response for admin-only endpoints
+func adminRequired(c *fiber.Ctx) error {
+	return apiError(c, handlers.ErrCodeInsufficientScope, "insufficient_scope.admin")
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// createListToken creates a token restricted to listID through the API
+func createListToken(t *testing.T, app *fiber.App, listID int64, scope string) CreateTokenResponse {
+	t.Helper()
+	status, body := apiRequest(t, app, "POST", fmt.Sprintf("/api/v1/lists/%d/tokens", listID), testMasterToken,
+		CreateTokenRequest{Name: "housemate", Scope: scope})
+	if status != fiber.StatusCreated {
+		t.Fatalf("create token: status %d: %s", status, body)
+	}
+	var resp CreateTokenResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode token: %v", err)
+	}
+	return resp
+}
+
+func TestListTokenCannotMutateForeignItem(t *testing.T) {
+	app := setupTestAPI(t)
+	own, ownSection, ownItem := createTestItem(t, "Own", "Milk")
+	_, foreignSection, foreignItem := createTestItem(t, "Foreign", "Bread")
+	token := createListToken(t, app, own.ID, ScopeWrite).Token
+
+	name := "Changed"
+	foreign := []struct {
+		method, path string
+		body         any
+	}{
+		{"PUT", fmt.Sprintf("/api/v1/items/%d", foreignItem.ID), UpdateItemRequest{Name: &name}},
+		{"POST", fmt.Sprintf("/api/v1/items/%d/toggle", foreignItem.ID), nil},
+		{"DELETE", fmt.Sprintf("/api/v1/items/%d", foreignItem.ID), nil},
+		{"POST", "/api/v1/items", CreateItemRequest{SectionID: foreignSection.ID, Name: "Eggs"}},
+		// Moving an own item into the foreign list must be rejected too
+		{"POST", fmt.Sprintf("/api/v1/items/%d/move", ownItem.ID), MoveItemRequest{SectionID: foreignSection.ID}},
+	}
+	for _, tt := range foreign {
+		status, body := apiRequest(t, app, tt.method, tt.path, token, tt.body)
+		if status != fiber.StatusForbidden || errorCode(t, body) != handlers.ErrCodeListForbidden {
+			t.Errorf("%s %s: got %d %s, want 403 %s", tt.method, tt.path, status, body, handlers.ErrCodeListForbidden)
+		}
+	}
+
+	after, err := db.GetItemByID(foreignItem.ID)
+	if err != nil {
+		t.Fatalf("foreign item: %v", err)
+	}
+	if after.Name != "Bread" || after.Completed || after.SectionID != foreignSection.ID {
+		t.Errorf("foreign item was changed: %+v", after)
+	}
+	if moved, _ := db.GetItemByID(ownItem.ID); moved == nil || moved.SectionID != ownSection.ID {
+		t.Errorf("own item left its list: %+v", moved)
+	}
+
+	// The same token may still change items of its own list
+	status, body := apiRequest(t, app, "PUT", fmt.Sprintf("/api/v1/items/%d", ownItem.ID), token, UpdateItemRequest{Name: &name})
+	if status != fiber.StatusOK {
+		t.Errorf("own item: got %d %s, want 200", status, body)
+	}
+}
+
+func TestReadScopedListTokenCannotMutate(t *testing.T) {
+	app := setupTestAPI(t)
+	own, _, ownItem := createTestItem(t, "Own", "Milk")
+	token := createListToken(t, app, own.ID, ScopeRead).Token
+
+	if status, body := apiRequest(t, app, "GET", fmt.Sprintf("/api/v1/items/%d", ownItem.ID), token, nil); status != fiber.StatusOK {
+		t.Errorf("read own item: got %d %s", status, body)
+	}
+	status, body := apiRequest(t, app, "POST", fmt.Sprintf("/api/v1/items/%d/toggle", ownItem.ID), token, nil)
+	if status != fiber.StatusForbidden || errorCode(t, body) != handlers.ErrCodeInsufficientScope {
+		t.Errorf("toggle with read scope: got %d %s", status, body)
+	}
+}
+
+func TestListTokenCannotReachOtherLists(t *testing.T) {
+	app := setupTestAPI(t)
+	own, _, _ := createTestItem(t, "Own", "Milk")
+	foreign, _, _ := createTestItem(t, "Foreign", "Bread")
+	token := createListToken(t, app, own.ID, ScopeWrite).Token
+
+	for _, path := range []string{
+		fmt.Sprintf("/api/v1/lists/%d", foreign.ID),
+		fmt.Sprintf("/api/v1/lists/%d/sections", foreign.ID),
+		"/api/v1/history",
+		fmt.Sprintf("/api/v1/lists/%d/tokens", own.ID),
+	} {
+		if status, body := apiRequest(t, app, "GET", path, token, nil); status != fiber.StatusForbidden {
+			t.Errorf("GET %s: got %d %s, want 403", path, status, body)
+		}
+	}
+
+	// Listing lists only shows the token's own list
+	status, body := apiRequest(t, app, "GET", "/api/v1/lists", token, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("GET /lists: %d %s", status, body)
+	}
+	var resp ListsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode lists: %v", err)
+	}
+	if len(resp.Lists) != 1 || resp.Lists[0].ID != own.ID {
+		t.Errorf("GET /lists returned %+v, want only list %d", resp.Lists, own.ID)
+	}
+}
+
+func TestRevokedListTokenIsRejected(t *testing.T) {
+	app := setupTestAPI(t)
+	own, _, _ := createTestItem(t, "Own", "Milk")
+	foreign, _, _ := createTestItem(t, "Foreign", "Bread")
+	token := createListToken(t, app, own.ID, ScopeWrite)
+	listPath := fmt.Sprintf("/api/v1/lists/%d", own.ID)
+
+	if status, body := apiRequest(t, app, "GET", listPath, token.Token, nil); status != fiber.StatusOK {
+		t.Fatalf("before revoke: got %d %s", status, body)
+	}
+
+	// A token is only revoked through the list it belongs to
+	if status, _ := apiRequest(t, app, "DELETE", fmt.Sprintf("/api/v1/lists/%d/tokens/%d", foreign.ID, token.ID), testMasterToken, nil); status != fiber.StatusNotFound {
+		t.Errorf("revoke through foreign list: got %d, want 404", status)
+	}
+	if status, body := apiRequest(t, app, "DELETE", fmt.Sprintf("/api/v1/lists/%d/tokens/%d", own.ID, token.ID), testMasterToken, nil); status != fiber.StatusNoContent {
+		t.Fatalf("revoke: got %d %s", status, body)
+	}
+
+	status, body := apiRequest(t, app, "GET", listPath, token.Token, nil)
+	if status != fiber.StatusUnauthorized || errorCode(t, body) != handlers.ErrCodeInvalidToken {
+		t.Errorf("after revoke: got %d %s, want 401 %s", status, body, handlers.ErrCodeInvalidToken)
+	}
+}
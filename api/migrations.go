@@ -0,0 +1,34 @@
+package api
+
+import (
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MigrationsResponse lists applied and pending schema migrations
+type MigrationsResponse struct {
+	Migrations []db.MigrationStatus `json:"migrations"`
+	Pending    int                  `json:"pending"`
+}
+
+// GetMigrations returns the status of every schema migration
+func GetMigrations(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	statuses, err := db.GetMigrationStatus()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	response := MigrationsResponse{Migrations: statuses}
+	for _, s := range statuses {
+		if !s.Applied {
+			response.Pending++
+		}
+	}
+	return c.JSON(response)
+}
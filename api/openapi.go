@@ -0,0 +1,500 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"shopping-list/handlers"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Security scheme names used by documented routes
+const (
+	authNone    = ""
+	authBearer  = "bearerAuth"
+	authSession = "sessionCookie"
+)
+
+// openAPIParam documents a query parameter
+type openAPIParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// openAPIRoute documents one endpoint, request and response bodies are given as Go values
+// whose types are turned into schemas, or as *openAPISchema for bodies built from fiber.Map
+type openAPIRoute struct {
+	Method     string
+	Path       string // fiber syntax, e.g. /api/v1/lists/:id
+	Tag        string
+	Summary    string
+	Auth       string
+	Query      []openAPIParam
+	Request    any
+	Upload     bool           // multipart/form-data with a "file" field
+	Form       []openAPIParam // further multipart fields of an upload
+	Status     int            // success status, defaults to 200
+	Response   any            // nil for an empty body
+	Produces   string         // content type of a non-JSON success body
+	ETag       bool           // sends an ETag and answers If-None-Match with 304
+	Idempotent bool           // accepts an Idempotency-Key header
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas"`
+	Responses       map[string]*openAPIResponse       `json:"responses"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	Tags        []string                    `json:"tags,omitempty"`
+	Summary     string                      `json:"summary"`
+	OperationID string                      `json:"operationId"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Required    bool           `json:"required,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Ref         string                       `json:"$ref,omitempty"`
+	Description string                       `json:"description,omitempty"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+
+	// goType is replaced by the schema derived from it when the document is built
+	goType reflect.Type
+}
+
+// objectSchema describes a JSON object with the given properties, all of them required
+func objectSchema(props map[string]*openAPISchema) *openAPISchema {
+	required := make([]string, 0, len(props))
+	for name := range props {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return &openAPISchema{Type: "object", Properties: props, Required: required}
+}
+
+func typeSchema(typ string) *openAPISchema {
+	return &openAPISchema{Type: typ}
+}
+
+// schemaOfType refers to the schema of v's type inside a hand-written schema
+func schemaOfType(v any) *openAPISchema {
+	return &openAPISchema{goType: reflect.TypeOf(v)}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage(nil))
+	priceType   = reflect.TypeOf(PriceInput(nil))
+)
+
+// schemaBuilder turns Go types into schemas, named structs become shared components
+type schemaBuilder struct {
+	schemas map[string]*openAPISchema
+	names   map[reflect.Type]string
+}
+
+func (b *schemaBuilder) schemaFor(v any) *openAPISchema {
+	if s, ok := v.(*openAPISchema); ok {
+		return b.resolve(s)
+	}
+	return b.schemaOf(reflect.TypeOf(v))
+}
+
+// resolve replaces schemaOfType placeholders in a hand-written schema
+func (b *schemaBuilder) resolve(s *openAPISchema) *openAPISchema {
+	if s == nil {
+		return nil
+	}
+	if s.goType != nil {
+		return b.schemaOf(s.goType)
+	}
+	resolved := *s
+	resolved.Items = b.resolve(s.Items)
+	resolved.AdditionalProperties = b.resolve(s.AdditionalProperties)
+	if s.Properties != nil {
+		resolved.Properties = make(map[string]*openAPISchema, len(s.Properties))
+		for name, prop := range s.Properties {
+			resolved.Properties[name] = b.resolve(prop)
+		}
+	}
+	return &resolved
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *openAPISchema {
+	if t == timeType {
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	}
+	if t == rawJSONType {
+		return typeSchema("object")
+	}
+	if t == priceType {
+		return &openAPISchema{Type: "string", Nullable: true, Description: `Decimal amount such as "3.49" or "3,49", or a number; null clears the price`}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schemaOf(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return typeSchema("boolean")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return typeSchema("number")
+	case reflect.String:
+		return typeSchema("string")
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: "string", Format: "byte"}
+		}
+		return &openAPISchema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + b.component(t)}
+	}
+	return &openAPISchema{}
+}
+
+// component registers a named struct and returns its component name
+// Unexported names are capitalized, clashes between packages get the package as prefix
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if _, taken := b.schemas[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	b.names[t] = name
+	// Reserve the name before recursing so self-referencing types terminate
+	b.schemas[name] = &openAPISchema{}
+	*b.schemas[name] = *b.structSchema(t)
+	return name
+}
+
+// structSchema follows encoding/json: embedded structs are flattened, "-" is skipped
+// and fields without omitempty are required
+func (b *schemaBuilder) structSchema(t reflect.Type) *openAPISchema {
+	s := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := b.structSchema(ft)
+				for k, v := range embedded.Properties {
+					s.Properties[k] = v
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = b.schemaOf(ft)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+var fiberParamPattern = regexp.MustCompile(`:([A-Za-z]+)`)
+
+// openAPIPath converts a fiber route path to OpenAPI syntax
+func openAPIPath(path string) string {
+	return fiberParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+// buildOpenAPI renders openAPIRoutes into an OpenAPI 3 document
+func buildOpenAPI() *openAPIDocument {
+	b := &schemaBuilder{schemas: map[string]*openAPISchema{}, names: map[reflect.Type]string{}}
+
+	errorRef := b.schemaFor(ErrorResponse{})
+	errorSchema := b.schemas[strings.TrimPrefix(errorRef.Ref, "#/components/schemas/")]
+	errorSchema.Properties["error"].Enum = handlers.ErrorCodes()
+	errorSchema.Properties["error"].Description = "Stable machine-readable code, clients should branch on this"
+	errorSchema.Properties["message"].Description = "Human-readable message in the request language (?lang=, X-Language or Accept-Language)"
+	errorSchema.Properties["request_id"].Description = "Same as the X-Request-ID response header, quote it when reporting a problem"
+
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:   "Koffan API",
+			Version: handlers.AppVersion,
+			Description: "The /api/v1 REST API uses bearer tokens (API_TOKEN or tokens created through the API). " +
+				"Other endpoints are used by the web UI and need a session cookie, state-changing requests also need the X-CSRF-Token header.",
+		},
+		Paths: map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: b.schemas,
+			Responses: map[string]*openAPIResponse{
+				"Error": {
+					Description: "Error with a machine-readable code",
+					Content:     map[string]*openAPIMediaType{fiber.MIMEApplicationJSON: {Schema: errorRef}},
+				},
+			},
+			SecuritySchemes: map[string]*openAPISecurityScheme{
+				authBearer: {Type: "http", Scheme: "bearer", Description: "Authorization: Bearer <token>"},
+				authSession: {Type: "apiKey", In: "cookie", Name: handlers.SessionCookieName,
+					Description: "Session of the web UI, state-changing requests also need the " + handlers.CSRFHeaderName + " header"},
+			},
+		},
+	}
+
+	for _, r := range openAPIRoutes {
+		op := &openAPIOperation{
+			Summary:     r.Summary,
+			OperationID: strings.ToLower(r.Method) + strings.Map(operationIDRune, r.Path),
+			Responses:   map[string]*openAPIResponse{},
+			Security:    []map[string][]string{},
+		}
+		if r.Tag != "" {
+			op.Tags = []string{r.Tag}
+		}
+		if r.Auth != authNone {
+			op.Security = append(op.Security, map[string][]string{r.Auth: {}})
+		}
+
+		for _, m := range fiberParamPattern.FindAllStringSubmatch(r.Path, -1) {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name: m[1], In: "path", Required: true, Schema: &openAPISchema{Type: "integer", Format: "int64"},
+			})
+		}
+		for _, q := range r.Query {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name: q.Name, In: "query", Description: q.Description, Schema: typeSchema(q.Type),
+			})
+		}
+
+		switch {
+		case r.Upload:
+			form := &openAPISchema{Type: "object", Required: []string{"file"}, Properties: map[string]*openAPISchema{
+				"file": {Type: "string", Format: "binary"},
+			}}
+			for _, f := range r.Form {
+				form.Properties[f.Name] = &openAPISchema{Type: f.Type, Description: f.Description}
+			}
+			op.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]*openAPIMediaType{
+				fiber.MIMEMultipartForm: {Schema: form},
+			}}
+		case r.Request != nil:
+			op.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]*openAPIMediaType{
+				fiber.MIMEApplicationJSON: {Schema: b.schemaFor(r.Request)},
+			}}
+		}
+
+		status := r.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &openAPIResponse{Description: http.StatusText(status)}
+		switch {
+		case r.Produces != "":
+			success.Content = map[string]*openAPIMediaType{r.Produces: {Schema: &openAPISchema{Type: "string", Format: "binary"}}}
+		case r.Response != nil:
+			success.Content = map[string]*openAPIMediaType{fiber.MIMEApplicationJSON: {Schema: b.schemaFor(r.Response)}}
+		}
+		op.Responses[strconv.Itoa(status)] = success
+		if r.ETag {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name: fiber.HeaderIfNoneMatch, In: "header", Description: "ETag of a previous response", Schema: typeSchema("string"),
+			})
+			op.Responses[strconv.Itoa(http.StatusNotModified)] = &openAPIResponse{Description: http.StatusText(http.StatusNotModified)}
+		}
+		if r.Idempotent {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name: handlers.HeaderIdempotencyKey, In: "header",
+				Description: "Client-chosen key of at most 255 characters, a retry with the same key and body replays the first response instead of running again",
+				Schema:      typeSchema("string"),
+			})
+		}
+		op.Responses["default"] = &openAPIResponse{Ref: "#/components/responses/Error"}
+
+		path := openAPIPath(r.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	return doc
+}
+
+// operationIDRune keeps letters and digits of a path for operation IDs
+func operationIDRune(r rune) rune {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+		return r
+	}
+	return '_'
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// GetOpenAPI serves the OpenAPI 3 document of the HTTP API
+func GetOpenAPI(c *fiber.Ctx) error {
+	openAPIOnce.Do(func() {
+		var err error
+		openAPIJSON, err = json.Marshal(buildOpenAPI())
+		if err != nil {
+			panic(err)
+		}
+	})
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(openAPIJSON)
+}
+
+// UndocumentedRoutes returns the /api routes registered on app that the OpenAPI document does not describe
+func UndocumentedRoutes(app *fiber.App) []string {
+	documented := make(map[string]bool, len(openAPIRoutes))
+	for _, r := range openAPIRoutes {
+		documented[r.Method+" "+r.Path] = true
+	}
+
+	var missing []string
+	for _, r := range app.GetRoutes(true) {
+		if !strings.HasPrefix(r.Path, "/api/") || r.Method == fiber.MethodHead {
+			continue
+		}
+		// The catch-all answering while the REST API is disabled
+		if strings.HasSuffix(r.Path, "/*") {
+			continue
+		}
+		if key := r.Method + " " + r.Path; !documented[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// UnregisteredRoutes returns the routes the OpenAPI document describes that are not registered on app
+func UnregisteredRoutes(app *fiber.App) []string {
+	registered := make(map[string]bool)
+	for _, r := range app.GetRoutes(true) {
+		registered[r.Method+" "+r.Path] = true
+	}
+
+	var stale []string
+	for _, r := range openAPIRoutes {
+		if key := r.Method + " " + r.Path; !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// apiDocsPage renders the OpenAPI document with Swagger UI
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Koffan API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({ url: '/api/openapi.json', dom_id: '#swagger-ui' });
+</script>
+</body>
+</html>
+`
+
+// GetAPIDocs serves an interactive view of the OpenAPI document
+// Swagger UI is loaded from a CDN so it is not part of the binary
+func GetAPIDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(apiDocsPage)
+}
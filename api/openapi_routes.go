@@ -0,0 +1,334 @@
+package api
+
+import (
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+	"shopping-list/settings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Response bodies built from fiber.Map, described by hand
+var (
+	deletedCountSchema = objectSchema(map[string]*openAPISchema{"deleted": typeSchema("integer")})
+	importResultSchema = func() *openAPISchema {
+		s := objectSchema(map[string]*openAPISchema{
+			"success":            typeSchema("boolean"),
+			"imported_lists":     typeSchema("integer"),
+			"imported_items":     typeSchema("integer"),
+			"imported_templates": typeSchema("integer"),
+			"imported_history":   typeSchema("integer"),
+			"skipped_lists":      typeSchema("integer"),
+			"merged_lists":       {Type: "integer", Description: "Existing lists imported into with merge"},
+			"merged_items":       {Type: "integer", Description: "Existing items whose completed and uncertain flags were updated by merge"},
+			"deduped_items":      {Type: "integer", Description: "Duplicate items collapsed by dedupe_items"},
+			"message":            {Type: "string", Description: "Summary in the request language"},
+			"import_id":          {Type: "string", Description: "ID of the import_progress and import_finished WebSocket events"},
+		})
+		// Only present when rows were skipped or changed
+		s.Properties["warnings"] = &openAPISchema{Type: "array", Items: schemaOfType(handlers.ImportWarning{})}
+		s.Properties["more_warnings"] = &openAPISchema{Type: "integer", Description: "Warnings left out after the first 200"}
+		return s
+	}()
+)
+
+// columnMappingDescription documents the column_mapping field of uploads
+const columnMappingDescription = "JSON object of import columns (list_name, list_icon, section_name, item_name, item_description, item_completed, item_uncertain, item_quantity, section_sort_order, item_sort_order, item_created_at, item_completed_at, item_price, item_currency, item_due_date) to header names or zero-based indices of a CSV or XLSX file from another app; item_name is required. Without it a header naming the columns in any order is used"
+
+// encodingDescription documents the encoding field of uploads
+const encodingDescription = "Encoding of a CSV file: utf-8, utf-16, windows-1252 or iso-8859-1. Detected from the byte order mark or the content when left out"
+
+// openAPIRoutes documents every /api route plus the import and export endpoints of the UI
+// A route registered under /api but missing here is logged at startup, see UndocumentedRoutes
+var openAPIRoutes = []openAPIRoute{
+	// Public
+	{Method: "GET", Path: "/healthz", Tag: "meta", Summary: "Liveness probe", Response: objectSchema(map[string]*openAPISchema{"status": typeSchema("string")})},
+	{Method: "GET", Path: "/readyz", Tag: "meta", Summary: "Readiness probe, 503 with the failing checks when not ready", Response: handlers.ReadinessResponse{}},
+	{Method: "GET", Path: "/api/openapi.json", Tag: "meta", Summary: "This OpenAPI document", Response: &openAPISchema{Type: "object"}},
+	{Method: "GET", Path: "/api/docs", Tag: "meta", Summary: "Interactive API documentation", Produces: fiber.MIMETextHTMLCharsetUTF8},
+	{Method: "GET", Path: "/api/languages", Tag: "meta", Summary: "Available languages and the default", Response: objectSchema(map[string]*openAPISchema{
+		"default":   typeSchema("string"),
+		"languages": {Type: "array", Items: schemaOfType(i18n.LanguageInfo{})},
+	})},
+	{Method: "GET", Path: "/api/version", Tag: "meta", Summary: "Running version and available update", Response: &openAPISchema{Type: "object"}},
+	{Method: "GET", Path: "/api/version/changelog", Tag: "meta", Summary: "Releases newer than the running version", Response: &openAPISchema{Type: "object"}},
+	{Method: "GET", Path: "/api/version/build", Tag: "meta", Summary: "Build information", Response: handlers.BuildInfo{}},
+
+	// REST API
+	{Method: "GET", Path: "/api/v1/me", Tag: "tokens", Summary: "Identity and capabilities of the calling token", Auth: authBearer, Response: MeResponse{}},
+
+	{Method: "GET", Path: "/api/v1/lists", Tag: "lists", Summary: "All lists", Auth: authBearer, Response: ListsResponse{}},
+	{Method: "GET", Path: "/api/v1/lists/:id", Tag: "lists", Summary: "A single list", Auth: authBearer, Response: db.List{}, ETag: true},
+	{Method: "POST", Path: "/api/v1/lists", Tag: "lists", Summary: "Create a list", Auth: authBearer, Request: CreateListRequest{}, Status: fiber.StatusCreated, Response: db.List{}, Idempotent: true},
+	{Method: "PUT", Path: "/api/v1/lists/:id", Tag: "lists", Summary: "Update a list", Auth: authBearer, Request: UpdateListRequest{}, Response: db.List{}},
+	{Method: "DELETE", Path: "/api/v1/lists/:id", Tag: "lists", Summary: "Delete a list with its sections and items", Auth: authBearer, Status: fiber.StatusNoContent},
+	{Method: "GET", Path: "/api/v1/lists/:id/sections", Tag: "lists", Summary: "Sections of a list with their items", Auth: authBearer, Response: SectionsResponse{}, ETag: true},
+	{Method: "POST", Path: "/api/v1/lists/:id/move-up", Tag: "lists", Summary: "Move a list up", Auth: authBearer, Response: db.List{}},
+	{Method: "POST", Path: "/api/v1/lists/:id/move-down", Tag: "lists", Summary: "Move a list down", Auth: authBearer, Response: db.List{}},
+
+	{Method: "POST", Path: "/api/v1/lists/:id/clear-completed", Tag: "lists", Summary: "Delete the completed items of a list", Auth: authBearer, Query: []openAPIParam{
+		{Name: "archive", Type: "boolean", Description: "Record each item as a completion in history"},
+		{Name: "prune_sections", Type: "boolean", Description: "Delete the sections the clear leaves empty"},
+	}, Response: db.ClearCompletedResult{}},
+	{Method: "PUT", Path: "/api/v1/lists/:id/sections/order", Tag: "lists", Summary: "Put the sections of a list in the order of section_ids, the others after them", Auth: authBearer, Request: OrderRequest{}, Response: SectionsResponse{}},
+	{Method: "GET", Path: "/api/v1/lists/:id/activity", Tag: "lists", Summary: "Recorded changes of the items of a list, newest first", Auth: authBearer, Query: []openAPIParam{
+		{Name: "limit", Type: "integer", Description: "Page size, defaults to 50 and at most 200"},
+		{Name: "offset", Type: "integer", Description: "Number of events to skip"},
+	}, Response: ItemEventsResponse{}},
+	{Method: "GET", Path: "/api/v1/lists/:id/trash", Tag: "lists", Summary: "Deleted items of a list that can still be restored, most recently deleted first", Auth: authBearer, Query: []openAPIParam{
+		{Name: "limit", Type: "integer", Description: "Page size, defaults to 50 and at most 200"},
+		{Name: "offset", Type: "integer", Description: "Number of items to skip"},
+	}, Response: TrashResponse{}},
+	{Method: "DELETE", Path: "/api/v1/lists/:id/trash", Tag: "lists", Summary: "Empty the trash of a list, its items cannot be restored afterwards", Auth: authBearer, Response: deletedCountSchema},
+	{Method: "GET", Path: "/api/v1/sections/:id", Tag: "sections", Summary: "A single section", Auth: authBearer, Response: db.Section{}},
+	{Method: "POST", Path: "/api/v1/sections", Tag: "sections", Summary: "Create a section", Auth: authBearer, Request: CreateSectionRequest{}, Status: fiber.StatusCreated, Response: db.Section{}, Idempotent: true},
+	{Method: "PUT", Path: "/api/v1/sections/:id", Tag: "sections", Summary: "Rename a section", Auth: authBearer, Request: UpdateSectionRequest{}, Response: db.Section{}},
+	{Method: "DELETE", Path: "/api/v1/sections/:id", Tag: "sections", Summary: "Delete a section with its items", Auth: authBearer, Status: fiber.StatusNoContent},
+	{Method: "GET", Path: "/api/v1/sections/:id/items", Tag: "sections", Summary: "Items of a section, all of them in manual order by default", Auth: authBearer, Query: []openAPIParam{
+		{Name: "completed", Type: "boolean", Description: "Only completed items with true, only open ones with false"},
+		{Name: "q", Type: "string", Description: "Part of the name or description"},
+		{Name: "sort", Type: "string", Description: "manual, name or created, completed items last in each, defaults to manual"},
+		{Name: "limit", Type: "integer", Description: "Page size, at most 1000, every item without it"},
+		{Name: "offset", Type: "integer", Description: "Number of items to skip"},
+	}, Response: ItemsResponse{}, ETag: true},
+	{Method: "PUT", Path: "/api/v1/sections/:id/items/order", Tag: "sections", Summary: "Put the items of a section in the order of item_ids, the others after them", Auth: authBearer, Request: OrderRequest{}, Response: ItemsResponse{}},
+	{Method: "POST", Path: "/api/v1/sections/:id/move-up", Tag: "sections", Summary: "Move a section up", Auth: authBearer, Response: db.Section{}},
+	{Method: "POST", Path: "/api/v1/sections/:id/move-down", Tag: "sections", Summary: "Move a section down", Auth: authBearer, Response: db.Section{}},
+
+	{Method: "GET", Path: "/api/v1/items/due", Tag: "items", Summary: "Uncompleted items due before a date, overdue ones included, by list", Auth: authBearer, Query: []openAPIParam{
+		{Name: "before", Type: "string", Description: "YYYY-MM-DD, a week from today by default"},
+	}, Response: DueItemsResponse{}},
+	{Method: "POST", Path: "/api/v1/items/batch-delete", Tag: "items", Summary: "Delete several items, reporting IDs without one in not_found", Auth: authBearer, Request: BatchDeleteItemsRequest{}, Response: BatchDeleteItemsResponse{}},
+	{Method: "POST", Path: "/api/v1/items/batch-complete", Tag: "items", Summary: "Set the completed flag of several items, counting those already in that state as unchanged", Auth: authBearer, Request: BatchCompleteItemsRequest{}, Response: BatchCompleteItemsResponse{}},
+	{Method: "GET", Path: "/api/v1/items/:id", Tag: "items", Summary: "A single item", Auth: authBearer, Response: db.Item{}},
+	{Method: "POST", Path: "/api/v1/items", Tag: "items", Summary: "Create an item, or answer 409 duplicate_barcode with the open item of the list that has its barcode", Auth: authBearer, Request: CreateItemRequest{}, Status: fiber.StatusCreated, Response: ItemResponse{}, Idempotent: true},
+	{Method: "PUT", Path: "/api/v1/items/:id", Tag: "items", Summary: "Update an item", Auth: authBearer, Request: UpdateItemRequest{}, Response: ItemResponse{}},
+	{Method: "DELETE", Path: "/api/v1/items/:id", Tag: "items", Summary: "Move an item to the trash of its list", Auth: authBearer, Status: fiber.StatusNoContent},
+	{Method: "POST", Path: "/api/v1/items/:id/toggle", Tag: "items", Summary: "Toggle completed", Auth: authBearer, Response: db.Item{}},
+	{Method: "POST", Path: "/api/v1/items/:id/uncertain", Tag: "items", Summary: "Toggle uncertain", Auth: authBearer, Response: db.Item{}},
+	{Method: "POST", Path: "/api/v1/items/:id/move", Tag: "items", Summary: "Move an item to another section", Auth: authBearer, Request: MoveItemRequest{}, Response: db.Item{}},
+	{Method: "GET", Path: "/api/v1/search", Tag: "items", Summary: "Find items by part of their name or description across lists", Auth: authBearer, Query: []openAPIParam{
+		{Name: "q", Type: "string", Description: "Text to find in item names and descriptions, ignoring case and accents"},
+		{Name: "list_id", Type: "integer", Description: "Only search this list"},
+		{Name: "completed", Type: "boolean", Description: "Only completed items with true, only open ones with false"},
+		{Name: "limit", Type: "integer", Description: "Maximum number of results, defaults to 20 and at most 100"},
+		{Name: "offset", Type: "integer", Description: "Number of results to skip"},
+	}, Response: db.ItemSearchResults{}},
+	{Method: "GET", Path: "/api/v1/products/lookup", Tag: "items", Summary: "Suggested name and brand of a scanned product from Open Food Facts, cached, and marked offline when it cannot be reached", Auth: authBearer, Query: []openAPIParam{
+		{Name: "barcode", Type: "string", Description: "EAN-8, UPC-A, EAN-13 or GTIN-14 digits with their check digit"},
+	}, Response: handlers.ProductLookup{}},
+	{Method: "POST", Path: "/api/v1/items/:id/move-to-list", Tag: "items", Summary: "Move an item to the end of a section of another list, found or created by name", Auth: authBearer, Request: MoveItemToListRequest{}, Response: ItemMovedResponse{}},
+	{Method: "POST", Path: "/api/v1/items/:id/move-up", Tag: "items", Summary: "Move an item up", Auth: authBearer, Response: db.Item{}},
+	{Method: "POST", Path: "/api/v1/items/:id/move-down", Tag: "items", Summary: "Move an item down", Auth: authBearer, Response: db.Item{}},
+	{Method: "POST", Path: "/api/v1/items/:id/photo", Tag: "items", Summary: "Attach a JPEG, PNG or WebP photo of at most 5 MB to an item, replacing any previous one", Auth: authBearer, Upload: true, Response: db.Item{}},
+	{Method: "GET", Path: "/api/v1/items/:id/photo", Tag: "items", Summary: "Download the photo of an item", Auth: authBearer, Produces: "image/*"},
+	{Method: "DELETE", Path: "/api/v1/items/:id/photo", Tag: "items", Summary: "Remove the photo of an item", Auth: authBearer, Status: fiber.StatusNoContent},
+	{Method: "GET", Path: "/api/v1/items/:id/history", Tag: "items", Summary: "Recorded changes of an item, newest first, also after it was deleted", Auth: authBearer, Query: []openAPIParam{
+		{Name: "limit", Type: "integer", Description: "Page size, defaults to 50 and at most 200"},
+		{Name: "offset", Type: "integer", Description: "Number of events to skip"},
+	}, Response: ItemEventsResponse{}},
+	{Method: "POST", Path: "/api/v1/items/:id/restore", Tag: "items", Summary: "Take an item out of the trash at its old place", Auth: authBearer, Response: db.Item{}},
+
+	{Method: "POST", Path: "/api/v1/batch", Tag: "items", Summary: "Create a list, sections or items in one request, or apply ordered operations in one transaction", Auth: authBearer, Request: BatchCreateRequest{}, Status: fiber.StatusCreated, Response: BatchCreateResponse{}, Idempotent: true},
+
+	{Method: "GET", Path: "/api/v1/history", Tag: "history", Summary: "Item history used for suggestions", Auth: authBearer, Response: HistoryResponse{}, ETag: true},
+	{Method: "POST", Path: "/api/v1/history", Tag: "history", Summary: "Add or bump a history entry", Auth: authBearer, Request: CreateHistoryRequest{}, Status: fiber.StatusCreated, Response: &openAPISchema{Type: "object"}},
+	{Method: "DELETE", Path: "/api/v1/history/:id", Tag: "history", Summary: "Delete a history entry", Auth: authBearer, Status: fiber.StatusNoContent},
+	{Method: "POST", Path: "/api/v1/history/batch-delete", Tag: "history", Summary: "Delete several history entries", Auth: authBearer, Request: BatchDeleteHistoryRequest{}, Response: deletedCountSchema},
+
+	{Method: "GET", Path: "/api/v1/lists/:id/tokens", Tag: "tokens", Summary: "Tokens scoped to a list", Auth: authBearer, Response: TokensResponse{}},
+	{Method: "POST", Path: "/api/v1/lists/:id/tokens", Tag: "tokens", Summary: "Create a token scoped to a list", Auth: authBearer, Request: CreateTokenRequest{}, Status: fiber.StatusCreated, Response: CreateTokenResponse{}},
+	{Method: "DELETE", Path: "/api/v1/lists/:id/tokens/:tokenId", Tag: "tokens", Summary: "Revoke a list token", Auth: authBearer, Status: fiber.StatusNoContent},
+	{Method: "GET", Path: "/api/v1/admin/tokens", Tag: "tokens", Summary: "All tokens", Auth: authBearer, Response: TokensResponse{}},
+	{Method: "POST", Path: "/api/v1/admin/tokens/:id/rotate", Tag: "tokens", Summary: "Rotate a token", Auth: authBearer, Request: RotateTokenRequest{}, Response: RotateTokenResponse{}},
+
+	{Method: "GET", Path: "/api/v1/admin/maintenance", Tag: "admin", Summary: "Maintenance mode state", Auth: authBearer, Response: handlers.MaintenanceState{}},
+	{Method: "POST", Path: "/api/v1/admin/maintenance", Tag: "admin", Summary: "Enable or disable maintenance mode", Auth: authBearer, Request: MaintenanceRequest{}, Response: handlers.MaintenanceState{}},
+	{Method: "GET", Path: "/api/v1/admin/settings", Tag: "admin", Summary: "Server-side settings", Auth: authBearer, Response: SettingsResponse{}},
+	{Method: "PUT", Path: "/api/v1/admin/settings", Tag: "admin", Summary: "Change server-side settings", Auth: authBearer, Request: map[string]any{}, Response: SettingsResponse{}},
+	{Method: "GET", Path: "/api/v1/admin/i18n/overrides", Tag: "admin", Summary: "Overridden translation keys per language", Auth: authBearer, Response: objectSchema(map[string]*openAPISchema{
+		"overrides": {Type: "object", AdditionalProperties: &openAPISchema{Type: "array", Items: typeSchema("string")}},
+	})},
+	{Method: "POST", Path: "/api/v1/admin/i18n/reload", Tag: "admin", Summary: "Reload translation overrides", Auth: authBearer, Response: i18n.OverrideReport{}},
+	{Method: "GET", Path: "/api/v1/admin/connectivity-check", Tag: "admin", Summary: "Check outbound connectivity", Auth: authBearer, Query: []openAPIParam{
+		{Name: "target", Type: "string", Description: "Target to check, defaults to github"},
+	}, Response: handlers.ConnectivityResult{}},
+	{Method: "GET", Path: "/api/v1/admin/backup", Tag: "admin", Summary: "Download a consistent copy of the database", Auth: authBearer, Produces: "application/vnd.sqlite3"},
+	{Method: "GET", Path: "/api/v1/admin/backups", Tag: "admin", Summary: "Recent backups with localized dates", Auth: authBearer, Response: BackupsResponse{}},
+	{Method: "POST", Path: "/api/v1/admin/restore", Tag: "admin", Summary: "Replace the database with an uploaded backup", Auth: authBearer, Upload: true, Response: RestoreResponse{}},
+	{Method: "POST", Path: "/api/v1/admin/clear", Tag: "admin", Summary: "Delete selected data", Auth: authBearer, Request: ClearRequest{}, Response: handlers.ClearedData{}},
+	{Method: "POST", Path: "/api/v1/admin/cleanup/run", Tag: "admin", Summary: "Remove old completed items", Auth: authBearer, Request: CleanupRequest{}, Response: handlers.CleanupReport{}},
+	{Method: "POST", Path: "/api/v1/admin/cleanup/files", Tag: "admin", Summary: "Remove unreferenced files", Auth: authBearer, Request: FileCleanupRequest{}, Response: handlers.FileCleanupReport{}},
+	{Method: "GET", Path: "/api/v1/admin/integrity", Tag: "admin", Summary: "Check database integrity", Auth: authBearer, Response: db.IntegrityReport{}},
+	{Method: "POST", Path: "/api/v1/admin/integrity/repair", Tag: "admin", Summary: "Repair orphaned rows", Auth: authBearer, Request: RepairRequest{}, Response: RepairResponse{}},
+	{Method: "POST", Path: "/api/v1/admin/repair-ordering", Tag: "admin", Summary: "Renumber broken sort orders", Auth: authBearer, Request: RepairOrderingRequest{}, Response: handlers.OrderingReport{}},
+	{Method: "GET", Path: "/api/v1/admin/db-stats", Tag: "admin", Summary: "Database connection statistics", Auth: authBearer, Response: db.ConnStats{}},
+	{Method: "GET", Path: "/api/v1/admin/migrations", Tag: "admin", Summary: "Schema migration status", Auth: authBearer, Response: MigrationsResponse{}},
+	{Method: "POST", Path: "/api/v1/admin/seed-demo", Tag: "admin", Summary: "Create demo data", Auth: authBearer, Query: []openAPIParam{
+		{Name: "force", Type: "boolean", Description: "Replace existing data, needs the DELETE confirmation"},
+	}, Request: SeedDemoRequest{}, Status: fiber.StatusCreated, Response: handlers.SeedResult{}},
+	{Method: "GET", Path: "/api/v1/admin/optimize", Tag: "admin", Summary: "Status of the last optimize job", Auth: authBearer, Response: handlers.OptimizeJob{}},
+	{Method: "POST", Path: "/api/v1/admin/optimize", Tag: "admin", Summary: "Optimize the database, large databases run in the background", Auth: authBearer, Response: handlers.OptimizeJob{}},
+	{Method: "GET", Path: "/api/v1/admin/operations", Tag: "admin", Summary: "Running and recent exclusive operations", Auth: authBearer, Response: handlers.OperationsStatus{}},
+	{Method: "DELETE", Path: "/api/v1/admin/operations/lock", Tag: "admin", Summary: "Clear a stale operation lock", Auth: authBearer, Response: objectSchema(map[string]*openAPISchema{
+		"cleared": schemaOfType(&handlers.Operation{}),
+	})},
+	{Method: "GET", Path: "/api/v1/admin/shares", Tag: "shares", Summary: "Active share links", Auth: authBearer, Response: SharesResponse{}},
+	{Method: "POST", Path: "/api/v1/admin/shares", Tag: "shares", Summary: "Create a share link", Auth: authBearer, Request: CreateShareRequest{}, Status: fiber.StatusCreated, Response: CreateShareResponse{}},
+	{Method: "DELETE", Path: "/api/v1/admin/shares/:id", Tag: "shares", Summary: "Revoke a share link", Auth: authBearer, Status: fiber.StatusNoContent},
+
+	// Web UI
+	{Method: "GET", Path: "/api/settings", Tag: "ui", Summary: "Server-side settings with types, defaults and sources", Auth: authSession, Response: objectSchema(map[string]*openAPISchema{
+		"settings": {Type: "array", Items: schemaOfType(settings.Info{})},
+	})},
+	{Method: "PUT", Path: "/api/settings", Tag: "ui", Summary: "Change server-side settings", Auth: authSession, Request: map[string]any{}, Response: objectSchema(map[string]*openAPISchema{
+		"settings": {Type: "array", Items: schemaOfType(settings.Info{})},
+	})},
+	{Method: "PUT", Path: "/api/settings/language", Tag: "ui", Summary: "Change the default language", Auth: authSession, Request: objectSchema(map[string]*openAPISchema{
+		"language": typeSchema("string"),
+	}), Response: objectSchema(map[string]*openAPISchema{"default": typeSchema("string")})},
+	{Method: "POST", Path: "/api/version/refresh", Tag: "ui", Summary: "Check for updates now", Auth: authSession, Response: &openAPISchema{Type: "object"}},
+	{Method: "GET", Path: "/api/data", Tag: "ui", Summary: "All sections with items and stats", Auth: authSession, Response: objectSchema(map[string]*openAPISchema{
+		"sections":  {Type: "array", Items: schemaOfType(db.Section{})},
+		"stats":     schemaOfType(db.Stats{}),
+		"timestamp": typeSchema("integer"),
+	})},
+	{Method: "GET", Path: "/api/stats/overview", Tag: "ui", Summary: "Totals, completions per weekday and most active sections", Auth: authSession, Query: []openAPIParam{
+		{Name: "since", Type: "string", Description: "Start of the activity range, YYYY-MM-DD or RFC 3339, defaults to 30 days ago"},
+		{Name: "top", Type: "integer", Description: "Number of sections to return, defaults to 5"},
+		{Name: "include_archived", Type: "boolean", Description: "Count archived lists and their items"},
+	}, Response: db.StatsOverview{}},
+	{Method: "GET", Path: "/api/stats/timeseries", Tag: "ui", Summary: "A metric per day, week or month", Auth: authSession, Query: []openAPIParam{
+		{Name: "metric", Type: "string", Description: "completed_items (default), added_items or open_items (average per list)"},
+		{Name: "interval", Type: "string", Description: "day, week (default, starting Monday) or month, in UTC"},
+		{Name: "since", Type: "string", Description: "Start of the range, YYYY-MM-DD or RFC 3339"},
+		{Name: "until", Type: "string", Description: "End of the range, defaults to now"},
+		{Name: "include_archived", Type: "boolean", Description: "Count archived lists and their items"},
+	}, Response: db.Timeseries{}},
+	{Method: "GET", Path: "/api/item/:id/version", Tag: "ui", Summary: "Last change of an item, used to resolve offline edits", Auth: authSession, Response: objectSchema(map[string]*openAPISchema{
+		"id":         typeSchema("integer"),
+		"updated_at": typeSchema("integer"),
+		"completed":  typeSchema("boolean"),
+	})},
+	{Method: "GET", Path: "/api/suggestions", Tag: "history", Summary: "Name suggestions from history", Auth: authSession, Query: []openAPIParam{
+		{Name: "q", Type: "string", Description: "Search text"},
+		{Name: "limit", Type: "integer", Description: "Maximum number of suggestions, defaults to 10"},
+	}, Response: []db.ItemSuggestion{}},
+	{Method: "GET", Path: "/api/search", Tag: "ui", Summary: "Ranked search across items, history, templates and lists", Auth: authSession, Query: []openAPIParam{
+		{Name: "q", Type: "string", Description: "Search text, all words must match, a trailing * matches a prefix"},
+		{Name: "scope", Type: "string", Description: "Comma separated subset of items, history, templates and lists, defaults to all"},
+		{Name: "limit", Type: "integer", Description: "Maximum number of results, defaults to 20"},
+	}, Response: db.SearchResults{}},
+	{Method: "GET", Path: "/api/search/items", Tag: "ui", Summary: "Find items by part of their name or description across lists", Auth: authSession, Query: []openAPIParam{
+		{Name: "q", Type: "string", Description: "Text to find in item names and descriptions, ignoring case and accents"},
+		{Name: "list_id", Type: "integer", Description: "Only search this list"},
+		{Name: "completed", Type: "boolean", Description: "Only completed items with true, only open ones with false"},
+		{Name: "limit", Type: "integer", Description: "Maximum number of results, defaults to 20 and at most 100"},
+		{Name: "offset", Type: "integer", Description: "Number of results to skip"},
+	}, Response: db.ItemSearchResults{}},
+	{Method: "GET", Path: "/api/products/lookup", Tag: "ui", Summary: "Suggested name and brand of a scanned product", Auth: authSession, Query: []openAPIParam{
+		{Name: "barcode", Type: "string", Description: "EAN-8, UPC-A, EAN-13 or GTIN-14 digits with their check digit"},
+	}, Response: handlers.ProductLookup{}},
+	{Method: "POST", Path: "/api/admin/search/reindex", Tag: "ui", Summary: "Rebuild the full-text search index", Auth: authSession, Response: handlers.SearchReindexResponse{}},
+	{Method: "GET", Path: "/api/history", Tag: "history", Summary: "Item history for management", Auth: authSession, Response: []db.HistoryItem{}, ETag: true},
+	{Method: "DELETE", Path: "/api/history/:id", Tag: "history", Summary: "Delete a history entry", Auth: authSession, Response: objectSchema(map[string]*openAPISchema{"success": typeSchema("boolean")})},
+	{Method: "POST", Path: "/api/history/batch-delete", Tag: "history", Summary: "Delete several history entries", Auth: authSession, Request: BatchDeleteHistoryRequest{}, Response: deletedCountSchema},
+	{Method: "GET", Path: "/api/database/clear-challenge", Tag: "ui", Summary: "Challenge required to clear the database", Auth: authSession, Response: objectSchema(map[string]*openAPISchema{
+		"challenge":  typeSchema("string"),
+		"expires_at": typeSchema("integer"),
+	})},
+	{Method: "POST", Path: "/api/database/clear", Tag: "ui", Summary: "Clear the database", Auth: authSession, Request: handlers.ClearDatabaseRequest{}, Response: objectSchema(map[string]*openAPISchema{
+		"success": typeSchema("boolean"),
+		"cleared": {Type: "array", Items: typeSchema("string")},
+		"counts":  {Type: "object", AdditionalProperties: typeSchema("integer")},
+	})},
+
+	{Method: "POST", Path: "/api/backup/push", Tag: "import-export", Summary: "Upload the JSON export to the configured S3 or WebDAV destination", Auth: authSession, Response: handlers.BackupPushResult{}},
+	{Method: "POST", Path: "/api/backup/test", Tag: "import-export", Summary: "Write and delete a probe object on the configured backup destination", Auth: authSession, Response: handlers.BackupTestResult{}},
+
+	{Method: "GET", Path: "/export", Tag: "import-export", Summary: "Export all data", Auth: authSession, Query: []openAPIParam{
+		{Name: "format", Type: "string", Description: "json (default), yaml, csv, xlsx, markdown, html, a printable page, or zip, a ZIP of the JSON and CSV exports"},
+		{Name: "inline", Type: "boolean", Description: "With markdown or html, leave out Content-Disposition so the export is shown instead of downloaded"},
+		{Name: "columns", Type: "integer", Description: "With html, 1 (default) or 2 columns of items"},
+		{Name: "include_templates", Type: "boolean", Description: "Also export templates, in CSV as [TEMPLATE] rows"},
+		{Name: "delimiter", Type: "string", Description: `CSV delimiter, a single character or \t or "tab" for a tab`},
+		{Name: "crlf", Type: "boolean", Description: "End CSV lines with CRLF"},
+		{Name: "quote_all", Type: "boolean", Description: "Quote every CSV field, not only those that need it"},
+		{Name: "excel", Type: "boolean", Description: "CSV for Excel in European locales: a semicolon delimiter unless delimiter is given, and CRLF"},
+		{Name: "include_history", Type: "boolean"},
+		{Name: "exclude_completed", Type: "boolean", Description: "Leave out completed items and the sections left empty"},
+		{Name: "include_empty_sections", Type: "boolean", Description: "With exclude_completed, keep the sections left empty"},
+		{Name: "include_photos", Type: "boolean", Description: "With zip, bundle the photos of items under photos/"},
+	}, Response: handlers.ExportData{}},
+	{Method: "GET", Path: "/export/list/:id", Tag: "import-export", Summary: "Export a single list", Auth: authSession, Query: []openAPIParam{
+		{Name: "format", Type: "string", Description: "json (default), csv, xlsx, markdown or html, a printable page"},
+		{Name: "inline", Type: "boolean", Description: "With markdown or html, leave out Content-Disposition so the export is shown instead of downloaded"},
+		{Name: "columns", Type: "integer", Description: "With html, 1 (default) or 2 columns of items"},
+		{Name: "include_history", Type: "boolean", Description: "With json or csv, also export the history entries last added to a section of this list, in CSV as [HISTORY] rows"},
+		{Name: "delimiter", Type: "string", Description: `CSV delimiter, a single character or \t or "tab" for a tab`},
+		{Name: "crlf", Type: "boolean", Description: "End CSV lines with CRLF"},
+		{Name: "quote_all", Type: "boolean", Description: "Quote every CSV field, not only those that need it"},
+		{Name: "excel", Type: "boolean", Description: "CSV for Excel in European locales: a semicolon delimiter unless delimiter is given, and CRLF"},
+		{Name: "exclude_completed", Type: "boolean", Description: "Leave out completed items and the sections left empty"},
+		{Name: "include_empty_sections", Type: "boolean", Description: "With exclude_completed, keep the sections left empty"},
+	}, Response: handlers.ExportData{}, ETag: true},
+	{Method: "GET", Path: "/export/templates/:id", Tag: "import-export", Summary: "Export a single template, importable on its own", Auth: authSession, Query: []openAPIParam{
+		{Name: "format", Type: "string", Description: "json (default) or csv with [TEMPLATE] rows"},
+		{Name: "delimiter", Type: "string", Description: `CSV delimiter, a single character or \t or "tab" for a tab`},
+		{Name: "crlf", Type: "boolean", Description: "End CSV lines with CRLF"},
+		{Name: "quote_all", Type: "boolean", Description: "Quote every CSV field, not only those that need it"},
+		{Name: "excel", Type: "boolean", Description: "CSV for Excel in European locales: a semicolon delimiter unless delimiter is given, and CRLF"},
+	}, Response: handlers.ExportData{}},
+	{Method: "GET", Path: "/export/history", Tag: "import-export", Summary: "Export the whole item history", Auth: authSession, Query: []openAPIParam{
+		{Name: "format", Type: "string", Description: "json (default) or csv with [HISTORY] rows"},
+		{Name: "delimiter", Type: "string", Description: `CSV delimiter, a single character or \t or "tab" for a tab`},
+		{Name: "crlf", Type: "boolean", Description: "End CSV lines with CRLF"},
+		{Name: "quote_all", Type: "boolean", Description: "Quote every CSV field, not only those that need it"},
+		{Name: "excel", Type: "boolean", Description: "CSV for Excel in European locales: a semicolon delimiter unless delimiter is given, and CRLF"},
+	}, Response: handlers.ExportData{}},
+	{Method: "POST", Path: "/api/export/link", Tag: "import-export", Summary: "Signed, expiring download URL of the full export or one list", Auth: authBearer, Request: CreateExportLinkRequest{}, Status: fiber.StatusCreated, Response: CreateExportLinkResponse{}},
+	{Method: "GET", Path: "/export/download", Tag: "import-export", Summary: "Download the export a signed link describes, 403 when it was changed or has expired", Query: []openAPIParam{
+		{Name: "sig", Type: "string", Description: "Signature over the path and every other parameter"},
+		{Name: "exp", Type: "integer", Description: "Unix time the link expires"},
+		{Name: "list_id", Type: "integer", Description: "Export this list, as GET /export/list/:id does"},
+	}, Response: handlers.ExportData{}},
+	{Method: "GET", Path: "/export/preview", Tag: "import-export", Summary: "Counts of what an export contains", Auth: authSession, Query: []openAPIParam{
+		{Name: "exclude_completed", Type: "boolean", Description: "Count only the items that are not completed"},
+	}, Response: objectSchema(map[string]*openAPISchema{
+		"lists_count":     typeSchema("integer"),
+		"items_count":     typeSchema("integer"),
+		"templates_count": typeSchema("integer"),
+		"history_count":   typeSchema("integer"),
+	})},
+	{Method: "POST", Path: "/import/preview", Tag: "import-export", Summary: "Validate an import file", Auth: authSession, Query: []openAPIParam{
+		{Name: "delimiter", Type: "string", Description: `CSV delimiter, a single character or \t or "tab" for a tab`},
+	}, Upload: true, Form: []openAPIParam{
+		{Name: "column_mapping", Type: "string", Description: columnMappingDescription},
+		{Name: "encoding", Type: "string", Description: encodingDescription},
+		{Name: "strict", Type: "boolean", Description: "Mark the preview invalid with import_rejected when the import would have warnings"},
+	}, Response: handlers.ImportPreviewResponse{}},
+	{Method: "POST", Path: "/import", Tag: "import-export", Summary: "Import a JSON, YAML, CSV or XLSX file", Auth: authSession, Upload: true, Form: []openAPIParam{
+		{Name: "conflict_resolution", Type: "string", Description: "skip (default), replace, copy or merge for lists that already exist"},
+		{Name: "conflict_resolutions", Type: "string", Description: "JSON object of list names to skip, replace, copy or merge, overriding conflict_resolution for those lists"},
+		{Name: "copy_suffix", Type: "string", Description: "Suffix of copied list names"},
+		{Name: "delimiter", Type: "string", Description: `CSV delimiter, a single character or \t or "tab" for a tab`},
+		{Name: "column_mapping", Type: "string", Description: columnMappingDescription},
+		{Name: "encoding", Type: "string", Description: encodingDescription},
+		{Name: "dedupe_items", Type: "boolean", Description: "Collapse items named alike, ignoring case, within a section of the file into the first, which is completed or uncertain if any of them is"},
+		{Name: "strict", Type: "boolean", Description: "Reject the whole import with import_rejected and its warnings instead of importing with warnings"},
+		{Name: "total_items", Type: "integer", Description: "Expected rows, usually the items_count of the preview, reported as total in import_progress events"},
+		{Name: "async", Type: "boolean", Description: "Answer 202 with the import_id right away and run the import in the background, its outcome is sent as an import_finished event"},
+	}, Response: importResultSchema, Idempotent: true},
+	{Method: "POST", Path: "/import/url/preview", Tag: "import-export", Summary: "Validate an import file fetched from a URL", Auth: authSession, Request: handlers.ImportURLRequest{}, Response: handlers.ImportPreviewResponse{}},
+	{Method: "POST", Path: "/import/url", Tag: "import-export", Summary: "Import a file fetched from a URL", Auth: authSession, Request: handlers.ImportURLRequest{}, Response: importResultSchema, Idempotent: true},
+	{Method: "POST", Path: "/import/history", Tag: "import-export", Summary: "Merge the history of a history or full export into the item history", Auth: authSession, Upload: true, Form: []openAPIParam{
+		{Name: "delimiter", Type: "string", Description: `CSV delimiter, a single character or \t or "tab" for a tab`},
+		{Name: "encoding", Type: "string", Description: encodingDescription},
+	}, Response: handlers.HistoryImportResult{}, Idempotent: true},
+	{Method: "POST", Path: "/import/text", Tag: "import-export", Summary: "Add items pasted as text or Markdown", Auth: authSession, Request: handlers.TextImportRequest{}, Response: handlers.TextImportResponse{}, Idempotent: true},
+	{Method: "GET", Path: "/api/imports", Tag: "import-export", Summary: "Recent imports with the rows they created", Auth: authSession, Response: []db.ImportBatch{}},
+	{Method: "POST", Path: "/api/imports/:id/rollback", Tag: "import-export", Summary: "Undo an import, deleting what it created and restoring the lists it replaced", Auth: authSession, Query: []openAPIParam{
+		{Name: "force", Type: "boolean", Description: "Roll back even when rows of the import were changed after it"},
+	}, Response: handlers.ImportRollbackResult{}},
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// getOpenAPI fetches the served document and decodes it without the Go types that built it
+func getOpenAPI(t *testing.T) map[string]any {
+	t.Helper()
+	app := setupTestAPI(t)
+	app.Get("/api/openapi.json", GetOpenAPI)
+	status, body := apiRequest(t, app, http.MethodGet, "/api/openapi.json", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json = %d", status)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("document is not JSON: %v", err)
+	}
+	return doc
+}
+
+// resolvePointer follows a local JSON reference such as #/components/schemas/Item
+func resolvePointer(doc map[string]any, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	var node any = doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// collectRefs appends every $ref below node
+func collectRefs(node any, refs *[]string) {
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if ref, ok := child.(string); ok && k == "$ref" {
+				*refs = append(*refs, ref)
+				continue
+			}
+			collectRefs(child, refs)
+		}
+	case []any:
+		for _, child := range v {
+			collectRefs(child, refs)
+		}
+	}
+}
+
+var pathTemplatePattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+var openAPIMethods = map[string]bool{"get": true, "put": true, "post": true, "delete": true, "patch": true, "head": true, "options": true}
+
+func TestOpenAPIDocumentIsValid(t *testing.T) {
+	doc := getOpenAPI(t)
+
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.0.") {
+		t.Errorf("openapi = %q, want 3.0.x", v)
+	}
+	info, _ := doc["info"].(map[string]any)
+	if info["title"] == "" || info["version"] == nil {
+		t.Errorf("info lacks title or version: %v", info)
+	}
+
+	components, _ := doc["components"].(map[string]any)
+	schemes, _ := components["securitySchemes"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	for _, name := range []string{"CreateItemRequest", "ErrorResponse", "ImportPreviewResponse", "ExportData"} {
+		if schemas[name] == nil {
+			t.Errorf("schema %s missing", name)
+		}
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	if len(paths) == 0 {
+		t.Fatal("document has no paths")
+	}
+	operationIDs := make(map[string]string)
+	for path, item := range paths {
+		if !strings.HasPrefix(path, "/") {
+			t.Errorf("path %q does not start with /", path)
+		}
+		templated := make(map[string]bool)
+		for _, m := range pathTemplatePattern.FindAllStringSubmatch(path, -1) {
+			templated[m[1]] = true
+		}
+
+		for method, raw := range item.(map[string]any) {
+			where := strings.ToUpper(method) + " " + path
+			if !openAPIMethods[method] {
+				t.Errorf("%s: unknown method", where)
+				continue
+			}
+			op := raw.(map[string]any)
+
+			id, _ := op["operationId"].(string)
+			if id == "" {
+				t.Errorf("%s: no operationId", where)
+			} else if other, dup := operationIDs[id]; dup {
+				t.Errorf("%s: operationId %s also used by %s", where, id, other)
+			}
+			operationIDs[id] = where
+
+			responses, _ := op["responses"].(map[string]any)
+			if len(responses) == 0 {
+				t.Errorf("%s: no responses", where)
+			}
+
+			declared := make(map[string]bool)
+			params, _ := op["parameters"].([]any)
+			for _, p := range params {
+				param := p.(map[string]any)
+				if param["in"] == "path" {
+					declared[param["name"].(string)] = true
+					if param["required"] != true {
+						t.Errorf("%s: path parameter %v not required", where, param["name"])
+					}
+				}
+			}
+			for name := range templated {
+				if !declared[name] {
+					t.Errorf("%s: path parameter %s not declared", where, name)
+				}
+			}
+			for name := range declared {
+				if !templated[name] {
+					t.Errorf("%s: parameter %s is not in the path", where, name)
+				}
+			}
+
+			security, _ := op["security"].([]any)
+			for _, s := range security {
+				for scheme := range s.(map[string]any) {
+					if schemes[scheme] == nil {
+						t.Errorf("%s: unknown security scheme %s", where, scheme)
+					}
+				}
+			}
+		}
+	}
+
+	var refs []string
+	collectRefs(doc, &refs)
+	if len(refs) == 0 {
+		t.Fatal("document has no references")
+	}
+	for _, ref := range refs {
+		if !resolvePointer(doc, ref) {
+			t.Errorf("reference %s does not resolve", ref)
+		}
+	}
+}
+
+func TestRegisteredRoutesAreDocumented(t *testing.T) {
+	app := setupTestAPI(t)
+	for _, route := range UndocumentedRoutes(app) {
+		t.Errorf("route missing from the OpenAPI document: %s", route)
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOperations returns the operation holding the lock and recently finished operations
+func GetOperations(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	return c.JSON(handlers.GetOperations())
+}
+
+// ClearOperationLock clears a lock left by a crashed process or held for too long
+func ClearOperationLock(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	cleared, err := handlers.ClearStaleOperation()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeClearFailed, "lock_clear_failed")
+	}
+	if cleared == nil {
+		return apiError(c, handlers.ErrCodeNotStale, "not_stale")
+	}
+
+	auditAdmin(c, "clear_operation_lock", fmt.Sprintf("operation=%s started_at=%d pid=%d",
+		cleared.Name, cleared.StartedAt, cleared.PID))
+
+	return c.JSON(fiber.Map{"cleared": cleared})
+}
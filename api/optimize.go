@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Optimize checkpoints, analyzes and vacuums the database
+// Large databases are optimized in the background, poll GET /admin/optimize for the result
+func Optimize(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	job, err := handlers.StartOptimize()
+	var busy *handlers.OperationBusyError
+	switch {
+	case errors.As(err, &busy):
+		return handlers.OperationConflict(c, busy)
+	case errors.Is(err, handlers.ErrMaintenanceRequired):
+		return apiError(c, handlers.ErrCodeMaintenanceRequired, "maintenance_required")
+	case err != nil:
+		return apiError(c, handlers.ErrCodeOptimizeFailed, "optimize_failed")
+	}
+
+	auditAdmin(c, "optimize", fmt.Sprintf("job=%s async=%v size_before=%d size_after=%d",
+		job.ID, job.Async, job.SizeBefore, job.SizeAfter))
+
+	if job.Async {
+		return c.Status(fiber.StatusAccepted).JSON(job)
+	}
+	if job.Status == handlers.OptimizeFailed {
+		return apiError(c, handlers.ErrCodeOptimizeFailed, "optimize_failed")
+	}
+	return c.JSON(job)
+}
+
+// GetOptimizeStatus returns the most recent optimize job
+func GetOptimizeStatus(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	job := handlers.GetOptimizeJob()
+	if job == nil {
+		return apiError(c, handlers.ErrCodeNotFound, "not_found.optimize_job")
+	}
+	return c.JSON(job)
+}
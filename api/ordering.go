@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"shopping-list/handlers"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RepairOrderingRequest for renumbering sort_order
+type RepairOrderingRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// RepairOrdering rewrites duplicate or gapped sort_order values of sections and items
+func RepairOrdering(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req RepairOrderingRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+		}
+	}
+
+	report, err := handlers.RepairOrdering(req.DryRun)
+	var busy *handlers.OperationBusyError
+	if errors.As(err, &busy) {
+		return handlers.OperationConflict(c, busy)
+	}
+	if err != nil {
+		return apiError(c, handlers.ErrCodeRepairFailed, "repair_failed")
+	}
+
+	if !req.DryRun {
+		var details []string
+		for _, r := range report.Repairs {
+			details = append(details, fmt.Sprintf("%s:%d=%d", r.Table, r.ParentID, r.Changed))
+		}
+		auditAdmin(c, "repair_ordering", strings.Join(details, " "))
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// auditCount returns the number of audit log entries
+func auditCount(t *testing.T) int {
+	t.Helper()
+	entries, err := db.GetAuditLog(1000)
+	if err != nil {
+		t.Fatalf("audit log: %v", err)
+	}
+	return len(entries)
+}
+
+func TestRepairOrderingEndpoint(t *testing.T) {
+	app := setupTestAPI(t)
+	list, section, _ := createTestItem(t, "Groceries", "Milk")
+	if _, err := db.CreateItem(section.ID, "Cheese", "", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec("UPDATE items SET sort_order = 4 WHERE section_id = ?", section.ID); err != nil {
+		t.Fatal(err)
+	}
+	writeToken := createListToken(t, app, list.ID, ScopeWrite).Token
+	conn := dialEvents(t)
+
+	status, body := apiRequest(t, app, "POST", "/api/v1/admin/repair-ordering", writeToken, RepairOrderingRequest{DryRun: true})
+	if status != fiber.StatusForbidden || errorCode(t, body) != handlers.ErrCodeInsufficientScope {
+		t.Errorf("repair with a write token: %d %s, want 403", status, body)
+	}
+
+	// A dry run reports both items without changing them or writing to the audit log
+	audits := auditCount(t)
+	status, body = apiRequest(t, app, "POST", "/api/v1/admin/repair-ordering", testMasterToken, RepairOrderingRequest{DryRun: true})
+	var report handlers.OrderingReport
+	if status != fiber.StatusOK || json.Unmarshal(body, &report) != nil {
+		t.Fatalf("dry run: %d %s", status, body)
+	}
+	want := db.OrderingRepair{Table: "items", ParentID: section.ID, Changed: 2}
+	if !report.DryRun || len(report.Repairs) != 1 || report.Repairs[0] != want {
+		t.Errorf("dry run report = %+v, want %+v", report, want)
+	}
+	if items, _ := db.GetItemsBySection(section.ID); items[0].SortOrder != 4 {
+		t.Errorf("dry run changed sort_order to %d", items[0].SortOrder)
+	}
+	if n := auditCount(t); n != audits {
+		t.Errorf("dry run wrote %d audit entries", n-audits)
+	}
+
+	status, body = apiRequest(t, app, "POST", "/api/v1/admin/repair-ordering", testMasterToken, nil)
+	if status != fiber.StatusOK || json.Unmarshal(body, &report) != nil {
+		t.Fatalf("repair: %d %s", status, body)
+	}
+	if report.DryRun || len(report.Repairs) != 1 || report.Repairs[0] != want {
+		t.Errorf("repair report = %+v, want %+v", report, want)
+	}
+	if e := lastAudit(t); e.Action != "repair_ordering" || e.Details != fmt.Sprintf("items:%d=2", section.ID) {
+		t.Errorf("audit entry = %+v, want the repair", e)
+	}
+	// The dry run broadcast nothing, so the first event is the repair's
+	event := readEvent(t, conn)
+	var data struct {
+		SectionID int64 `json:"section_id"`
+	}
+	if event.Type != "items_reordered" || json.Unmarshal(event.Data, &data) != nil || data.SectionID != section.ID {
+		t.Errorf("event = %s %s, want items_reordered for section %d", event.Type, event.Data, section.ID)
+	}
+	noEvent(t, conn)
+
+	if status, body := apiRequest(t, app, "POST", "/api/v1/admin/repair-ordering", testMasterToken, "not an object"); status != fiber.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeInvalidJSON {
+		t.Errorf("invalid body: %d %s, want 400", status, body)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// photoContentTypes maps the extensions handlers.SavePhoto gives photos to the type they are served with
+var photoContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
+// UploadItemPhoto sets the photo of an item from the multipart field file, replacing any previous one
+// The image type is sniffed from the content, the file name and type the client sent are ignored
+func UploadItemPhoto(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+	if _, err := db.GetItemByID(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "file"})
+	}
+	if file.Size > handlers.MaxPhotoSize {
+		return photoTooLarge(c)
+	}
+	src, err := file.Open()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeValidation, "validation_error.unreadable_upload")
+	}
+	defer src.Close()
+
+	photo, err := handlers.SavePhoto(src)
+	switch {
+	case errors.Is(err, handlers.ErrPhotoTooLarge):
+		return photoTooLarge(c)
+	case errors.Is(err, handlers.ErrPhotoType):
+		return apiError(c, handlers.ErrCodeInvalidFile, "validation_error.photo_type")
+	case err != nil:
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
+	}
+
+	item, err := db.SetItemPhoto(int64(id), photo)
+	if err != nil {
+		// Nothing references the file, the item was deleted meanwhile or the update failed
+		if path, ok := handlers.ManagedFilePath(photo); ok {
+			os.Remove(path)
+		}
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
+	}
+
+	handlers.BroadcastFrom(c, "item_updated", item)
+	return c.JSON(item)
+}
+
+// photoTooLarge refuses a photo over handlers.MaxPhotoSize
+func photoTooLarge(c *fiber.Ctx) error {
+	return apiErrorF(c, handlers.ErrCodePayloadTooLarge, "validation_error.photo_too_large", map[string]any{
+		"max": strconv.Itoa(handlers.MaxPhotoSize>>20) + " MB",
+	})
+}
+
+// GetItemPhoto sends the photo of an item. Every upload gets a new file name, so the ETag
+// follows the name and clients revalidate instead of keeping a replaced photo
+func GetItemPhoto(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	photo, err := db.GetItemPhoto(int64(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	if photo == "" {
+		return apiError(c, handlers.ErrCodeNotFound, "not_found.photo")
+	}
+	file, ok := handlers.ManagedFilePath(photo)
+	if !ok {
+		return apiError(c, handlers.ErrCodeNotFound, "not_found.photo")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	if handlers.NotModified(c, photo) {
+		return handlers.NotModifiedResponse(c)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.photo")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	c.Set(fiber.HeaderContentType, photoContentTypes[path.Ext(photo)])
+	c.Set(fiber.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+	// fasthttp closes the file after sending
+	return c.SendStream(f, int(info.Size()))
+}
+
+// DeleteItemPhoto removes the photo of an item and its file
+func DeleteItemPhoto(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	photo, err := db.GetItemPhoto(int64(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	if photo == "" {
+		return apiError(c, handlers.ErrCodeNotFound, "not_found.photo")
+	}
+
+	// The file goes with the released files once the request is done, see handlers.ReleasedFilesMiddleware
+	item, err := db.SetItemPhoto(int64(id), "")
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.item")
+		}
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
+	}
+
+	handlers.BroadcastFrom(c, "item_updated", item)
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"database/sql"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LookupProduct resolves a scanned barcode to a suggested name and brand, which the client can send to CreateItem
+// Open Food Facts being unreachable is not an error, the answer is then cached or marked offline
+func LookupProduct(c *fiber.Ctx) error {
+	if !handlers.ProductLookupEnabled() {
+		return apiError(c, handlers.ErrCodeNotConfigured, "product_lookup_disabled")
+	}
+	barcode, err := handlers.ParseBarcode(c.Query("barcode"))
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+	if barcode == "" {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "barcode"})
+	}
+
+	product, err := handlers.LookupProduct(barcode, time.Now())
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	return c.JSON(product)
+}
+
+// openItemWithBarcodeTx returns the open item with the barcode in the list of a section, nil when there is none
+func openItemWithBarcodeTx(tx *sql.Tx, sectionID int64, barcode string) (*db.Item, error) {
+	var listID int64
+	if err := tx.QueryRow("SELECT list_id FROM sections WHERE id = ?", sectionID).Scan(&listID); err != nil {
+		return nil, err
+	}
+	item, err := db.FindOpenItemByBarcodeTx(tx, listID, barcode)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return item, err
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+)
+
+func TestCreateItemReturnsOpenItemWithBarcode(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, _ := createTestItem(t, "Groceries", "Bread")
+	scan := map[string]any{"section_id": section.ID, "name": "Milk", "barcode": testBarcode}
+
+	status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, scan)
+	if status != http.StatusCreated {
+		t.Fatalf("first scan: status %d, body %s", status, body)
+	}
+	created := decodeItem(t, body)
+
+	status, body = apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, scan)
+	if status != http.StatusConflict || errorCode(t, body) != handlers.ErrCodeDuplicateBarcode {
+		t.Fatalf("second scan: status %d, body %s, want duplicate_barcode", status, body)
+	}
+	var conflict BarcodeConflictError
+	if err := json.Unmarshal(body, &conflict); err != nil || conflict.Item.ID != created.ID {
+		t.Errorf("conflict %s, want the item of the first scan", body)
+	}
+
+	// Once completed the product can be added again
+	if _, err := db.DB.Exec("UPDATE items SET completed = TRUE WHERE id = ?", created.ID); err != nil {
+		t.Fatalf("complete item: %v", err)
+	}
+	if status, body := apiRequest(t, app, http.MethodPost, "/api/v1/items", testMasterToken, scan); status != http.StatusCreated {
+		t.Errorf("scan after completing: status %d, body %s", status, body)
+	}
+}
+
+// writeWaits returns how often a write has queued for the write connection
+func writeWaits(t *testing.T) int64 {
+	t.Helper()
+	stats, err := db.GetConnStats()
+	if err != nil {
+		t.Fatalf("conn stats: %v", err)
+	}
+	return stats.WriteWaitCount
+}
+
+func TestConcurrentScansCreateOneItem(t *testing.T) {
+	app := setupTestAPI(t)
+	_, section, _ := createTestItem(t, "Groceries", "Bread")
+	data, err := json.Marshal(map[string]any{"section_id": section.ID, "name": "Milk", "barcode": testBarcode})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A write held open queues every scan behind it, so they all reach the check before any insert
+	hold, err := db.BeginWrite()
+	if err != nil {
+		t.Fatalf("hold the write connection: %v", err)
+	}
+	before := writeWaits(t)
+
+	const scans = 10
+	var wg sync.WaitGroup
+	statuses := make(chan int, scans)
+	failures := make(chan string, scans)
+	for i := 0; i < scans; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/items", bytes.NewReader(data))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+testMasterToken)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				failures <- err.Error()
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); writeWaits(t) < before+scans; {
+		if time.Now().After(deadline) {
+			t.Fatal("scans never queued for the write connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	hold.Rollback()
+	wg.Wait()
+	close(statuses)
+	close(failures)
+	for f := range failures {
+		t.Error(f)
+	}
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != scans-1 {
+		t.Errorf("statuses = %v, want one 201 and %d 409", counts, scans-1)
+	}
+	var stored int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM items WHERE barcode = ?", testBarcode).Scan(&stored); err != nil {
+		t.Fatalf("count items: %v", err)
+	}
+	if stored != 1 {
+		t.Errorf("%d items with the barcode, want 1", stored)
+	}
+}
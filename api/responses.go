@@ -1,15 +1,15 @@
 package api
 
 import (
+	"encoding/json"
 	"shopping-list/db"
+	"shopping-list/handlers"
 	"unicode"
 )
 
 // ErrorResponse represents an API error
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-}
+// Shared with the UI middlewares so permission errors look the same everywhere
+type ErrorResponse = handlers.ErrorResponse
 
 // ListsResponse wraps multiple lists
 type ListsResponse struct {
@@ -18,12 +18,74 @@ type ListsResponse struct {
 
 // SectionsResponse wraps multiple sections
 type SectionsResponse struct {
-	Sections []db.Section `json:"sections"`
+	Sections []db.Section    `json:"sections"`
+	Totals   []db.PriceTotal `json:"totals"` // Item prices summed per currency
+}
+
+// BatchDeleteItemsRequest names the items to delete, at most MaxBatchItems
+type BatchDeleteItemsRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// BatchDeleteItemsResponse counts the deleted items and lists the IDs that had none
+type BatchDeleteItemsResponse struct {
+	Deleted  int     `json:"deleted"`
+	NotFound []int64 `json:"not_found"`
+}
+
+// BatchCompleteItemsRequest sets the completed flag of at most MaxBatchItems items
+type BatchCompleteItemsRequest struct {
+	IDs       []int64 `json:"ids"`
+	Completed *bool   `json:"completed"`
+}
+
+// BatchCompleteItemsResponse holds the items that changed, the count of those already in the requested
+// state and the IDs without an item
+type BatchCompleteItemsResponse struct {
+	Items     []db.Item `json:"items"`
+	Unchanged int       `json:"unchanged"`
+	NotFound  []int64   `json:"not_found"`
+}
+
+// ItemResponse is a written item with the warnings about the values it was given
+type ItemResponse struct {
+	db.Item
+	Warnings []ValidationWarning `json:"warnings,omitempty"`
+}
+
+// ValidationWarning flags a value that was accepted but is likely a mistake, such as a due date in the past
+type ValidationWarning struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// DueItemsResponse holds the items due before a date, grouped by list
+type DueItemsResponse struct {
+	Before string       `json:"before"`
+	Lists  []db.DueList `json:"lists"`
 }
 
 // ItemsResponse wraps multiple items
 type ItemsResponse struct {
-	Items []db.Item `json:"items"`
+	Items      []db.Item `json:"items"`
+	Total      int       `json:"total"`                 // Items matching the filters, on every page
+	NextOffset *int      `json:"next_offset,omitempty"` // Offset of the next page, left out on the last one
+}
+
+// ItemEventsResponse is a page of item events, newest first
+type ItemEventsResponse struct {
+	Events     []db.ItemEvent `json:"events"`
+	Total      int            `json:"total"`
+	NextOffset *int           `json:"next_offset,omitempty"` // Offset of the next page, left out on the last one
+}
+
+// TrashResponse is a page of the items in the trash of a list, most recently deleted first
+type TrashResponse struct {
+	Items         []db.TrashedItem `json:"items"`
+	Total         int              `json:"total"`
+	NextOffset    *int             `json:"next_offset,omitempty"` // Offset of the next page, left out on the last one
+	RetentionDays int              `json:"retention_days"`        // Days items stay in the trash before they are purged
 }
 
 // BatchCreateRequest represents the request body for batch creation
@@ -38,6 +100,51 @@ type BatchCreateRequest struct {
 	// Option 3: Add items to existing section
 	SectionID int64            `json:"section_id,omitempty"`
 	Items     []BatchItemInput `json:"items,omitempty"`
+
+	// Option 4: Apply ordered operations in one transaction
+	Operations []BatchOperation `json:"operations,omitempty"`
+}
+
+// BatchOperation is one step of an operations batch
+// Body is the request body of the matching endpoint, plus "id" for operations on an existing section or item.
+// A value {"$ref": "<ref>.<field>"} in Body is replaced by a field of the result of an earlier operation
+type BatchOperation struct {
+	Op   string          `json:"op"`
+	Ref  string          `json:"ref,omitempty"`
+	Body json.RawMessage `json:"body"`
+}
+
+// BatchOperationResult is the outcome of one operation, in request order
+type BatchOperationResult struct {
+	Op     string `json:"op"`
+	Ref    string `json:"ref,omitempty"`
+	Result any    `json:"result"`
+}
+
+// BatchOperationError is the error of an operations batch, naming the operation that failed
+// Nothing of the batch is applied
+type BatchOperationError struct {
+	ErrorResponse
+	Operation int    `json:"operation"`
+	Op        string `json:"op"`
+}
+
+// OrderRequest is the new order of the items of a section or the sections of a list
+type OrderRequest struct {
+	ItemIDs    []int64 `json:"item_ids,omitempty"`
+	SectionIDs []int64 `json:"section_ids,omitempty"`
+}
+
+// BarcodeConflictError rejects a new item whose barcode an open item of the list already has, which it carries
+type BarcodeConflictError struct {
+	ErrorResponse
+	Item db.Item `json:"item"`
+}
+
+// OrderError rejects an order that names IDs of another section or list, or of nothing
+type OrderError struct {
+	ErrorResponse
+	InvalidIDs []int64 `json:"invalid_ids"`
 }
 
 // BatchListInput represents a new list with nested sections/items
@@ -65,6 +172,9 @@ type BatchCreateResponse struct {
 	List     *db.List     `json:"list,omitempty"`
 	Sections []db.Section `json:"sections,omitempty"`
 	Items    []db.Item    `json:"items,omitempty"`
+
+	// Results of an operations batch
+	Results []BatchOperationResult `json:"results,omitempty"`
 }
 
 // CreateListRequest for creating a new list
@@ -75,8 +185,9 @@ type CreateListRequest struct {
 
 // UpdateListRequest for updating a list
 type UpdateListRequest struct {
-	Name string `json:"name,omitempty"`
-	Icon string `json:"icon,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Icon     string `json:"icon,omitempty"`
+	Archived *bool  `json:"archived,omitempty"` // Omitted keeps the flag
 }
 
 // CreateSectionRequest for creating a new section
@@ -92,19 +203,38 @@ type UpdateSectionRequest struct {
 
 // CreateItemRequest for creating a new item
 type CreateItemRequest struct {
-	SectionID   int64  `json:"section_id"`
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
-	Quantity    int    `json:"quantity,omitempty"`
+	SectionID   int64      `json:"section_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Quantity    int        `json:"quantity,omitempty"`
+	Price       PriceInput `json:"price,omitempty"`    // Price of one unit
+	Currency    *string    `json:"currency,omitempty"` // Three-letter code such as EUR
+	DueDate     string     `json:"due_date,omitempty"` // YYYY-MM-DD, a past date is accepted with a warning
+	Barcode     string     `json:"barcode,omitempty"`  // EAN-8, UPC-A, EAN-13 or GTIN-14 digits with their check digit
+}
+
+// PriceInput is the price of an item in a request, a JSON number or a decimal string such as "3,49"
+// It keeps the raw value so that null, which clears the price, differs from leaving it out
+type PriceInput []byte
+
+func (p *PriceInput) UnmarshalJSON(data []byte) error {
+	*p = append((*p)[:0], data...)
+	return nil
 }
 
 // UpdateItemRequest for updating an item
+// Fields left out keep their value and fields sent are set, so "" clears a description; name may not be empty.
+// A price of null clears the price, a currency alone changes the currency of the current price
 type UpdateItemRequest struct {
-	Name        string `json:"name,omitempty"`
-	Description string `json:"description,omitempty"`
-	Quantity    *int   `json:"quantity,omitempty"`
-	Completed   *bool  `json:"completed,omitempty"`
-	Uncertain   *bool  `json:"uncertain,omitempty"`
+	Name        *string    `json:"name,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	Quantity    *int       `json:"quantity,omitempty"`
+	Completed   *bool      `json:"completed,omitempty"`
+	Uncertain   *bool      `json:"uncertain,omitempty"`
+	Price       PriceInput `json:"price,omitempty"`
+	Currency    *string    `json:"currency,omitempty"`
+	DueDate     *string    `json:"due_date,omitempty"` // Empty clears the due date
+	Barcode     *string    `json:"barcode,omitempty"`  // Empty clears the barcode
 }
 
 // MoveItemRequest for moving item to another section
@@ -112,6 +242,22 @@ type MoveItemRequest struct {
 	SectionID int64 `json:"section_id"`
 }
 
+// MoveItemToListRequest moves an item to another list, into the section named section_name
+// or without one the list's first section
+type MoveItemToListRequest struct {
+	ListID      int64  `json:"list_id"`
+	SectionName string `json:"section_name,omitempty"`
+}
+
+// ItemMovedResponse is a moved item with the section and list it left, also sent as item_moved
+type ItemMovedResponse struct {
+	db.Item
+	ListID         int64       `json:"list_id"`
+	FromSectionID  int64       `json:"from_section_id"`
+	FromListID     int64       `json:"from_list_id"`
+	CreatedSection *db.Section `json:"created_section,omitempty"` // Section created in the target list for the item
+}
+
 // iconAliases maps string aliases to emoji icons
 var iconAliases = map[string]string{
 	"cart":      "🛒",
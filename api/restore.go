@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RestoreResponse reports what the restored database contains
+type RestoreResponse struct {
+	*handlers.RestoreResult
+}
+
+// RestoreBackup replaces the live database with an uploaded SQLite file
+func RestoreBackup(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "file"})
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeValidation, "validation_error.unreadable_upload")
+	}
+	defer src.Close()
+
+	// Stage the upload next to the database so the final move is an atomic rename
+	tmp, err := os.CreateTemp(filepath.Dir(db.Path()), ".restore-*.db")
+	if err != nil {
+		return apiError(c, handlers.ErrCodeRestoreFailed, "restore_failed")
+	}
+	// After a successful restore the file has been moved and this is a no-op
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return apiError(c, handlers.ErrCodeRestoreFailed, "restore_failed")
+	}
+
+	result, err := handlers.RestoreDatabase(tmp.Name())
+	var busy *handlers.OperationBusyError
+	if errors.As(err, &busy) {
+		return handlers.OperationConflict(c, busy)
+	}
+	if errors.Is(err, handlers.ErrInvalidBackup) {
+		detail := strings.TrimPrefix(err.Error(), handlers.ErrInvalidBackup.Error()+": ")
+		return apiErrorF(c, handlers.ErrCodeInvalidBackup, "invalid_backup", map[string]any{"detail": detail})
+	}
+	if err != nil {
+		return apiError(c, handlers.ErrCodeRestoreFailed, "restore_failed")
+	}
+
+	auditAdmin(c, "restore", file.Filename)
+
+	return c.JSON(RestoreResponse{result})
+}
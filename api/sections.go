@@ -2,38 +2,40 @@ package api
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"shopping-list/db"
 	"shopping-list/handlers"
+	"shopping-list/i18n"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 const (
 	MaxSectionNameLength = 100
+
+	// MaxSectionItemsPage caps the limit of GET /sections/:id/items, which returns every item without one
+	MaxSectionItemsPage = 1000
 )
 
 // GetSection returns a single section by ID
 func GetSection(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid section ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "section_id"})
+	}
+	if !requireSectionAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	section, err := db.GetSectionByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	return c.JSON(section)
@@ -43,64 +45,46 @@ func GetSection(c *fiber.Ctx) error {
 func CreateSection(c *fiber.Ctx) error {
 	var req CreateSectionRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "name"})
 	}
 
 	if req.ListID == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "list_id is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "list_id"})
 	}
 
-	if len(req.Name) > MaxSectionNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
+	if tooLong(req.Name, MaxSectionNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "name", "max": MaxSectionNameLength,
 		})
 	}
 
 	if req.Name == "[HISTORY]" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "This name is reserved for system use",
-		})
+		return apiError(c, handlers.ErrCodeValidation, "validation_error.reserved_name")
+	}
+
+	if !requireListAccess(c, req.ListID) {
+		return listForbidden(c)
 	}
 
 	// Check if list exists
 	_, err := db.GetListByID(req.ListID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "List not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch list",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	section, err := db.CreateSectionForList(req.ListID, req.Name)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "create_failed",
-			Message: "Failed to create section",
-		})
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
 	}
 
-	handlers.BroadcastUpdate("section_created", section)
+	handlers.BroadcastFrom(c, "section_created", section)
 	return c.Status(fiber.StatusCreated).JSON(section)
 }
 
@@ -108,65 +92,46 @@ func CreateSection(c *fiber.Ctx) error {
 func UpdateSection(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid section ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "section_id"})
+	}
+	if !requireSectionAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	var req UpdateSectionRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_json",
-			Message: "Failed to parse request body",
-		})
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
 	}
 
 	if req.Name == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name is required",
-		})
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "name"})
 	}
 
-	if len(req.Name) > MaxSectionNameLength {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "Name exceeds maximum length of 100 characters",
+	if tooLong(req.Name, MaxSectionNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "name", "max": MaxSectionNameLength,
 		})
 	}
 
 	if req.Name == "[HISTORY]" {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "validation_error",
-			Message: "This name is reserved for system use",
-		})
+		return apiError(c, handlers.ErrCodeValidation, "validation_error.reserved_name")
 	}
 
 	// Check if section exists
 	_, err = db.GetSectionByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	section, err := db.UpdateSection(int64(id), req.Name)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "update_failed",
-			Message: "Failed to update section",
-		})
+		return apiError(c, handlers.ErrCodeUpdateFailed, "update_failed")
 	}
 
-	handlers.BroadcastUpdate("section_updated", section)
+	handlers.BroadcastFrom(c, "section_updated", section)
 	return c.JSON(section)
 }
 
@@ -174,35 +139,26 @@ func UpdateSection(c *fiber.Ctx) error {
 func DeleteSection(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid section ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "section_id"})
+	}
+	if !requireSectionAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if section exists
 	_, err = db.GetSectionByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.DeleteSection(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "delete_failed",
-			Message: "Failed to delete section",
-		})
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
 	}
 
-	handlers.BroadcastUpdate("section_deleted", map[string]int64{"id": int64(id)})
+	handlers.BroadcastFrom(c, "section_deleted", map[string]int64{"id": int64(id)})
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
@@ -210,71 +166,158 @@ func DeleteSection(c *fiber.Ctx) error {
 func GetSectionItems(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid section ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "section_id"})
+	}
+	if !requireSectionAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+	filter, err := sectionItemsFilter(c)
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
 	}
 
-	// Check if section exists
-	_, err = db.GetSectionByID(int64(id))
+	// The version query also checks that the section exists
+	version, err := db.SectionVersion(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	if handlers.NotModified(c, version) {
+		return handlers.NotModifiedResponse(c)
 	}
 
-	items, err := db.GetItemsBySection(int64(id))
+	items, total, err := db.GetItemsBySectionFiltered(int64(id), filter)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch items",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
-	return c.JSON(ItemsResponse{Items: items})
+	resp := ItemsResponse{Items: items, Total: total}
+	if next := filter.Offset + len(items); filter.Limit > 0 && next < total {
+		resp.NextOffset = &next
+	}
+	return c.JSON(resp)
+}
+
+// sectionItemsFilter reads the completed, q, sort, limit and offset of GET /sections/:id/items
+// The error describes an invalid value
+func sectionItemsFilter(c *fiber.Ctx) (db.ItemFilter, error) {
+	filter := db.ItemFilter{Query: strings.TrimSpace(c.Query("q")), Sort: c.Query("sort", db.ItemSortManual)}
+	if value := c.Query("completed"); value != "" {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("completed must be true or false")
+		}
+		filter.Completed = &completed
+	}
+	switch filter.Sort {
+	case db.ItemSortManual, db.ItemSortName, db.ItemSortCreated:
+	default:
+		return filter, errors.New("sort must be manual, name or created")
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxSectionItemsPage {
+			return filter, fmt.Errorf("limit must be between 1 and %d", MaxSectionItemsPage)
+		}
+		filter.Limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, errors.New("offset must not be negative")
+		}
+		filter.Offset = offset
+	}
+	return filter, nil
+}
+
+// orderFailed rejects an order with the IDs that do not belong to the section or list, key names the message
+func orderFailed(c *fiber.Ctx, key, field string, ids []int64) error {
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = strconv.FormatInt(id, 10)
+	}
+	message := i18n.GetF(handlers.RequestLang(c), "api_errors.validation_error."+key, map[string]any{
+		"field": field, "ids": strings.Join(list, ", "),
+	})
+	return c.Status(fiber.StatusBadRequest).JSON(OrderError{
+		ErrorResponse: handlers.NewErrorResponse(c, handlers.ErrCodeValidation, message),
+		InvalidIDs:    ids,
+	})
+}
+
+// SetSectionItemsOrder puts the items of a section in the order of item_ids in one call, for drag and drop
+// Items left out follow in their previous order, and the items are returned like GET /sections/:id/items
+func SetSectionItemsOrder(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "section_id"})
+	}
+	if !requireSectionAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	var req OrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+	if len(req.ItemIDs) == 0 {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "item_ids"})
+	}
+
+	if _, err := db.GetSectionByID(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	foreign, err := db.SetItemsOrder(int64(id), req.ItemIDs)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
+	}
+	if len(foreign) > 0 {
+		return orderFailed(c, "not_in_section", "item_ids", foreign)
+	}
+
+	items, err := db.GetItemsBySection(int64(id))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	ids := make([]int64, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	handlers.BroadcastFrom(c, "items_reordered", map[string]any{"section_id": id, "item_ids": ids})
+	return c.JSON(ItemsResponse{Items: items, Total: len(items)})
 }
 
 // MoveSectionUp moves a section up in sort order
 func MoveSectionUp(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid section ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "section_id"})
+	}
+	if !requireSectionAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if section exists
 	_, err = db.GetSectionByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.MoveSectionUp(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move section",
-		})
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
 	}
 
-	handlers.BroadcastUpdate("sections_reordered", nil)
+	handlers.BroadcastFrom(c, "sections_reordered", nil)
 
 	section, _ := db.GetSectionByID(int64(id))
 	return c.JSON(section)
@@ -284,35 +327,26 @@ func MoveSectionUp(c *fiber.Ctx) error {
 func MoveSectionDown(c *fiber.Ctx) error {
 	id, err := c.ParamsInt("id")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
-			Error:   "invalid_id",
-			Message: "Invalid section ID",
-		})
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "section_id"})
+	}
+	if !requireSectionAccess(c, int64(id)) {
+		return listForbidden(c)
 	}
 
 	// Check if section exists
 	_, err = db.GetSectionByID(int64(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
-				Error:   "not_found",
-				Message: "Section not found",
-			})
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.section")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "db_error",
-			Message: "Failed to fetch section",
-		})
+		return apiError(c, handlers.ErrCodeDB, "db_error")
 	}
 
 	if err := db.MoveSectionDown(int64(id)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "move_failed",
-			Message: "Failed to move section",
-		})
+		return apiError(c, handlers.ErrCodeMoveFailed, "move_failed")
 	}
 
-	handlers.BroadcastUpdate("sections_reordered", nil)
+	handlers.BroadcastFrom(c, "sections_reordered", nil)
 
 	section, _ := db.GetSectionByID(int64(id))
 	return c.JSON(section)
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+)
+
+// sectionItemIDs returns the IDs of the items of a section in their order, checking it is numbered 0..n-1
+func sectionItemIDs(t *testing.T, sectionID int64) []int64 {
+	t.Helper()
+	items, err := db.GetItemsBySection(sectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int64{}
+	for i, item := range items {
+		if item.SortOrder != i {
+			t.Errorf("%s has sort order %d at position %d", item.Name, item.SortOrder, i)
+		}
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestSetSectionItemsOrder(t *testing.T) {
+	app := setupTestAPI(t)
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	list, section, a := createTestItem(t, "Groceries", "A")
+	ids := []int64{a.ID}
+	for _, name := range []string{"B", "C", "D"} {
+		item, err := db.CreateItem(section.ID, name, "", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, item.ID)
+	}
+	b, c, d := ids[1], ids[2], ids[3]
+	other, err := db.CreateSectionForList(list.ID, "Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := db.CreateItem(other.ID, "Foreign", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialEvents(t)
+	path := fmt.Sprintf("/api/v1/sections/%d/items/order", section.ID)
+
+	// C and A go first, a repeated C counts once, B and D follow in their previous order
+	status, body := apiRequest(t, app, http.MethodPut, path, testMasterToken, OrderRequest{ItemIDs: []int64{c, a.ID, c}})
+	var resp ItemsResponse
+	if status != http.StatusOK || json.Unmarshal(body, &resp) != nil {
+		t.Fatalf("order: status %d, body %s", status, body)
+	}
+	want := []int64{c, a.ID, b, d}
+	got := []int64{}
+	for _, item := range resp.Items {
+		got = append(got, item.ID)
+	}
+	if !reflect.DeepEqual(got, want) || resp.Total != 4 {
+		t.Errorf("returned items %v (total %d), want %v", got, resp.Total, want)
+	}
+	if stored := sectionItemIDs(t, section.ID); !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored order = %v, want %v", stored, want)
+	}
+
+	event := readEvent(t, conn)
+	var reordered struct {
+		SectionID int64   `json:"section_id"`
+		ItemIDs   []int64 `json:"item_ids"`
+	}
+	json.Unmarshal(event.Data, &reordered)
+	if event.Type != "items_reordered" || reordered.SectionID != section.ID || !reflect.DeepEqual(reordered.ItemIDs, want) {
+		t.Errorf("event = %s %s, want items_reordered with %v", event.Type, event.Data, want)
+	}
+
+	// IDs of another section or of no item are listed and nothing changes
+	status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, OrderRequest{ItemIDs: []int64{d, foreign.ID, 9999}})
+	var orderErr OrderError
+	json.Unmarshal(body, &orderErr)
+	wantMessage := fmt.Sprintf("item_ids contains IDs of items not in this section: %d, 9999", foreign.ID)
+	if status != http.StatusBadRequest || orderErr.Error != handlers.ErrCodeValidation || orderErr.Message != wantMessage ||
+		!reflect.DeepEqual(orderErr.InvalidIDs, []int64{foreign.ID, 9999}) {
+		t.Errorf("foreign IDs: status %d, body %s, want 400 listing %d and 9999", status, body, foreign.ID)
+	}
+	if stored := sectionItemIDs(t, section.ID); !reflect.DeepEqual(stored, want) {
+		t.Errorf("order after the refused request = %v, want %v", stored, want)
+	}
+
+	// A trashed item cannot be ordered either
+	if status, _ := apiRequest(t, app, http.MethodDelete, fmt.Sprintf("/api/v1/items/%d", b), testMasterToken, nil); status != http.StatusNoContent {
+		t.Fatalf("delete: status %d", status)
+	}
+	readEvent(t, conn)
+	status, body = apiRequest(t, app, http.MethodPut, path, testMasterToken, OrderRequest{ItemIDs: []int64{b}})
+	if json.Unmarshal(body, &orderErr); status != http.StatusBadRequest || !reflect.DeepEqual(orderErr.InvalidIDs, []int64{b}) {
+		t.Errorf("trashed item: status %d, body %s, want 400 listing it", status, body)
+	}
+
+	token := createListToken(t, app, createOtherList(t), "write")
+	for _, tc := range []struct {
+		name, path, token string
+		body              any
+		status            int
+		code              string
+	}{
+		{"no ids", path, testMasterToken, OrderRequest{}, http.StatusBadRequest, handlers.ErrCodeValidation},
+		{"ids that are not numbers", path, testMasterToken, map[string]any{"item_ids": "1,2"}, http.StatusBadRequest, handlers.ErrCodeInvalidJSON},
+		{"unknown section", "/api/v1/sections/9999/items/order", testMasterToken, OrderRequest{ItemIDs: []int64{1}}, http.StatusNotFound, handlers.ErrCodeNotFound},
+		{"token of another list", path, token.Token, OrderRequest{ItemIDs: []int64{a.ID}}, http.StatusForbidden, handlers.ErrCodeListForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, body := apiRequest(t, app, http.MethodPut, tc.path, tc.token, tc.body); status != tc.status || errorCode(t, body) != tc.code {
+				t.Errorf("status %d, body %s, want %d %s", status, body, tc.status, tc.code)
+			}
+		})
+	}
+	noEvent(t, conn)
+}
+
+// createOtherList creates an empty list for tokens that must not reach the lists of a test
+func createOtherList(t *testing.T) int64 {
+	t.Helper()
+	list, err := db.CreateList("Elsewhere", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list.ID
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"shopping-list/handlers"
+	"shopping-list/settings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SettingsResponse wraps the server-side settings in their stored form, secrets masked
+type SettingsResponse struct {
+	Settings map[string]string `json:"settings"`
+}
+
+// GetSettings returns all server-side settings
+func GetSettings(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+	return c.JSON(SettingsResponse{Settings: settings.Values()})
+}
+
+// UpdateSettings changes one or more server-side settings
+func UpdateSettings(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req map[string]interface{}
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	if err := settings.Update(req); err != nil {
+		var invalid *settings.ValidationError
+		if !errors.As(err, &invalid) {
+			return err
+		}
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{
+			"detail": invalid.Error(),
+		})
+	}
+
+	return c.JSON(SettingsResponse{Settings: settings.Values()})
+}
+
+// CheckConnectivity runs an outbound diagnostic request and reports timings or the failing stage
+func CheckConnectivity(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	result, err := handlers.CheckConnectivity(c.Query("target", "github"))
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{
+			"detail": err.Error(),
+		})
+	}
+
+	return c.JSON(result)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"database/sql"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SharesResponse wraps multiple shares
+type SharesResponse struct {
+	Shares []db.Share `json:"shares"`
+}
+
+// CreateShareRequest for creating a public share link
+type CreateShareRequest struct {
+	ListID    int64      `json:"list_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateShareResponse includes the share token, which is only shown once
+type CreateShareResponse struct {
+	db.Share
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// GetShares returns all active shares with their hit counts
+func GetShares(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	// Include hits that have not been flushed yet
+	handlers.FlushShareHits()
+
+	shares, err := db.GetActiveShares()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	if shares == nil {
+		shares = []db.Share{}
+	}
+
+	return c.JSON(SharesResponse{Shares: shares})
+}
+
+// CreateShare creates a public read-only share link for a list
+func CreateShare(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	var req CreateShareRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	if req.ListID == 0 {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "list_id"})
+	}
+
+	var expiresAt int64
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.future", map[string]any{"field": "expires_at"})
+		}
+		expiresAt = req.ExpiresAt.Unix()
+	}
+
+	// Check if list exists
+	_, err := db.GetListByID(req.ListID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	token, err := generateTokenSecret()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
+	}
+
+	share, err := db.CreateShare(req.ListID, token, expiresAt)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(CreateShareResponse{
+		Share: *share,
+		Token: token,
+		URL:   c.BaseURL() + "/share/" + token,
+	})
+}
+
+// RevokeShare revokes a share link
+func RevokeShare(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "share_id"})
+	}
+
+	if err := db.RevokeShare(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.share")
+		}
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// importBody builds a multipart import of a JSON export with one list of n items
+func importBody(t *testing.T, listName string, n int) (*bytes.Buffer, string) {
+	t.Helper()
+	items := make([]handlers.ExportItem, n)
+	for i := range items {
+		items[i] = handlers.ExportItem{Name: fmt.Sprintf("Item %d", i), Quantity: 1}
+	}
+	export, err := json.Marshal(handlers.ExportData{
+		Version: handlers.ExportVersion,
+		App:     "koffan",
+		Data: handlers.ExportBody{Lists: []handlers.ExportList{{
+			Name:     listName,
+			Sections: []handlers.ExportSection{{Name: "Imported", Items: items}},
+		}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "export.json")
+	part.Write(export)
+	w.Close()
+	return &body, w.FormDataContentType()
+}
+
+func TestParallelTogglesDuringImport(t *testing.T) {
+	app := setupTestAPI(t)
+	app.Post("/import", handlers.ImportData)
+
+	const (
+		togglers       = 8
+		togglesEach    = 40
+		imports        = 3
+		itemsPerImport = 1500
+	)
+
+	// Each client toggles its own item, so every toggle changes it and is recorded
+	_, _, first := createTestItem(t, "Kitchen", "Item 0")
+	itemIDs := []int64{first.ID}
+	for i := 1; i < togglers; i++ {
+		item, err := db.CreateItem(first.SectionID, fmt.Sprintf("Item %d", i), "", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	var wg sync.WaitGroup
+	failures := make(chan string, togglers*togglesEach+imports)
+
+	// Like the two phones: toggles from several clients while imports write large transactions.
+	// Imports exclude each other through the operation lock, so they run one after the other
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < imports; i++ {
+			body, contentType := importBody(t, fmt.Sprintf("Import %d", i), itemsPerImport)
+			req := httptest.NewRequest("POST", "/import", body)
+			req.Header.Set("Content-Type", contentType)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				failures <- fmt.Sprintf("import %d: %v", i, err)
+				continue
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != fiber.StatusOK {
+				failures <- fmt.Sprintf("import %d: %d %s", i, resp.StatusCode, data)
+			}
+		}
+	}()
+	for g := 0; g < togglers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < togglesEach; i++ {
+				id := itemIDs[g]
+				status, body := apiRequest(t, app, "POST", fmt.Sprintf("/api/v1/items/%d/toggle", id), testMasterToken, nil)
+				if status != fiber.StatusOK {
+					failures <- fmt.Sprintf("toggle %d: %d %s", id, status, body)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(failures)
+
+	for f := range failures {
+		t.Error(f)
+	}
+
+	// Every toggle and every imported row was written
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != imports+1 {
+		t.Errorf("%d lists, want %d", len(lists), imports+1)
+	}
+	var items int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM items").Scan(&items); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(itemIDs) + imports*itemsPerImport; items != want {
+		t.Errorf("%d items, want %d", items, want)
+	}
+	var toggles int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM item_events WHERE action = ?", db.ItemEventToggle).Scan(&toggles); err != nil {
+		t.Fatal(err)
+	}
+	if toggles != togglers*togglesEach {
+		t.Errorf("%d toggle events recorded, want %d", toggles, togglers*togglesEach)
+	}
+
+	stats, err := db.GetConnStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.MaxWriteConnections != 1 {
+		t.Errorf("write handle allows %d connections, want 1", stats.MaxWriteConnections)
+	}
+}
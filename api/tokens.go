@@ -0,0 +1,271 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	MaxTokenNameLength = 100
+
+	// Defaults, overridable via API_TOKEN_ROTATION_GRACE_MINUTES and API_TOKEN_STALE_DAYS
+	DefaultRotationGraceMinutes = 60
+	DefaultTokenStaleDays       = 30
+
+	// MaxRotationGraceMinutes bounds how long a rotated secret stays valid, 7 days
+	MaxRotationGraceMinutes = 7 * 24 * 60
+)
+
+// TokenInfo is a token as shown in list responses, with computed status
+type TokenInfo struct {
+	db.APIToken
+	Expired bool `json:"expired"`
+	Stale   bool `json:"stale"`
+}
+
+// TokensResponse wraps multiple API tokens
+type TokensResponse struct {
+	Tokens []TokenInfo `json:"tokens"`
+}
+
+// CreateTokenRequest for creating a list-scoped token
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateTokenResponse includes the plain secret, which is only shown once
+type CreateTokenResponse struct {
+	db.APIToken
+	Token string `json:"token"`
+}
+
+// RotateTokenRequest for rotating a token secret
+type RotateTokenRequest struct {
+	GraceMinutes *int `json:"grace_minutes,omitempty"`
+}
+
+// RotateTokenResponse includes the new secret and until when the old one stays valid
+type RotateTokenResponse struct {
+	db.APIToken
+	Token             string `json:"token"`
+	PreviousExpiresAt int64  `json:"previous_expires_at"`
+	GraceMinutes      int    `json:"grace_minutes"`
+}
+
+func getEnvInt(key string, defaultVal int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
+
+// tokenInfos annotates tokens with expiry and staleness
+// A token is stale if it was never used or not used within API_TOKEN_STALE_DAYS
+func tokenInfos(tokens []db.APIToken) []TokenInfo {
+	staleBefore := time.Now().AddDate(0, 0, -getEnvInt("API_TOKEN_STALE_DAYS", DefaultTokenStaleDays)).Unix()
+	infos := make([]TokenInfo, 0, len(tokens))
+	for i := range tokens {
+		t := tokens[i]
+		infos = append(infos, TokenInfo{
+			APIToken: t,
+			Expired:  t.IsExpired(),
+			Stale:    t.LastUsedAt < staleBefore,
+		})
+	}
+	return infos
+}
+
+// generateTokenSecret returns a random hex-encoded token secret
+func generateTokenSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetListTokens returns all tokens bound to a list
+func GetListTokens(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+
+	tokens, err := db.GetAPITokensByList(int64(id))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	return c.JSON(TokensResponse{Tokens: tokenInfos(tokens)})
+}
+
+// CreateListToken creates a new token bound to a list
+func CreateListToken(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+
+	var req CreateTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+	}
+
+	if req.Name == "" {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.required", map[string]any{"field": "name"})
+	}
+
+	if tooLong(req.Name, MaxTokenNameLength) {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.too_long", map[string]any{
+			"field": "name", "max": MaxTokenNameLength,
+		})
+	}
+
+	if req.Scope != ScopeRead && req.Scope != ScopeWrite {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.one_of", map[string]any{
+			"field": "scope", "valid": "read, write",
+		})
+	}
+
+	var expiresAt int64
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.future", map[string]any{"field": "expires_at"})
+		}
+		expiresAt = req.ExpiresAt.Unix()
+	}
+
+	// Check if list exists
+	_, err = db.GetListByID(int64(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	secret, err := generateTokenSecret()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
+	}
+
+	token, err := db.CreateAPIToken(req.Name, secret, req.Scope, int64(id), expiresAt)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeCreateFailed, "create_failed")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(CreateTokenResponse{
+		APIToken: *token,
+		Token:    secret,
+	})
+}
+
+// DeleteListToken revokes a token bound to a list
+func DeleteListToken(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+
+	tokenID, err := c.ParamsInt("tokenId")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "token_id"})
+	}
+
+	if err := db.DeleteAPIToken(int64(tokenID), int64(id)); err != nil {
+		return apiError(c, handlers.ErrCodeNotFound, "not_found.token")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetAllTokens returns every database-backed token with expiry and staleness
+func GetAllTokens(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	tokens, err := db.GetAllAPITokens()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	return c.JSON(TokensResponse{Tokens: tokenInfos(tokens)})
+}
+
+// RotateToken issues a new secret for a token, keeping the old one valid for a grace period
+func RotateToken(c *fiber.Ctx) error {
+	if !requireAdmin(c) {
+		return adminRequired(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "token_id"})
+	}
+
+	var req RotateTokenRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return apiError(c, handlers.ErrCodeInvalidJSON, "invalid_json")
+		}
+	}
+
+	grace := min(getEnvInt("API_TOKEN_ROTATION_GRACE_MINUTES", DefaultRotationGraceMinutes), MaxRotationGraceMinutes)
+	if req.GraceMinutes != nil {
+		grace = *req.GraceMinutes
+	}
+	if grace < 0 || grace > MaxRotationGraceMinutes {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{
+			"detail": "grace_minutes must be between 0 and " + strconv.Itoa(MaxRotationGraceMinutes),
+		})
+	}
+
+	secret, err := generateTokenSecret()
+	if err != nil {
+		return apiError(c, handlers.ErrCodeRotateFailed, "rotate_failed")
+	}
+
+	previousExpiresAt := time.Now().Add(time.Duration(grace) * time.Minute).Unix()
+	if err := db.RotateAPIToken(int64(id), secret, previousExpiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.token")
+		}
+		return apiError(c, handlers.ErrCodeRotateFailed, "rotate_failed")
+	}
+
+	token, err := db.GetAPITokenByID(int64(id))
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	return c.JSON(RotateTokenResponse{
+		APIToken:          *token,
+		Token:             secret,
+		PreviousExpiresAt: previousExpiresAt,
+		GraceMinutes:      grace,
+	})
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestExpiredTokenRejected(t *testing.T) {
+	app := setupTestAPI(t)
+	list, _, _ := createTestItem(t, "Own", "Milk")
+	listPath := fmt.Sprintf("/api/v1/lists/%d", list.ID)
+
+	if _, err := db.CreateAPIToken("expired", "expired-secret", ScopeWrite, list.ID, time.Now().Add(-time.Minute).Unix()); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if _, err := db.CreateAPIToken("valid", "valid-secret", ScopeWrite, list.ID, time.Now().Add(time.Hour).Unix()); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	status, body := apiRequest(t, app, "GET", listPath, "expired-secret", nil)
+	if status != fiber.StatusUnauthorized || errorCode(t, body) != handlers.ErrCodeTokenExpired {
+		t.Errorf("expired token: got %d %s, want 401 %s", status, body, handlers.ErrCodeTokenExpired)
+	}
+	if status, body := apiRequest(t, app, "GET", listPath, "valid-secret", nil); status != fiber.StatusOK {
+		t.Errorf("token before its expiry: got %d %s, want 200", status, body)
+	}
+
+	// An expiry in the past cannot be set through the API
+	past := time.Now().Add(-time.Hour)
+	status, body = apiRequest(t, app, "POST", fmt.Sprintf("/api/v1/lists/%d/tokens", list.ID), testMasterToken,
+		CreateTokenRequest{Name: "past", Scope: ScopeRead, ExpiresAt: &past})
+	if status != fiber.StatusBadRequest {
+		t.Errorf("create with past expiry: got %d %s, want 400", status, body)
+	}
+}
+
+// rotateToken rotates a token through the API with the given grace period
+func rotateToken(t *testing.T, app *fiber.App, id int64, grace int) RotateTokenResponse {
+	t.Helper()
+	status, body := apiRequest(t, app, "POST", fmt.Sprintf("/api/v1/admin/tokens/%d/rotate", id), testMasterToken,
+		RotateTokenRequest{GraceMinutes: &grace})
+	if status != fiber.StatusOK {
+		t.Fatalf("rotate: got %d %s", status, body)
+	}
+	var resp RotateTokenResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode rotation: %v", err)
+	}
+	return resp
+}
+
+func TestRotatedTokenGracePeriod(t *testing.T) {
+	app := setupTestAPI(t)
+	list, _, _ := createTestItem(t, "Own", "Milk")
+	listPath := fmt.Sprintf("/api/v1/lists/%d", list.ID)
+	token := createListToken(t, app, list.ID, ScopeWrite)
+
+	rotated := rotateToken(t, app, token.ID, 30)
+	if rotated.Token == "" || rotated.Token == token.Token {
+		t.Fatalf("rotation returned secret %q, want a new one", rotated.Token)
+	}
+	if rotated.ID != token.ID || rotated.Name != token.Name || rotated.Scope != token.Scope || rotated.ListID != list.ID {
+		t.Errorf("rotation changed the token: %+v, was %+v", rotated.APIToken, token.APIToken)
+	}
+	if want := time.Now().Add(30 * time.Minute).Unix(); rotated.PreviousExpiresAt < want-5 || rotated.PreviousExpiresAt > want+5 {
+		t.Errorf("previous_expires_at = %d, want about %d", rotated.PreviousExpiresAt, want)
+	}
+
+	// Within the grace period both secrets work
+	if status, body := apiRequest(t, app, "GET", listPath, token.Token, nil); status != fiber.StatusOK {
+		t.Errorf("old secret within grace: got %d %s, want 200", status, body)
+	}
+	if status, body := apiRequest(t, app, "GET", listPath, rotated.Token, nil); status != fiber.StatusOK {
+		t.Errorf("new secret: got %d %s, want 200", status, body)
+	}
+
+	// Move the end of the grace period into the past
+	if _, err := db.DB.Exec("UPDATE api_tokens SET previous_expires_at = ? WHERE id = ?", time.Now().Add(-time.Second).Unix(), token.ID); err != nil {
+		t.Fatalf("expire grace period: %v", err)
+	}
+	status, body := apiRequest(t, app, "GET", listPath, token.Token, nil)
+	if status != fiber.StatusUnauthorized || errorCode(t, body) != handlers.ErrCodeInvalidToken {
+		t.Errorf("old secret after grace: got %d %s, want 401 %s", status, body, handlers.ErrCodeInvalidToken)
+	}
+	if status, body := apiRequest(t, app, "GET", listPath, rotated.Token, nil); status != fiber.StatusOK {
+		t.Errorf("new secret after grace: got %d %s, want 200", status, body)
+	}
+}
+
+func TestRotationWithoutGraceRevokesOldSecret(t *testing.T) {
+	app := setupTestAPI(t)
+	list, _, _ := createTestItem(t, "Own", "Milk")
+	token := createListToken(t, app, list.ID, ScopeRead)
+
+	rotated := rotateToken(t, app, token.ID, 0)
+	listPath := fmt.Sprintf("/api/v1/lists/%d", list.ID)
+	if status, _ := apiRequest(t, app, "GET", listPath, token.Token, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("old secret with no grace: got %d, want 401", status)
+	}
+	if status, _ := apiRequest(t, app, "GET", listPath, rotated.Token, nil); status != fiber.StatusOK {
+		t.Errorf("new secret: got %d, want 200", status)
+	}
+
+	// A second rotation ends the first one's old secret as well
+	second := rotateToken(t, app, token.ID, 30)
+	if status, _ := apiRequest(t, app, "GET", listPath, rotated.Token, nil); status != fiber.StatusOK {
+		t.Errorf("first rotated secret within grace: got %d, want 200", status)
+	}
+	if status, _ := apiRequest(t, app, "GET", listPath, token.Token, nil); status != fiber.StatusUnauthorized {
+		t.Errorf("original secret after two rotations: got %d, want 401", status)
+	}
+	if status, _ := apiRequest(t, app, "GET", listPath, second.Token, nil); status != fiber.StatusOK {
+		t.Errorf("second rotated secret: got %d, want 200", status)
+	}
+}
+
+func TestRotationGraceIsBounded(t *testing.T) {
+	app := setupTestAPI(t)
+	list, _, _ := createTestItem(t, "Own", "Milk")
+	token := createListToken(t, app, list.ID, ScopeRead)
+	path := fmt.Sprintf("/api/v1/admin/tokens/%d/rotate", token.ID)
+
+	for _, grace := range []int{-1, MaxRotationGraceMinutes + 1, 1 << 40} {
+		status, body := apiRequest(t, app, "POST", path, testMasterToken, RotateTokenRequest{GraceMinutes: &grace})
+		if status != fiber.StatusBadRequest || errorCode(t, body) != handlers.ErrCodeValidation {
+			t.Errorf("grace %d: got %d %s, want 400 %s", grace, status, body, handlers.ErrCodeValidation)
+		}
+	}
+	// The rejected rotations left the original secret as the only one
+	if status, _ := apiRequest(t, app, "GET", fmt.Sprintf("/api/v1/lists/%d", list.ID), token.Token, nil); status != fiber.StatusOK {
+		t.Errorf("secret after rejected rotations: got %d, want 200", status)
+	}
+
+	rotated := rotateToken(t, app, token.ID, MaxRotationGraceMinutes)
+	if want := time.Now().AddDate(0, 0, 7).Unix(); rotated.PreviousExpiresAt < want-5 || rotated.PreviousExpiresAt > want+5 {
+		t.Errorf("previous_expires_at = %d, want about %d", rotated.PreviousExpiresAt, want)
+	}
+
+	// A configured default above the bound is clamped to it
+	t.Setenv("API_TOKEN_ROTATION_GRACE_MINUTES", "100000")
+	status, body := apiRequest(t, app, "POST", path, testMasterToken, nil)
+	if status != fiber.StatusOK {
+		t.Fatalf("rotate with the default grace: got %d %s", status, body)
+	}
+	var resp RotateTokenResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode rotation: %v", err)
+	}
+	if resp.GraceMinutes != MaxRotationGraceMinutes {
+		t.Errorf("grace_minutes = %d, want %d", resp.GraceMinutes, MaxRotationGraceMinutes)
+	}
+}
+
+func TestTokenLastUsedThrottled(t *testing.T) {
+	app := setupTestAPI(t)
+	list, _, _ := createTestItem(t, "Own", "Milk")
+	token := createListToken(t, app, list.ID, ScopeRead)
+	listPath := fmt.Sprintf("/api/v1/lists/%d", list.ID)
+
+	apiRequest(t, app, "GET", listPath, token.Token, nil)
+	first, err := db.GetAPITokenByID(token.ID)
+	if err != nil || first.LastUsedAt == 0 {
+		t.Fatalf("last_used_at not recorded: %+v, %v", first, err)
+	}
+
+	// A second use within the interval does not write again
+	if _, err := db.DB.Exec("UPDATE api_tokens SET last_used_at = 1 WHERE id = ?", token.ID); err != nil {
+		t.Fatal(err)
+	}
+	apiRequest(t, app, "GET", listPath, token.Token, nil)
+	if second, _ := db.GetAPITokenByID(token.ID); second.LastUsedAt != 1 {
+		t.Errorf("last_used_at written again within %v: %d", lastUsedInterval, second.LastUsedAt)
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetListTrash returns the deleted items of a list that can still be restored, most recently deleted first
+func GetListTrash(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+	limit, offset, err := eventsPage(c)
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeValidation, "validation_error.invalid_value", map[string]any{"detail": err.Error()})
+	}
+
+	if _, err := db.GetListByID(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	items, total, err := db.GetTrash(int64(id), limit, offset)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	resp := TrashResponse{Items: items, Total: total, RetentionDays: handlers.TrashRetentionDays()}
+	if next := offset + len(items); next < total && len(items) == limit {
+		resp.NextOffset = &next
+	}
+	return c.JSON(resp)
+}
+
+// PurgeListTrash deletes the items in the trash of a list for good
+func PurgeListTrash(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "list_id"})
+	}
+	if !requireListAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	if _, err := db.GetListByID(int64(id)); err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.list")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+
+	// Deleted within the current second too
+	purged, err := db.PurgeTrash(int64(id), time.Now().Unix()+1)
+	if err != nil {
+		return apiError(c, handlers.ErrCodeDeleteFailed, "delete_failed")
+	}
+	return c.JSON(fiber.Map{"deleted": purged})
+}
+
+// RestoreItem takes an item out of the trash, clients re-render it as if it was created
+func RestoreItem(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return apiErrorF(c, handlers.ErrCodeInvalidID, "invalid_id", map[string]any{"field": "item_id"})
+	}
+	if !requireItemAccess(c, int64(id)) {
+		return listForbidden(c)
+	}
+
+	item, err := db.RestoreItem(int64(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return apiError(c, handlers.ErrCodeNotFound, "not_found.trashed_item")
+		}
+		return apiError(c, handlers.ErrCodeDB, "db_error")
+	}
+	handlers.RecordItemEvent(c, db.ItemEventRestore, nil, item)
+
+	handlers.BroadcastFrom(c, "item_created", item)
+	return c.JSON(item)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+)
+
+func decodeTrash(t *testing.T, body []byte) TrashResponse {
+	t.Helper()
+	var trash TrashResponse
+	if err := json.Unmarshal(body, &trash); err != nil {
+		t.Fatalf("decode trash %q: %v", body, err)
+	}
+	return trash
+}
+
+func TestTrashEndpoints(t *testing.T) {
+	app := setupTestAPI(t)
+	list, section, item := createTestItem(t, "Groceries", "Milk")
+	itemPath := fmt.Sprintf("/api/v1/items/%d", item.ID)
+	trashPath := fmt.Sprintf("/api/v1/lists/%d/trash", list.ID)
+
+	if status, body := apiRequest(t, app, http.MethodDelete, itemPath, testMasterToken, nil); status != http.StatusNoContent {
+		t.Fatalf("delete: status %d, body %s", status, body)
+	}
+
+	// Hidden from the list, listed in the trash
+	if status, _ := apiRequest(t, app, http.MethodGet, itemPath, testMasterToken, nil); status != http.StatusNotFound {
+		t.Errorf("get deleted item: status %d, want 404", status)
+	}
+	status, body := apiRequest(t, app, http.MethodGet, fmt.Sprintf("/api/v1/sections/%d/items", section.ID), testMasterToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("section items: status %d, body %s", status, body)
+	}
+	var page struct {
+		Items []db.Item `json:"items"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatalf("decode section items %q: %v", body, err)
+	}
+	if len(page.Items) != 0 {
+		t.Errorf("section items = %+v, want none", page.Items)
+	}
+	status, body = apiRequest(t, app, http.MethodGet, trashPath, testMasterToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("trash: status %d, body %s", status, body)
+	}
+	trash := decodeTrash(t, body)
+	if trash.Total != 1 || len(trash.Items) != 1 || trash.Items[0].ID != item.ID || trash.RetentionDays != 30 {
+		t.Errorf("trash = %+v, want Milk with a 30 day retention", trash)
+	}
+
+	// Restored
+	status, body = apiRequest(t, app, http.MethodPost, itemPath+"/restore", testMasterToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("restore: status %d, body %s", status, body)
+	}
+	if status, _ := apiRequest(t, app, http.MethodGet, itemPath, testMasterToken, nil); status != http.StatusOK {
+		t.Errorf("get restored item: status %d, want 200", status)
+	}
+	status, body = apiRequest(t, app, http.MethodPost, itemPath+"/restore", testMasterToken, nil)
+	if status != http.StatusNotFound || errorCode(t, body) != handlers.ErrCodeNotFound {
+		t.Errorf("restore twice: status %d, body %s, want 404", status, body)
+	}
+
+	// Purged
+	if status, body := apiRequest(t, app, http.MethodDelete, itemPath, testMasterToken, nil); status != http.StatusNoContent {
+		t.Fatalf("delete again: status %d, body %s", status, body)
+	}
+	status, body = apiRequest(t, app, http.MethodDelete, trashPath, testMasterToken, nil)
+	if status != http.StatusOK {
+		t.Fatalf("purge: status %d, body %s", status, body)
+	}
+	var purged struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := json.Unmarshal(body, &purged); err != nil || purged.Deleted != 1 {
+		t.Errorf("purge response %s, want 1 deleted", body)
+	}
+	if _, body := apiRequest(t, app, http.MethodGet, trashPath, testMasterToken, nil); decodeTrash(t, body).Total != 0 {
+		t.Errorf("trash after purge = %s, want empty", body)
+	}
+	if status, _ := apiRequest(t, app, http.MethodPost, itemPath+"/restore", testMasterToken, nil); status != http.StatusNotFound {
+		t.Errorf("restore purged item: status %d, want 404", status)
+	}
+}
+
+func TestTrashOfUnknownList(t *testing.T) {
+	app := setupTestAPI(t)
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if status, body := apiRequest(t, app, method, "/api/v1/lists/999/trash", testMasterToken, nil); status != http.StatusNotFound {
+			t.Errorf("%s trash of unknown list: status %d, body %s, want 404", method, status, body)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package api
+
+import "shopping-list/handlers"
+
+// tooLong reports whether a name, description or message is over its length limit
+// The limits count characters, not bytes, so the "max characters" of validation_error.too_long holds in every script
+func tooLong(value string, max int) bool {
+	return handlers.TextLength(value) > max
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+	"strings"
+	"time"
+)
+
+// cliCommand is an admin subcommand working on the database directly, without the server
+type cliCommand struct {
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+// cliCommands are the subcommands of the binary, any other first argument starts the server
+var cliCommands = map[string]cliCommand{
+	"export":  {usage: "export [--format json|yaml|csv|xlsx|markdown|zip] [--out file] [--delimiter ,] [--no-templates] [--no-history] [--exclude-completed] [--include-photos]", run: cliExport},
+	"import":  {usage: "import <file> [--conflict skip|replace|copy|merge] [--conflict-list name=mode] [--copy-suffix copy] [--delimiter ,] [--encoding utf-8|utf-16|windows-1252|iso-8859-1] [--columns json] [--lang code]", run: cliImport},
+	"backup":  {usage: "backup --out file.db", run: cliBackup},
+	"migrate": {usage: "migrate [--status] [--json]", run: cliMigrate},
+}
+
+// isCLICommand reports whether args start with an admin subcommand or a request for help
+func isCLICommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := cliCommands[args[0]]
+	return ok || args[0] == "help" || args[0] == "-h" || args[0] == "--help"
+}
+
+// runCLI runs the admin subcommand in args and returns the exit code
+// The database at DB_PATH is opened without starting the server, logs go to stderr
+func runCLI(args []string) int {
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		cliUsage(os.Stdout)
+		return 0
+	}
+
+	if err := i18n.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize i18n: %v\n", err)
+		return 1
+	}
+	if lang := os.Getenv("DEFAULT_LANG"); lang != "" {
+		i18n.SetDefaultLang(lang)
+	}
+
+	if err := db.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database %s: %v\n", db.Path(), err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := cmd.run(args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func cliUsage(w io.Writer) {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(w, "Usage: %s [command]\n\nWithout a command the server starts. Commands use the database at DB_PATH:\n", name)
+	for _, key := range []string{"export", "import", "backup", "migrate"} {
+		fmt.Fprintf(w, "  %s %s\n", name, cliCommands[key].usage)
+	}
+}
+
+// parseCLIArgs parses flags placed before or after the positional arguments, which are returned
+func parseCLIArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// cliOutput returns the file to write to, stdout for "" and "-"
+func cliOutput(path string, stdout io.Writer) (io.Writer, func() error, error) {
+	if path == "" || path == "-" {
+		return stdout, func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// cliExport writes the same export as GET /export
+func cliExport(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "json", "json, yaml, csv, xlsx, markdown, html or zip")
+	out := fs.String("out", "-", "output file, must not exist, - for stdout")
+	delimiter := fs.String("delimiter", ",", "CSV field separator, a single character or tab")
+	noTemplates := fs.Bool("no-templates", false, "leave out templates (JSON, YAML and CSV only)")
+	noHistory := fs.Bool("no-history", false, "leave out item history")
+	excludeCompleted := fs.Bool("exclude-completed", false, "leave out completed items and the sections left empty")
+	includeEmptySections := fs.Bool("include-empty-sections", false, "with --exclude-completed, keep sections left empty")
+	columns := fs.Int("columns", 1, "item columns of HTML exports, 1 or 2")
+	crlf := fs.Bool("crlf", false, "end CSV lines with CRLF")
+	quoteAll := fs.Bool("quote-all", false, "quote every CSV field")
+	excel := fs.Bool("excel", false, "CSV for Excel: semicolon delimiter unless --delimiter is given, and CRLF")
+	includePhotos := fs.Bool("include-photos", false, "bundle the photos of items (zip only)")
+	if _, err := parseCLIArgs(fs, args); err != nil {
+		return err
+	}
+	if *excel {
+		*crlf = true
+		delimiterSet := false
+		fs.Visit(func(f *flag.Flag) { delimiterSet = delimiterSet || f.Name == "delimiter" })
+		if !delimiterSet {
+			*delimiter = ";"
+		}
+	}
+	switch *format {
+	case "json", "yaml", "csv", "xlsx", "markdown", "html", "zip":
+	default:
+		return fmt.Errorf("unknown format %q, use json, yaml, csv, xlsx, markdown, html or zip", *format)
+	}
+	if *columns != 1 && *columns != 2 {
+		return errors.New("--columns must be 1 or 2")
+	}
+
+	w, closeOut, err := cliOutput(*out, stdout)
+	if err != nil {
+		return err
+	}
+	err = handlers.Export(w, handlers.ExportOptions{
+		Format:               *format,
+		Delimiter:            *delimiter,
+		CRLF:                 *crlf,
+		QuoteAll:             *quoteAll,
+		IncludeTemplates:     !*noTemplates,
+		IncludeHistory:       !*noHistory,
+		ExcludeCompleted:     *excludeCompleted,
+		IncludeEmptySections: *includeEmptySections,
+		Columns:              *columns,
+		IncludePhotos:        *includePhotos,
+	})
+	if closeErr := closeOut(); err == nil {
+		err = closeErr
+	}
+	var appErr *handlers.AppError
+	if errors.As(err, &appErr) {
+		return errors.New(appErr.Message)
+	}
+	return err
+}
+
+// cliImport imports a file like POST /import, it refuses to run while another import or restore runs
+func cliImport(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	conflict := fs.String("conflict", "skip", "existing lists with the same name: skip, replace, copy or merge")
+	resolutions := map[string]string{}
+	fs.Func("conflict-list", "`name=mode` overriding --conflict for one list, can be repeated", func(value string) error {
+		name, mode, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return errors.New("expected name=mode")
+		}
+		if mode != "skip" && mode != "replace" && mode != "copy" && mode != "merge" {
+			return fmt.Errorf("unknown conflict resolution %q, use skip, replace, copy or merge", mode)
+		}
+		resolutions[name] = mode
+		return nil
+	})
+	copySuffix := fs.String("copy-suffix", "copy", "suffix of renamed lists with --conflict copy")
+	delimiter := fs.String("delimiter", ",", "CSV field separator, a single character or tab")
+	encoding := fs.String("encoding", "", "encoding of CSV files: utf-8, utf-16, windows-1252 or iso-8859-1, detected by default")
+	var mapping handlers.ColumnMapping
+	fs.Func("columns", "JSON object of import columns to header names or indices, for CSV and XLSX files from other apps", func(value string) error {
+		return json.Unmarshal([]byte(value), &mapping)
+	})
+	lang := fs.String("lang", "", "language of default section names, defaults to DEFAULT_LANG")
+	dedupe := fs.Bool("dedupe-items", false, "collapse items named alike within a section into one")
+	strict := fs.Bool("strict", false, "reject the whole import if it has warnings")
+	files, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return errors.New("expected exactly one file to import")
+	}
+	if *conflict != "skip" && *conflict != "replace" && *conflict != "copy" && *conflict != "merge" {
+		return fmt.Errorf("unknown conflict resolution %q, use skip, replace, copy or merge", *conflict)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := db.Migrate(); err != nil {
+		return fmt.Errorf("migrating database: %w", err)
+	}
+
+	end, err := handlers.BeginOperation(handlers.OperationImport)
+	if err != nil {
+		return err
+	}
+	result, err := handlers.Import(f, handlers.ImportOptions{
+		Filename:            files[0],
+		ConflictResolution:  *conflict,
+		ConflictResolutions: resolutions,
+		CopySuffix:          *copySuffix,
+		Delimiter:           *delimiter,
+		ColumnMapping:       mapping,
+		Encoding:            *encoding,
+		Lang:                i18n.Resolve(*lang),
+		DedupeItems:         *dedupe,
+		Strict:              *strict,
+	})
+	end(err)
+	if err != nil {
+		var partial *handlers.ImportPartialError
+		if errors.As(err, &partial) {
+			return fmt.Errorf("%s, the first %d rows were imported (%s)", partial.Message, partial.CommittedRows, partial.Committed.Message)
+		}
+		var rejected *handlers.ImportRejectedError
+		if errors.As(err, &rejected) {
+			printImportWarnings(stdout, rejected.Warnings, rejected.MoreWarnings)
+			return errors.New(rejected.Message)
+		}
+		var appErr *handlers.AppError
+		if errors.As(err, &appErr) {
+			return errors.New(appErr.Message)
+		}
+		return err
+	}
+
+	fmt.Fprintln(stdout, result.Message)
+	printImportWarnings(stdout, result.Warnings, result.MoreWarnings)
+	return nil
+}
+
+// printImportWarnings writes the warnings of an import, one per line
+func printImportWarnings(stdout io.Writer, warnings []handlers.ImportWarning, more int) {
+	for _, w := range warnings {
+		where := w.Path
+		if w.Row > 0 {
+			where = fmt.Sprintf("row %d", w.Row)
+		}
+		if w.Field != "" {
+			where += " (" + w.Field + ")"
+		}
+		if w.Value != "" {
+			where += fmt.Sprintf(" %q", w.Value)
+		}
+		fmt.Fprintf(stdout, "warning: %s: %s, %s\n", where, w.Reason, w.Action)
+	}
+	if more > 0 {
+		fmt.Fprintf(stdout, "warning: and %d more\n", more)
+	}
+}
+
+// cliBackup writes a consistent snapshot like GET /api/v1/admin/backup, also while the server runs
+func cliBackup(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", "snapshot file, must not exist")
+	if _, err := parseCLIArgs(fs, args); err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("koffan-backup-%s.db", time.Now().Format("2006-01-02-150405"))
+	}
+
+	size, err := db.BackupTo(*out)
+	if err != nil {
+		return err
+	}
+	if err := db.AddBackupRecord(db.BackupKindCommand, "", *out, size); err != nil {
+		fmt.Fprintf(stdout, "warning: backup not recorded: %v\n", err)
+	}
+	fmt.Fprintf(stdout, "Wrote %s (%d bytes)\n", *out, size)
+	return nil
+}
+
+// cliMigrate applies pending migrations, or lists them with --status
+func cliMigrate(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := fs.Bool("status", false, "list migrations without applying them")
+	asJSON := fs.Bool("json", false, "print the status as JSON")
+	if _, err := parseCLIArgs(fs, args); err != nil {
+		return err
+	}
+
+	if !*status {
+		if err := db.Migrate(); err != nil {
+			return err
+		}
+	}
+
+	statuses, err := db.GetMigrationStatus()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(stdout).Encode(statuses)
+	}
+	for _, m := range statuses {
+		state := "pending"
+		if m.Applied {
+			state = "applied " + time.Unix(m.AppliedAt, 0).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(stdout, "%4d  %-28s %s\n", m.ID, m.Name, state)
+	}
+	return nil
+}
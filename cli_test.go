@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+)
+
+// setupCLIDB opens a fresh migrated database for the admin commands, as runCLI does
+func setupCLIDB(t *testing.T) {
+	t.Helper()
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	db.Init()
+	t.Cleanup(db.Close)
+}
+
+// seedCLIData creates a list with two sections, a completed item, a template and history
+func seedCLIData(t *testing.T) {
+	t.Helper()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := db.CreateList("Groceries", "🛒")
+	must(err)
+	dairy, err := db.CreateSectionForList(list.ID, "Dairy")
+	must(err)
+	bakery, err := db.CreateSectionForList(list.ID, "Bakery")
+	must(err)
+	milk, err := db.CreateItem(dairy.ID, "Milk", "2L", 2)
+	must(err)
+	_, err = db.ToggleItemCompleted(milk.ID)
+	must(err)
+	_, err = db.CreateItem(bakery.ID, "Bread, rye", `"fresh"`, 1)
+	must(err)
+	weekly, err := db.CreateTemplate("Weekly", "")
+	must(err)
+	_, err = db.AddTemplateItem(weekly.ID, "Dairy", "Milk", "2L")
+	must(err)
+	must(db.SaveItemHistoryWithCount("Milk", dairy.ID, 3))
+}
+
+// cliJSONExport runs the export command to stdout and decodes it without its export time
+func cliJSONExport(t *testing.T) handlers.ExportData {
+	t.Helper()
+	var out bytes.Buffer
+	if err := cliExport([]string{"--format", "json"}, &out); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var data handlers.ExportData
+	if err := json.Unmarshal(out.Bytes(), &data); err != nil {
+		t.Fatalf("decode export %q: %v", out.String(), err)
+	}
+	data.ExportedAt = ""
+	return data
+}
+
+func TestCLIExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "yaml", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			setupCLIDB(t)
+			seedCLIData(t)
+			want := cliJSONExport(t)
+			path := filepath.Join(t.TempDir(), "export."+format)
+			var out bytes.Buffer
+			if err := cliExport([]string{"--format", format, "--out", path}, &out); err != nil {
+				t.Fatalf("export: %v", err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("export to a file wrote %q to stdout", out.String())
+			}
+
+			setupCLIDB(t)
+			out.Reset()
+			if err := cliImport([]string{path, "--conflict", "skip"}, &out); err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if !strings.HasPrefix(out.String(), "Imported 1 list and 2 items") {
+				t.Errorf("import printed %q, want the summary", out.String())
+			}
+			if got := cliJSONExport(t); !reflect.DeepEqual(got.Data.Lists, want.Data.Lists) ||
+				!reflect.DeepEqual(got.Data.Templates, want.Data.Templates) || !reflect.DeepEqual(got.Data.History, want.Data.History) {
+				t.Errorf("database after the import differs:\ngot  %+v\nwant %+v", got.Data, want.Data)
+			}
+		})
+	}
+}
+
+func TestCLIImportConflicts(t *testing.T) {
+	setupCLIDB(t)
+	seedCLIData(t)
+	path := filepath.Join(t.TempDir(), "export.json")
+	if err := cliExport([]string{"--out", path, "--no-templates", "--no-history"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// Flags may follow the file, as the usage shows them
+	if err := cliImport([]string{path, "--conflict", "copy", "--copy-suffix", "again"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("import with copy: %v", err)
+	}
+	if err := cliImport([]string{"--conflict", "skip", path}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("import with skip: %v", err)
+	}
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, l := range lists {
+		names = append(names, l.Name)
+	}
+	if len(names) != 2 || names[0] != "Groceries" || !strings.Contains(names[1], "again") {
+		t.Errorf("lists = %q, want Groceries and one renamed copy", names)
+	}
+}
+
+func TestCLIRejectsBadArguments(t *testing.T) {
+	setupCLIDB(t)
+	existing := filepath.Join(t.TempDir(), "existing.json")
+	if err := os.WriteFile(existing, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		run  func([]string, *bytes.Buffer) error
+		args []string
+	}{
+		{"unknown export format", func(a []string, w *bytes.Buffer) error { return cliExport(a, w) }, []string{"--format", "pdf"}},
+		{"HTML columns", func(a []string, w *bytes.Buffer) error { return cliExport(a, w) }, []string{"--format", "html", "--columns", "3"}},
+		{"existing output file", func(a []string, w *bytes.Buffer) error { return cliExport(a, w) }, []string{"--out", existing}},
+		{"no file to import", func(a []string, w *bytes.Buffer) error { return cliImport(a, w) }, nil},
+		{"two files to import", func(a []string, w *bytes.Buffer) error { return cliImport(a, w) }, []string{existing, existing}},
+		{"unknown conflict", func(a []string, w *bytes.Buffer) error { return cliImport(a, w) }, []string{existing, "--conflict", "overwrite"}},
+		{"unknown list conflict", func(a []string, w *bytes.Buffer) error { return cliImport(a, w) }, []string{existing, "--conflict-list", "Groceries=drop"}},
+		{"missing file", func(a []string, w *bytes.Buffer) error { return cliImport(a, w) }, []string{filepath.Join(t.TempDir(), "missing.csv")}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.run(tc.args, &bytes.Buffer{}); err == nil {
+				t.Errorf("%v succeeded, want an error", tc.args)
+			}
+		})
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "{}" {
+		t.Errorf("export overwrote an existing file: %q", data)
+	}
+}
+
+func TestCLIImportRefusesWhileServerImports(t *testing.T) {
+	setupCLIDB(t)
+	path := filepath.Join(t.TempDir(), "list.csv")
+	csv := "list_name,list_icon,section_name,item_name,item_description,item_completed,item_uncertain\nGroceries,,Dairy,Milk,,false,false\n"
+	if err := os.WriteFile(path, []byte(csv), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock the server persists while it imports, held by a live process that is not this one
+	lock := `{"name":"restore","started_at":1,"pid":` + strconv.Itoa(os.Getppid()) + `}`
+	if err := db.SetSetting("operation_lock", lock); err != nil {
+		t.Fatal(err)
+	}
+	err := cliImport([]string{path}, &bytes.Buffer{})
+	var busy *handlers.OperationBusyError
+	if !errors.As(err, &busy) || busy.Current.Name != handlers.OperationRestore {
+		t.Fatalf("import while the server restores: %v, want an operation busy error", err)
+	}
+	if lists, _ := db.GetAllLists(); len(lists) != 0 {
+		t.Errorf("refused import created %d lists", len(lists))
+	}
+
+	// Once the server is done the import runs
+	if err := db.SetSetting("operation_lock", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := cliImport([]string{path}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("import after the server finished: %v", err)
+	}
+	if lists, _ := db.GetAllLists(); len(lists) != 1 {
+		t.Errorf("import created %d lists, want 1", len(lists))
+	}
+}
+
+func TestCLIMigrateStatus(t *testing.T) {
+	setupCLIDB(t)
+	var out bytes.Buffer
+	if err := cliMigrate([]string{"--status", "--json"}, &out); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var statuses []struct {
+		ID      int  `json:"id"`
+		Applied bool `json:"applied"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &statuses); err != nil {
+		t.Fatalf("decode %q: %v", out.String(), err)
+	}
+	if len(statuses) == 0 {
+		t.Fatal("no migrations listed")
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("migration %d pending on a migrated database", s.ID)
+		}
+	}
+}
+
+func TestIsCLICommand(t *testing.T) {
+	for args, want := range map[string]bool{
+		"":                 false,
+		"export --out x":   true,
+		"import file.csv":  true,
+		"backup":           true,
+		"migrate --status": true,
+		"help":             true,
+		"--help":           true,
+		"serve":            false,
+		"--port 8080":      false,
+	} {
+		if got := isCLICommand(strings.Fields(args)); got != want {
+			t.Errorf("isCLICommand(%q) = %v, want %v", args, got, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Timeseries metrics
+const (
+	MetricCompletedItems = "completed_items"
+	MetricAddedItems     = "added_items"
+	MetricOpenItems      = "open_items"
+)
+
+// Items and lists of archived lists only count with :include_archived
+const (
+	activityItemsSQL = ` AND (:include_archived OR i.section_id NOT IN (
+		SELECT s.id FROM sections s JOIN lists l ON l.id = s.list_id WHERE l.archived = TRUE
+	))`
+	activityListsSQL = ` AND (:include_archived OR l.archived = FALSE)`
+)
+
+// activityInterval describes how a timeseries interval is bucketed
+type activityInterval struct {
+	step      string // SQLite date modifier to the next period
+	maxPoints int    // Upper bound of the range, in periods
+	// bucketSQL returns the first day of the period of a date expression
+	bucketSQL func(date string) string
+}
+
+// activityIntervals are the supported timeseries intervals, periods are UTC calendar dates
+var activityIntervals = map[string]activityInterval{
+	"day":   {step: "+1 day", maxPoints: 366, bucketSQL: func(d string) string { return "date(" + d + ")" }},
+	"week":  {step: "+7 days", maxPoints: 157, bucketSQL: func(d string) string { return "date(" + d + ", 'weekday 0', '-6 days')" }},
+	"month": {step: "+1 month", maxPoints: 60, bucketSQL: func(d string) string { return "date(" + d + ", 'start of month')" }},
+}
+
+// ValidActivityInterval reports whether interval is supported and its maximum number of periods
+func ValidActivityInterval(interval string) (int, bool) {
+	iv, ok := activityIntervals[interval]
+	return iv.maxPoints, ok
+}
+
+// ValidActivityMetric reports whether metric is supported
+func ValidActivityMetric(metric string) bool {
+	switch metric {
+	case MetricCompletedItems, MetricAddedItems, MetricOpenItems:
+		return true
+	}
+	return false
+}
+
+// TimeseriesPoint is the value of a metric in the period starting on Period (YYYY-MM-DD, UTC)
+type TimeseriesPoint struct {
+	Period string  `json:"period"`
+	Value  float64 `json:"value"`
+}
+
+// Timeseries is a metric bucketed by interval, with every period in range present
+type Timeseries struct {
+	Metric   string            `json:"metric"`
+	Interval string            `json:"interval"`
+	Since    string            `json:"since"`
+	Until    string            `json:"until"`
+	Points   []TimeseriesPoint `json:"points"`
+	Total    float64           `json:"total"` // Sum over the range, the average for open_items
+}
+
+// GetTimeseries buckets metric by interval for the periods overlapping [since, until]
+// Activity is derived from the items that still exist: completed_at for completions and created_at for
+// additions. open_items is the average number of open items per list at the end of each period,
+// counting items created before and not completed by then. Archived lists count with includeArchived
+func GetTimeseries(metric, interval string, since, until time.Time, includeArchived bool) (*Timeseries, error) {
+	iv, ok := activityIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval %q", interval)
+	}
+
+	// periods yields the start of every period and the unix bounds it covers, the last one ends at until
+	periods := fmt.Sprintf(`
+		WITH RECURSIVE periods(start) AS (
+			SELECT %s
+			UNION ALL
+			SELECT date(start, '%s') FROM periods WHERE date(start, '%s') <= date(:until, 'unixepoch')
+		),
+		bounds AS (
+			SELECT start,
+				CAST(strftime('%%s', start) AS INTEGER) AS from_ts,
+				MIN(CAST(strftime('%%s', date(start, '%s')) AS INTEGER), :until + 1) AS to_ts
+			FROM periods
+		)
+	`, iv.bucketSQL(":since, 'unixepoch'"), iv.step, iv.step, iv.step)
+
+	var query string
+	switch metric {
+	case MetricCompletedItems:
+		query = periods + `
+			SELECT b.start, COUNT(i.id) FROM bounds b
+			LEFT JOIN items i ON i.deleted_at IS NULL AND i.completed = TRUE AND i.completed_at >= MAX(b.from_ts, :since) AND i.completed_at < b.to_ts` + activityItemsSQL + `
+			GROUP BY b.start ORDER BY b.start
+		`
+	case MetricAddedItems:
+		query = periods + `
+			SELECT b.start, COUNT(i.id) FROM bounds b
+			LEFT JOIN items i ON i.deleted_at IS NULL AND CAST(strftime('%s', i.created_at) AS INTEGER) >= MAX(b.from_ts, :since)
+				AND CAST(strftime('%s', i.created_at) AS INTEGER) < b.to_ts` + activityItemsSQL + `
+			GROUP BY b.start ORDER BY b.start
+		`
+	case MetricOpenItems:
+		query = periods + `
+			SELECT b.start,
+				COALESCE(CAST((
+					SELECT COUNT(*) FROM items i
+					WHERE i.deleted_at IS NULL AND CAST(strftime('%s', i.created_at) AS INTEGER) < b.to_ts
+						AND (i.completed = FALSE OR i.completed_at >= b.to_ts)` + activityItemsSQL + `
+				) AS REAL) / NULLIF((
+					SELECT COUNT(*) FROM lists l WHERE CAST(strftime('%s', l.created_at) AS INTEGER) < b.to_ts` + activityListsSQL + `
+				), 0), 0)
+			FROM bounds b ORDER BY b.start
+		`
+	default:
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+
+	rows, err := DB.Query(query, sql.Named("since", since.Unix()), sql.Named("until", until.Unix()), sql.Named("include_archived", includeArchived))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ts := &Timeseries{
+		Metric:   metric,
+		Interval: interval,
+		Since:    since.UTC().Format(time.RFC3339),
+		Until:    until.UTC().Format(time.RFC3339),
+		Points:   []TimeseriesPoint{},
+	}
+	for rows.Next() {
+		var p TimeseriesPoint
+		if err := rows.Scan(&p.Period, &p.Value); err != nil {
+			return nil, err
+		}
+		ts.Points = append(ts.Points, p)
+		ts.Total += p.Value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if metric == MetricOpenItems && len(ts.Points) > 0 {
+		ts.Total /= float64(len(ts.Points))
+	}
+	return ts, nil
+}
+
+// WeekdayActivity is the number of completions on a weekday, 0 is Sunday
+type WeekdayActivity struct {
+	Weekday   int `json:"weekday"`
+	Completed int `json:"completed"`
+}
+
+// SectionActivity is the activity of all sections sharing a name
+type SectionActivity struct {
+	Name      string `json:"name"`
+	Completed int    `json:"completed"`
+	Added     int    `json:"added"`
+}
+
+// StatsOverview summarizes the current state and the activity since Since
+type StatsOverview struct {
+	Since          string            `json:"since"`
+	Lists          int               `json:"lists"`
+	Items          int               `json:"items"`
+	OpenItems      int               `json:"open_items"`
+	CompletedItems int               `json:"completed_items"`
+	Completed      int               `json:"completed"` // Completions since Since
+	Added          int               `json:"added"`     // Additions since Since
+	BusiestWeekday *WeekdayActivity  `json:"busiest_weekday"`
+	Weekdays       []WeekdayActivity `json:"weekdays"`
+	TopSections    []SectionActivity `json:"top_sections"`
+}
+
+// GetStatsOverview returns totals, completions per weekday (UTC) and the sections with the most activity
+// Archived lists count with includeArchived
+func GetStatsOverview(since time.Time, topSections int, includeArchived bool) (*StatsOverview, error) {
+	o := &StatsOverview{Since: since.UTC().Format(time.RFC3339)}
+	sinceTS := sql.Named("since", since.Unix())
+	archived := sql.Named("include_archived", includeArchived)
+
+	err := DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM lists l WHERE TRUE`+activityListsSQL+`),
+			(SELECT COUNT(*) FROM items i WHERE i.deleted_at IS NULL`+activityItemsSQL+`),
+			(SELECT COUNT(*) FROM items i WHERE i.deleted_at IS NULL AND i.completed = FALSE`+activityItemsSQL+`),
+			(SELECT COUNT(*) FROM items i WHERE i.deleted_at IS NULL AND i.completed = TRUE`+activityItemsSQL+`),
+			(SELECT COUNT(*) FROM items i WHERE i.deleted_at IS NULL AND i.completed = TRUE AND i.completed_at >= :since`+activityItemsSQL+`),
+			(SELECT COUNT(*) FROM items i WHERE i.deleted_at IS NULL AND CAST(strftime('%s', i.created_at) AS INTEGER) >= :since`+activityItemsSQL+`)
+	`, sinceTS, archived).Scan(&o.Lists, &o.Items, &o.OpenItems, &o.CompletedItems, &o.Completed, &o.Added)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Weekdays = make([]WeekdayActivity, 7)
+	for i := range o.Weekdays {
+		o.Weekdays[i].Weekday = i
+	}
+	rows, err := DB.Query(`
+		SELECT CAST(strftime('%w', i.completed_at, 'unixepoch') AS INTEGER), COUNT(*)
+		FROM items i WHERE i.deleted_at IS NULL AND i.completed = TRUE AND i.completed_at >= :since`+activityItemsSQL+`
+		GROUP BY 1
+	`, sinceTS, archived)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var day, count int
+		if err := rows.Scan(&day, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		o.Weekdays[day].Completed = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range o.Weekdays {
+		if o.Weekdays[i].Completed > 0 && (o.BusiestWeekday == nil || o.Weekdays[i].Completed > o.BusiestWeekday.Completed) {
+			day := o.Weekdays[i]
+			o.BusiestWeekday = &day
+		}
+	}
+
+	rows, err = DB.Query(`
+		SELECT MIN(s.name),
+			SUM(CASE WHEN i.completed = TRUE AND i.completed_at >= :since THEN 1 ELSE 0 END) AS completed,
+			SUM(CASE WHEN CAST(strftime('%s', i.created_at) AS INTEGER) >= :since THEN 1 ELSE 0 END) AS added
+		FROM items i JOIN sections s ON s.id = i.section_id
+		WHERE i.deleted_at IS NULL`+activityItemsSQL+`
+		GROUP BY s.name COLLATE NOCASE
+		HAVING completed + added > 0
+		ORDER BY completed + added DESC, completed DESC, MIN(s.name)
+		LIMIT :top
+	`, sinceTS, archived, sql.Named("top", topSections))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	o.TopSections = []SectionActivity{}
+	for rows.Next() {
+		var s SectionActivity
+		if err := rows.Scan(&s.Name, &s.Completed, &s.Added); err != nil {
+			return nil, err
+		}
+		o.TopSections = append(o.TopSections, s)
+	}
+	return o, rows.Err()
+}
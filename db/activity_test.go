@@ -0,0 +1,174 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// addActivityItem adds an item created at created and, unless completed is zero, completed at completed
+func addActivityItem(t *testing.T, sectionID int64, name string, created, completed time.Time) {
+	t.Helper()
+	item, err := CreateItem(sectionID, name, "", 1)
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	if _, err := DB.Exec("UPDATE items SET created_at = ? WHERE id = ?", created.UTC().Format(time.DateTime), item.ID); err != nil {
+		t.Fatalf("set created_at: %v", err)
+	}
+	if !completed.IsZero() {
+		completeItems(t, completed, item.ID)
+	}
+}
+
+// activitySection creates a list with one section, the list as if created at the start of September
+func activitySection(t *testing.T, list, section string) (*List, *Section) {
+	t.Helper()
+	l, err := CreateList(list, "")
+	if err != nil {
+		t.Fatalf("create list: %v", err)
+	}
+	if _, err := DB.Exec("UPDATE lists SET created_at = ? WHERE id = ?", day(1, 0).Format(time.DateTime), l.ID); err != nil {
+		t.Fatalf("set created_at: %v", err)
+	}
+	s, err := CreateSectionForList(l.ID, section)
+	if err != nil {
+		t.Fatalf("create section: %v", err)
+	}
+	return l, s
+}
+
+// day returns the hour of a day of September 2026, UTC
+func day(d, hour int) time.Time {
+	return time.Date(2026, time.September, d, hour, 0, 0, 0, time.UTC)
+}
+
+func TestStatsLeaveOutArchivedLists(t *testing.T) {
+	setupTestDB(t)
+	_, dairy := activitySection(t, "Groceries", "Dairy")
+	attic, boxes := activitySection(t, "Attic", "Boxes")
+	addActivityItem(t, dairy.ID, "Milk", day(1, 10), day(2, 10))
+	addActivityItem(t, boxes.ID, "Box", day(1, 10), day(2, 10))
+	addActivityItem(t, boxes.ID, "Tape", day(1, 10), time.Time{})
+	archived := true
+	if _, err := UpdateList(attic.ID, attic.Name, "", &archived); err != nil {
+		t.Fatalf("archive list: %v", err)
+	}
+
+	for _, tc := range []struct {
+		includeArchived bool
+		completed       float64
+		openOnFirstDay  float64
+		lists, items    int
+		topSections     int
+	}{
+		{false, 1, 1, 1, 1, 1},
+		{true, 2, 1.5, 2, 3, 2},
+	} {
+		completed, err := GetTimeseries(MetricCompletedItems, "day", day(1, 0), day(3, 0), tc.includeArchived)
+		if err != nil {
+			t.Fatalf("completed timeseries: %v", err)
+		}
+		if completed.Total != tc.completed {
+			t.Errorf("include_archived=%v: %v completions, want %v", tc.includeArchived, completed.Total, tc.completed)
+		}
+		open, err := GetTimeseries(MetricOpenItems, "day", day(1, 0), day(3, 0), tc.includeArchived)
+		if err != nil {
+			t.Fatalf("open timeseries: %v", err)
+		}
+		if open.Points[0].Value != tc.openOnFirstDay {
+			t.Errorf("include_archived=%v: %v open items per list on the first day, want %v", tc.includeArchived, open.Points[0].Value, tc.openOnFirstDay)
+		}
+		overview, err := GetStatsOverview(day(1, 0), 5, tc.includeArchived)
+		if err != nil {
+			t.Fatalf("overview: %v", err)
+		}
+		if overview.Lists != tc.lists || overview.Items != tc.items || len(overview.TopSections) != tc.topSections {
+			t.Errorf("include_archived=%v: overview %+v, want %d lists, %d items and %d sections",
+				tc.includeArchived, overview, tc.lists, tc.items, tc.topSections)
+		}
+	}
+
+	// Taken out of the archive the list counts again, a nil flag leaves it alone
+	unarchived := false
+	if _, err := UpdateList(attic.ID, attic.Name, "", &unarchived); err != nil {
+		t.Fatalf("unarchive list: %v", err)
+	}
+	list, err := UpdateList(attic.ID, "Loft", "", nil)
+	if err != nil {
+		t.Fatalf("rename list: %v", err)
+	}
+	if list.Archived || list.Name != "Loft" {
+		t.Errorf("list = %+v, want Loft out of the archive", list)
+	}
+	if overview, _ := GetStatsOverview(day(1, 0), 5, false); overview == nil || overview.Lists != 2 {
+		t.Errorf("overview after unarchiving = %+v, want 2 lists", overview)
+	}
+}
+
+// activityFixture is testdata/activity_september.json, the expected statistics of seedSeptember
+type activityFixture struct {
+	Timeseries []struct {
+		Metric   string            `json:"metric"`
+		Interval string            `json:"interval"`
+		Since    time.Time         `json:"since"`
+		Until    time.Time         `json:"until"`
+		Points   []TimeseriesPoint `json:"points"`
+		Total    float64           `json:"total"`
+	} `json:"timeseries"`
+	Overview StatsOverview `json:"overview"`
+}
+
+// seedSeptember creates an item at noon on every day of September 2026 and completes those of even days
+// at noon the next day
+func seedSeptember(t *testing.T) {
+	t.Helper()
+	_, daily := activitySection(t, "Groceries", "Daily")
+	for d := 1; d <= 30; d++ {
+		var completed time.Time
+		if d%2 == 0 {
+			completed = day(d+1, 12)
+		}
+		addActivityItem(t, daily.ID, fmt.Sprintf("Item %d", d), day(d, 12), completed)
+	}
+}
+
+func TestActivityBucketing(t *testing.T) {
+	setupTestDB(t)
+	seedSeptember(t)
+	data, err := os.ReadFile(filepath.Join("testdata", "activity_september.json"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	var fixture activityFixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatalf("decode fixture: %v", err)
+	}
+
+	for _, want := range fixture.Timeseries {
+		name := fmt.Sprintf("%s per %s from %s", want.Metric, want.Interval, want.Since.Format(time.DateOnly))
+		t.Run(name, func(t *testing.T) {
+			got, err := GetTimeseries(want.Metric, want.Interval, want.Since, want.Until, false)
+			if err != nil {
+				t.Fatalf("timeseries: %v", err)
+			}
+			if !reflect.DeepEqual(got.Points, want.Points) || math.Abs(got.Total-want.Total) > 1e-9 {
+				t.Errorf("points %v total %v, want %v total %v", got.Points, got.Total, want.Points, want.Total)
+			}
+		})
+	}
+
+	want := fixture.Overview
+	got, err := GetStatsOverview(day(1, 0), 5, false)
+	if err != nil {
+		t.Fatalf("overview: %v", err)
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("overview = %+v\nwant %+v", *got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package db
+
+import "time"
+
+// AuditEntry represents a single audit log record
+type AuditEntry struct {
+	ID        int64  `json:"id"`
+	Action    string `json:"action"`
+	Actor     string `json:"actor,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// AddAuditLog records a security-relevant event
+func AddAuditLog(action, actor, ip, details, requestID string) error {
+	_, err := writeDB.Exec(`
+		INSERT INTO audit_log (action, actor, ip, details, request_id, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, action, actor, ip, details, requestID, time.Now().Unix())
+	return err
+}
+
+// GetAuditLog returns the most recent audit log entries
+func GetAuditLog(limit int) ([]AuditEntry, error) {
+	rows, err := DB.Query(`
+		SELECT id, action, actor, ip, details, request_id, created_at
+		FROM audit_log
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &e.IP, &e.Details, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
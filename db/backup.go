@@ -0,0 +1,183 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// BackupTo writes a consistent snapshot of the database to path using VACUUM INTO
+// It runs on the write connection, so writes wait for the snapshot rather than racing it
+// The target file must not exist yet
+func BackupTo(path string) (int64, error) {
+	if _, err := writeDB.Exec("VACUUM INTO ?", path); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// sqliteHeader is the magic string at the start of every SQLite database file
+const sqliteHeader = "SQLite format 3\x00"
+
+// RestoreCounts summarizes the contents of a restored database
+type RestoreCounts struct {
+	Lists int `json:"lists"`
+	Items int `json:"items"`
+}
+
+// ValidateBackup checks that path is an SQLite database that passes an integrity check
+// The file is opened read-only on its own connection, DB is not touched
+func ValidateBackup(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(f, header)
+	f.Close()
+	if err != nil || string(header) != sqliteHeader {
+		return errors.New("not an SQLite database")
+	}
+
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+// Restore replaces the live database with the file at newPath, which must be on the same filesystem
+// The current database is kept next to it with a timestamped suffix, and migrations run on the new one.
+// If the new database cannot be opened or migrated the original is moved back and reopened
+// Callers must make sure no other requests use DB while this runs
+func Restore(newPath string) (string, error) {
+	dbPath := Path()
+	asidePath := fmt.Sprintf("%s.pre-restore-%s", dbPath, time.Now().Format("20060102-150405"))
+
+	// Closing the last connection checkpoints the WAL into the main file
+	if err := closeDB(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(dbPath, asidePath); err != nil {
+		if openErr := open(dbPath); openErr != nil {
+			log.Printf("[RESTORE] Failed to reopen database: %v", openErr)
+		}
+		return "", err
+	}
+	// Leftover WAL files belong to the old database and must not be applied to the new one
+	os.Remove(dbPath + "-wal")
+	os.Remove(dbPath + "-shm")
+
+	if err := os.Rename(newPath, dbPath); err != nil {
+		restoreAside(dbPath, asidePath)
+		return "", err
+	}
+
+	if err := open(dbPath); err != nil {
+		closeDB()
+		restoreAside(dbPath, asidePath)
+		return "", err
+	}
+	if err := Migrate(); err != nil {
+		closeDB()
+		restoreAside(dbPath, asidePath)
+		return "", err
+	}
+	if err := InitSearch(); err != nil {
+		log.Printf("[SEARCH] Full-text index unavailable, search falls back to LIKE: %v", err)
+	}
+
+	return asidePath, nil
+}
+
+// restoreAside discards whatever is at dbPath and reopens the original database moved to asidePath
+func restoreAside(dbPath, asidePath string) {
+	for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("[RESTORE] Failed to remove %s: %v", path, err)
+		}
+	}
+	if err := os.Rename(asidePath, dbPath); err != nil {
+		log.Printf("[RESTORE] Failed to move original database back: %v", err)
+	}
+	if err := open(dbPath); err != nil {
+		log.Printf("[RESTORE] Failed to reopen database: %v", err)
+	}
+}
+
+// GetRestoreCounts returns the number of lists and items in the database, items in the trash not counted
+func GetRestoreCounts() (RestoreCounts, error) {
+	var counts RestoreCounts
+	err := DB.QueryRow("SELECT (SELECT COUNT(*) FROM lists), (SELECT COUNT(*) FROM items WHERE deleted_at IS NULL)").Scan(&counts.Lists, &counts.Items)
+	return counts, err
+}
+
+// Kinds of backup records
+const (
+	BackupKindDownload = "download" // GET /api/v1/admin/backup
+	BackupKindPush     = "push"     // Export pushed to S3 or WebDAV
+	BackupKindCommand  = "command"  // The backup admin command
+)
+
+// BackupRecord is a backup that was taken, the file itself is not kept by the server
+type BackupRecord struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Target    string `json:"target,omitempty"` // s3 or webdav for pushes
+	Name      string `json:"name"`             // File name, object key or path
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+	// CreatedAtDisplay and CreatedAtRelative are filled in by handlers for the request language
+	CreatedAtDisplay  string `json:"created_at_display,omitempty"`
+	CreatedAtRelative string `json:"created_at_relative,omitempty"`
+}
+
+// AddBackupRecord records a backup taken now
+func AddBackupRecord(kind, target, name string, size int64) error {
+	_, err := writeDB.Exec(`
+		INSERT INTO backups (kind, target, name, size, created_at) VALUES (?, ?, ?, ?, ?)
+	`, kind, target, name, size, time.Now().Unix())
+	return err
+}
+
+// GetBackupRecords returns the most recent backups, newest first
+func GetBackupRecords(limit int) ([]BackupRecord, error) {
+	rows, err := DB.Query(`
+		SELECT id, kind, target, name, size, created_at FROM backups
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []BackupRecord{}
+	for rows.Next() {
+		var r BackupRecord
+		if err := rows.Scan(&r.ID, &r.Kind, &r.Target, &r.Name, &r.Size, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
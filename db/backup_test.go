@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRestoreSwapsDatabase(t *testing.T) {
+	setupTestDB(t)
+	if _, err := CreateList("Before", ""); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	if _, err := BackupTo(backup); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if _, err := CreateList("After", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateBackup(backup); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	aside, err := Restore(backup)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := listNames(t); !reflect.DeepEqual(got, []string{"Before"}) {
+		t.Errorf("lists after restore = %v, want [Before]", got)
+	}
+	if _, err := os.Stat(aside); err != nil {
+		t.Errorf("previous database not kept at %s: %v", aside, err)
+	}
+}
+
+func TestRestoreRollsBackFailedMigration(t *testing.T) {
+	setupTestDB(t)
+	if _, err := CreateList("Original", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A valid SQLite file whose migration table cannot be read, so Migrate fails
+	broken := filepath.Join(t.TempDir(), "broken.db")
+	conn, err := sql.Open("sqlite3", broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("CREATE TABLE schema_migrations (version TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := ValidateBackup(broken); err != nil {
+		t.Fatalf("the broken file should pass validation: %v", err)
+	}
+
+	aside, err := Restore(broken)
+	if err == nil {
+		t.Fatal("restore of a database that cannot be migrated succeeded")
+	}
+	if aside != "" {
+		t.Errorf("restore returned previous path %q for a rolled back restore", aside)
+	}
+
+	// The original database is back in place and usable
+	if got := listNames(t); !reflect.DeepEqual(got, []string{"Original"}) {
+		t.Errorf("lists after failed restore = %v, want [Original]", got)
+	}
+	if _, err := CreateList("Still writable", ""); err != nil {
+		t.Errorf("write after failed restore: %v", err)
+	}
+	leftovers, _ := filepath.Glob(Path() + ".pre-restore-*")
+	if len(leftovers) > 0 {
+		t.Errorf("original database left aside: %v", leftovers)
+	}
+}
+
+func TestGetRestoreCountsSkipsTrash(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	if err := DeleteItem(f.milk.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	counts, err := GetRestoreCounts()
+	if err != nil {
+		t.Fatalf("counts: %v", err)
+	}
+	if counts.Lists != 1 || counts.Items != 2 {
+		t.Errorf("counts = %+v, want 1 list and 2 items", counts)
+	}
+}
+
+// waitsForWrite runs fn while a write transaction is open and checks that it queues for the write connection
+func waitsForWrite(t *testing.T, name string, fn func() error) {
+	t.Helper()
+	tx, err := BeginWrite()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	waits := writeDB.Stats().WaitCount
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for writeDB.Stats().WaitCount == waits {
+		select {
+		case err := <-done:
+			tx.Rollback()
+			t.Fatalf("%s ran while a write was open, err = %v", name, err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			tx.Rollback()
+			t.Fatalf("%s did not queue for the write connection", name)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("%s after the write: %v", name, err)
+	}
+}
+
+func TestMaintenanceRunsOnWriteConnection(t *testing.T) {
+	setupTestDB(t)
+	if _, err := CreateList("Groceries", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	waitsForWrite(t, "Optimize", Optimize)
+	waitsForWrite(t, "BackupTo", func() error {
+		_, err := BackupTo(filepath.Join(t.TempDir(), "backup.db"))
+		return err
+	})
+}
@@ -0,0 +1,186 @@
+package db
+
+// CleanupListResult describes the completed items removed from one list
+type CleanupListResult struct {
+	ListID   int64    `json:"list_id"`
+	ListName string   `json:"list_name"`
+	Count    int      `json:"count"`
+	Items    []string `json:"items"`
+}
+
+// CleanupCompletedItems moves items completed before the cutoff (unix seconds) to the trash
+// Item names are kept in history for auto-completion. With dryRun nothing is changed
+func CleanupCompletedItems(cutoff int64, dryRun bool) ([]CleanupListResult, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT i.id, i.name, i.section_id, l.id, l.name
+		FROM items i
+		JOIN sections s ON s.id = i.section_id
+		JOIN lists l ON l.id = s.list_id
+		WHERE i.completed = TRUE AND i.completed_at IS NOT NULL AND i.completed_at < ? AND i.deleted_at IS NULL
+		ORDER BY l.sort_order, l.id, i.id
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		id        int64
+		name      string
+		sectionID int64
+	}
+	var candidates []candidate
+	var results []CleanupListResult
+	for rows.Next() {
+		var c candidate
+		var listID int64
+		var listName string
+		if err := rows.Scan(&c.id, &c.name, &c.sectionID, &listID, &listName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+		if len(results) == 0 || results[len(results)-1].ListID != listID {
+			results = append(results, CleanupListResult{ListID: listID, ListName: listName})
+		}
+		r := &results[len(results)-1]
+		r.Count++
+		r.Items = append(r.Items, c.name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if dryRun || len(candidates) == 0 {
+		return results, nil
+	}
+
+	for _, c := range candidates {
+		// Items are added to history when created, this only covers names missing from it
+		if _, err := tx.Exec(`
+			INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
+			VALUES (?, ?, 1, strftime('%s', 'now'))
+			ON CONFLICT(name COLLATE NOCASE) DO NOTHING
+		`, c.name, c.sectionID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(trashItemSQL, c.id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ClearedSection counts the completed items ClearCompletedItems removed from a section
+type ClearedSection struct {
+	SectionID int64  `json:"section_id"`
+	Name      string `json:"name"`
+	Removed   int    `json:"removed"`
+}
+
+// ClearCompletedResult describes what ClearCompletedItems removed from a list
+type ClearCompletedResult struct {
+	Removed        int              `json:"removed"`
+	Archived       bool             `json:"archived"`
+	Sections       []ClearedSection `json:"sections"`        // Sections that had completed items, in list order
+	PrunedSections []int64          `json:"pruned_sections"` // Sections deleted because the clear left them empty
+	ItemIDs        []int64          `json:"-"`
+}
+
+// ClearCompletedItems moves the completed items of a list to the trash in one transaction
+// With archive each item is recorded in history as a completion, with pruneSections the sections
+// left empty are deleted too, along with their trash. Sections that were empty before are kept
+func ClearCompletedItems(listID int64, archive, pruneSections bool) (*ClearCompletedResult, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT i.id, i.name, COALESCE(i.completed_at, strftime('%s', 'now')), s.id, s.name
+		FROM items i
+		JOIN sections s ON s.id = i.section_id
+		WHERE s.list_id = ? AND i.completed = TRUE AND i.deleted_at IS NULL
+		ORDER BY s.sort_order, s.id, i.sort_order
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		id, completedAt, sectionID int64
+		name                       string
+	}
+	var candidates []candidate
+	result := &ClearCompletedResult{Archived: archive, Sections: []ClearedSection{}, PrunedSections: []int64{}, ItemIDs: []int64{}}
+	for rows.Next() {
+		var c candidate
+		var sectionName string
+		if err := rows.Scan(&c.id, &c.name, &c.completedAt, &c.sectionID, &sectionName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+		if n := len(result.Sections); n == 0 || result.Sections[n-1].SectionID != c.sectionID {
+			result.Sections = append(result.Sections, ClearedSection{SectionID: c.sectionID, Name: sectionName})
+		}
+		result.Sections[len(result.Sections)-1].Removed++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	for _, c := range candidates {
+		if archive {
+			if _, err := tx.Exec(`
+				INSERT INTO item_history (name, last_section_id, usage_count, last_used_at, completed_count, last_completed_at)
+				VALUES (?, ?, 1, strftime('%s', 'now'), 1, ?)
+				ON CONFLICT(name COLLATE NOCASE) DO UPDATE SET
+					last_section_id = excluded.last_section_id,
+					completed_count = completed_count + 1,
+					last_completed_at = MAX(COALESCE(last_completed_at, 0), excluded.last_completed_at)
+			`, c.name, c.sectionID, c.completedAt); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(trashItemSQL, c.id); err != nil {
+			return nil, err
+		}
+		result.ItemIDs = append(result.ItemIDs, c.id)
+	}
+	result.Removed = len(candidates)
+
+	if pruneSections {
+		for _, section := range result.Sections {
+			res, err := tx.Exec(`
+				DELETE FROM sections WHERE id = ? AND NOT EXISTS (SELECT 1 FROM items WHERE section_id = ? AND deleted_at IS NULL)
+			`, section.SectionID, section.SectionID)
+			if err != nil {
+				return nil, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				result.PrunedSections = append(result.PrunedSections, section.SectionID)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
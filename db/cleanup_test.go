@@ -0,0 +1,89 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// completeItems marks items completed at the given time
+func completeItems(t *testing.T, at time.Time, ids ...int64) {
+	t.Helper()
+	for _, id := range ids {
+		if _, err := DB.Exec("UPDATE items SET completed = TRUE, completed_at = ? WHERE id = ?", at.Unix(), id); err != nil {
+			t.Fatalf("complete item: %v", err)
+		}
+	}
+}
+
+// trashedIDs returns the IDs of the items in the trash of a list
+func trashedIDs(t *testing.T, listID int64) []int64 {
+	t.Helper()
+	trash, _, err := GetTrash(listID, 100, 0)
+	if err != nil {
+		t.Fatalf("get trash: %v", err)
+	}
+	ids := make([]int64, 0, len(trash))
+	for _, i := range trash {
+		ids = append(ids, i.ID)
+	}
+	return ids
+}
+
+func TestCleanupCompletedItemsMovesToTrash(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	now := time.Now()
+	completeItems(t, now.AddDate(0, 0, -10), f.bread.ID)
+	completeItems(t, now.AddDate(0, 0, -1), f.milk.ID)
+
+	results, err := CleanupCompletedItems(now.AddDate(0, 0, -7).Unix(), false)
+	if err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if len(results) != 1 || results[0].Count != 1 || results[0].Items[0] != "Bread" {
+		t.Errorf("cleanup results = %+v, want Bread only", results)
+	}
+	if names := sectionItemNames(t, f.section.ID); !equalNames(names, []string{"Cheese", "Milk"}) {
+		t.Errorf("section items = %v, want Cheese and the completed Milk", names)
+	}
+	if ids := trashedIDs(t, f.list.ID); len(ids) != 1 || ids[0] != f.bread.ID {
+		t.Errorf("trash = %v, want Bread", ids)
+	}
+	if _, err := RestoreItem(f.bread.ID); err != nil {
+		t.Errorf("cleaned up item cannot be restored: %v", err)
+	}
+}
+
+func TestClearCompletedTargetMovesToTrash(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	completeItems(t, time.Now(), f.bread.ID, f.milk.ID)
+	// Milk is already in the trash, the clear neither counts nor touches it
+	if err := DeleteItem(f.milk.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	var milkDeletedAt int64
+	if _, err := DB.Exec("UPDATE items SET deleted_at = 1000 WHERE id = ?", f.milk.ID); err != nil {
+		t.Fatalf("age item: %v", err)
+	}
+
+	counts, err := ClearData([]string{ClearTargetCompletedItems})
+	if err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if counts[ClearTargetCompletedItems] != 1 {
+		t.Errorf("cleared %d completed items, want 1", counts[ClearTargetCompletedItems])
+	}
+	if names := sectionItemNames(t, f.section.ID); !equalNames(names, []string{"Cheese"}) {
+		t.Errorf("section items = %v, want Cheese", names)
+	}
+	if ids := trashedIDs(t, f.list.ID); len(ids) != 2 {
+		t.Errorf("trash = %v, want Bread and Milk", ids)
+	}
+	if err := DB.QueryRow("SELECT deleted_at FROM items WHERE id = ?", f.milk.ID).Scan(&milkDeletedAt); err != nil || milkDeletedAt != 1000 {
+		t.Errorf("Milk deleted_at = %d, %v, want it unchanged", milkDeletedAt, err)
+	}
+	if _, err := RestoreItem(f.bread.ID); err != nil {
+		t.Errorf("cleared item cannot be restored: %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,11 +13,27 @@ import (
 
 var DB *sql.DB
 
-func Init() {
+// writeDB is a second handle on the same file with a single connection that every write goes through,
+// so writers of this process queue for it instead of contending for SQLite's write lock
+var writeDB *sql.DB
+
+const (
+	connectionParams = "?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL&_txlock=immediate"
+	maxIdleConns     = 4
+	maxWriteConns    = 1
+)
+
+// Path returns the location of the database file
+func Path() string {
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = "./shopping.db"
 	}
+	return dbPath
+}
+
+func Init() {
+	dbPath := Path()
 
 	// Create parent directory if it doesn't exist
 	dir := filepath.Dir(dbPath)
@@ -25,16 +43,64 @@ func Init() {
 		}
 	}
 
+	if err := open(dbPath); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	// Create tables and bring the schema up to date
+	if err := Migrate(); err != nil {
+		log.Fatal("Database migration failed: ", err)
+	}
+	if err := InitSearch(); err != nil {
+		log.Printf("[SEARCH] Full-text index unavailable, search falls back to LIKE: %v", err)
+	}
+
+	log.Println("Database initialized successfully (WAL mode)")
+}
+
+// Open connects to the existing database at Path without running migrations
+// Used by the admin commands, which must also work when a migration keeps the server from starting
+func Open() error {
+	dbPath := Path()
+	if _, err := os.Stat(dbPath); err != nil {
+		return err
+	}
+	return open(dbPath)
+}
+
+// open connects DB to the database file at dbPath
+func open(dbPath string) error {
 	var err error
-	// Enable WAL mode and foreign keys for better concurrency
-	DB, err = sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000")
+	// Connection parameters apply to every pooled connection:
+	// WAL lets readers run alongside the single writer, busy_timeout makes writers wait for the lock,
+	// and _txlock=immediate takes the write lock at BEGIN so a transaction never has to upgrade
+	// a read lock mid-way (an upgrade that fails with SQLITE_BUSY regardless of busy_timeout)
+	DB, err = sql.Open("sqlite3", dbPath+connectionParams)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return err
 	}
 
+	// Reads are not capped because some queries run a nested query while iterating rows, which
+	// would deadlock a small pool. Idle connections are kept so their pragmas do not have to be reapplied
+	DB.SetMaxIdleConns(maxIdleConns)
+
+	// SQLite has a single writer, so the write handle has a single connection. A write waits in the
+	// pool for the one before it instead of failing with "database is locked" after busy_timeout.
+	// Writes must not start another write while they hold it, that would wait forever
+	writeDB, err = sql.Open("sqlite3", dbPath+connectionParams)
+	if err != nil {
+		DB.Close()
+		return err
+	}
+	writeDB.SetMaxOpenConns(maxWriteConns)
+	writeDB.SetMaxIdleConns(maxWriteConns)
+
 	// Test connection
 	if err = DB.Ping(); err != nil {
-		log.Fatal("Failed to ping database:", err)
+		return err
+	}
+	if err = writeDB.Ping(); err != nil {
+		return err
 	}
 
 	// Enable WAL mode explicitly (in case pragma wasn't applied via connection string)
@@ -49,13 +115,11 @@ func Init() {
 		log.Println("Warning: Could not set busy timeout:", err)
 	}
 
-	// Create tables
-	createTables()
-
-	log.Println("Database initialized successfully (WAL mode)")
+	return nil
 }
 
-func createTables() {
+// createBaseSchema creates the original tables, later columns and tables are added by the legacy migrations
+func createBaseSchema(tx *sql.Tx) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS sections (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -97,93 +161,69 @@ func createTables() {
 	CREATE INDEX IF NOT EXISTS idx_item_history_name ON item_history(name COLLATE NOCASE);
 	`
 
-	_, err := DB.Exec(schema)
-	if err != nil {
-		log.Fatal("Failed to create tables:", err)
-	}
-
-	// Migration: Add updated_at column if it doesn't exist
-	runMigrations()
+	_, err := tx.Exec(schema)
+	return err
 }
 
-func runMigrations() {
+// migrateUpdatedAt adds updated_at to sections and items
+func migrateUpdatedAt(tx *sql.Tx) error {
 	// Check if updated_at column exists in sections
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info('sections') WHERE name='updated_at'").Scan(&count)
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('sections') WHERE name='updated_at'").Scan(&count)
 	if err != nil {
-		log.Println("Migration check failed:", err)
-		return
+		return err
 	}
 
 	if count == 0 {
 		log.Println("Running migration: Adding updated_at to sections...")
 		// SQLite doesn't support dynamic DEFAULT in ALTER TABLE, so add with NULL first
-		_, err := DB.Exec("ALTER TABLE sections ADD COLUMN updated_at INTEGER")
-		if err != nil {
-			log.Println("Migration failed for sections:", err)
-		} else {
-			// Set updated_at for existing rows
-			_, updateErr := DB.Exec("UPDATE sections SET updated_at = strftime('%s', 'now')")
-			if updateErr != nil {
-				log.Printf("WARNING: Migration UPDATE failed for sections: %v", updateErr)
-			}
-			log.Println("Migration completed: sections.updated_at added")
+		if _, err := tx.Exec("ALTER TABLE sections ADD COLUMN updated_at INTEGER"); err != nil {
+			return fmt.Errorf("adding updated_at to sections: %w", err)
 		}
+		// Set updated_at for existing rows
+		if _, err := tx.Exec("UPDATE sections SET updated_at = strftime('%s', 'now')"); err != nil {
+			return fmt.Errorf("setting sections.updated_at: %w", err)
+		}
+		log.Println("Migration completed: sections.updated_at added")
 	}
 
 	// Check if updated_at column exists in items
-	err = DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info('items') WHERE name='updated_at'").Scan(&count)
+	err = tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('items') WHERE name='updated_at'").Scan(&count)
 	if err != nil {
-		log.Println("Migration check failed:", err)
-		return
+		return err
 	}
 
 	if count == 0 {
 		log.Println("Running migration: Adding updated_at to items...")
 		// SQLite doesn't support dynamic DEFAULT in ALTER TABLE, so add with NULL first
-		_, err := DB.Exec("ALTER TABLE items ADD COLUMN updated_at INTEGER")
-		if err != nil {
-			log.Println("Migration failed for items:", err)
-		} else {
-			// Set updated_at for existing rows
-			_, updateErr := DB.Exec("UPDATE items SET updated_at = strftime('%s', 'now')")
-			if updateErr != nil {
-				log.Printf("WARNING: Migration UPDATE failed for items: %v", updateErr)
-			}
-			log.Println("Migration completed: items.updated_at added")
+		if _, err := tx.Exec("ALTER TABLE items ADD COLUMN updated_at INTEGER"); err != nil {
+			return fmt.Errorf("adding updated_at to items: %w", err)
+		}
+		// Set updated_at for existing rows
+		if _, err := tx.Exec("UPDATE items SET updated_at = strftime('%s', 'now')"); err != nil {
+			return fmt.Errorf("setting items.updated_at: %w", err)
 		}
+		log.Println("Migration completed: items.updated_at added")
 	}
-
-	// Migration: Multiple lists support
-	migrateToMultipleLists()
-
-	// Migration: Templates support
-	migrateTemplates()
-
-	// Migration: Add icon to lists
-	migrateListIcons()
-
-	// Migration: Add quantity to items
-	migrateItemQuantity()
+	return nil
 }
 
-func migrateToMultipleLists() {
+func migrateToMultipleLists(tx *sql.Tx) error {
 	// Check if lists table exists
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='lists'").Scan(&count)
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='lists'").Scan(&count)
 	if err != nil {
-		log.Println("Migration check failed:", err)
-		return
+		return err
 	}
 
 	if count > 0 {
-		return // Already migrated
+		return nil // Already migrated
 	}
 
 	log.Println("Running migration: Adding multiple lists support...")
 
 	// Create lists table
-	_, err = DB.Exec(`
+	_, err = tx.Exec(`
 		CREATE TABLE IF NOT EXISTS lists (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL,
@@ -196,43 +236,41 @@ func migrateToMultipleLists() {
 		CREATE INDEX IF NOT EXISTS idx_lists_active ON lists(is_active);
 	`)
 	if err != nil {
-		log.Println("Migration failed - creating lists table:", err)
-		return
+		return fmt.Errorf("creating lists table: %w", err)
 	}
 
 	// Add list_id column to sections
-	_, err = DB.Exec("ALTER TABLE sections ADD COLUMN list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE")
+	_, err = tx.Exec("ALTER TABLE sections ADD COLUMN list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE")
 	if err != nil {
-		log.Println("Migration failed - adding list_id to sections:", err)
-		return
+		return fmt.Errorf("adding list_id to sections: %w", err)
 	}
 
 	// Create index for list_id
-	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS idx_sections_list ON sections(list_id, sort_order)")
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS idx_sections_list ON sections(list_id, sort_order)")
 	if err != nil {
-		log.Println("Migration warning - creating sections list index:", err)
+		return fmt.Errorf("creating sections list index: %w", err)
 	}
 
 	log.Println("Migration completed: Multiple lists support added")
+	return nil
 }
 
-func migrateTemplates() {
+func migrateTemplates(tx *sql.Tx) error {
 	// Check if templates table exists
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='templates'").Scan(&count)
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='templates'").Scan(&count)
 	if err != nil {
-		log.Println("Migration check failed:", err)
-		return
+		return err
 	}
 
 	if count > 0 {
-		return // Already migrated
+		return nil // Already migrated
 	}
 
 	log.Println("Running migration: Adding templates support...")
 
 	// Create templates table
-	_, err = DB.Exec(`
+	_, err = tx.Exec(`
 		CREATE TABLE IF NOT EXISTS templates (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL,
@@ -244,12 +282,11 @@ func migrateTemplates() {
 		CREATE INDEX IF NOT EXISTS idx_templates_order ON templates(sort_order);
 	`)
 	if err != nil {
-		log.Println("Migration failed - creating templates table:", err)
-		return
+		return fmt.Errorf("creating templates table: %w", err)
 	}
 
 	// Create template_items table
-	_, err = DB.Exec(`
+	_, err = tx.Exec(`
 		CREATE TABLE IF NOT EXISTS template_items (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			template_id INTEGER NOT NULL,
@@ -263,63 +300,272 @@ func migrateTemplates() {
 		CREATE INDEX IF NOT EXISTS idx_template_items_template ON template_items(template_id, sort_order);
 	`)
 	if err != nil {
-		log.Println("Migration failed - creating template_items table:", err)
-		return
+		return fmt.Errorf("creating template_items table: %w", err)
 	}
 
 	log.Println("Migration completed: Templates support added")
+	return nil
 }
 
-func migrateListIcons() {
+func migrateListIcons(tx *sql.Tx) error {
 	// Check if icon column exists in lists
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info('lists') WHERE name='icon'").Scan(&count)
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('lists') WHERE name='icon'").Scan(&count)
 	if err != nil {
-		log.Println("Migration check failed:", err)
-		return
+		return err
 	}
 
 	if count > 0 {
-		return // Already migrated
+		return nil // Already migrated
 	}
 
 	log.Println("Running migration: Adding icon to lists...")
 
-	_, err = DB.Exec("ALTER TABLE lists ADD COLUMN icon TEXT DEFAULT '🛒'")
+	_, err = tx.Exec("ALTER TABLE lists ADD COLUMN icon TEXT DEFAULT '🛒'")
 	if err != nil {
-		log.Println("Migration failed - adding icon to lists:", err)
-		return
+		return fmt.Errorf("adding icon to lists: %w", err)
 	}
 
 	log.Println("Migration completed: List icons added")
+	return nil
 }
 
-func migrateItemQuantity() {
+func migrateItemQuantity(tx *sql.Tx) error {
 	// Check if quantity column exists in items
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info('items') WHERE name='quantity'").Scan(&count)
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('items') WHERE name='quantity'").Scan(&count)
 	if err != nil {
-		log.Println("Migration check failed:", err)
-		return
+		return err
 	}
 
 	if count > 0 {
-		return // Already migrated
+		return nil // Already migrated
 	}
 
 	log.Println("Running migration: Adding quantity to items...")
 
-	_, err = DB.Exec("ALTER TABLE items ADD COLUMN quantity INTEGER DEFAULT 0")
+	_, err = tx.Exec("ALTER TABLE items ADD COLUMN quantity INTEGER DEFAULT 0")
 	if err != nil {
-		log.Println("Migration failed - adding quantity to items:", err)
-		return
+		return fmt.Errorf("adding quantity to items: %w", err)
 	}
 
 	log.Println("Migration completed: Item quantity added")
+	return nil
+}
+
+func migrateAPITokens(tx *sql.Tx) error {
+	// Check if api_tokens table exists
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='api_tokens'").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil // Already migrated
+	}
+
+	log.Println("Running migration: Adding API tokens...")
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			scope TEXT NOT NULL,
+			list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_list ON api_tokens(list_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("creating api_tokens table: %w", err)
+	}
+
+	log.Println("Migration completed: API tokens added")
+	return nil
+}
+
+func migrateAPITokenExpiry(tx *sql.Tx) error {
+	// Check if expires_at column exists in api_tokens
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('api_tokens') WHERE name='expires_at'").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil // Already migrated
+	}
+
+	log.Println("Running migration: Adding expiry and rotation to API tokens...")
+
+	columns := []string{
+		"ALTER TABLE api_tokens ADD COLUMN expires_at INTEGER",
+		"ALTER TABLE api_tokens ADD COLUMN last_used_at INTEGER",
+		"ALTER TABLE api_tokens ADD COLUMN previous_hash TEXT",
+		"ALTER TABLE api_tokens ADD COLUMN previous_expires_at INTEGER",
+	}
+	for _, stmt := range columns {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("altering api_tokens: %w", err)
+		}
+	}
+
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS idx_api_tokens_previous ON api_tokens(previous_hash)")
+	if err != nil {
+		return fmt.Errorf("creating api_tokens index: %w", err)
+	}
+
+	log.Println("Migration completed: API token expiry added")
+	return nil
+}
+
+func migrateAuditLog(tx *sql.Tx) error {
+	// Check if audit_log table exists
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='audit_log'").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil // Already migrated
+	}
+
+	log.Println("Running migration: Adding audit log...")
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			action TEXT NOT NULL,
+			actor TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			details TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("creating audit_log table: %w", err)
+	}
+
+	log.Println("Migration completed: Audit log added")
+	return nil
+}
+
+func migrateSettings(tx *sql.Tx) error {
+	// Check if settings table exists
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='settings'").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil // Already migrated
+	}
+
+	log.Println("Running migration: Adding settings...")
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("creating settings table: %w", err)
+	}
+
+	log.Println("Migration completed: Settings added")
+	return nil
+}
+
+func migrateShares(tx *sql.Tx) error {
+	// Check if shares table exists
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='shares'").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil // Already migrated
+	}
+
+	log.Println("Running migration: Adding shares...")
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS shares (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_hash TEXT NOT NULL UNIQUE,
+			list_id INTEGER NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER,
+			revoked_at INTEGER,
+			hits INTEGER NOT NULL DEFAULT 0,
+			last_hit_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_shares_list ON shares(list_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("creating shares table: %w", err)
+	}
+
+	log.Println("Migration completed: Shares added")
+	return nil
+}
+
+func migrateItemCompletedAt(tx *sql.Tx) error {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info('items') WHERE name='completed_at'").Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil // Already migrated
+	}
+
+	log.Println("Running migration: Adding completed_at to items...")
+
+	_, err = tx.Exec("ALTER TABLE items ADD COLUMN completed_at INTEGER")
+	if err != nil {
+		return fmt.Errorf("adding completed_at to items: %w", err)
+	}
+
+	// Best guess for items completed before the column existed
+	_, err = tx.Exec("UPDATE items SET completed_at = COALESCE(updated_at, strftime('%s', 'now')) WHERE completed = TRUE")
+	if err != nil {
+		return fmt.Errorf("setting items.completed_at: %w", err)
+	}
+
+	log.Println("Migration completed: Item completed_at added")
+	return nil
+}
+
+// Ping runs a trivial query to check that the database answers
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	var one int
+	return DB.QueryRowContext(ctx, "SELECT 1").Scan(&one)
 }
 
 func Close() {
 	if DB != nil {
-		DB.Close()
+		closeDB()
+	}
+}
+
+// closeDB closes the read and write handles, the last connection to close checkpoints the WAL
+func closeDB() error {
+	writeErr := writeDB.Close()
+	if err := DB.Close(); err != nil {
+		return err
 	}
+	return writeErr
 }
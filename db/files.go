@@ -0,0 +1,37 @@
+package db
+
+import "path/filepath"
+
+// fileReferenceQueries select paths, relative to FilesDir, of files referenced by rows
+// Tables that store files on disk add their query here so cleanup keeps those files
+var fileReferenceQueries []string
+
+// FilesDir returns the directory for files managed by the application, next to the database
+func FilesDir() string {
+	return filepath.Join(filepath.Dir(Path()), "files")
+}
+
+// ReferencedFiles returns the set of paths, relative to FilesDir, referenced by any row
+func ReferencedFiles() (map[string]bool, error) {
+	refs := make(map[string]bool)
+	for _, query := range fileReferenceQueries {
+		rows, err := DB.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			refs[filepath.Clean(path)] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
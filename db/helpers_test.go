@@ -0,0 +1,28 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// setupTestDB opens a fresh migrated database in a temp directory for the test
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	Init()
+	t.Cleanup(Close)
+}
+
+// listNames returns the names of all lists
+func listNames(t *testing.T) []string {
+	t.Helper()
+	lists, err := GetAllLists()
+	if err != nil {
+		t.Fatalf("get lists: %v", err)
+	}
+	names := make([]string, 0, len(lists))
+	for _, l := range lists {
+		names = append(names, l.Name)
+	}
+	return names
+}
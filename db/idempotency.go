@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IdempotentResponse is a stored request made with an Idempotency-Key
+// Status is 0 while the first request is still being handled
+type IdempotentResponse struct {
+	RequestHash string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   int64
+}
+
+// Pending returns true if the first request with the key has not finished yet
+func (r *IdempotentResponse) Pending() bool {
+	return r.Status == 0
+}
+
+// ClaimIdempotencyKey reserves key within scope for a new request
+// It returns nil if the caller now owns the key, otherwise the existing entry.
+// Entries created before expiredBefore, and pending ones created before staleBefore, are replaced
+// since their request was either long ago or never finished
+func ClaimIdempotencyKey(scope, key, requestHash string, expiredBefore, staleBefore int64) (*IdempotentResponse, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE scope = ? AND key = ? AND (created_at < ? OR (status = 0 AND created_at < ?))
+	`, scope, key, expiredBefore, staleBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO idempotency_keys (scope, key, request_hash, created_at) VALUES (?, ?, ?, ?)
+	`, scope, key, requestHash, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 1 {
+		return nil, tx.Commit()
+	}
+
+	var r IdempotentResponse
+	err = tx.QueryRow(`
+		SELECT request_hash, status, content_type, COALESCE(body, X''), created_at
+		FROM idempotency_keys WHERE scope = ? AND key = ?
+	`, scope, key).Scan(&r.RequestHash, &r.Status, &r.ContentType, &r.Body, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed the key
+func CompleteIdempotencyKey(scope, key string, status int, contentType string, body []byte) error {
+	return WithRetry(func() error {
+		_, err := writeDB.Exec(`
+			UPDATE idempotency_keys SET status = ?, content_type = ?, body = ? WHERE scope = ? AND key = ?
+		`, status, contentType, body, scope, key)
+		return err
+	})
+}
+
+// ReleaseIdempotencyKey drops a pending key so the request can be retried
+func ReleaseIdempotencyKey(scope, key string) error {
+	return WithRetry(func() error {
+		_, err := writeDB.Exec("DELETE FROM idempotency_keys WHERE scope = ? AND key = ? AND status = 0", scope, key)
+		return err
+	})
+}
+
+// DeleteExpiredIdempotencyKeys removes entries created before the cutoff and returns how many were removed
+func DeleteExpiredIdempotencyKeys(before int64) (int64, error) {
+	var result sql.Result
+	err := WithRetry(func() error {
+		var err error
+		result, err = writeDB.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", before)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,386 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// importItemBatch is the number of rows per multi-row INSERT, 12 parameters each stays below SQLite's variable limit
+const importItemBatch = 80
+
+const importItemColumns = "(section_id, name, description, quantity, sort_order, completed, uncertain, completed_at, created_at, price_cents, currency, due_date)"
+
+const importItemValues = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// sqliteTimeFormat is the format of CURRENT_TIMESTAMP, which DATETIME columns default to
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// ImportItem is an item written by an ImportWriter, with its flags set on insert
+type ImportItem struct {
+	SectionID   int64
+	Name        string
+	Description string
+	Quantity    int
+	SortOrder   int
+	Completed   bool
+	Uncertain   bool
+	CreatedAt   time.Time // Zero for now
+	CompletedAt time.Time // Zero for now, if completed
+	PriceCents  *int64    // nil without a price
+	Currency    string
+	DueDate     string // YYYY-MM-DD, empty without one
+}
+
+// ImportWriter writes the items and history of an import within its transaction
+// Items are buffered and inserted importItemBatch rows at a time, statements are prepared once.
+// Call Close before committing, it writes what is still buffered
+type ImportWriter struct {
+	tx          *sql.Tx
+	items       []ImportItem
+	insertBatch *sql.Stmt
+	insertOne   *sql.Stmt
+	saveHistory *sql.Stmt
+	findHistory *sql.Stmt
+	updateFlags *sql.Stmt
+
+	// itemIDs and historyIDs are the items and history entries it created
+	itemIDs    []int64
+	historyIDs []int64
+
+	// sectionIDs maps ASCII-lowercased section names to the first section with that name, see GetSectionIDByNameTx
+	// nil until the first lookup and after sections were deleted
+	sectionIDs map[string]int64
+}
+
+// NewImportWriter returns a writer for tx
+func NewImportWriter(tx *sql.Tx) *ImportWriter {
+	return &ImportWriter{tx: tx, items: make([]ImportItem, 0, importItemBatch)}
+}
+
+// AddItem queues an item for insertion
+func (w *ImportWriter) AddItem(item ImportItem) error {
+	w.items = append(w.items, item)
+	if len(w.items) < importItemBatch {
+		return nil
+	}
+	return w.flush()
+}
+
+// flush inserts the buffered items, a full batch in one statement and a partial one row by row
+func (w *ImportWriter) flush() error {
+	if len(w.items) == 0 {
+		return nil
+	}
+	now := time.Now()
+
+	if len(w.items) == importItemBatch {
+		if w.insertBatch == nil {
+			values := strings.TrimSuffix(strings.Repeat(importItemValues+", ", importItemBatch), ", ")
+			stmt, err := w.tx.Prepare("INSERT INTO items " + importItemColumns + " VALUES " + values)
+			if err != nil {
+				return err
+			}
+			w.insertBatch = stmt
+		}
+		args := make([]any, 0, importItemBatch*12)
+		for _, item := range w.items {
+			args = append(args, importItemArgs(item, now)...)
+		}
+		w.items = w.items[:0]
+		result, err := w.insertBatch.Exec(args...)
+		if err != nil {
+			return err
+		}
+		// The rows of one statement get consecutive ids
+		last, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for id := last - importItemBatch + 1; id <= last; id++ {
+			w.itemIDs = append(w.itemIDs, id)
+		}
+		return nil
+	}
+
+	if w.insertOne == nil {
+		stmt, err := w.tx.Prepare("INSERT INTO items " + importItemColumns + " VALUES " + importItemValues)
+		if err != nil {
+			return err
+		}
+		w.insertOne = stmt
+	}
+	for _, item := range w.items {
+		result, err := w.insertOne.Exec(importItemArgs(item, now)...)
+		if err != nil {
+			w.items = w.items[:0]
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			w.items = w.items[:0]
+			return err
+		}
+		w.itemIDs = append(w.itemIDs, id)
+	}
+	w.items = w.items[:0]
+	return nil
+}
+
+func importItemArgs(item ImportItem, now time.Time) []any {
+	createdAt := item.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	var completedAt any
+	if item.Completed {
+		completedAt = now.Unix()
+		if !item.CompletedAt.IsZero() {
+			completedAt = item.CompletedAt.Unix()
+		}
+	}
+	return []any{item.SectionID, item.Name, item.Description, item.Quantity, item.SortOrder,
+		item.Completed, item.Uncertain, completedAt, createdAt.UTC().Format(sqliteTimeFormat), item.PriceCents, item.Currency, item.DueDate}
+}
+
+// SaveHistory records an item in the history with its usage count, like SaveItemHistoryWithCountTx
+// sectionName is resolved like GetSectionIDByNameTx, from a map loaded once instead of a query per row
+func (w *ImportWriter) SaveHistory(name, sectionName string, usageCount int) error {
+	sectionID, err := w.sectionID(sectionName)
+	if err != nil {
+		return err
+	}
+	if w.saveHistory == nil {
+		stmt, err := w.tx.Prepare(`
+			INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
+			VALUES (?, ?, ?, strftime('%s', 'now'))
+			ON CONFLICT(name COLLATE NOCASE) DO UPDATE SET
+				last_section_id = CASE WHEN excluded.last_section_id > 0 THEN excluded.last_section_id ELSE last_section_id END,
+				usage_count = CASE WHEN excluded.usage_count > usage_count THEN excluded.usage_count ELSE usage_count END,
+				last_used_at = strftime('%s', 'now')
+		`)
+		if err != nil {
+			return err
+		}
+		w.saveHistory = stmt
+	}
+	if w.findHistory == nil {
+		stmt, err := w.tx.Prepare("SELECT COUNT(*) FROM item_history WHERE name = ? COLLATE NOCASE")
+		if err != nil {
+			return err
+		}
+		w.findHistory = stmt
+	}
+	var existing int
+	if err := w.findHistory.QueryRow(name).Scan(&existing); err != nil {
+		return err
+	}
+	result, err := w.saveHistory.Exec(name, sectionID, usageCount)
+	if err != nil || existing > 0 {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	w.historyIDs = append(w.historyIDs, id)
+	return nil
+}
+
+// MergeHistory adds usageCount to the history entry of name, creating it if there is none, and reports whether it was created
+// The last section of an existing entry is only set when it has none or its section was deleted
+func (w *ImportWriter) MergeHistory(name, sectionName string, usageCount int) (bool, error) {
+	sectionID, err := w.sectionID(sectionName)
+	if err != nil {
+		return false, err
+	}
+	result, err := w.tx.Exec(`
+		UPDATE item_history SET
+			usage_count = usage_count + ?,
+			last_section_id = CASE
+				WHEN ? > 0 AND (COALESCE(last_section_id, 0) = 0 OR last_section_id NOT IN (SELECT id FROM sections)) THEN ?
+				ELSE last_section_id END
+		WHERE name = ? COLLATE NOCASE
+	`, usageCount, sectionID, sectionID, name)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return false, err
+	}
+	result, err = w.tx.Exec(`
+		INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
+		VALUES (?, ?, ?, strftime('%s', 'now'))
+	`, name, sectionID, usageCount)
+	if err != nil {
+		return false, err
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		w.historyIDs = append(w.historyIDs, id)
+	}
+	return true, nil
+}
+
+// UpdateItemFlags sets the completed and uncertain flags of an existing item, for imports merging into a list
+// completed_at is kept for items that stay completed
+func (w *ImportWriter) UpdateItemFlags(id int64, completed, uncertain bool) error {
+	if w.updateFlags == nil {
+		stmt, err := w.tx.Prepare(`
+			UPDATE items SET
+				completed = ?,
+				completed_at = CASE WHEN ? THEN COALESCE(completed_at, strftime('%s', 'now')) ELSE NULL END,
+				uncertain = ?,
+				updated_at = strftime('%s', 'now')
+			WHERE id = ?
+		`)
+		if err != nil {
+			return err
+		}
+		w.updateFlags = stmt
+	}
+	_, err := w.updateFlags.Exec(completed, completed, uncertain, id)
+	return err
+}
+
+// SetImportedItemFlagsTx sets the flags of an item an import wrote, like UpdateItemFlags after the writer is closed
+func SetImportedItemFlagsTx(tx *sql.Tx, id int64, completed, uncertain bool) error {
+	_, err := tx.Exec(`
+		UPDATE items SET
+			completed = ?,
+			completed_at = CASE WHEN ? THEN COALESCE(completed_at, strftime('%s', 'now')) ELSE NULL END,
+			uncertain = ?,
+			updated_at = strftime('%s', 'now')
+		WHERE id = ?
+	`, completed, completed, uncertain, id)
+	return err
+}
+
+// MergeSection is a section of an existing list that an import merges into
+type MergeSection struct {
+	ID        int64
+	Name      string
+	NextOrder int              // Sort order after its last item
+	Items     map[string]int64 // Lowercased item name -> id, the first item wins when names repeat
+}
+
+// LoadMergeSectionsTx returns the sections of a list by lowercased name with their items, and the sort order after
+// the last section. The first section wins when names repeat
+func LoadMergeSectionsTx(tx *sql.Tx, listID int64) (map[string]*MergeSection, int, error) {
+	rows, err := tx.Query(`
+		SELECT s.id, s.name, i.id, i.name, i.sort_order
+		FROM sections s
+		LEFT JOIN items i ON i.section_id = s.id AND i.deleted_at IS NULL
+		WHERE s.list_id = ?
+		ORDER BY s.sort_order, s.id, i.sort_order, i.id
+	`, listID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	sections := make(map[string]*MergeSection)
+	byID := make(map[int64]*MergeSection)
+	for rows.Next() {
+		var sectionID int64
+		var sectionName string
+		var itemID, itemOrder sql.NullInt64
+		var itemName sql.NullString
+		if err := rows.Scan(&sectionID, &sectionName, &itemID, &itemName, &itemOrder); err != nil {
+			return nil, 0, err
+		}
+
+		section := byID[sectionID]
+		if section == nil {
+			section = &MergeSection{ID: sectionID, Name: sectionName, Items: make(map[string]int64)}
+			byID[sectionID] = section
+			if _, ok := sections[strings.ToLower(sectionName)]; !ok {
+				sections[strings.ToLower(sectionName)] = section
+			}
+		}
+		if itemID.Valid {
+			if _, ok := section.Items[strings.ToLower(itemName.String)]; !ok {
+				section.Items[strings.ToLower(itemName.String)] = itemID.Int64
+			}
+			if int(itemOrder.Int64) >= section.NextOrder {
+				section.NextOrder = int(itemOrder.Int64) + 1
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return sections, GetMaxSectionOrderTx(tx, listID) + 1, nil
+}
+
+// SectionCreated adds a section created by the import to the name lookup
+func (w *ImportWriter) SectionCreated(section *Section) {
+	if w.sectionIDs == nil {
+		return
+	}
+	key := asciiLower(section.Name)
+	if _, ok := w.sectionIDs[key]; !ok {
+		w.sectionIDs[key] = section.ID
+	}
+}
+
+// SectionsDeleted drops the name lookup after lists were deleted, it is reloaded on the next lookup
+func (w *ImportWriter) SectionsDeleted() {
+	w.sectionIDs = nil
+}
+
+func (w *ImportWriter) sectionID(name string) (int64, error) {
+	if name == "" {
+		return 0, nil
+	}
+	if w.sectionIDs == nil {
+		rows, err := w.tx.Query("SELECT id, name FROM sections ORDER BY id")
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		w.sectionIDs = make(map[string]int64)
+		for rows.Next() {
+			var id int64
+			var sectionName string
+			if err := rows.Scan(&id, &sectionName); err != nil {
+				w.sectionIDs = nil
+				return 0, err
+			}
+			if _, ok := w.sectionIDs[asciiLower(sectionName)]; !ok {
+				w.sectionIDs[asciiLower(sectionName)] = id
+			}
+		}
+		if err := rows.Err(); err != nil {
+			w.sectionIDs = nil
+			return 0, err
+		}
+	}
+	return w.sectionIDs[asciiLower(name)], nil
+}
+
+// Created returns the ids of the items and history entries created so far, call it after Close for all of them
+func (w *ImportWriter) Created() (items, history []int64) {
+	return w.itemIDs, w.historyIDs
+}
+
+// Close writes the buffered items and releases the prepared statements
+func (w *ImportWriter) Close() error {
+	err := w.flush()
+	for _, stmt := range []*sql.Stmt{w.insertBatch, w.insertOne, w.saveHistory, w.findHistory, w.updateFlags} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	return err
+}
+
+// asciiLower folds case like SQLite's NOCASE collation, which only folds ASCII letters
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
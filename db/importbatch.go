@@ -0,0 +1,240 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Kinds of rows recorded for an import batch
+const (
+	ImportRowList         = "list"
+	ImportRowSection      = "section"
+	ImportRowItem         = "item"
+	ImportRowTemplate     = "template"
+	ImportRowTemplateItem = "template_item"
+	ImportRowHistory      = "history"
+)
+
+// Statuses of an import batch
+const (
+	ImportBatchRunning    = "running"
+	ImportBatchCompleted  = "completed"
+	ImportBatchFailed     = "failed" // Failed after some of its rows were committed
+	ImportBatchRolledBack = "rolled_back"
+)
+
+// importBatchRetention is the number of import batches kept, older ones are dropped when an import starts
+const importBatchRetention = 20
+
+// importRowTables maps row kinds to their table, in the order a rollback deletes them
+var importRowTables = []struct {
+	kind  string
+	table string
+}{
+	{ImportRowItem, "items"},
+	{ImportRowTemplateItem, "template_items"},
+	{ImportRowHistory, "item_history"},
+	{ImportRowSection, "sections"},
+	{ImportRowTemplate, "templates"},
+	{ImportRowList, "lists"},
+}
+
+// ImportBatch is a recorded import with the number of rows it created by kind
+type ImportBatch struct {
+	ID                 int64          `json:"id"`
+	Filename           string         `json:"filename"`
+	ConflictResolution string         `json:"conflict_resolution"`
+	Status             string         `json:"status"` // running, completed, failed or rolled_back
+	Created            map[string]int `json:"created"`
+	HasSnapshot        bool           `json:"has_snapshot"` // Whether it replaced lists or templates that a rollback restores
+	CreatedAt          int64          `json:"created_at"`
+	FinishedAt         int64          `json:"finished_at,omitempty"`
+	RolledBackAt       int64          `json:"rolled_back_at,omitempty"`
+
+	// Snapshot is the JSON of the lists and templates it replaced, only loaded by GetImportBatchTx
+	Snapshot string `json:"-"`
+}
+
+// CreateImportBatchTx records the start of an import and drops the batches past importBatchRetention
+func CreateImportBatchTx(tx *sql.Tx, filename, conflictResolution string) (int64, error) {
+	result, err := tx.Exec(`
+		INSERT INTO import_batches (filename, conflict_resolution, status, created_at) VALUES (?, ?, ?, ?)
+	`, filename, conflictResolution, ImportBatchRunning, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM import_batches WHERE id NOT IN (SELECT id FROM import_batches ORDER BY id DESC LIMIT ?)
+	`, importBatchRetention)
+	return id, err
+}
+
+// AddImportBatchRowsTx records rows of the given kind as created by an import
+func AddImportBatchRowsTx(tx *sql.Tx, batchID int64, kind string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare("INSERT INTO import_batch_rows (batch_id, kind, row_id) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		if _, err := stmt.Exec(batchID, kind, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetImportBatchSnapshotTx stores the JSON of the lists and templates an import replaced
+func SetImportBatchSnapshotTx(tx *sql.Tx, id int64, snapshot string) error {
+	_, err := tx.Exec("UPDATE import_batches SET snapshot = ? WHERE id = ?", snapshot, id)
+	return err
+}
+
+// FinishImportBatchTx sets the final status of an import
+func FinishImportBatchTx(tx *sql.Tx, id int64, status string) error {
+	_, err := tx.Exec("UPDATE import_batches SET status = ?, finished_at = ? WHERE id = ?", status, time.Now().Unix(), id)
+	return err
+}
+
+// FinishImportBatch sets the final status of an import outside its transactions, for imports that failed
+func FinishImportBatch(id int64, status string) error {
+	_, err := writeDB.Exec("UPDATE import_batches SET status = ?, finished_at = ? WHERE id = ?", status, time.Now().Unix(), id)
+	return err
+}
+
+// GetImportBatches returns the import batches kept, newest first
+func GetImportBatches() ([]ImportBatch, error) {
+	rows, err := DB.Query(`
+		SELECT b.id, b.filename, b.conflict_resolution, b.status, b.snapshot != '', b.created_at, b.finished_at, b.rolled_back_at,
+			COALESCE(r.kind, ''), COUNT(r.row_id)
+		FROM import_batches b
+		LEFT JOIN import_batch_rows r ON r.batch_id = b.id
+		GROUP BY b.id, r.kind
+		ORDER BY b.id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := []ImportBatch{}
+	for rows.Next() {
+		var b ImportBatch
+		var kind string
+		var count int
+		if err := rows.Scan(&b.ID, &b.Filename, &b.ConflictResolution, &b.Status, &b.HasSnapshot, &b.CreatedAt, &b.FinishedAt, &b.RolledBackAt, &kind, &count); err != nil {
+			return nil, err
+		}
+		if n := len(batches); n == 0 || batches[n-1].ID != b.ID {
+			b.Created = make(map[string]int)
+			batches = append(batches, b)
+		}
+		if kind != "" {
+			batches[len(batches)-1].Created[kind] = count
+		}
+	}
+	return batches, rows.Err()
+}
+
+// GetImportBatchTx returns an import batch with its snapshot, sql.ErrNoRows if there is none
+func GetImportBatchTx(tx *sql.Tx, id int64) (*ImportBatch, error) {
+	var b ImportBatch
+	err := tx.QueryRow(`
+		SELECT id, filename, conflict_resolution, status, snapshot, created_at, finished_at, rolled_back_at
+		FROM import_batches WHERE id = ?
+	`, id).Scan(&b.ID, &b.Filename, &b.ConflictResolution, &b.Status, &b.Snapshot, &b.CreatedAt, &b.FinishedAt, &b.RolledBackAt)
+	if err != nil {
+		return nil, err
+	}
+	b.HasSnapshot = b.Snapshot != ""
+
+	rows, err := tx.Query("SELECT kind, COUNT(*) FROM import_batch_rows WHERE batch_id = ? GROUP BY kind", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	b.Created = make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+		b.Created[kind] = count
+	}
+	return &b, rows.Err()
+}
+
+// ImportBatchChangesTx counts the rows changed since an import finished, by kind: rows it created that were
+// updated later and rows added to the lists, sections and templates it created. Lists themselves are not
+// compared, switching to a list updates it
+func ImportBatchChangesTx(tx *sql.Tx, batch *ImportBatch) (map[string]int, error) {
+	since := batch.FinishedAt
+	if since == 0 {
+		since = batch.CreatedAt
+	}
+	const created = "SELECT row_id FROM import_batch_rows WHERE batch_id = ? AND kind = ?"
+	checks := []struct {
+		kind  string
+		query string
+		args  []any
+	}{
+		{ImportRowItem, "SELECT COUNT(*) FROM items WHERE id IN (" + created + ") AND COALESCE(updated_at, 0) > ?",
+			[]any{batch.ID, ImportRowItem, since}},
+		{ImportRowItem, "SELECT COUNT(*) FROM items WHERE section_id IN (" + created + ") AND id NOT IN (" + created + ")",
+			[]any{batch.ID, ImportRowSection, batch.ID, ImportRowItem}},
+		{ImportRowSection, "SELECT COUNT(*) FROM sections WHERE id IN (" + created + ") AND COALESCE(updated_at, 0) > ?",
+			[]any{batch.ID, ImportRowSection, since}},
+		{ImportRowSection, "SELECT COUNT(*) FROM sections WHERE list_id IN (" + created + ") AND id NOT IN (" + created + ")",
+			[]any{batch.ID, ImportRowList, batch.ID, ImportRowSection}},
+		{ImportRowTemplate, "SELECT COUNT(*) FROM templates WHERE id IN (" + created + ") AND COALESCE(updated_at, 0) > ?",
+			[]any{batch.ID, ImportRowTemplate, since}},
+		{ImportRowTemplateItem, "SELECT COUNT(*) FROM template_items WHERE template_id IN (" + created + ") AND id NOT IN (" + created + ")",
+			[]any{batch.ID, ImportRowTemplate, batch.ID, ImportRowTemplateItem}},
+		{ImportRowHistory, "SELECT COUNT(*) FROM item_history WHERE id IN (" + created + ") AND COALESCE(last_used_at, 0) > ?",
+			[]any{batch.ID, ImportRowHistory, since}},
+	}
+
+	changes := make(map[string]int)
+	for _, check := range checks {
+		var count int
+		if err := tx.QueryRow(check.query, check.args...).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			changes[check.kind] += count
+		}
+	}
+	return changes, nil
+}
+
+// DeleteImportBatchRowsTx deletes the rows an import created and returns the number deleted by kind
+// Rows within deleted lists, sections and templates go with them and are not counted
+func DeleteImportBatchRowsTx(tx *sql.Tx, batchID int64) (map[string]int, error) {
+	deleted := make(map[string]int)
+	for _, t := range importRowTables {
+		result, err := tx.Exec(`
+			DELETE FROM `+t.table+` WHERE id IN (SELECT row_id FROM import_batch_rows WHERE batch_id = ? AND kind = ?)
+		`, batchID, t.kind)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			deleted[t.kind] = int(n)
+		}
+	}
+	return deleted, nil
+}
+
+// MarkImportBatchRolledBackTx records that an import was rolled back
+func MarkImportBatchRolledBackTx(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec("UPDATE import_batches SET status = ?, rolled_back_at = ? WHERE id = ?", ImportBatchRolledBack, time.Now().Unix(), id)
+	return err
+}
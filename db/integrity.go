@@ -0,0 +1,287 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Orphan categories reported by CheckIntegrity
+const (
+	OrphanSections      = "sections"
+	OrphanItems         = "items"
+	OrphanTemplateItems = "template_items"
+	OrphanHistory       = "history"
+)
+
+// Repair actions for orphans
+const (
+	RepairDelete = "delete"
+	RepairMove   = "move"
+	RepairDetach = "detach"
+)
+
+// RecoveryListName is the list orphaned sections and items are moved to
+const RecoveryListName = "Recovered"
+
+// maxOrphanSamples is how many orphan IDs are included per category
+const maxOrphanSamples = 20
+
+// orphanQueries select the IDs of rows whose parent no longer exists
+var orphanQueries = map[string]string{
+	OrphanSections:      "SELECT id FROM sections WHERE list_id IS NULL OR list_id NOT IN (SELECT id FROM lists)",
+	OrphanItems:         "SELECT id FROM items WHERE section_id NOT IN (SELECT id FROM sections)",
+	OrphanTemplateItems: "SELECT id FROM template_items WHERE template_id NOT IN (SELECT id FROM templates)",
+	OrphanHistory:       "SELECT id FROM item_history WHERE last_section_id > 0 AND last_section_id NOT IN (SELECT id FROM sections)",
+}
+
+// OrphanCategories lists the orphan categories in report and repair order
+var OrphanCategories = []string{OrphanSections, OrphanItems, OrphanTemplateItems, OrphanHistory}
+
+// repairActions lists the allowed repair actions per category, the first is the default
+var repairActions = map[string][]string{
+	OrphanSections:      {RepairDelete, RepairMove},
+	OrphanItems:         {RepairDelete, RepairMove},
+	OrphanTemplateItems: {RepairDelete},
+	OrphanHistory:       {RepairDelete, RepairDetach},
+}
+
+// OrphanReport describes the orphans found in one category
+type OrphanReport struct {
+	Category  string  `json:"category"`
+	Count     int     `json:"count"`
+	SampleIDs []int64 `json:"sample_ids"`
+}
+
+// IntegrityReport is the result of CheckIntegrity
+type IntegrityReport struct {
+	OK                   bool           `json:"ok"`
+	IntegrityCheck       []string       `json:"integrity_check"`
+	ForeignKeyViolations int            `json:"foreign_key_violations"`
+	ForeignKeyTables     []string       `json:"foreign_key_tables,omitempty"`
+	Orphans              []OrphanReport `json:"orphans"`
+	TotalOrphans         int            `json:"total_orphans"`
+}
+
+// RepairResult describes what was fixed in one category
+type RepairResult struct {
+	Category string `json:"category"`
+	Action   string `json:"action"`
+	Count    int    `json:"count"`
+}
+
+// ValidRepairActions returns the allowed actions for a category, nil if the category is unknown
+func ValidRepairActions(category string) []string {
+	return repairActions[category]
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// orphanIDs returns the IDs of all orphans in a category
+func orphanIDs(q querier, category string) ([]int64, error) {
+	rows, err := q.Query(orphanQueries[category])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CheckIntegrity runs SQLite's integrity and foreign key checks and looks for orphaned rows
+func CheckIntegrity() (*IntegrityReport, error) {
+	report := &IntegrityReport{IntegrityCheck: []string{}, Orphans: []OrphanReport{}}
+
+	rows, err := DB.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.IntegrityCheck = append(report.IntegrityCheck, msg)
+	}
+	rows.Close()
+
+	rows, err = DB.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var table, parent string
+		var rowid, fkid sql.NullInt64
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.ForeignKeyViolations++
+		if !seen[table] {
+			seen[table] = true
+			report.ForeignKeyTables = append(report.ForeignKeyTables, table)
+		}
+	}
+	rows.Close()
+
+	for _, category := range OrphanCategories {
+		ids, err := orphanIDs(DB, category)
+		if err != nil {
+			return nil, fmt.Errorf("orphan check %s: %w", category, err)
+		}
+		sample := ids
+		if len(sample) > maxOrphanSamples {
+			sample = sample[:maxOrphanSamples]
+		}
+		if sample == nil {
+			sample = []int64{}
+		}
+		report.Orphans = append(report.Orphans, OrphanReport{Category: category, Count: len(ids), SampleIDs: sample})
+		report.TotalOrphans += len(ids)
+	}
+
+	report.OK = len(report.IntegrityCheck) == 1 && report.IntegrityCheck[0] == "ok" &&
+		report.ForeignKeyViolations == 0 && report.TotalOrphans == 0
+	return report, nil
+}
+
+// RepairOrphans fixes orphans in one transaction using the given action per category
+// Categories missing from actions use their default action
+func RepairOrphans(actions map[string]string) ([]RepairResult, error) {
+	for category, action := range actions {
+		allowed, ok := repairActions[category]
+		if !ok {
+			return nil, fmt.Errorf("unknown category: %s", category)
+		}
+		if !containsString(allowed, action) {
+			return nil, fmt.Errorf("invalid action %s for %s", action, category)
+		}
+	}
+
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var recoveryListID int64
+	recoveryList := func() (int64, error) {
+		if recoveryListID > 0 {
+			return recoveryListID, nil
+		}
+		list, err := CreateListTx(tx, RecoveryListName, "🩹")
+		if err != nil {
+			return 0, err
+		}
+		recoveryListID = list.ID
+		return recoveryListID, nil
+	}
+
+	results := make([]RepairResult, 0, len(OrphanCategories))
+	// Sections go first so items moved with them are no longer orphaned
+	for _, category := range OrphanCategories {
+		action, ok := actions[category]
+		if !ok {
+			action = repairActions[category][0]
+		}
+
+		ids, err := orphanIDs(tx, category)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			results = append(results, RepairResult{Category: category, Action: action})
+			continue
+		}
+
+		for _, id := range ids {
+			if err := repairOrphan(tx, category, action, id, recoveryList); err != nil {
+				return nil, fmt.Errorf("repair %s %d: %w", category, id, err)
+			}
+		}
+		results = append(results, RepairResult{Category: category, Action: action, Count: len(ids)})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// repairOrphan fixes a single orphaned row
+func repairOrphan(tx *sql.Tx, category, action string, id int64, recoveryList func() (int64, error)) error {
+	var err error
+	switch category + "/" + action {
+	case OrphanSections + "/" + RepairDelete:
+		if _, err = tx.Exec("DELETE FROM items WHERE section_id = ?", id); err == nil {
+			_, err = tx.Exec("DELETE FROM sections WHERE id = ?", id)
+		}
+	case OrphanSections + "/" + RepairMove:
+		var listID int64
+		if listID, err = recoveryList(); err == nil {
+			_, err = tx.Exec("UPDATE sections SET list_id = ?, updated_at = strftime('%s', 'now') WHERE id = ?", listID, id)
+		}
+	case OrphanItems + "/" + RepairDelete:
+		_, err = tx.Exec("DELETE FROM items WHERE id = ?", id)
+	case OrphanItems + "/" + RepairMove:
+		var sectionID int64
+		if sectionID, err = recoverySection(tx, recoveryList); err == nil {
+			_, err = tx.Exec(`
+				UPDATE items SET section_id = ?, sort_order = (SELECT COALESCE(MAX(sort_order), -1) + 1 FROM items WHERE section_id = ? AND deleted_at IS NULL),
+				updated_at = strftime('%s', 'now') WHERE id = ?
+			`, sectionID, sectionID, id)
+		}
+	case OrphanTemplateItems + "/" + RepairDelete:
+		_, err = tx.Exec("DELETE FROM template_items WHERE id = ?", id)
+	case OrphanHistory + "/" + RepairDelete:
+		_, err = tx.Exec("DELETE FROM item_history WHERE id = ?", id)
+	case OrphanHistory + "/" + RepairDetach:
+		_, err = tx.Exec("UPDATE item_history SET last_section_id = NULL WHERE id = ?", id)
+	default:
+		err = fmt.Errorf("unsupported action %s", action)
+	}
+	return err
+}
+
+// recoverySection returns the section in the recovery list that receives orphaned items
+func recoverySection(tx *sql.Tx, recoveryList func() (int64, error)) (int64, error) {
+	listID, err := recoveryList()
+	if err != nil {
+		return 0, err
+	}
+
+	var sectionID int64
+	err = tx.QueryRow("SELECT id FROM sections WHERE list_id = ? AND name = ?", listID, RecoveryListName).Scan(&sectionID)
+	if err == nil {
+		return sectionID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	section, err := CreateSectionForListTx(tx, listID, RecoveryListName, GetMaxSectionOrderTx(tx, listID)+1)
+	if err != nil {
+		return 0, err
+	}
+	return section.ID, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// orphanFixture holds the IDs of the rows seeded by seedOrphans
+type orphanFixture struct {
+	list, section, item                     int64
+	orphanSection, itemInOrphanSection      int64
+	orphanItem, orphanTemplateItem, history int64
+}
+
+// seedOrphans creates a healthy list next to one orphan of every category
+// Foreign keys are switched off on the connection the orphans are written with, as a crash would leave them
+func seedOrphans(t *testing.T) orphanFixture {
+	t.Helper()
+	list, err := CreateList("Groceries", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, err := CreateSectionForList(list.ID, "Food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := CreateItem(section.ID, "Milk", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stmts := []string{
+		"PRAGMA foreign_keys = OFF",
+		"INSERT INTO sections (id, list_id, name, sort_order) VALUES (9001, 999, 'Lost section', 0)",
+		"INSERT INTO items (id, section_id, name, sort_order) VALUES (9101, 9001, 'Bread', 0)",
+		"INSERT INTO items (id, section_id, name, sort_order) VALUES (9102, 998, 'Eggs', 0)",
+		"INSERT INTO template_items (id, template_id, section_name, name, sort_order) VALUES (9201, 997, 'Food', 'Butter', 0)",
+		"INSERT INTO item_history (id, name, last_section_id) VALUES (9301, 'Cheese', 996)",
+		"PRAGMA foreign_keys = ON",
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return orphanFixture{
+		list: list.ID, section: section.ID, item: item.ID,
+		orphanSection: 9001, itemInOrphanSection: 9101,
+		orphanItem: 9102, orphanTemplateItem: 9201, history: 9301,
+	}
+}
+
+// rowExists reports whether table has a row with the given id
+func rowExists(t *testing.T, table string, id int64) bool {
+	t.Helper()
+	var n int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id = ?", id).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+// assertIntact fails unless the healthy rows of f survived and the database reports no orphans
+func assertIntact(t *testing.T, f orphanFixture) {
+	t.Helper()
+	if item, err := GetItemByID(f.item); err != nil || item.SectionID != f.section {
+		t.Errorf("healthy item = %+v, %v, want it untouched", item, err)
+	}
+	report, err := CheckIntegrity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || report.TotalOrphans != 0 || report.ForeignKeyViolations != 0 {
+		t.Errorf("report after repair = %+v, want ok", report)
+	}
+}
+
+func TestCheckIntegrityReportsSeededOrphans(t *testing.T) {
+	setupTestDB(t)
+
+	report, err := CheckIntegrity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || report.TotalOrphans != 0 {
+		t.Fatalf("report on a fresh database = %+v, want ok", report)
+	}
+
+	f := seedOrphans(t)
+	if report, err = CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || !reflect.DeepEqual(report.IntegrityCheck, []string{"ok"}) {
+		t.Errorf("report = %+v, want not ok with a passing integrity_check", report)
+	}
+	// The lost section, the item without a section and the template item break foreign keys, the history row has none
+	tables := append([]string(nil), report.ForeignKeyTables...)
+	sort.Strings(tables)
+	if report.ForeignKeyViolations != 3 || !reflect.DeepEqual(tables, []string{"items", "sections", "template_items"}) {
+		t.Errorf("foreign key check = %d in %v, want 3 in sections, items and template_items", report.ForeignKeyViolations, report.ForeignKeyTables)
+	}
+	want := []OrphanReport{
+		{Category: OrphanSections, Count: 1, SampleIDs: []int64{f.orphanSection}},
+		{Category: OrphanItems, Count: 1, SampleIDs: []int64{f.orphanItem}},
+		{Category: OrphanTemplateItems, Count: 1, SampleIDs: []int64{f.orphanTemplateItem}},
+		{Category: OrphanHistory, Count: 1, SampleIDs: []int64{f.history}},
+	}
+	if !reflect.DeepEqual(report.Orphans, want) || report.TotalOrphans != 4 {
+		t.Errorf("orphans = %+v (%d), want %+v", report.Orphans, report.TotalOrphans, want)
+	}
+}
+
+func TestCheckIntegritySamplesAreCapped(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	for i := 0; i < maxOrphanSamples+5; i++ {
+		if _, err := conn.ExecContext(ctx, "INSERT INTO items (section_id, name, sort_order) VALUES (998, 'Lost', ?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	conn.Close()
+
+	report, err := CheckIntegrity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := report.Orphans[1]
+	if items.Category != OrphanItems || items.Count != maxOrphanSamples+5 || len(items.SampleIDs) != maxOrphanSamples {
+		t.Errorf("item orphans = %d with %d samples, want %d with %d", items.Count, len(items.SampleIDs), maxOrphanSamples+5, maxOrphanSamples)
+	}
+}
+
+func TestRepairOrphansDelete(t *testing.T) {
+	setupTestDB(t)
+	f := seedOrphans(t)
+
+	results, err := RepairOrphans(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RepairResult{
+		{Category: OrphanSections, Action: RepairDelete, Count: 1},
+		{Category: OrphanItems, Action: RepairDelete, Count: 1},
+		{Category: OrphanTemplateItems, Action: RepairDelete, Count: 1},
+		{Category: OrphanHistory, Action: RepairDelete, Count: 1},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	for table, id := range map[string]int64{
+		"sections": f.orphanSection, "template_items": f.orphanTemplateItem, "item_history": f.history,
+	} {
+		if rowExists(t, table, id) {
+			t.Errorf("%s %d was kept, want it deleted", table, id)
+		}
+	}
+	// A deleted section takes its items along
+	for _, id := range []int64{f.itemInOrphanSection, f.orphanItem} {
+		if rowExists(t, "items", id) {
+			t.Errorf("item %d was kept, want it deleted", id)
+		}
+	}
+	if names := listNames(t); !reflect.DeepEqual(names, []string{"Groceries"}) {
+		t.Errorf("lists = %v, want no recovery list", names)
+	}
+	assertIntact(t, f)
+}
+
+func TestRepairOrphansMoveAndDetach(t *testing.T) {
+	setupTestDB(t)
+	f := seedOrphans(t)
+
+	results, err := RepairOrphans(map[string]string{
+		OrphanSections: RepairMove,
+		OrphanItems:    RepairMove,
+		OrphanHistory:  RepairDetach,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Action != RepairMove || results[1].Action != RepairMove || results[2].Action != RepairDelete || results[3].Action != RepairDetach {
+		t.Errorf("results = %+v, want move, move, delete and detach", results)
+	}
+
+	// Both moves share one recovery list, the section keeps its item, the lost item gets a recovery section
+	var recoveryID int64
+	if err := DB.QueryRow("SELECT id FROM lists WHERE name = ?", RecoveryListName).Scan(&recoveryID); err != nil {
+		t.Fatalf("recovery list: %v", err)
+	}
+	if names := listNames(t); len(names) != 2 {
+		t.Errorf("lists = %v, want Groceries and one recovery list", names)
+	}
+	var sectionList int64
+	DB.QueryRow("SELECT list_id FROM sections WHERE id = ?", f.orphanSection).Scan(&sectionList)
+	if sectionList != recoveryID {
+		t.Errorf("lost section is in list %d, want the recovery list %d", sectionList, recoveryID)
+	}
+	if item, err := GetItemByID(f.itemInOrphanSection); err != nil || item.SectionID != f.orphanSection {
+		t.Errorf("item of the lost section = %+v, %v, want it kept in its section", item, err)
+	}
+	item, err := GetItemByID(f.orphanItem)
+	if err != nil {
+		t.Fatalf("lost item: %v", err)
+	}
+	var itemList int64
+	var sectionName string
+	DB.QueryRow("SELECT list_id, name FROM sections WHERE id = ?", item.SectionID).Scan(&itemList, &sectionName)
+	if itemList != recoveryID || sectionName != RecoveryListName {
+		t.Errorf("lost item is in section %q of list %d, want %q of the recovery list", sectionName, itemList, RecoveryListName)
+	}
+
+	var lastSection *int64
+	if err := DB.QueryRow("SELECT last_section_id FROM item_history WHERE id = ?", f.history).Scan(&lastSection); err != nil || lastSection != nil {
+		t.Errorf("history row last_section_id = %v, %v, want it kept and detached", lastSection, err)
+	}
+	if rowExists(t, "template_items", f.orphanTemplateItem) {
+		t.Error("orphaned template item was kept, want it deleted")
+	}
+	assertIntact(t, f)
+}
+
+func TestRepairOrphansRejectsInvalidActions(t *testing.T) {
+	setupTestDB(t)
+	f := seedOrphans(t)
+
+	for _, actions := range []map[string]string{
+		{"lists": RepairDelete},
+		{OrphanTemplateItems: RepairMove},
+		{OrphanSections: RepairDetach},
+	} {
+		if _, err := RepairOrphans(actions); err == nil {
+			t.Errorf("RepairOrphans(%v) succeeded, want an error", actions)
+		}
+	}
+	report, err := CheckIntegrity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalOrphans != 4 || !rowExists(t, "sections", f.orphanSection) {
+		t.Errorf("rejected repairs changed the database: %d orphans left", report.TotalOrphans)
+	}
+}
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Actions of item events
+const (
+	ItemEventCreate  = "create"
+	ItemEventUpdate  = "update"
+	ItemEventToggle  = "toggle"
+	ItemEventMove    = "move"
+	ItemEventDelete  = "delete"
+	ItemEventRestore = "restore"
+)
+
+// ItemChange is a field of an item before and after an event, nil before a create and after a delete
+type ItemChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// ItemEvent is a recorded change of an item
+type ItemEvent struct {
+	ID        int64                 `json:"id"`
+	ItemID    int64                 `json:"item_id"`
+	ListID    int64                 `json:"list_id"`
+	ItemName  string                `json:"item_name"` // Name after the event, before it for deletes
+	Action    string                `json:"action"`
+	Changes   map[string]ItemChange `json:"changes"`
+	Actor     string                `json:"actor,omitempty"`      // Display name the client sent, else the token name or proxy user
+	TokenName string                `json:"token_name,omitempty"` // API token of the request, also when a display name was sent
+	CreatedAt int64                 `json:"created_at"`
+}
+
+// ItemChanges returns the fields that differ between two states of an item, before is nil for
+// creates and after for deletes, where every field that is set counts as changed
+func ItemChanges(before, after *Item) map[string]ItemChange {
+	changes := map[string]ItemChange{}
+	for _, f := range itemEventFields {
+		var oldValue, newValue any
+		if before != nil {
+			oldValue = f.value(before)
+		}
+		if after != nil {
+			newValue = f.value(after)
+		}
+		if before == nil && isZeroChange(newValue) || after == nil && isZeroChange(oldValue) {
+			continue
+		}
+		if oldValue != newValue {
+			changes[f.name] = ItemChange{Old: oldValue, New: newValue}
+		}
+	}
+	return changes
+}
+
+// itemEventFields are the fields of items whose changes are recorded
+var itemEventFields = []struct {
+	name  string
+	value func(*Item) any
+}{
+	{"name", func(i *Item) any { return i.Name }},
+	{"description", func(i *Item) any { return i.Description }},
+	{"quantity", func(i *Item) any { return i.Quantity }},
+	{"completed", func(i *Item) any { return i.Completed }},
+	{"uncertain", func(i *Item) any { return i.Uncertain }},
+	{"section_id", func(i *Item) any { return i.SectionID }},
+	{"price_cents", func(i *Item) any {
+		if i.PriceCents == nil {
+			return nil
+		}
+		return *i.PriceCents
+	}},
+	{"currency", func(i *Item) any { return i.Currency }},
+	{"due_date", func(i *Item) any { return i.DueDate }},
+	{"has_photo", func(i *Item) any { return i.HasPhoto }},
+	{"barcode", func(i *Item) any { return i.Barcode }},
+}
+
+// isZeroChange reports whether a field value is unset, such fields are left out of creates and deletes
+func isZeroChange(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case int:
+		return v == 0
+	case bool:
+		return !v
+	}
+	return false
+}
+
+// AddItemEvent records an event, its ID and CreatedAt are set
+func AddItemEvent(e *ItemEvent) error {
+	tx, err := BeginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := AddItemEventTx(tx, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddItemEventTx records an event within a transaction, like AddItemEvent
+func AddItemEventTx(tx *sql.Tx, e *ItemEvent) error {
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	e.CreatedAt = time.Now().Unix()
+	res, err := tx.Exec(`
+		INSERT INTO item_events (item_id, list_id, item_name, action, changes, actor, token_name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ItemID, e.ListID, e.ItemName, e.Action, changes, e.Actor, e.TokenName, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// DeleteItemWithEvent moves an item to the trash and records the event of it in one transaction
+// The event is only recorded when the delete succeeds, sql.ErrNoRows when the item is gone or already deleted
+func DeleteItemWithEvent(id int64, e *ItemEvent) error {
+	tx, err := BeginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(trashItemSQL, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if e != nil {
+		if err := AddItemEventTx(tx, e); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetItemEvents returns a page of the events of an item, newest first, and the number of all of them
+func GetItemEvents(itemID int64, limit, offset int) ([]ItemEvent, int, error) {
+	return queryItemEvents("item_id", itemID, limit, offset)
+}
+
+// GetListActivity returns a page of the events of the items of a list, newest first, and the number of all of them
+// Items moved to another list show up in the activity of the list they went to
+func GetListActivity(listID int64, limit, offset int) ([]ItemEvent, int, error) {
+	return queryItemEvents("list_id", listID, limit, offset)
+}
+
+// ItemEventListID returns the list of the latest event of an item, sql.ErrNoRows without events
+// It tells which list a deleted item belonged to
+func ItemEventListID(itemID int64) (int64, error) {
+	var listID int64
+	err := DB.QueryRow("SELECT list_id FROM item_events WHERE item_id = ? ORDER BY id DESC LIMIT 1", itemID).Scan(&listID)
+	return listID, err
+}
+
+// queryItemEvents pages the events whose column equals id, column is item_id or list_id
+func queryItemEvents(column string, id int64, limit, offset int) ([]ItemEvent, int, error) {
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM item_events WHERE "+column+" = ?", id).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := DB.Query(`
+		SELECT id, item_id, list_id, item_name, action, changes, actor, token_name, created_at
+		FROM item_events
+		WHERE `+column+` = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, id, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []ItemEvent{}
+	for rows.Next() {
+		var e ItemEvent
+		var changes string
+		if err := rows.Scan(&e.ID, &e.ItemID, &e.ListID, &e.ItemName, &e.Action, &changes, &e.Actor, &e.TokenName, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, e)
+	}
+	return events, total, rows.Err()
+}
+
+// DeleteItemEventsBefore removes events recorded before cutoff, a Unix time, and returns how many
+func DeleteItemEventsBefore(cutoff int64) (int64, error) {
+	res, err := writeDB.Exec("DELETE FROM item_events WHERE created_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// How an item matched a search, best first
+const (
+	ItemMatchExact       = "exact"
+	ItemMatchPrefix      = "prefix"
+	ItemMatchSubstring   = "substring"
+	ItemMatchDescription = "description"
+)
+
+var itemMatchRanks = map[string]int{ItemMatchExact: 0, ItemMatchPrefix: 1, ItemMatchSubstring: 2, ItemMatchDescription: 3}
+
+// ItemSearchOptions narrows SearchItems to one list and to completed or open items
+type ItemSearchOptions struct {
+	Query     string
+	ListID    int64 // 0 searches every list
+	Completed *bool // nil matches both
+	Limit     int
+	Offset    int
+}
+
+// ItemSearchMatch is a matching item with its section and list
+type ItemSearchMatch struct {
+	Item        Item   `json:"item"`
+	Match       string `json:"match"` // exact, prefix or substring of the name, or description
+	SectionName string `json:"section_name"`
+	ListID      int64  `json:"list_id"`
+	ListName    string `json:"list_name"`
+	ListIcon    string `json:"list_icon"`
+}
+
+// ItemSearchListCount is the number of matches in one list
+type ItemSearchListCount struct {
+	ListID   int64  `json:"list_id"`
+	ListName string `json:"list_name"`
+	ListIcon string `json:"list_icon"`
+	Count    int    `json:"count"`
+}
+
+// ItemSearchResults is one page of matches, with the counts of all of them
+type ItemSearchResults struct {
+	Query   string                `json:"query"`
+	Total   int                   `json:"total"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+	Lists   []ItemSearchListCount `json:"lists"`
+	Results []ItemSearchMatch     `json:"results"`
+}
+
+// SearchItems finds items whose name or description contains the query, ignoring case and diacritics,
+// so "creme" finds "Crème fraîche". Exact names rank first, then names starting with the query, then
+// other name matches and last description matches, each in the order of lists, sections and items.
+// Unlike Search it matches any part of a word and only items
+func SearchItems(opts ItemSearchOptions) (*ItemSearchResults, error) {
+	results := &ItemSearchResults{Query: opts.Query, Limit: opts.Limit, Offset: opts.Offset,
+		Lists: []ItemSearchListCount{}, Results: []ItemSearchMatch{}}
+	needle := foldSearchText(strings.Join(strings.Fields(opts.Query), " "))
+	if needle == "" {
+		return results, nil
+	}
+
+	query := `
+		SELECT i.id, i.name, i.description, s.name, l.id, l.name, l.icon
+		FROM items i
+		JOIN sections s ON s.id = i.section_id
+		JOIN lists l ON l.id = s.list_id
+		WHERE (? = 0 OR l.id = ?) AND i.deleted_at IS NULL`
+	args := []any{opts.ListID, opts.ListID}
+	if opts.Completed != nil {
+		query += " AND i.completed = ?"
+		args = append(args, *opts.Completed)
+	}
+	rows, err := DB.Query(query+" ORDER BY l.sort_order ASC, l.id ASC, s.sort_order ASC, s.id ASC, i.sort_order ASC, i.id ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []ItemSearchMatch
+	counts := map[int64]int{}
+	for rows.Next() {
+		var m ItemSearchMatch
+		var name, description string
+		if err := rows.Scan(&m.Item.ID, &name, &description, &m.SectionName, &m.ListID, &m.ListName, &m.ListIcon); err != nil {
+			return nil, err
+		}
+		if m.Match = itemMatch(needle, name, description); m.Match == "" {
+			continue
+		}
+		if counts[m.ListID] == 0 {
+			results.Lists = append(results.Lists, ItemSearchListCount{ListID: m.ListID, ListName: m.ListName, ListIcon: m.ListIcon})
+		}
+		counts[m.ListID]++
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range results.Lists {
+		results.Lists[i].Count = counts[results.Lists[i].ListID]
+	}
+	results.Total = len(matches)
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return itemMatchRanks[matches[i].Match] < itemMatchRanks[matches[j].Match]
+	})
+	if opts.Offset >= len(matches) {
+		return results, nil
+	}
+	matches = matches[opts.Offset:]
+	if len(matches) > opts.Limit {
+		matches = matches[:opts.Limit]
+	}
+	for _, m := range matches {
+		item, err := GetItemByID(m.Item.ID)
+		if err != nil {
+			return nil, err
+		}
+		m.Item = *item
+		results.Results = append(results.Results, m)
+	}
+	return results, nil
+}
+
+// itemMatch returns how the folded needle matches an item, empty when it does not
+func itemMatch(needle, name, description string) string {
+	name = foldSearchText(name)
+	switch {
+	case name == needle:
+		return ItemMatchExact
+	case strings.HasPrefix(name, needle):
+		return ItemMatchPrefix
+	case strings.Contains(name, needle):
+		return ItemMatchSubstring
+	case strings.Contains(foldSearchText(description), needle):
+		return ItemMatchDescription
+	}
+	return ""
+}
+
+// searchFolds maps letters with diacritics to the letters they are searched as, beyond lower-casing
+var searchFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ą': "a", 'ā': "a", 'ă': "a", 'æ': "ae",
+	'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ę': "e", 'ė': "e", 'ē': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'į': "i", 'ī': "i", 'ı': "i",
+	'ĺ': "l", 'ľ': "l", 'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ő': "o", 'œ': "oe",
+	'ŕ': "r", 'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ų': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+	'ά': "α", 'έ': "ε", 'ή': "η", 'ί': "ι", 'ϊ': "ι", 'ΐ': "ι", 'ό': "ο", 'ύ': "υ", 'ϋ': "υ", 'ΰ': "υ", 'ώ': "ω", 'ς': "σ",
+}
+
+// foldSearchText lower-cases s and drops the diacritics of searchFolds, combining marks included
+func foldSearchText(s string) string {
+	ascii := true
+	for i := 0; i < len(s) && ascii; i++ {
+		ascii = s[i] < utf8.RuneSelf
+	}
+	if ascii {
+		return asciiLower(s)
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if fold, ok := searchFolds[r]; ok {
+			b.WriteString(fold)
+		} else if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
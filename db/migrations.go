@@ -0,0 +1,388 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Migration is a versioned schema or data change
+// Migrations run in ID order, each in its own transaction, and are recorded in schema_migrations
+type Migration struct {
+	ID   int
+	Name string
+	Up   func(tx *sql.Tx) error
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt int64  `json:"applied_at,omitempty"`
+}
+
+// migrations lists every migration in order, IDs must never be reused or reordered
+var migrations = []Migration{
+	{ID: 0, Name: "baseline", Up: migrateBaseline},
+	{ID: 1, Name: "idempotency_keys", Up: migrateIdempotencyKeys},
+	{ID: 2, Name: "audit_log_request_id", Up: migrateAuditLogRequestID},
+	{ID: 3, Name: "import_batches", Up: migrateImportBatches},
+	{ID: 4, Name: "item_prices", Up: migrateItemPrices},
+	{ID: 5, Name: "item_due_dates", Up: migrateItemDueDates},
+	{ID: 6, Name: "history_completions", Up: migrateHistoryCompletions},
+	{ID: 7, Name: "item_photos", Up: migrateItemPhotos},
+	{ID: 8, Name: "item_events", Up: migrateItemEvents},
+	{ID: 9, Name: "item_trash", Up: migrateItemTrash},
+	{ID: 10, Name: "item_barcodes", Up: migrateItemBarcodes},
+	{ID: 11, Name: "list_archived", Up: migrateListArchived},
+	{ID: 12, Name: "backup_records", Up: migrateBackupRecords},
+}
+
+// migrateBaseline creates the schema as it was before versioned migrations
+// Every step checks the current schema first, so it also upgrades databases from any earlier release
+func migrateBaseline(tx *sql.Tx) error {
+	steps := []func(*sql.Tx) error{
+		createBaseSchema,
+		migrateUpdatedAt,
+		migrateToMultipleLists,
+		migrateTemplates,
+		migrateListIcons,
+		migrateItemQuantity,
+		migrateAPITokens,
+		migrateAPITokenExpiry,
+		migrateAuditLog,
+		migrateSettings,
+		migrateShares,
+		migrateItemCompletedAt,
+	}
+	for _, step := range steps {
+		if err := step(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateIdempotencyKeys adds the table storing responses of requests sent with an Idempotency-Key
+func migrateIdempotencyKeys(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			scope TEXT NOT NULL,
+			key TEXT NOT NULL,
+			request_hash TEXT NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			body BLOB,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (scope, key)
+		);
+		CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys(created_at);
+	`)
+	return err
+}
+
+// migrateAuditLogRequestID ties audit log rows to the request log through the request ID
+func migrateAuditLogRequestID(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE audit_log ADD COLUMN request_id TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// migrateImportBatches adds the tables recording what each import created, so it can be rolled back
+func migrateImportBatches(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS import_batches (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			filename TEXT NOT NULL DEFAULT '',
+			conflict_resolution TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'running',
+			snapshot TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			finished_at INTEGER NOT NULL DEFAULT 0,
+			rolled_back_at INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS import_batch_rows (
+			batch_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			row_id INTEGER NOT NULL,
+			FOREIGN KEY (batch_id) REFERENCES import_batches(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_import_batch_rows_batch ON import_batch_rows(batch_id, kind);
+	`)
+	return err
+}
+
+// migrateItemPrices adds the optional price of items, in cents, and its currency
+func migrateItemPrices(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE items ADD COLUMN price_cents INTEGER;
+		ALTER TABLE items ADD COLUMN currency TEXT NOT NULL DEFAULT '';
+	`)
+	return err
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func ensureMigrationsTable() error {
+	_, err := writeDB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at INTEGER NOT NULL
+		)
+	`)
+	return err
+}
+
+// appliedMigrations returns the applied migration IDs with their timestamps
+func appliedMigrations() (map[int]int64, error) {
+	rows, err := DB.Query("SELECT id, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var id int
+		var appliedAt int64
+		if err := rows.Scan(&id, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[id] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies all pending migrations in order
+// A failing migration is rolled back completely and stops the chain
+func Migrate() error {
+	if err := ensureMigrationsTable(); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.ID]; ok {
+			continue
+		}
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.ID, m.Name, err)
+		}
+		log.Printf("Migration %d (%s) applied", m.ID, m.Name)
+	}
+	return nil
+}
+
+// applyMigration runs a single migration and records it in the same transaction
+func applyMigration(m Migration) error {
+	tx, err := BeginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (id, name, applied_at) VALUES (?, ?, ?)",
+		m.ID, m.Name, time.Now().Unix(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMigrationStatus lists every known migration and whether it has been applied
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.ID]
+		statuses = append(statuses, MigrationStatus{
+			ID:        m.ID,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return statuses, nil
+}
+
+// PendingMigrations returns how many known migrations have not been applied yet
+func PendingMigrations(ctx context.Context) (int, error) {
+	rows, err := DB.QueryContext(ctx, "SELECT id FROM schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		applied[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if !applied[m.ID] {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Backfill calls fn for every row of table matching where, for data migrations written in Go
+// IDs are read up front so fn is free to update the rows it is given
+func Backfill(tx *sql.Tx, table, where string, fn func(tx *sql.Tx, id int64) error) (int, error) {
+	query := "SELECT id FROM " + table
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := fn(tx, id); err != nil {
+			return 0, fmt.Errorf("backfill %s %d: %w", table, id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// migrateItemDueDates adds the optional due date of items as YYYY-MM-DD, which sorts and compares as text
+func migrateItemDueDates(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE items ADD COLUMN due_date TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_items_due_date ON items(due_date) WHERE due_date != '';
+	`)
+	return err
+}
+
+// migrateItemPhotos adds the photo of items, a path relative to FilesDir, and released_files, where triggers
+// queue the photos of deleted items and replaced photos for RemoveReleasedFiles, cascades included
+func migrateItemPhotos(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE items ADD COLUMN photo TEXT NOT NULL DEFAULT '';
+		CREATE TABLE IF NOT EXISTS released_files (path TEXT PRIMARY KEY);
+		CREATE TRIGGER IF NOT EXISTS items_photo_ad AFTER DELETE ON items WHEN old.photo != '' BEGIN
+			INSERT OR IGNORE INTO released_files(path) VALUES (old.photo);
+		END;
+		CREATE TRIGGER IF NOT EXISTS items_photo_au AFTER UPDATE OF photo ON items WHEN old.photo != '' AND old.photo != new.photo BEGIN
+			INSERT OR IGNORE INTO released_files(path) VALUES (old.photo);
+		END;
+	`)
+	return err
+}
+
+// migrateHistoryCompletions adds the completions history entries record when completed items are archived
+func migrateHistoryCompletions(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE item_history ADD COLUMN completed_count INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE item_history ADD COLUMN last_completed_at INTEGER;
+	`)
+	return err
+}
+
+// migrateItemEvents adds the change history of items. Events outlive their item and are removed with their list
+func migrateItemEvents(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS item_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			item_id INTEGER NOT NULL,
+			list_id INTEGER NOT NULL,
+			item_name TEXT NOT NULL,
+			action TEXT NOT NULL,
+			changes TEXT NOT NULL DEFAULT '{}',
+			actor TEXT NOT NULL DEFAULT '',
+			token_name TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_item_events_item ON item_events(item_id, id);
+		CREATE INDEX IF NOT EXISTS idx_item_events_list ON item_events(list_id, id);
+		CREATE INDEX IF NOT EXISTS idx_item_events_created ON item_events(created_at);
+		CREATE TRIGGER IF NOT EXISTS lists_item_events_ad AFTER DELETE ON lists BEGIN
+			DELETE FROM item_events WHERE list_id = old.id;
+		END;
+	`)
+	return err
+}
+
+// migrateItemTrash adds when an item was moved to the trash, NULL for items that are not in it
+func migrateItemTrash(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE items ADD COLUMN deleted_at INTEGER;
+		CREATE INDEX IF NOT EXISTS idx_items_deleted_at ON items(deleted_at) WHERE deleted_at IS NOT NULL;
+	`)
+	return err
+}
+
+// migrateItemBarcodes adds the optional barcode of items and the cache of products looked up by barcode
+func migrateItemBarcodes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE items ADD COLUMN barcode TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_items_barcode ON items(barcode) WHERE barcode != '';
+		CREATE TABLE IF NOT EXISTS product_cache (
+			barcode TEXT PRIMARY KEY,
+			found INTEGER NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			brand TEXT NOT NULL DEFAULT '',
+			fetched_at INTEGER NOT NULL
+		);
+	`)
+	return err
+}
+
+// migrateListArchived adds the flag that leaves a list out of the statistics
+func migrateListArchived(tx *sql.Tx) error {
+	_, err := tx.Exec("ALTER TABLE lists ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE")
+	return err
+}
+
+// migrateBackupRecords adds the table listing the backups that were taken
+func migrateBackupRecords(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS backups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			name TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_backups_created ON backups(created_at);
+	`)
+	return err
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// columns returns the column names of a table
+func columns(t *testing.T, table string) map[string]bool {
+	t.Helper()
+	rows, err := DB.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatalf("table info %s: %v", table, err)
+	}
+	defer rows.Close()
+	result := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		result[name] = true
+	}
+	return result
+}
+
+// checkHeadSchema fails the test unless the tables and columns added along the chain exist
+func checkHeadSchema(t *testing.T) {
+	t.Helper()
+	want := map[string][]string{
+		"lists":            {"id", "name", "icon", "sort_order", "is_active"},
+		"sections":         {"id", "list_id", "name", "sort_order"},
+		"items":            {"quantity", "completed_at", "price_cents", "currency", "due_date", "photo", "deleted_at", "barcode"},
+		"item_history":     {"name", "usage_count"},
+		"templates":        {"id", "name"},
+		"template_items":   {"template_id", "section_name"},
+		"api_tokens":       {"token_hash", "scope", "list_id", "expires_at", "last_used_at", "previous_hash", "previous_expires_at"},
+		"audit_log":        {"action", "request_id"},
+		"settings":         {"key", "value"},
+		"shares":           {"id"},
+		"idempotency_keys": {"scope", "key", "request_hash"},
+		"import_batches":   {"id", "status", "snapshot"},
+		"item_events":      {"item_id", "list_id", "action", "changes"},
+		"product_cache":    {"barcode"},
+	}
+	for table, cols := range want {
+		have := columns(t, table)
+		if len(have) == 0 {
+			t.Errorf("table %s missing", table)
+			continue
+		}
+		for _, col := range cols {
+			if !have[col] {
+				t.Errorf("column %s.%s missing", table, col)
+			}
+		}
+	}
+}
+
+// checkAllApplied fails the test unless every migration is recorded as applied
+func checkAllApplied(t *testing.T) []MigrationStatus {
+	t.Helper()
+	statuses, err := GetMigrationStatus()
+	if err != nil {
+		t.Fatalf("migration status: %v", err)
+	}
+	if len(statuses) != len(migrations) {
+		t.Fatalf("%d statuses for %d migrations", len(statuses), len(migrations))
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.AppliedAt == 0 {
+			t.Errorf("migration %d (%s) not applied", s.ID, s.Name)
+		}
+	}
+	return statuses
+}
+
+func TestMigrationIDsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.ID != i {
+			t.Errorf("migration %q has ID %d at position %d", m.Name, m.ID, i)
+		}
+		if m.Name == "" || m.Up == nil {
+			t.Errorf("migration %d has no name or function", m.ID)
+		}
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	setupTestDB(t)
+	before := checkAllApplied(t)
+	checkHeadSchema(t)
+
+	// Running the chain again changes nothing
+	if err := Migrate(); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	after := checkAllApplied(t)
+	for i := range before {
+		if before[i].AppliedAt != after[i].AppliedAt {
+			t.Errorf("migration %d applied again", before[i].ID)
+		}
+	}
+}
+
+func TestMigratePreviousRelease(t *testing.T) {
+	script, err := os.ReadFile(filepath.Join("testdata", "previous_release.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "old.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(string(script)); err != nil {
+		t.Fatalf("load previous release: %v", err)
+	}
+	conn.Close()
+
+	t.Setenv("DB_PATH", path)
+	Init()
+	t.Cleanup(Close)
+
+	checkAllApplied(t)
+	checkHeadSchema(t)
+
+	// The data of the old release survives and reads through the current queries
+	if got := listNames(t); len(got) != 1 || got[0] != "Groceries" {
+		t.Fatalf("lists = %v, want [Groceries]", got)
+	}
+	sections, err := GetSectionsByList(1)
+	if err != nil || len(sections) != 1 || sections[0].Name != "Dairy" {
+		t.Fatalf("sections = %+v, %v", sections, err)
+	}
+	items, err := GetItemsBySection(sections[0].ID)
+	if err != nil {
+		t.Fatalf("items: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("%d items, want 2", len(items))
+	}
+	byName := map[string]Item{}
+	for _, i := range items {
+		byName[i.Name] = i
+	}
+	if milk := byName["Milk"]; milk.Quantity != 2 || milk.Description != "2L" || milk.Completed {
+		t.Errorf("Milk = %+v", milk)
+	}
+	if cheese := byName["Cheese"]; !cheese.Completed || cheese.PriceCents != nil || cheese.Barcode != "" {
+		t.Errorf("Cheese = %+v", cheese)
+	}
+
+	// And the upgraded database takes new rows
+	item, err := CreateItem(sections[0].ID, "Butter", "", 1)
+	if err != nil {
+		t.Fatalf("create item after upgrade: %v", err)
+	}
+	if _, err := SetItemBarcode(item.ID, "4006381333931"); err != nil {
+		t.Errorf("set barcode after upgrade: %v", err)
+	}
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	setupTestDB(t)
+
+	failing := Migration{ID: len(migrations), Name: "failing", Up: func(tx *sql.Tx) error {
+		if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+			return err
+		}
+		return errors.New("backfill failed")
+	}}
+	original := migrations
+	migrations = append(append([]Migration{}, original...), failing)
+	t.Cleanup(func() { migrations = original })
+
+	if err := Migrate(); err == nil {
+		t.Fatal("migrate succeeded with a failing migration")
+	}
+	if len(columns(t, "half_done")) > 0 {
+		t.Error("the failing migration's table was kept")
+	}
+	statuses, err := GetMigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; last.Applied {
+		t.Errorf("failing migration recorded as applied: %+v", last)
+	}
+}
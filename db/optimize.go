@@ -0,0 +1,47 @@
+package db
+
+import (
+	"os"
+	"strings"
+)
+
+// FileSize returns the size of the database file including its WAL
+func FileSize() int64 {
+	var size int64
+	for _, suffix := range []string{"", "-wal"} {
+		if info, err := os.Stat(Path() + suffix); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// Optimize checkpoints the WAL, refreshes query planner statistics and rebuilds the file
+// VACUUM holds the write lock for its whole duration, readers are not blocked in WAL mode.
+// Everything runs on the write connection, so writes queue behind it instead of failing as busy
+func Optimize() error {
+	var mode string
+	if err := writeDB.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		return err
+	}
+	if strings.EqualFold(mode, "wal") {
+		if _, err := writeDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := writeDB.Exec("PRAGMA optimize"); err != nil {
+		return err
+	}
+	if _, err := writeDB.Exec("VACUUM"); err != nil {
+		return err
+	}
+
+	// VACUUM writes through the WAL, truncate it again so the space is actually returned
+	if strings.EqualFold(mode, "wal") {
+		if _, err := writeDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
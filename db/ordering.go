@@ -0,0 +1,215 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// OrderingRepair describes one section's items or one list's sections whose sort_order was rewritten
+type OrderingRepair struct {
+	Table    string `json:"table"`
+	ParentID int64  `json:"parent_id"`
+	Changed  int    `json:"changed"`
+}
+
+// orderingGroups are the tables whose sort_order is scoped to a parent
+var orderingGroups = []struct {
+	table     string
+	parentCol string
+}{
+	{"sections", "list_id"},
+	{"items", "section_id"},
+}
+
+// liveRows is the condition that leaves trashed rows out of a group's ordering
+// Only items are soft-deleted, a trashed item keeps its sort_order for a restore
+func liveRows(table string) string {
+	if table == "items" {
+		return " AND deleted_at IS NULL"
+	}
+	return ""
+}
+
+// RepairOrdering rewrites duplicate or gapped sort_order values to 0..n-1 per parent
+// Relative order is preserved, ties are broken by id. Each parent is rewritten in its own transaction.
+// With dryRun nothing is changed and the report lists what would be
+func RepairOrdering(dryRun bool) ([]OrderingRepair, error) {
+	var repairs []OrderingRepair
+	for _, g := range orderingGroups {
+		parents, err := orderingParents(g.table, g.parentCol)
+		if err != nil {
+			return nil, err
+		}
+		for _, parentID := range parents {
+			changed, err := repairGroupOrdering(g.table, g.parentCol, parentID, dryRun)
+			if err != nil {
+				return nil, fmt.Errorf("%s of %s %d: %w", g.table, g.parentCol, parentID, err)
+			}
+			if changed > 0 {
+				repairs = append(repairs, OrderingRepair{Table: g.table, ParentID: parentID, Changed: changed})
+			}
+		}
+	}
+	return repairs, nil
+}
+
+func orderingParents(table, parentCol string) ([]int64, error) {
+	rows, err := DB.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL%s", parentCol, table, parentCol, liveRows(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// repairGroupOrdering renumbers the rows of one parent and returns how many rows changed
+func repairGroupOrdering(table, parentCol string, parentID int64, dryRun bool) (int, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	wrong, err := groupRenumberingTx(tx, table, parentCol, parentID)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := len(wrong)
+	if changed == 0 || dryRun {
+		return changed, nil
+	}
+
+	if err := applyRenumberingTx(tx, table, wrong); err != nil {
+		return 0, err
+	}
+	return changed, tx.Commit()
+}
+
+// renumbering is the new sort_order of one row
+type renumbering struct {
+	id    int64
+	order int
+}
+
+// groupRenumberingTx returns the rows of one parent whose sort_order differs from their place in 0..n-1
+func groupRenumberingTx(tx *sql.Tx, table, parentCol string, parentID int64) ([]renumbering, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, sort_order FROM %s WHERE %s = ?%s ORDER BY sort_order ASC, id ASC", table, parentCol, liveRows(table)), parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wrong []renumbering
+	for i := 0; rows.Next(); i++ {
+		var r renumbering
+		if err := rows.Scan(&r.id, &r.order); err != nil {
+			return nil, err
+		}
+		if r.order != i {
+			wrong = append(wrong, renumbering{id: r.id, order: i})
+		}
+	}
+	return wrong, rows.Err()
+}
+
+func applyRenumberingTx(tx *sql.Tx, table string, renumberings []renumbering) error {
+	for _, r := range renumberings {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET sort_order = ?, updated_at = strftime('%%s', 'now') WHERE id = ?", table), r.order, r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renumberItemsTx closes the gaps in the sort_order of a section's items, such as after an item moved out
+func renumberItemsTx(tx *sql.Tx, sectionID int64) error {
+	wrong, err := groupRenumberingTx(tx, "items", "section_id", sectionID)
+	if err != nil {
+		return err
+	}
+	return applyRenumberingTx(tx, "items", wrong)
+}
+
+// SetItemsOrder puts the items of a section in the order of ids, see setGroupOrder
+func SetItemsOrder(sectionID int64, ids []int64) (foreign []int64, err error) {
+	return setGroupOrder("items", "section_id", sectionID, ids)
+}
+
+// SetSectionsOrder puts the sections of a list in the order of ids, see setGroupOrder
+func SetSectionsOrder(listID int64, ids []int64) (foreign []int64, err error) {
+	return setGroupOrder("sections", "list_id", listID, ids)
+}
+
+// setGroupOrder renumbers the rows of one parent 0..n-1 in the order of ids in one transaction
+// Rows missing from ids follow in their previous relative order, repeated ids count once.
+// IDs of rows with another parent, of none, or in the trash are returned in foreign and nothing is changed
+func setGroupOrder(table, parentCol string, parentID int64, ids []int64) (foreign []int64, err error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, sort_order FROM %s WHERE %s = ?%s ORDER BY sort_order ASC, id ASC", table, parentCol, liveRows(table)), parentID)
+	if err != nil {
+		return nil, err
+	}
+	var current []int64
+	previous := map[int64]int{}
+	for rows.Next() {
+		var id int64
+		var order int
+		if err := rows.Scan(&id, &order); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		current = append(current, id)
+		previous[id] = order
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int64, 0, len(current))
+	placed := map[int64]bool{}
+	for _, id := range ids {
+		if _, ok := previous[id]; !ok {
+			foreign = append(foreign, id)
+			continue
+		}
+		if !placed[id] {
+			placed[id] = true
+			order = append(order, id)
+		}
+	}
+	if len(foreign) > 0 {
+		return foreign, nil
+	}
+	for _, id := range current {
+		if !placed[id] {
+			order = append(order, id)
+		}
+	}
+
+	for i, id := range order {
+		if previous[id] == i {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET sort_order = ?, updated_at = strftime('%%s', 'now') WHERE id = ?", table), i, id); err != nil {
+			return nil, err
+		}
+	}
+	return nil, tx.Commit()
+}
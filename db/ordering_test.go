@@ -0,0 +1,226 @@
+package db
+
+import "testing"
+
+// sortOrder returns the sort_order of an item, trashed or not
+func sortOrder(t *testing.T, id int64) int {
+	t.Helper()
+	var order int
+	if err := DB.QueryRow("SELECT sort_order FROM items WHERE id = ?", id).Scan(&order); err != nil {
+		t.Fatalf("get sort_order: %v", err)
+	}
+	return order
+}
+
+func TestRepairOrderingSkipsTrashedItems(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	if err := DeleteItem(f.milk.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// Cheese closes the gap Milk left, Milk keeps its place for a restore
+	repairs, err := RepairOrdering(false)
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if len(repairs) != 1 || repairs[0].Table != "items" || repairs[0].ParentID != f.section.ID || repairs[0].Changed != 1 {
+		t.Errorf("repairs = %+v, want Cheese in Dairy", repairs)
+	}
+	if got := sortOrder(t, f.cheese.ID); got != 1 {
+		t.Errorf("Cheese sort_order = %d, want 1", got)
+	}
+	if got := sortOrder(t, f.milk.ID); got != 1 {
+		t.Errorf("trashed Milk sort_order = %d, want it left at 1", got)
+	}
+
+	if _, err := RestoreItem(f.milk.ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if names := sectionItemNames(t, f.section.ID); !equalNames(names, []string{"Bread", "Milk", "Cheese"}) {
+		t.Errorf("section items after restore = %v, want Bread, Milk, Cheese", names)
+	}
+	if repairs, err := RepairOrdering(true); err != nil || len(repairs) != 0 {
+		t.Errorf("repairs after restore = %+v, %v, want none", repairs, err)
+	}
+}
+
+func TestNewItemFollowsLiveItems(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	if err := DeleteItem(f.cheese.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	eggs, err := CreateItem(f.section.ID, "Eggs", "", 1)
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	if got := sortOrder(t, eggs.ID); got != 2 {
+		t.Errorf("Eggs sort_order = %d, want 2 after Bread and Milk", got)
+	}
+	if repairs, err := RepairOrdering(true); err != nil || len(repairs) != 0 {
+		t.Errorf("repairs = %+v, %v, want none", repairs, err)
+	}
+}
+
+func TestSetItemsOrderSkipsTrashedItems(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	if err := DeleteItem(f.milk.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	foreign, err := SetItemsOrder(f.section.ID, []int64{f.cheese.ID, f.milk.ID})
+	if err != nil {
+		t.Fatalf("set order: %v", err)
+	}
+	if len(foreign) != 1 || foreign[0] != f.milk.ID {
+		t.Errorf("foreign = %v, want the trashed Milk", foreign)
+	}
+
+	foreign, err = SetItemsOrder(f.section.ID, []int64{f.cheese.ID})
+	if err != nil || len(foreign) != 0 {
+		t.Fatalf("set order: foreign %v, err %v", foreign, err)
+	}
+	if names := sectionItemNames(t, f.section.ID); !equalNames(names, []string{"Cheese", "Bread"}) {
+		t.Errorf("section items = %v, want Cheese, Bread", names)
+	}
+	if got := sortOrder(t, f.milk.ID); got != 1 {
+		t.Errorf("trashed Milk sort_order = %d, want it left at 1", got)
+	}
+}
+
+// setSortOrders overwrites the sort_order of rows of table, as a failed import or reorder leaves them
+func setSortOrders(t *testing.T, table string, orders map[int64]int) {
+	t.Helper()
+	for id, order := range orders {
+		if _, err := DB.Exec("UPDATE "+table+" SET sort_order = ? WHERE id = ?", order, id); err != nil {
+			t.Fatalf("set sort_order of %s %d: %v", table, id, err)
+		}
+	}
+}
+
+// groupOrders returns the ids of the rows of one parent by sort_order and their sort_order
+func groupOrders(t *testing.T, table, parentCol string, parentID int64) (ids []int64, orders []int) {
+	t.Helper()
+	rows, err := DB.Query("SELECT id, sort_order FROM "+table+" WHERE "+parentCol+" = ? ORDER BY sort_order, id", parentID)
+	if err != nil {
+		t.Fatalf("get %s: %v", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var order int
+		if err := rows.Scan(&id, &order); err != nil {
+			t.Fatalf("scan %s: %v", table, err)
+		}
+		ids, orders = append(ids, id), append(orders, order)
+	}
+	return ids, orders
+}
+
+func TestRepairOrderingRenumbersDuplicatesAndGaps(t *testing.T) {
+	setupTestDB(t)
+	list, err := CreateList("Groceries", "")
+	if err != nil {
+		t.Fatalf("create list: %v", err)
+	}
+	var sections [3]*Section
+	for i, name := range []string{"Dairy", "Bakery", "Produce"} {
+		if sections[i], err = CreateSectionForList(list.ID, name); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+	dairy, bakery, produce := sections[0], sections[1], sections[2]
+	var items []*Item
+	for _, it := range []struct {
+		section *Section
+		name    string
+	}{{dairy, "Bread"}, {dairy, "Milk"}, {dairy, "Cheese"}, {dairy, "Eggs"}, {bakery, "Rolls"}, {bakery, "Bagel"}, {produce, "Apples"}} {
+		item, err := CreateItem(it.section.ID, it.name, "", 1)
+		if err != nil {
+			t.Fatalf("create %s: %v", it.name, err)
+		}
+		items = append(items, item)
+	}
+	bread, milk, cheese, eggs, rolls, bagel, apples := items[0], items[1], items[2], items[3], items[4], items[5], items[6]
+
+	// Duplicates in Dairy and the sections, a gap in Bakery, Produce is left intact
+	setSortOrders(t, "items", map[int64]int{bread.ID: 3, milk.ID: 0, cheese.ID: 0, eggs.ID: 3, bagel.ID: 5})
+	setSortOrders(t, "sections", map[int64]int{dairy.ID: 7, bakery.ID: 2, produce.ID: 2})
+	wantRepairs := map[OrderingRepair]bool{
+		{Table: "sections", ParentID: list.ID, Changed: 3}: true,
+		{Table: "items", ParentID: dairy.ID, Changed: 2}:   true,
+		{Table: "items", ParentID: bakery.ID, Changed: 1}:  true,
+	}
+	checkRepairs := func(name string, repairs []OrderingRepair) {
+		t.Helper()
+		got := map[OrderingRepair]bool{}
+		for _, r := range repairs {
+			got[r] = true
+		}
+		if len(repairs) != len(wantRepairs) || len(got) != len(wantRepairs) {
+			t.Errorf("%s repairs = %+v, want %v", name, repairs, wantRepairs)
+			return
+		}
+		for r := range wantRepairs {
+			if !got[r] {
+				t.Errorf("%s repairs = %+v, want %+v among them", name, repairs, r)
+			}
+		}
+	}
+
+	// A dry run reports the same repairs and changes nothing
+	repairs, err := RepairOrdering(true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	checkRepairs("dry run", repairs)
+	if got := sortOrder(t, cheese.ID); got != 0 {
+		t.Errorf("Cheese sort_order after the dry run = %d, want it left at 0", got)
+	}
+
+	repairs, err = RepairOrdering(false)
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	checkRepairs("repair", repairs)
+
+	// Relative order is kept, ties go to the lower id
+	for _, g := range []struct {
+		table, parentCol string
+		parentID         int64
+		want             []int64
+	}{
+		{"sections", "list_id", list.ID, []int64{bakery.ID, produce.ID, dairy.ID}},
+		{"items", "section_id", dairy.ID, []int64{milk.ID, cheese.ID, bread.ID, eggs.ID}},
+		{"items", "section_id", bakery.ID, []int64{rolls.ID, bagel.ID}},
+		{"items", "section_id", produce.ID, []int64{apples.ID}},
+	} {
+		ids, orders := groupOrders(t, g.table, g.parentCol, g.parentID)
+		for i := range orders {
+			if orders[i] != i {
+				t.Errorf("%s of %d have sort_order %v, want 0..%d", g.table, g.parentID, orders, len(orders)-1)
+				break
+			}
+		}
+		if len(ids) != len(g.want) {
+			t.Errorf("%s of %d = %v, want %v", g.table, g.parentID, ids, g.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != g.want[i] {
+				t.Errorf("%s of %d = %v, want %v", g.table, g.parentID, ids, g.want)
+				break
+			}
+		}
+	}
+	if names := sectionItemNames(t, dairy.ID); !equalNames(names, []string{"Milk", "Cheese", "Bread", "Eggs"}) {
+		t.Errorf("Dairy items = %v, want Milk, Cheese, Bread, Eggs", names)
+	}
+
+	if repairs, err := RepairOrdering(false); err != nil || len(repairs) != 0 {
+		t.Errorf("second repair = %+v, %v, want nothing to do", repairs, err)
+	}
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// PastedItem is an item parsed from pasted text
+type PastedItem struct {
+	Name        string
+	Description string
+	Quantity    int
+	Completed   bool
+	Uncertain   bool
+}
+
+// PastedSection groups pasted items under a section name
+type PastedSection struct {
+	Name  string
+	Items []PastedItem
+}
+
+// AddPastedItemsTx appends pasted sections and items to a list
+// Sections are matched by name like templates, so "General" finds the list's translated default section,
+// and only missing ones are created. Items go to the end of their section and are saved to the history
+func AddPastedItemsTx(tx *sql.Tx, listID int64, sections []PastedSection) ([]Section, []Item, error) {
+	var createdSections []Section
+	var createdItems []Item
+
+	for _, pasted := range sections {
+		if len(pasted.Items) == 0 {
+			continue
+		}
+
+		sectionID, err := findSectionTx(tx, listID, pasted.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sectionID == 0 {
+			section, err := CreateSectionForListTx(tx, listID, pasted.Name, GetMaxSectionOrderTx(tx, listID)+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			sectionID = section.ID
+			createdSections = append(createdSections, *section)
+		}
+
+		order := GetMaxItemOrderTx(tx, sectionID) + 1
+		for _, p := range pasted.Items {
+			item, err := CreateItemTx(tx, sectionID, p.Name, p.Description, p.Quantity, order)
+			if err != nil {
+				return nil, nil, err
+			}
+			order++
+
+			if p.Completed || p.Uncertain {
+				_, err := tx.Exec(`
+					UPDATE items SET
+						completed = ?,
+						completed_at = CASE WHEN ? THEN strftime('%s', 'now') ELSE NULL END,
+						uncertain = ?
+					WHERE id = ?
+				`, p.Completed, p.Completed, p.Uncertain, item.ID)
+				if err != nil {
+					return nil, nil, err
+				}
+				item.Completed, item.Uncertain = p.Completed, p.Uncertain
+			}
+
+			SaveItemHistoryTx(tx, p.Name, sectionID)
+			createdItems = append(createdItems, *item)
+		}
+	}
+
+	return createdSections, createdItems, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import "database/sql"
+
+// PhotosDir is the directory of item photos within FilesDir
+const PhotosDir = "photos"
+
+func init() {
+	fileReferenceQueries = append(fileReferenceQueries, "SELECT photo FROM items WHERE photo != ''")
+}
+
+// GetItemPhoto returns the path of an item's photo relative to FilesDir, empty without one
+func GetItemPhoto(id int64) (string, error) {
+	var photo string
+	err := DB.QueryRow("SELECT photo FROM items WHERE id = ? AND deleted_at IS NULL", id).Scan(&photo)
+	return photo, err
+}
+
+// SetItemPhoto sets the photo of an item, a path relative to FilesDir or empty to remove it
+// The photo it replaces is released, see TakeReleasedFiles
+func SetItemPhoto(id int64, photo string) (*Item, error) {
+	res, err := writeDB.Exec(`UPDATE items SET photo = ?, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL`, photo, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return GetItemByID(id)
+}
+
+// TakeReleasedFiles empties the queue of files released by deleted items and replaced photos and returns
+// the paths, relative to FilesDir, that no row references anymore
+func TakeReleasedFiles() ([]string, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT path FROM released_files
+		WHERE NOT EXISTS (SELECT 1 FROM items WHERE photo = released_files.path)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM released_files"); err != nil {
+		return nil, err
+	}
+	return paths, tx.Commit()
+}
+
+// HasReleasedFiles reports whether files wait in the queue of TakeReleasedFiles, without taking the write lock
+func HasReleasedFiles() bool {
+	var n int
+	DB.QueryRow("SELECT EXISTS (SELECT 1 FROM released_files)").Scan(&n)
+	return n == 1
+}
@@ -0,0 +1,82 @@
+package db
+
+import "database/sql"
+
+// CachedProduct is a product looked up by barcode, Found is false for barcodes the lookup did not know
+type CachedProduct struct {
+	Barcode   string
+	Found     bool
+	Name      string
+	Brand     string
+	FetchedAt int64
+}
+
+// SetItemBarcode sets the barcode of an item, empty clears it
+func SetItemBarcode(id int64, barcode string) (*Item, error) {
+	_, err := writeDB.Exec(`
+		UPDATE items SET barcode = ?, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL
+	`, barcode, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetItemByID(id)
+}
+
+// openItemByBarcodeSQL selects the first open item of a list with a barcode
+const openItemByBarcodeSQL = `
+	SELECT i.id FROM items i
+	JOIN sections s ON s.id = i.section_id
+	WHERE s.list_id = ? AND i.barcode = ? AND i.completed = FALSE AND i.deleted_at IS NULL
+	ORDER BY s.sort_order, i.sort_order, i.id
+	LIMIT 1
+`
+
+// FindOpenItemByBarcode returns the first item of a list with the barcode that is not completed,
+// sql.ErrNoRows when there is none
+func FindOpenItemByBarcode(listID int64, barcode string) (*Item, error) {
+	var id int64
+	if err := DB.QueryRow(openItemByBarcodeSQL, listID, barcode).Scan(&id); err != nil {
+		return nil, err
+	}
+	return GetItemByID(id)
+}
+
+// FindOpenItemByBarcodeTx is FindOpenItemByBarcode within a write transaction,
+// so no other write can add the barcode between the check and the insert that follows it
+func FindOpenItemByBarcodeTx(tx *sql.Tx, listID int64, barcode string) (*Item, error) {
+	var id int64
+	if err := tx.QueryRow(openItemByBarcodeSQL, listID, barcode).Scan(&id); err != nil {
+		return nil, err
+	}
+	return GetItemByIDTx(tx, id)
+}
+
+// GetCachedProduct returns the cached lookup of a barcode, sql.ErrNoRows when it was never looked up
+func GetCachedProduct(barcode string) (*CachedProduct, error) {
+	p := CachedProduct{Barcode: barcode}
+	err := DB.QueryRow("SELECT found, name, brand, fetched_at FROM product_cache WHERE barcode = ?", barcode).
+		Scan(&p.Found, &p.Name, &p.Brand, &p.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SaveCachedProduct stores the lookup of a barcode, replacing an older one
+func SaveCachedProduct(p CachedProduct) error {
+	_, err := writeDB.Exec(`
+		INSERT INTO product_cache (barcode, found, name, brand, fetched_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(barcode) DO UPDATE SET found = excluded.found, name = excluded.name, brand = excluded.brand,
+			fetched_at = excluded.fetched_at
+	`, p.Barcode, p.Found, p.Name, p.Brand, p.FetchedAt)
+	return err
+}
+
+// DeleteCachedProductsBefore removes the product lookups fetched before the cutoff (unix seconds) and returns how many
+func DeleteCachedProductsBefore(cutoff int64) (int64, error) {
+	res, err := writeDB.Exec("DELETE FROM product_cache WHERE fetched_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"shopping-list/i18n"
 	"sort"
 	"strings"
 	"time"
@@ -31,6 +32,15 @@ type Item struct {
 	SortOrder   int       `json:"sort_order"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   int64     `json:"updated_at"`
+	CompletedAt *int64    `json:"completed_at,omitempty"` // Unix time, nil unless completed
+	PriceCents  *int64    `json:"price_cents,omitempty"`  // Price of one unit in cents, nil when not set
+	Currency    string    `json:"currency,omitempty"`     // ISO 4217 style code of the price, empty when not given
+	DueDate     string    `json:"due_date,omitempty"`     // YYYY-MM-DD, empty without one
+	Overdue     bool      `json:"overdue,omitempty"`      // Not completed and due before today
+	Photo       string    `json:"-"`                      // Path of the photo relative to FilesDir, empty without one
+	HasPhoto    bool      `json:"has_photo"`
+	PhotoURL    string    `json:"photo_url,omitempty"` // API path of the photo
+	Barcode     string    `json:"barcode,omitempty"`   // EAN or UPC digits with a valid check digit, empty without one
 }
 
 // Session represents a user session
@@ -46,6 +56,7 @@ type List struct {
 	Icon      string    `json:"icon"`
 	SortOrder int       `json:"sort_order"`
 	IsActive  bool      `json:"is_active"`
+	Archived  bool      `json:"archived"` // Left out of the statistics unless they ask for archived lists
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt int64     `json:"updated_at"`
 	Stats     Stats     `json:"stats,omitempty"`
@@ -78,7 +89,7 @@ type TemplateItem struct {
 // GetAllLists returns all shopping lists with their stats
 func GetAllLists() ([]List, error) {
 	rows, err := DB.Query(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
+		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, archived, created_at, COALESCE(updated_at, 0)
 		FROM lists
 		ORDER BY sort_order ASC
 	`)
@@ -90,7 +101,7 @@ func GetAllLists() ([]List, error) {
 	var lists []List
 	for rows.Next() {
 		var l List
-		err := rows.Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+		err := rows.Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.Archived, &l.CreatedAt, &l.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -104,9 +115,9 @@ func GetAllLists() ([]List, error) {
 func GetListByID(id int64) (*List, error) {
 	var l List
 	err := DB.QueryRow(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
+		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, archived, created_at, COALESCE(updated_at, 0)
 		FROM lists WHERE id = ?
-	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.Archived, &l.CreatedAt, &l.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -118,10 +129,10 @@ func GetListByID(id int64) (*List, error) {
 func GetActiveList() (*List, error) {
 	var l List
 	err := DB.QueryRow(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
+		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, archived, created_at, COALESCE(updated_at, 0)
 		FROM lists WHERE is_active = TRUE
 		LIMIT 1
-	`).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+	`).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.Archived, &l.CreatedAt, &l.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +149,7 @@ func CreateList(name, icon string) (*List, error) {
 		icon = "🛒"
 	}
 
-	result, err := DB.Exec(`
+	result, err := writeDB.Exec(`
 		INSERT INTO lists (name, icon, sort_order, is_active) VALUES (?, ?, ?, FALSE)
 	`, name, icon, maxOrder+1)
 	if err != nil {
@@ -171,38 +182,35 @@ func ListNameExists(name string, excludeID int64) (bool, error) {
 	return count > 0, nil
 }
 
-// UpdateList updates a list's name and icon
-func UpdateList(id int64, name, icon string) (*List, error) {
-	if icon == "" {
-		_, err := DB.Exec(`UPDATE lists SET name = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, id)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		_, err := DB.Exec(`UPDATE lists SET name = ?, icon = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, icon, id)
-		if err != nil {
-			return nil, err
-		}
+// UpdateList updates a list's name and icon, an empty icon keeps the current one and a nil archived the flag
+func UpdateList(id int64, name, icon string, archived *bool) (*List, error) {
+	_, err := writeDB.Exec(`
+		UPDATE lists SET name = ?, icon = CASE WHEN ? = '' THEN icon ELSE ? END, archived = COALESCE(?, archived),
+			updated_at = strftime('%s', 'now')
+		WHERE id = ?
+	`, name, icon, icon, archived, id)
+	if err != nil {
+		return nil, err
 	}
 	return GetListByID(id)
 }
 
 // DeleteList deletes a list and all its sections/items
 func DeleteList(id int64) error {
-	_, err := DB.Exec(`DELETE FROM lists WHERE id = ?`, id)
+	_, err := writeDB.Exec(`DELETE FROM lists WHERE id = ?`, id)
 	return err
 }
 
 // SetActiveList sets a list as the active one
 func SetActiveList(id int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	// Deactivate all lists
-	_, err = tx.Exec("UPDATE lists SET is_active = FALSE")
+	_, err = tx.Exec("UPDATE lists SET is_active = FALSE, updated_at = strftime('%s', 'now') WHERE is_active = TRUE")
 	if err != nil {
 		return err
 	}
@@ -218,7 +226,7 @@ func SetActiveList(id int64) error {
 
 // MoveListUp moves a list up in sort order
 func MoveListUp(id int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
@@ -234,12 +242,12 @@ func MoveListUp(id int64) error {
 		return nil
 	}
 
-	_, err = tx.Exec(`UPDATE lists SET sort_order = sort_order + 1 WHERE sort_order = ?`, currentOrder-1)
+	_, err = tx.Exec(`UPDATE lists SET sort_order = sort_order + 1, updated_at = strftime('%s', 'now') WHERE sort_order = ?`, currentOrder-1)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`UPDATE lists SET sort_order = ? WHERE id = ?`, currentOrder-1, id)
+	_, err = tx.Exec(`UPDATE lists SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, currentOrder-1, id)
 	if err != nil {
 		return err
 	}
@@ -249,7 +257,7 @@ func MoveListUp(id int64) error {
 
 // MoveListDown moves a list down in sort order
 func MoveListDown(id int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
@@ -269,12 +277,12 @@ func MoveListDown(id int64) error {
 		return nil
 	}
 
-	_, err = tx.Exec(`UPDATE lists SET sort_order = sort_order - 1 WHERE sort_order = ?`, currentOrder+1)
+	_, err = tx.Exec(`UPDATE lists SET sort_order = sort_order - 1, updated_at = strftime('%s', 'now') WHERE sort_order = ?`, currentOrder+1)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`UPDATE lists SET sort_order = ? WHERE id = ?`, currentOrder+1, id)
+	_, err = tx.Exec(`UPDATE lists SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, currentOrder+1, id)
 	if err != nil {
 		return err
 	}
@@ -288,12 +296,12 @@ func GetListStats(listID int64) Stats {
 	DB.QueryRow(`
 		SELECT COUNT(*) FROM items i
 		JOIN sections s ON i.section_id = s.id
-		WHERE s.list_id = ?
+		WHERE s.list_id = ? AND i.deleted_at IS NULL
 	`, listID).Scan(&stats.TotalItems)
 	DB.QueryRow(`
 		SELECT COUNT(*) FROM items i
 		JOIN sections s ON i.section_id = s.id
-		WHERE s.list_id = ? AND i.completed = TRUE
+		WHERE s.list_id = ? AND i.completed = TRUE AND i.deleted_at IS NULL
 	`, listID).Scan(&stats.CompletedItems)
 	if stats.TotalItems > 0 {
 		stats.Percentage = (stats.CompletedItems * 100) / stats.TotalItems
@@ -399,7 +407,7 @@ func CreateSectionForList(listID int64, name string) (*Section, error) {
 	var maxOrder int
 	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM sections WHERE list_id = ?", listID).Scan(&maxOrder)
 
-	result, err := DB.Exec(`
+	result, err := writeDB.Exec(`
 		INSERT INTO sections (name, sort_order, list_id) VALUES (?, ?, ?)
 	`, name, maxOrder+1, listID)
 	if err != nil {
@@ -411,7 +419,7 @@ func CreateSectionForList(listID int64, name string) (*Section, error) {
 }
 
 func UpdateSection(id int64, name string) (*Section, error) {
-	_, err := DB.Exec(`UPDATE sections SET name = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, id)
+	_, err := writeDB.Exec(`UPDATE sections SET name = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, id)
 	if err != nil {
 		return nil, err
 	}
@@ -419,12 +427,12 @@ func UpdateSection(id int64, name string) (*Section, error) {
 }
 
 func DeleteSection(id int64) error {
-	_, err := DB.Exec(`DELETE FROM sections WHERE id = ?`, id)
+	_, err := writeDB.Exec(`DELETE FROM sections WHERE id = ?`, id)
 	return err
 }
 
 func MoveSectionUp(id int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
@@ -443,7 +451,7 @@ func MoveSectionUp(id int64) error {
 
 	// Swap with previous section (within the same list)
 	_, err = tx.Exec(`
-		UPDATE sections SET sort_order = sort_order + 1
+		UPDATE sections SET sort_order = sort_order + 1, updated_at = strftime('%s', 'now')
 		WHERE sort_order = ? AND list_id = ?
 	`, currentOrder-1, listID)
 	if err != nil {
@@ -451,7 +459,7 @@ func MoveSectionUp(id int64) error {
 	}
 
 	_, err = tx.Exec(`
-		UPDATE sections SET sort_order = ? WHERE id = ?
+		UPDATE sections SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?
 	`, currentOrder-1, id)
 	if err != nil {
 		return err
@@ -461,7 +469,7 @@ func MoveSectionUp(id int64) error {
 }
 
 func MoveSectionDown(id int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
@@ -486,7 +494,7 @@ func MoveSectionDown(id int64) error {
 
 	// Swap with next section (within the same list)
 	_, err = tx.Exec(`
-		UPDATE sections SET sort_order = sort_order - 1
+		UPDATE sections SET sort_order = sort_order - 1, updated_at = strftime('%s', 'now')
 		WHERE sort_order = ? AND list_id = ?
 	`, currentOrder+1, listID)
 	if err != nil {
@@ -494,7 +502,7 @@ func MoveSectionDown(id int64) error {
 	}
 
 	_, err = tx.Exec(`
-		UPDATE sections SET sort_order = ? WHERE id = ?
+		UPDATE sections SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?
 	`, currentOrder+1, id)
 	if err != nil {
 		return err
@@ -506,35 +514,105 @@ func MoveSectionDown(id int64) error {
 // ==================== ITEMS ====================
 
 func GetItemsBySection(sectionID int64) ([]Item, error) {
-	rows, err := DB.Query(`
-		SELECT id, section_id, name, description, completed, uncertain, COALESCE(quantity, 0), sort_order, created_at, COALESCE(updated_at, 0)
+	items, _, err := GetItemsBySectionFiltered(sectionID, ItemFilter{})
+	return items, err
+}
+
+// Orders of GetItemsBySectionFiltered, completed items always come last
+const (
+	ItemSortManual  = "manual"
+	ItemSortName    = "name"
+	ItemSortCreated = "created"
+)
+
+// itemSortSQL are the ORDER BY clauses of the item sorts
+var itemSortSQL = map[string]string{
+	ItemSortManual:  "completed ASC, sort_order ASC, id ASC",
+	ItemSortName:    "completed ASC, name COLLATE NOCASE ASC, id ASC",
+	ItemSortCreated: "completed ASC, created_at ASC, id ASC",
+}
+
+// ItemFilter narrows and orders the items of a section, the zero value is every item in manual order
+type ItemFilter struct {
+	Completed *bool  // nil matches both
+	Query     string // Part of the name or description, ASCII case is ignored
+	Sort      string // manual, name or created, manual when empty
+	Limit     int    // 0 for no limit
+	Offset    int
+}
+
+// GetItemsBySectionFiltered returns one page of the items of a section matching f, and how many match in all
+func GetItemsBySectionFiltered(sectionID int64, f ItemFilter) ([]Item, int, error) {
+	where := "section_id = ? AND deleted_at IS NULL"
+	args := []any{sectionID}
+	if f.Completed != nil {
+		where += " AND completed = ?"
+		args = append(args, *f.Completed)
+	}
+	if f.Query != "" {
+		where += ` AND (name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`
+		pattern := "%" + escapeLike(f.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+	order, ok := itemSortSQL[f.Sort]
+	if !ok {
+		order = itemSortSQL[ItemSortManual]
+	}
+	countArgs := append([]any(nil), args...)
+	page := ""
+	if f.Limit > 0 {
+		page = " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		page = " LIMIT -1 OFFSET ?"
+		args = append(args, f.Offset)
+	}
+
+	query := `
+		SELECT id, section_id, name, description, completed, uncertain, COALESCE(quantity, 0), sort_order, created_at, COALESCE(updated_at, 0), completed_at, price_cents, currency,
+			due_date, (due_date != '' AND due_date < date('now', 'localtime') AND completed = 0),
+			photo, photo != '', CASE WHEN photo != '' THEN '/api/v1/items/' || id || '/photo' ELSE '' END, barcode
 		FROM items
-		WHERE section_id = ?
-		ORDER BY completed ASC, sort_order ASC
-	`, sectionID)
+		WHERE ` + where + `
+		ORDER BY ` + order + page
+	rows, err := DB.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var items []Item
 	for rows.Next() {
 		var i Item
-		err := rows.Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
+		err := rows.Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt, &i.CompletedAt, &i.PriceCents, &i.Currency, &i.DueDate, &i.Overdue, &i.Photo, &i.HasPhoto, &i.PhotoURL, &i.Barcode)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		items = append(items, i)
 	}
-	return items, nil
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	// A page that is not full ends the matches, the total only needs counting otherwise
+	total := f.Offset + len(items)
+	if (f.Limit > 0 && len(items) == f.Limit) || (f.Offset > 0 && len(items) == 0) {
+		if err := DB.QueryRow("SELECT COUNT(*) FROM items WHERE "+where, countArgs...).Scan(&total); err != nil {
+			return nil, 0, err
+		}
+	}
+	return items, total, nil
 }
 
 func GetItemByID(id int64) (*Item, error) {
 	var i Item
 	err := DB.QueryRow(`
-		SELECT id, section_id, name, description, completed, uncertain, COALESCE(quantity, 0), sort_order, created_at, COALESCE(updated_at, 0)
-		FROM items WHERE id = ?
-	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
+		SELECT id, section_id, name, description, completed, uncertain, COALESCE(quantity, 0), sort_order, created_at, COALESCE(updated_at, 0), completed_at, price_cents, currency,
+			due_date, (due_date != '' AND due_date < date('now', 'localtime') AND completed = 0),
+			photo, photo != '', CASE WHEN photo != '' THEN '/api/v1/items/' || id || '/photo' ELSE '' END, barcode
+		FROM items WHERE id = ? AND deleted_at IS NULL
+	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt, &i.CompletedAt, &i.PriceCents, &i.Currency, &i.DueDate, &i.Overdue, &i.Photo, &i.HasPhoto, &i.PhotoURL, &i.Barcode)
 	if err != nil {
 		return nil, err
 	}
@@ -544,9 +622,9 @@ func GetItemByID(id int64) (*Item, error) {
 func CreateItem(sectionID int64, name, description string, quantity int) (*Item, error) {
 	// Get max sort_order for this section
 	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
+	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ? AND deleted_at IS NULL", sectionID).Scan(&maxOrder)
 
-	result, err := DB.Exec(`
+	result, err := writeDB.Exec(`
 		INSERT INTO items (section_id, name, description, quantity, sort_order) VALUES (?, ?, ?, ?, ?)
 	`, sectionID, name, description, quantity, maxOrder+1)
 	if err != nil {
@@ -558,8 +636,8 @@ func CreateItem(sectionID int64, name, description string, quantity int) (*Item,
 }
 
 func UpdateItem(id int64, name, description string, quantity int) (*Item, error) {
-	_, err := DB.Exec(`
-		UPDATE items SET name = ?, description = ?, quantity = ?, updated_at = strftime('%s', 'now') WHERE id = ?
+	_, err := writeDB.Exec(`
+		UPDATE items SET name = ?, description = ?, quantity = ?, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL
 	`, name, description, quantity, id)
 	if err != nil {
 		return nil, err
@@ -567,20 +645,238 @@ func UpdateItem(id int64, name, description string, quantity int) (*Item, error)
 	return GetItemByID(id)
 }
 
+// SetItemPrice sets the price of an item in cents and its currency, a nil price clears both
+func SetItemPrice(id int64, priceCents *int64, currency string) (*Item, error) {
+	if priceCents == nil {
+		currency = ""
+	}
+	_, err := writeDB.Exec(`
+		UPDATE items SET price_cents = ?, currency = ?, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL
+	`, priceCents, currency, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetItemByID(id)
+}
+
+// SetItemDueDate sets the due date of an item as YYYY-MM-DD, empty clears it
+func SetItemDueDate(id int64, dueDate string) (*Item, error) {
+	_, err := writeDB.Exec(`
+		UPDATE items SET due_date = ?, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL
+	`, dueDate, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetItemByID(id)
+}
+
+// DueList holds the due items of one list, see GetDueItems
+type DueList struct {
+	ListID   int64  `json:"list_id"`
+	ListName string `json:"list_name"`
+	ListIcon string `json:"list_icon"`
+	Items    []Item `json:"items"`
+}
+
+// GetDueItems returns the uncompleted items due before a YYYY-MM-DD date, overdue ones included,
+// grouped by list in list order and by due date within a list. listID limits them to one list unless 0
+func GetDueItems(before string, listID int64) ([]DueList, error) {
+	rows, err := DB.Query(`
+		SELECT l.id, l.name, l.icon, i.id, i.section_id, i.name, i.description, i.completed, i.uncertain, COALESCE(i.quantity, 0),
+			i.sort_order, i.created_at, COALESCE(i.updated_at, 0), i.completed_at, i.price_cents, i.currency,
+			i.due_date, i.due_date < date('now', 'localtime'),
+			i.photo, i.photo != '', CASE WHEN i.photo != '' THEN '/api/v1/items/' || i.id || '/photo' ELSE '' END, i.barcode
+		FROM items i
+		JOIN sections s ON s.id = i.section_id
+		JOIN lists l ON l.id = s.list_id
+		WHERE i.completed = 0 AND i.due_date != '' AND i.due_date < ? AND (? = 0 OR l.id = ?) AND i.deleted_at IS NULL
+		ORDER BY l.sort_order ASC, l.id ASC, i.due_date ASC, s.sort_order ASC, i.sort_order ASC
+	`, before, listID, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []DueList{}
+	for rows.Next() {
+		var l DueList
+		var i Item
+		err := rows.Scan(&l.ListID, &l.ListName, &l.ListIcon, &i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity,
+			&i.SortOrder, &i.CreatedAt, &i.UpdatedAt, &i.CompletedAt, &i.PriceCents, &i.Currency, &i.DueDate, &i.Overdue, &i.Photo, &i.HasPhoto, &i.PhotoURL, &i.Barcode)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(lists); n == 0 || lists[n-1].ListID != l.ListID {
+			lists = append(lists, l)
+		}
+		lists[len(lists)-1].Items = append(lists[len(lists)-1].Items, i)
+	}
+	return lists, rows.Err()
+}
+
+// PriceTotal sums the prices of the items of a list in one currency
+type PriceTotal struct {
+	Currency  string `json:"currency"`
+	Total     int64  `json:"total_cents"`     // Every item with a price, times its quantity
+	Remaining int64  `json:"remaining_cents"` // Items not completed yet
+	Items     int    `json:"items"`           // Items with a price in this currency
+}
+
+// PriceTotals sums the item prices of sections per currency, in the order the currencies first appear
+// An item counts price times quantity, once when it has no quantity. Items without a price are left out
+func PriceTotals(sections []Section) []PriceTotal {
+	totals := []PriceTotal{}
+	index := make(map[string]int)
+	for _, section := range sections {
+		for _, item := range section.Items {
+			if item.PriceCents == nil {
+				continue
+			}
+			i, ok := index[item.Currency]
+			if !ok {
+				i = len(totals)
+				index[item.Currency] = i
+				totals = append(totals, PriceTotal{Currency: item.Currency})
+			}
+			amount := *item.PriceCents * int64(max(item.Quantity, 1))
+			totals[i].Total += amount
+			if !item.Completed {
+				totals[i].Remaining += amount
+			}
+			totals[i].Items++
+		}
+	}
+	return totals
+}
+
+// DeleteItem moves an item to the trash, where it stays hidden until it is restored or purged
 func DeleteItem(id int64) error {
-	_, err := DB.Exec(`DELETE FROM items WHERE id = ?`, id)
+	_, err := writeDB.Exec(trashItemSQL, id)
 	return err
 }
 
-// DeleteCompletedItems deletes all completed items from the active list
+// trashItemSQL moves the item with the given ID to the trash
+const trashItemSQL = `UPDATE items SET deleted_at = strftime('%s', 'now'), updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL`
+
+// ItemRef identifies an item with the section and list it is in, for events about several items
+type ItemRef struct {
+	ID        int64 `json:"id"`
+	SectionID int64 `json:"section_id"`
+	ListID    int64 `json:"list_id"`
+}
+
+// findItemRefsTx looks up the items with the given IDs, with listID other than 0 only those of that list
+func findItemRefsTx(tx *sql.Tx, ids []int64, listID int64) (map[int64]ItemRef, error) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, 0, len(ids)+2)
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	args = append(args, listID, listID)
+	rows, err := tx.Query(fmt.Sprintf(`
+		SELECT i.id, i.section_id, s.list_id
+		FROM items i
+		JOIN sections s ON s.id = i.section_id
+		WHERE i.id IN (%s) AND (? = 0 OR s.list_id = ?) AND i.deleted_at IS NULL
+	`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[int64]ItemRef, len(ids))
+	for rows.Next() {
+		var ref ItemRef
+		if err := rows.Scan(&ref.ID, &ref.SectionID, &ref.ListID); err != nil {
+			return nil, err
+		}
+		found[ref.ID] = ref
+	}
+	return found, rows.Err()
+}
+
+// DeleteItemsBatch moves the items with the given IDs to the trash in one transaction and returns them
+// IDs without an item, or with listID other than 0 of an item in another list, are returned in notFound
+func DeleteItemsBatch(ids []int64, listID int64) (deleted []ItemRef, notFound []int64, err error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	found, err := findItemRefsTx(tx, ids, listID)
+	if err != nil {
+		return nil, nil, err
+	}
+	deleted, notFound = []ItemRef{}, []int64{}
+	for _, id := range ids {
+		ref, ok := found[id]
+		if !ok {
+			notFound = append(notFound, id)
+			continue
+		}
+		if _, err := tx.Exec(trashItemSQL, id); err != nil {
+			return nil, nil, err
+		}
+		deleted = append(deleted, ref)
+	}
+	return deleted, notFound, tx.Commit()
+}
+
+// SetItemsCompleted sets, rather than toggles, the completed flag of items in one transaction
+// It returns the items it changed and counts those already in that state as unchanged.
+// Missing IDs are returned in notFound like in DeleteItemsBatch
+func SetItemsCompleted(ids []int64, completed bool, listID int64) (changed []Item, unchanged int, notFound []int64, err error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer tx.Rollback()
+
+	found, err := findItemRefsTx(tx, ids, listID)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	changed, notFound = []Item{}, []int64{}
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			notFound = append(notFound, id)
+			continue
+		}
+		result, err := tx.Exec(`
+			UPDATE items SET
+				completed = ?,
+				completed_at = CASE WHEN ? THEN strftime('%s', 'now') ELSE NULL END,
+				updated_at = strftime('%s', 'now')
+			WHERE id = ? AND completed != ?
+		`, completed, completed, id, completed)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			unchanged++
+			continue
+		}
+		item, err := GetItemByIDTx(tx, id)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		changed = append(changed, *item)
+	}
+	return changed, unchanged, notFound, tx.Commit()
+}
+
+// DeleteCompletedItems moves all completed items of the active list to the trash
 func DeleteCompletedItems() (int64, error) {
 	activeList, err := GetActiveList()
 	if err != nil {
 		return 0, err
 	}
 
-	result, err := DB.Exec(`
-		DELETE FROM items WHERE completed = TRUE AND section_id IN (
+	result, err := writeDB.Exec(`
+		UPDATE items SET deleted_at = strftime('%s', 'now'), updated_at = strftime('%s', 'now')
+		WHERE completed = TRUE AND deleted_at IS NULL AND section_id IN (
 			SELECT id FROM sections WHERE list_id = ?
 		)
 	`, activeList.ID)
@@ -591,7 +887,16 @@ func DeleteCompletedItems() (int64, error) {
 }
 
 func ToggleItemCompleted(id int64) (*Item, error) {
-	_, err := DB.Exec(`UPDATE items SET completed = NOT completed, updated_at = strftime('%s', 'now') WHERE id = ?`, id)
+	err := WithRetry(func() error {
+		_, err := writeDB.Exec(`
+			UPDATE items SET
+				completed = NOT completed,
+				completed_at = CASE WHEN completed THEN NULL ELSE strftime('%s', 'now') END,
+				updated_at = strftime('%s', 'now')
+			WHERE id = ? AND deleted_at IS NULL
+		`, id)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -599,7 +904,10 @@ func ToggleItemCompleted(id int64) (*Item, error) {
 }
 
 func ToggleItemUncertain(id int64) (*Item, error) {
-	_, err := DB.Exec(`UPDATE items SET uncertain = NOT uncertain, updated_at = strftime('%s', 'now') WHERE id = ?`, id)
+	err := WithRetry(func() error {
+		_, err := writeDB.Exec(`UPDATE items SET uncertain = NOT uncertain, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL`, id)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -609,10 +917,10 @@ func ToggleItemUncertain(id int64) (*Item, error) {
 func MoveItemToSection(id, newSectionID int64) (*Item, error) {
 	// Get max sort_order in new section
 	var maxOrder int
-	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", newSectionID).Scan(&maxOrder)
+	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ? AND deleted_at IS NULL", newSectionID).Scan(&maxOrder)
 
-	_, err := DB.Exec(`
-		UPDATE items SET section_id = ?, sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?
+	_, err := writeDB.Exec(`
+		UPDATE items SET section_id = ?, sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL
 	`, newSectionID, maxOrder+1, id)
 	if err != nil {
 		return nil, err
@@ -622,7 +930,7 @@ func MoveItemToSection(id, newSectionID int64) (*Item, error) {
 
 // MoveItemToSectionAtPosition moves an item to a new section at a specific position among ACTIVE items
 func MoveItemToSectionAtPosition(id, newSectionID int64, targetPosition int) (*Item, error) {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return nil, err
 	}
@@ -630,7 +938,7 @@ func MoveItemToSectionAtPosition(id, newSectionID int64, targetPosition int) (*I
 
 	// Verify item exists and get current section
 	var currentSectionID int64
-	err = tx.QueryRow("SELECT section_id FROM items WHERE id = ?", id).Scan(&currentSectionID)
+	err = tx.QueryRow("SELECT section_id FROM items WHERE id = ? AND deleted_at IS NULL", id).Scan(&currentSectionID)
 	if err != nil {
 		return nil, err // Item not found
 	}
@@ -644,7 +952,7 @@ func MoveItemToSectionAtPosition(id, newSectionID int64, targetPosition int) (*I
 	// Get all ACTIVE items in target section, ordered by sort_order
 	rows, err := tx.Query(`
 		SELECT id, sort_order FROM items
-		WHERE section_id = ? AND completed = FALSE
+		WHERE section_id = ? AND completed = FALSE AND deleted_at IS NULL
 		ORDER BY sort_order ASC
 	`, newSectionID)
 	if err != nil {
@@ -671,7 +979,7 @@ func MoveItemToSectionAtPosition(id, newSectionID int64, targetPosition int) (*I
 	if len(activeItems) == 0 {
 		// No active items - check if there are ANY items (completed) and use max+1
 		var maxOrder int
-		err = tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", newSectionID).Scan(&maxOrder)
+		err = tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ? AND deleted_at IS NULL", newSectionID).Scan(&maxOrder)
 		if err != nil {
 			return nil, err
 		}
@@ -689,7 +997,7 @@ func MoveItemToSectionAtPosition(id, newSectionID int64, targetPosition int) (*I
 
 	// Shift all items with sort_order >= targetSortOrder up by 1
 	_, err = tx.Exec(`
-		UPDATE items SET sort_order = sort_order + 1
+		UPDATE items SET sort_order = sort_order + 1, updated_at = strftime('%s', 'now')
 		WHERE section_id = ? AND sort_order >= ?
 	`, newSectionID, targetSortOrder)
 	if err != nil {
@@ -714,7 +1022,7 @@ func MoveItemToSectionAtPosition(id, newSectionID int64, targetPosition int) (*I
 
 // reorderItemInSection moves an item to a specific position within its current section
 func reorderItemInSection(id int64, targetPosition int) (*Item, error) {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return nil, err
 	}
@@ -723,7 +1031,7 @@ func reorderItemInSection(id int64, targetPosition int) (*Item, error) {
 	// Get item's current section and sort_order
 	var sectionID int64
 	var currentSortOrder int
-	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ?", id).Scan(&sectionID, &currentSortOrder)
+	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ? AND deleted_at IS NULL", id).Scan(&sectionID, &currentSortOrder)
 	if err != nil {
 		return nil, err
 	}
@@ -731,7 +1039,7 @@ func reorderItemInSection(id int64, targetPosition int) (*Item, error) {
 	// Get all ACTIVE items in section (excluding the moved item), ordered by sort_order
 	rows, err := tx.Query(`
 		SELECT id, sort_order FROM items
-		WHERE section_id = ? AND completed = FALSE AND id != ?
+		WHERE section_id = ? AND completed = FALSE AND id != ? AND deleted_at IS NULL
 		ORDER BY sort_order ASC
 	`, sectionID, id)
 	if err != nil {
@@ -766,13 +1074,13 @@ func reorderItemInSection(id int64, targetPosition int) (*Item, error) {
 	for i, item := range otherItems {
 		if i == targetPosition {
 			// Insert moved item here
-			_, err = tx.Exec("UPDATE items SET sort_order = ? WHERE id = ?", newOrder, id)
+			_, err = tx.Exec("UPDATE items SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?", newOrder, id)
 			if err != nil {
 				return nil, err
 			}
 			newOrder++
 		}
-		_, err = tx.Exec("UPDATE items SET sort_order = ? WHERE id = ?", newOrder, item.id)
+		_, err = tx.Exec("UPDATE items SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?", newOrder, item.id)
 		if err != nil {
 			return nil, err
 		}
@@ -781,7 +1089,7 @@ func reorderItemInSection(id int64, targetPosition int) (*Item, error) {
 
 	// If target is at end
 	if targetPosition >= len(otherItems) {
-		_, err = tx.Exec("UPDATE items SET sort_order = ? WHERE id = ?", newOrder, id)
+		_, err = tx.Exec("UPDATE items SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?", newOrder, id)
 		if err != nil {
 			return nil, err
 		}
@@ -795,7 +1103,7 @@ func reorderItemInSection(id int64, targetPosition int) (*Item, error) {
 }
 
 func MoveItemUp(id int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
@@ -803,7 +1111,7 @@ func MoveItemUp(id int64) error {
 
 	var sectionID int64
 	var sortOrder int
-	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ?", id).Scan(&sectionID, &sortOrder)
+	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ? AND deleted_at IS NULL", id).Scan(&sectionID, &sortOrder)
 	if err != nil {
 		return err
 	}
@@ -813,7 +1121,7 @@ func MoveItemUp(id int64) error {
 	var prevSortOrder int
 	err = tx.QueryRow(`
 		SELECT id, sort_order FROM items
-		WHERE section_id = ? AND sort_order < ?
+		WHERE section_id = ? AND sort_order < ? AND deleted_at IS NULL
 		ORDER BY sort_order DESC
 		LIMIT 1
 	`, sectionID, sortOrder).Scan(&prevID, &prevSortOrder)
@@ -826,11 +1134,11 @@ func MoveItemUp(id int64) error {
 	}
 
 	// Swap sort_order values
-	_, err = tx.Exec("UPDATE items SET sort_order = ? WHERE id = ?", sortOrder, prevID)
+	_, err = tx.Exec("UPDATE items SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?", sortOrder, prevID)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("UPDATE items SET sort_order = ? WHERE id = ?", prevSortOrder, id)
+	_, err = tx.Exec("UPDATE items SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?", prevSortOrder, id)
 	if err != nil {
 		return err
 	}
@@ -839,7 +1147,7 @@ func MoveItemUp(id int64) error {
 }
 
 func MoveItemDown(id int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
@@ -847,7 +1155,7 @@ func MoveItemDown(id int64) error {
 
 	var sectionID int64
 	var sortOrder int
-	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ?", id).Scan(&sectionID, &sortOrder)
+	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ? AND deleted_at IS NULL", id).Scan(&sectionID, &sortOrder)
 	if err != nil {
 		return err
 	}
@@ -857,7 +1165,7 @@ func MoveItemDown(id int64) error {
 	var nextSortOrder int
 	err = tx.QueryRow(`
 		SELECT id, sort_order FROM items
-		WHERE section_id = ? AND sort_order > ?
+		WHERE section_id = ? AND sort_order > ? AND deleted_at IS NULL
 		ORDER BY sort_order ASC
 		LIMIT 1
 	`, sectionID, sortOrder).Scan(&nextID, &nextSortOrder)
@@ -870,11 +1178,11 @@ func MoveItemDown(id int64) error {
 	}
 
 	// Swap sort_order values
-	_, err = tx.Exec("UPDATE items SET sort_order = ? WHERE id = ?", sortOrder, nextID)
+	_, err = tx.Exec("UPDATE items SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?", sortOrder, nextID)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("UPDATE items SET sort_order = ? WHERE id = ?", nextSortOrder, id)
+	_, err = tx.Exec("UPDATE items SET sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ?", nextSortOrder, id)
 	if err != nil {
 		return err
 	}
@@ -885,7 +1193,7 @@ func MoveItemDown(id int64) error {
 // ==================== SESSIONS ====================
 
 func CreateSession(id string, expiresAt int64) error {
-	_, err := DB.Exec(`INSERT INTO sessions (id, expires_at) VALUES (?, ?)`, id, expiresAt)
+	_, err := writeDB.Exec(`INSERT INTO sessions (id, expires_at) VALUES (?, ?)`, id, expiresAt)
 	return err
 }
 
@@ -899,12 +1207,12 @@ func GetSession(id string) (*Session, error) {
 }
 
 func DeleteSession(id string) error {
-	_, err := DB.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	_, err := writeDB.Exec(`DELETE FROM sessions WHERE id = ?`, id)
 	return err
 }
 
 func CleanExpiredSessions() error {
-	_, err := DB.Exec(`DELETE FROM sessions WHERE expires_at < ?`, time.Now().Unix())
+	_, err := writeDB.Exec(`DELETE FROM sessions WHERE expires_at < ?`, time.Now().Unix())
 	return err
 }
 
@@ -928,8 +1236,8 @@ func GetStats() Stats {
 // getGlobalStats returns stats for all items (fallback)
 func getGlobalStats() Stats {
 	var stats Stats
-	DB.QueryRow("SELECT COUNT(*) FROM items").Scan(&stats.TotalItems)
-	DB.QueryRow("SELECT COUNT(*) FROM items WHERE completed = TRUE").Scan(&stats.CompletedItems)
+	DB.QueryRow("SELECT COUNT(*) FROM items WHERE deleted_at IS NULL").Scan(&stats.TotalItems)
+	DB.QueryRow("SELECT COUNT(*) FROM items WHERE completed = TRUE AND deleted_at IS NULL").Scan(&stats.CompletedItems)
 	if stats.TotalItems > 0 {
 		stats.Percentage = (stats.CompletedItems * 100) / stats.TotalItems
 	}
@@ -946,8 +1254,8 @@ type SectionStats struct {
 
 func GetSectionStats(sectionID int64) SectionStats {
 	var stats SectionStats
-	DB.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ?", sectionID).Scan(&stats.TotalItems)
-	DB.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ? AND completed = TRUE", sectionID).Scan(&stats.CompletedItems)
+	DB.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ? AND deleted_at IS NULL", sectionID).Scan(&stats.TotalItems)
+	DB.QueryRow("SELECT COUNT(*) FROM items WHERE section_id = ? AND completed = TRUE AND deleted_at IS NULL", sectionID).Scan(&stats.CompletedItems)
 	if stats.TotalItems > 0 {
 		stats.Percentage = (stats.CompletedItems * 100) / stats.TotalItems
 	}
@@ -957,7 +1265,7 @@ func GetSectionStats(sectionID int64) SectionStats {
 // ==================== BATCH DELETE SECTIONS ====================
 
 func DeleteSections(ids []int64) error {
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
@@ -984,7 +1292,7 @@ type ItemSuggestion struct {
 
 // SaveItemHistory saves or updates item name in history for auto-completion
 func SaveItemHistory(name string, sectionID int64) error {
-	_, err := DB.Exec(`
+	_, err := writeDB.Exec(`
 		INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
 		VALUES (?, ?, 1, strftime('%s', 'now'))
 		ON CONFLICT(name COLLATE NOCASE) DO UPDATE SET
@@ -997,7 +1305,7 @@ func SaveItemHistory(name string, sectionID int64) error {
 
 // SaveItemHistoryWithCount saves item history with a specific usage count (used for import)
 func SaveItemHistoryWithCount(name string, sectionID int64, usageCount int) error {
-	_, err := DB.Exec(`
+	_, err := writeDB.Exec(`
 		INSERT INTO item_history (name, last_section_id, usage_count, last_used_at)
 		VALUES (?, ?, ?, strftime('%s', 'now'))
 		ON CONFLICT(name COLLATE NOCASE) DO UPDATE SET
@@ -1161,8 +1469,10 @@ func GetItemSuggestions(query string, limit int) ([]ItemSuggestion, error) {
 }
 
 // GetAllItemSuggestions returns all item suggestions for offline cache
+// A limit of 0 returns 100, a negative limit returns every entry
 func GetAllItemSuggestions(limit int) ([]ItemSuggestion, error) {
-	if limit <= 0 {
+	// SQLite reads a negative limit as no limit
+	if limit == 0 {
 		limit = 100
 	}
 
@@ -1189,6 +1499,31 @@ func GetAllItemSuggestions(limit int) ([]ItemSuggestion, error) {
 	return suggestions, nil
 }
 
+// GetListItemSuggestions returns the history entries whose last section belongs to a list, most used first
+func GetListItemSuggestions(listID int64) ([]ItemSuggestion, error) {
+	rows, err := DB.Query(`
+		SELECT h.name, h.last_section_id, s.name, h.usage_count
+		FROM item_history h
+		JOIN sections s ON h.last_section_id = s.id
+		WHERE s.list_id = ?
+		ORDER BY h.usage_count DESC, h.last_used_at DESC
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []ItemSuggestion
+	for rows.Next() {
+		var s ItemSuggestion
+		if err := rows.Scan(&s.Name, &s.LastSectionID, &s.LastSectionName, &s.UsageCount); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
 // HistoryItem represents an item from history with ID for management
 type HistoryItem struct {
 	ID              int64  `json:"id"`
@@ -1196,12 +1531,18 @@ type HistoryItem struct {
 	LastSectionID   int64  `json:"last_section_id"`
 	LastSectionName string `json:"last_section_name"`
 	UsageCount      int    `json:"usage_count"`
+	LastUsedAt      int64  `json:"last_used_at"`
+	CompletedCount  int    `json:"completed_count"`             // Times the item was cleared from a list as completed with archive
+	LastCompletedAt *int64 `json:"last_completed_at,omitempty"` // Unix time of the last of those completions
+	// LastUsedAtDisplay is filled in by handlers for the request language
+	LastUsedAtDisplay string `json:"last_used_at_display,omitempty"`
 }
 
 // GetItemHistoryList returns all history items for management UI
 func GetItemHistoryList() ([]HistoryItem, error) {
 	rows, err := DB.Query(`
-		SELECT h.id, h.name, COALESCE(h.last_section_id, 0), COALESCE(s.name, ''), h.usage_count
+		SELECT h.id, h.name, COALESCE(h.last_section_id, 0), COALESCE(s.name, ''), h.usage_count, COALESCE(h.last_used_at, 0),
+			h.completed_count, h.last_completed_at
 		FROM item_history h
 		LEFT JOIN sections s ON h.last_section_id = s.id
 		ORDER BY h.usage_count DESC, h.last_used_at DESC
@@ -1215,7 +1556,7 @@ func GetItemHistoryList() ([]HistoryItem, error) {
 	var items []HistoryItem
 	for rows.Next() {
 		var h HistoryItem
-		if err := rows.Scan(&h.ID, &h.Name, &h.LastSectionID, &h.LastSectionName, &h.UsageCount); err != nil {
+		if err := rows.Scan(&h.ID, &h.Name, &h.LastSectionID, &h.LastSectionName, &h.UsageCount, &h.LastUsedAt, &h.CompletedCount, &h.LastCompletedAt); err != nil {
 			return nil, err
 		}
 		items = append(items, h)
@@ -1225,7 +1566,7 @@ func GetItemHistoryList() ([]HistoryItem, error) {
 
 // DeleteItemHistory deletes a single item from history
 func DeleteItemHistory(id int64) error {
-	result, err := DB.Exec("DELETE FROM item_history WHERE id = ?", id)
+	result, err := writeDB.Exec("DELETE FROM item_history WHERE id = ?", id)
 	if err != nil {
 		return err
 	}
@@ -1251,7 +1592,7 @@ func DeleteItemHistoryBatch(ids []int64) (int64, error) {
 	}
 
 	query := fmt.Sprintf("DELETE FROM item_history WHERE id IN (%s)", strings.Join(placeholders, ","))
-	result, err := DB.Exec(query, args...)
+	result, err := writeDB.Exec(query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -1335,7 +1676,7 @@ func CreateTemplate(name, description string) (*Template, error) {
 	var maxOrder int
 	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM templates").Scan(&maxOrder)
 
-	result, err := DB.Exec(`
+	result, err := writeDB.Exec(`
 		INSERT INTO templates (name, description, sort_order) VALUES (?, ?, ?)
 	`, name, description, maxOrder+1)
 	if err != nil {
@@ -1348,7 +1689,7 @@ func CreateTemplate(name, description string) (*Template, error) {
 
 // UpdateTemplate updates a template's name and description
 func UpdateTemplate(id int64, name, description string) (*Template, error) {
-	_, err := DB.Exec(`
+	_, err := writeDB.Exec(`
 		UPDATE templates SET name = ?, description = ?, updated_at = strftime('%s', 'now') WHERE id = ?
 	`, name, description, id)
 	if err != nil {
@@ -1359,7 +1700,7 @@ func UpdateTemplate(id int64, name, description string) (*Template, error) {
 
 // DeleteTemplate deletes a template and all its items
 func DeleteTemplate(id int64) error {
-	_, err := DB.Exec(`DELETE FROM templates WHERE id = ?`, id)
+	_, err := writeDB.Exec(`DELETE FROM templates WHERE id = ?`, id)
 	return err
 }
 
@@ -1368,7 +1709,7 @@ func AddTemplateItem(templateID int64, sectionName, name, description string) (*
 	var maxOrder int
 	DB.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM template_items WHERE template_id = ?", templateID).Scan(&maxOrder)
 
-	result, err := DB.Exec(`
+	result, err := writeDB.Exec(`
 		INSERT INTO template_items (template_id, section_name, name, description, sort_order)
 		VALUES (?, ?, ?, ?, ?)
 	`, templateID, sectionName, name, description, maxOrder+1)
@@ -1395,7 +1736,7 @@ func GetTemplateItemByID(id int64) (*TemplateItem, error) {
 
 // UpdateTemplateItem updates a template item
 func UpdateTemplateItem(id int64, sectionName, name, description string) (*TemplateItem, error) {
-	_, err := DB.Exec(`
+	_, err := writeDB.Exec(`
 		UPDATE template_items SET section_name = ?, name = ?, description = ? WHERE id = ?
 	`, sectionName, name, description, id)
 	if err != nil {
@@ -1406,10 +1747,37 @@ func UpdateTemplateItem(id int64, sectionName, name, description string) (*Templ
 
 // DeleteTemplateItem deletes a template item
 func DeleteTemplateItem(id int64) error {
-	_, err := DB.Exec(`DELETE FROM template_items WHERE id = ?`, id)
+	_, err := writeDB.Exec(`DELETE FROM template_items WHERE id = ?`, id)
 	return err
 }
 
+// findSectionTx returns the id of the list's section matching name, 0 if there is none
+// Well-known sections match in any language, so a template's "General" finds "Загальне"
+func findSectionTx(tx *sql.Tx, listID int64, name string) (int64, error) {
+	rows, err := tx.Query("SELECT id, name FROM sections WHERE list_id = ? ORDER BY sort_order", listID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var fallbackID int64
+	for rows.Next() {
+		var id int64
+		var sectionName string
+		if err := rows.Scan(&id, &sectionName); err != nil {
+			return 0, err
+		}
+		// An exact match wins over a translated one
+		if strings.EqualFold(sectionName, name) {
+			return id, nil
+		}
+		if fallbackID == 0 && i18n.SameSection(sectionName, name) {
+			fallbackID = id
+		}
+	}
+	return fallbackID, rows.Err()
+}
+
 // ApplyTemplateToList applies a template to a list (adds items from template)
 func ApplyTemplateToList(templateID, listID int64) error {
 	template, err := GetTemplateByID(templateID)
@@ -1417,27 +1785,40 @@ func ApplyTemplateToList(templateID, listID int64) error {
 		return err
 	}
 
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Group items by section name
+	// Group items by section, default sections named in different languages are one group
+	var sectionNames []string
 	sectionItems := make(map[string][]TemplateItem)
 	for _, item := range template.Items {
-		sectionItems[item.SectionName] = append(sectionItems[item.SectionName], item)
+		sectionName := item.SectionName
+		for _, existing := range sectionNames {
+			if i18n.SameSection(existing, sectionName) {
+				sectionName = existing
+				break
+			}
+		}
+		if _, ok := sectionItems[sectionName]; !ok {
+			sectionNames = append(sectionNames, sectionName)
+		}
+		sectionItems[sectionName] = append(sectionItems[sectionName], item)
 	}
 
 	// For each section in template
-	for sectionName, items := range sectionItems {
-		// Find or create section in target list
-		var sectionID int64
-		err := tx.QueryRow(`
-			SELECT id FROM sections WHERE list_id = ? AND name = ? COLLATE NOCASE
-		`, listID, sectionName).Scan(&sectionID)
+	for _, sectionName := range sectionNames {
+		items := sectionItems[sectionName]
 
+		// Find or create section in target list
+		sectionID, err := findSectionTx(tx, listID, sectionName)
 		if err != nil {
+			return err
+		}
+
+		if sectionID == 0 {
 			// Section doesn't exist, create it
 			var maxOrder int
 			tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM sections WHERE list_id = ?", listID).Scan(&maxOrder)
@@ -1454,7 +1835,7 @@ func ApplyTemplateToList(templateID, listID int64) error {
 		// Add items to section
 		for _, item := range items {
 			var maxItemOrder int
-			tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", sectionID).Scan(&maxItemOrder)
+			tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ? AND deleted_at IS NULL", sectionID).Scan(&maxItemOrder)
 
 			_, err := tx.Exec(`
 				INSERT INTO items (section_id, name, description, sort_order)
@@ -1486,7 +1867,7 @@ func CreateTemplateFromList(listID int64, templateName, templateDescription stri
 		return nil, err
 	}
 
-	tx, err := DB.Begin()
+	tx, err := BeginWrite()
 	if err != nil {
 		return nil, err
 	}
@@ -1551,9 +1932,9 @@ func CreateListTx(tx *sql.Tx, name, icon string) (*List, error) {
 
 	var l List
 	err = tx.QueryRow(`
-		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, created_at, COALESCE(updated_at, 0)
+		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, archived, created_at, COALESCE(updated_at, 0)
 		FROM lists WHERE id = ?
-	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.CreatedAt, &l.UpdatedAt)
+	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.Archived, &l.CreatedAt, &l.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -1596,15 +1977,117 @@ func CreateItemTx(tx *sql.Tx, sectionID int64, name, description string, quantit
 
 	var i Item
 	err = tx.QueryRow(`
-		SELECT id, section_id, name, description, completed, uncertain, COALESCE(quantity, 0), sort_order, created_at, COALESCE(updated_at, 0)
-		FROM items WHERE id = ?
-	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt)
+		SELECT id, section_id, name, description, completed, uncertain, COALESCE(quantity, 0), sort_order, created_at, COALESCE(updated_at, 0), completed_at, price_cents, currency,
+			due_date, (due_date != '' AND due_date < date('now', 'localtime') AND completed = 0),
+			photo, photo != '', CASE WHEN photo != '' THEN '/api/v1/items/' || id || '/photo' ELSE '' END, barcode
+		FROM items WHERE id = ? AND deleted_at IS NULL
+	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt, &i.CompletedAt, &i.PriceCents, &i.Currency, &i.DueDate, &i.Overdue, &i.Photo, &i.HasPhoto, &i.PhotoURL, &i.Barcode)
 	if err != nil {
 		return nil, err
 	}
 	return &i, nil
 }
 
+// ItemFields are the fields an item create or update writes in one statement
+// In an update a nil Price, DueDate or Barcode keeps the item's current value
+type ItemFields struct {
+	Name        string
+	Description string
+	Quantity    int
+	Price       *ItemPrice
+	DueDate     *string
+	Barcode     *string
+}
+
+// ItemPrice is a price in cents with its currency, a nil Cents clears both
+type ItemPrice struct {
+	Cents    *int64
+	Currency string
+}
+
+// priceArgs returns whether the price is set and its cents and currency as statement arguments
+func (f ItemFields) priceArgs() (bool, *int64, string) {
+	if f.Price == nil {
+		return false, nil, ""
+	}
+	if f.Price.Cents == nil {
+		return true, nil, ""
+	}
+	return true, f.Price.Cents, f.Price.Currency
+}
+
+// CreateItemWithFieldsTx creates an item at the end of its section with all its fields in one INSERT
+func CreateItemWithFieldsTx(tx *sql.Tx, sectionID int64, f ItemFields) (*Item, error) {
+	_, cents, currency := f.priceArgs()
+	dueDate, barcode := "", ""
+	if f.DueDate != nil {
+		dueDate = *f.DueDate
+	}
+	if f.Barcode != nil {
+		barcode = *f.Barcode
+	}
+	result, err := tx.Exec(`
+		INSERT INTO items (section_id, name, description, quantity, sort_order, price_cents, currency, due_date, barcode)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(sort_order), -1) + 1 FROM items WHERE section_id = ? AND deleted_at IS NULL), ?, ?, ?, ?)
+	`, sectionID, f.Name, f.Description, f.Quantity, sectionID, cents, currency, dueDate, barcode)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	return GetItemByIDTx(tx, id)
+}
+
+// CreateItemWithFields creates an item with all its fields, like CreateItemWithFieldsTx
+func CreateItemWithFields(sectionID int64, f ItemFields) (*Item, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	item, err := CreateItemWithFieldsTx(tx, sectionID, f)
+	if err != nil {
+		return nil, err
+	}
+	return item, tx.Commit()
+}
+
+// UpdateItemWithFields updates an item's fields, like UpdateItemWithFieldsTx
+func UpdateItemWithFields(id int64, f ItemFields) (*Item, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	item, err := UpdateItemWithFieldsTx(tx, id, f)
+	if err != nil {
+		return nil, err
+	}
+	return item, tx.Commit()
+}
+
+// UpdateItemWithFieldsTx updates an item's fields in one UPDATE, sql.ErrNoRows when it does not exist or is deleted
+func UpdateItemWithFieldsTx(tx *sql.Tx, id int64, f ItemFields) (*Item, error) {
+	setPrice, cents, currency := f.priceArgs()
+	result, err := tx.Exec(`
+		UPDATE items SET name = ?, description = ?, quantity = ?,
+			price_cents = CASE WHEN ? THEN ? ELSE price_cents END,
+			currency = CASE WHEN ? THEN ? ELSE currency END,
+			due_date = COALESCE(?, due_date),
+			barcode = COALESCE(?, barcode),
+			updated_at = strftime('%s', 'now')
+		WHERE id = ? AND deleted_at IS NULL
+	`, f.Name, f.Description, f.Quantity, setPrice, cents, setPrice, currency, f.DueDate, f.Barcode, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return GetItemByIDTx(tx, id)
+}
+
 // SaveItemHistoryTx saves item name to history within a transaction
 func SaveItemHistoryTx(tx *sql.Tx, name string, sectionID int64) {
 	tx.Exec(`
@@ -1616,6 +2099,35 @@ func SaveItemHistoryTx(tx *sql.Tx, name string, sectionID int64) {
 	`, name, sectionID)
 }
 
+// CreateTemplateTx creates a template within a transaction and returns its ID
+func CreateTemplateTx(tx *sql.Tx, name, description string) (int64, error) {
+	var maxOrder int
+	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM templates").Scan(&maxOrder)
+
+	result, err := tx.Exec(`
+		INSERT INTO templates (name, description, sort_order) VALUES (?, ?, ?)
+	`, name, description, maxOrder+1)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// AddTemplateItemTx adds an item to a template within a transaction and returns its id
+func AddTemplateItemTx(tx *sql.Tx, templateID int64, sectionName, name, description string) (int64, error) {
+	var maxOrder int
+	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM template_items WHERE template_id = ?", templateID).Scan(&maxOrder)
+
+	result, err := tx.Exec(`
+		INSERT INTO template_items (template_id, section_name, name, description, sort_order)
+		VALUES (?, ?, ?, ?, ?)
+	`, templateID, sectionName, name, description, maxOrder+1)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
 // GetMaxSectionOrderTx gets max sort_order for sections in a list within a transaction
 func GetMaxSectionOrderTx(tx *sql.Tx, listID int64) int {
 	var maxOrder int
@@ -1626,10 +2138,169 @@ func GetMaxSectionOrderTx(tx *sql.Tx, listID int64) int {
 // GetMaxItemOrderTx gets max sort_order for items in a section within a transaction
 func GetMaxItemOrderTx(tx *sql.Tx, sectionID int64) int {
 	var maxOrder int
-	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ?", sectionID).Scan(&maxOrder)
+	tx.QueryRow("SELECT COALESCE(MAX(sort_order), -1) FROM items WHERE section_id = ? AND deleted_at IS NULL", sectionID).Scan(&maxOrder)
 	return maxOrder
 }
 
+// ListNameExistsTx checks if a list with the given name exists (case-insensitive) within a transaction
+func ListNameExistsTx(tx *sql.Tx, name string) (bool, error) {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM lists WHERE name = ? COLLATE NOCASE", name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetListByIDTx returns a list within a transaction, without stats
+func GetListByIDTx(tx *sql.Tx, id int64) (*List, error) {
+	var l List
+	err := tx.QueryRow(`
+		SELECT id, name, COALESCE(icon, '🛒'), sort_order, is_active, archived, created_at, COALESCE(updated_at, 0)
+		FROM lists WHERE id = ?
+	`, id).Scan(&l.ID, &l.Name, &l.Icon, &l.SortOrder, &l.IsActive, &l.Archived, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetSectionByIDTx returns a section within a transaction, without its items
+func GetSectionByIDTx(tx *sql.Tx, id int64) (*Section, error) {
+	var s Section
+	err := tx.QueryRow(`
+		SELECT id, list_id, name, sort_order, created_at, COALESCE(updated_at, 0)
+		FROM sections WHERE id = ?
+	`, id).Scan(&s.ID, &s.ListID, &s.Name, &s.SortOrder, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.Items = []Item{}
+	return &s, nil
+}
+
+// GetItemByIDTx returns an item within a transaction
+func GetItemByIDTx(tx *sql.Tx, id int64) (*Item, error) {
+	var i Item
+	err := tx.QueryRow(`
+		SELECT id, section_id, name, description, completed, uncertain, COALESCE(quantity, 0), sort_order, created_at, COALESCE(updated_at, 0), completed_at, price_cents, currency,
+			due_date, (due_date != '' AND due_date < date('now', 'localtime') AND completed = 0),
+			photo, photo != '', CASE WHEN photo != '' THEN '/api/v1/items/' || id || '/photo' ELSE '' END, barcode
+		FROM items WHERE id = ? AND deleted_at IS NULL
+	`, id).Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt, &i.UpdatedAt, &i.CompletedAt, &i.PriceCents, &i.Currency, &i.DueDate, &i.Overdue, &i.Photo, &i.HasPhoto, &i.PhotoURL, &i.Barcode)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// UpdateSectionTx renames a section within a transaction
+func UpdateSectionTx(tx *sql.Tx, id int64, name string) (*Section, error) {
+	_, err := tx.Exec(`UPDATE sections SET name = ?, updated_at = strftime('%s', 'now') WHERE id = ?`, name, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetSectionByIDTx(tx, id)
+}
+
+// ToggleItemCompletedTx toggles the completed status of an item within a transaction
+func ToggleItemCompletedTx(tx *sql.Tx, id int64) (*Item, error) {
+	_, err := tx.Exec(`
+		UPDATE items SET
+			completed = NOT completed,
+			completed_at = CASE WHEN completed THEN NULL ELSE strftime('%s', 'now') END,
+			updated_at = strftime('%s', 'now')
+		WHERE id = ? AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetItemByIDTx(tx, id)
+}
+
+// ToggleItemUncertainTx toggles the uncertain status of an item within a transaction
+func ToggleItemUncertainTx(tx *sql.Tx, id int64) (*Item, error) {
+	_, err := tx.Exec(`UPDATE items SET uncertain = NOT uncertain, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL`, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetItemByIDTx(tx, id)
+}
+
+// MoveItemToSectionTx moves an item to the end of another section within a transaction
+func MoveItemToSectionTx(tx *sql.Tx, id, newSectionID int64) (*Item, error) {
+	_, err := tx.Exec(`
+		UPDATE items SET section_id = ?, sort_order = ?, updated_at = strftime('%s', 'now') WHERE id = ? AND deleted_at IS NULL
+	`, newSectionID, GetMaxItemOrderTx(tx, newSectionID)+1, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetItemByIDTx(tx, id)
+}
+
+// ItemListMove is an item moved to another list by MoveItemToList, with where it came from
+type ItemListMove struct {
+	Item           *Item
+	From           ItemRef
+	ListID         int64
+	CreatedSection *Section // The section created in the target list, nil when one was found
+}
+
+// MoveItemToList moves an item to the end of a section of another list in one transaction and closes the
+// gap it leaves in its old section. The section is found by name like pasted ones and created when missing,
+// without a name the list's first section is used, or one named defaultName in a list without sections.
+// A list the item is already in keeps it in its own section unless sectionName names another
+func MoveItemToList(id, listID int64, sectionName, defaultName string) (*ItemListMove, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	refs, err := findItemRefsTx(tx, []int64{id}, 0)
+	if err != nil {
+		return nil, err
+	}
+	from, ok := refs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	move := &ItemListMove{From: from, ListID: listID}
+
+	var sectionID int64
+	switch {
+	case sectionName != "":
+		if sectionID, err = findSectionTx(tx, listID, sectionName); err != nil {
+			return nil, err
+		}
+	case listID == from.ListID:
+		sectionID = from.SectionID
+	default:
+		err = tx.QueryRow("SELECT id FROM sections WHERE list_id = ? ORDER BY sort_order ASC, id ASC LIMIT 1", listID).Scan(&sectionID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		sectionName = defaultName
+	}
+	if sectionID == 0 {
+		move.CreatedSection, err = CreateSectionForListTx(tx, listID, sectionName, GetMaxSectionOrderTx(tx, listID)+1)
+		if err != nil {
+			return nil, err
+		}
+		sectionID = move.CreatedSection.ID
+	}
+
+	if move.Item, err = MoveItemToSectionTx(tx, id, sectionID); err != nil {
+		return nil, err
+	}
+	if sectionID != from.SectionID {
+		if err := renumberItemsTx(tx, from.SectionID); err != nil {
+			return nil, err
+		}
+	}
+	return move, tx.Commit()
+}
+
 // GetSectionIDByNameTx finds section ID by name (case-insensitive) within a transaction
 // Returns 0 if section not found
 func GetSectionIDByNameTx(tx *sql.Tx, sectionName string) int64 {
@@ -1657,7 +2328,7 @@ func GetSectionNameForItem(itemName string) string {
 	err := DB.QueryRow(`
 		SELECT s.name FROM items i
 		JOIN sections s ON i.section_id = s.id
-		WHERE i.name = ? COLLATE NOCASE
+		WHERE i.name = ? COLLATE NOCASE AND i.deleted_at IS NULL
 		LIMIT 1
 	`, itemName).Scan(&sectionName)
 
@@ -1669,47 +2340,95 @@ func GetSectionNameForItem(itemName string) string {
 
 // ==================== DATABASE CLEAR ====================
 
-// ClearAllData clears all user data from database (lists, sections, items, templates, history)
-// Sessions are preserved so user remains logged in
-func ClearAllData() error {
-	tx, err := DB.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+// Clear targets for ClearData
+const (
+	ClearTargetLists          = "lists"
+	ClearTargetCompletedItems = "completed_items"
+	ClearTargetTemplates      = "templates"
+	ClearTargetHistory        = "history"
+	ClearTargetSettings       = "settings"
+	ClearTargetTokens         = "tokens"
+)
 
-	// Delete in proper order due to foreign key constraints
-	// 1. template_items (references templates)
-	if _, err := tx.Exec("DELETE FROM template_items"); err != nil {
-		return fmt.Errorf("failed to delete template_items: %w", err)
-	}
+// ClearTargets lists the user data targets, in the order they are executed
+var ClearTargets = []string{
+	ClearTargetTemplates,
+	ClearTargetCompletedItems,
+	ClearTargetLists,
+	ClearTargetHistory,
+}
 
-	// 2. templates
-	if _, err := tx.Exec("DELETE FROM templates"); err != nil {
-		return fmt.Errorf("failed to delete templates: %w", err)
-	}
+// SettingsClearTargets lists the configuration targets, executed after the data targets
+var SettingsClearTargets = []string{
+	ClearTargetSettings,
+	ClearTargetTokens,
+}
 
-	// 3. items (references sections)
-	if _, err := tx.Exec("DELETE FROM items"); err != nil {
-		return fmt.Errorf("failed to delete items: %w", err)
-	}
+// AllClearTargets returns every valid clear target in execution order
+func AllClearTargets() []string {
+	return append(append([]string{}, ClearTargets...), SettingsClearTargets...)
+}
 
-	// 4. sections (references lists)
-	if _, err := tx.Exec("DELETE FROM sections"); err != nil {
-		return fmt.Errorf("failed to delete sections: %w", err)
+// clearStatements are executed in order for each target, children before parents
+// Completed items go to the trash like any deleted item, clearing the lists removes their trash too
+var clearStatements = map[string][]string{
+	ClearTargetTemplates:      {"DELETE FROM template_items", "DELETE FROM templates"},
+	ClearTargetCompletedItems: {"UPDATE items SET deleted_at = strftime('%s', 'now'), updated_at = strftime('%s', 'now') WHERE completed = TRUE AND deleted_at IS NULL"},
+	ClearTargetLists:          {"DELETE FROM items", "DELETE FROM sections", "DELETE FROM lists"},
+	ClearTargetHistory:        {"DELETE FROM item_history"},
+	ClearTargetSettings:       {"DELETE FROM settings"},
+	ClearTargetTokens:         {"DELETE FROM api_tokens"},
+}
+
+// IsClearTarget reports whether target is a valid clear target
+func IsClearTarget(target string) bool {
+	_, ok := clearStatements[target]
+	return ok
+}
+
+// ClearData deletes the selected targets in one transaction and returns the rows deleted per target
+// Sessions are preserved so user remains logged in
+func ClearData(targets []string) (map[string]int64, error) {
+	selected := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		if !IsClearTarget(t) {
+			return nil, fmt.Errorf("unknown clear target: %s", t)
+		}
+		selected[t] = true
 	}
 
-	// 5. lists
-	if _, err := tx.Exec("DELETE FROM lists"); err != nil {
-		return fmt.Errorf("failed to delete lists: %w", err)
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	// 6. item_history
-	if _, err := tx.Exec("DELETE FROM item_history"); err != nil {
-		return fmt.Errorf("failed to delete item_history: %w", err)
+	counts := make(map[string]int64, len(selected))
+	for _, target := range AllClearTargets() {
+		if !selected[target] {
+			continue
+		}
+		var deleted int64
+		for _, stmt := range clearStatements[target] {
+			result, err := tx.Exec(stmt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to clear %s: %w", target, err)
+			}
+			n, _ := result.RowsAffected()
+			deleted += n
+		}
+		counts[target] = deleted
 	}
 
-	// Note: sessions are NOT deleted - user remains logged in
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
 
-	return tx.Commit()
+// ClearAllData clears all user data from database (lists, sections, items, templates, history)
+// Sessions are preserved so user remains logged in
+func ClearAllData() error {
+	_, err := ClearData(ClearTargets)
+	return err
 }
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Retry limits for writes that hit a busy database
+const (
+	maxBusyRetries    = 5
+	initialBusyDelay  = 50 * time.Millisecond
+	maxBusyRetryDelay = 1 * time.Second
+)
+
+// IsBusy reports whether err is SQLite's "database is locked" or "database table is locked"
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// WithRetry runs fn again with capped exponential backoff while it fails with a busy error
+// This covers contention beyond the busy_timeout, such as a long import or VACUUM
+func WithRetry(fn func() error) error {
+	delay := initialBusyDelay
+	var err error
+	for attempt := 0; attempt <= maxBusyRetries; attempt++ {
+		if err = fn(); !IsBusy(err) {
+			return err
+		}
+		if attempt == maxBusyRetries {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxBusyRetryDelay {
+			delay = maxBusyRetryDelay
+		}
+	}
+	return err
+}
+
+// BeginWrite starts a write transaction, retrying while the database is busy
+// Transactions take the write lock up front (_txlock=immediate), so once this returns
+// the statements inside cannot fail with a busy error
+func BeginWrite() (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := WithRetry(func() error {
+		var err error
+		tx, err = writeDB.Begin()
+		return err
+	})
+	return tx, err
+}
@@ -0,0 +1,487 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Search engines reported with results
+const (
+	SearchEngineFTS5 = "fts5"
+	SearchEngineLike = "like"
+)
+
+// Searchable entity types
+const (
+	SearchTypeItem         = "item"
+	SearchTypeHistory      = "history"
+	SearchTypeTemplate     = "template"
+	SearchTypeTemplateItem = "template_item"
+	SearchTypeList         = "list"
+	SearchTypeSection      = "section"
+)
+
+// searchKinds is the number of rowid slots per entity ID in search_index, rowid = id*searchKinds + kind
+// Encoding the entity in the rowid keeps trigger updates to a rowid lookup instead of a scan
+const searchKinds = 8
+
+// Bounds of the snippet markers, replaced after HTML escaping
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+// searchSource describes how one entity type is indexed
+type searchSource struct {
+	typ   string
+	kind  int
+	table string
+	// description is true when the table has a description, indexed as body with a lower weight than the name
+	description bool
+	// trash is true when rows can be in the trash, which keeps them out of the index
+	trash bool
+}
+
+// bodySQL returns the SQL expression of the indexed body for a row referenced as ref
+func (src searchSource) bodySQL(ref string) string {
+	if !src.description {
+		return "''"
+	}
+	return fmt.Sprintf("COALESCE(%s.description, '')", ref)
+}
+
+// liveSQL returns the condition matching the rows of src that are not in the trash
+func (src searchSource) liveSQL() string {
+	if !src.trash {
+		return "1"
+	}
+	return "deleted_at IS NULL"
+}
+
+// searchSources lists every indexed table, kinds must never be reused or changed
+var searchSources = []searchSource{
+	{typ: SearchTypeItem, kind: 1, table: "items", description: true, trash: true},
+	{typ: SearchTypeHistory, kind: 2, table: "item_history"},
+	{typ: SearchTypeTemplate, kind: 3, table: "templates", description: true},
+	{typ: SearchTypeTemplateItem, kind: 4, table: "template_items", description: true},
+	{typ: SearchTypeList, kind: 5, table: "lists"},
+	{typ: SearchTypeSection, kind: 6, table: "sections"},
+}
+
+// SearchScopes maps the scope names accepted by the search endpoint to entity types
+var SearchScopes = map[string][]string{
+	"items":     {SearchTypeItem},
+	"history":   {SearchTypeHistory},
+	"templates": {SearchTypeTemplate, SearchTypeTemplateItem},
+	"lists":     {SearchTypeList, SearchTypeSection},
+}
+
+// searchFTS is true when the SQLite build has FTS5 and search_index is maintained
+var searchFTS bool
+
+// SearchResult is a matching entity with where it lives
+type SearchResult struct {
+	Type         string  `json:"type"`
+	ID           int64   `json:"id"`
+	Name         string  `json:"name"`
+	Snippet      string  `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+	Score        float64 `json:"score"`   // Higher is better, only comparable within one response
+	ListID       int64   `json:"list_id,omitempty"`
+	ListName     string  `json:"list_name,omitempty"`
+	SectionID    int64   `json:"section_id,omitempty"`
+	SectionName  string  `json:"section_name,omitempty"`
+	TemplateID   int64   `json:"template_id,omitempty"`
+	TemplateName string  `json:"template_name,omitempty"`
+}
+
+// SearchResults are the ranked results of a query and the engine that produced them
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Engine  string         `json:"engine"`
+	Results []SearchResult `json:"results"`
+}
+
+// SearchEngine returns the engine used for searches
+func SearchEngine() string {
+	if searchFTS {
+		return SearchEngineFTS5
+	}
+	return SearchEngineLike
+}
+
+// InitSearch sets up the full-text index when SQLite has FTS5, searches fall back to LIKE otherwise
+// and when setting up the index fails
+// The index is kept current by triggers. It is rebuilt when triggers were missing, which covers new
+// databases and databases last opened by a build without FTS5, whose writes were not indexed
+func InitSearch() error {
+	var enabled int
+	if err := DB.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return err
+	}
+	searchFTS = false
+
+	if enabled != 1 {
+		// Triggers left by an FTS5 build would fail every write without the module
+		for _, src := range searchSources {
+			for _, suffix := range []string{"ai", "au", "ad", "at"} {
+				if _, err := writeDB.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS search_%s_%s", src.table, suffix)); err != nil {
+					return err
+				}
+			}
+		}
+		log.Println("[SEARCH] SQLite built without FTS5, search falls back to LIKE")
+		return nil
+	}
+
+	var triggers int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'search\\_%' ESCAPE '\\'").Scan(&triggers); err != nil {
+		return err
+	}
+
+	tx, err := BeginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(name, body, tokenize = 'unicode61 remove_diacritics 2')`); err != nil {
+		return err
+	}
+	for _, src := range searchSources {
+		if _, err := tx.Exec(searchTriggersSQL(src)); err != nil {
+			return fmt.Errorf("creating search triggers for %s: %w", src.table, err)
+		}
+	}
+	if triggers < len(searchSources)*3 {
+		count, err := rebuildSearchIndexTx(tx)
+		if err != nil {
+			return err
+		}
+		log.Printf("[SEARCH] Built full-text index with %d entries", count)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	searchFTS = true
+	return nil
+}
+
+// searchTriggersSQL keeps the index entries of src in sync with inserts, renames and deletes
+// and, for sources with a trash, with rows moved to and restored from it
+func searchTriggersSQL(src searchSource) string {
+	rowid := func(ref string) string { return fmt.Sprintf("%s.id * %d + %d", ref, searchKinds, src.kind) }
+	columns := "name"
+	if src.description {
+		columns = "name, description"
+	}
+	triggers := fmt.Sprintf(`
+		CREATE TRIGGER IF NOT EXISTS search_%[1]s_ai AFTER INSERT ON %[1]s BEGIN
+			INSERT INTO search_index(rowid, name, body) VALUES (%[2]s, new.name, %[3]s);
+		END;
+		CREATE TRIGGER IF NOT EXISTS search_%[1]s_au AFTER UPDATE OF %[4]s ON %[1]s BEGIN
+			DELETE FROM search_index WHERE rowid = %[5]s;
+			INSERT INTO search_index(rowid, name, body) VALUES (%[2]s, new.name, %[3]s);
+		END;
+		CREATE TRIGGER IF NOT EXISTS search_%[1]s_ad AFTER DELETE ON %[1]s BEGIN
+			DELETE FROM search_index WHERE rowid = %[5]s;
+		END;
+	`, src.table, rowid("new"), src.bodySQL("new"), columns, rowid("old"))
+	if !src.trash {
+		return triggers
+	}
+	return triggers + fmt.Sprintf(`
+		CREATE TRIGGER IF NOT EXISTS search_%[1]s_at AFTER UPDATE OF deleted_at ON %[1]s BEGIN
+			DELETE FROM search_index WHERE rowid = %[2]s;
+			INSERT INTO search_index(rowid, name, body) SELECT %[2]s, new.name, %[3]s WHERE new.deleted_at IS NULL;
+		END;
+	`, src.table, rowid("new"), src.bodySQL("new"))
+}
+
+// RebuildSearchIndex repopulates the full-text index from the indexed tables and returns its size
+func RebuildSearchIndex() (int, error) {
+	if !searchFTS {
+		return 0, fmt.Errorf("full-text search is not available in this build")
+	}
+
+	tx, err := BeginWrite()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count, err := rebuildSearchIndexTx(tx)
+	if err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+func rebuildSearchIndexTx(tx *sql.Tx) (int, error) {
+	if _, err := tx.Exec("DELETE FROM search_index"); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, src := range searchSources {
+		res, err := tx.Exec(fmt.Sprintf("INSERT INTO search_index(rowid, name, body) SELECT id * %d + %d, name, %s FROM %s WHERE %s",
+			searchKinds, src.kind, src.bodySQL(src.table), src.table, src.liveSQL()))
+		if err != nil {
+			return 0, fmt.Errorf("indexing %s: %w", src.table, err)
+		}
+		n, _ := res.RowsAffected()
+		total += int(n)
+	}
+	return total, nil
+}
+
+// Search returns up to limit entities of the given types matching query, best matches first
+// Words must all match, a trailing * matches a prefix. Name matches rank above description matches
+func Search(query string, types []string, limit int) (*SearchResults, error) {
+	terms := searchTerms(query)
+	results := &SearchResults{Query: query, Engine: SearchEngine(), Results: []SearchResult{}}
+	if len(terms) == 0 || len(types) == 0 {
+		return results, nil
+	}
+
+	var sources []searchSource
+	for _, src := range searchSources {
+		for _, typ := range types {
+			if src.typ == typ {
+				sources = append(sources, src)
+			}
+		}
+	}
+
+	var err error
+	if searchFTS {
+		results.Results, err = searchFTS5(terms, sources, limit)
+	} else {
+		results.Results, err = searchLike(terms, sources, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results.Results {
+		if err := searchContext(&results.Results[i]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// searchTerm is a word of the query, prefix when it ended with *
+type searchTerm struct {
+	text   string
+	prefix bool
+}
+
+func searchTerms(query string) []searchTerm {
+	var terms []searchTerm
+	for _, word := range strings.Fields(query) {
+		prefix := strings.HasSuffix(word, "*")
+		text := strings.Trim(word, `*"`)
+		if text != "" {
+			terms = append(terms, searchTerm{text: text, prefix: prefix})
+		}
+	}
+	return terms
+}
+
+// ftsQuery quotes every term, so user input is never parsed as FTS5 query syntax
+func ftsQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = `"` + strings.ReplaceAll(t.text, `"`, `""`) + `"`
+		if t.prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func searchFTS5(terms []searchTerm, sources []searchSource, limit int) ([]SearchResult, error) {
+	kinds := make([]string, len(sources))
+	kindTypes := make(map[int64]string, len(sources))
+	for i, src := range sources {
+		kinds[i] = fmt.Sprint(src.kind)
+		kindTypes[int64(src.kind)] = src.typ
+	}
+
+	rows, err := DB.Query(fmt.Sprintf(`
+		SELECT rowid, name, bm25(search_index, 10.0, 1.0) AS rank,
+			snippet(search_index, -1, '%s', '%s', '…', 12)
+		FROM search_index
+		WHERE search_index MATCH ? AND rowid %% %d IN (%s)
+		ORDER BY rank
+		LIMIT ?
+	`, snippetStart, snippetEnd, searchKinds, strings.Join(kinds, ", ")), ftsQuery(terms), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var rowid int64
+		var r SearchResult
+		if err := rows.Scan(&rowid, &r.Name, &r.Score, &r.Snippet); err != nil {
+			return nil, err
+		}
+		r.Type = kindTypes[rowid%searchKinds]
+		r.ID = rowid / searchKinds
+		r.Score = -r.Score // bm25 is lower for better matches
+		r.Snippet = markSnippet(r.Snippet)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// searchLike matches terms with LIKE, which only folds ASCII case and ignores diacritics
+// Each term scores 10 when it matches the name and 1 when it only matches the description
+func searchLike(terms []searchTerm, sources []searchSource, limit int) ([]SearchResult, error) {
+	results := []SearchResult{}
+	for _, src := range sources {
+		conds := make([]string, len(terms))
+		args := make([]any, 0, len(terms)*2+1)
+		for i, t := range terms {
+			conds[i] = "(name LIKE ? ESCAPE '\\' OR body LIKE ? ESCAPE '\\')"
+			pattern := "%" + escapeLike(t.text) + "%"
+			args = append(args, pattern, pattern)
+		}
+		args = append(args, limit)
+
+		rows, err := DB.Query(fmt.Sprintf(`
+			SELECT id, name, body FROM (SELECT id, name, %s AS body FROM %s WHERE %s)
+			WHERE %s
+			LIMIT ?
+		`, src.bodySQL(src.table), src.table, src.liveSQL(), strings.Join(conds, " AND ")), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var r SearchResult
+			var body string
+			if err := rows.Scan(&r.ID, &r.Name, &body); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			r.Type = src.typ
+			r.Score, r.Snippet = scoreLike(terms, r.Name, body)
+			results = append(results, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// scoreLike ranks a LIKE match and highlights the terms in the name, or in the body when the name has none
+func scoreLike(terms []searchTerm, name, body string) (float64, string) {
+	var score float64
+	nameHit := false
+	for _, t := range terms {
+		if strings.Contains(asciiLower(name), asciiLower(t.text)) {
+			score += 10
+			nameHit = true
+		} else {
+			score++
+		}
+	}
+	text := name
+	if !nameHit && body != "" {
+		text = body
+	}
+	return score, markSnippet(highlightTerms(text, terms))
+}
+
+// highlightTerms wraps case-insensitive (ASCII) occurrences of terms in the snippet markers
+func highlightTerms(text string, terms []searchTerm) string {
+	lower := asciiLower(text)
+	marked := make([]bool, len(text))
+	for _, t := range terms {
+		needle := asciiLower(t.text)
+		for start := 0; ; {
+			i := strings.Index(lower[start:], needle)
+			if i < 0 {
+				break
+			}
+			for j := start + i; j < start+i+len(needle); j++ {
+				marked[j] = true
+			}
+			start += i + len(needle)
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString(snippetStart)
+		}
+		b.WriteByte(text[i])
+		if marked[i] && (i == len(text)-1 || !marked[i+1]) {
+			b.WriteString(snippetEnd)
+		}
+	}
+	return b.String()
+}
+
+// markSnippet escapes a snippet for HTML and turns the markers into <mark> tags
+func markSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, snippetStart, "<mark>")
+	return strings.ReplaceAll(s, snippetEnd, "</mark>")
+}
+
+// searchContext fills in the list, section or template a result belongs to
+func searchContext(r *SearchResult) error {
+	var err error
+	switch r.Type {
+	case SearchTypeItem:
+		err = DB.QueryRow(`
+			SELECT s.id, s.name, l.id, l.name FROM items i
+			JOIN sections s ON s.id = i.section_id
+			JOIN lists l ON l.id = s.list_id
+			WHERE i.id = ?
+		`, r.ID).Scan(&r.SectionID, &r.SectionName, &r.ListID, &r.ListName)
+	case SearchTypeSection:
+		err = DB.QueryRow(`
+			SELECT l.id, l.name FROM sections s JOIN lists l ON l.id = s.list_id WHERE s.id = ?
+		`, r.ID).Scan(&r.ListID, &r.ListName)
+	case SearchTypeTemplateItem:
+		err = DB.QueryRow(`
+			SELECT t.id, t.name, ti.section_name FROM template_items ti
+			JOIN templates t ON t.id = ti.template_id
+			WHERE ti.id = ?
+		`, r.ID).Scan(&r.TemplateID, &r.TemplateName, &r.SectionName)
+	case SearchTypeHistory:
+		err = DB.QueryRow(`
+			SELECT COALESCE(s.id, 0), COALESCE(s.name, '') FROM item_history h
+			LEFT JOIN sections s ON s.id = h.last_section_id
+			WHERE h.id = ?
+		`, r.ID).Scan(&r.SectionID, &r.SectionName)
+	}
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
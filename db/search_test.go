@@ -0,0 +1,183 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// seedSearchData creates items, a template and history whose words overlap in names and descriptions
+func seedSearchData(t *testing.T) map[string]int64 {
+	t.Helper()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := map[string]int64{}
+	list, err := CreateList("Groceries", "")
+	must(err)
+	dairy, err := CreateSectionForList(list.ID, "Dairy")
+	must(err)
+	bakery, err := CreateSectionForList(list.ID, "Bakery")
+	must(err)
+	for _, item := range []struct {
+		section           *Section
+		name, description string
+	}{
+		{dairy, "Whole milk", "2L"},
+		{dairy, "Oat drink", "tastes like milk, for coffee"},
+		{dairy, "Cheddar cheese", "mature"},
+		{bakery, "Rye bread", "whole grain"},
+		{bakery, "Fish & chips", "<b>Friday</b>"},
+	} {
+		created, err := CreateItem(item.section.ID, item.name, item.description, 1)
+		must(err)
+		ids[item.name] = created.ID
+	}
+	weekly, err := CreateTemplate("Weekly", "")
+	must(err)
+	_, err = AddTemplateItem(weekly.ID, "Sweets", "Milk chocolate", "")
+	must(err)
+	must(SaveItemHistory("Skimmed milk", dairy.ID))
+	return ids
+}
+
+// searchNames returns the type and name of every result of query within types, in rank order
+func searchNames(t *testing.T, query string, types ...string) []string {
+	t.Helper()
+	results, err := Search(query, types, 20)
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	names := []string{}
+	for _, r := range results.Results {
+		names = append(names, r.Type+":"+r.Name)
+	}
+	return names
+}
+
+func TestSearch(t *testing.T) {
+	setupTestDB(t)
+	seedSearchData(t)
+
+	cases := []struct {
+		name, query string
+		types       []string
+		want        []string
+	}{
+		// Every word must match, in the name or the description
+		{"multi-word", "whole milk", []string{SearchTypeItem}, []string{"item:Whole milk"}},
+		{"multi-word across name and description", "oat coffee", []string{SearchTypeItem}, []string{"item:Oat drink"}},
+		{"words in any order", "MILK whole", []string{SearchTypeItem}, []string{"item:Whole milk"}},
+		{"prefix", "ched*", []string{SearchTypeItem}, []string{"item:Cheddar cheese"}},
+		{"prefix with another word", "gra* rye", []string{SearchTypeItem}, []string{"item:Rye bread"}},
+		// A name match ranks above a description match
+		{"ranking", "milk", []string{SearchTypeItem}, []string{"item:Whole milk", "item:Oat drink"}},
+		{"scope", "milk", []string{SearchTypeTemplateItem, SearchTypeHistory}, []string{"history:Skimmed milk", "template_item:Milk chocolate"}},
+		{"section names", "bakery", []string{SearchTypeSection}, []string{"section:Bakery"}},
+		{"no match", "whole butter", []string{SearchTypeItem}, []string{}},
+		{"empty query", "  * ", []string{SearchTypeItem}, []string{}},
+		{"no types", "milk", nil, []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := searchNames(t, tc.query, tc.types...)
+			if tc.name == "scope" {
+				// Both are name matches, their order is up to the engine
+				sort.Strings(got)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("search %q = %v, want %v", tc.query, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchResultContext(t *testing.T) {
+	setupTestDB(t)
+	seedSearchData(t)
+
+	results, err := Search("fish", []string{SearchTypeItem}, 20)
+	if err != nil || len(results.Results) != 1 {
+		t.Fatalf("search fish = %+v, %v, want one item", results, err)
+	}
+	fish := results.Results[0]
+	if fish.ListName != "Groceries" || fish.SectionName != "Bakery" || fish.ListID == 0 || fish.SectionID == 0 {
+		t.Errorf("result = %+v, want it placed in Groceries/Bakery", fish)
+	}
+	if !strings.Contains(fish.Snippet, "<mark>Fish</mark>") || !strings.Contains(fish.Snippet, "&amp;") {
+		t.Errorf("snippet = %q, want the match marked and the rest escaped", fish.Snippet)
+	}
+	if results.Engine != SearchEngine() || results.Query != "fish" {
+		t.Errorf("results = %+v, want the query and the engine", results)
+	}
+
+	// A description match is escaped as well
+	results, err = Search("friday", []string{SearchTypeItem}, 20)
+	if err != nil || len(results.Results) != 1 || strings.Contains(results.Results[0].Snippet, "<b>") {
+		t.Errorf("search friday = %+v, %v, want the description escaped", results, err)
+	}
+}
+
+func TestSearchFollowsWrites(t *testing.T) {
+	setupTestDB(t)
+	ids := seedSearchData(t)
+
+	// Renamed and trashed items are found by what they are now
+	if _, err := UpdateItem(ids["Whole milk"], "Buttermilk", "2L", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteItem(ids["Oat drink"]); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchNames(t, "whole", SearchTypeItem); !reflect.DeepEqual(got, []string{"item:Rye bread"}) {
+		t.Errorf("search whole after the rename = %v, want only the rye bread", got)
+	}
+	if got := searchNames(t, "coffee", SearchTypeItem); len(got) != 0 {
+		t.Errorf("search coffee after trashing = %v, want nothing", got)
+	}
+	if got := searchNames(t, "butter*", SearchTypeItem); !reflect.DeepEqual(got, []string{"item:Buttermilk"}) {
+		t.Errorf("search butter* = %v, want the renamed item", got)
+	}
+
+	// Rebuilding the full-text index finds the same
+	if SearchEngine() != SearchEngineFTS5 {
+		return
+	}
+	if _, err := RebuildSearchIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchNames(t, "butter*", SearchTypeItem); !reflect.DeepEqual(got, []string{"item:Buttermilk"}) {
+		t.Errorf("search butter* after a rebuild = %v", got)
+	}
+}
+
+func TestSearchFoldsDiacritics(t *testing.T) {
+	setupTestDB(t)
+	if SearchEngine() != SearchEngineFTS5 {
+		t.Skip("LIKE only folds ASCII case, run with -tags sqlite_fts5")
+	}
+	list, err := CreateList("Zakupy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, err := CreateSectionForList(list.ID, "Nabiał")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Crème fraîche", "Молоко", "Żółty ser"} {
+		if _, err := CreateItem(section.ID, name, "", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Accents are folded and case is ignored, ł is a letter of its own rather than an accented l
+	for query, want := range map[string]string{"creme": "Crème fraîche", "FRAICHE": "Crème fraîche", "молоко": "Молоко", "мол*": "Молоко", "ZOŁTY": "Żółty ser", "zolty": ""} {
+		got := searchNames(t, query, SearchTypeItem)
+		if want == "" && len(got) != 0 || want != "" && !reflect.DeepEqual(got, []string{"item:" + want}) {
+			t.Errorf("search %q = %v, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetSetting returns the value of a setting, or defaultVal if it is not set
+func GetSetting(key, defaultVal string) (string, error) {
+	var value string
+	err := DB.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return defaultVal, nil
+	}
+	if err != nil {
+		return defaultVal, err
+	}
+	return value, nil
+}
+
+// LookupSetting returns the stored value of a setting and whether it is stored at all
+func LookupSetting(key string) (string, bool, error) {
+	var value string
+	err := DB.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetSetting stores the value of a setting
+func SetSetting(key, value string) error {
+	_, err := writeDB.Exec(`
+		INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, key, value, time.Now().Unix())
+	return err
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Share represents a public read-only link to a list
+// Like API tokens, only the SHA-256 hash of the share token is stored
+type Share struct {
+	ID        int64  `json:"id"`
+	ListID    int64  `json:"list_id"`
+	ListName  string `json:"list_name"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	RevokedAt int64  `json:"revoked_at,omitempty"`
+	Hits      int64  `json:"hits"`
+	LastHitAt int64  `json:"last_hit_at,omitempty"`
+}
+
+// IsExpired returns true if the share has an expiry in the past
+func (s *Share) IsExpired() bool {
+	return s.ExpiresAt > 0 && s.ExpiresAt <= time.Now().Unix()
+}
+
+// IsRevoked returns true if the share was revoked
+func (s *Share) IsRevoked() bool {
+	return s.RevokedAt > 0
+}
+
+const shareColumns = `s.id, s.list_id, l.name, s.created_at, s.expires_at, s.revoked_at, s.hits, s.last_hit_at`
+
+func scanShare(scanner interface{ Scan(...interface{}) error }) (*Share, error) {
+	var s Share
+	var expiresAt, revokedAt, lastHitAt sql.NullInt64
+	if err := scanner.Scan(&s.ID, &s.ListID, &s.ListName, &s.CreatedAt, &expiresAt, &revokedAt, &s.Hits, &lastHitAt); err != nil {
+		return nil, err
+	}
+	s.ExpiresAt = expiresAt.Int64
+	s.RevokedAt = revokedAt.Int64
+	s.LastHitAt = lastHitAt.Int64
+	return &s, nil
+}
+
+// CreateShare stores a new share for a list (expiresAt 0 means no expiry)
+func CreateShare(listID int64, token string, expiresAt int64) (*Share, error) {
+	result, err := writeDB.Exec(`
+		INSERT INTO shares (token_hash, list_id, created_at, expires_at) VALUES (?, ?, ?, ?)
+	`, HashToken(token), listID, time.Now().Unix(), nullableInt64(expiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := result.LastInsertId()
+	return GetShareByID(id)
+}
+
+// GetShareByID returns a single share by ID
+func GetShareByID(id int64) (*Share, error) {
+	return scanShare(DB.QueryRow(`
+		SELECT `+shareColumns+`
+		FROM shares s JOIN lists l ON l.id = s.list_id
+		WHERE s.id = ?
+	`, id))
+}
+
+// GetShareByToken looks up a share by its plain token via the indexed hash
+// Expired and revoked shares are returned so callers can report them distinctly
+func GetShareByToken(token string) (*Share, error) {
+	return scanShare(DB.QueryRow(`
+		SELECT `+shareColumns+`
+		FROM shares s JOIN lists l ON l.id = s.list_id
+		WHERE s.token_hash = ?
+	`, HashToken(token)))
+}
+
+// GetActiveShares returns all shares that are neither revoked nor expired
+func GetActiveShares() ([]Share, error) {
+	rows, err := DB.Query(`
+		SELECT `+shareColumns+`
+		FROM shares s JOIN lists l ON l.id = s.list_id
+		WHERE s.revoked_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > ?)
+		ORDER BY s.created_at DESC, s.id DESC
+	`, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []Share
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *s)
+	}
+	return shares, nil
+}
+
+// RevokeShare marks a share as revoked
+func RevokeShare(id int64) error {
+	result, err := writeDB.Exec("UPDATE shares SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AddShareHits adds batched hit counts to shares
+func AddShareHits(hits map[int64]int64) error {
+	tx, err := BeginWrite()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for id, count := range hits {
+		if _, err := tx.Exec("UPDATE shares SET hits = hits + ?, last_hit_at = ? WHERE id = ?", count, now, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteStaleShares removes shares that expired or were revoked before the cutoff
+func DeleteStaleShares(before int64) (int64, error) {
+	result, err := writeDB.Exec(`
+		DELETE FROM shares
+		WHERE (expires_at IS NOT NULL AND expires_at < ?)
+		   OR (revoked_at IS NOT NULL AND revoked_at < ?)
+	`, before, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,65 @@
+package db
+
+import "context"
+
+// ConnStats reports the connection settings and pool usage of the database
+type ConnStats struct {
+	JournalMode     string `json:"journal_mode"`
+	BusyTimeoutMs   int    `json:"busy_timeout_ms"`
+	ForeignKeys     bool   `json:"foreign_keys"`
+	Synchronous     string `json:"synchronous"`
+	TxLock          string `json:"tx_lock"`
+	FileSize        int64  `json:"file_size"`
+	OpenConnections int    `json:"open_connections"`
+	InUse           int    `json:"in_use"`
+	Idle            int    `json:"idle"`
+	WaitCount       int64  `json:"wait_count"`
+	WaitDurationMs  int64  `json:"wait_duration_ms"`
+
+	// The write handle, its wait count is how often a write queued behind another one
+	MaxWriteConnections int   `json:"max_write_connections"`
+	WriteWaitCount      int64 `json:"write_wait_count"`
+	WriteWaitDurationMs int64 `json:"write_wait_duration_ms"`
+}
+
+// synchronousModes maps PRAGMA synchronous values to their names
+var synchronousModes = map[int]string{0: "OFF", 1: "NORMAL", 2: "FULL", 3: "EXTRA"}
+
+// GetConnStats returns the pragmas in effect and connection pool statistics
+func GetConnStats() (*ConnStats, error) {
+	conn, err := DB.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stats := &ConnStats{TxLock: "immediate", FileSize: FileSize()}
+	var foreignKeys, synchronous int
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA journal_mode").Scan(&stats.JournalMode); err != nil {
+		return nil, err
+	}
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA busy_timeout").Scan(&stats.BusyTimeoutMs); err != nil {
+		return nil, err
+	}
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return nil, err
+	}
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA synchronous").Scan(&synchronous); err != nil {
+		return nil, err
+	}
+	stats.ForeignKeys = foreignKeys == 1
+	stats.Synchronous = synchronousModes[synchronous]
+
+	pool := DB.Stats()
+	stats.OpenConnections = pool.OpenConnections
+	stats.InUse = pool.InUse
+	stats.Idle = pool.Idle
+	stats.WaitCount = pool.WaitCount
+	stats.WaitDurationMs = pool.WaitDuration.Milliseconds()
+
+	writes := writeDB.Stats()
+	stats.MaxWriteConnections = writes.MaxOpenConnections
+	stats.WriteWaitCount = writes.WaitCount
+	stats.WriteWaitDurationMs = writes.WaitDuration.Milliseconds()
+	return stats, nil
+}
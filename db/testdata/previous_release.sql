@@ -0,0 +1,80 @@
+-- Database written by the release before versioned migrations (baseline commit 07eafe4)
+-- with one list, one section, one open and one completed item
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE sections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		sort_order INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at INTEGER DEFAULT (strftime('%s', 'now'))
+	, list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE);
+INSERT INTO sections VALUES(1,'Dairy',0,'2026-10-16 08:15:57',1792138557,1);
+CREATE TABLE items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		section_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT DEFAULT '',
+		completed BOOLEAN DEFAULT FALSE,
+		uncertain BOOLEAN DEFAULT FALSE,
+		sort_order INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at INTEGER DEFAULT (strftime('%s', 'now')), quantity INTEGER DEFAULT 0,
+		FOREIGN KEY (section_id) REFERENCES sections(id) ON DELETE CASCADE
+	);
+INSERT INTO items VALUES(1,1,'Milk','2L',0,0,0,'2026-10-16 08:15:57',1792138557,2);
+INSERT INTO items VALUES(2,1,'Cheese','',1,0,1,'2026-10-16 08:15:57',1792138557,0);
+CREATE TABLE sessions (
+		id TEXT PRIMARY KEY,
+		expires_at INTEGER NOT NULL
+	);
+CREATE TABLE item_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL COLLATE NOCASE,
+		last_section_id INTEGER,
+		usage_count INTEGER DEFAULT 1,
+		last_used_at INTEGER DEFAULT (strftime('%s', 'now')),
+		UNIQUE(name COLLATE NOCASE)
+	);
+INSERT INTO item_history VALUES(1,'Milk',1,1,1792138557);
+INSERT INTO item_history VALUES(2,'Cheese',1,1,1792138557);
+CREATE TABLE lists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			sort_order INTEGER NOT NULL,
+			is_active BOOLEAN DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at INTEGER DEFAULT (strftime('%s', 'now'))
+		, icon TEXT DEFAULT '🛒');
+INSERT INTO lists VALUES(1,'Groceries',0,0,'2026-10-16 08:15:54',1792138554,'🛒');
+CREATE TABLE templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			sort_order INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at INTEGER DEFAULT (strftime('%s', 'now'))
+		);
+CREATE TABLE template_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			template_id INTEGER NOT NULL,
+			section_name TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			sort_order INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE CASCADE
+		);
+INSERT INTO sqlite_sequence VALUES('lists',1);
+INSERT INTO sqlite_sequence VALUES('sections',1);
+INSERT INTO sqlite_sequence VALUES('items',2);
+INSERT INTO sqlite_sequence VALUES('item_history',2);
+CREATE INDEX idx_items_section ON items(section_id, sort_order);
+CREATE INDEX idx_sections_order ON sections(sort_order);
+CREATE INDEX idx_item_history_name ON item_history(name COLLATE NOCASE);
+CREATE INDEX idx_lists_order ON lists(sort_order);
+CREATE INDEX idx_lists_active ON lists(is_active);
+CREATE INDEX idx_sections_list ON sections(list_id, sort_order);
+CREATE INDEX idx_templates_order ON templates(sort_order);
+CREATE INDEX idx_template_items_template ON template_items(template_id, sort_order);
+COMMIT;
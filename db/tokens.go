@@ -0,0 +1,184 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// APIToken represents a database-backed API token
+// The secret itself is never stored, only its SHA-256 hash
+type APIToken struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Scope      string    `json:"scope"`
+	ListID     int64     `json:"list_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  int64     `json:"expires_at,omitempty"`
+	LastUsedAt int64     `json:"last_used_at,omitempty"`
+}
+
+// IsExpired returns true if the token has an expiry in the past
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt > 0 && t.ExpiresAt <= time.Now().Unix()
+}
+
+const apiTokenColumns = `id, name, scope, list_id, created_at, expires_at, last_used_at`
+
+// scanAPIToken scans a row selected with apiTokenColumns
+func scanAPIToken(scanner interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	var listID, expiresAt, lastUsedAt sql.NullInt64
+	if err := scanner.Scan(&t.ID, &t.Name, &t.Scope, &listID, &t.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	t.ListID = listID.Int64
+	t.ExpiresAt = expiresAt.Int64
+	t.LastUsedAt = lastUsedAt.Int64
+	return &t, nil
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of a token secret
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// nullableInt64 maps 0 to NULL
+func nullableInt64(v int64) interface{} {
+	if v > 0 {
+		return v
+	}
+	return nil
+}
+
+// CreateAPIToken stores a new token bound to a list (listID 0 means unrestricted)
+// expiresAt is a unix timestamp, 0 means the token never expires
+func CreateAPIToken(name, secret, scope string, listID, expiresAt int64) (*APIToken, error) {
+	result, err := writeDB.Exec(`
+		INSERT INTO api_tokens (name, token_hash, scope, list_id, expires_at) VALUES (?, ?, ?, ?, ?)
+	`, name, HashToken(secret), scope, nullableInt64(listID), nullableInt64(expiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := result.LastInsertId()
+	return GetAPITokenByID(id)
+}
+
+// GetAPITokenByID returns a single token by ID
+func GetAPITokenByID(id int64) (*APIToken, error) {
+	return scanAPIToken(DB.QueryRow(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens WHERE id = ?
+	`, id))
+}
+
+// GetAPITokenBySecret looks up a token by its plain secret
+// A previous secret still inside its rotation grace period also matches
+// Expiry is not checked here so callers can report it distinctly
+func GetAPITokenBySecret(secret string) (*APIToken, error) {
+	hash := HashToken(secret)
+	return scanAPIToken(DB.QueryRow(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE token_hash = ?
+		   OR (previous_hash = ? AND previous_expires_at > ?)
+		LIMIT 1
+	`, hash, hash, time.Now().Unix()))
+}
+
+// queryAPITokens runs a token query and collects the results
+func queryAPITokens(query string, args ...interface{}) ([]APIToken, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, nil
+}
+
+// GetAPITokensByList returns all tokens bound to a list
+func GetAPITokensByList(listID int64) ([]APIToken, error) {
+	return queryAPITokens(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE list_id = ?
+		ORDER BY created_at ASC, id ASC
+	`, listID)
+}
+
+// GetAllAPITokens returns every database-backed token
+func GetAllAPITokens() ([]APIToken, error) {
+	return queryAPITokens(`
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens
+		ORDER BY created_at ASC, id ASC
+	`)
+}
+
+// DeleteAPIToken revokes a token bound to the given list
+func DeleteAPIToken(id, listID int64) error {
+	result, err := writeDB.Exec("DELETE FROM api_tokens WHERE id = ? AND list_id = ?", id, listID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+// RotateAPIToken replaces a token's secret in a single statement
+// The old secret stays valid until previousExpiresAt (unix timestamp)
+func RotateAPIToken(id int64, newSecret string, previousExpiresAt int64) error {
+	result, err := writeDB.Exec(`
+		UPDATE api_tokens
+		SET previous_hash = token_hash, previous_expires_at = ?, token_hash = ?
+		WHERE id = ?
+	`, previousExpiresAt, HashToken(newSecret), id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchAPIToken records the time a token was last used
+func TouchAPIToken(id int64) error {
+	_, err := writeDB.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now().Unix(), id)
+	return err
+}
+
+// GetSectionListID returns the ID of the list that owns a section
+func GetSectionListID(sectionID int64) (int64, error) {
+	var listID int64
+	err := DB.QueryRow("SELECT list_id FROM sections WHERE id = ?", sectionID).Scan(&listID)
+	return listID, err
+}
+
+// GetItemListID returns the ID of the list that owns an item
+func GetItemListID(itemID int64) (int64, error) {
+	var listID int64
+	err := DB.QueryRow(`
+		SELECT s.list_id FROM items i
+		JOIN sections s ON s.id = i.section_id
+		WHERE i.id = ?
+	`, itemID).Scan(&listID)
+	return listID, err
+}
@@ -0,0 +1,95 @@
+package db
+
+// TrashedItem is an item in the trash with when it was deleted and the section it is restored to
+type TrashedItem struct {
+	Item
+	DeletedAt   int64  `json:"deleted_at"`
+	SectionName string `json:"section_name"`
+}
+
+// GetTrash returns one page of the items of a list in the trash, most recently deleted first, and how many there are
+func GetTrash(listID int64, limit, offset int) ([]TrashedItem, int, error) {
+	var total int
+	if err := DB.QueryRow(`
+		SELECT COUNT(*) FROM items i
+		JOIN sections s ON s.id = i.section_id
+		WHERE s.list_id = ? AND i.deleted_at IS NOT NULL
+	`, listID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := DB.Query(`
+		SELECT i.id, i.section_id, i.name, i.description, i.completed, i.uncertain, COALESCE(i.quantity, 0), i.sort_order, i.created_at,
+			COALESCE(i.updated_at, 0), i.completed_at, i.price_cents, i.currency, i.due_date, i.photo, i.photo != '', i.barcode, i.deleted_at, s.name
+		FROM items i
+		JOIN sections s ON s.id = i.section_id
+		WHERE s.list_id = ? AND i.deleted_at IS NOT NULL
+		ORDER BY i.deleted_at DESC, i.id DESC
+		LIMIT ? OFFSET ?
+	`, listID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []TrashedItem{}
+	for rows.Next() {
+		var t TrashedItem
+		i := &t.Item
+		if err := rows.Scan(&i.ID, &i.SectionID, &i.Name, &i.Description, &i.Completed, &i.Uncertain, &i.Quantity, &i.SortOrder, &i.CreatedAt,
+			&i.UpdatedAt, &i.CompletedAt, &i.PriceCents, &i.Currency, &i.DueDate, &i.Photo, &i.HasPhoto, &i.Barcode, &t.DeletedAt, &t.SectionName); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, t)
+	}
+	return items, total, rows.Err()
+}
+
+// RestoreItem takes an item out of the trash at its old place in its section, sql.ErrNoRows if it is not in the trash
+func RestoreItem(id int64) (*Item, error) {
+	tx, err := BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sectionID int64
+	var sortOrder int
+	err = tx.QueryRow("SELECT section_id, sort_order FROM items WHERE id = ? AND deleted_at IS NOT NULL", id).Scan(&sectionID, &sortOrder)
+	if err != nil {
+		return nil, err
+	}
+	// Items reordered while it was in the trash may have taken its place
+	if _, err := tx.Exec(`
+		UPDATE items SET sort_order = sort_order + 1, updated_at = strftime('%s', 'now')
+		WHERE section_id = ? AND sort_order >= ? AND deleted_at IS NULL
+	`, sectionID, sortOrder); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE items SET deleted_at = NULL, updated_at = strftime('%s', 'now') WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	item, err := GetItemByIDTx(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return item, tx.Commit()
+}
+
+// PurgeTrash deletes the items in the trash for good that were deleted before the given unix time,
+// of one list or of all lists when listID is 0, and returns how many were deleted
+func PurgeTrash(listID, before int64) (int64, error) {
+	var purged int64
+	err := WithRetry(func() error {
+		res, err := writeDB.Exec(`
+			DELETE FROM items WHERE deleted_at IS NOT NULL AND deleted_at < ?
+				AND (? = 0 OR section_id IN (SELECT id FROM sections WHERE list_id = ?))
+		`, before, listID, listID)
+		if err != nil {
+			return err
+		}
+		purged, err = res.RowsAffected()
+		return err
+	})
+	return purged, err
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// trashFixture is a list with one section of three items
+type trashFixture struct {
+	list                *List
+	section             *Section
+	bread, milk, cheese *Item
+}
+
+func newTrashFixture(t *testing.T) trashFixture {
+	t.Helper()
+	list, err := CreateList("Groceries", "")
+	if err != nil {
+		t.Fatalf("create list: %v", err)
+	}
+	section, err := CreateSectionForList(list.ID, "Dairy")
+	if err != nil {
+		t.Fatalf("create section: %v", err)
+	}
+	f := trashFixture{list: list, section: section}
+	for _, it := range []struct {
+		item **Item
+		name string
+	}{{&f.bread, "Bread"}, {&f.milk, "Milk"}, {&f.cheese, "Cheese"}} {
+		if *it.item, err = CreateItem(section.ID, it.name, "", 1); err != nil {
+			t.Fatalf("create %s: %v", it.name, err)
+		}
+	}
+	return f
+}
+
+// sectionItemNames returns the names of the items of a section in their order
+func sectionItemNames(t *testing.T, sectionID int64) []string {
+	t.Helper()
+	items, err := GetItemsBySection(sectionID)
+	if err != nil {
+		t.Fatalf("get items: %v", err)
+	}
+	names := make([]string, 0, len(items))
+	for _, i := range items {
+		names = append(names, i.Name)
+	}
+	return names
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDeletedItemIsHidden(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	if _, err := SetItemBarcode(f.milk.ID, "4006381333931"); err != nil {
+		t.Fatalf("set barcode: %v", err)
+	}
+
+	if err := DeleteItem(f.milk.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err := GetItemByID(f.milk.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetItemByID of a deleted item: err = %v, want sql.ErrNoRows", err)
+	}
+	if names := sectionItemNames(t, f.section.ID); !equalNames(names, []string{"Bread", "Cheese"}) {
+		t.Errorf("section items = %v, want Bread and Cheese", names)
+	}
+	sections, err := GetSectionsByList(f.list.ID)
+	if err != nil {
+		t.Fatalf("get sections: %v", err)
+	}
+	if len(sections) != 1 || len(sections[0].Items) != 2 {
+		t.Errorf("sections of the list = %+v, want one section with two items", sections)
+	}
+	if stats := GetListStats(f.list.ID); stats.TotalItems != 2 {
+		t.Errorf("list stats count %d items, want 2", stats.TotalItems)
+	}
+	if _, err := FindOpenItemByBarcode(f.list.ID, "4006381333931"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("barcode lookup found the deleted item, err = %v", err)
+	}
+
+	found, err := SearchItems(ItemSearchOptions{Query: "milk", Limit: 10})
+	if err != nil {
+		t.Fatalf("search items: %v", err)
+	}
+	if found.Total != 0 {
+		t.Errorf("item search found %+v, want no matches", found.Results)
+	}
+	results, err := Search("milk", []string{SearchTypeItem}, 10)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results.Results) != 0 {
+		t.Errorf("search found %+v, want no matches", results.Results)
+	}
+
+	// Deleting again changes nothing
+	if err := DeleteItem(f.milk.ID); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+	trash, total, err := GetTrash(f.list.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("get trash: %v", err)
+	}
+	if total != 1 || len(trash) != 1 || trash[0].ID != f.milk.ID || trash[0].SectionName != "Dairy" || trash[0].DeletedAt == 0 {
+		t.Errorf("trash = %+v (total %d), want only Milk from Dairy", trash, total)
+	}
+}
+
+func TestRestoreItem(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	if err := DeleteItem(f.milk.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// Bread moves down into the place Milk left
+	if _, err := MoveItemToSectionAtPosition(f.bread.ID, f.section.ID, 1); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+
+	item, err := RestoreItem(f.milk.ID)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if item.ID != f.milk.ID || item.Name != "Milk" {
+		t.Errorf("restored item = %+v", item)
+	}
+	if names := sectionItemNames(t, f.section.ID); !equalNames(names, []string{"Cheese", "Milk", "Bread"}) {
+		t.Errorf("section items after restore = %v, want Milk back at its place before Bread", names)
+	}
+	if _, total, _ := GetTrash(f.list.ID, 10, 0); total != 0 {
+		t.Errorf("trash holds %d items after the restore, want 0", total)
+	}
+	if found, _ := SearchItems(ItemSearchOptions{Query: "milk", Limit: 10}); found == nil || found.Total != 1 {
+		t.Errorf("item search after restore = %+v, want Milk", found)
+	}
+
+	if _, err := RestoreItem(f.milk.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("restoring an item not in the trash: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := RestoreItem(f.bread.ID + 100); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("restoring an unknown item: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	setupTestDB(t)
+	f := newTrashFixture(t)
+	other, err := CreateList("Hardware", "")
+	if err != nil {
+		t.Fatalf("create list: %v", err)
+	}
+	tools, err := CreateSectionForList(other.ID, "Tools")
+	if err != nil {
+		t.Fatalf("create section: %v", err)
+	}
+	hammer, err := CreateItem(tools.ID, "Hammer", "", 1)
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	for _, id := range []int64{f.bread.ID, f.milk.ID, hammer.ID} {
+		if err := DeleteItem(id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	// Bread has been in the trash for 40 days
+	old := time.Now().AddDate(0, 0, -40).Unix()
+	if _, err := DB.Exec("UPDATE items SET deleted_at = ? WHERE id = ?", old, f.bread.ID); err != nil {
+		t.Fatalf("age item: %v", err)
+	}
+
+	purged, err := PurgeTrash(0, time.Now().AddDate(0, 0, -30).Unix())
+	if err != nil {
+		t.Fatalf("purge expired: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d expired items, want 1", purged)
+	}
+	if _, err := RestoreItem(f.bread.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("restoring a purged item: err = %v, want sql.ErrNoRows", err)
+	}
+
+	// Emptying the trash of one list leaves the other list's trash alone
+	purged, err = PurgeTrash(f.list.ID, time.Now().Unix()+1)
+	if err != nil {
+		t.Fatalf("purge list: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d items of the list, want 1", purged)
+	}
+	if _, total, _ := GetTrash(f.list.ID, 10, 0); total != 0 {
+		t.Errorf("list trash holds %d items after emptying, want 0", total)
+	}
+	if _, total, _ := GetTrash(other.ID, 10, 0); total != 1 {
+		t.Errorf("other list's trash holds %d items, want Hammer", total)
+	}
+	if names := sectionItemNames(t, f.section.ID); !equalNames(names, []string{"Cheese"}) {
+		t.Errorf("items still on the list = %v, want Cheese", names)
+	}
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Versions are cheap fingerprints of the rows behind a read endpoint, used to build ETags
+// Each is a single aggregate query over row counts and updated_at, so every mutation has to bump updated_at.
+// Timestamps have one second resolution, the completed and uncertain totals catch a toggle within the same second
+
+// ListVersion fingerprints a list with its sections and items, sql.ErrNoRows if the list does not exist
+func ListVersion(listID int64) (string, error) {
+	var lists, sections, items int
+	var listUpdated, sectionsUpdated, itemsUpdated int64
+	var itemsTotal, completed, uncertain, overdue float64
+	err := DB.QueryRow(`
+		SELECT COUNT(DISTINCT l.id), COUNT(DISTINCT s.id), COUNT(i.id),
+			COALESCE(MAX(l.updated_at), 0), COALESCE(MAX(s.updated_at), 0), COALESCE(MAX(i.updated_at), 0),
+			TOTAL(i.updated_at), TOTAL(i.completed), TOTAL(i.uncertain), `+overdueTotal+`
+		FROM lists l
+		LEFT JOIN sections s ON s.list_id = l.id
+		LEFT JOIN items i ON i.section_id = s.id AND i.deleted_at IS NULL
+		WHERE l.id = ?
+	`, listID).Scan(&lists, &sections, &items, &listUpdated, &sectionsUpdated, &itemsUpdated, &itemsTotal, &completed, &uncertain, &overdue)
+	if err != nil {
+		return "", err
+	}
+	if lists == 0 {
+		return "", sql.ErrNoRows
+	}
+	return fmt.Sprintf("list:%d:%d:%d:%d:%d:%d:%.0f:%.0f:%.0f:%.0f", listID, sections, items,
+		listUpdated, sectionsUpdated, itemsUpdated, itemsTotal, completed, uncertain, overdue), nil
+}
+
+// overdueTotal counts the overdue items of a version query, which change with the date alone
+const overdueTotal = "TOTAL(i.due_date != '' AND i.due_date < date('now', 'localtime') AND i.completed = 0)"
+
+// SectionVersion fingerprints the items of a section, sql.ErrNoRows if the section does not exist
+func SectionVersion(sectionID int64) (string, error) {
+	var sections, items int
+	var sectionUpdated, itemsUpdated int64
+	var itemsTotal, completed, uncertain, overdue float64
+	err := DB.QueryRow(`
+		SELECT COUNT(DISTINCT s.id), COUNT(i.id),
+			COALESCE(MAX(s.updated_at), 0), COALESCE(MAX(i.updated_at), 0),
+			TOTAL(i.updated_at), TOTAL(i.completed), TOTAL(i.uncertain), `+overdueTotal+`
+		FROM sections s
+		LEFT JOIN items i ON i.section_id = s.id AND i.deleted_at IS NULL
+		WHERE s.id = ?
+	`, sectionID).Scan(&sections, &items, &sectionUpdated, &itemsUpdated, &itemsTotal, &completed, &uncertain, &overdue)
+	if err != nil {
+		return "", err
+	}
+	if sections == 0 {
+		return "", sql.ErrNoRows
+	}
+	return fmt.Sprintf("section:%d:%d:%d:%d:%.0f:%.0f:%.0f:%.0f", sectionID, items,
+		sectionUpdated, itemsUpdated, itemsTotal, completed, uncertain, overdue), nil
+}
+
+// HistoryVersion fingerprints the item history, including section renames shown as last_section_name
+func HistoryVersion() (string, error) {
+	var entries int
+	var lastUsed, sectionsUpdated int64
+	var usageTotal, lastUsedTotal, completedTotal float64
+	err := DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(MAX(last_used_at), 0), TOTAL(usage_count), TOTAL(last_used_at), TOTAL(completed_count),
+			(SELECT COALESCE(MAX(updated_at), 0) FROM sections)
+		FROM item_history
+	`).Scan(&entries, &lastUsed, &usageTotal, &lastUsedTotal, &completedTotal, &sectionsUpdated)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("history:%d:%d:%.0f:%.0f:%.0f:%d", entries, lastUsed, usageTotal, lastUsedTotal, completedTotal, sectionsUpdated), nil
+}
@@ -11,7 +11,7 @@ import (
 func GetAllData(c *fiber.Ctx) error {
 	sections, err := db.GetAllSections()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+		return Fail(c, ErrCodeDB, "Failed to fetch data")
 	}
 
 	stats := db.GetStats()
@@ -62,7 +62,7 @@ func LoginPage(c *fiber.Ctx) error {
 		"Error":        c.Query("error"),
 		"Translations": i18n.GetAllLocales(),
 		"Locales":      i18n.AvailableLocales(),
-		"DefaultLang":  i18n.GetDefaultLang(),
+		"DefaultLang":  RequestLang(c),
 	}, "")
 }
 
@@ -108,6 +108,9 @@ func Login(c *fiber.Ctx) error {
 		Path:     "/",
 	})
 
+	// Rotate CSRF token on session start
+	setCSRFCookie(c)
+
 	return c.Redirect("/")
 }
 
@@ -144,6 +147,11 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		return c.Next()
 	}
 
+	// Trusted reverse proxy handles authentication
+	if isProxyAuthEnabled() {
+		return proxyAuthenticate(c)
+	}
+
 	sessionID := c.Cookies(SessionCookieName)
 	if sessionID == "" {
 		log.Printf("[AUTH] No session cookie for %s %s (HX-Request: %s)", c.Method(), path, c.Get("HX-Request"))
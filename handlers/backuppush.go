@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"shopping-list/db"
+	"shopping-list/settings"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	settingBackupPushTarget        = "backup_push_target"
+	settingBackupPushPrefix        = "backup_push_prefix"
+	settingBackupPushEnabled       = "backup_push_enabled"
+	settingBackupPushIntervalHours = "backup_push_interval_hours"
+	settingBackupS3Endpoint        = "backup_s3_endpoint"
+	settingBackupS3Region          = "backup_s3_region"
+	settingBackupS3Bucket          = "backup_s3_bucket"
+	settingBackupS3AccessKey       = "backup_s3_access_key"
+	settingBackupS3SecretKey       = "backup_s3_secret_key"
+	settingBackupWebDAVURL         = "backup_webdav_url"
+	settingBackupWebDAVUsername    = "backup_webdav_username"
+	settingBackupWebDAVPassword    = "backup_webdav_password"
+
+	// settingBackupPushLast stores when the scheduled push last succeeded, it is not exposed in the settings API
+	settingBackupPushLast = "backup_push_last"
+
+	backupPushTimeout = 60 * time.Second
+	// backupPushTick is how often the scheduler checks whether a push is due
+	backupPushTick = time.Hour
+)
+
+func init() {
+	settings.Register(
+		settings.Def{Key: settingBackupPushTarget, Type: settings.TypeString, Env: "BACKUP_PUSH_TARGET", Validate: func(value string) error {
+			if value != "" && value != "s3" && value != "webdav" {
+				return fmt.Errorf("must be s3, webdav or empty")
+			}
+			return nil
+		}},
+		settings.Def{Key: settingBackupPushPrefix, Type: settings.TypeString, Default: "koffan/", Env: "BACKUP_PUSH_PREFIX"},
+		settings.Def{Key: settingBackupPushEnabled, Type: settings.TypeBool, Default: "false", Env: "BACKUP_PUSH_ENABLED"},
+		settings.Def{Key: settingBackupPushIntervalHours, Type: settings.TypeInt, Default: "24", Env: "BACKUP_PUSH_INTERVAL_HOURS", Min: 1, Max: 24 * 30},
+		settings.Def{Key: settingBackupS3Endpoint, Type: settings.TypeString, Env: "BACKUP_S3_ENDPOINT", Validate: validateBackupURL},
+		settings.Def{Key: settingBackupS3Region, Type: settings.TypeString, Default: "us-east-1", Env: "BACKUP_S3_REGION"},
+		settings.Def{Key: settingBackupS3Bucket, Type: settings.TypeString, Env: "BACKUP_S3_BUCKET"},
+		settings.Def{Key: settingBackupS3AccessKey, Type: settings.TypeString, Env: "BACKUP_S3_ACCESS_KEY", Secret: true},
+		settings.Def{Key: settingBackupS3SecretKey, Type: settings.TypeString, Env: "BACKUP_S3_SECRET_KEY", Secret: true},
+		settings.Def{Key: settingBackupWebDAVURL, Type: settings.TypeString, Env: "BACKUP_WEBDAV_URL", Validate: validateBackupURL},
+		settings.Def{Key: settingBackupWebDAVUsername, Type: settings.TypeString, Env: "BACKUP_WEBDAV_USERNAME"},
+		settings.Def{Key: settingBackupWebDAVPassword, Type: settings.TypeString, Env: "BACKUP_WEBDAV_PASSWORD", Secret: true},
+	)
+}
+
+// validateBackupURL accepts an empty value or an http or https URL
+func validateBackupURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	return nil
+}
+
+// BackupPushResult describes an export written to the remote destination
+type BackupPushResult struct {
+	Target string `json:"target"` // "s3" or "webdav"
+	Key    string `json:"key"`    // Object key or path below the WebDAV URL
+	Size   int64  `json:"size"`
+}
+
+// BackupTestResult reports a successful connection test
+type BackupTestResult struct {
+	Success bool   `json:"success"`
+	Target  string `json:"target"`
+	Key     string `json:"key"` // The probe object that was written and deleted
+}
+
+// backupDestination stores objects on remote storage
+type backupDestination interface {
+	put(ctx context.Context, key string, body []byte, contentType string) error
+	delete(ctx context.Context, key string) error
+}
+
+// errBackupNotConfigured is returned when no destination or an incomplete one is configured
+var errBackupNotConfigured = errors.New("backup destination not configured")
+
+// configuredBackupDestination returns the destination from the settings with the name of its target
+func configuredBackupDestination() (backupDestination, string, error) {
+	client := NewOutboundClient(backupPushTimeout)
+	switch target := settings.String(settingBackupPushTarget); target {
+	case "s3":
+		dest := &s3Destination{
+			client:    client,
+			endpoint:  strings.TrimRight(settings.String(settingBackupS3Endpoint), "/"),
+			region:    settings.String(settingBackupS3Region),
+			bucket:    settings.String(settingBackupS3Bucket),
+			accessKey: settings.String(settingBackupS3AccessKey),
+			secretKey: settings.String(settingBackupS3SecretKey),
+		}
+		if dest.endpoint == "" || dest.bucket == "" || dest.accessKey == "" || dest.secretKey == "" {
+			return nil, target, fmt.Errorf("%w: %s, %s, %s and %s are required", errBackupNotConfigured,
+				settingBackupS3Endpoint, settingBackupS3Bucket, settingBackupS3AccessKey, settingBackupS3SecretKey)
+		}
+		return dest, target, nil
+	case "webdav":
+		dest := &webDAVDestination{
+			client:   client,
+			baseURL:  strings.TrimRight(settings.String(settingBackupWebDAVURL), "/"),
+			username: settings.String(settingBackupWebDAVUsername),
+			password: settings.String(settingBackupWebDAVPassword),
+		}
+		if dest.baseURL == "" {
+			return nil, target, fmt.Errorf("%w: %s is required", errBackupNotConfigured, settingBackupWebDAVURL)
+		}
+		return dest, target, nil
+	default:
+		return nil, "", fmt.Errorf("%w: set %s to s3 or webdav", errBackupNotConfigured, settingBackupPushTarget)
+	}
+}
+
+// backupKey joins the configured prefix and name into an object key
+func backupKey(name string) string {
+	return strings.TrimLeft(settings.String(settingBackupPushPrefix), "/") + name
+}
+
+// PushBackupExport writes the JSON export with templates and history to the configured destination
+// It is shared by the push endpoint and the scheduled push
+func PushBackupExport(ctx context.Context, now time.Time) (*BackupPushResult, error) {
+	dest, target, err := configuredBackupDestination()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, ExportOptions{Format: "json", IncludeTemplates: true, IncludeHistory: true}); err != nil {
+		return nil, fmt.Errorf("export: %w", err)
+	}
+
+	key := backupKey(fmt.Sprintf("koffan-export-%s.json", now.UTC().Format("2006-01-02-150405")))
+	if err := dest.put(ctx, key, buf.Bytes(), "application/json"); err != nil {
+		return nil, err
+	}
+	if err := db.AddBackupRecord(db.BackupKindPush, target, key, int64(buf.Len())); err != nil {
+		log.Printf("[BACKUP] Failed to record push of %s: %v", key, err)
+	}
+	return &BackupPushResult{Target: target, Key: key, Size: int64(buf.Len())}, nil
+}
+
+// TestBackupDestination writes and deletes a small probe object on the configured destination
+func TestBackupDestination(ctx context.Context, now time.Time) (*BackupTestResult, error) {
+	dest, target, err := configuredBackupDestination()
+	if err != nil {
+		return nil, err
+	}
+
+	key := backupKey(fmt.Sprintf("koffan-probe-%d.txt", now.UnixNano()))
+	if err := dest.put(ctx, key, []byte("koffan connection test\n"), "text/plain"); err != nil {
+		return nil, fmt.Errorf("write probe: %w", err)
+	}
+	if err := dest.delete(ctx, key); err != nil {
+		return nil, fmt.Errorf("delete probe %s: %w", key, err)
+	}
+	return &BackupTestResult{Success: true, Target: target, Key: key}, nil
+}
+
+// backupPushFailed maps a push or test error to a response
+func backupPushFailed(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errBackupNotConfigured) {
+		return Fail(c, ErrCodeNotConfigured, "Backup destination is not configured: "+strings.TrimPrefix(err.Error(), errBackupNotConfigured.Error()+": "))
+	}
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return Fail(c, appErr.Code, appErr.Message)
+	}
+	log.Printf("[BACKUP] Push failed: %v", err)
+	return Fail(c, ErrCodeUpstream, "Backup push failed: "+err.Error())
+}
+
+// PushBackup uploads the JSON export to the configured S3 or WebDAV destination
+// Credentials come from the settings only, the request has no body
+func PushBackup(c *fiber.Ctx) error {
+	result, err := PushBackupExport(c.UserContext(), time.Now())
+	if err != nil {
+		return backupPushFailed(c, err)
+	}
+	log.Printf("[BACKUP] Pushed %s (%d bytes) to %s", result.Key, result.Size, result.Target)
+	return c.JSON(result)
+}
+
+// TestBackupPush checks the configured destination by writing and deleting a probe object
+func TestBackupPush(c *fiber.Ctx) error {
+	result, err := TestBackupDestination(c.UserContext(), time.Now())
+	if err != nil {
+		return backupPushFailed(c, err)
+	}
+	return c.JSON(result)
+}
+
+// StartBackupPush pushes the export on the configured interval until ctx is cancelled
+func StartBackupPush(ctx context.Context) {
+	ticker := time.NewTicker(backupPushTick)
+	goBackground(func() {
+		defer ticker.Stop()
+		runBackupPush(ctx, time.Now(), ticker.C)
+	})
+}
+
+// runBackupPush checks once at start and then on every tick, using the tick time as the clock
+// A push that started is not cancelled with ctx, shutdown waits for it to finish within backupPushTimeout
+func runBackupPush(ctx context.Context, start time.Time, ticks <-chan time.Time) {
+	push := context.WithoutCancel(ctx)
+	withDatabaseLock(func() { scheduledBackupPush(push, start) })
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[BACKUP] Scheduled push stopped")
+			return
+		case now := <-ticks:
+			withDatabaseLock(func() { scheduledBackupPush(push, now) })
+		}
+	}
+}
+
+// scheduledBackupPush pushes the export if enabled and the interval passed since the last successful push
+// The time of the last push is stored, so restarts do not push again early
+func scheduledBackupPush(ctx context.Context, now time.Time) {
+	if !settings.Bool(settingBackupPushEnabled) {
+		return
+	}
+	last, _ := db.GetSetting(settingBackupPushLast, "0")
+	lastUnix, _ := strconv.ParseInt(last, 10, 64)
+	interval := time.Duration(settings.Int(settingBackupPushIntervalHours)) * time.Hour
+	if now.Sub(time.Unix(lastUnix, 0)) < interval {
+		return
+	}
+
+	result, err := PushBackupExport(ctx, now)
+	if err != nil {
+		log.Printf("[BACKUP] Scheduled push failed: %v", err)
+		return
+	}
+	log.Printf("[BACKUP] Pushed %s (%d bytes) to %s", result.Key, result.Size, result.Target)
+	if err := db.SetSetting(settingBackupPushLast, strconv.FormatInt(now.Unix(), 10)); err != nil {
+		log.Printf("[BACKUP] Failed to store the time of the last push: %v", err)
+	}
+}
+
+// checkBackupResponse turns a response outside 2xx into an error with the status and the start of the body
+func checkBackupResponse(resp *http.Response, allowed ...int) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	for _, status := range allowed {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if detail := strings.TrimSpace(string(body)); detail != "" {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, detail)
+	}
+	return fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+// s3Destination stores objects in a bucket of an S3-compatible service, addressed path-style
+// so that MinIO and other self-hosted services work without DNS for each bucket
+type s3Destination struct {
+	client    *http.Client
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+}
+
+func (d *s3Destination) put(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := d.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return d.do(req)
+}
+
+func (d *s3Destination) delete(ctx context.Context, key string) error {
+	req, err := d.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	return d.do(req)
+}
+
+func (d *s3Destination) do(req *http.Request) error {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkBackupResponse(resp)
+}
+
+// request builds a request for key signed with AWS Signature Version 4
+func (d *s3Destination) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	path := "/" + awsEscape(d.bucket) + "/" + awsEscapePath(key)
+	req, err := http.NewRequestWithContext(ctx, method, d.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		"",
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + d.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+d.secretKey), date)
+	for _, part := range []string{d.region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		d.accessKey, scope, signedHeaders, signature))
+	return req, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, as Signature Version 4 expects
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsEscapePath escapes each segment of a key and keeps the slashes between them
+func awsEscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// webDAVDestination stores files below a WebDAV collection with basic auth
+// Collections named by the prefix must already exist
+type webDAVDestination struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	password string
+}
+
+func (d *webDAVDestination) put(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := d.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return d.do(req)
+}
+
+func (d *webDAVDestination) delete(ctx context.Context, key string) error {
+	req, err := d.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	// Already gone counts as deleted
+	return d.do(req, http.StatusNotFound)
+}
+
+func (d *webDAVDestination) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, d.baseURL+"/"+strings.Join(segments, "/"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if d.username != "" || d.password != "" {
+		req.SetBasicAuth(d.username, d.password)
+	}
+	return req, nil
+}
+
+func (d *webDAVDestination) do(req *http.Request, allowed ...int) error {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkBackupResponse(resp, allowed...)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Build metadata, set at build time via ldflags
+// Empty values are filled from the Go build info when available
+var (
+	GitCommit = ""
+	BuildDate = ""
+	GoVersion = ""
+)
+
+// gitDescribeSuffix matches the "-<commits>-g<hash>[-dirty]" suffix added by git describe
+var gitDescribeSuffix = regexp.MustCompile(`-\d+-g[0-9a-fA-F]+(-dirty)?$|-dirty$`)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+var buildInfoOnce sync.Once
+
+// fillBuildInfo fills missing ldflags values from the embedded Go build info
+func fillBuildInfo() {
+	if GoVersion == "" {
+		GoVersion = runtime.Version()
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	modified := false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if GitCommit == "" {
+				GitCommit = s.Value
+			}
+		case "vcs.time":
+			if BuildDate == "" {
+				BuildDate = s.Value
+			}
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if modified && GitCommit != "" {
+		GitCommit += "-dirty"
+	}
+}
+
+// GetBuildInfo returns the metadata of the running binary
+func GetBuildInfo() BuildInfo {
+	buildInfoOnce.Do(fillBuildInfo)
+
+	info := BuildInfo{
+		Version:   AppVersion,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: GoVersion,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// GetVersionBuild returns build metadata without contacting GitHub
+func GetVersionBuild(c *fiber.Ctx) error {
+	return c.JSON(GetBuildInfo())
+}
+
+// stripDescribeSuffix reduces a git describe version like "1.5.0-12-gabcdef" to "1.5.0"
+func stripDescribeSuffix(v string) string {
+	return gitDescribeSuffix.ReplaceAllString(v, "")
+}
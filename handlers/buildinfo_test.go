@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"shopping-list/settings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStripDescribeSuffix(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"1.5.0-12-gabcdef", "1.5.0"},
+		{"v1.5.0-12-gabcdef", "v1.5.0"},
+		{"v1.5.0-12-gABCDEF0", "v1.5.0"},
+		{"v1.5.0-0-g1a2b3c4", "v1.5.0"},
+		{"v1.5.0-12-gabcdef-dirty", "v1.5.0"},
+		{"v1.5.0-dirty", "v1.5.0"},
+		{"v1.5.0-rc.1-3-gabc123", "v1.5.0-rc.1"},
+		{"v1.5.0-rc.1-3-gabc123-dirty", "v1.5.0-rc.1"},
+		// Versions that only look similar are left alone
+		{"v1.5.0", "v1.5.0"},
+		{"v1.5.0-rc.1", "v1.5.0-rc.1"},
+		{"v1.5.0-12", "v1.5.0-12"},
+		{"v1.5.0-12-gxyz", "v1.5.0-12-gxyz"},
+		{"v1.5.0-12-gabcdef+build.3", "v1.5.0-12-gabcdef+build.3"},
+		{"dev", "dev"},
+	}
+	for _, tt := range tests {
+		if got := stripDescribeSuffix(tt.in); got != tt.want {
+			t.Errorf("stripDescribeSuffix(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsNewerVersionThanDescribeBuild(t *testing.T) {
+	// A build some commits past a tag is at least that release
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.5.0", "v1.5.0-12-gabcdef", false},
+		{"v1.5.0", "1.5.0-12-gabcdef-dirty", false},
+		{"v1.4.9", "v1.5.0-12-gabcdef", false},
+		{"v1.5.0-rc.2", "v1.5.0-12-gabcdef", false},
+		{"v1.5.1", "v1.5.0-12-gabcdef", true},
+		{"v1.6.0", "v1.5.0-dirty", true},
+		{"v1.5.0-rc.1", "v1.5.0-rc.1-3-gabc123", false},
+		{"v1.5.0-rc.2", "v1.5.0-rc.1-3-gabc123", true},
+		{"v1.5.0", "v1.5.0-rc.1-3-gabc123", true},
+	}
+	for _, tt := range tests {
+		if got := isNewerVersion(tt.latest, tt.current); got != tt.want {
+			t.Errorf("isNewerVersion(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestGetVersionForDescribeBuild(t *testing.T) {
+	setupTestDB(t)
+	useVersionState(t)
+	useFakeGitHub(t, map[string]fakeResponse{
+		testLatestURL: {status: http.StatusOK, fixture: "github_release_latest.json"},
+	})
+	app := newVersionApp()
+
+	// A build of v2.4.0 with local commits is not offered v2.4.0, and keeps its full version
+	AppVersion = "v2.4.0-7-g1a2b3c4-dirty"
+	if v := getVersion(t, app, "GET", "/api/version"); v.UpdateAvailable || v.Latest != "v2.4.0" || v.Current != AppVersion || v.Build.Version != AppVersion {
+		t.Errorf("version = %+v, want no update for a build past v2.4.0", v)
+	}
+	AppVersion = "v2.3.1-4-g1a2b3c4"
+	if v := getVersion(t, app, "GET", "/api/version"); !v.UpdateAvailable || v.ReleaseURL == "" {
+		t.Errorf("version = %+v, want v2.4.0 offered to a build past v2.3.1", v)
+	}
+}
+
+func TestGetVersionBuildOffline(t *testing.T) {
+	setupTestDB(t)
+	useVersionState(t)
+	doer := useFakeGitHub(t, nil)
+	doer.err = errors.New("dial tcp: lookup api.github.com: no such host")
+	previous := GitCommit
+	GitCommit = "1a2b3c4d"
+	t.Cleanup(func() { GitCommit = previous })
+
+	app := fiber.New()
+	app.Get("/api/version/build", GetVersionBuild)
+	get := func() BuildInfo {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/version/build", nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var info BuildInfo
+		if resp.StatusCode != fiber.StatusOK || json.Unmarshal(data, &info) != nil {
+			t.Fatalf("GET /api/version/build: %d %s", resp.StatusCode, data)
+		}
+		return info
+	}
+
+	// The build endpoint answers without GitHub, whether the update check is on or off
+	for _, enabled := range []bool{true, false} {
+		if err := settings.Update(map[string]any{settingUpdateCheckEnabled: enabled}); err != nil {
+			t.Fatal(err)
+		}
+		info := get()
+		want := BuildInfo{Version: "v2.3.0", GitCommit: "1a2b3c4d", BuildDate: info.BuildDate, GoVersion: info.GoVersion, OS: runtime.GOOS, Arch: runtime.GOARCH}
+		if info != want || info.GoVersion == "" || info.BuildDate == "" {
+			t.Errorf("build info with the check enabled=%v = %+v, want %+v", enabled, info, want)
+		}
+	}
+	if len(doer.requested) != 0 {
+		t.Errorf("build info requested %v", doer.requested)
+	}
+}
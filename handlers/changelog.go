@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"shopping-list/i18n"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	changelogPageSize         = 30
+	changelogMaxPages         = 5
+	changelogUncomparableSize = 5
+	maxChangelogSummaryLength = 8000
+)
+
+var (
+	changelogReleases  []githubRelease
+	changelogRepo      string
+	changelogETag      string
+	changelogFetchedAt time.Time
+	changelogMutex     sync.Mutex
+)
+
+// changelogEntry is a single release in the changelog response
+type changelogEntry struct {
+	Tag         string `json:"tag"`
+	PublishedAt string `json:"published_at,omitempty"`
+	// PublishedAtDisplay is the publish date formatted for the request language
+	PublishedAtDisplay string `json:"published_at_display,omitempty"`
+	URL                string `json:"url"`
+	Body               string `json:"body"`
+	Prerelease         bool   `json:"prerelease,omitempty"`
+}
+
+type changelogResponse struct {
+	Current string `json:"current"`
+	Enabled bool   `json:"enabled"`
+	// Comparable is false when the current version is not a release (e.g. "dev")
+	Comparable bool             `json:"comparable"`
+	Releases   []changelogEntry `json:"releases"`
+	Summary    string           `json:"summary,omitempty"`
+}
+
+// GetChangelog returns all releases newer than the running version
+func GetChangelog(c *fiber.Ctx) error {
+	response := changelogResponse{
+		Current:  AppVersion,
+		Releases: []changelogEntry{},
+	}
+	if !updateCheckEnabled() {
+		return c.JSON(response)
+	}
+	response.Enabled = true
+
+	lang := RequestLang(c)
+	repo := updateRepository()
+	releases, err := getCachedReleaseList(repo)
+	if err != nil && releases == nil {
+		return Fail(c, ErrCodeUpstream, "Failed to fetch releases")
+	}
+
+	withPrereleases := includePrereleases()
+	response.Comparable = AppVersion != "dev" && AppVersion != "unknown" && AppVersion != ""
+
+	var summary strings.Builder
+	for i := range releases {
+		r := releases[i]
+		if r.Draft || (r.Prerelease && !withPrereleases) {
+			continue
+		}
+		if response.Comparable {
+			if compareVersions(r.TagName, AppVersion) <= 0 {
+				continue
+			}
+		} else if len(response.Releases) >= changelogUncomparableSize {
+			break
+		}
+
+		entry := releaseToChangelogEntry(lang, repo, r)
+		response.Releases = append(response.Releases, entry)
+		fmt.Fprintf(&summary, "## %s\n\n%s\n\n", entry.Tag, strings.TrimSpace(entry.Body))
+	}
+
+	response.Summary = abbreviateText(strings.TrimSpace(summary.String()), maxChangelogSummaryLength)
+	return c.JSON(response)
+}
+
+func releaseToChangelogEntry(lang, repo string, r githubRelease) changelogEntry {
+	info := releaseFromGitHub(repo, &r)
+	entry := changelogEntry{
+		Tag:         r.TagName,
+		PublishedAt: r.PublishedAt,
+		URL:         info.URL,
+		Body:        r.Body,
+		Prerelease:  r.Prerelease,
+	}
+	if t, err := time.Parse(time.RFC3339, r.PublishedAt); err == nil {
+		entry.PublishedAtDisplay = i18n.FormatDate(lang, t, i18n.DateLong)
+	}
+	return entry
+}
+
+// getCachedReleaseList returns the release list, refreshed with the update check interval
+// On errors the previous list is returned along with the error
+func getCachedReleaseList(repo string) ([]githubRelease, error) {
+	changelogMutex.Lock()
+	defer changelogMutex.Unlock()
+
+	if changelogRepo == repo && changelogReleases != nil && versionClock().Sub(changelogFetchedAt) < versionCacheTTL() {
+		return changelogReleases, nil
+	}
+	if changelogRepo != repo {
+		changelogReleases = nil
+		changelogETag = ""
+	}
+
+	versionMutex.RLock()
+	limited := versionClock().Before(rateLimitedUntil)
+	versionMutex.RUnlock()
+	if limited {
+		return changelogReleases, fmt.Errorf("rate limited")
+	}
+
+	releases, etag, notModified, err := fetchReleaseList(repo, changelogETag)
+	if err != nil {
+		return changelogReleases, err
+	}
+	if !notModified || changelogReleases == nil {
+		changelogReleases = releases
+		changelogETag = etag
+	}
+	changelogRepo = repo
+	changelogFetchedAt = versionClock()
+	return changelogReleases, nil
+}
+
+// fetchReleaseList fetches releases newest-first, following pages until an older
+// release than the running version is seen or the page limit is reached
+// The ETag only applies to the first page; a 304 means the cached list is current
+func fetchReleaseList(repo, etag string) ([]githubRelease, string, bool, error) {
+	var all []githubRelease
+	var firstETag string
+
+	for page := 1; page <= changelogMaxPages; page++ {
+		url := fmt.Sprintf("%s/releases?per_page=%d&page=%d", githubRepoAPI(repo), changelogPageSize, page)
+		pageETag := ""
+		if page == 1 {
+			pageETag = etag
+		}
+
+		req, err := newGitHubRequest(url, pageETag)
+		if err != nil {
+			return nil, "", false, err
+		}
+		resp, err := versionHTTPClient.Do(req)
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		if reset, limited := rateLimitReset(resp); limited {
+			resp.Body.Close()
+			versionMutex.Lock()
+			rateLimitedUntil = reset
+			versionMutex.Unlock()
+			return nil, "", false, fmt.Errorf("rate limited until %s", reset.Format(time.RFC3339))
+		}
+		if page == 1 && resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			return nil, etag, true, nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, "", false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		if page == 1 {
+			firstETag = resp.Header.Get("ETag")
+		}
+
+		var releases []githubRelease
+		err = json.NewDecoder(resp.Body).Decode(&releases)
+		resp.Body.Close()
+		if err != nil {
+			return nil, "", false, err
+		}
+		all = append(all, releases...)
+
+		if len(releases) < changelogPageSize || reachedCurrentVersion(releases) {
+			break
+		}
+	}
+
+	return all, firstETag, false, nil
+}
+
+// reachedCurrentVersion returns true if the page contains the running version or older
+func reachedCurrentVersion(releases []githubRelease) bool {
+	if AppVersion == "dev" || AppVersion == "unknown" || AppVersion == "" {
+		return true
+	}
+	for _, r := range releases {
+		if compareVersions(r.TagName, AppVersion) <= 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"shopping-list/settings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// changelogPage is the URL of a page of the release list of the test repository
+func changelogPage(page string) string {
+	return testRepoAPI + "/releases?per_page=30&page=" + page
+}
+
+// getChangelog requests the changelog with the running version set to current
+func getChangelog(t *testing.T, current string) changelogResponse {
+	t.Helper()
+	AppVersion = current
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/api/version/changelog", GetChangelog)
+	req := httptest.NewRequest("GET", "/api/version/changelog", nil)
+	req.Header.Set("Accept-Language", "en")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var changelog changelogResponse
+	if resp.StatusCode != fiber.StatusOK || json.Unmarshal(data, &changelog) != nil {
+		t.Fatalf("GET /api/version/changelog: %d %s", resp.StatusCode, data)
+	}
+	return changelog
+}
+
+// changelogTags returns the tags of the releases in a changelog, in order
+func changelogTags(c changelogResponse) []string {
+	tags := []string{}
+	for _, r := range c.Releases {
+		tags = append(tags, r.Tag)
+	}
+	return tags
+}
+
+func TestChangelogPagination(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+
+	cases := []struct {
+		name, current string
+		pages         []string
+		releases      int
+		oldest        string
+	}{
+		// Page 1 is full and all newer, so page 2 is needed, and it reaches the running version
+		{"two pages", "v2.5.0", []string{"1", "2"}, 34, "v2.6.0"},
+		// The running version is on page 1, nothing older is fetched
+		{"one page", "v3.10.0", []string{"1"}, 19, "v3.11.0"},
+		// Older than every listed release, pages run out before the page limit
+		{"older than all", "v1.0.0", []string{"1", "2"}, 40, "v2.0.0"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			useVersionState(t)
+			doer := useFakeGitHub(t, map[string]fakeResponse{
+				changelogPage("1"): {status: http.StatusOK, fixture: "github_releases_page1.json"},
+				changelogPage("2"): {status: http.StatusOK, fixture: "github_releases_page2.json"},
+			})
+
+			changelog := getChangelog(t, tc.current)
+			var want []string
+			for _, page := range tc.pages {
+				want = append(want, changelogPage(page))
+			}
+			if !reflect.DeepEqual(doer.requested, want) {
+				t.Errorf("requested %v, want %v", doer.requested, want)
+			}
+			tags := changelogTags(changelog)
+			if !changelog.Enabled || !changelog.Comparable || len(tags) != tc.releases || tags[0] != "v3.29.0" || tags[len(tags)-1] != tc.oldest {
+				t.Errorf("changelog = %v, want %d releases from v3.29.0 to %s", tags, tc.releases, tc.oldest)
+			}
+		})
+	}
+}
+
+func TestChangelogEntriesAndSummary(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	useVersionState(t)
+	useFakeGitHub(t, map[string]fakeResponse{
+		changelogPage("1"): {status: http.StatusOK, fixture: "github_releases_page1.json"},
+		changelogPage("2"): {status: http.StatusOK, fixture: "github_releases_page2.json"},
+	})
+
+	changelog := getChangelog(t, "v2.5.0")
+	newest := changelog.Releases[0]
+	if newest.URL != "https://github.com/PanSalut/Koffan/releases/tag/v3.29.0" || newest.PublishedAt != "2026-10-01T09:07:00Z" ||
+		newest.PublishedAtDisplay == "" || !strings.HasPrefix(newest.Body, "## What's new") {
+		t.Errorf("newest entry = %+v", newest)
+	}
+
+	// The summary starts with the newest release and is cut to its limit
+	if !strings.HasPrefix(changelog.Summary, "## v3.29.0\n\n## What's new") || !strings.HasSuffix(changelog.Summary, "…") {
+		t.Errorf("summary starts %.40q and ends %q, want the newest release first and a cut", changelog.Summary, changelog.Summary[len(changelog.Summary)-10:])
+	}
+	if n := TextLength(changelog.Summary); n > maxChangelogSummaryLength {
+		t.Errorf("summary is %d characters, want at most %d", n, maxChangelogSummaryLength)
+	}
+}
+
+func TestChangelogFilterBoundary(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+
+	// github_releases.json holds a draft v2.6.0, a prerelease v2.5.0-rc.1 and v2.4.0
+	cases := []struct {
+		current     string
+		prereleases bool
+		want        []string
+	}{
+		{"v2.4.0", false, []string{}},
+		{"v2.3.9", false, []string{"v2.4.0"}},
+		{"v2.4.0", true, []string{"v2.5.0-rc.1"}},
+		{"v2.5.0-beta.2", true, []string{"v2.5.0-rc.1"}},
+		{"v2.5.0-rc.1", true, []string{}},
+		{"v2.5.0", true, []string{}},
+	}
+	for _, tc := range cases {
+		useVersionState(t)
+		useFakeGitHub(t, map[string]fakeResponse{
+			changelogPage("1"): {status: http.StatusOK, fixture: "github_releases.json"},
+		})
+		if err := settings.Update(map[string]any{settingIncludePrerelease: tc.prereleases}); err != nil {
+			t.Fatal(err)
+		}
+		if got := changelogTags(getChangelog(t, tc.current)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("current %s, prereleases %v: changelog %v, want %v", tc.current, tc.prereleases, got, tc.want)
+		}
+	}
+}
+
+func TestChangelogWithoutComparableVersion(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	useVersionState(t)
+	doer := useFakeGitHub(t, map[string]fakeResponse{
+		changelogPage("1"): {status: http.StatusOK, fixture: "github_releases_page1.json"},
+		changelogPage("2"): {status: http.StatusOK, fixture: "github_releases_page2.json"},
+	})
+
+	// A development build cannot be compared, so only the latest few releases are shown
+	changelog := getChangelog(t, "dev")
+	want := []string{"v3.29.0", "v3.28.0", "v3.27.0", "v3.26.0", "v3.25.0"}
+	if got := changelogTags(changelog); changelog.Comparable || !reflect.DeepEqual(got, want) {
+		t.Errorf("changelog = %v, comparable %v, want %v and not comparable", got, changelog.Comparable, want)
+	}
+	if len(doer.requested) != 1 {
+		t.Errorf("requested %v, want only the first page", doer.requested)
+	}
+}
+
+func TestChangelogCache(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	clock := useVersionState(t)
+	doer := useFakeGitHub(t, map[string]fakeResponse{
+		changelogPage("1"): {status: http.StatusOK, fixture: "github_releases.json", header: http.Header{"Etag": {`"list-1"`}}},
+	})
+
+	getChangelog(t, "v2.3.0")
+	clock.Advance(versionCacheTTL() - time.Minute)
+	getChangelog(t, "v2.3.0")
+	if len(doer.requested) != 1 {
+		t.Fatalf("%d requests within the interval, want 1", len(doer.requested))
+	}
+
+	// After the interval the list is revalidated, a 304 keeps it
+	clock.Advance(2 * time.Minute)
+	doer.responses[changelogPage("1")] = fakeResponse{status: http.StatusNotModified}
+	if got := changelogTags(getChangelog(t, "v2.3.0")); !reflect.DeepEqual(got, []string{"v2.4.0"}) {
+		t.Errorf("changelog after a 304 = %v, want the cached v2.4.0", got)
+	}
+	if len(doer.requested) != 2 || doer.headers[1].Get("If-None-Match") != `"list-1"` {
+		t.Errorf("revalidation: %d requests, If-None-Match %q", len(doer.requested), doer.headers[len(doer.headers)-1].Get("If-None-Match"))
+	}
+
+	// Without GitHub the cached list is still served, the disabled check serves nothing
+	clock.Advance(versionCacheTTL())
+	doer.responses[changelogPage("1")] = fakeResponse{status: http.StatusBadGateway}
+	if got := changelogTags(getChangelog(t, "v2.3.0")); !reflect.DeepEqual(got, []string{"v2.4.0"}) {
+		t.Errorf("changelog while GitHub fails = %v, want the cached v2.4.0", got)
+	}
+	if err := settings.Update(map[string]any{settingUpdateCheckEnabled: false}); err != nil {
+		t.Fatal(err)
+	}
+	if changelog := getChangelog(t, "v2.3.0"); changelog.Enabled || len(changelog.Releases) != 0 || len(doer.requested) != 3 {
+		t.Errorf("disabled changelog = %+v after %d requests", changelog, len(doer.requested))
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"shopping-list/db"
+	"shopping-list/settings"
+	"time"
+)
+
+const (
+	settingAutoCleanupEnabled = "auto_cleanup_enabled"
+	settingAutoCleanupDays    = "auto_cleanup_days"
+
+	// autoCleanupTick is how often the background cleanup runs
+	autoCleanupTick = 24 * time.Hour
+)
+
+// CleanupReport describes the result of a completed-items cleanup
+type CleanupReport struct {
+	DryRun bool                   `json:"dry_run"`
+	Days   int                    `json:"days"`
+	Cutoff int64                  `json:"cutoff"`
+	Total  int                    `json:"total"`
+	Lists  []db.CleanupListResult `json:"lists"`
+}
+
+// AutoCleanupDays returns the configured age in days after which completed items are removed
+func AutoCleanupDays() int {
+	return settings.Int(settingAutoCleanupDays)
+}
+
+// RunCleanup removes items completed more than days before now
+// now is passed in so the cutoff does not depend on the wall clock
+func RunCleanup(now time.Time, days int, dryRun bool) (*CleanupReport, error) {
+	cutoff := now.AddDate(0, 0, -days).Unix()
+	lists, err := db.CleanupCompletedItems(cutoff, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CleanupReport{
+		DryRun: dryRun,
+		Days:   days,
+		Cutoff: cutoff,
+		Lists:  lists,
+	}
+	if report.Lists == nil {
+		report.Lists = []db.CleanupListResult{}
+	}
+	for _, l := range lists {
+		report.Total += l.Count
+		if !dryRun {
+			BroadcastUpdate("items_cleared", map[string]interface{}{
+				"list_id": l.ListID,
+				"count":   l.Count,
+			})
+		}
+	}
+	return report, nil
+}
+
+// StartAutoCleanup runs the daily completed-items cleanup until ctx is cancelled
+func StartAutoCleanup(ctx context.Context) {
+	ticker := time.NewTicker(autoCleanupTick)
+	goBackground(func() {
+		defer ticker.Stop()
+		runAutoCleanup(ctx, time.Now(), ticker.C)
+	})
+}
+
+// runAutoCleanup cleans up once at start and then on every tick, using the tick time as the clock
+func runAutoCleanup(ctx context.Context, start time.Time, ticks <-chan time.Time) {
+	withDatabaseLock(func() { autoCleanup(start) })
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[CLEANUP] Auto cleanup stopped")
+			return
+		case now := <-ticks:
+			withDatabaseLock(func() { autoCleanup(now) })
+		}
+	}
+}
+
+// autoCleanup removes orphaned files, expired idempotency keys, item events, trash and product lookups, and completed items
+// if enabled in settings
+func autoCleanup(now time.Time) {
+	if _, err := CleanupFiles(false); err != nil {
+		log.Printf("[CLEANUP] Orphaned file cleanup failed: %v", err)
+	}
+	if _, err := db.DeleteExpiredIdempotencyKeys(now.Add(-IdempotencyTTL()).Unix()); err != nil {
+		log.Printf("[CLEANUP] Idempotency key cleanup failed: %v", err)
+	}
+	if _, err := PruneItemEvents(now); err != nil {
+		log.Printf("[CLEANUP] Item event cleanup failed: %v", err)
+	}
+	if purged, err := PurgeExpiredTrash(now); err != nil {
+		log.Printf("[CLEANUP] Trash cleanup failed: %v", err)
+	} else if purged > 0 {
+		log.Printf("[CLEANUP] Purged %d item(s) from the trash", purged)
+	}
+	if _, err := PruneProductCache(now); err != nil {
+		log.Printf("[CLEANUP] Product cache cleanup failed: %v", err)
+	}
+
+	if !settings.Bool(settingAutoCleanupEnabled) {
+		return
+	}
+
+	report, err := RunCleanup(now, AutoCleanupDays(), false)
+	if err != nil {
+		log.Printf("[CLEANUP] Auto cleanup failed: %v", err)
+		return
+	}
+	if report.Total > 0 {
+		log.Printf("[CLEANUP] Removed %d completed item(s) older than %d days", report.Total, report.Days)
+	}
+}
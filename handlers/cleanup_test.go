@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/settings"
+)
+
+// createCompletedItem creates an item completed at the given time, or an open one if at is zero
+func createCompletedItem(t *testing.T, sectionID int64, name string, at time.Time) int64 {
+	t.Helper()
+	item, err := db.CreateItem(sectionID, name, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.IsZero() {
+		if _, err := db.DB.Exec("UPDATE items SET completed = TRUE, completed_at = ? WHERE id = ?", at.Unix(), item.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return item.ID
+}
+
+func TestAutoCleanupTicker(t *testing.T) {
+	setupTestDB(t)
+	if err := settings.Update(map[string]any{settingAutoCleanupEnabled: true, settingAutoCleanupDays: 30}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	groceries, _ := db.CreateList("Groceries", "")
+	food, _ := db.CreateSectionForList(groceries.ID, "Food")
+	hardware, _ := db.CreateList("Hardware", "")
+	tools, _ := db.CreateSectionForList(hardware.ID, "Tools")
+	oldMilk := createCompletedItem(t, food.ID, "Old milk", start.AddDate(0, 0, -40))
+	bread := createCompletedItem(t, food.ID, "Bread", start.AddDate(0, 0, -25))
+	flour := createCompletedItem(t, food.ID, "Flour", start.AddDate(0, 0, -5))
+	eggs := createCompletedItem(t, food.ID, "Eggs", time.Time{})
+	nails := createCompletedItem(t, tools.ID, "Nails", start.AddDate(0, 0, -35))
+	conn := dialWebSocket(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticks, done := make(chan time.Time), make(chan struct{})
+	go func() { runAutoCleanup(ctx, start, ticks); close(done) }()
+	// A tick is only received once the run before it finished, so a second tick waits for the first
+	tick := func(at time.Time) {
+		ticks <- at
+		ticks <- at
+	}
+	cleared := func() (listID int64, count int) {
+		t.Helper()
+		msg, ok := readBroadcast(t, conn, 2*time.Second)
+		var data struct {
+			ListID int64 `json:"list_id"`
+			Count  int   `json:"count"`
+		}
+		if !ok || msg.Type != "items_cleared" || json.Unmarshal(msg.Data, &data) != nil {
+			t.Fatalf("broadcast = %+v (%v), want items_cleared", msg, ok)
+		}
+		return data.ListID, data.Count
+	}
+
+	// The run at start removes what was completed more than 30 days before it, one event per list
+	if list, count := cleared(); list != groceries.ID || count != 1 {
+		t.Errorf("first event for list %d with %d items, want Groceries with 1", list, count)
+	}
+	if list, count := cleared(); list != hardware.ID || count != 1 {
+		t.Errorf("second event for list %d with %d items, want Hardware with 1", list, count)
+	}
+
+	// Ten days on, Bread has passed the cutoff too
+	tick(start.AddDate(0, 0, 10))
+	if list, count := cleared(); list != groceries.ID || count != 1 {
+		t.Errorf("event for list %d with %d items, want Groceries with 1", list, count)
+	}
+	trashed := map[int64]bool{}
+	for _, listID := range []int64{groceries.ID, hardware.ID} {
+		trash, _, err := db.GetTrash(listID, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range trash {
+			trashed[item.ID] = true
+		}
+	}
+	if len(trashed) != 3 || !trashed[oldMilk] || !trashed[bread] || !trashed[nails] {
+		t.Errorf("trash = %v, want old milk, bread and nails", trashed)
+	}
+	for _, id := range []int64{flour, eggs} {
+		if _, err := db.GetItemByID(id); err != nil {
+			t.Errorf("item %d: %v, want it kept", id, err)
+		}
+	}
+	var history int
+	db.DB.QueryRow("SELECT COUNT(*) FROM item_history WHERE name IN ('Old milk', 'Bread', 'Nails')").Scan(&history)
+	if history != 3 {
+		t.Errorf("%d removed items in the history, want 3", history)
+	}
+
+	// Switched off, later runs leave completed items alone, however old
+	if err := settings.Update(map[string]any{settingAutoCleanupEnabled: false}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, ok := readBroadcast(t, conn, 2*time.Second); !ok || msg.Type != "settings_changed" {
+		t.Fatalf("broadcast = %+v (%v), want settings_changed", msg, ok)
+	}
+	tick(start.AddDate(0, 0, 40))
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("auto cleanup did not stop")
+	}
+	if _, err := db.GetItemByID(flour); err != nil {
+		t.Errorf("flour: %v, want it kept while cleanup is off", err)
+	}
+	if msg, ok := readBroadcast(t, conn, 100*time.Millisecond); ok {
+		t.Errorf("cleanup while off broadcast %+v", msg)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+	CSRFFormField  = "_csrf"
+)
+
+// setCSRFCookie issues a new CSRF token cookie and returns the token
+// The cookie is readable from JS so the UI can echo it back (double-submit pattern)
+func setCSRFCookie(c *fiber.Ctx) string {
+	token := generateSessionID()
+	c.Cookie(&fiber.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Expires:  time.Now().Add(SessionDuration),
+		HTTPOnly: false,
+		Secure:   isSecureConnection(c),
+		SameSite: "Lax",
+		Path:     "/",
+	})
+	// Make the new token visible to handlers rendering in this request
+	c.Locals(CSRFCookieName, token)
+	return token
+}
+
+// isCSRFExempt returns true for routes that do not use cookie authentication
+func isCSRFExempt(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/") || path == "/login"
+}
+
+// isTokenAuthenticated returns true for requests carrying an Authorization header, such as POST /api/export/link
+// Browsers cannot add that header to a cross-site request without a CORS preflight, which the server never allows
+func isTokenAuthenticated(c *fiber.Ctx) bool {
+	return len(c.Request().Header.Peek(fiber.HeaderAuthorization)) > 0
+}
+
+// isSafeMethod returns true for HTTP methods that must not change state
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// CSRFMiddleware requires a matching CSRF token on state-changing UI requests
+// The token is sent in the X-CSRF-Token header (fetch/htmx) or the _csrf form field
+func CSRFMiddleware(c *fiber.Ctx) error {
+	if isCSRFExempt(RoutePath(c)) || isTokenAuthenticated(c) {
+		return c.Next()
+	}
+
+	cookieToken := c.Cookies(CSRFCookieName)
+	if isSafeMethod(c.Method()) {
+		if cookieToken == "" {
+			setCSRFCookie(c)
+		}
+		return c.Next()
+	}
+
+	requestToken := c.Get(CSRFHeaderName)
+	if requestToken == "" {
+		requestToken = c.FormValue(CSRFFormField)
+	}
+
+	if cookieToken == "" || requestToken == "" ||
+		subtle.ConstantTimeCompare([]byte(cookieToken), []byte(requestToken)) != 1 {
+		return Fail(c, ErrCodeCSRFInvalid, "Missing or invalid CSRF token")
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newCSRFApp returns an app with the CSRF middleware in front of the login and import handlers
+func newCSRFApp(t *testing.T) *fiber.App {
+	t.Helper()
+	setupTestDB(t)
+	t.Setenv("APP_PASSWORD", "secret")
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(CSRFMiddleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	app.Post("/login", Login)
+	app.Post("/import", ImportData)
+	return app
+}
+
+// importRequest builds a multipart import of a JSON export holding one list named listName
+// csrfField is sent as the _csrf form field when not empty
+func importRequest(t *testing.T, listName, csrfField string) *http.Request {
+	t.Helper()
+	export, err := json.Marshal(ExportData{
+		Version: ExportVersion,
+		App:     "koffan",
+		Data: ExportBody{Lists: []ExportList{{
+			Name:     listName,
+			Sections: []ExportSection{{Name: "Dairy", Items: []ExportItem{{Name: "Milk", Quantity: 1}}}},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("encode export: %v", err)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if csrfField != "" {
+		w.WriteField(CSRFFormField, csrfField)
+	}
+	part, _ := w.CreateFormFile("file", "export.json")
+	part.Write(export)
+	w.Close()
+
+	req := httptest.NewRequest("POST", "/import", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+// sendCSRF sends req with the CSRF cookie and header set when not empty
+// It returns the response status, the error code if any and the response
+func sendCSRF(t *testing.T, app *fiber.App, req *http.Request, cookie, header string) (int, string, *http.Response) {
+	t.Helper()
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: cookie})
+	}
+	if header != "" {
+		req.Header.Set(CSRFHeaderName, header)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var errResp ErrorResponse
+	json.Unmarshal(data, &errResp)
+	return resp.StatusCode, errResp.Error, resp
+}
+
+// csrfCookie returns the CSRF token set by resp, empty if none
+func csrfCookie(resp *http.Response) string {
+	for _, c := range resp.Cookies() {
+		if c.Name == CSRFCookieName {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// listExists reports whether a list with the given name was created
+func listExists(t *testing.T, name string) bool {
+	t.Helper()
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatalf("get lists: %v", err)
+	}
+	for _, l := range lists {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCSRFImportRejectsMissingToken(t *testing.T) {
+	app := newCSRFApp(t)
+
+	tests := []struct {
+		name, cookie, header string
+	}{
+		{"no cookie and no token", "", ""},
+		{"cookie without token", "cookie-token", ""},
+		{"token without cookie", "", "cookie-token"},
+	}
+	for _, tt := range tests {
+		status, code, _ := sendCSRF(t, app, importRequest(t, tt.name, ""), tt.cookie, tt.header)
+		if status != fiber.StatusForbidden || code != ErrCodeCSRFInvalid {
+			t.Errorf("%s: got %d %q, want 403 %q", tt.name, status, code, ErrCodeCSRFInvalid)
+		}
+		if listExists(t, tt.name) {
+			t.Errorf("%s: import ran despite the rejection", tt.name)
+		}
+	}
+}
+
+func TestCSRFImportRejectsStaleToken(t *testing.T) {
+	app := newCSRFApp(t)
+
+	// The token issued before login is rotated by it
+	_, _, resp := sendCSRF(t, app, httptest.NewRequest("GET", "/", nil), "", "")
+	stale := csrfCookie(resp)
+	if stale == "" {
+		t.Fatal("GET did not issue a CSRF cookie")
+	}
+
+	form := url.Values{"password": {"secret"}}
+	login := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	login.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	status, _, resp := sendCSRF(t, app, login, stale, "")
+	if status != fiber.StatusFound {
+		t.Fatalf("login: got %d, want 302", status)
+	}
+	fresh := csrfCookie(resp)
+	if fresh == "" || fresh == stale {
+		t.Fatalf("login did not rotate the CSRF token (before %q, after %q)", stale, fresh)
+	}
+
+	status, code, _ := sendCSRF(t, app, importRequest(t, "Stale", ""), fresh, stale)
+	if status != fiber.StatusForbidden || code != ErrCodeCSRFInvalid {
+		t.Errorf("stale header: got %d %q, want 403 %q", status, code, ErrCodeCSRFInvalid)
+	}
+	status, code, _ = sendCSRF(t, app, importRequest(t, "Stale form", stale), fresh, "")
+	if status != fiber.StatusForbidden || code != ErrCodeCSRFInvalid {
+		t.Errorf("stale form field: got %d %q, want 403 %q", status, code, ErrCodeCSRFInvalid)
+	}
+	if listExists(t, "Stale") || listExists(t, "Stale form") {
+		t.Error("import ran with a stale token")
+	}
+}
+
+func TestCSRFImportAcceptsValidToken(t *testing.T) {
+	app := newCSRFApp(t)
+
+	if status, code, _ := sendCSRF(t, app, importRequest(t, "Header", ""), "valid-token", "valid-token"); status != fiber.StatusOK {
+		t.Errorf("valid header: got %d %q, want 200", status, code)
+	}
+	if status, code, _ := sendCSRF(t, app, importRequest(t, "Form", "valid-token"), "valid-token", ""); status != fiber.StatusOK {
+		t.Errorf("valid form field: got %d %q, want 200", status, code)
+	}
+	if !listExists(t, "Header") || !listExists(t, "Form") {
+		t.Error("imports with a valid token did not create their lists")
+	}
+}
+
+func TestCSRFExemptRoutes(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(CSRFMiddleware)
+	app.Post("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	// The token-authenticated API does not use cookies and needs no CSRF token
+	for _, path := range []string{"/api/v1/items", "/API/V1/items", "/login", "/Login/"} {
+		if status, code, _ := sendCSRF(t, app, httptest.NewRequest("POST", path, nil), "", ""); status != fiber.StatusOK {
+			t.Errorf("POST %s: got %d %q, want 200", path, status, code)
+		}
+	}
+	for _, path := range []string{"/api/database/clear", "/import", "/api/v1", "/loginx"} {
+		if status, _, _ := sendCSRF(t, app, httptest.NewRequest("POST", path, nil), "", ""); status != fiber.StatusForbidden {
+			t.Errorf("POST %s: got %d, want 403", path, status)
+		}
+	}
+
+	// A request carrying an Authorization header is token authenticated on any route
+	req := httptest.NewRequest("POST", "/api/export/link", nil)
+	req.Header.Set("Authorization", "Bearer some-token")
+	if status, code, _ := sendCSRF(t, app, req, "", ""); status != fiber.StatusOK {
+		t.Errorf("POST with an Authorization header: got %d %q, want 200", status, code)
+	}
+	if status, _, _ := sendCSRF(t, app, httptest.NewRequest("POST", "/api/export/link", nil), "", ""); status != fiber.StatusForbidden {
+		t.Errorf("POST /api/export/link without an Authorization header: got %d, want 403", status)
+	}
+}
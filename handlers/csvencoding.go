@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings of CSV files, as reported in previews
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingISO88591    = "iso-8859-1"
+)
+
+// encodingSniffSize is how much of a file without a byte order mark is looked at to guess its encoding
+const encodingSniffSize = 4096
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// parseEncoding checks the encoding option of an import, "" detects it
+// "utf-16" takes the byte order from the byte order mark or the content
+func parseEncoding(name string) (string, *AppError) {
+	switch name {
+	case "", "utf-16", EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingWindows1252, EncodingISO88591:
+		return name, nil
+	case "utf8":
+		return EncodingUTF8, nil
+	case "cp1252":
+		return EncodingWindows1252, nil
+	case "latin1":
+		return EncodingISO88591, nil
+	}
+	return "", NewError(ErrCodeValidation, fmt.Sprintf("Unknown encoding %q, use utf-8, utf-16, windows-1252 or iso-8859-1", name))
+}
+
+// decodeCSV returns r transcoded to UTF-8 without its byte order mark, and the encoding it was read as
+// encoding is a value of parseEncoding. Without one a byte order mark decides, otherwise the start of the file:
+// zero bytes mean UTF-16, mostly valid UTF-8 means UTF-8 and anything else is read as Windows-1252
+func decodeCSV(r io.Reader, encoding string) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, encodingSniffSize)
+	head, err := br.Peek(encodingSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	switch {
+	case encoding == "" && bytes.HasPrefix(head, bomUTF8):
+		encoding = EncodingUTF8
+	case (encoding == "" || encoding == "utf-16") && bytes.HasPrefix(head, bomUTF16LE):
+		encoding = EncodingUTF16LE
+	case (encoding == "" || encoding == "utf-16") && bytes.HasPrefix(head, bomUTF16BE):
+		encoding = EncodingUTF16BE
+	case encoding == "" || encoding == "utf-16":
+		encoding = guessEncoding(head, encoding == "utf-16")
+	}
+
+	switch encoding {
+	case EncodingUTF16LE:
+		skipPrefix(br, bomUTF16LE)
+		return &decodeReader{src: br, decode: utf16Decoder(false)}, encoding, nil
+	case EncodingUTF16BE:
+		skipPrefix(br, bomUTF16BE)
+		return &decodeReader{src: br, decode: utf16Decoder(true)}, encoding, nil
+	case EncodingWindows1252:
+		return &decodeReader{src: br, decode: decodeWindows1252}, encoding, nil
+	case EncodingISO88591:
+		return &decodeReader{src: br, decode: decodeISO88591}, encoding, nil
+	}
+	// UTF-8 is passed through, rows with invalid bytes are skipped when they are imported
+	skipPrefix(br, bomUTF8)
+	return br, EncodingUTF8, nil
+}
+
+// guessEncoding guesses the encoding of a file without a byte order mark from its start
+func guessEncoding(head []byte, utf16Only bool) string {
+	// Text in UTF-16 has a zero byte in most ASCII characters, on the odd bytes in little endian
+	var even, odd int
+	for i, b := range head {
+		if b == 0 {
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	switch {
+	case odd > len(head)/8 && odd > even:
+		return EncodingUTF16LE
+	case even > len(head)/8:
+		return EncodingUTF16BE
+	case utf16Only:
+		return EncodingUTF16LE
+	}
+
+	// Windows-1252 text rarely forms multi-byte UTF-8 characters, so a file that has more of them than invalid bytes
+	// is UTF-8 with a few broken rows, which are skipped rather than misread along with the rest
+	var multiByte, invalid int
+	for i := 0; i < len(head); {
+		r, size := utf8.DecodeRune(head[i:])
+		switch {
+		case r == utf8.RuneError && size == 1 && (utf8.FullRune(head[i:]) || len(head) < encodingSniffSize):
+			invalid++
+		case size > 1:
+			multiByte++
+		}
+		i += size
+	}
+	if invalid == 0 || multiByte > invalid {
+		return EncodingUTF8
+	}
+	return EncodingWindows1252
+}
+
+func skipPrefix(br *bufio.Reader, prefix []byte) {
+	if head, _ := br.Peek(len(prefix)); bytes.Equal(head, prefix) {
+		br.Discard(len(prefix))
+	}
+}
+
+// decodeReader reads the characters of src, as decoded by decode, as UTF-8
+// Bytes that do not form a character are read as utf8.RuneError
+type decodeReader struct {
+	src     *bufio.Reader
+	decode  func(*bufio.Reader) (rune, error)
+	pending []byte
+	err     error
+}
+
+func (d *decodeReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(d.pending) > 0 {
+			c := copy(p[n:], d.pending)
+			d.pending = d.pending[c:]
+			n += c
+			continue
+		}
+		if d.err != nil {
+			break
+		}
+		r, err := d.decode(d.src)
+		if err != nil {
+			d.err = err
+			continue
+		}
+		d.pending = utf8.AppendRune(d.pending[:0], r)
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, d.err
+}
+
+// utf16Decoder returns a decoder of UTF-16 code units, joining surrogate pairs
+func utf16Decoder(bigEndian bool) func(*bufio.Reader) (rune, error) {
+	unit := func(b []byte) rune {
+		if bigEndian {
+			return rune(b[0])<<8 | rune(b[1])
+		}
+		return rune(b[1])<<8 | rune(b[0])
+	}
+	return func(src *bufio.Reader) (rune, error) {
+		b, err := src.Peek(2)
+		if len(b) < 2 {
+			if len(b) == 1 {
+				// A lone byte at the end of the file
+				src.Discard(1)
+				return utf8.RuneError, nil
+			}
+			return 0, err
+		}
+		r := unit(b)
+		src.Discard(2)
+		if !utf16.IsSurrogate(r) {
+			return r, nil
+		}
+		if b, _ := src.Peek(2); len(b) == 2 {
+			if pair := utf16.DecodeRune(r, unit(b)); pair != utf8.RuneError {
+				src.Discard(2)
+				return pair, nil
+			}
+		}
+		return utf8.RuneError, nil
+	}
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252, which differ from ISO-8859-1
+// The five bytes it leaves undefined decode as utf8.RuneError
+var windows1252 = [32]rune{
+	0x20AC, utf8.RuneError, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, utf8.RuneError, 0x017D, utf8.RuneError,
+	utf8.RuneError, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, utf8.RuneError, 0x017E, 0x0178,
+}
+
+func decodeWindows1252(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b >= 0x80 && b <= 0x9F {
+		return windows1252[b-0x80], nil
+	}
+	return rune(b), nil
+}
+
+func decodeISO88591(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	return rune(b), err
+}
+
+// validText reports whether s is valid UTF-8 without replacement characters, which stand for text lost in decoding
+func validText(s string) bool {
+	// ContainsRune finds invalid bytes as well when asked for utf8.RuneError
+	return !strings.ContainsRune(s, utf8.RuneError)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// csvQueryOptions reads the delimiter, crlf and quote_all of a CSV export from the query into opts
+// excel=true stands for the semicolon delimiter and CRLF line endings Excel expects in European
+// locales, a delimiter given with it still wins. Exports always start with a BOM
+func csvQueryOptions(c *fiber.Ctx, opts ExportOptions) ExportOptions {
+	opts.Delimiter = c.Query("delimiter", ",")
+	opts.CRLF = c.Query("crlf") == "true"
+	opts.QuoteAll = c.Query("quote_all") == "true"
+	if c.Query("excel") == "true" {
+		opts.Delimiter = c.Query("delimiter", ";")
+		opts.CRLF = true
+	}
+	return opts
+}
+
+// startCSVExport writes the BOM that makes Excel read the file as UTF-8 and the header of CSV exports,
+// and returns the writer of the rows
+func startCSVExport(w io.Writer, comma rune, opts ExportOptions) (*csvExportWriter, error) {
+	if _, err := w.Write(bomUTF8); err != nil {
+		return nil, err
+	}
+	writer := newCSVExportWriter(w, comma, opts)
+	writer.Write(csvExportHeader)
+	return writer, nil
+}
+
+// csvExportWriter writes the rows of CSV exports like csv.Writer, which only quotes the fields that need
+// it, so with QuoteAll it writes the rows itself and quotes every field
+type csvExportWriter struct {
+	csv   *csv.Writer
+	buf   *bufio.Writer // Used instead of csv with QuoteAll
+	comma rune
+	crlf  bool
+	err   error
+}
+
+// newCSVExportWriter returns a writer of rows to w with the CRLF and QuoteAll of opts
+func newCSVExportWriter(w io.Writer, comma rune, opts ExportOptions) *csvExportWriter {
+	writer := &csvExportWriter{comma: comma, crlf: opts.CRLF}
+	if opts.QuoteAll {
+		writer.buf = bufio.NewWriter(w)
+		return writer
+	}
+	writer.csv = csv.NewWriter(w)
+	writer.csv.Comma = comma
+	writer.csv.UseCRLF = opts.CRLF
+	return writer
+}
+
+// Write writes a row, quoted line breaks follow the line endings like those of csv.Writer
+func (w *csvExportWriter) Write(record []string) error {
+	if w.csv != nil {
+		return w.csv.Write(record)
+	}
+	if w.err != nil {
+		return w.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			w.buf.WriteRune(w.comma)
+		}
+		field = strings.ReplaceAll(field, `"`, `""`)
+		if w.crlf {
+			field = strings.ReplaceAll(strings.ReplaceAll(field, "\r\n", "\n"), "\n", "\r\n")
+		} else {
+			field = strings.ReplaceAll(field, "\r\n", "\n")
+		}
+		w.buf.WriteByte('"')
+		w.buf.WriteString(field)
+		w.buf.WriteByte('"')
+	}
+	if w.crlf {
+		_, w.err = w.buf.WriteString("\r\n")
+	} else {
+		w.err = w.buf.WriteByte('\n')
+	}
+	return w.err
+}
+
+// Flush writes any buffered rows
+func (w *csvExportWriter) Flush() {
+	if w.csv != nil {
+		w.csv.Flush()
+		return
+	}
+	if err := w.buf.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// Error reports any error of a previous Write or Flush
+func (w *csvExportWriter) Error() error {
+	if w.csv != nil {
+		return w.csv.Error()
+	}
+	return w.err
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"log"
+	"shopping-list/db"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// statsCacheTTL is how long dashboard statistics are served from memory
+// Aggregates scan every item, a short TTL keeps dashboard refreshes cheap while staying close to live
+const statsCacheTTL = 30 * time.Second
+
+type statsCacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+var (
+	statsCache   = make(map[string]statsCacheEntry)
+	statsCacheMu sync.Mutex
+)
+
+// cachedStats returns the value cached for the request URL or computes and caches it
+func cachedStats(c *fiber.Ctx, compute func() (any, error)) (any, error) {
+	key := c.Path() + "?" + string(c.Request().URI().QueryString())
+	now := time.Now()
+
+	statsCacheMu.Lock()
+	entry, ok := statsCache[key]
+	statsCacheMu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err := compute()
+	if err != nil {
+		return nil, err
+	}
+
+	statsCacheMu.Lock()
+	for k, e := range statsCache {
+		if now.After(e.expires) {
+			delete(statsCache, k)
+		}
+	}
+	statsCache[key] = statsCacheEntry{value: value, expires: now.Add(statsCacheTTL)}
+	statsCacheMu.Unlock()
+	return value, nil
+}
+
+// parseStatsTime accepts RFC 3339 timestamps and YYYY-MM-DD dates (UTC midnight)
+func parseStatsTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// GetStatsOverview returns totals, completions per weekday and the most active sections
+// since defaults to 30 days ago, top to 5 sections. Archived lists count with include_archived=true
+func GetStatsOverview(c *fiber.Ctx) error {
+	since := time.Now().AddDate(0, 0, -30)
+	if value := c.Query("since"); value != "" {
+		t, ok := parseStatsTime(value)
+		if !ok {
+			return Fail(c, ErrCodeValidation, "Invalid since, use YYYY-MM-DD or RFC 3339")
+		}
+		since = t
+	}
+
+	top, err := strconv.Atoi(c.Query("top", "5"))
+	if err != nil || top <= 0 {
+		top = 5
+	} else if top > 50 {
+		top = 50
+	}
+
+	includeArchived := c.Query("include_archived") == "true"
+	overview, err := cachedStats(c, func() (any, error) { return db.GetStatsOverview(since, top, includeArchived) })
+	if err != nil {
+		log.Printf("[STATS] Overview failed: %v", err)
+		return Fail(c, ErrCodeDB, "Failed to compute statistics")
+	}
+	return c.JSON(overview)
+}
+
+// GetStatsTimeseries returns a metric per day, week or month with every period present
+// The range defaults to the last 30 days, 12 weeks or 12 months and is bounded per interval.
+// Archived lists count with include_archived=true
+func GetStatsTimeseries(c *fiber.Ctx) error {
+	metric := c.Query("metric", db.MetricCompletedItems)
+	if !db.ValidActivityMetric(metric) {
+		return Fail(c, ErrCodeValidation, "Unknown metric, use completed_items, added_items or open_items")
+	}
+	interval := c.Query("interval", "week")
+	maxPoints, ok := db.ValidActivityInterval(interval)
+	if !ok {
+		return Fail(c, ErrCodeValidation, "Unknown interval, use day, week or month")
+	}
+
+	until := time.Now()
+	if value := c.Query("until"); value != "" {
+		t, ok := parseStatsTime(value)
+		if !ok {
+			return Fail(c, ErrCodeValidation, "Invalid until, use YYYY-MM-DD or RFC 3339")
+		}
+		until = t
+	}
+
+	var since time.Time
+	var maxRange time.Duration
+	switch interval {
+	case "day":
+		since = until.AddDate(0, 0, -30)
+		maxRange = time.Duration(maxPoints) * 24 * time.Hour
+	case "week":
+		since = until.AddDate(0, 0, -7*12)
+		maxRange = time.Duration(maxPoints) * 7 * 24 * time.Hour
+	case "month":
+		since = until.AddDate(0, -12, 0)
+		maxRange = time.Duration(maxPoints) * 31 * 24 * time.Hour
+	}
+	if value := c.Query("since"); value != "" {
+		t, ok := parseStatsTime(value)
+		if !ok {
+			return Fail(c, ErrCodeValidation, "Invalid since, use YYYY-MM-DD or RFC 3339")
+		}
+		since = t
+	}
+
+	if !since.Before(until) {
+		return Fail(c, ErrCodeValidation, "since must be before until")
+	}
+	if until.Sub(since) > maxRange {
+		return Fail(c, ErrCodeValidation, "Range too long, at most "+strconv.Itoa(maxPoints)+" periods per request")
+	}
+
+	includeArchived := c.Query("include_archived") == "true"
+	series, err := cachedStats(c, func() (any, error) { return db.GetTimeseries(metric, interval, since, until, includeArchived) })
+	if err != nil {
+		log.Printf("[STATS] Timeseries %s/%s failed: %v", metric, interval, err)
+		return Fail(c, ErrCodeDB, "Failed to compute statistics")
+	}
+	return c.JSON(series)
+}
@@ -1,47 +1,154 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
 	"shopping-list/db"
+	"shopping-list/i18n"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// clearChallengeTTL is how long a clear-database challenge can be used
+const clearChallengeTTL = 5 * time.Minute
+
 // ClearDatabaseRequest represents the request body for clearing the database
 type ClearDatabaseRequest struct {
 	Confirmation string `json:"confirmation" form:"confirmation"`
+	// Lang selects the language of the expected confirmation word
+	Lang string `json:"lang" form:"lang"`
+	// KeepSettings preserves settings and API tokens, defaults to true
+	KeepSettings *bool `json:"keep_settings" form:"keep_settings"`
+}
+
+// ClearedData is broadcast after a clear so clients can invalidate the affected data
+type ClearedData struct {
+	Targets []string         `json:"targets"`
+	Counts  map[string]int64 `json:"counts"`
+}
+
+var (
+	clearChallenges   = make(map[string]time.Time)
+	clearChallengesMu sync.Mutex
+)
+
+// ClearData deletes the selected targets and notifies connected clients
+func ClearData(targets []string) (*ClearedData, error) {
+	end, err := BeginOperation(OperationClear)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := db.ClearData(targets)
+	if err == nil {
+		cleanupFilesAfter(OperationClear)
+	}
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	cleared := &ClearedData{Targets: targets, Counts: counts}
+	BroadcastUpdate("data_cleared", cleared)
+	return cleared, nil
+}
+
+// GetClearChallenge issues a single-use nonce that can be sent as the clear confirmation
+func GetClearChallenge(c *fiber.Ctx) error {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Fail(c, ErrCodeInternal, "Failed to create challenge")
+	}
+	nonce := strings.ToUpper(hex.EncodeToString(b))
+	expiresAt := time.Now().Add(clearChallengeTTL)
+
+	clearChallengesMu.Lock()
+	for n, exp := range clearChallenges {
+		if time.Now().After(exp) {
+			delete(clearChallenges, n)
+		}
+	}
+	clearChallenges[nonce] = expiresAt
+	clearChallengesMu.Unlock()
+
+	return c.JSON(fiber.Map{
+		"challenge":  nonce,
+		"expires_at": expiresAt.Unix(),
+	})
+}
+
+// consumeClearChallenge reports whether nonce is a valid challenge and invalidates it
+func consumeClearChallenge(nonce string) bool {
+	clearChallengesMu.Lock()
+	defer clearChallengesMu.Unlock()
+
+	expiresAt, ok := clearChallenges[nonce]
+	if !ok {
+		return false
+	}
+	delete(clearChallenges, nonce)
+	return time.Now().Before(expiresAt)
+}
+
+// isValidClearConfirmation accepts a challenge nonce or the confirmation word in the given language
+func isValidClearConfirmation(confirmation, lang string) bool {
+	confirmation = strings.TrimSpace(confirmation)
+	if confirmation == "" {
+		return false
+	}
+	if consumeClearChallenge(confirmation) {
+		return true
+	}
+	if lang == "" {
+		lang = i18n.GetDefaultLang()
+	}
+	word := i18n.Get(lang, "danger_zone.confirm_word")
+	return word != "danger_zone.confirm_word" && strings.EqualFold(confirmation, word)
 }
 
 // ClearDatabase handles the database clear operation
-// Requires confirmation word "DELETE" to proceed
+// Requires the localized confirmation word or a nonce from GetClearChallenge
 func ClearDatabase(c *fiber.Ctx) error {
 	var req ClearDatabaseRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid request",
-		})
+		return Fail(c, ErrCodeInvalidJSON, "Invalid request")
 	}
 
 	// Verify confirmation word
-	if req.Confirmation != "DELETE" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "invalid_confirmation",
-		})
+	lang := req.Lang
+	if lang == "" {
+		lang = RequestLang(c)
+	}
+	if !isValidClearConfirmation(req.Confirmation, lang) {
+		return Fail(c, ErrCodeInvalidConfirmation, "Type the confirmation word to clear the database")
+	}
+
+	targets := db.ClearTargets
+	if req.KeepSettings != nil && !*req.KeepSettings {
+		targets = db.AllClearTargets()
 	}
 
 	// Clear all data
-	if err := db.ClearAllData(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to clear database: " + err.Error(),
-		})
+	cleared, err := ClearData(targets)
+	var busy *OperationBusyError
+	if errors.As(err, &busy) {
+		return OperationConflict(c, busy)
+	}
+	if err != nil {
+		log.Printf("[DATABASE] Clear failed: %v", err)
+		return Fail(c, ErrCodeClearFailed, "Failed to clear database")
 	}
 
-	// Broadcast update to all connected clients
-	BroadcastUpdate("database_cleared", nil)
+	// Kept for clients that predate data_cleared
+	BroadcastFrom(c, "database_cleared", nil)
 
 	return c.JSON(fiber.Map{
 		"success": true,
+		"cleared": cleared.Targets,
+		"counts":  cleared.Counts,
 	})
 }
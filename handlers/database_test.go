@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/settings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newClearApp serves the clear endpoints the way main registers them
+func newClearApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/api/database/clear-challenge", GetClearChallenge)
+	app.Post("/api/database/clear", ClearDatabase)
+	return app
+}
+
+// postClear sends body to the clear endpoint with the given Accept-Language and returns the status and body
+func postClear(t *testing.T, app *fiber.App, body map[string]any, acceptLanguage string) (int, string) {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/api/database/clear", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(respBody)
+}
+
+// getClearChallenge requests a new clear challenge
+func getClearChallenge(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/database/clear-challenge", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var challenge struct {
+		Challenge string `json:"challenge"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	if resp.StatusCode != fiber.StatusOK || json.NewDecoder(resp.Body).Decode(&challenge) != nil || challenge.Challenge == "" {
+		t.Fatalf("GET clear-challenge: %d", resp.StatusCode)
+	}
+	if wait := time.Until(time.Unix(challenge.ExpiresAt, 0)); wait <= 0 || wait > clearChallengeTTL {
+		t.Errorf("challenge expires in %v, want within %v", wait, clearChallengeTTL)
+	}
+	return challenge.Challenge
+}
+
+// countRows returns the number of rows in table
+// The operation lock is written by the clear itself, so it is not counted as a setting
+func countRows(t *testing.T, table string) int {
+	t.Helper()
+	query := "SELECT COUNT(*) FROM " + table
+	if table == "settings" {
+		query += " WHERE key != '" + settingOperationLock + "'"
+	}
+	var n int
+	if err := db.DB.QueryRow(query).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestClearDatabaseConfirmationWord(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	app := newClearApp()
+
+	cases := []struct {
+		name           string
+		body           map[string]any
+		acceptLanguage string
+		status         int
+	}{
+		{"missing", map[string]any{}, "", fiber.StatusBadRequest},
+		{"English word", map[string]any{"confirmation": "DELETE"}, "en", fiber.StatusOK},
+		{"any case and spacing", map[string]any{"confirmation": " delete "}, "en", fiber.StatusOK},
+		{"word of the request language", map[string]any{"confirmation": "usuń"}, "pl-PL,pl;q=0.9", fiber.StatusOK},
+		{"English word in Polish", map[string]any{"confirmation": "DELETE"}, "pl", fiber.StatusBadRequest},
+		{"lang in the body wins", map[string]any{"confirmation": "ВИДАЛИТИ", "lang": "uk"}, "en", fiber.StatusOK},
+		{"word of another language", map[string]any{"confirmation": "USUŃ", "lang": "uk"}, "pl", fiber.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		status, body := postClear(t, app, tc.body, tc.acceptLanguage)
+		if status != tc.status {
+			t.Errorf("%s: %d %s, want %d", tc.name, status, body, tc.status)
+		}
+		if status == fiber.StatusBadRequest && errorCodeOf(t, body) != ErrCodeInvalidConfirmation {
+			t.Errorf("%s: %s, want %s", tc.name, body, ErrCodeInvalidConfirmation)
+		}
+	}
+}
+
+func TestClearDatabaseChallenge(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	app := newClearApp()
+
+	nonce := getClearChallenge(t, app)
+	if other := getClearChallenge(t, app); other == nonce {
+		t.Fatalf("two challenges are both %s", nonce)
+	}
+	if status, body := postClear(t, app, map[string]any{"confirmation": "0123456789ABCDEF"}, "en"); status != fiber.StatusBadRequest {
+		t.Errorf("unknown nonce: %d %s, want 400", status, body)
+	}
+	// The nonce works in any language, once
+	if status, body := postClear(t, app, map[string]any{"confirmation": nonce}, "pl"); status != fiber.StatusOK {
+		t.Errorf("nonce: %d %s, want 200", status, body)
+	}
+	if status, body := postClear(t, app, map[string]any{"confirmation": nonce}, "pl"); status != fiber.StatusBadRequest {
+		t.Errorf("reused nonce: %d %s, want 400", status, body)
+	}
+
+	expired := getClearChallenge(t, app)
+	clearChallengesMu.Lock()
+	clearChallenges[expired] = time.Now().Add(-time.Second)
+	clearChallengesMu.Unlock()
+	if status, body := postClear(t, app, map[string]any{"confirmation": expired}, "en-US"); status != fiber.StatusBadRequest {
+		t.Errorf("expired nonce: %d %s, want 400", status, body)
+	}
+}
+
+func TestClearDatabaseKeepSettings(t *testing.T) {
+	initLocales(t)
+	app := newClearApp()
+	seed := func(t *testing.T) {
+		t.Helper()
+		seedExportData(t)
+		if err := settings.Update(map[string]any{settingAutoCleanupDays: 14}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.CreateAPIToken("phone", "secret-phone", "admin", 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clearWith := func(t *testing.T, body map[string]any) []string {
+		t.Helper()
+		body["confirmation"] = "DELETE"
+		status, respBody := postClear(t, app, body, "en")
+		var resp struct {
+			Success bool             `json:"success"`
+			Cleared []string         `json:"cleared"`
+			Counts  map[string]int64 `json:"counts"`
+		}
+		if status != fiber.StatusOK || json.Unmarshal([]byte(respBody), &resp) != nil || !resp.Success {
+			t.Fatalf("clear %v: %d %s", body, status, respBody)
+		}
+		if resp.Counts[db.ClearTargetLists] == 0 {
+			t.Errorf("counts = %v, want the deleted lists counted", resp.Counts)
+		}
+		return resp.Cleared
+	}
+
+	// Settings and API tokens survive by default and when asked to
+	for _, body := range []map[string]any{{}, {"keep_settings": true}} {
+		setupTestDB(t)
+		seed(t)
+		settingsRows := countRows(t, "settings")
+		if settingsRows == 0 {
+			t.Fatal("no settings were stored")
+		}
+		if cleared := clearWith(t, body); !reflect.DeepEqual(cleared, db.ClearTargets) {
+			t.Errorf("keep_settings %v cleared %v, want %v", body["keep_settings"], cleared, db.ClearTargets)
+		}
+		if n := countRows(t, "items") + countRows(t, "templates") + countRows(t, "item_history"); n != 0 {
+			t.Errorf("keep_settings %v left %d rows of data", body["keep_settings"], n)
+		}
+		if countRows(t, "settings") != settingsRows || countRows(t, "api_tokens") != 1 {
+			t.Errorf("keep_settings %v: %d settings and %d tokens left, want %d and 1",
+				body["keep_settings"], countRows(t, "settings"), countRows(t, "api_tokens"), settingsRows)
+		}
+	}
+
+	// Without keep_settings they go with the data
+	setupTestDB(t)
+	seed(t)
+	if cleared := clearWith(t, map[string]any{"keep_settings": false}); !reflect.DeepEqual(cleared, db.AllClearTargets()) {
+		t.Errorf("cleared %v, want %v", cleared, db.AllClearTargets())
+	}
+	if countRows(t, "settings") != 0 || countRows(t, "api_tokens") != 0 || countRows(t, "items") != 0 {
+		t.Errorf("%d settings, %d tokens and %d items left, want none", countRows(t, "settings"), countRows(t, "api_tokens"), countRows(t, "items"))
+	}
+}
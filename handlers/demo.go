@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"shopping-list/db"
+	"shopping-list/i18n"
+)
+
+// Item states used by demo data
+const (
+	demoOpen = iota
+	demoCompleted
+	demoUncertain
+)
+
+type demoItem struct {
+	Name        string
+	Description string
+	Quantity    int
+	State       int
+}
+
+type demoSection struct {
+	Name  string
+	Items []demoItem
+}
+
+type demoList struct {
+	Name     string
+	Icon     string
+	Sections []demoSection
+}
+
+type demoTemplate struct {
+	Name        string
+	Description string
+	Items       [][2]string // section name, item name
+}
+
+// demoContent is the sample data for one language
+type demoContent struct {
+	Lists    []demoList
+	Template demoTemplate
+	// History holds extra names for auto-completion with their usage count
+	History map[string]int
+}
+
+// demoContents holds sample data per language, languages without an entry use English
+// A section named "" takes the localized default section name from the i18n catalog
+var demoContents = map[string]demoContent{
+	"en": {
+		Lists: []demoList{
+			{Name: "Weekly groceries", Icon: "🛒", Sections: []demoSection{
+				{Name: "Fruit & vegetables", Items: []demoItem{
+					{Name: "Bananas", Quantity: 6},
+					{Name: "Tomatoes", Description: "ripe"},
+					{Name: "Apples", Quantity: 4, State: demoCompleted},
+					{Name: "Avocado", State: demoUncertain},
+				}},
+				{Name: "Dairy", Items: []demoItem{
+					{Name: "Milk", Quantity: 2},
+					{Name: "Butter", State: demoCompleted},
+					{Name: "Greek yogurt", Description: "plain"},
+				}},
+				{Name: "Bakery", Items: []demoItem{
+					{Name: "Sourdough bread"},
+					{Name: "Croissants", Quantity: 4, State: demoUncertain},
+				}},
+			}},
+			{Name: "Weekend barbecue", Icon: "🔥", Sections: []demoSection{
+				{Name: "Meat", Items: []demoItem{
+					{Name: "Sausages", Quantity: 10},
+					{Name: "Chicken wings", Description: "about 1 kg"},
+				}},
+				{Name: "", Items: []demoItem{
+					{Name: "Charcoal", State: demoCompleted},
+					{Name: "Paper plates"},
+					{Name: "Ketchup", State: demoUncertain},
+				}},
+			}},
+			{Name: "Drugstore", Icon: "🧴", Sections: []demoSection{
+				{Name: "", Items: []demoItem{
+					{Name: "Toothpaste"},
+					{Name: "Shampoo", State: demoCompleted},
+					{Name: "Sunscreen", Description: "SPF 50"},
+				}},
+			}},
+		},
+		Template: demoTemplate{
+			Name:        "Breakfast basics",
+			Description: "Everything for a quick breakfast",
+			Items: [][2]string{
+				{"Dairy", "Milk"},
+				{"Dairy", "Eggs"},
+				{"Bakery", "Bread"},
+				{"Fruit & vegetables", "Oranges"},
+			},
+		},
+		History: map[string]int{"Coffee": 8, "Eggs": 6, "Olive oil": 3, "Rice": 2},
+	},
+	"pl": {
+		Lists: []demoList{
+			{Name: "Zakupy tygodniowe", Icon: "🛒", Sections: []demoSection{
+				{Name: "Owoce i warzywa", Items: []demoItem{
+					{Name: "Banany", Quantity: 6},
+					{Name: "Pomidory", Description: "dojrzałe"},
+					{Name: "Jabłka", Quantity: 4, State: demoCompleted},
+					{Name: "Awokado", State: demoUncertain},
+				}},
+				{Name: "Nabiał", Items: []demoItem{
+					{Name: "Mleko", Quantity: 2},
+					{Name: "Masło", State: demoCompleted},
+					{Name: "Jogurt grecki", Description: "naturalny"},
+				}},
+				{Name: "Pieczywo", Items: []demoItem{
+					{Name: "Chleb na zakwasie"},
+					{Name: "Rogaliki", Quantity: 4, State: demoUncertain},
+				}},
+			}},
+			{Name: "Grill w weekend", Icon: "🔥", Sections: []demoSection{
+				{Name: "Mięso", Items: []demoItem{
+					{Name: "Kiełbaski", Quantity: 10},
+					{Name: "Skrzydełka", Description: "około 1 kg"},
+				}},
+				{Name: "", Items: []demoItem{
+					{Name: "Węgiel drzewny", State: demoCompleted},
+					{Name: "Papierowe talerze"},
+					{Name: "Keczup", State: demoUncertain},
+				}},
+			}},
+			{Name: "Drogeria", Icon: "🧴", Sections: []demoSection{
+				{Name: "", Items: []demoItem{
+					{Name: "Pasta do zębów"},
+					{Name: "Szampon", State: demoCompleted},
+					{Name: "Krem z filtrem", Description: "SPF 50"},
+				}},
+			}},
+		},
+		Template: demoTemplate{
+			Name:        "Śniadanie",
+			Description: "Wszystko na szybkie śniadanie",
+			Items: [][2]string{
+				{"Nabiał", "Mleko"},
+				{"Nabiał", "Jajka"},
+				{"Pieczywo", "Chleb"},
+				{"Owoce i warzywa", "Pomarańcze"},
+			},
+		},
+		History: map[string]int{"Kawa": 8, "Jajka": 6, "Oliwa": 3, "Ryż": 2},
+	},
+	"de": {
+		Lists: []demoList{
+			{Name: "Wocheneinkauf", Icon: "🛒", Sections: []demoSection{
+				{Name: "Obst & Gemüse", Items: []demoItem{
+					{Name: "Bananen", Quantity: 6},
+					{Name: "Tomaten", Description: "reif"},
+					{Name: "Äpfel", Quantity: 4, State: demoCompleted},
+					{Name: "Avocado", State: demoUncertain},
+				}},
+				{Name: "Milchprodukte", Items: []demoItem{
+					{Name: "Milch", Quantity: 2},
+					{Name: "Butter", State: demoCompleted},
+					{Name: "Griechischer Joghurt", Description: "natur"},
+				}},
+				{Name: "Bäckerei", Items: []demoItem{
+					{Name: "Sauerteigbrot"},
+					{Name: "Croissants", Quantity: 4, State: demoUncertain},
+				}},
+			}},
+			{Name: "Grillen am Wochenende", Icon: "🔥", Sections: []demoSection{
+				{Name: "Fleisch", Items: []demoItem{
+					{Name: "Bratwürste", Quantity: 10},
+					{Name: "Hähnchenflügel", Description: "ca. 1 kg"},
+				}},
+				{Name: "", Items: []demoItem{
+					{Name: "Grillkohle", State: demoCompleted},
+					{Name: "Pappteller"},
+					{Name: "Ketchup", State: demoUncertain},
+				}},
+			}},
+		},
+		Template: demoTemplate{
+			Name:        "Frühstück",
+			Description: "Alles für ein schnelles Frühstück",
+			Items: [][2]string{
+				{"Milchprodukte", "Milch"},
+				{"Milchprodukte", "Eier"},
+				{"Bäckerei", "Brot"},
+				{"Obst & Gemüse", "Orangen"},
+			},
+		},
+		History: map[string]int{"Kaffee": 8, "Eier": 6, "Olivenöl": 3, "Reis": 2},
+	},
+}
+
+// SeedResult reports what SeedDemo created
+type SeedResult struct {
+	Lang      string `json:"lang"`
+	Lists     int    `json:"lists"`
+	Sections  int    `json:"sections"`
+	Items     int    `json:"items"`
+	Templates int    `json:"templates"`
+	History   int    `json:"history"`
+}
+
+// SeedDemo creates localized example lists, a template and history in one transaction
+func SeedDemo(lang string) (*SeedResult, error) {
+	content, ok := demoContents[lang]
+	if !ok {
+		lang = "en"
+		content = demoContents[lang]
+	}
+	defaultSection := i18n.Get(lang, "sections.default")
+
+	tx, err := db.BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &SeedResult{Lang: lang}
+	var listIDs []int64
+	for _, l := range content.Lists {
+		list, err := db.CreateListTx(tx, l.Name, l.Icon)
+		if err != nil {
+			return nil, err
+		}
+		listIDs = append(listIDs, list.ID)
+		result.Lists++
+
+		for sectionOrder, s := range l.Sections {
+			name := s.Name
+			if name == "" {
+				name = defaultSection
+			}
+			section, err := db.CreateSectionForListTx(tx, list.ID, name, sectionOrder)
+			if err != nil {
+				return nil, err
+			}
+			result.Sections++
+
+			for itemOrder, it := range s.Items {
+				item, err := db.CreateItemTx(tx, section.ID, it.Name, it.Description, it.Quantity, itemOrder)
+				if err != nil {
+					return nil, err
+				}
+				switch it.State {
+				case demoCompleted:
+					_, err = tx.Exec("UPDATE items SET completed = TRUE, completed_at = strftime('%s', 'now') WHERE id = ?", item.ID)
+				case demoUncertain:
+					_, err = tx.Exec("UPDATE items SET uncertain = TRUE WHERE id = ?", item.ID)
+				}
+				if err != nil {
+					return nil, err
+				}
+				if err := db.SaveItemHistoryWithCountTx(tx, it.Name, section.ID, 1); err != nil {
+					return nil, err
+				}
+				result.Items++
+			}
+		}
+	}
+
+	templateID, err := db.CreateTemplateTx(tx, content.Template.Name, content.Template.Description)
+	if err != nil {
+		return nil, err
+	}
+	for _, ti := range content.Template.Items {
+		if _, err := db.AddTemplateItemTx(tx, templateID, ti[0], ti[1], ""); err != nil {
+			return nil, err
+		}
+	}
+	result.Templates++
+
+	for name, count := range content.History {
+		if err := db.SaveItemHistoryWithCountTx(tx, name, 0, count); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.QueryRow("SELECT COUNT(*) FROM item_history").Scan(&result.History); err != nil {
+		return nil, err
+	}
+
+	// Make the first example the active list unless the user already has one
+	if _, err := tx.Exec(`
+		UPDATE lists SET is_active = TRUE
+		WHERE id = ? AND NOT EXISTS (SELECT 1 FROM lists WHERE is_active = TRUE)
+	`, listIDs[0]); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range listIDs {
+		if list, err := db.GetListByID(id); err == nil {
+			BroadcastUpdate("list_created", list)
+		}
+	}
+	return result, nil
+}
+
+// IsDatabaseEmpty reports whether there are no items and no templates yet
+// An empty default list created on first start does not count as data
+func IsDatabaseEmpty() (bool, error) {
+	var count int
+	err := db.DB.QueryRow("SELECT (SELECT COUNT(*) FROM items) + (SELECT COUNT(*) FROM templates)").Scan(&count)
+	return count == 0, err
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/i18n"
+)
+
+func TestSeedDemoExportsLocalizedStructure(t *testing.T) {
+	initLocales(t)
+
+	// Ukrainian has no demo content and falls back to English
+	for _, tc := range []struct{ lang, content string }{{"en", "en"}, {"pl", "pl"}, {"de", "de"}, {"uk", "en"}} {
+		t.Run(tc.lang, func(t *testing.T) {
+			setupTestDB(t)
+			if empty, err := IsDatabaseEmpty(); err != nil || !empty {
+				t.Fatalf("fresh database empty = %v, %v", empty, err)
+			}
+			conn := dialWebSocket(t)
+
+			result, err := SeedDemo(tc.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := demoContents[tc.content]
+			wantResult := SeedResult{Lang: tc.content, Lists: len(content.Lists), Templates: 1, History: result.History}
+			for _, l := range content.Lists {
+				wantResult.Sections += len(l.Sections)
+				for _, s := range l.Sections {
+					wantResult.Items += len(s.Items)
+				}
+			}
+			if *result != wantResult {
+				t.Errorf("result = %+v, want %+v", *result, wantResult)
+			}
+			if empty, _ := IsDatabaseEmpty(); empty {
+				t.Error("database still empty after seeding")
+			}
+
+			// One list_created event per list, in order
+			for _, l := range content.Lists {
+				msg, ok := readBroadcast(t, conn, 2*time.Second)
+				var list db.List
+				if ok {
+					json.Unmarshal(msg.Data, &list)
+				}
+				if !ok || msg.Type != "list_created" || list.Name != l.Name {
+					t.Errorf("broadcast = %+v (%v), want list_created for %s", msg, ok, l.Name)
+				}
+			}
+
+			lists, err := db.GetAllLists()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := exportAllAsJSON(&buf, lists, ExportOptions{IncludeTemplates: true, IncludeHistory: true}); err != nil {
+				t.Fatal(err)
+			}
+			var export ExportData
+			if err := json.Unmarshal(buf.Bytes(), &export); err != nil {
+				t.Fatalf("decode export: %v", err)
+			}
+			if appErr := validateExport(&export, tc.lang); appErr != nil {
+				t.Fatalf("export of the demo data is invalid: %v", appErr)
+			}
+			assertDemoExport(t, export.Data, content, i18n.Get(tc.content, "sections.default"))
+			if result.History != len(export.Data.History) {
+				t.Errorf("result counts %d history entries, the export has %d", result.History, len(export.Data.History))
+			}
+		})
+	}
+}
+
+// assertDemoExport compares an export of freshly seeded demo data with its content
+func assertDemoExport(t *testing.T, data ExportBody, content demoContent, defaultSection string) {
+	t.Helper()
+	if len(data.Lists) != len(content.Lists) {
+		t.Fatalf("%d lists exported, want %d", len(data.Lists), len(content.Lists))
+	}
+	states := map[int]int{}
+	for i, want := range content.Lists {
+		got := data.Lists[i]
+		if got.Name != want.Name || got.Icon != want.Icon || got.IsActive != (i == 0) || len(got.Sections) != len(want.Sections) {
+			t.Errorf("list %d = %s %s active %v with %d sections, want %s %s with %d", i, got.Icon, got.Name, got.IsActive, len(got.Sections), want.Icon, want.Name, len(want.Sections))
+			continue
+		}
+		for j, ws := range want.Sections {
+			gs := got.Sections[j]
+			name := ws.Name
+			if name == "" {
+				name = defaultSection
+			}
+			if gs.Name != name || len(gs.Items) != len(ws.Items) {
+				t.Errorf("section %s/%d = %s with %d items, want %s with %d", want.Name, j, gs.Name, len(gs.Items), name, len(ws.Items))
+				continue
+			}
+			// The export puts completed items last, so items are matched by name
+			items := map[string]ExportItem{}
+			for _, gi := range gs.Items {
+				items[gi.Name] = gi
+			}
+			for _, wi := range ws.Items {
+				gi, ok := items[wi.Name]
+				if !ok || gi.Description != wi.Description || gi.Quantity != wi.Quantity ||
+					gi.Completed != (wi.State == demoCompleted) || gi.Uncertain != (wi.State == demoUncertain) ||
+					(gi.CompletedAt != "") != gi.Completed {
+					t.Errorf("item %s = %+v, want %+v", wi.Name, gi, wi)
+				}
+				states[wi.State]++
+			}
+		}
+	}
+	if states[demoOpen] == 0 || states[demoCompleted] == 0 || states[demoUncertain] == 0 {
+		t.Errorf("item states = %v, want open, completed and uncertain items", states)
+	}
+
+	if len(data.Templates) != 1 || data.Templates[0].Name != content.Template.Name || len(data.Templates[0].Items) != len(content.Template.Items) {
+		t.Fatalf("templates = %+v, want %s", data.Templates, content.Template.Name)
+	}
+	// Template items are exported grouped by section
+	templateItems := map[[2]string]bool{}
+	for _, ti := range data.Templates[0].Items {
+		templateItems[[2]string{ti.SectionName, ti.Name}] = true
+	}
+	for _, want := range content.Template.Items {
+		if !templateItems[want] {
+			t.Errorf("template items = %+v, want %s in %s", data.Templates[0].Items, want[1], want[0])
+		}
+	}
+
+	// Every item name is in the history, next to the extra names with their usage
+	history := map[string]ExportHistory{}
+	for _, h := range data.History {
+		history[h.Name] = h
+	}
+	for _, l := range content.Lists {
+		for _, s := range l.Sections {
+			for _, it := range s.Items {
+				if _, ok := history[it.Name]; !ok {
+					t.Errorf("item %s is not in the history", it.Name)
+				}
+			}
+		}
+	}
+	for name, count := range content.History {
+		if h, ok := history[name]; !ok || h.UsageCount < count {
+			t.Errorf("history %s = %+v, want a usage of at least %d", name, h, count)
+		}
+	}
+	first := content.Lists[0].Sections[0]
+	if h := history[first.Items[0].Name]; h.LastSection != first.Name {
+		t.Errorf("history %s = %+v, want last section %s", first.Items[0].Name, h, first.Name)
+	}
+}
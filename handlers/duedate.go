@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errInvalidDueDate = errors.New("due_date must be a date like 2024-05-31")
+
+// ParseDueDate checks a due date in the form YYYY-MM-DD, empty stays empty
+func ParseDueDate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return "", errInvalidDueDate
+	}
+	return t.Format(time.DateOnly), nil
+}
+
+// DueDatePast reports whether a due date lies before today in the server's time zone
+func DueDatePast(date string) bool {
+	return date != "" && date < time.Now().Format(time.DateOnly)
+}
+
+// formDueDate applies the due_date form value to that of an item like formPrice, an empty one clears it
+func formDueDate(c *fiber.Ctx, dueDate string) (string, bool, error) {
+	if !formHas(c, "due_date") {
+		return dueDate, false, nil
+	}
+	date, err := ParseDueDate(c.FormValue("due_date"))
+	if err != nil {
+		return "", false, err
+	}
+	return date, true, nil
+}
+
+// importDueDate reads the due date of an imported item, dates that cannot be read are left out with
+// an invalid_value warning. Exports write YYYY-MM-DD, spreadsheets may add a time that is dropped
+func importDueDate(value string, warnings *importWarnings, row int, path, field string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > len(time.DateOnly) && (value[len(time.DateOnly)] == 'T' || value[len(time.DateOnly)] == ' ') {
+		value = value[:len(time.DateOnly)]
+	}
+	date, err := ParseDueDate(value)
+	if err != nil {
+		warnings.add(ImportWarning{Row: row, Path: path, Field: field, Value: warningValue(value), Reason: ImportWarningInvalidValue, Action: "modified"})
+		return ""
+	}
+	return date
+}
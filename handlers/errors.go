@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Machine-readable error codes, shared by the UI handlers and the REST API
+// Codes are the stable contract for clients, messages are for humans and may change or be translated.
+// Every code has one HTTP status, see codeStatus
+const (
+	// Authentication and permissions
+	ErrCodeAPIDisabled       = "api_disabled"
+	ErrCodeMissingToken      = "missing_token"
+	ErrCodeInvalidFormat     = "invalid_format"
+	ErrCodeInvalidToken      = "invalid_token"
+	ErrCodeTokenExpired      = "token_expired"
+	ErrCodeUnauthorized      = "unauthorized"
+	ErrCodeInsufficientScope = "insufficient_scope"
+	ErrCodeListForbidden     = "list_forbidden"
+	ErrCodeIPBlocked         = "ip_blocked"
+	ErrCodeCSRFInvalid       = "csrf_invalid"
+	ErrCodeRateLimited       = "rate_limited"
+	ErrCodeInvalidSignature  = "invalid_signature"
+	ErrCodeLinkExpired       = "link_expired"
+
+	// Client errors
+	ErrCodeInvalidRequest        = "invalid_request"
+	ErrCodeInvalidJSON           = "invalid_json"
+	ErrCodeInvalidID             = "invalid_id"
+	ErrCodeValidation            = "validation_error"
+	ErrCodeInvalidFile           = "invalid_file"
+	ErrCodeNotFound              = "not_found"
+	ErrCodeMethodNotAllowed      = "method_not_allowed"
+	ErrCodePayloadTooLarge       = "payload_too_large"
+	ErrCodeListNameExists        = "list_name_exists"
+	ErrCodeInvalidConfirmation   = "invalid_confirmation"
+	ErrCodeInvalidBackup         = "invalid_backup"
+	ErrCodeShareRevoked          = "share_revoked"
+	ErrCodeShareExpired          = "share_expired"
+	ErrCodeInvalidIdempotencyKey = "invalid_idempotency_key"
+	ErrCodeIdempotencyMismatch   = "idempotency_key_mismatch"
+	ErrCodeImportRejected        = "import_rejected"
+	ErrCodeUnsupportedVersion    = "unsupported_version"
+
+	// Conflicts with the current state
+	ErrCodeNotEmpty              = "not_empty"
+	ErrCodeNotStale              = "not_stale"
+	ErrCodeNotConfigured         = "not_configured"
+	ErrCodeMaintenanceRequired   = "maintenance_required"
+	ErrCodeOperationInProgress   = "operation_in_progress"
+	ErrCodeIdempotencyInProgress = "idempotency_in_progress"
+	ErrCodeImportModified        = "import_modified"
+	ErrCodeAlreadyRolledBack     = "already_rolled_back"
+	ErrCodeDuplicateBarcode      = "duplicate_barcode"
+
+	// Server errors
+	ErrCodeInternal       = "internal_error"
+	ErrCodeDB             = "db_error"
+	ErrCodeCreateFailed   = "create_failed"
+	ErrCodeUpdateFailed   = "update_failed"
+	ErrCodeDeleteFailed   = "delete_failed"
+	ErrCodeMoveFailed     = "move_failed"
+	ErrCodeToggleFailed   = "toggle_failed"
+	ErrCodeCommitFailed   = "commit_failed"
+	ErrCodeBackupFailed   = "backup_failed"
+	ErrCodeRestoreFailed  = "restore_failed"
+	ErrCodeClearFailed    = "clear_failed"
+	ErrCodeCleanupFailed  = "cleanup_failed"
+	ErrCodeRepairFailed   = "repair_failed"
+	ErrCodeOptimizeFailed = "optimize_failed"
+	ErrCodeRotateFailed   = "rotate_failed"
+	ErrCodeSeedFailed     = "seed_failed"
+	ErrCodeReloadFailed   = "reload_failed"
+	ErrCodeUpstream       = "upstream_error"
+	ErrCodeMaintenance    = "maintenance"
+)
+
+// codeStatus is the HTTP status of every error code
+var codeStatus = map[string]int{
+	ErrCodeAPIDisabled:       fiber.StatusServiceUnavailable,
+	ErrCodeMissingToken:      fiber.StatusUnauthorized,
+	ErrCodeInvalidFormat:     fiber.StatusUnauthorized,
+	ErrCodeInvalidToken:      fiber.StatusUnauthorized,
+	ErrCodeTokenExpired:      fiber.StatusUnauthorized,
+	ErrCodeUnauthorized:      fiber.StatusUnauthorized,
+	ErrCodeInsufficientScope: fiber.StatusForbidden,
+	ErrCodeListForbidden:     fiber.StatusForbidden,
+	ErrCodeIPBlocked:         fiber.StatusForbidden,
+	ErrCodeCSRFInvalid:       fiber.StatusForbidden,
+	ErrCodeRateLimited:       fiber.StatusTooManyRequests,
+	ErrCodeInvalidSignature:  fiber.StatusForbidden,
+	ErrCodeLinkExpired:       fiber.StatusForbidden,
+
+	ErrCodeInvalidRequest:        fiber.StatusBadRequest,
+	ErrCodeInvalidJSON:           fiber.StatusBadRequest,
+	ErrCodeInvalidID:             fiber.StatusBadRequest,
+	ErrCodeValidation:            fiber.StatusBadRequest,
+	ErrCodeInvalidFile:           fiber.StatusBadRequest,
+	ErrCodeNotFound:              fiber.StatusNotFound,
+	ErrCodeMethodNotAllowed:      fiber.StatusMethodNotAllowed,
+	ErrCodePayloadTooLarge:       fiber.StatusRequestEntityTooLarge,
+	ErrCodeListNameExists:        fiber.StatusBadRequest,
+	ErrCodeInvalidConfirmation:   fiber.StatusBadRequest,
+	ErrCodeInvalidBackup:         fiber.StatusBadRequest,
+	ErrCodeShareRevoked:          fiber.StatusGone,
+	ErrCodeShareExpired:          fiber.StatusGone,
+	ErrCodeInvalidIdempotencyKey: fiber.StatusBadRequest,
+	ErrCodeIdempotencyMismatch:   fiber.StatusUnprocessableEntity,
+	ErrCodeImportRejected:        fiber.StatusUnprocessableEntity,
+	ErrCodeUnsupportedVersion:    fiber.StatusUnprocessableEntity,
+
+	ErrCodeNotEmpty:              fiber.StatusConflict,
+	ErrCodeNotStale:              fiber.StatusConflict,
+	ErrCodeNotConfigured:         fiber.StatusConflict,
+	ErrCodeMaintenanceRequired:   fiber.StatusConflict,
+	ErrCodeOperationInProgress:   fiber.StatusConflict,
+	ErrCodeIdempotencyInProgress: fiber.StatusConflict,
+	ErrCodeImportModified:        fiber.StatusConflict,
+	ErrCodeAlreadyRolledBack:     fiber.StatusConflict,
+	ErrCodeDuplicateBarcode:      fiber.StatusConflict,
+
+	ErrCodeInternal:       fiber.StatusInternalServerError,
+	ErrCodeDB:             fiber.StatusInternalServerError,
+	ErrCodeCreateFailed:   fiber.StatusInternalServerError,
+	ErrCodeUpdateFailed:   fiber.StatusInternalServerError,
+	ErrCodeDeleteFailed:   fiber.StatusInternalServerError,
+	ErrCodeMoveFailed:     fiber.StatusInternalServerError,
+	ErrCodeToggleFailed:   fiber.StatusInternalServerError,
+	ErrCodeCommitFailed:   fiber.StatusInternalServerError,
+	ErrCodeBackupFailed:   fiber.StatusInternalServerError,
+	ErrCodeRestoreFailed:  fiber.StatusInternalServerError,
+	ErrCodeClearFailed:    fiber.StatusInternalServerError,
+	ErrCodeCleanupFailed:  fiber.StatusInternalServerError,
+	ErrCodeRepairFailed:   fiber.StatusInternalServerError,
+	ErrCodeOptimizeFailed: fiber.StatusInternalServerError,
+	ErrCodeRotateFailed:   fiber.StatusInternalServerError,
+	ErrCodeSeedFailed:     fiber.StatusInternalServerError,
+	ErrCodeReloadFailed:   fiber.StatusInternalServerError,
+	ErrCodeUpstream:       fiber.StatusBadGateway,
+	ErrCodeMaintenance:    fiber.StatusServiceUnavailable,
+}
+
+// StatusForCode returns the HTTP status of an error code, 500 for unknown codes
+func StatusForCode(code string) int {
+	if status, ok := codeStatus[code]; ok {
+		return status
+	}
+	return fiber.StatusInternalServerError
+}
+
+// ErrorCodes returns every error code, sorted
+func ErrorCodes() []string {
+	codes := make([]string, 0, len(codeStatus))
+	for code := range codeStatus {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// ErrorResponse is the JSON body of every error response
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// NewErrorResponse builds the error body for the current request
+func NewErrorResponse(c *fiber.Ctx, code, message string) ErrorResponse {
+	return ErrorResponse{Error: code, Message: message, RequestID: RequestID(c)}
+}
+
+// RequestID returns the ID assigned by RequestIDMiddleware, also sent in X-Request-ID
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(localsRequestID).(string)
+	return id
+}
+
+// Fail sends an error response with the status mapped from code
+func Fail(c *fiber.Ctx, code, message string) error {
+	return c.Status(StatusForCode(code)).JSON(NewErrorResponse(c, code, message))
+}
+
+// AppError is an error with a machine-readable code
+// Handlers may return it instead of writing the response, ErrorHandler renders it
+type AppError struct {
+	Code    string
+	Message string
+}
+
+func (e *AppError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewError returns an AppError for code
+func NewError(code, message string) *AppError {
+	return &AppError{Code: code, Message: message}
+}
+
+// ErrorHandler is the fiber error handler, it renders every error a handler returns,
+// and panics recovered by the recover middleware, as an ErrorResponse
+// Unexpected errors are logged with the request ID and their details are not sent to the client
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return Fail(c, appErr.Code, appErr.Message)
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) && fiberErr.Code < fiber.StatusInternalServerError {
+		return c.Status(fiberErr.Code).JSON(NewErrorResponse(c, codeForStatus(fiberErr.Code), fiberErr.Message))
+	}
+
+	slog.Error("unhandled error", "request_id", RequestID(c), "method", c.Method(), "path", c.Path(), "error", err.Error())
+	return Fail(c, ErrCodeInternal, http.StatusText(http.StatusInternalServerError))
+}
+
+// codeForStatus picks the code for fiber's own errors, such as unknown routes or oversized bodies
+func codeForStatus(status int) string {
+	switch status {
+	case fiber.StatusNotFound:
+		return ErrCodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case fiber.StatusRequestEntityTooLarge:
+		return ErrCodePayloadTooLarge
+	case fiber.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case fiber.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	}
+	return ErrCodeInvalidRequest
+}
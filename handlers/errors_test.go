@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorHandlerRendersEnvelope(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(RequestIDMiddleware)
+	app.Get("/app-error", func(c *fiber.Ctx) error { return NewError(ErrCodeListForbidden, "No access to this list") })
+	app.Get("/fail", func(c *fiber.Ctx) error { return Fail(c, ErrCodeNotFound, "Item not found") })
+
+	cases := []struct {
+		name, method, path string
+		status             int
+		code, message      string
+	}{
+		{"returned AppError", "GET", "/app-error", fiber.StatusForbidden, ErrCodeListForbidden, "No access to this list"},
+		{"Fail", "GET", "/fail", fiber.StatusNotFound, ErrCodeNotFound, "Item not found"},
+		{"unknown route", "GET", "/missing", fiber.StatusNotFound, ErrCodeNotFound, "Cannot GET /missing"},
+		{"wrong method", "DELETE", "/fail", fiber.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method Not Allowed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set(HeaderRequestID, "client-id-1")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			var body ErrorResponse
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("decode %q: %v", data, err)
+			}
+			want := ErrorResponse{Error: tc.code, Message: tc.message, RequestID: "client-id-1"}
+			if resp.StatusCode != tc.status || body != want {
+				t.Errorf("got %d %+v, want %d %+v", resp.StatusCode, body, tc.status, want)
+			}
+		})
+	}
+}
+
+func TestStatusForCode(t *testing.T) {
+	for _, code := range ErrorCodes() {
+		if status := StatusForCode(code); status < 400 || status > 599 {
+			t.Errorf("%s maps to %d, not an error status", code, status)
+		}
+	}
+	if status := StatusForCode("no_such_code"); status != fiber.StatusInternalServerError {
+		t.Errorf("unknown code maps to %d, want 500", status)
+	}
+	if status := StatusForCode(ErrCodeValidation); status != fiber.StatusBadRequest {
+		t.Errorf("%s maps to %d, want 400", ErrCodeValidation, status)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NotModified sets a weak ETag derived from a db version and the request variants (language, format)
+// and reports whether If-None-Match already names it, in which case the caller should answer with NotModifiedResponse
+func NotModified(c *fiber.Ctx, version string, variants ...string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(version))
+	for _, v := range variants {
+		h.Write([]byte{0})
+		h.Write([]byte(v))
+	}
+	etag := fmt.Sprintf(`W/"%x"`, h.Sum64())
+	c.Set(fiber.HeaderETag, etag)
+
+	return etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag)
+}
+
+// NotModifiedResponse sends a 304 without a body
+func NotModifiedResponse(c *fiber.Ctx) error {
+	c.Status(fiber.StatusNotModified)
+	c.Response().ResetBody()
+	return nil
+}
+
+// etagMatches applies the weak comparison of If-None-Match, which may list several tags or be *
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,19 +1,32 @@
 package handlers
 
 import (
-	"encoding/csv"
+	"archive/zip"
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"shopping-list/db"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// ExportVersion is the version of the export format
+// 1.1 added sort orders and the created and completed times of items, imports accept files without them.
+// 1.2 added app_version, 1.3 the price and currency of items, 1.4 their due date and 1.5 their photo
+// in ZIP exports. 2.0 requires the sort order of every section and item, 1.x files are upgraded to it.
+// See exportSchemas for how imports read older and newer versions
+const ExportVersion = "2.0"
+
 // ExportData represents the full export structure
 type ExportData struct {
 	Version    string     `json:"version"`
+	AppVersion string     `json:"app_version,omitempty"` // Version of the Koffan that wrote the file
 	ExportedAt string     `json:"exported_at"`
 	App        string     `json:"app"`
 	Data       ExportBody `json:"data"`
@@ -36,17 +49,27 @@ type ExportList struct {
 
 // ExportSection represents a section with items
 type ExportSection struct {
-	Name  string       `json:"name"`
-	Items []ExportItem `json:"items"`
+	Name      string       `json:"name"`
+	SortOrder *int         `json:"sort_order,omitempty"` // Always set from 2.0, 1.x files without it keep the file order
+	Items     []ExportItem `json:"items"`
 }
 
 // ExportItem represents a shopping item
 type ExportItem struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
-	Uncertain   bool   `json:"uncertain"`
-	Quantity    int    `json:"quantity"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Completed   bool        `json:"completed"`
+	Uncertain   bool        `json:"uncertain"`
+	Quantity    int         `json:"quantity"`
+	SortOrder   *int        `json:"sort_order,omitempty"`   // Always set from 2.0, 1.x files without it keep the file order
+	CreatedAt   string      `json:"created_at,omitempty"`   // RFC3339, imports without it use the time of the import
+	CompletedAt string      `json:"completed_at,omitempty"` // RFC3339, only for completed items
+	Price       ExportPrice `json:"price,omitempty"`        // Decimal amount of one unit, only for items with a price
+	Currency    string      `json:"currency,omitempty"`
+	DueDate     string      `json:"due_date,omitempty"` // YYYY-MM-DD
+	Photo       string      `json:"photo,omitempty"`    // Path of the photo in a ZIP export with IncludePhotos, imports ignore it
+
+	photo string // Path of the photo relative to db.FilesDir
 }
 
 // ExportTemplate represents a template
@@ -70,53 +93,277 @@ type ExportHistory struct {
 	UsageCount  int    `json:"usage_count"`
 }
 
-// ExportAllData exports all data as JSON or CSV
+// ExportOptions selects the format and content of a full export
+type ExportOptions struct {
+	Format           string // "json" (default), "yaml", "csv", "xlsx", "markdown", "html" or "zip"
+	Delimiter        string // CSV field separator, see parseDelimiter
+	CRLF             bool   // End CSV lines with \r\n
+	QuoteAll         bool   // Quote every CSV field, not only those that need it
+	IncludeTemplates bool   // JSON, YAML and CSV, as [TEMPLATE] rows
+	IncludeHistory   bool
+	// ExcludeCompleted leaves out completed items and the sections left empty, unless IncludeEmptySections
+	ExcludeCompleted     bool
+	IncludeEmptySections bool
+	Columns              int  // Item columns of HTML exports, 1 or 2
+	IncludePhotos        bool // ZIP, bundles the photos of items
+}
+
+// exportFilterOptions reads exclude_completed and include_empty_sections from the query into opts
+func exportFilterOptions(c *fiber.Ctx, opts ExportOptions) ExportOptions {
+	opts.ExcludeCompleted = c.Query("exclude_completed") == "true"
+	opts.IncludeEmptySections = c.Query("include_empty_sections") == "true"
+	return opts
+}
+
+// filterSections applies ExcludeCompleted to the sections of a list, the sections are modified in place
+func (o ExportOptions) filterSections(sections []db.Section) []db.Section {
+	if !o.ExcludeCompleted {
+		return sections
+	}
+	filtered := sections[:0]
+	for _, section := range sections {
+		items := section.Items[:0]
+		for _, item := range section.Items {
+			if !item.Completed {
+				items = append(items, item)
+			}
+		}
+		section.Items = items
+		if len(items) > 0 || o.IncludeEmptySections {
+			filtered = append(filtered, section)
+		}
+	}
+	return filtered
+}
+
+// exportSections returns the sections of a list with their items, filtered by opts
+func exportSections(listID int64, opts ExportOptions) ([]db.Section, error) {
+	sections, err := db.GetSectionsByList(listID)
+	if err != nil {
+		return nil, err
+	}
+	return opts.filterSections(sections), nil
+}
+
+// ExportAllData exports all data as JSON, YAML, CSV, XLSX, Markdown, printable HTML or a ZIP of JSON and CSV
 func ExportAllData(c *fiber.Ctx) error {
-	format := c.Query("format", "json")
-	includeTemplates := c.Query("include_templates", "true") == "true"
-	includeHistory := c.Query("include_history", "true") == "true"
+	opts := csvQueryOptions(c, exportFilterOptions(c, ExportOptions{
+		Format:           c.Query("format", "json"),
+		IncludeTemplates: c.Query("include_templates", "true") == "true",
+		IncludeHistory:   c.Query("include_history", "true") == "true",
+		IncludePhotos:    c.Query("include_photos") == "true",
+	}))
+	if opts.Format == "csv" || opts.Format == "zip" {
+		if _, appErr := parseDelimiter(opts.Delimiter); appErr != nil {
+			return Fail(c, appErr.Code, appErr.Message)
+		}
+	}
+	if opts.Format == "html" {
+		var appErr *AppError
+		if opts.Columns, appErr = parseExportColumns(c.Query("columns")); appErr != nil {
+			return Fail(c, appErr.Code, appErr.Message)
+		}
+	}
+
+	switch opts.Format {
+	case "csv":
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-export-%s.csv\"", time.Now().Format("2006-01-02")))
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+	case "xlsx":
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-export-%s.xlsx\"", time.Now().Format("2006-01-02")))
+		c.Set("Content-Type", xlsxContentType)
+	case "markdown":
+		if c.Query("inline") != "true" {
+			c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-export-%s.md\"", time.Now().Format("2006-01-02")))
+		}
+		c.Set("Content-Type", markdownContentType)
+	case "html":
+		if c.Query("inline") != "true" {
+			c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-export-%s.html\"", time.Now().Format("2006-01-02")))
+		}
+		c.Set("Content-Type", fiber.MIMETextHTMLCharsetUTF8)
+	case "yaml":
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-export-%s.yaml\"", time.Now().Format("2006-01-02")))
+		c.Set("Content-Type", yamlContentType)
+	case "zip":
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-export-%s.zip\"", time.Now().Format("2006-01-02")))
+		c.Set("Content-Type", "application/zip")
+	default:
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-export-%s.json\"", time.Now().Format("2006-01-02")))
+		c.Set("Content-Type", "application/json")
+	}
+
+	if err := Export(c.Response().BodyWriter(), opts); err != nil {
+		c.Response().ResetBody()
+		c.Set("Content-Disposition", "")
+		return Fail(c, ErrCodeDB, "Failed to fetch lists")
+	}
+	return nil
+}
 
+// Export writes all lists, and optionally templates and history, to w
+// It is shared by the export endpoint and the export command
+func Export(w io.Writer, opts ExportOptions) error {
 	lists, err := db.GetAllLists()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch lists"})
+		return err
 	}
 
-	if format == "csv" {
-		return exportAllAsCSV(c, lists)
+	switch opts.Format {
+	case "csv":
+		comma, appErr := parseDelimiter(opts.Delimiter)
+		if appErr != nil {
+			return appErr
+		}
+		return exportAllAsCSV(w, lists, opts, comma)
+	case "xlsx":
+		return exportAllAsXLSX(w, lists, opts)
+	case "markdown":
+		return exportAllAsMarkdown(w, lists, opts)
+	case "html":
+		return exportAllAsHTML(w, lists, opts)
+	case "yaml":
+		return encodeYAML(w, buildExport(lists, opts))
+	case "zip":
+		comma, appErr := parseDelimiter(opts.Delimiter)
+		if appErr != nil {
+			return appErr
+		}
+		return exportAllAsZIP(w, lists, opts, comma)
 	}
-
-	return exportAllAsJSON(c, lists, includeTemplates, includeHistory)
+	return exportAllAsJSON(w, lists, opts)
 }
 
 // ExportSingleList exports a single list
 func ExportSingleList(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid list ID"})
+		return Fail(c, ErrCodeInvalidID, "Invalid list ID")
 	}
+	return exportSingleList(c, id)
+}
 
+// exportSingleList exports a list with the options of the query, shared with signed download links
+func exportSingleList(c *fiber.Ctx, id int64) error {
 	format := c.Query("format", "json")
+	opts := csvQueryOptions(c, exportFilterOptions(c, ExportOptions{}))
+	comma := ','
+	if format == "csv" {
+		var appErr *AppError
+		if comma, appErr = parseDelimiter(opts.Delimiter); appErr != nil {
+			return Fail(c, appErr.Code, appErr.Message)
+		}
+	}
+	columns := 1
+	if format == "html" {
+		var appErr *AppError
+		if columns, appErr = parseExportColumns(c.Query("columns")); appErr != nil {
+			return Fail(c, appErr.Code, appErr.Message)
+		}
+	}
+
+	opts.IncludeHistory = c.Query("include_history") == "true"
+
+	version, err := db.ListVersion(id)
+	if err != nil {
+		return Fail(c, ErrCodeNotFound, "List not found")
+	}
+	if opts.IncludeHistory {
+		historyVersion, err := db.HistoryVersion()
+		if err != nil {
+			return Fail(c, ErrCodeDB, "Failed to fetch history")
+		}
+		version += "-" + historyVersion
+	}
+	if NotModified(c, version, format, string(comma), strconv.FormatBool(opts.CRLF), strconv.FormatBool(opts.QuoteAll), strconv.Itoa(columns),
+		strconv.FormatBool(opts.ExcludeCompleted), strconv.FormatBool(opts.IncludeEmptySections), strconv.FormatBool(opts.IncludeHistory)) {
+		return NotModifiedResponse(c)
+	}
 
 	list, err := db.GetListByID(id)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "List not found"})
+		return Fail(c, ErrCodeNotFound, "List not found")
+	}
+
+	sections, err := exportSections(id, opts)
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to fetch sections")
+	}
+
+	switch format {
+	case "csv":
+		return exportListAsCSV(c, list, sections, comma, opts)
+	case "xlsx":
+		return exportListAsXLSX(c, list, sections)
+	case "markdown":
+		return exportListAsMarkdown(c, list, sections)
+	case "html":
+		return exportListAsHTML(c, list, sections, columns)
+	}
+
+	return exportListAsJSON(c, list, sections, opts)
+}
+
+// ExportSingleTemplate exports a single template as JSON, an export with only the template, or as CSV [TEMPLATE] rows
+// Both import back as the template alone
+func ExportSingleTemplate(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return Fail(c, ErrCodeInvalidID, "Invalid template ID")
+	}
+
+	format := c.Query("format", "json")
+	opts := csvQueryOptions(c, ExportOptions{})
+	comma := ','
+	switch format {
+	case "csv":
+		var appErr *AppError
+		if comma, appErr = parseDelimiter(opts.Delimiter); appErr != nil {
+			return Fail(c, appErr.Code, appErr.Message)
+		}
+	case "json":
+	default:
+		return Fail(c, ErrCodeValidation, "Format must be json or csv")
 	}
 
-	sections, err := db.GetSectionsByList(id)
+	tmpl, err := db.GetTemplateByID(id)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch sections"})
+		return Fail(c, ErrCodeNotFound, "Template not found")
 	}
 
+	filename := fmt.Sprintf("koffan-template-%s-%s.%s", sanitizeFilename(tmpl.Name), time.Now().Format("2006-01-02"), format)
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+
 	if format == "csv" {
-		return exportListAsCSV(c, list, sections)
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+
+		writer, err := startCSVExport(c.Response().BodyWriter(), comma, opts)
+		if err != nil {
+			return err
+		}
+		writeTemplateCSVRows(writer, tmpl)
+		writer.Flush()
+		return writer.Error()
 	}
 
-	return exportListAsJSON(c, list, sections)
+	c.Set("Content-Type", "application/json")
+	return c.JSON(ExportData{
+		Version:    ExportVersion,
+		AppVersion: AppVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		App:        "koffan",
+		Data: ExportBody{
+			Lists:     []ExportList{},
+			Templates: []ExportTemplate{toExportTemplate(tmpl)},
+		},
+	})
 }
 
-func exportAllAsJSON(c *fiber.Ctx, lists []db.List, includeTemplates, includeHistory bool) error {
+// buildExport collects lists with their sections and items, and templates and history as opts asks
+func buildExport(lists []db.List, opts ExportOptions) *ExportData {
 	exportData := ExportData{
-		Version:    "1.0",
+		Version:    ExportVersion,
+		AppVersion: AppVersion,
 		ExportedAt: time.Now().UTC().Format(time.RFC3339),
 		App:        "koffan",
 		Data: ExportBody{
@@ -125,100 +372,158 @@ func exportAllAsJSON(c *fiber.Ctx, lists []db.List, includeTemplates, includeHis
 	}
 
 	for _, list := range lists {
-		sections, err := db.GetSectionsByList(list.ID)
+		sections, err := exportSections(list.ID, opts)
 		if err != nil {
 			continue
 		}
 
-		exportList := ExportList{
-			Name:     list.Name,
-			Icon:     list.Icon,
-			IsActive: list.IsActive,
-			Sections: make([]ExportSection, 0, len(sections)),
-		}
-
-		for _, section := range sections {
-			exportSection := ExportSection{
-				Name:  section.Name,
-				Items: make([]ExportItem, 0, len(section.Items)),
-			}
-
-			for _, item := range section.Items {
-				exportSection.Items = append(exportSection.Items, ExportItem{
-					Name:        item.Name,
-					Description: item.Description,
-					Completed:   item.Completed,
-					Uncertain:   item.Uncertain,
-					Quantity:    item.Quantity,
-				})
-			}
-
-			exportList.Sections = append(exportList.Sections, exportSection)
-		}
-
-		exportData.Data.Lists = append(exportData.Data.Lists, exportList)
+		exportData.Data.Lists = append(exportData.Data.Lists, toExportList(&list, sections))
 	}
 
 	// Include templates if requested
-	if includeTemplates {
+	if opts.IncludeTemplates {
 		templates, err := db.GetAllTemplates()
 		if err == nil {
 			exportData.Data.Templates = make([]ExportTemplate, 0, len(templates))
-			for _, tmpl := range templates {
-				exportTemplate := ExportTemplate{
-					Name:        tmpl.Name,
-					Description: tmpl.Description,
-					Items:       make([]ExportTemplateItem, 0, len(tmpl.Items)),
-				}
-				for _, item := range tmpl.Items {
-					exportTemplate.Items = append(exportTemplate.Items, ExportTemplateItem{
-						SectionName: item.SectionName,
-						Name:        item.Name,
-						Description: item.Description,
-					})
-				}
-				exportData.Data.Templates = append(exportData.Data.Templates, exportTemplate)
+			for i := range templates {
+				exportData.Data.Templates = append(exportData.Data.Templates, toExportTemplate(&templates[i]))
 			}
 		}
 	}
 
 	// Include history if requested
-	if includeHistory {
-		historyItems, err := db.GetAllItemSuggestions(1000)
-		if err == nil {
-			exportData.Data.History = make([]ExportHistory, 0, len(historyItems))
-			for _, h := range historyItems {
-				sectionName := h.LastSectionName
-				// Fallback: if no section in history, find where item currently exists
-				if sectionName == "" {
-					sectionName = db.GetSectionNameForItem(h.Name)
+	if opts.IncludeHistory {
+		if history, err := exportHistoryEntries(1000); err == nil {
+			exportData.Data.History = history
+		}
+	}
+
+	return &exportData
+}
+
+// exportAllAsJSON writes the same JSON as encoding buildExport, but encodes each list as soon as its
+// sections are fetched, so the lists are never all held in memory at once
+func exportAllAsJSON(w io.Writer, lists []db.List, opts ExportOptions) error {
+	bw := bufio.NewWriter(w)
+
+	// The envelope is ExportData without data, whose key comes last
+	envelope, err := json.Marshal(struct {
+		Version    string `json:"version"`
+		AppVersion string `json:"app_version,omitempty"`
+		ExportedAt string `json:"exported_at"`
+		App        string `json:"app"`
+	}{ExportVersion, AppVersion, time.Now().UTC().Format(time.RFC3339), "koffan"})
+	if err != nil {
+		return err
+	}
+	bw.Write(envelope[:len(envelope)-1])
+	bw.WriteString(`,"data":{"lists":[`)
+
+	written := 0
+	for _, list := range lists {
+		sections, err := exportSections(list.ID, opts)
+		if err != nil {
+			continue
+		}
+		if err := writeJSONElement(bw, written, toExportList(&list, sections)); err != nil {
+			return err
+		}
+		written++
+	}
+	bw.WriteString("]")
+
+	// Templates and history are left out when there are none, like the omitempty fields of ExportBody
+	if opts.IncludeTemplates {
+		if templates, err := db.GetAllTemplates(); err == nil && len(templates) > 0 {
+			bw.WriteString(`,"templates":[`)
+			for i := range templates {
+				if err := writeJSONElement(bw, i, toExportTemplate(&templates[i])); err != nil {
+					return err
+				}
+			}
+			bw.WriteString("]")
+		}
+	}
+	if opts.IncludeHistory {
+		if history, err := exportHistoryEntries(1000); err == nil && len(history) > 0 {
+			bw.WriteString(`,"history":[`)
+			for i, h := range history {
+				if err := writeJSONElement(bw, i, h); err != nil {
+					return err
 				}
-				exportData.Data.History = append(exportData.Data.History, ExportHistory{
-					Name:        h.Name,
-					LastSection: sectionName,
-					UsageCount:  h.UsageCount,
-				})
 			}
+			bw.WriteString("]")
 		}
 	}
 
-	filename := fmt.Sprintf("koffan-export-%s.json", time.Now().Format("2006-01-02"))
-	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Set("Content-Type", "application/json")
+	bw.WriteString("}}\n")
+	return bw.Flush()
+}
 
-	return c.JSON(exportData)
+// writeJSONElement writes the i-th element of a JSON array, preceded by a comma after the first
+func writeJSONElement(w *bufio.Writer, i int, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if i > 0 {
+		w.WriteByte(',')
+	}
+	_, err = w.Write(data)
+	return err
 }
 
-func exportListAsJSON(c *fiber.Ctx, list *db.List, sections []db.Section) error {
-	exportData := ExportData{
-		Version:    "1.0",
-		ExportedAt: time.Now().UTC().Format(time.RFC3339),
-		App:        "koffan",
-		Data: ExportBody{
-			Lists: make([]ExportList, 0, 1),
-		},
+// exportHistoryEntries returns up to limit history entries in the export format, all of them for a negative limit
+func exportHistoryEntries(limit int) ([]ExportHistory, error) {
+	historyItems, err := db.GetAllItemSuggestions(limit)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]ExportHistory, 0, len(historyItems))
+	for _, h := range historyItems {
+		sectionName := h.LastSectionName
+		// Fallback: if no section in history, find where item currently exists
+		if sectionName == "" {
+			sectionName = db.GetSectionNameForItem(h.Name)
+		}
+		history = append(history, ExportHistory{
+			Name:        h.Name,
+			LastSection: sectionName,
+			UsageCount:  h.UsageCount,
+		})
+	}
+	return history, nil
+}
+
+// exportListHistoryEntries returns the history entries whose last section belongs to a list
+func exportListHistoryEntries(listID int64) ([]ExportHistory, error) {
+	historyItems, err := db.GetListItemSuggestions(listID)
+	if err != nil {
+		return nil, err
 	}
+	history := make([]ExportHistory, 0, len(historyItems))
+	for _, h := range historyItems {
+		history = append(history, ExportHistory{
+			Name:        h.Name,
+			LastSection: h.LastSectionName,
+			UsageCount:  h.UsageCount,
+		})
+	}
+	return history, nil
+}
 
+// writeHistoryCSVRows writes a [HISTORY] row per entry, padded to the width of csvExportHeader
+// Format: [HISTORY],,item_name,last_section,usage_count,,
+func writeHistoryCSVRows(writer *csvExportWriter, history []ExportHistory) {
+	for _, h := range history {
+		record := make([]string, len(csvExportHeader))
+		record[0], record[2], record[3], record[4] = "[HISTORY]", h.Name, h.LastSection, strconv.Itoa(h.UsageCount)
+		writer.Write(record)
+	}
+}
+
+// toExportList converts a list with its sections to the export format
+func toExportList(list *db.List, sections []db.Section) ExportList {
 	exportList := ExportList{
 		Name:     list.Name,
 		Icon:     list.Icon,
@@ -226,26 +531,72 @@ func exportListAsJSON(c *fiber.Ctx, list *db.List, sections []db.Section) error
 		Sections: make([]ExportSection, 0, len(sections)),
 	}
 
-	for _, section := range sections {
+	for i := range sections {
+		section := &sections[i]
 		exportSection := ExportSection{
-			Name:  section.Name,
-			Items: make([]ExportItem, 0, len(section.Items)),
+			Name:      section.Name,
+			SortOrder: &section.SortOrder,
+			Items:     make([]ExportItem, 0, len(section.Items)),
 		}
 
-		for _, item := range section.Items {
+		for j := range section.Items {
+			item := &section.Items[j]
 			exportSection.Items = append(exportSection.Items, ExportItem{
 				Name:        item.Name,
 				Description: item.Description,
 				Completed:   item.Completed,
 				Uncertain:   item.Uncertain,
 				Quantity:    item.Quantity,
+				SortOrder:   &item.SortOrder,
+				CreatedAt:   exportTime(item.CreatedAt),
+				CompletedAt: exportCompletedAt(item),
+				Price:       exportPrice(item),
+				Currency:    item.Currency,
+				DueDate:     item.DueDate,
+				photo:       item.Photo,
 			})
 		}
 
 		exportList.Sections = append(exportList.Sections, exportSection)
 	}
 
-	exportData.Data.Lists = append(exportData.Data.Lists, exportList)
+	return exportList
+}
+
+// toExportTemplate converts a template with its items to the export format
+func toExportTemplate(tmpl *db.Template) ExportTemplate {
+	exportTemplate := ExportTemplate{
+		Name:        tmpl.Name,
+		Description: tmpl.Description,
+		Items:       make([]ExportTemplateItem, 0, len(tmpl.Items)),
+	}
+	for _, item := range tmpl.Items {
+		exportTemplate.Items = append(exportTemplate.Items, ExportTemplateItem{
+			SectionName: item.SectionName,
+			Name:        item.Name,
+			Description: item.Description,
+		})
+	}
+	return exportTemplate
+}
+
+func exportListAsJSON(c *fiber.Ctx, list *db.List, sections []db.Section, opts ExportOptions) error {
+	exportData := ExportData{
+		Version:    ExportVersion,
+		AppVersion: AppVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		App:        "koffan",
+		Data: ExportBody{
+			Lists: make([]ExportList, 0, 1),
+		},
+	}
+
+	exportData.Data.Lists = append(exportData.Data.Lists, toExportList(list, sections))
+	if opts.IncludeHistory {
+		if history, err := exportListHistoryEntries(list.ID); err == nil {
+			exportData.Data.History = history
+		}
+	}
 
 	filename := fmt.Sprintf("koffan-%s-%s.json", sanitizeFilename(list.Name), time.Now().Format("2006-01-02"))
 	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
@@ -254,109 +605,123 @@ func exportListAsJSON(c *fiber.Ctx, list *db.List, sections []db.Section) error
 	return c.JSON(exportData)
 }
 
-func exportAllAsCSV(c *fiber.Ctx, lists []db.List) error {
-	includeHistory := c.Query("include_history", "true") == "true"
-	delimiter := c.Query("delimiter", ",")
-
-	filename := fmt.Sprintf("koffan-export-%s.csv", time.Now().Format("2006-01-02"))
-	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Set("Content-Type", "text/csv; charset=utf-8")
+// csvExportHeader is the header of CSV exports, the import columns with quantity, sort orders and times
+var csvExportHeader = []string{"list_name", "list_icon", "section_name", "item_name", "item_description", "item_completed", "item_uncertain", "item_quantity", "section_sort_order", "item_sort_order", "item_created_at", "item_completed_at", "item_price", "item_currency", "item_due_date"}
+
+// parseDelimiter returns the CSV field separator named by delimiter: a single character, "\t" or "tab" for a tab,
+// and "," when it is empty. Line breaks and quotes cannot separate fields and are rejected
+func parseDelimiter(delimiter string) (rune, *AppError) {
+	switch {
+	case delimiter == "":
+		return ',', nil
+	case delimiter == `\t` || strings.EqualFold(delimiter, "tab"):
+		return '\t', nil
+	}
+	comma, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) {
+		return 0, NewError(ErrCodeValidation, "Delimiter must be a single character")
+	}
+	if comma == utf8.RuneError || comma == '\r' || comma == '\n' || comma == '"' || comma == 0 {
+		return 0, NewError(ErrCodeValidation, "Delimiter cannot be a line break, a quote or an invalid character")
+	}
+	return comma, nil
+}
 
-	// Write BOM for Excel compatibility
-	c.Write([]byte{0xEF, 0xBB, 0xBF})
+// exportTime formats t as RFC3339 in UTC, empty if it is zero
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
 
-	writer := csv.NewWriter(c.Response().BodyWriter())
-	// Set delimiter
-	if len(delimiter) > 0 {
-		writer.Comma = rune(delimiter[0])
+// exportCompletedAt returns when item was completed as RFC3339, empty if it is not completed
+func exportCompletedAt(item *db.Item) string {
+	if !item.Completed || item.CompletedAt == nil {
+		return ""
 	}
-	defer writer.Flush()
+	return exportTime(time.Unix(*item.CompletedAt, 0))
+}
 
-	// Header
-	writer.Write([]string{"list_name", "list_icon", "section_name", "item_name", "item_description", "item_completed", "item_uncertain", "item_quantity"})
+func exportAllAsCSV(w io.Writer, lists []db.List, opts ExportOptions, comma rune) error {
+	writer, err := startCSVExport(w, comma, opts)
+	if err != nil {
+		return err
+	}
 
 	for _, list := range lists {
-		sections, err := db.GetSectionsByList(list.ID)
+		sections, err := exportSections(list.ID, opts)
 		if err != nil {
 			continue
 		}
+		writeListCSVRows(writer, &list, sections)
+	}
 
-		hasItems := false
-		for _, section := range sections {
-			for _, item := range section.Items {
-				hasItems = true
-				writer.Write([]string{
-					list.Name,
-					list.Icon,
-					section.Name,
-					item.Name,
-					item.Description,
-					strconv.FormatBool(item.Completed),
-					strconv.FormatBool(item.Uncertain),
-					strconv.Itoa(item.Quantity),
-				})
+	// Export templates if requested, one row per item and one without an item for empty templates
+	// Format: [TEMPLATE],template_name,section_name,item_name,item_description,template_description,...
+	if opts.IncludeTemplates {
+		templates, err := db.GetAllTemplates()
+		if err == nil {
+			for _, tmpl := range templates {
+				writeTemplateCSVRows(writer, &tmpl)
 			}
 		}
-
-		// Export empty list with just name and icon
-		if !hasItems {
-			writer.Write([]string{
-				list.Name,
-				list.Icon,
-				"",
-				"",
-				"",
-				"",
-				"",
-				"",
-			})
-		}
 	}
 
 	// Export history if requested
-	// Format: [HISTORY],,item_name,last_section,usage_count,,
-	if includeHistory {
-		historyItems, err := db.GetAllItemSuggestions(1000)
-		if err == nil {
-			for _, h := range historyItems {
-				sectionName := h.LastSectionName
-				// Fallback: if no section in history, find where item currently exists
-				if sectionName == "" {
-					sectionName = db.GetSectionNameForItem(h.Name)
-				}
-				writer.Write([]string{
-					"[HISTORY]",
-					"",
-					h.Name,
-					sectionName,
-					strconv.Itoa(h.UsageCount),
-					"",
-					"",
-					"",
-				})
-			}
+	if opts.IncludeHistory {
+		if history, err := exportHistoryEntries(1000); err == nil {
+			writeHistoryCSVRows(writer, history)
 		}
 	}
 
-	return nil
+	writer.Flush()
+	return writer.Error()
 }
 
-func exportListAsCSV(c *fiber.Ctx, list *db.List, sections []db.Section) error {
+// writeTemplateCSVRows writes the [TEMPLATE] rows of a template, padded to the width of csvExportHeader
+func writeTemplateCSVRows(writer *csvExportWriter, tmpl *db.Template) {
+	row := func(sectionName, name, description string) []string {
+		record := make([]string, len(csvExportHeader))
+		record[0], record[1], record[2], record[3], record[4], record[5] = "[TEMPLATE]", tmpl.Name, sectionName, name, description, tmpl.Description
+		return record
+	}
+	if len(tmpl.Items) == 0 {
+		writer.Write(row("", "", ""))
+	}
+	for _, item := range tmpl.Items {
+		writer.Write(row(item.SectionName, item.Name, item.Description))
+	}
+}
+
+func exportListAsCSV(c *fiber.Ctx, list *db.List, sections []db.Section, comma rune, opts ExportOptions) error {
 	filename := fmt.Sprintf("koffan-%s-%s.csv", sanitizeFilename(list.Name), time.Now().Format("2006-01-02"))
 	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	c.Set("Content-Type", "text/csv; charset=utf-8")
 
-	// Write BOM for Excel compatibility
-	c.Write([]byte{0xEF, 0xBB, 0xBF})
+	writer, err := startCSVExport(c.Response().BodyWriter(), comma, opts)
+	if err != nil {
+		return err
+	}
+	writeListCSVRows(writer, list, sections)
 
-	writer := csv.NewWriter(c.Response().BodyWriter())
-	defer writer.Flush()
+	// History of the items last added to a section of this list
+	if opts.IncludeHistory {
+		if history, err := exportListHistoryEntries(list.ID); err == nil {
+			writeHistoryCSVRows(writer, history)
+		}
+	}
 
-	// Header
-	writer.Write([]string{"list_name", "list_icon", "section_name", "item_name", "item_description", "item_completed", "item_uncertain", "item_quantity"})
+	writer.Flush()
+	return writer.Error()
+}
 
+// writeListCSVRows writes a row per item of a list, or one with just the name and icon of an empty list
+func writeListCSVRows(writer *csvExportWriter, list *db.List, sections []db.Section) {
+	hasItems := false
 	for _, section := range sections {
 		for _, item := range section.Items {
+			hasItems = true
 			writer.Write([]string{
 				list.Name,
 				list.Icon,
@@ -366,10 +731,183 @@ func exportListAsCSV(c *fiber.Ctx, list *db.List, sections []db.Section) error {
 				strconv.FormatBool(item.Completed),
 				strconv.FormatBool(item.Uncertain),
 				strconv.Itoa(item.Quantity),
+				strconv.Itoa(section.SortOrder),
+				strconv.Itoa(item.SortOrder),
+				exportTime(item.CreatedAt),
+				exportCompletedAt(&item),
+				string(exportPrice(&item)),
+				item.Currency,
+				item.DueDate,
 			})
 		}
 	}
 
+	if !hasItems {
+		record := make([]string, len(csvExportHeader))
+		record[0], record[1] = list.Name, list.Icon
+		writer.Write(record)
+	}
+}
+
+// xlsxItemHeader is the header of the list sheets of XLSX exports
+var xlsxItemHeader = []any{"section_name", "item_name", "item_description", "item_completed", "item_uncertain", "item_quantity", "item_price", "item_currency", "item_due_date"}
+
+// xlsxHistorySheet names the history sheet, Excel reserves "History" itself
+const xlsxHistorySheet = "Item history"
+
+// xlsxListSheet returns the sheet of a list, a header and one row per item
+func xlsxListSheet(list ExportList, used map[string]bool) xlsxSheet {
+	sheet := xlsxSheet{Name: xlsxSheetName(list.Name, used), Rows: [][]any{xlsxItemHeader}}
+	for _, section := range list.Sections {
+		for _, item := range section.Items {
+			var price any
+			if cents, err := ParsePrice(string(item.Price)); err == nil {
+				price = float64(cents) / 100
+			}
+			sheet.Rows = append(sheet.Rows, []any{section.Name, item.Name, item.Description, item.Completed, item.Uncertain, item.Quantity, price, item.Currency, item.DueDate})
+		}
+	}
+	return sheet
+}
+
+// exportAllAsXLSX writes a workbook with one sheet per list and, if requested, the item history
+func exportAllAsXLSX(w io.Writer, lists []db.List, opts ExportOptions) error {
+	opts.IncludeTemplates = false
+	data := buildExport(lists, opts)
+
+	used := map[string]bool{strings.ToLower(xlsxHistorySheet): opts.IncludeHistory}
+	sheets := make([]xlsxSheet, 0, len(data.Data.Lists)+1)
+	for _, list := range data.Data.Lists {
+		sheets = append(sheets, xlsxListSheet(list, used))
+	}
+
+	if opts.IncludeHistory {
+		history := xlsxSheet{Name: xlsxHistorySheet, Rows: [][]any{{"item_name", "last_section", "usage_count"}}}
+		for _, h := range data.Data.History {
+			history.Rows = append(history.Rows, []any{h.Name, h.LastSection, h.UsageCount})
+		}
+		sheets = append(sheets, history)
+	}
+
+	// A workbook needs a sheet even without lists
+	if len(sheets) == 0 {
+		sheets = append(sheets, xlsxSheet{Name: "Lists", Rows: [][]any{xlsxItemHeader}})
+	}
+	return writeXLSX(w, sheets)
+}
+
+// exportAllAsZIP writes a ZIP archive of the JSON and CSV exports and a manifest, for backups in one file
+// Each file is written to the archive as it is produced, nothing but the JSON export is held in memory
+func exportAllAsZIP(w io.Writer, lists []db.List, opts ExportOptions, comma rune) error {
+	data := buildExport(lists, opts)
+	modified, _ := time.Parse(time.RFC3339, data.ExportedAt)
+
+	var photos []string
+	if opts.IncludePhotos {
+		photos = exportPhotos(data)
+	}
+
+	zw := zip.NewWriter(w)
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	}
+
+	f, err := create("koffan-export.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(data); err != nil {
+		return err
+	}
+
+	if f, err = create("koffan-export.csv"); err != nil {
+		return err
+	}
+	if err := exportAllAsCSV(f, lists, opts, comma); err != nil {
+		return err
+	}
+
+	if f, err = create("manifest.txt"); err != nil {
+		return err
+	}
+	manifest := fmt.Sprintf("app: koffan\nversion: %s\nexport_version: %s\nexported_at: %s\nfiles: koffan-export.json, koffan-export.csv\n",
+		AppVersion, data.Version, data.ExportedAt)
+	if opts.IncludePhotos {
+		manifest += fmt.Sprintf("photos: %d in %s/\n", len(photos), db.PhotosDir)
+	}
+	if _, err := io.WriteString(f, manifest); err != nil {
+		return err
+	}
+
+	for _, photo := range photos {
+		// Images are compressed already
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: photo, Method: zip.Store, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if err := copyManagedFile(f, photo); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// exportPhotos sets the Photo of the exported items whose photo file exists and returns the paths of
+// those files, which the ZIP stores under the same names
+func exportPhotos(data *ExportData) []string {
+	var photos []string
+	seen := map[string]bool{}
+	for l := range data.Data.Lists {
+		for s := range data.Data.Lists[l].Sections {
+			items := data.Data.Lists[l].Sections[s].Items
+			for i := range items {
+				if items[i].photo == "" {
+					continue
+				}
+				path, ok := ManagedFilePath(items[i].photo)
+				if !ok {
+					continue
+				}
+				if _, err := os.Stat(path); err != nil {
+					continue
+				}
+				items[i].Photo = items[i].photo
+				if !seen[items[i].photo] {
+					seen[items[i].photo] = true
+					photos = append(photos, items[i].photo)
+				}
+			}
+		}
+	}
+	return photos
+}
+
+// copyManagedFile copies a file referenced relative to db.FilesDir to w
+func copyManagedFile(w io.Writer, rel string) error {
+	path, ok := ManagedFilePath(rel)
+	if !ok {
+		return fmt.Errorf("%s is outside the files directory", rel)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func exportListAsXLSX(c *fiber.Ctx, list *db.List, sections []db.Section) error {
+	filename := fmt.Sprintf("koffan-%s-%s.xlsx", sanitizeFilename(list.Name), time.Now().Format("2006-01-02"))
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Set("Content-Type", xlsxContentType)
+
+	sheet := xlsxListSheet(toExportList(list, sections), map[string]bool{})
+	if err := writeXLSX(c.Response().BodyWriter(), []xlsxSheet{sheet}); err != nil {
+		c.Response().ResetBody()
+		c.Set("Content-Disposition", "")
+		return Fail(c, ErrCodeInternal, "Failed to write workbook")
+	}
 	return nil
 }
 
@@ -391,10 +929,11 @@ func sanitizeFilename(name string) string {
 }
 
 // GetExportPreview returns a preview of what will be exported (for UI)
+// With exclude_completed=true the items count leaves out completed items like the export
 func GetExportPreview(c *fiber.Ctx) error {
 	lists, err := db.GetAllLists()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch lists"})
+		return Fail(c, ErrCodeDB, "Failed to fetch lists")
 	}
 
 	templates, _ := db.GetAllTemplates()
@@ -403,6 +942,9 @@ func GetExportPreview(c *fiber.Ctx) error {
 	totalItems := 0
 	for _, list := range lists {
 		totalItems += list.Stats.TotalItems
+		if c.Query("exclude_completed") == "true" {
+			totalItems -= list.Stats.CompletedItems
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -413,11 +955,45 @@ func GetExportPreview(c *fiber.Ctx) error {
 	})
 }
 
-// decodeJSON helper for import
-func decodeJSON(data []byte) (*ExportData, error) {
+// decodeJSON decodes a JSON export and upgrades it to the current structure
+func decodeJSON(data []byte) (*ExportData, *AppError) {
 	var exportData ExportData
 	if err := json.Unmarshal(data, &exportData); err != nil {
-		return nil, err
+		// Report files from newer versions as such even if their structure changed
+		var header struct {
+			Version    string `json:"version"`
+			AppVersion string `json:"app_version"`
+		}
+		if json.Unmarshal(data, &header) == nil {
+			if _, appErr := exportSchemaFor(header.Version, header.AppVersion); appErr != nil {
+				return nil, appErr
+			}
+		}
+		return nil, NewError(ErrCodeInvalidFile, "Invalid JSON format: "+err.Error())
+	}
+	if appErr := upgradeExport(&exportData); appErr != nil {
+		return nil, appErr
+	}
+	return &exportData, nil
+}
+
+// decodeYAMLExport decodes a YAML export and upgrades it to the current structure
+func decodeYAMLExport(data []byte) (*ExportData, *AppError) {
+	var exportData ExportData
+	if err := decodeYAML(data, &exportData); err != nil {
+		var header struct {
+			Version    string `json:"version"`
+			AppVersion string `json:"app_version"`
+		}
+		if decodeYAML(data, &header) == nil {
+			if _, appErr := exportSchemaFor(header.Version, header.AppVersion); appErr != nil {
+				return nil, appErr
+			}
+		}
+		return nil, NewError(ErrCodeInvalidFile, "Invalid YAML format: "+err.Error())
+	}
+	if appErr := upgradeExport(&exportData); appErr != nil {
+		return nil, appErr
 	}
 	return &exportData, nil
 }
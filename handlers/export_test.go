@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+
+	"shopping-list/db"
+)
+
+// seedLargeExport creates lists with sections of items, named and described like real ones
+func seedLargeExport(tb testing.TB, lists, sections, items int) {
+	tb.Helper()
+	for l := 0; l < lists; l++ {
+		list, err := db.CreateList(fmt.Sprintf("List %d", l), "🛒")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for s := 0; s < sections; s++ {
+			section, err := db.CreateSectionForList(list.ID, fmt.Sprintf("Section %d", s))
+			if err != nil {
+				tb.Fatal(err)
+			}
+			_, err = db.DB.Exec(`
+				WITH RECURSIVE n(i) AS (SELECT 0 UNION ALL SELECT i + 1 FROM n WHERE i + 1 < ?)
+				INSERT INTO items (section_id, name, description, completed, quantity, sort_order, price_cents, currency)
+				SELECT ?, 'Item "' || i || '"', 'Zażółć gęślą jaźń ' || i, i % 3 = 0, i % 5 + 1, i, i * 7, 'EUR' FROM n
+			`, items, section.ID)
+			if err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+}
+
+var exportedAtPattern = regexp.MustCompile(`"exported_at":"[^"]*"`)
+
+func TestStreamingJSONExportMatchesTree(t *testing.T) {
+	setupTestDB(t)
+	seedExportData(t)
+	seedLargeExport(t, 2, 2, 3)
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []ExportOptions{
+		{IncludeTemplates: true, IncludeHistory: true},
+		{},
+		{ExcludeCompleted: true, IncludeHistory: true},
+	} {
+		var streamed, tree bytes.Buffer
+		if err := exportAllAsJSON(&streamed, lists, opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewEncoder(&tree).Encode(buildExport(lists, opts)); err != nil {
+			t.Fatal(err)
+		}
+		got := exportedAtPattern.ReplaceAll(streamed.Bytes(), nil)
+		want := exportedAtPattern.ReplaceAll(tree.Bytes(), nil)
+		if !bytes.Equal(got, want) {
+			t.Errorf("streamed export with %+v differs:\ngot  %s\nwant %s", opts, got, want)
+		}
+	}
+}
+
+// BenchmarkExportJSON compares the streamed full JSON export with encoding the tree buildExport returns,
+// which the export used before, on 50000 items. Both allocate about as much in all, the stream only holds
+// one list at a time
+func BenchmarkExportJSON(b *testing.B) {
+	setupTestDB(b)
+	seedLargeExport(b, 10, 5, 1000)
+	lists, err := db.GetAllLists()
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := ExportOptions{IncludeTemplates: true, IncludeHistory: true}
+
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := exportAllAsJSON(io.Discard, lists, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := json.NewEncoder(io.Discard).Encode(buildExport(lists, opts)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"os"
+	"shopping-list/db"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// ExportDownloadPath serves exports through signed links, without a session or token
+	ExportDownloadPath = "/export/download"
+
+	// settingExportLinkSecret keeps the generated signing secret across restarts, it is not a registered setting
+	settingExportLinkSecret = "export_link_secret"
+)
+
+// Formats a download link may name, for full exports and for single lists
+var (
+	ExportLinkFormats     = []string{"json", "yaml", "csv", "xlsx", "markdown", "html", "zip"}
+	ExportListLinkFormats = []string{"json", "csv", "xlsx", "markdown", "html"}
+)
+
+// exportLinkSecret signs download links, see InitExportLinks
+var exportLinkSecret []byte
+
+// InitExportLinks loads the secret that signs export download links: EXPORT_LINK_SECRET, or one generated
+// on first boot and kept in the database. Changing it invalidates the links handed out before
+func InitExportLinks() {
+	if secret := os.Getenv("EXPORT_LINK_SECRET"); secret != "" {
+		exportLinkSecret = []byte(secret)
+		return
+	}
+	if secret, err := db.GetSetting(settingExportLinkSecret, ""); err == nil && secret != "" {
+		exportLinkSecret = []byte(secret)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to generate export link secret: %v", err)
+	}
+	secret := hex.EncodeToString(b)
+	if err := db.SetSetting(settingExportLinkSecret, secret); err != nil {
+		log.Printf("[EXPORT] Failed to persist export link secret, links will not survive a restart: %v", err)
+	}
+	exportLinkSecret = []byte(secret)
+}
+
+// SignExportLink returns the path and query of a download link for the export query describes, a full
+// export or with list_id a single list, valid until expires. The signature covers every parameter
+func SignExportLink(query url.Values, expires time.Time) string {
+	signed := url.Values{}
+	for key, values := range query {
+		signed[key] = append([]string(nil), values...)
+	}
+	signed.Del("sig")
+	signed.Set("exp", strconv.FormatInt(expires.Unix(), 10))
+	signed.Set("sig", exportLinkSignature(signed))
+	return ExportDownloadPath + "?" + signed.Encode()
+}
+
+// exportLinkSignature is the HMAC of the download path and the sorted query without sig
+func exportLinkSignature(query url.Values) string {
+	mac := hmac.New(sha256.New, exportLinkSecret)
+	mac.Write([]byte(ExportDownloadPath + "?" + query.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadExport serves the export a signed link describes, like GET /export or GET /export/list/:id
+// Links that were changed or have expired are refused with 403
+func DownloadExport(c *fiber.Ctx) error {
+	query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return Fail(c, ErrCodeInvalidSignature, "Invalid download link")
+	}
+	sig := query.Get("sig")
+	query.Del("sig")
+	if sig == "" || !hmac.Equal([]byte(sig), []byte(exportLinkSignature(query))) {
+		return Fail(c, ErrCodeInvalidSignature, "Invalid download link")
+	}
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return Fail(c, ErrCodeLinkExpired, "Download link has expired")
+	}
+
+	if value := query.Get("list_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Fail(c, ErrCodeInvalidID, "Invalid list ID")
+		}
+		return exportSingleList(c, id)
+	}
+	return ExportAllData(c)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exportSchema is a major version of the export format that imports accept
+// Its upgrades convert the lists, templates and history entries of such a file to the current structure,
+// they are nil when the fields of the version are still read as they are
+type exportSchema struct {
+	upgradeList     func(*ExportList)
+	upgradeTemplate func(*ExportTemplate)
+	upgradeHistory  func(*ExportHistory)
+}
+
+// exportSchemas maps the major versions of the export format to their schema. Minor versions only add
+// optional fields. A change old files cannot be read with bumps ExportVersion to the next major version,
+// adds it here and gives the older versions the upgrades that fill in what it changed
+var exportSchemas = map[int]exportSchema{
+	1: {upgradeList: fillSortOrders}, // 1.0 to 1.5
+	2: {},
+}
+
+// fillSortOrders gives the sections and items of a 1.x list without a sort order the next one in file order,
+// as 1.0 files have none. 2.0 files always have them
+func fillSortOrders(list *ExportList) {
+	sectionOrder := 0
+	for i := range list.Sections {
+		section := &list.Sections[i]
+		section.SortOrder = filledSortOrder(section.SortOrder, &sectionOrder)
+		itemOrder := 0
+		for j := range section.Items {
+			section.Items[j].SortOrder = filledSortOrder(section.Items[j].SortOrder, &itemOrder)
+		}
+	}
+}
+
+// filledSortOrder returns order, or next if it is missing or negative, and advances next past it
+func filledSortOrder(order *int, next *int) *int {
+	if order == nil || *order < 0 {
+		filled := *next
+		order = &filled
+	}
+	*next = max(*next, *order+1)
+	return order
+}
+
+// parseExportVersion returns the major and minor version of an export, files without one are 1.0
+func parseExportVersion(version string) (int, int, bool) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return 1, 0, true
+	}
+	majorText, minorText, _ := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorText)
+	if err != nil || major < 0 {
+		return 0, 0, false
+	}
+	minor := 0
+	if minorText != "" {
+		if minor, err = strconv.Atoi(minorText); err != nil || minor < 0 {
+			return 0, 0, false
+		}
+	}
+	return major, minor, true
+}
+
+// exportSchemaFor returns the schema of an export version. Files from a newer major version fail with
+// unsupported_version and the app version to upgrade to, when the file names the one it came from
+func exportSchemaFor(version, appVersion string) (exportSchema, *AppError) {
+	major, _, ok := parseExportVersion(version)
+	if !ok {
+		return exportSchema{}, NewError(ErrCodeInvalidFile, fmt.Sprintf("Unknown export version %q", version))
+	}
+	current, _, _ := parseExportVersion(ExportVersion)
+	if major > current {
+		upgrade := "upgrade Koffan"
+		if appVersion = strings.TrimPrefix(strings.TrimSpace(appVersion), "v"); appVersion != "" && appVersion != "dev" {
+			upgrade = "upgrade to v" + appVersion
+		}
+		return exportSchema{}, NewError(ErrCodeUnsupportedVersion, fmt.Sprintf("This file was exported from a newer Koffan (export version %s), %s to import it", version, upgrade))
+	}
+	schema, ok := exportSchemas[major]
+	if !ok {
+		return exportSchema{}, NewError(ErrCodeUnsupportedVersion, fmt.Sprintf("Export version %s is no longer supported", version))
+	}
+	return schema, nil
+}
+
+// upgradeExport converts a decoded export to the current structure, or fails if its version is not supported
+func upgradeExport(exportData *ExportData) *AppError {
+	schema, appErr := exportSchemaFor(exportData.Version, exportData.AppVersion)
+	if appErr != nil {
+		return appErr
+	}
+	for i := range exportData.Data.Lists {
+		schema.list(&exportData.Data.Lists[i])
+	}
+	for i := range exportData.Data.Templates {
+		schema.template(&exportData.Data.Templates[i])
+	}
+	for i := range exportData.Data.History {
+		schema.history(&exportData.Data.History[i])
+	}
+	return nil
+}
+
+func (s exportSchema) list(list *ExportList) {
+	if s.upgradeList != nil {
+		s.upgradeList(list)
+	}
+}
+
+func (s exportSchema) template(template *ExportTemplate) {
+	if s.upgradeTemplate != nil {
+		s.upgradeTemplate(template)
+	}
+}
+
+func (s exportSchema) history(history *ExportHistory) {
+	if s.upgradeHistory != nil {
+		s.upgradeHistory(history)
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportOutline returns the sections of the exported lists in order as "List/Section: item, item"
+func exportOutline(data *ExportData) []string {
+	var outline []string
+	for _, list := range data.Data.Lists {
+		for _, section := range list.Sections {
+			var names []string
+			for _, item := range section.Items {
+				names = append(names, item.Name)
+			}
+			outline = append(outline, list.Name+"/"+section.Name+": "+strings.Join(names, ", "))
+		}
+	}
+	return outline
+}
+
+// exportedItem returns the exported item named name
+func exportedItem(t *testing.T, data *ExportData, name string) ExportItem {
+	t.Helper()
+	for _, list := range data.Data.Lists {
+		for _, section := range list.Sections {
+			for _, item := range section.Items {
+				if item.Name == name {
+					return item
+				}
+			}
+		}
+	}
+	t.Fatalf("no exported item named %q", name)
+	return ExportItem{}
+}
+
+func TestImportExportVersions(t *testing.T) {
+	fileOrder := []string{"Groceries/Dairy: Milk, Cheese", "Groceries/Bakery: Bread"}
+	cases := []struct {
+		file        string
+		outline     []string
+		milkOrder   int
+		milkCreated string // Empty for files without created times, which get the time of the import
+		price       ExportPrice
+		dueDate     string
+	}{
+		{"export_v1.0.json", fileOrder, 0, "", "", ""},
+		{"export_v1.3.json", fileOrder, 0, "2025-01-10T08:00:00Z", "2.49", ""},
+		{"export_v1.5.json", fileOrder, 0, "2025-09-10T08:00:00Z", "2.49", "2025-09-25"},
+		// 2.0 files are ordered by their sort orders, not the order they list sections and items in.
+		// Completed items still come last
+		{"export_v2.0.json", []string{"Groceries/Bakery: Bread", "Groceries/Dairy: Milk, Cheese"}, 1, "2026-09-10T08:00:00Z", "2.49", "2026-10-05"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.file, func(t *testing.T) {
+			setupTestDB(t)
+			data, err := os.ReadFile(filepath.Join("testdata", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := Import(strings.NewReader(string(data)), ImportOptions{Filename: tc.file})
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if result.ImportedLists != 1 || result.ImportedItems != 3 {
+				t.Errorf("imported %d lists and %d items, want 1 and 3", result.ImportedLists, result.ImportedItems)
+			}
+
+			exported := fullExport(t)
+			if exported.Version != "2.0" {
+				t.Errorf("export version = %q, want 2.0", exported.Version)
+			}
+			if got := exportOutline(exported); !reflect.DeepEqual(got, tc.outline) {
+				t.Errorf("lists = %q, want %q", got, tc.outline)
+			}
+			milk := exportedItem(t, exported, "Milk")
+			if milk.Description != "2L" || milk.Quantity != 2 || milk.Price != tc.price || milk.DueDate != tc.dueDate {
+				t.Errorf("milk = %+v, want 2L x2 priced %q due %q", milk, tc.price, tc.dueDate)
+			}
+			if milk.SortOrder == nil || *milk.SortOrder != tc.milkOrder {
+				t.Errorf("milk sort order = %v, want %d", milk.SortOrder, tc.milkOrder)
+			}
+			if tc.milkCreated != "" && milk.CreatedAt != tc.milkCreated {
+				t.Errorf("milk created at %q, want %q", milk.CreatedAt, tc.milkCreated)
+			}
+			if cheese := exportedItem(t, exported, "Cheese"); !cheese.Completed || cheese.CompletedAt == "" {
+				t.Errorf("cheese = %+v, want completed with a time", cheese)
+			}
+			if bread := exportedItem(t, exported, "Bread"); !bread.Uncertain || bread.Description != "rye" {
+				t.Errorf("bread = %+v, want uncertain rye", bread)
+			}
+			wantTemplates := []ExportTemplate{{Name: "Weekly", Items: []ExportTemplateItem{{SectionName: "Dairy", Name: "Milk", Description: "2L"}}}}
+			if !reflect.DeepEqual(exported.Data.Templates, wantTemplates) {
+				t.Errorf("templates = %+v, want %+v", exported.Data.Templates, wantTemplates)
+			}
+			wantHistory := []ExportHistory{{Name: "Milk", LastSection: "Dairy", UsageCount: 3}}
+			if !reflect.DeepEqual(exported.Data.History, wantHistory) {
+				t.Errorf("history = %+v, want %+v", exported.Data.History, wantHistory)
+			}
+		})
+	}
+}
+
+func TestImportRejectsNewerExportVersion(t *testing.T) {
+	setupTestDB(t)
+	data, err := os.ReadFile(filepath.Join("testdata", "export_v3.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Import(strings.NewReader(string(data)), ImportOptions{Filename: "export.json"})
+	var appErr *AppError
+	if !errors.As(err, &appErr) || appErr.Code != ErrCodeUnsupportedVersion || !strings.Contains(appErr.Message, "upgrade to v4.0.0") {
+		t.Fatalf("import = %v, want unsupported_version naming v4.0.0", err)
+	}
+
+	// The preview reports it the same way, even though the lists have a structure this version cannot decode
+	app := fiber.New()
+	app.Post("/import/preview", PreviewImport)
+	resp, err := app.Test(uploadRequest(t, "/import/preview", "export.json", data, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var preview ImportPreviewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		t.Fatal(err)
+	}
+	if preview.Valid || preview.Code != ErrCodeUnsupportedVersion || !strings.Contains(preview.Error, "upgrade to v4.0.0") {
+		t.Errorf("preview = %+v, want unsupported_version naming v4.0.0", preview)
+	}
+	if lists, _ := db.GetAllLists(); len(lists) != 0 {
+		t.Errorf("rejected import created %d lists", len(lists))
+	}
+}
+
+func TestParseExportVersion(t *testing.T) {
+	cases := []struct {
+		version      string
+		major, minor int
+		ok           bool
+	}{
+		{"", 1, 0, true},
+		{" 1.5 ", 1, 5, true},
+		{"2", 2, 0, true},
+		{"2.0", 2, 0, true},
+		{"10.12", 10, 12, true},
+		{"v2.0", 0, 0, false},
+		{"two", 0, 0, false},
+		{"-1.0", 0, 0, false},
+		{"1.x", 0, 0, false},
+	}
+	for _, tc := range cases {
+		major, minor, ok := parseExportVersion(tc.version)
+		if major != tc.major || minor != tc.minor || ok != tc.ok {
+			t.Errorf("parseExportVersion(%q) = %d, %d, %v, want %d, %d, %v", tc.version, major, minor, ok, tc.major, tc.minor, tc.ok)
+		}
+	}
+}
+
+func TestFillSortOrders(t *testing.T) {
+	order := func(n int) *int { return &n }
+	list := ExportList{Sections: []ExportSection{
+		{Name: "A", Items: []ExportItem{{Name: "a1"}, {Name: "a2", SortOrder: order(5)}, {Name: "a3"}}},
+		{Name: "B", SortOrder: order(4)},
+		{Name: "C", SortOrder: order(-1), Items: []ExportItem{{Name: "c1", SortOrder: order(-3)}}},
+	}}
+	fillSortOrders(&list)
+
+	var got []int
+	for _, section := range list.Sections {
+		got = append(got, *section.SortOrder)
+		for _, item := range section.Items {
+			got = append(got, *item.SortOrder)
+		}
+	}
+	// Missing orders follow the one before them, like nextSortOrder gives them on import
+	if want := []int{0, 0, 5, 6, 4, 5, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sort orders = %v, want %v", got, want)
+	}
+}
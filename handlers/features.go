@@ -0,0 +1,13 @@
+package handlers
+
+// FeatureFlags returns which optional server features are enabled
+func FeatureFlags() map[string]bool {
+	return map[string]bool{
+		"proxy_auth":      isProxyAuthEnabled(),
+		"admin_allowlist": adminAllowlist != nil,
+		"maintenance":     GetMaintenance().Enabled,
+		"shares":          shareLimiter != nil,
+		"auth_disabled":   isAuthDisabled(),
+		"backups":         true,
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"shopping-list/db"
+	"strings"
+	"time"
+)
+
+const (
+	// OperationFileCleanup is the operation name for orphaned file cleanup
+	OperationFileCleanup = "file_cleanup"
+
+	// orphanGrace is how long a file nothing references is kept before cleanup removes it
+	orphanGrace = time.Minute
+)
+
+// FileCleanupReport describes orphaned files found or removed from the managed directory
+type FileCleanupReport struct {
+	DryRun     bool     `json:"dry_run"`
+	Files      []string `json:"files"`
+	FreedBytes int64    `json:"freed_bytes"`
+}
+
+// CleanupFiles removes files in the managed directory that no row references
+// With dryRun the orphans are only reported
+func CleanupFiles(dryRun bool) (report *FileCleanupReport, err error) {
+	end, err := BeginOperation(OperationFileCleanup)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { end(err) }()
+
+	return cleanupFiles(dryRun)
+}
+
+// cleanupFiles does the work of CleanupFiles, callers must hold the operation lock
+func cleanupFiles(dryRun bool) (*FileCleanupReport, error) {
+	report := &FileCleanupReport{DryRun: dryRun, Files: []string{}}
+
+	root, err := filepath.Abs(db.FilesDir())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+		return report, nil
+	}
+
+	refs, err := db.ReferencedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Symlinks are never followed or removed, they could point outside the managed directory
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !isWithinDir(root, path) {
+			log.Printf("[CLEANUP] Refusing to touch %s outside %s", path, root)
+			return nil
+		}
+		if refs[rel] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// A file this new may be an upload whose row is not saved yet
+		if time.Since(info.ModTime()) < orphanGrace {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+		report.Files = append(report.Files, rel)
+		report.FreedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun && len(report.Files) > 0 {
+		log.Printf("[CLEANUP] Removed %d orphaned file(s), freed %d bytes", len(report.Files), report.FreedBytes)
+	}
+	return report, nil
+}
+
+// isWithinDir reports whether path is inside root, both must be absolute and clean
+func isWithinDir(root, path string) bool {
+	return strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+// cleanupFilesAfter removes files orphaned by a destructive operation, failures are only logged
+// Callers must hold the operation lock
+func cleanupFilesAfter(operation string) {
+	if _, err := cleanupFiles(false); err != nil {
+		log.Printf("[CLEANUP] File cleanup after %s failed: %v", operation, err)
+	}
+}
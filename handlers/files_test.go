@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+)
+
+// writeManagedFile writes data to rel under the managed directory, dated age ago
+func writeManagedFile(t *testing.T, rel, data string, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(db.FilesDir(), rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(-age)
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fileExists reports whether path exists, a symlink counts even if its target is gone
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestCleanupFilesRemovesOnlyOrphans(t *testing.T) {
+	setupTestDB(t)
+	useOperationState(t)
+	list, _ := db.CreateList("Groceries", "")
+	section, _ := db.CreateSectionForList(list.ID, "Dairy")
+	item, _ := db.CreateItem(section.ID, "Milk", "", 1)
+
+	referenced := writeManagedFile(t, "photos/milk.jpg", "referenced photo", time.Hour)
+	if _, err := db.SetItemPhoto(item.ID, "photos/milk.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	orphan := writeManagedFile(t, "photos/old.jpg", "orphaned photo", time.Hour)
+	// An upload whose row is not saved yet is kept for a while
+	fresh := writeManagedFile(t, "photos/uploading.jpg", "fresh upload", 0)
+	// A symlink is never followed or removed, nor is what it points to
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	if err := os.WriteFile(outside, []byte("not managed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(db.FilesDir(), "photos", "link.jpg")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run reports the orphan and removes nothing
+	report, err := CleanupFiles(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FileCleanupReport{DryRun: true, Files: []string{filepath.Join("photos", "old.jpg")}, FreedBytes: int64(len("orphaned photo"))}
+	if !reflect.DeepEqual(*report, want) {
+		t.Errorf("dry run = %+v, want %+v", *report, want)
+	}
+	if !fileExists(orphan) {
+		t.Fatal("dry run removed the orphan")
+	}
+
+	report, err = CleanupFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.DryRun = false
+	if !reflect.DeepEqual(*report, want) {
+		t.Errorf("cleanup = %+v, want %+v", *report, want)
+	}
+	if fileExists(orphan) {
+		t.Error("orphan was kept")
+	}
+	for _, path := range []string{referenced, fresh, link, outside} {
+		if !fileExists(path) {
+			t.Errorf("%s was removed", path)
+		}
+	}
+
+	// Nothing is left to remove
+	if report, err = CleanupFiles(false); err != nil || len(report.Files) != 0 || report.FreedBytes != 0 {
+		t.Errorf("second cleanup = %+v, %v, want nothing removed", report, err)
+	}
+	if recent := GetOperations().Recent; len(recent) != 3 || recent[0].Name != OperationFileCleanup {
+		t.Errorf("operations = %+v, want three file cleanups", recent)
+	}
+}
+
+func TestCleanupFilesWithoutManagedDirectory(t *testing.T) {
+	setupTestDB(t)
+	useOperationState(t)
+	report, err := CleanupFiles(false)
+	if err != nil || len(report.Files) != 0 {
+		t.Errorf("cleanup without %s = %+v, %v, want nothing to do", db.FilesDir(), report, err)
+	}
+}
+
+func TestClearDataRemovesOrphanedFiles(t *testing.T) {
+	setupTestDB(t)
+	useOperationState(t)
+	list, _ := db.CreateList("Groceries", "")
+	section, _ := db.CreateSectionForList(list.ID, "Dairy")
+	milk, _ := db.CreateItem(section.ID, "Milk", "", 1)
+	hardware, _ := db.CreateList("Hardware", "")
+	tools, _ := db.CreateSectionForList(hardware.ID, "Tools")
+	hammer, _ := db.CreateItem(tools.ID, "Hammer", "", 1)
+
+	milkPhoto := writeManagedFile(t, "photos/milk.jpg", "milk", time.Hour)
+	hammerPhoto := writeManagedFile(t, "photos/hammer.jpg", "hammer", time.Hour)
+	db.SetItemPhoto(milk.ID, "photos/milk.jpg")
+	db.SetItemPhoto(hammer.ID, "photos/hammer.jpg")
+	if _, err := db.DB.Exec("UPDATE items SET completed = TRUE, completed_at = strftime('%s', 'now') WHERE id = ?", hammer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cleared completed items go to the trash and can be restored, so their photos stay
+	if _, err := ClearData([]string{db.ClearTargetCompletedItems}); err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(hammerPhoto) || !fileExists(milkPhoto) {
+		t.Errorf("after clearing completed items: hammer photo kept %v, milk photo kept %v, want both", fileExists(hammerPhoto), fileExists(milkPhoto))
+	}
+
+	// Clearing the lists deletes the items, trashed ones included, and with them every photo
+	if _, err := ClearData(db.ClearTargets); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(milkPhoto) || fileExists(hammerPhoto) {
+		t.Errorf("after clearing all data: milk photo kept %v, hammer photo kept %v, want neither", fileExists(milkPhoto), fileExists(hammerPhoto))
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"shopping-list/db"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// readinessTimeout bounds all readiness checks together so probes get a quick answer
+const readinessTimeout = 500 * time.Millisecond
+
+// HealthCheck is the outcome of a single readiness check
+type HealthCheck struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// ReadinessResponse lists every readiness check, Ready is false if any of them failed
+type ReadinessResponse struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+var errRestoreInProgress = errors.New("database restore in progress")
+
+// Healthz reports that the process is serving requests, it does not touch the database
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Readyz checks that the database answers, the data directory is writable and all migrations are applied
+// It responds 503 with the failing checks otherwise
+func Readyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), readinessTimeout)
+	defer cancel()
+
+	response := ReadinessResponse{Ready: true}
+	for _, check := range []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{"database", checkDatabase},
+		{"storage", checkStorage},
+		{"migrations", checkMigrations},
+	} {
+		start := time.Now()
+		err := check.run(ctx)
+		result := HealthCheck{Name: check.name, OK: err == nil, DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			result.Error = err.Error()
+			response.Ready = false
+		}
+		response.Checks = append(response.Checks, result)
+	}
+
+	if !response.Ready {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(response)
+	}
+	return c.JSON(response)
+}
+
+// withDatabase runs fn unless a restore is swapping the database handle
+// Unlike restoreGuard it never waits, so a pending restore makes the check fail instead of blocking the probe
+func withDatabase(fn func() error) error {
+	if restoring.Load() || !restoreMu.TryRLock() {
+		return errRestoreInProgress
+	}
+	defer restoreMu.RUnlock()
+	return fn()
+}
+
+func checkDatabase(ctx context.Context) error {
+	return withDatabase(func() error { return db.Ping(ctx) })
+}
+
+// checkStorage writes and removes a temp file next to the database to catch full or read-only disks
+func checkStorage(context.Context) error {
+	f, err := os.CreateTemp(filepath.Dir(db.Path()), ".readyz-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write([]byte("ok"))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func checkMigrations(ctx context.Context) error {
+	return withDatabase(func() error {
+		pending, err := db.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d pending migrations", pending)
+		}
+		return nil
+	})
+}
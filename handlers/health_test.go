@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getReadiness requests /readyz and returns the status, the decoded response and how long it took
+func getReadiness(t *testing.T, app *fiber.App) (int, ReadinessResponse, time.Duration) {
+	t.Helper()
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil), -1)
+	took := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var readiness ReadinessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&readiness); err != nil {
+		t.Fatalf("decode readiness: %v", err)
+	}
+	return resp.StatusCode, readiness, took
+}
+
+// failedChecks returns the errors of the failed checks by name
+func failedChecks(readiness ReadinessResponse) map[string]string {
+	failed := map[string]string{}
+	for _, check := range readiness.Checks {
+		if !check.OK {
+			failed[check.Name] = check.Error
+		}
+	}
+	return failed
+}
+
+// newHealthApp serves the probes without any middleware
+func newHealthApp() *fiber.App {
+	app := fiber.New()
+	app.Get("/healthz", Healthz)
+	app.Get("/readyz", Readyz)
+	return app
+}
+
+func TestReadyzWithClosedDatabase(t *testing.T) {
+	setupTestDB(t)
+	app := newHealthApp()
+
+	status, readiness, _ := getReadiness(t, app)
+	if status != fiber.StatusOK || !readiness.Ready || len(readiness.Checks) != 3 || len(failedChecks(readiness)) != 0 {
+		t.Fatalf("readiness of an open database = %d %+v, want every check passing", status, readiness)
+	}
+
+	// Closing the read pool fails the checks that query it, the storage check still passes
+	if err := db.DB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	status, readiness, took := getReadiness(t, app)
+	failed := failedChecks(readiness)
+	if status != fiber.StatusServiceUnavailable || readiness.Ready || len(readiness.Checks) != 3 || len(failed) != 2 {
+		t.Errorf("readiness of a closed database = %d %+v, want 503 with database and migrations failing", status, readiness)
+	}
+	for _, name := range []string{"database", "migrations"} {
+		if !strings.Contains(failed[name], "closed") {
+			t.Errorf("%s check error = %q, want the closed database", name, failed[name])
+		}
+	}
+	if took >= time.Second {
+		t.Errorf("readiness took %v, want well under a second", took)
+	}
+
+	// The process is still serving
+	resp, err := app.Test(httptest.NewRequest("GET", "/healthz", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("GET /healthz with a closed database: %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestReadyzReportsPendingMigrations(t *testing.T) {
+	setupTestDB(t)
+	app := newHealthApp()
+	if _, err := db.DB.Exec("DELETE FROM schema_migrations WHERE id = (SELECT MAX(id) FROM schema_migrations)"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, readiness, _ := getReadiness(t, app)
+	failed := failedChecks(readiness)
+	if status != fiber.StatusServiceUnavailable || len(failed) != 1 || failed["migrations"] != "1 pending migrations" {
+		t.Errorf("readiness = %d %+v, want 503 with one pending migration", status, readiness)
+	}
+}
+
+func TestReadyzDuringRestore(t *testing.T) {
+	setupTestDB(t)
+	app := newHealthApp()
+	restoring.Store(true)
+	t.Cleanup(func() { restoring.Store(false) })
+
+	// The probe fails at once instead of waiting for the restore
+	status, readiness, took := getReadiness(t, app)
+	failed := failedChecks(readiness)
+	if status != fiber.StatusServiceUnavailable || failed["database"] != errRestoreInProgress.Error() || failed["migrations"] != errRestoreInProgress.Error() {
+		t.Errorf("readiness during a restore = %d %+v, want 503 naming the restore", status, readiness)
+	}
+	if took >= time.Second {
+		t.Errorf("readiness took %v, want well under a second", took)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// setupTestDB opens a fresh migrated database in a temp directory for the test
+func setupTestDB(t testing.TB) {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	db.Init()
+	t.Cleanup(db.Close)
+}
+
+// serveFrom runs a request through app as if it arrived on a connection from remoteIP
+// app.Test always reports 0.0.0.0 as the peer, this sets the socket address itself
+func serveFrom(t *testing.T, app *fiber.App, method, path, remoteIP string, headers map[string]string) int {
+	t.Helper()
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		t.Fatalf("invalid remote IP %q", remoteIP)
+	}
+	var req fasthttp.Request
+	req.Header.SetMethod(method)
+	req.SetRequestURI(path)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, &net.TCPAddr{IP: ip, Port: 40000}, nil)
+	app.Handler()(&ctx)
+	return ctx.Response.StatusCode()
+}
+
+// seedExportData fills the database with lists, templates and history whose names need quoting or escaping
+// in every export format: YAML keywords and numbers, colons, hashes, quotes, line breaks, emoji and accents
+func seedExportData(t *testing.T) {
+	t.Helper()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groceries, err := db.CreateList("Groceries", "🛒")
+	must(err)
+	dairy, err := db.CreateSectionForList(groceries.ID, "Dairy")
+	must(err)
+	produce, err := db.CreateSectionForList(groceries.ID, "Produce: local")
+	must(err)
+
+	milk, err := db.CreateItem(dairy.ID, "Milk", "2L", 2)
+	must(err)
+	price := int64(349)
+	_, err = db.SetItemPrice(milk.ID, &price, "EUR")
+	must(err)
+	_, err = db.SetItemDueDate(milk.ID, time.Now().AddDate(0, 0, 7).Format("2006-01-02"))
+	must(err)
+	_, err = db.ToggleItemCompleted(milk.ID)
+	must(err)
+	cheese, err := db.CreateItem(dairy.ID, "Gouda #1", `aged "extra", 12 months`, 1)
+	must(err)
+	_, err = db.ToggleItemUncertain(cheese.ID)
+	must(err)
+	_, err = db.CreateItem(produce.ID, "Äpfel 🍎 – 1 kg", "line one\nline two", 3)
+	must(err)
+	_, err = db.CreateItem(produce.ID, "true", "  leading and trailing  ", 1)
+	must(err)
+
+	hardware, err := db.CreateList("Hardware: store", "🔨")
+	must(err)
+	tools, err := db.CreateSectionForList(hardware.ID, "- Tools")
+	must(err)
+	_, err = db.CreateItem(tools.ID, "null", "", 1)
+	must(err)
+	_, err = db.CreateItem(tools.ID, "123", "key: value", 4)
+	must(err)
+
+	weekly, err := db.CreateTemplate("Weekly", "Every week: the basics")
+	must(err)
+	_, err = db.AddTemplateItem(weekly.ID, "Dairy", "Milk", "2L")
+	must(err)
+	_, err = db.AddTemplateItem(weekly.ID, "Bakery", "Bread: rye", "")
+	must(err)
+
+	must(db.SaveItemHistoryWithCount("Milk", dairy.ID, 5))
+	must(db.SaveItemHistoryWithCount("Äpfel 🍎", produce.ID, 2))
+}
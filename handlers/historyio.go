@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"shopping-list/db"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HistoryImportResult counts the history entries of a history import
+type HistoryImportResult struct {
+	Success bool `json:"success"`
+	Created int  `json:"created"` // Entries that were not in the history yet
+	Merged  int  `json:"merged"`  // Existing entries whose usage count was increased
+	Skipped int  `json:"skipped"`
+
+	Warnings     []ImportWarning `json:"warnings,omitempty"`
+	MoreWarnings int             `json:"more_warnings,omitempty"`
+}
+
+// ExportAllHistory exports the whole item history, as JSON with only the history or as CSV [HISTORY] rows
+// The files are laid out like full exports, so POST /import takes them as well
+func ExportAllHistory(c *fiber.Ctx) error {
+	format := c.Query("format", "json")
+	opts := csvQueryOptions(c, ExportOptions{})
+	comma := ','
+	switch format {
+	case "csv":
+		var appErr *AppError
+		if comma, appErr = parseDelimiter(opts.Delimiter); appErr != nil {
+			return Fail(c, appErr.Code, appErr.Message)
+		}
+	case "json":
+	default:
+		return Fail(c, ErrCodeValidation, "Format must be json or csv")
+	}
+
+	history, err := exportHistoryEntries(-1)
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to fetch history")
+	}
+
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"koffan-history-%s.%s\"", time.Now().Format("2006-01-02"), format))
+
+	if format == "csv" {
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+
+		writer, err := startCSVExport(c.Response().BodyWriter(), comma, opts)
+		if err != nil {
+			return err
+		}
+		writeHistoryCSVRows(writer, history)
+		writer.Flush()
+		return writer.Error()
+	}
+
+	c.Set("Content-Type", "application/json")
+	return c.JSON(ExportData{
+		Version:    ExportVersion,
+		AppVersion: AppVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		App:        "koffan",
+		Data: ExportBody{
+			Lists:   []ExportList{},
+			History: history,
+		},
+	})
+}
+
+// ImportHistory merges the history of a history export or a full JSON, YAML or CSV export into the history
+// Usage counts are added to those of existing entries, which only take the last section if they have none.
+// Lists and templates in the file are ignored
+func ImportHistory(c *fiber.Ctx) error {
+	end, err := BeginOperation(OperationImport)
+	var busy *OperationBusyError
+	if errors.As(err, &busy) {
+		return OperationConflict(c, busy)
+	}
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to start import")
+	}
+	defer func() { end(responseError(c)) }()
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return Fail(c, ErrCodeValidation, "No file provided")
+	}
+	if limit := MaxImportSize(); file.Size > limit {
+		return Fail(c, ErrCodeValidation, fmt.Sprintf("File too large (max %dMB)", limit>>20))
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return Fail(c, ErrCodeInternal, "Failed to open file")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return Fail(c, ErrCodeInternal, "Failed to read file")
+	}
+
+	history, rows, appErr := parseHistoryFile(data, file.Filename, c.FormValue("delimiter", ","), c.FormValue("encoding"))
+	if appErr != nil {
+		return Fail(c, appErr.Code, appErr.Message)
+	}
+
+	result, err := mergeHistory(history, rows, sectionLocalizer(RequestLang(c)))
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to import history")
+	}
+	return c.JSON(result)
+}
+
+// parseHistoryFile returns the history entries of a JSON, YAML or CSV file
+// For CSV files rows holds the row of each entry for warnings, it is nil for exports
+func parseHistoryFile(data []byte, filename, delimiter, encoding string) ([]ExportHistory, []int, *AppError) {
+	switch detectFormat(filename, data) {
+	case "json":
+		exportData, appErr := decodeJSON(data)
+		if appErr != nil {
+			return nil, nil, appErr
+		}
+		return exportData.Data.History, nil, nil
+	case "yaml":
+		exportData, appErr := decodeYAMLExport(data)
+		if appErr != nil {
+			return nil, nil, appErr
+		}
+		return exportData.Data.History, nil, nil
+	case "csv":
+	default:
+		return nil, nil, NewError(ErrCodeInvalidFile, "History imports take a JSON, YAML or CSV file")
+	}
+
+	comma, appErr := parseDelimiter(delimiter)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	encoding, appErr = parseEncoding(encoding)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	text, _, err := decodeCSV(bytes.NewReader(data), encoding)
+	if err != nil {
+		return nil, nil, NewError(ErrCodeInternal, "Failed to read file")
+	}
+
+	reader := csv.NewReader(text)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+
+	var history []ExportHistory
+	var rows []int
+	// The header is row 1, rows other than [HISTORY] rows are ignored
+	for rowNum := 1; ; rowNum++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, NewError(ErrCodeInvalidFile, "Invalid CSV format: "+err.Error())
+		}
+		if rowNum == 1 || column(row, 0) != "[HISTORY]" {
+			continue
+		}
+		usageCount, _ := strconv.Atoi(column(row, 4))
+		history = append(history, ExportHistory{Name: column(row, 2), LastSection: column(row, 3), UsageCount: usageCount})
+		rows = append(rows, rowNum)
+	}
+	return history, rows, nil
+}
+
+// mergeHistory merges history entries into the history in one transaction
+func mergeHistory(history []ExportHistory, rows []int, localize func(string) string) (*HistoryImportResult, error) {
+	tx, err := db.BeginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	writer := db.NewImportWriter(tx)
+
+	result := &HistoryImportResult{Success: true}
+	var warnings importWarnings
+	for i, h := range history {
+		row, path := 0, "history / "+warningPath(h.Name)
+		if rows != nil {
+			row, path = rows[i], ""
+		}
+
+		name := strings.TrimSpace(h.Name)
+		if name == "" {
+			warnings.add(ImportWarning{Row: row, Path: path, Field: "item_name", Reason: ImportWarningInvalidRow, Action: "skipped"})
+			result.Skipped++
+			continue
+		}
+		if !validText(name) || !validText(h.LastSection) {
+			warnings.add(ImportWarning{Row: row, Path: path, Field: "item_name", Reason: ImportWarningEncoding, Action: "skipped"})
+			result.Skipped++
+			continue
+		}
+		name = warnings.truncate(name, MaxItemNameLength, row, path, "item_name")
+
+		usageCount := h.UsageCount
+		if usageCount < 1 {
+			usageCount = 1
+		}
+		created, err := writer.MergeHistory(name, localize(strings.TrimSpace(h.LastSection)), usageCount)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Merged++
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	result.Warnings, result.MoreWarnings = warnings.list, warnings.more
+	return result, nil
+}
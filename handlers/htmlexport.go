@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"shopping-list/db"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// htmlExportTemplate is a self-contained page for printing, every list starts on a new page
+// Empty sections are left out like in Markdown exports
+var htmlExportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+@page { size: A4; margin: 1.5cm; }
+body { font-family: system-ui, -apple-system, "Segoe UI", Roboto, sans-serif; font-size: 12pt; color: #000; margin: 1.5cm; }
+@media print { body { margin: 0; } }
+.list + .list { break-before: page; }
+h1 { font-size: 20pt; margin: 0 0 0.4em; }
+h2 { font-size: 13pt; margin: 1em 0 0.3em; padding-bottom: 0.1em; border-bottom: 1px solid #999; break-after: avoid; }
+ul { list-style: none; margin: 0; padding: 0; }
+.columns-2 ul { columns: 2; column-gap: 1.5cm; }
+li { padding: 0.15em 0 0.15em 1.5em; text-indent: -1.5em; break-inside: avoid; }
+.box { display: inline-block; width: 1.5em; text-indent: 0; }
+.done .name { text-decoration: line-through; color: #666; }
+small { display: block; font-size: 9pt; color: #444; text-indent: 0; }
+</style>
+</head>
+<body class="columns-{{.Columns}}">
+{{- range .Lists}}
+<section class="list">
+<h1>{{if .Icon}}{{.Icon}} {{end}}{{.Name}}</h1>
+{{- range .Sections}}{{if .Items}}
+<h2>{{.Name}}</h2>
+<ul>
+{{- range .Items}}
+<li{{if .Completed}} class="done"{{end}}><span class="box">{{if .Completed}}☑{{else}}☐{{end}}</span><span class="name">{{.Name}}</span>{{if gt .Quantity 0}} ×{{.Quantity}}{{end}}{{if .Uncertain}} (?){{end}}{{with .Description}}<small>{{.}}</small>{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}{{end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// htmlExportPage is the data of htmlExportTemplate
+type htmlExportPage struct {
+	Title   string
+	Columns int
+	Lists   []ExportList
+}
+
+// parseExportColumns reads the columns of HTML exports, 1 (default) or 2
+func parseExportColumns(value string) (int, *AppError) {
+	switch value {
+	case "", "1":
+		return 1, nil
+	case "2":
+		return 2, nil
+	}
+	return 0, NewError(ErrCodeValidation, "columns must be 1 or 2")
+}
+
+// exportAllAsHTML writes every list as one printable page, each list on a new sheet
+func exportAllAsHTML(w io.Writer, lists []db.List, opts ExportOptions) error {
+	page := htmlExportPage{Title: "Koffan", Columns: opts.Columns, Lists: make([]ExportList, 0, len(lists))}
+	for _, list := range lists {
+		sections, err := exportSections(list.ID, opts)
+		if err != nil {
+			continue
+		}
+		page.Lists = append(page.Lists, toExportList(&list, sections))
+	}
+	return htmlExportTemplate.Execute(w, page)
+}
+
+// exportListAsHTML sends a list as a printable page, with inline=true shown instead of downloaded
+func exportListAsHTML(c *fiber.Ctx, list *db.List, sections []db.Section, columns int) error {
+	if c.Query("inline") != "true" {
+		filename := fmt.Sprintf("koffan-%s-%s.html", sanitizeFilename(list.Name), time.Now().Format("2006-01-02"))
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	}
+	c.Set("Content-Type", fiber.MIMETextHTMLCharsetUTF8)
+
+	title := list.Name
+	if list.Icon != "" {
+		title = list.Icon + " " + title
+	}
+	return htmlExportTemplate.Execute(c.Response().BodyWriter(), htmlExportPage{
+		Title:   title,
+		Columns: columns,
+		Lists:   []ExportList{toExportList(list, sections)},
+	})
+}
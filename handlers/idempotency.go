@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"shopping-list/db"
+	"shopping-list/settings"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// HeaderIdempotencyKey makes a retried POST replay the first response instead of running again
+	HeaderIdempotencyKey = "Idempotency-Key"
+
+	// HeaderIdempotentReplayed is set on responses replayed from storage
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	settingIdempotencyTTLHours = "idempotency_ttl_hours"
+
+	maxIdempotencyKeyLength = 255
+
+	// idempotencyPendingTimeout is how long a key stays claimed by a request that never finished, e.g. after a crash
+	idempotencyPendingTimeout = 5 * time.Minute
+)
+
+// IdempotencyTTL returns how long responses are kept for replay
+func IdempotencyTTL() time.Duration {
+	return time.Duration(settings.Int(settingIdempotencyTTLHours)) * time.Hour
+}
+
+// Idempotent returns middleware honoring the Idempotency-Key header
+// The first request with a key runs and its response is stored; an exact retry gets the stored response,
+// a retry with a different body gets 422 and a retry while the first is still running gets 409.
+// scope names the caller, so keys of different tokens or sessions never collide.
+// Transient failures are not stored, the key is released so the request can be retried
+func Idempotent(scope func(*fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return Fail(c, ErrCodeInvalidIdempotencyKey,
+				fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+		}
+
+		owner := scope(c)
+		hash := requestFingerprint(c)
+		now := time.Now()
+		stored, err := db.ClaimIdempotencyKey(owner, key, hash,
+			now.Add(-IdempotencyTTL()).Unix(), now.Add(-idempotencyPendingTimeout).Unix())
+		if err != nil {
+			log.Printf("[IDEMPOTENCY] Failed to claim key: %v", err)
+			return Fail(c, ErrCodeDB, "Database error")
+		}
+
+		if stored != nil {
+			switch {
+			case stored.RequestHash != hash:
+				return Fail(c, ErrCodeIdempotencyMismatch,
+					"Idempotency-Key was already used with a different request")
+			case stored.Pending():
+				return Fail(c, ErrCodeIdempotencyInProgress,
+					"A request with this Idempotency-Key is still being processed")
+			}
+			c.Set(HeaderIdempotentReplayed, "true")
+			if stored.ContentType != "" {
+				c.Set(fiber.HeaderContentType, stored.ContentType)
+			}
+			return c.Status(stored.Status).Send(stored.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			releaseIdempotencyKey(owner, key)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if !replayableStatus(status) {
+			releaseIdempotencyKey(owner, key)
+			return nil
+		}
+		body := append([]byte(nil), c.Response().Body()...)
+		contentType := string(c.Response().Header.ContentType())
+		if err := db.CompleteIdempotencyKey(owner, key, status, contentType, body); err != nil {
+			log.Printf("[IDEMPOTENCY] Failed to store response: %v", err)
+			releaseIdempotencyKey(owner, key)
+		}
+		return nil
+	}
+}
+
+// replayableStatus returns false for server errors and conflicts, which a retry may not hit again
+func replayableStatus(status int) bool {
+	return status < fiber.StatusInternalServerError &&
+		status != fiber.StatusConflict && status != fiber.StatusTooManyRequests
+}
+
+// SessionIdempotencyScope scopes UI keys to the login session
+func SessionIdempotencyScope(c *fiber.Ctx) string {
+	if session := c.Cookies(SessionCookieName); session != "" {
+		return "session:" + db.HashToken(session)
+	}
+	return "ui"
+}
+
+func releaseIdempotencyKey(scope, key string) {
+	if err := db.ReleaseIdempotencyKey(scope, key); err != nil {
+		log.Printf("[IDEMPOTENCY] Failed to release key: %v", err)
+	}
+}
+
+// requestFingerprint hashes the method, path and body of a request
+// Multipart bodies are hashed by their fields and file contents, since clients pick a new boundary on every attempt
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	io.WriteString(h, c.Method()+" "+c.Path()+"\n")
+
+	if !strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		h.Write(c.Body())
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		h.Write(c.Body())
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	for _, name := range sortedKeys(form.Value) {
+		for _, v := range form.Value[name] {
+			fmt.Fprintf(h, "value %q %q\n", name, v)
+		}
+	}
+	for _, name := range sortedKeys(form.File) {
+		for _, fh := range form.File[name] {
+			fmt.Fprintf(h, "file %q %q %d\n", name, fh.Filename, fh.Size)
+			if f, err := fh.Open(); err == nil {
+				io.Copy(h, f)
+				f.Close()
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
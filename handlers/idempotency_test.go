@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotencyApp counts the requests that reach its handler behind the Idempotent middleware
+// The X-Scope header names the caller, ?status= sets the status the handler answers with
+// and ?block=1 holds the handler until release is closed
+type idempotencyApp struct {
+	*fiber.App
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newIdempotencyApp(t *testing.T) *idempotencyApp {
+	t.Helper()
+	setupTestDB(t)
+	a := &idempotencyApp{started: make(chan struct{}, 1), release: make(chan struct{})}
+	a.App = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	scope := func(c *fiber.Ctx) string { return c.Get("X-Scope") }
+	a.Post("/things", Idempotent(scope), func(c *fiber.Ctx) error {
+		call := a.calls.Add(1)
+		if c.Query("block") != "" {
+			a.started <- struct{}{}
+			<-a.release
+		}
+		return c.Status(c.QueryInt("status", fiber.StatusCreated)).JSON(fiber.Map{"call": call, "body": string(c.Body())})
+	})
+	return a
+}
+
+// send posts body to path with the Idempotency-Key key and returns the status, the body and the replay header
+func (a *idempotencyApp) send(t *testing.T, path, scope, key, contentType string, body []byte) (int, string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Scope", scope)
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), resp.Header.Get(HeaderIdempotentReplayed)
+}
+
+// errorCodeOf returns the code of an ErrorResponse body
+func errorCodeOf(t *testing.T, body string) string {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("decode error response %q: %v", body, err)
+	}
+	return resp.Error
+}
+
+func TestIdempotentReplaysRetries(t *testing.T) {
+	app := newIdempotencyApp(t)
+	send := func(scope, key, body string) (int, string, string) {
+		t.Helper()
+		return app.send(t, "/things", scope, key, fiber.MIMEApplicationJSON, []byte(body))
+	}
+
+	status, first, replayed := send("alice", "key-1", `{"name":"Milk"}`)
+	if status != fiber.StatusCreated || replayed != "" {
+		t.Fatalf("first request: %d %s, replayed %q", status, first, replayed)
+	}
+
+	// An exact retry replays the stored response without running the handler
+	status, retry, replayed := send("alice", "key-1", `{"name":"Milk"}`)
+	if status != fiber.StatusCreated || retry != first || replayed != "true" {
+		t.Errorf("retry: %d %s, replayed %q, want the first response replayed", status, retry, replayed)
+	}
+
+	// The same key with another body is a client bug, not a retry
+	status, body, _ := send("alice", "key-1", `{"name":"Bread"}`)
+	if status != fiber.StatusUnprocessableEntity || errorCodeOf(t, body) != ErrCodeIdempotencyMismatch {
+		t.Errorf("changed body: %d %s, want 422 %s", status, body, ErrCodeIdempotencyMismatch)
+	}
+	// Keys belong to their scope, another caller's key-1 is a new request
+	if status, body, replayed := send("bob", "key-1", `{"name":"Milk"}`); status != fiber.StatusCreated || body == first || replayed != "" {
+		t.Errorf("same key in another scope: %d %s, replayed %q, want a new request", status, body, replayed)
+	}
+
+	// Requests without a key always run
+	send("alice", "", `{"name":"Milk"}`)
+	send("alice", "", `{"name":"Milk"}`)
+	if calls := app.calls.Load(); calls != 4 {
+		t.Errorf("handler ran %d times, want 4", calls)
+	}
+
+	status, body, _ = send("alice", strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`)
+	if status != fiber.StatusBadRequest || errorCodeOf(t, body) != ErrCodeInvalidIdempotencyKey {
+		t.Errorf("long key: %d %s, want 400 %s", status, body, ErrCodeInvalidIdempotencyKey)
+	}
+}
+
+func TestIdempotentStoresOnlyFinalResponses(t *testing.T) {
+	app := newIdempotencyApp(t)
+	body := []byte(`{"name":"Milk"}`)
+
+	// Server errors, conflicts and rate limits release the key, the retry runs the handler again
+	for i, status := range []int{fiber.StatusInternalServerError, fiber.StatusServiceUnavailable, fiber.StatusConflict, fiber.StatusTooManyRequests} {
+		path := "/things?status=" + strconv.Itoa(status)
+		if got, resp, _ := app.send(t, path, "alice", "key-1", fiber.MIMEApplicationJSON, body); got != status {
+			t.Fatalf("attempt %d: %d %s, want %d", i+1, got, resp, status)
+		}
+		if calls := app.calls.Load(); calls != int32(i+1) {
+			t.Fatalf("attempt %d with a released key ran the handler %d times", i+1, calls)
+		}
+	}
+
+	// A client error is final and replayed like a success
+	status, first, _ := app.send(t, "/things?status=400", "alice", "key-1", fiber.MIMEApplicationJSON, body)
+	status2, retry, replayed := app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, body)
+	if status != fiber.StatusBadRequest || status2 != fiber.StatusBadRequest || retry != first || replayed != "true" {
+		t.Errorf("retry of a 400: %d %s, replayed %q, want the 400 replayed", status2, retry, replayed)
+	}
+	if calls := app.calls.Load(); calls != 5 {
+		t.Errorf("handler ran %d times, want 5", calls)
+	}
+}
+
+func TestIdempotentConcurrentRetry(t *testing.T) {
+	app := newIdempotencyApp(t)
+	body := []byte(`{"name":"Milk"}`)
+
+	type result struct {
+		status int
+		body   string
+	}
+	done := make(chan result)
+	go func() {
+		status, body, _ := app.send(t, "/things?block=1", "alice", "key-1", fiber.MIMEApplicationJSON, body)
+		done <- result{status, body}
+	}()
+	select {
+	case <-app.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first request never reached the handler")
+	}
+
+	// A retry while the first request still runs is told to come back, not run twice
+	status, resp, _ := app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, body)
+	if status != fiber.StatusConflict || errorCodeOf(t, resp) != ErrCodeIdempotencyInProgress {
+		t.Errorf("concurrent retry: %d %s, want 409 %s", status, resp, ErrCodeIdempotencyInProgress)
+	}
+	// A different body under the running key is still a mismatch
+	status, resp, _ = app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, []byte(`{"name":"Bread"}`))
+	if status != fiber.StatusUnprocessableEntity {
+		t.Errorf("concurrent changed body: %d %s, want 422", status, resp)
+	}
+
+	close(app.release)
+	first := <-done
+	if first.status != fiber.StatusCreated {
+		t.Fatalf("first request: %d %s", first.status, first.body)
+	}
+	status, resp, replayed := app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, body)
+	if status != fiber.StatusCreated || resp != first.body || replayed != "true" {
+		t.Errorf("retry after the first finished: %d %s, replayed %q, want the replay", status, resp, replayed)
+	}
+	if calls := app.calls.Load(); calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotentReclaimsStaleKeys(t *testing.T) {
+	app := newIdempotencyApp(t)
+	body := []byte(`{"name":"Milk"}`)
+
+	if status, resp, _ := app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, body); status != fiber.StatusCreated {
+		t.Fatalf("first request: %d %s", status, resp)
+	}
+
+	// A key left pending by a request that never finished, as after a crash, holds retries off until it goes stale
+	if _, err := db.DB.Exec("UPDATE idempotency_keys SET status = 0, body = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if status, resp, _ := app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, body); status != fiber.StatusConflict {
+		t.Errorf("retry against a fresh pending key: %d %s, want 409", status, resp)
+	}
+	stale := time.Now().Add(-idempotencyPendingTimeout - time.Minute).Unix()
+	if _, err := db.DB.Exec("UPDATE idempotency_keys SET created_at = ?", stale); err != nil {
+		t.Fatal(err)
+	}
+	if status, resp, replayed := app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, body); status != fiber.StatusCreated || replayed != "" {
+		t.Errorf("retry against a stale pending key: %d %s, replayed %q, want a new request", status, resp, replayed)
+	}
+
+	// A stored response expires with the TTL
+	expired := time.Now().Add(-IdempotencyTTL() - time.Minute).Unix()
+	if _, err := db.DB.Exec("UPDATE idempotency_keys SET created_at = ?", expired); err != nil {
+		t.Fatal(err)
+	}
+	if status, resp, replayed := app.send(t, "/things", "alice", "key-1", fiber.MIMEApplicationJSON, body); status != fiber.StatusCreated || replayed != "" {
+		t.Errorf("retry after the TTL: %d %s, replayed %q, want a new request", status, resp, replayed)
+	}
+	if calls := app.calls.Load(); calls != 3 {
+		t.Errorf("handler ran %d times, want 3", calls)
+	}
+}
+
+func TestIdempotentMultipartFingerprint(t *testing.T) {
+	app := newIdempotencyApp(t)
+	upload := func(boundary, content string) (string, []byte) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		if err := w.SetBoundary(boundary); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteField("conflict", "skip")
+		part, _ := w.CreateFormFile("file", "export.json")
+		part.Write([]byte(content))
+		w.Close()
+		return w.FormDataContentType(), buf.Bytes()
+	}
+
+	contentType, body := upload("first-boundary", `{"lists":[]}`)
+	status, first, _ := app.send(t, "/things", "alice", "key-1", contentType, body)
+	if status != fiber.StatusCreated {
+		t.Fatalf("first upload: %d %s", status, first)
+	}
+
+	// Clients pick a new boundary for every attempt, the same fields and file are still the same request
+	contentType, body = upload("second-boundary", `{"lists":[]}`)
+	if status, resp, replayed := app.send(t, "/things", "alice", "key-1", contentType, body); status != fiber.StatusCreated || resp != first || replayed != "true" {
+		t.Errorf("retry with a new boundary: %d %s, replayed %q, want the replay", status, resp, replayed)
+	}
+	contentType, body = upload("third-boundary", `{"lists":[{}]}`)
+	if status, resp, _ := app.send(t, "/things", "alice", "key-1", contentType, body); status != fiber.StatusUnprocessableEntity {
+		t.Errorf("retry with another file: %d %s, want 422", status, resp)
+	}
+	if calls := app.calls.Load(); calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
@@ -1,32 +1,55 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"shopping-list/db"
 	"shopping-list/i18n"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 const (
-	MaxImportFileSize = 5 * 1024 * 1024 // 5MB
+	MaxImportFileSize   = 5 * 1024 * 1024 // 5MB, the limit of previews, see MaxImportSize for imports
+	MaxCopySuffixLength = 30              // Leaves room for the name in copies, see findUniqueName
 )
 
+// importColumns is the column layout of CSV and XLSX imports
+// Quantity, section_sort_order, item_sort_order, item_created_at and item_completed_at columns may follow,
+// as exports write them
+const importColumns = "list_name, list_icon, section_name, item_name, item_description, item_completed, item_uncertain"
+
 // ImportPreviewResponse represents the preview of data to be imported
 type ImportPreviewResponse struct {
 	Valid            bool             `json:"valid"`
-	Error            string           `json:"error,omitempty"`
+	Code             string           `json:"code,omitempty"`  // error code when the file is invalid
+	Error            string           `json:"error,omitempty"` // message when the file is invalid
 	Format           string           `json:"format"`
+	Encoding         string           `json:"encoding,omitempty"` // Detected or given encoding of CSV files
 	ListsCount       int              `json:"lists_count"`
 	ItemsCount       int              `json:"items_count"`
 	TemplatesCount   int              `json:"templates_count"`
 	HistoryCount     int              `json:"history_count"`
 	Lists            []ImportListInfo `json:"lists"`
 	ConflictingLists []string         `json:"conflicting_lists,omitempty"`
+
+	// Warnings an import of a CSV or XLSX file would return, strict imports are rejected when there are any
+	Warnings     []ImportWarning `json:"warnings,omitempty"`
+	MoreWarnings int             `json:"more_warnings,omitempty"`
+
+	// Items named alike within a section of the file, which dedupe_items collapses into one
+	Duplicates             []ImportDuplicate `json:"duplicates,omitempty"`
+	ItemsCountDeduplicated int               `json:"items_count_deduplicated"` // items_count with dedupe_items
 }
 
 // ImportListInfo contains info about a list to be imported
@@ -40,57 +63,66 @@ type ImportListInfo struct {
 
 // ImportRequest contains import options
 type ImportRequest struct {
-	ConflictResolution string `json:"conflict_resolution"` // "skip", "replace", "copy"
+	ConflictResolution  string            `json:"conflict_resolution"`            // "skip", "replace", "copy", "merge"
+	ConflictResolutions map[string]string `json:"conflict_resolutions,omitempty"` // List name -> resolution, overrides ConflictResolution
 }
 
 // PreviewImport validates and returns a preview of the import data
 func PreviewImport(c *fiber.Ctx) error {
 	file, err := c.FormFile("file")
 	if err != nil {
-		return c.Status(400).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "No file provided",
-		})
+		return previewError(c, ErrCodeValidation, "No file provided")
 	}
 
 	if file.Size > MaxImportFileSize {
-		return c.Status(400).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "File too large (max 5MB)",
-		})
+		return previewError(c, ErrCodeValidation, "File too large (max 5MB)")
 	}
 
 	f, err := file.Open()
 	if err != nil {
-		return c.Status(500).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "Failed to open file",
-		})
+		return previewError(c, ErrCodeInternal, "Failed to open file")
 	}
 	defer f.Close()
 
 	data, err := io.ReadAll(f)
 	if err != nil {
-		return c.Status(500).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "Failed to read file",
-		})
+		return previewError(c, ErrCodeInternal, "Failed to read file")
+	}
+
+	mapping, appErr := parseColumnMapping(c.FormValue("column_mapping"))
+	if appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
 	}
 
-	// Detect format
-	format := detectFormat(file.Filename, data)
+	return previewData(c, data, ImportOptions{
+		Filename:      file.Filename,
+		Delimiter:     c.Query("delimiter", ","),
+		ColumnMapping: mapping,
+		Encoding:      c.FormValue("encoding"),
+		Strict:        c.FormValue("strict") == "true",
+	})
+}
 
-	if format == "json" {
+// previewData previews the contents of an upload or a fetched URL, detecting the format
+// Only the file options are used: Filename, Delimiter, ColumnMapping, Encoding and Strict
+func previewData(c *fiber.Ctx, data []byte, opts ImportOptions) error {
+	switch detectFormat(opts.Filename, data) {
+	case "json":
 		return previewJSONImport(c, data)
-	} else if format == "csv" {
-		delimiter := c.Query("delimiter", ",")
-		return previewCSVImport(c, data, delimiter)
+	case "csv":
+		return previewCSVImport(c, data, opts)
+	case "xlsx":
+		return previewXLSXImport(c, data, opts)
+	case "yaml":
+		return previewYAMLImport(c, data)
 	}
 
-	return c.Status(400).JSON(ImportPreviewResponse{
-		Valid: false,
-		Error: "Unsupported file format. Use JSON or CSV.",
-	})
+	return previewError(c, ErrCodeInvalidFile, "Unsupported file format. Use JSON, YAML, CSV or XLSX.")
+}
+
+// previewError sends an invalid preview, keeping the preview shape with the code of the error envelope
+func previewError(c *fiber.Ctx, code, message string) error {
+	return c.Status(StatusForCode(code)).JSON(ImportPreviewResponse{Valid: false, Code: code, Error: message})
 }
 
 func detectFormat(filename string, data []byte) string {
@@ -100,31 +132,86 @@ func detectFormat(filename string, data []byte) string {
 	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
 		return "csv"
 	}
+	if strings.HasSuffix(strings.ToLower(filename), ".xlsx") {
+		return "xlsx"
+	}
+	if strings.HasSuffix(strings.ToLower(filename), ".yaml") || strings.HasSuffix(strings.ToLower(filename), ".yml") {
+		return "yaml"
+	}
 
-	// Try to detect by content
+	// Try to detect by content, XLSX files are ZIP archives
+	if bytes.HasPrefix(data, zipMagic) {
+		return "xlsx"
+	}
 	trimmed := strings.TrimSpace(string(data))
 	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
 		return "json"
 	}
+	// YAML exports start with their version key, possibly after a document marker
+	if strings.HasPrefix(strings.TrimPrefix(trimmed, "---\n"), "version:") {
+		return "yaml"
+	}
 
 	return "csv"
 }
 
 func previewJSONImport(c *fiber.Ctx, data []byte) error {
-	exportData, err := decodeJSON(data)
-	if err != nil {
-		return c.Status(400).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "Invalid JSON format: " + err.Error(),
-		})
+	exportData, appErr := decodeJSON(data)
+	if appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
 	}
+	return previewExport(c, "json", exportData)
+}
 
-	// Validate structure
+func previewYAMLImport(c *fiber.Ctx, data []byte) error {
+	exportData, appErr := decodeYAMLExport(data)
+	if appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
+	}
+	return previewExport(c, "yaml", exportData)
+}
+
+// validateExport checks that an export comes from Koffan and that its names fit the length limits
+func validateExport(exportData *ExportData, lang string) *AppError {
 	if exportData.App != "koffan" && exportData.App != "" {
-		return c.Status(400).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "This file was not exported from Koffan",
-		})
+		return NewError(ErrCodeInvalidFile, "This file was not exported from Koffan")
+	}
+
+	for _, list := range exportData.Data.Lists {
+		// Validate list name length
+		if TextLength(list.Name) > MaxListNameLength {
+			return NewError(ErrCodeValidation, i18n.GetF(lang, "import.error_list_too_long", map[string]any{"name": list.Name}))
+		}
+
+		// Validate reserved names [HISTORY] and [TEMPLATE]
+		if list.Name == "[HISTORY]" || list.Name == "[TEMPLATE]" {
+			return NewError(ErrCodeValidation, i18n.Get(lang, "common.reserved_name"))
+		}
+
+		for _, section := range list.Sections {
+			// Validate section name length
+			if TextLength(section.Name) > MaxSectionNameLength {
+				return NewError(ErrCodeValidation, i18n.GetF(lang, "import.error_section_too_long", map[string]any{"list": list.Name, "name": section.Name}))
+			}
+
+			for _, item := range section.Items {
+				// Validate item name and description length
+				if TextLength(item.Name) > MaxItemNameLength {
+					return NewError(ErrCodeValidation, i18n.GetF(lang, "import.error_item_too_long", map[string]any{"list": list.Name, "name": item.Name}))
+				}
+				if TextLength(item.Description) > MaxDescriptionLength {
+					return NewError(ErrCodeValidation, i18n.GetF(lang, "import.error_description_too_long", map[string]any{"list": list.Name, "name": item.Name}))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// previewExport previews a decoded JSON or YAML export
+func previewExport(c *fiber.Ctx, format string, exportData *ExportData) error {
+	if appErr := validateExport(exportData, RequestLang(c)); appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
 	}
 
 	// Get existing lists for conflict detection
@@ -136,7 +223,7 @@ func previewJSONImport(c *fiber.Ctx, data []byte) error {
 
 	preview := ImportPreviewResponse{
 		Valid:            true,
-		Format:           "json",
+		Format:           format,
 		ListsCount:       len(exportData.Data.Lists),
 		TemplatesCount:   len(exportData.Data.Templates),
 		HistoryCount:     len(exportData.Data.History),
@@ -144,49 +231,15 @@ func previewJSONImport(c *fiber.Ctx, data []byte) error {
 		ConflictingLists: make([]string, 0),
 	}
 
+	duplicates := newDuplicateCounter()
+	localize := sectionLocalizer(RequestLang(c))
 	for _, list := range exportData.Data.Lists {
-		// Validate list name length
-		if len(list.Name) > MaxListNameLength {
-			return c.Status(400).JSON(ImportPreviewResponse{
-				Valid: false,
-				Error: "List name too long: " + list.Name,
-			})
-		}
-
-		// Validate reserved name [HISTORY]
-		if list.Name == "[HISTORY]" {
-			return c.Status(400).JSON(ImportPreviewResponse{
-				Valid: false,
-				Error: i18n.Get(i18n.GetDefaultLang(), "common.reserved_name"),
-			})
-		}
-
 		itemCount := 0
 		for _, section := range list.Sections {
-			// Validate section name length
-			if len(section.Name) > MaxSectionNameLength {
-				return c.Status(400).JSON(ImportPreviewResponse{
-					Valid: false,
-					Error: fmt.Sprintf("Section name too long in list '%s': %s", list.Name, section.Name),
-				})
-			}
-
+			itemCount += len(section.Items)
 			for _, item := range section.Items {
-				// Validate item name and description length
-				if len(item.Name) > MaxItemNameLength {
-					return c.Status(400).JSON(ImportPreviewResponse{
-						Valid: false,
-						Error: fmt.Sprintf("Item name too long in list '%s': %s", list.Name, item.Name),
-					})
-				}
-				if len(item.Description) > MaxDescriptionLength {
-					return c.Status(400).JSON(ImportPreviewResponse{
-						Valid: false,
-						Error: fmt.Sprintf("Item description too long in list '%s', item '%s'", list.Name, item.Name),
-					})
-				}
+				duplicates.add(list.Name, localize(section.Name), item.Name)
 			}
-			itemCount += len(section.Items)
 		}
 
 		hasConflict := existingNames[strings.ToLower(list.Name)]
@@ -203,46 +256,59 @@ func previewJSONImport(c *fiber.Ctx, data []byte) error {
 		})
 		preview.ItemsCount += itemCount
 	}
+	duplicates.setPreview(&preview)
 
 	return c.JSON(preview)
 }
 
-func previewCSVImport(c *fiber.Ctx, data []byte, delimiter string) error {
-	// Remove BOM if present
-	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
-		data = data[3:]
+func previewCSVImport(c *fiber.Ctx, data []byte, opts ImportOptions) error {
+	comma, appErr := parseDelimiter(opts.Delimiter)
+	if appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
+	}
+	encoding, appErr := parseEncoding(opts.Encoding)
+	if appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
 	}
 
-	reader := csv.NewReader(strings.NewReader(string(data)))
-	// Set delimiter
-	if len(delimiter) > 0 {
-		reader.Comma = rune(delimiter[0])
+	text, encoding, err := decodeCSV(bytes.NewReader(data), encoding)
+	if err != nil {
+		return previewError(c, ErrCodeInternal, "Failed to read file")
 	}
 
+	reader := csv.NewReader(text)
+	reader.Comma = comma
+	// Short rows are reported per row instead of failing the file
+	reader.FieldsPerRecord = -1
+
 	records, err := reader.ReadAll()
 	if err != nil {
-		return c.Status(400).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "Invalid CSV format: " + err.Error(),
-		})
+		return previewError(c, ErrCodeInvalidFile, "Invalid CSV format: "+err.Error())
 	}
 
 	if len(records) < 2 {
-		return c.Status(400).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "CSV file is empty or has no data rows",
-		})
+		return previewError(c, ErrCodeInvalidFile, "CSV file is empty or has no data rows")
+	}
+
+	// A mapping, or a header naming the columns in another order, rearranges the rows into the import columns
+	if records, appErr = opts.ColumnMapping.mapRecords(records, opts.Filename); appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
 	}
 
 	// Validate header
 	header := records[0]
 	if len(header) < 7 {
-		return c.Status(400).JSON(ImportPreviewResponse{
-			Valid: false,
-			Error: "Invalid CSV header. Expected: list_name, list_icon, section_name, item_name, item_description, item_completed, item_uncertain",
-		})
+		return previewError(c, ErrCodeInvalidFile, "Invalid CSV header. Expected: "+importColumns)
 	}
 
+	return previewRows(c, "csv", encoding, records, opts)
+}
+
+// previewRows previews the rows of a CSV or XLSX file, the first row is the header
+// encoding is reported for CSV files and empty for XLSX. Rows are checked like an import checks them,
+// so the preview has the same warnings
+func previewRows(c *fiber.Ctx, format, encoding string, records [][]string, opts ImportOptions) error {
+
 	// Get existing lists for conflict detection
 	existingLists, _ := db.GetAllLists()
 	existingNames := make(map[string]bool)
@@ -252,19 +318,27 @@ func previewCSVImport(c *fiber.Ctx, data []byte, delimiter string) error {
 
 	// Parse CSV to count lists and items
 	listsMap := make(map[string]*ImportListInfo)
+	listSections := make(map[string]map[string]bool) // list key -> lowercased section names, as the import merges them
 	conflicting := make(map[string]bool)
 	historyCount := 0
+	templateNames := make(map[string]bool)
+	duplicates := newDuplicateCounter()
+	localize := sectionLocalizer(RequestLang(c))
+	defaultSectionName := DefaultSection(RequestLang(c))
+	var warnings importWarnings
 
 	for i, row := range records[1:] {
+		rowNum := i + 2
 		if len(row) < 4 {
-			return c.Status(400).JSON(ImportPreviewResponse{
-				Valid: false,
-				Error: "Invalid row " + strconv.Itoa(i+2) + ": not enough columns",
-			})
+			warnings.add(ImportWarning{Row: rowNum, Reason: ImportWarningInvalidRow, Action: "skipped"})
+			continue
 		}
 
 		listName := strings.TrimSpace(row[0])
 		if listName == "" {
+			if strings.TrimSpace(strings.Join(row, "")) != "" {
+				warnings.add(ImportWarning{Row: rowNum, Field: "list_name", Reason: ImportWarningInvalidRow, Action: "skipped"})
+			}
 			continue
 		}
 
@@ -274,62 +348,54 @@ func previewCSVImport(c *fiber.Ctx, data []byte, delimiter string) error {
 			continue
 		}
 
-		if len(listName) > MaxListNameLength {
-			return c.Status(400).JSON(ImportPreviewResponse{
-				Valid: false,
-				Error: "List name too long in row " + strconv.Itoa(i+2),
-			})
-		}
-
-		// Validate item name length
-		itemName := strings.TrimSpace(row[3])
-		if len(itemName) > MaxItemNameLength {
-			return c.Status(400).JSON(ImportPreviewResponse{
-				Valid: false,
-				Error: fmt.Sprintf("Item name too long in row %d: %s", i+2, itemName),
-			})
+		// Templates are counted once however many items they have
+		if listName == "[TEMPLATE]" {
+			if name := strings.TrimSpace(row[1]); name != "" {
+				templateNames[strings.ToLower(name)] = true
+			}
+			continue
 		}
 
-		// Validate description length if present
-		if len(row) > 4 {
-			description := strings.TrimSpace(row[4])
-			if len(description) > MaxDescriptionLength {
-				return c.Status(400).JSON(ImportPreviewResponse{
-					Valid: false,
-					Error: fmt.Sprintf("Item description too long in row %d", i+2),
-				})
-			}
+		parsed, ok := parseImportRow(row, rowNum, &warnings, defaultSectionName, localize)
+		if !ok {
+			continue
 		}
 
-		key := strings.ToLower(listName)
+		key := strings.ToLower(parsed.listName)
 		if _, exists := listsMap[key]; !exists {
-			icon := "🛒"
-			if len(row) > 1 && row[1] != "" {
-				icon = row[1]
-			}
 			hasConflict := existingNames[key]
 			if hasConflict {
-				conflicting[listName] = true
+				conflicting[parsed.listName] = true
 			}
 			listsMap[key] = &ImportListInfo{
-				Name:        listName,
-				Icon:        icon,
+				Name:        parsed.listName,
+				Icon:        parsed.listIcon,
 				Sections:    0,
 				Items:       0,
 				HasConflict: hasConflict,
 			}
+			listSections[key] = make(map[string]bool)
+		}
+		if sectionKey := strings.ToLower(parsed.sectionName); !listSections[key][sectionKey] {
+			listSections[key][sectionKey] = true
+			listsMap[key].Sections++
 		}
 		listsMap[key].Items++
+		duplicates.add(listsMap[key].Name, parsed.sectionName, parsed.itemName)
 	}
 
 	preview := ImportPreviewResponse{
 		Valid:            true,
-		Format:           "csv",
+		Format:           format,
+		Encoding:         encoding,
 		ListsCount:       len(listsMap),
 		ItemsCount:       0,
+		TemplatesCount:   len(templateNames),
 		HistoryCount:     historyCount,
 		Lists:            make([]ImportListInfo, 0, len(listsMap)),
 		ConflictingLists: make([]string, 0),
+		Warnings:         warnings.list,
+		MoreWarnings:     warnings.more,
 	}
 
 	for name := range conflicting {
@@ -340,64 +406,319 @@ func previewCSVImport(c *fiber.Ctx, data []byte, delimiter string) error {
 		preview.Lists = append(preview.Lists, *info)
 		preview.ItemsCount += info.Items
 	}
+	duplicates.setPreview(&preview)
+
+	// A strict import would be rejected
+	if opts.Strict && len(warnings.list) > 0 {
+		appErr := warnings.rejected()
+		preview.Valid, preview.Code, preview.Error = false, appErr.Code, appErr.Message
+	}
 
 	return c.JSON(preview)
 }
 
+// ImportOptions controls how an import treats existing lists
+type ImportOptions struct {
+	Filename            string            // Used with the content to detect the format
+	ConflictResolution  string            // skip (default), replace, copy or merge
+	ConflictResolutions map[string]string // List name -> resolution overriding ConflictResolution, names match case-insensitively
+	CopySuffix          string            // Suffix of renamed lists with copy, defaults to "copy"
+	Delimiter           string            // CSV field separator, see parseDelimiter
+	ColumnMapping       ColumnMapping     // Columns of CSV and XLSX files from other apps, nil for the import column layout
+	Encoding            string            // Encoding of CSV files, see parseEncoding, detected when empty
+	Lang                string            // Language of default section names and the summary
+	DedupeItems         bool              // Collapse items named alike within a section into the first, OR-ing their flags
+	Strict              bool              // Reject the whole import when it has warnings, it is then committed at once
+	ImportID            string            // Broadcast import_progress and import_finished events with this ID, see runImport
+	TotalRows           int               // Expected rows reported in import_progress, 0 when unknown
+}
+
+// validConflictResolution reports whether resolution is skip, replace, copy or merge
+// merge adds new sections and items to the existing list and updates the flags of items it already has
+func validConflictResolution(resolution string) bool {
+	return resolution == "skip" || resolution == "replace" || resolution == "copy" || resolution == "merge"
+}
+
+// conflictResolution returns how an existing list named name is treated
+func (o ImportOptions) conflictResolution(name string) string {
+	if resolution, ok := o.ConflictResolutions[strings.ToLower(name)]; ok {
+		return resolution
+	}
+	return o.ConflictResolution
+}
+
+// ImportResult counts what an import created
+type ImportResult struct {
+	Success           bool   `json:"success"`
+	ImportedLists     int    `json:"imported_lists"`
+	ImportedItems     int    `json:"imported_items"`
+	ImportedTemplates int    `json:"imported_templates"`
+	ImportedHistory   int    `json:"imported_history"`
+	SkippedLists      int    `json:"skipped_lists"`
+	MergedLists       int    `json:"merged_lists"`            // Existing lists imported into with merge
+	MergedItems       int    `json:"merged_items"`            // Existing items whose flags were updated by merge
+	DedupedItems      int    `json:"deduped_items,omitempty"` // Duplicate items collapsed by DedupeItems
+	Message           string `json:"message"`
+	ImportID          string `json:"import_id,omitempty"` // ID of the import's events
+
+	Warnings     []ImportWarning `json:"warnings,omitempty"`
+	MoreWarnings int             `json:"more_warnings,omitempty"` // Warnings left out after MaxImportWarnings
+}
+
+// MaxImportWarnings caps the warnings of an import result, so a broken file cannot blow up the response
+const MaxImportWarnings = 200
+
+// Reasons of import warnings
+const (
+	ImportWarningTruncated    = "truncated"        // A value was cut to its length limit
+	ImportWarningTooLong      = "too_long"         // A value over its length limit was dropped or replaced
+	ImportWarningCreateFailed = "create_failed"    // Saving a list, section, template or history entry failed
+	ImportWarningReservedName = "reserved_name"    // A list used a name reserved for system use
+	ImportWarningInvalidRow   = "invalid_row"      // A row had too few columns or no list name
+	ImportWarningEncoding     = "invalid_encoding" // A row had text that is not valid in the file's encoding
+	ImportWarningInvalidValue = "invalid_value"    // A value could not be read and its default was used
+)
+
+// ImportWarning reports a part of the input that was skipped or changed on import
+type ImportWarning struct {
+	Row    int    `json:"row,omitempty"`   // Row of a CSV or XLSX file, the header is row 1
+	Path   string `json:"path,omitempty"`  // "list / section / item" of a JSON or YAML export
+	Field  string `json:"field,omitempty"` // name, icon, description, ...
+	Value  string `json:"value,omitempty"` // Start of the original value of truncated and replaced fields
+	Reason string `json:"reason"`
+	Action string `json:"action"` // "skipped" or "modified"
+}
+
+// importWarnings collects the warnings of an import up to MaxImportWarnings and counts the rest
+type importWarnings struct {
+	list []ImportWarning
+	more int
+}
+
+func (w *importWarnings) add(warning ImportWarning) {
+	if len(w.list) < MaxImportWarnings {
+		w.list = append(w.list, warning)
+	} else {
+		w.more++
+	}
+}
+
+// truncate cuts value to max characters, warning at row or path when it was longer
+func (w *importWarnings) truncate(value string, max, row int, path, field string) string {
+	if TextLength(value) <= max {
+		return value
+	}
+	w.add(ImportWarning{Row: row, Path: path, Field: field, Value: warningValue(value), Reason: ImportWarningTruncated, Action: "modified"})
+	return truncateText(value, max)
+}
+
+// rejected returns the error of a strict import rejected because of its warnings
+func (w *importWarnings) rejected() *AppError {
+	return NewError(ErrCodeImportRejected, fmt.Sprintf("Import rejected in strict mode, it has %d warnings", len(w.list)+w.more))
+}
+
+// warningValue returns the start of a value for a warning, cut on a character boundary
+func warningValue(value string) string {
+	if TextLength(value) > 40 {
+		return truncateText(value, 40) + "…"
+	}
+	return value
+}
+
+// warningPath joins names into a warning path, shortening long ones
+func warningPath(names ...string) string {
+	for i, name := range names {
+		if TextLength(name) > 60 {
+			names[i] = truncateText(name, 60) + "…"
+		}
+	}
+	return strings.Join(names, " / ")
+}
+
 // ImportData imports data from uploaded file
 func ImportData(c *fiber.Ctx) error {
+	end, err := BeginOperation(OperationImport)
+	var busy *OperationBusyError
+	if errors.As(err, &busy) {
+		return OperationConflict(c, busy)
+	}
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to start import")
+	}
+	// An async import releases the lock when it is done
+	async := false
+	defer func() {
+		if !async {
+			end(responseError(c))
+		}
+	}()
+
 	file, err := c.FormFile("file")
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "No file provided"})
+		return Fail(c, ErrCodeValidation, "No file provided")
 	}
 
-	if file.Size > MaxImportFileSize {
-		return c.Status(400).JSON(fiber.Map{"error": "File too large (max 5MB)"})
+	if limit := MaxImportSize(); file.Size > limit {
+		return Fail(c, ErrCodeValidation, fmt.Sprintf("File too large (max %dMB)", limit>>20))
 	}
 
-	conflictResolution := c.FormValue("conflict_resolution", "skip")
-	if conflictResolution != "skip" && conflictResolution != "replace" && conflictResolution != "copy" {
-		conflictResolution = "skip"
+	var resolutions map[string]string
+	if value := c.FormValue("conflict_resolutions"); value != "" {
+		if err := json.Unmarshal([]byte(value), &resolutions); err != nil {
+			return Fail(c, ErrCodeValidation, "conflict_resolutions must be a JSON object of list names to skip, replace, copy or merge")
+		}
+	}
+	mapping, appErr := parseColumnMapping(c.FormValue("column_mapping"))
+	if appErr != nil {
+		return Fail(c, appErr.Code, appErr.Message)
 	}
 
-	copySuffix := c.FormValue("copy_suffix", "copy")
-	delimiter := c.FormValue("delimiter", ",")
+	totalRows, _ := strconv.Atoi(c.FormValue("total_items"))
+
+	opts := ImportOptions{
+		Filename:            file.Filename,
+		ConflictResolution:  c.FormValue("conflict_resolution", "skip"),
+		ConflictResolutions: resolutions,
+		CopySuffix:          c.FormValue("copy_suffix", "copy"),
+		Delimiter:           c.FormValue("delimiter", ","),
+		ColumnMapping:       mapping,
+		Encoding:            c.FormValue("encoding"),
+		Lang:                RequestLang(c),
+		DedupeItems:         c.FormValue("dedupe_items") == "true",
+		Strict:              c.FormValue("strict") == "true",
+		ImportID:            newImportID(),
+		TotalRows:           totalRows,
+	}
+
+	if c.FormValue("async") == "true" {
+		tmp, err := spoolImport(file)
+		if err != nil {
+			return Fail(c, ErrCodeInternal, "Failed to read file")
+		}
+		async = true
+		go importAsync(tmp, opts, end)
+		return c.Status(fiber.StatusAccepted).JSON(ImportAccepted{Success: true, ImportID: opts.ImportID})
+	}
 
 	f, err := file.Open()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to open file"})
+		return Fail(c, ErrCodeInternal, "Failed to open file")
 	}
 	defer f.Close()
 
-	data, err := io.ReadAll(f)
+	result, err := runImport(f, opts)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to read file"})
+		return importFailed(c, err)
 	}
+	return c.JSON(result)
+}
 
-	format := detectFormat(file.Filename, data)
+// Import reads a JSON or YAML export, CSV or XLSX file from r and imports it
+// CSV and JSON are imported while they are read, XLSX and YAML are read whole first.
+// It is shared by the import endpoints and the import command, callers hold the import operation lock.
+// Failures that are the input's fault or the database's are returned as *AppError, or as
+// *ImportPartialError once rows were committed
+func Import(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if !validConflictResolution(opts.ConflictResolution) {
+		opts.ConflictResolution = "skip"
+	}
+	if len(opts.ConflictResolutions) > 0 {
+		resolutions := make(map[string]string, len(opts.ConflictResolutions))
+		for name, resolution := range opts.ConflictResolutions {
+			if !validConflictResolution(resolution) {
+				return nil, NewError(ErrCodeValidation, fmt.Sprintf("Unknown conflict resolution %q for %q, use skip, replace, copy or merge", resolution, name))
+			}
+			resolutions[strings.ToLower(name)] = resolution
+		}
+		opts.ConflictResolutions = resolutions
+	}
+	if opts.CopySuffix == "" {
+		opts.CopySuffix = "copy"
+	}
+	if len(opts.CopySuffix) > MaxCopySuffixLength {
+		return nil, NewError(ErrCodeValidation, fmt.Sprintf("copy_suffix must be at most %d bytes", MaxCopySuffixLength))
+	}
+	if opts.Lang == "" {
+		opts.Lang = i18n.GetDefaultLang()
+	}
 
-	if format == "json" {
-		return importJSON(c, data, conflictResolution, copySuffix)
-	} else if format == "csv" {
-		return importCSV(c, data, conflictResolution, copySuffix, delimiter)
+	// The start of the file is enough to detect the format
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
 	}
 
-	return c.Status(400).JSON(fiber.Map{"error": "Unsupported file format"})
-}
+	format := detectFormat(opts.Filename, head)
+	switch format {
+	case "json":
+		return importJSON(br, opts)
+	case "csv":
+		return importCSV(br, opts)
+	}
 
-func importJSON(c *fiber.Ctx, data []byte, conflictResolution, copySuffix string) error {
-	exportData, err := decodeJSON(data)
+	data, err := io.ReadAll(br)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON format"})
+		return nil, err
+	}
+	switch format {
+	case "xlsx":
+		return importXLSXImport(data, opts)
+	case "yaml":
+		return importYAML(data, opts)
+	}
+	return nil, NewError(ErrCodeInvalidFile, "Unsupported file format")
+}
+
+// importYAML imports a YAML export, rejecting names over the limits like the preview instead of skipping them
+func importYAML(data []byte, opts ImportOptions) (*ImportResult, error) {
+	exportData, appErr := decodeYAMLExport(data)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if appErr := validateExport(exportData, opts.Lang); appErr != nil {
+		return nil, appErr
 	}
+	return importExport(exportData, opts)
+}
 
-	// Start transaction
-	tx, err := db.DB.Begin()
+// importExport imports the lists, templates and history of a decoded YAML export
+func importExport(exportData *ExportData, opts ImportOptions) (*ImportResult, error) {
+	imp, err := newExportImporter(opts)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to start transaction"})
+		return nil, err
+	}
+	defer imp.run.rollback()
+
+	for _, list := range exportData.Data.Lists {
+		if err := imp.list(list); err != nil {
+			return nil, err
+		}
+	}
+	for _, template := range exportData.Data.Templates {
+		if err := imp.template(template); err != nil {
+			return nil, err
+		}
+	}
+	for _, history := range exportData.Data.History {
+		if err := imp.history(history); err != nil {
+			return nil, err
+		}
 	}
-	defer tx.Rollback()
+	return imp.run.finish()
+}
+
+// exportImporter imports the lists, templates and history of a JSON or YAML export one at a time
+type exportImporter struct {
+	run       *importRun
+	localize  func(string) string
+	templates *templateImporter
 
+	// existingNames maps lowercased list names to their id for conflict detection
+	existingNames map[string]int64
+}
+
+func newExportImporter(opts ImportOptions) (*exportImporter, error) {
 	// Get existing lists for conflict detection
 	existingLists, _ := db.GetAllLists()
 	existingNames := make(map[string]int64)
@@ -405,171 +726,322 @@ func importJSON(c *fiber.Ctx, data []byte, conflictResolution, copySuffix string
 		existingNames[strings.ToLower(list.Name)] = list.ID
 	}
 
-	importedLists := 0
-	importedItems := 0
-	importedTemplates := 0
-	importedHistory := 0
-	skippedLists := 0
+	templates := existingTemplateNames()
 
-	// Import lists
-	for _, exportList := range exportData.Data.Lists {
-		// Skip reserved name
-		if exportList.Name == "[HISTORY]" {
-			skippedLists++
-			continue
-		}
+	run, err := beginImport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &exportImporter{
+		run:           run,
+		localize:      sectionLocalizer(opts.Lang),
+		templates:     &templateImporter{run: run, existingNames: templates},
+		existingNames: existingNames,
+	}, nil
+}
 
-		// Validate field lengths
-		if len(exportList.Name) > MaxListNameLength {
-			continue
+// existingTemplateNames maps the lowercased names of existing templates to their id for conflict detection
+func existingTemplateNames() map[string]int64 {
+	templates, _ := db.GetAllTemplates()
+	names := make(map[string]int64, len(templates))
+	for _, tmpl := range templates {
+		names[strings.ToLower(tmpl.Name)] = tmpl.ID
+	}
+	return names
+}
+
+// templateImporter creates imported templates, treating a template named like an existing one
+// as the conflict resolution treats lists: merge adds the items to the existing template
+type templateImporter struct {
+	run           *importRun
+	existingNames map[string]int64 // Lowercased template names -> id
+}
+
+// create returns the id of the template to add the items of an imported template to
+// It is 0 without an error when the template is skipped because of a conflict
+func (t *templateImporter) create(name, description string) (int64, error) {
+	run := t.run
+	key := strings.ToLower(name)
+	if existingID, hasConflict := t.existingNames[key]; hasConflict {
+		switch run.opts.ConflictResolution {
+		case "skip":
+			return 0, nil
+		case "replace":
+			if err := run.replaceTemplate(existingID); err != nil {
+				return 0, err
+			}
+			if _, err := run.tx.Exec("DELETE FROM templates WHERE id = ?", existingID); err != nil {
+				return 0, err
+			}
+			delete(t.existingNames, key)
+		case "copy":
+			name = findUniqueName(name, run.opts.CopySuffix, t.existingNames)
+		case "merge":
+			return existingID, nil
 		}
+	}
+
+	// Must go through the transaction, which already holds the write lock
+	id, err := db.CreateTemplateTx(run.tx, name, description)
+	if err != nil {
+		return 0, err
+	}
+	run.created(db.ImportRowTemplate, id)
+	run.counts.ImportedTemplates++
+	return id, nil
+}
 
-		existingID, hasConflict := existingNames[strings.ToLower(exportList.Name)]
+// list imports a list with its sections and items
+func (imp *exportImporter) list(exportList ExportList) error {
+	run := imp.run
+	listPath := warningPath(exportList.Name)
 
-		if hasConflict {
-			switch conflictResolution {
-			case "skip":
-				skippedLists++
-				continue
-			case "replace":
-				// Delete existing list
-				_, err := tx.Exec("DELETE FROM lists WHERE id = ?", existingID)
-				if err != nil {
-					continue
-				}
-			case "copy":
-				// Find unique name with suffix
-				exportList.Name = findUniqueName(exportList.Name, copySuffix, existingNames)
+	// Skip reserved names
+	if exportList.Name == "[HISTORY]" || exportList.Name == "[TEMPLATE]" {
+		run.warnings.add(ImportWarning{Path: listPath, Field: "name", Reason: ImportWarningReservedName, Action: "skipped"})
+		run.counts.SkippedLists++
+		return nil
+	}
+
+	// Validate field lengths
+	if TextLength(exportList.Name) > MaxListNameLength {
+		run.warnings.add(ImportWarning{Path: listPath, Field: "name", Value: warningValue(exportList.Name), Reason: ImportWarningTooLong, Action: "skipped"})
+		return nil
+	}
+	if len(exportList.Icon) > MaxIconLength {
+		run.warnings.add(ImportWarning{Path: listPath, Field: "icon", Value: warningValue(exportList.Icon), Reason: ImportWarningTooLong, Action: "modified"})
+		exportList.Icon = "🛒"
+	}
+
+	existingID, hasConflict := imp.existingNames[strings.ToLower(exportList.Name)]
+
+	// merge holds the sections of the existing list when merging into it
+	var merge map[string]*db.MergeSection
+	sectionOrder := 0
+	if hasConflict {
+		switch run.opts.conflictResolution(exportList.Name) {
+		case "skip":
+			run.counts.SkippedLists++
+			return nil
+		case "replace":
+			// Delete existing list, keeping it for a rollback of the import
+			err := run.replaceList(existingID)
+			if err == nil {
+				_, err = run.tx.Exec("DELETE FROM lists WHERE id = ?", existingID)
+			}
+			if err != nil {
+				run.warnings.add(ImportWarning{Path: listPath, Reason: ImportWarningCreateFailed, Action: "skipped"})
+				return nil
+			}
+			run.writer.SectionsDeleted()
+		case "copy":
+			// Find unique name with suffix
+			exportList.Name = findUniqueName(exportList.Name, run.opts.CopySuffix, imp.existingNames)
+		case "merge":
+			var err error
+			merge, sectionOrder, err = db.LoadMergeSectionsTx(run.tx, existingID)
+			if err != nil {
+				run.warnings.add(ImportWarning{Path: listPath, Reason: ImportWarningCreateFailed, Action: "skipped"})
+				return nil
 			}
 		}
+	}
 
+	listID := existingID
+	if merge != nil {
+		run.counts.MergedLists++
+	} else {
 		// Create list with is_active flag preserved
-		list, err := db.CreateListTx(tx, exportList.Name, exportList.Icon)
+		list, err := db.CreateListTx(run.tx, exportList.Name, exportList.Icon)
 		if err != nil {
-			continue
+			run.warnings.add(ImportWarning{Path: listPath, Reason: ImportWarningCreateFailed, Action: "skipped"})
+			return nil
 		}
+		listID = list.ID
+		run.created(db.ImportRowList, list.ID)
 
 		// Set is_active if it was active in export
 		if exportList.IsActive {
-			tx.Exec("UPDATE lists SET is_active = TRUE WHERE id = ?", list.ID)
+			run.tx.Exec("UPDATE lists SET is_active = TRUE WHERE id = ?", list.ID)
 		}
 
-		importedLists++
+		run.counts.ImportedLists++
+	}
 
-		// Create sections and items
-		sectionOrder := 0
-		for _, exportSection := range exportList.Sections {
-			// Validate section name
-			sectionName := exportSection.Name
-			if len(sectionName) > MaxSectionNameLength {
-				sectionName = sectionName[:MaxSectionNameLength]
-			}
+	// Create sections and items
+	sections := make(map[string]*db.Section) // lowercase name -> section
+	itemOrders := make(map[int64]int)        // section id -> next item order
+	for _, exportSection := range exportList.Sections {
+		// Default sections from another language's export merge into this one's
+		sectionPath := warningPath(exportList.Name, exportSection.Name)
+		sectionName := run.warnings.truncate(imp.localize(exportSection.Name), MaxSectionNameLength, 0, sectionPath, "name")
+		sectionKey := strings.ToLower(sectionName)
 
-			section, err := db.CreateSectionForListTx(tx, list.ID, sectionName, sectionOrder)
+		section, exists := sections[sectionKey]
+		if existing := merge[sectionKey]; !exists && existing != nil {
+			section = &db.Section{ID: existing.ID, ListID: listID, Name: existing.Name}
+			sections[sectionKey] = section
+			itemOrders[section.ID] = existing.NextOrder
+			exists = true
+		}
+		if !exists {
+			var err error
+			section, err = db.CreateSectionForListTx(run.tx, listID, sectionName, nextSortOrder(exportSection.SortOrder, &sectionOrder, merge == nil))
 			if err != nil {
+				run.warnings.add(ImportWarning{Path: sectionPath, Reason: ImportWarningCreateFailed, Action: "skipped"})
 				continue
 			}
-			sectionOrder++
-
-			itemOrder := 0
-			for _, exportItem := range exportSection.Items {
-				// Validate item fields
-				itemName := exportItem.Name
-				if len(itemName) > MaxItemNameLength {
-					itemName = itemName[:MaxItemNameLength]
-				}
-				itemDesc := exportItem.Description
-				if len(itemDesc) > MaxDescriptionLength {
-					itemDesc = itemDesc[:MaxDescriptionLength]
-				}
+			run.created(db.ImportRowSection, section.ID)
+			run.writer.SectionCreated(section)
+			sections[sectionKey] = section
+		}
 
-				item, err := db.CreateItemTx(tx, section.ID, itemName, itemDesc, exportItem.Quantity, itemOrder)
-				if err != nil {
+		for _, exportItem := range exportSection.Items {
+			// Validate item fields
+			itemPath := warningPath(exportList.Name, exportSection.Name, exportItem.Name)
+			itemName := run.warnings.truncate(exportItem.Name, MaxItemNameLength, 0, itemPath, "name")
+			itemDesc := run.warnings.truncate(exportItem.Description, MaxDescriptionLength, 0, itemPath, "description")
+			priceCents, currency := importPrice(string(exportItem.Price), exportItem.Currency, &run.warnings, 0, itemPath, "")
+			dueDate := importDueDate(exportItem.DueDate, &run.warnings, 0, itemPath, "due_date")
+
+			// Items the list already has take the imported flags instead of being added twice
+			if existing := merge[sectionKey]; existing != nil {
+				if id, ok := existing.Items[strings.ToLower(itemName)]; ok {
+					first, err := run.mergeItemFlags(id, exportItem.Completed, exportItem.Uncertain)
+					if err != nil {
+						return run.fail(NewError(ErrCodeDB, "Failed to import items"))
+					}
+					if first {
+						run.counts.MergedItems++
+					}
+					if err := run.row(); err != nil {
+						return err
+					}
 					continue
 				}
-				itemOrder++
+			}
 
-				// Set completed and uncertain flags directly
-				if exportItem.Completed {
-					tx.Exec("UPDATE items SET completed = TRUE WHERE id = ?", item.ID)
-				}
-				if exportItem.Uncertain {
-					tx.Exec("UPDATE items SET uncertain = TRUE WHERE id = ?", item.ID)
-				}
+			itemOrder := itemOrders[section.ID]
+			added, err := run.addItem(db.ImportItem{
+				SectionID:   section.ID,
+				Name:        itemName,
+				Description: itemDesc,
+				Quantity:    exportItem.Quantity,
+				SortOrder:   nextSortOrder(exportItem.SortOrder, &itemOrder, merge == nil),
+				Completed:   exportItem.Completed,
+				Uncertain:   exportItem.Uncertain,
+				CreatedAt:   parseImportTime(exportItem.CreatedAt),
+				CompletedAt: parseImportTime(exportItem.CompletedAt),
+				PriceCents:  priceCents,
+				Currency:    currency,
+				DueDate:     dueDate,
+			})
+			if err != nil {
+				return run.fail(NewError(ErrCodeDB, "Failed to import items"))
+			}
+			if added {
+				itemOrders[section.ID] = itemOrder
+				run.counts.ImportedItems++
+			}
 
-				importedItems++
+			if err := run.row(); err != nil {
+				return err
 			}
 		}
 	}
+	return nil
+}
 
-	// Import templates
-	for _, exportTemplate := range exportData.Data.Templates {
-		template, err := db.CreateTemplate(exportTemplate.Name, exportTemplate.Description)
-		if err != nil {
-			continue
-		}
+// template imports a template with its items
+func (imp *exportImporter) template(exportTemplate ExportTemplate) error {
+	run := imp.run
 
-		for _, item := range exportTemplate.Items {
-			db.AddTemplateItem(template.ID, item.SectionName, item.Name, item.Description)
-		}
-		importedTemplates++
+	templatePath := "templates / " + warningPath(exportTemplate.Name)
+	templateID, err := imp.templates.create(exportTemplate.Name, exportTemplate.Description)
+	if err != nil {
+		run.warnings.add(ImportWarning{Path: templatePath, Reason: ImportWarningCreateFailed, Action: "skipped"})
+		return nil
+	}
+	if templateID == 0 {
+		return nil
 	}
 
-	// Import history with usage count preserved
-	for _, h := range exportData.Data.History {
-		usageCount := h.UsageCount
-		if usageCount < 1 {
-			usageCount = 1
-		}
-		sectionID := db.GetSectionIDByNameTx(tx, h.LastSection)
-		err := db.SaveItemHistoryWithCountTx(tx, h.Name, sectionID, usageCount)
-		if err == nil {
-			importedHistory++
+	for _, item := range exportTemplate.Items {
+		id, err := db.AddTemplateItemTx(run.tx, templateID, imp.localize(item.SectionName), item.Name, item.Description)
+		if err != nil {
+			run.warnings.add(ImportWarning{Path: templatePath + " / " + warningPath(item.Name), Reason: ImportWarningCreateFailed, Action: "skipped"})
+			continue
 		}
+		run.created(db.ImportRowTemplateItem, id)
 	}
+	return run.row()
+}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to commit import"})
+// history imports a history entry with its usage count preserved
+func (imp *exportImporter) history(h ExportHistory) error {
+	run := imp.run
+	usageCount := h.UsageCount
+	if usageCount < 1 {
+		usageCount = 1
 	}
-
-	return c.JSON(fiber.Map{
-		"success":            true,
-		"imported_lists":     importedLists,
-		"imported_items":     importedItems,
-		"imported_templates": importedTemplates,
-		"imported_history":   importedHistory,
-		"skipped_lists":      skippedLists,
-	})
+	err := run.writer.SaveHistory(h.Name, imp.localize(h.LastSection), usageCount)
+	if err != nil {
+		run.warnings.add(ImportWarning{Path: "history / " + warningPath(h.Name), Reason: ImportWarningCreateFailed, Action: "skipped"})
+		return nil
+	}
+	run.counts.ImportedHistory++
+	return run.row()
 }
 
-func importCSV(c *fiber.Ctx, data []byte, conflictResolution, copySuffix, delimiter string) error {
-	// Remove BOM if present
-	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
-		data = data[3:]
+// importCSV imports a CSV file while reading it, one row at a time
+func importCSV(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	comma, appErr := parseDelimiter(opts.Delimiter)
+	if appErr != nil {
+		return nil, appErr
 	}
 
-	reader := csv.NewReader(strings.NewReader(string(data)))
-	// Set delimiter
-	if len(delimiter) > 0 {
-		reader.Comma = rune(delimiter[0])
+	encoding, appErr := parseEncoding(opts.Encoding)
+	if appErr != nil {
+		return nil, appErr
 	}
-
-	records, err := reader.ReadAll()
+	text, _, err := decodeCSV(r, encoding)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid CSV format"})
+		return nil, err
 	}
 
-	if len(records) < 2 {
-		return c.Status(400).JSON(fiber.Map{"error": "CSV file is empty"})
-	}
+	reader := csv.NewReader(text)
+	reader.Comma = comma
+	// Short rows are reported per row instead of failing the file
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
 
-	// Start transaction
-	tx, err := db.DB.Begin()
+	return importRows(reader.Read, "CSV", opts)
+}
+
+// importRows imports the rows of a CSV or XLSX file of the given kind
+// next returns the header first and io.EOF after the last row
+func importRows(next func() ([]string, error), kind string, opts ImportOptions) (*ImportResult, error) {
+	invalid := NewError(ErrCodeInvalidFile, "Invalid "+kind+" format")
+	empty := NewError(ErrCodeInvalidFile, kind+" file is empty")
+
+	// A mapping, or a header naming the columns in another order, rearranges the rows into the import columns
+	next, err := opts.ColumnMapping.mapRows(next, opts.Filename)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to start transaction"})
+		var appErr *AppError
+		if errors.As(err, &appErr) {
+			return nil, appErr
+		}
+		return nil, invalid
+	}
+
+	// Check and skip the header row like previews do
+	if header, err := next(); err == io.EOF {
+		return nil, empty
+	} else if err != nil {
+		return nil, invalid
+	} else if len(header) < 7 {
+		return nil, NewError(ErrCodeInvalidFile, "Invalid "+kind+" header. Expected: "+importColumns)
 	}
-	defer tx.Rollback()
 
 	// Get existing lists for conflict detection
 	existingLists, _ := db.GetAllLists()
@@ -577,6 +1049,16 @@ func importCSV(c *fiber.Ctx, data []byte, conflictResolution, copySuffix, delimi
 	for _, list := range existingLists {
 		existingNames[strings.ToLower(list.Name)] = list.ID
 	}
+	existingTemplates := existingTemplateNames()
+
+	run, err := beginImport(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer run.rollback()
+
+	templates := &templateImporter{run: run, existingNames: existingTemplates}
+	templateIDs := make(map[string]int64) // Lowercased template name in the file -> id, 0 when skipped
 
 	// Track created lists and sections
 	createdLists := make(map[string]*db.List)
@@ -584,27 +1066,38 @@ func importCSV(c *fiber.Ctx, data []byte, conflictResolution, copySuffix, delimi
 	sectionOrders := make(map[string]int)                      // list key -> next section order
 	itemOrders := make(map[int64]int)                          // section id -> next item order
 
-	importedLists := 0
-	importedItems := 0
-	importedHistory := 0
-	skippedLists := 0
 	skippedListNames := make(map[string]bool)
+	mergeSections := make(map[string]map[string]*db.MergeSection) // list key -> sections of an existing list merged into
 
-	// Get default section name from i18n
-	defaultSectionName := i18n.Get(i18n.GetDefaultLang(), "sections.default")
-	if defaultSectionName == "sections.default" {
-		// Fallback if key not found
-		defaultSectionName = "General"
-	}
+	localize := sectionLocalizer(opts.Lang)
+	defaultSectionName := DefaultSection(opts.Lang)
+
+	for rowNum := 2; ; rowNum++ {
+		if rowNum > 2 {
+			if err := run.row(); err != nil {
+				return nil, err
+			}
+		}
+
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, run.fail(invalid)
+		}
 
-	// Skip header row
-	for _, row := range records[1:] {
 		if len(row) < 4 {
+			run.warnings.add(ImportWarning{Row: rowNum, Reason: ImportWarningInvalidRow, Action: "skipped"})
 			continue
 		}
 
 		listName := strings.TrimSpace(row[0])
 		if listName == "" {
+			// Rows with only empty cells are padding, not data
+			if strings.TrimSpace(strings.Join(row, "")) != "" {
+				run.warnings.add(ImportWarning{Row: rowNum, Field: "list_name", Reason: ImportWarningInvalidRow, Action: "skipped"})
+			}
 			continue
 		}
 
@@ -615,7 +1108,9 @@ func importCSV(c *fiber.Ctx, data []byte, conflictResolution, copySuffix, delimi
 			if len(row) > 2 {
 				itemName = strings.TrimSpace(row[2])
 			}
-			if itemName != "" {
+			if itemName != "" && !validText(itemName) {
+				run.warnings.add(ImportWarning{Row: rowNum, Field: "item_name", Reason: ImportWarningEncoding, Action: "skipped"})
+			} else if itemName != "" {
 				// Get last section name from column 3
 				lastSectionName := ""
 				if len(row) > 3 {
@@ -630,14 +1125,55 @@ func importCSV(c *fiber.Ctx, data []byte, conflictResolution, copySuffix, delimi
 					}
 				}
 
-				// Find section ID by name
-				sectionID := db.GetSectionIDByNameTx(tx, lastSectionName)
+				err := run.writer.SaveHistory(itemName, localize(lastSectionName), usageCount)
+				if err != nil {
+					run.warnings.add(ImportWarning{Row: rowNum, Reason: ImportWarningCreateFailed, Action: "skipped"})
+				} else {
+					run.counts.ImportedHistory++
+				}
+			}
+			continue
+		}
+
+		// Handle template rows, the template is created with its first row
+		// Format: [TEMPLATE],template_name,section_name,item_name,item_description,template_description
+		if listName == "[TEMPLATE]" {
+			templateName := column(row, 1)
+			sectionName, itemName, itemDescription := column(row, 2), column(row, 3), column(row, 4)
+			if templateName == "" {
+				run.warnings.add(ImportWarning{Row: rowNum, Field: "template_name", Reason: ImportWarningInvalidRow, Action: "skipped"})
+				continue
+			}
+			if field := invalidTextField(templateName, sectionName, itemName, itemDescription); field != "" {
+				run.warnings.add(ImportWarning{Row: rowNum, Field: field, Reason: ImportWarningEncoding, Action: "skipped"})
+				continue
+			}
 
-				err := db.SaveItemHistoryWithCountTx(tx, itemName, sectionID, usageCount)
-				if err == nil {
-					importedHistory++
+			templateKey := strings.ToLower(templateName)
+			templateID, seen := templateIDs[templateKey]
+			if !seen {
+				templateID, err = templates.create(templateName, column(row, 5))
+				if err != nil {
+					run.warnings.add(ImportWarning{Row: rowNum, Field: "template_name", Reason: ImportWarningCreateFailed, Action: "skipped"})
 				}
+				templateIDs[templateKey] = templateID
+			}
+			if templateID == 0 || itemName == "" {
+				continue
 			}
+
+			if sectionName == "" {
+				sectionName = defaultSectionName
+			}
+			sectionName = run.warnings.truncate(localize(sectionName), MaxSectionNameLength, rowNum, "", "section_name")
+			itemName = run.warnings.truncate(itemName, MaxItemNameLength, rowNum, "", "item_name")
+			itemDescription = run.warnings.truncate(itemDescription, MaxDescriptionLength, rowNum, "", "item_description")
+			id, err := db.AddTemplateItemTx(run.tx, templateID, sectionName, itemName, itemDescription)
+			if err != nil {
+				run.warnings.add(ImportWarning{Row: rowNum, Field: "item_name", Reason: ImportWarningCreateFailed, Action: "skipped"})
+				continue
+			}
+			run.created(db.ImportRowTemplateItem, id)
 			continue
 		}
 
@@ -648,50 +1184,17 @@ func importCSV(c *fiber.Ctx, data []byte, conflictResolution, copySuffix, delimi
 			continue
 		}
 
-		// Validate list name
-		if len(listName) > MaxListNameLength {
-			listName = listName[:MaxListNameLength]
-			listKey = strings.ToLower(listName)
-		}
-
-		listIcon := "🛒"
-		if len(row) > 1 && row[1] != "" {
-			listIcon = row[1]
-			if len(listIcon) > MaxIconLength {
-				listIcon = "🛒"
-			}
-		}
-		sectionName := ""
-		if len(row) > 2 {
-			sectionName = strings.TrimSpace(row[2])
-		}
-		itemName := strings.TrimSpace(row[3])
-		itemDescription := ""
-		if len(row) > 4 {
-			itemDescription = strings.TrimSpace(row[4])
-		}
-		itemCompleted := false
-		if len(row) > 5 {
-			itemCompleted = strings.ToLower(strings.TrimSpace(row[5])) == "true"
-		}
-		itemUncertain := false
-		if len(row) > 6 {
-			itemUncertain = strings.ToLower(strings.TrimSpace(row[6])) == "true"
-		}
-		itemQuantity := 0
-		if len(row) > 7 {
-			if qty, err := strconv.Atoi(strings.TrimSpace(row[7])); err == nil && qty >= 0 {
-				itemQuantity = qty
-			}
-		}
-
-		// Validate item fields
-		if len(itemName) > MaxItemNameLength {
-			itemName = itemName[:MaxItemNameLength]
-		}
-		if len(itemDescription) > MaxDescriptionLength {
-			itemDescription = itemDescription[:MaxDescriptionLength]
+		parsed, ok := parseImportRow(row, rowNum, &run.warnings, defaultSectionName, localize)
+		if !ok {
+			continue
 		}
+		listName, listKey = parsed.listName, strings.ToLower(parsed.listName)
+		listIcon, sectionName := parsed.listIcon, parsed.sectionName
+		itemName, itemDescription := parsed.itemName, parsed.itemDescription
+		itemCompleted, itemUncertain, itemQuantity := parsed.completed, parsed.uncertain, parsed.quantity
+		sectionSortOrder, itemSortOrder := parsed.sectionSortOrder, parsed.itemSortOrder
+		itemCreatedAt, itemCompletedAt := parsed.createdAt, parsed.completedAt
+		itemPriceCents, itemCurrency, itemDueDate := parsed.priceCents, parsed.currency, parsed.dueDate
 
 		// Get or create list
 		list, exists := createdLists[listKey]
@@ -699,106 +1202,319 @@ func importCSV(c *fiber.Ctx, data []byte, conflictResolution, copySuffix, delimi
 			existingID, hasConflict := existingNames[listKey]
 
 			if hasConflict {
-				switch conflictResolution {
+				switch opts.conflictResolution(listName) {
 				case "skip":
-					skippedLists++
+					run.counts.SkippedLists++
 					skippedListNames[listKey] = true
 					continue
 				case "replace":
-					tx.Exec("DELETE FROM lists WHERE id = ?", existingID)
+					// Keep the existing list for a rollback of the import
+					err := run.replaceList(existingID)
+					if err == nil {
+						_, err = run.tx.Exec("DELETE FROM lists WHERE id = ?", existingID)
+					}
+					if err != nil {
+						run.warnings.add(ImportWarning{Row: rowNum, Reason: ImportWarningCreateFailed, Action: "skipped"})
+						skippedListNames[listKey] = true
+						continue
+					}
+					run.writer.SectionsDeleted()
 				case "copy":
-					listName = findUniqueName(listName, copySuffix, existingNames)
-					listKey = strings.ToLower(listName)
+					// listKey stays the name in the file, so its later rows find the copy
+					listName = findUniqueName(listName, opts.CopySuffix, existingNames)
+				case "merge":
+					sections, nextOrder, err := db.LoadMergeSectionsTx(run.tx, existingID)
+					if err != nil {
+						run.warnings.add(ImportWarning{Row: rowNum, Reason: ImportWarningCreateFailed, Action: "skipped"})
+						skippedListNames[listKey] = true
+						continue
+					}
+					list = &db.List{ID: existingID, Name: listName}
+					mergeSections[listKey] = sections
+					sectionOrders[listKey] = nextOrder
+					run.counts.MergedLists++
 				}
 			}
 
-			newList, err := db.CreateListTx(tx, listName, listIcon)
-			if err != nil {
-				continue
+			if list == nil {
+				newList, err := db.CreateListTx(run.tx, listName, listIcon)
+				if err != nil {
+					run.warnings.add(ImportWarning{Row: rowNum, Field: "list_name", Reason: ImportWarningCreateFailed, Action: "skipped"})
+					continue
+				}
+				list = newList
+				run.created(db.ImportRowList, list.ID)
+				sectionOrders[listKey] = 0
+				run.counts.ImportedLists++
 			}
-			list = newList
 			createdLists[listKey] = list
 			createdSections[listKey] = make(map[string]*db.Section)
-			sectionOrders[listKey] = 0
-			importedLists++
 		}
 
 		// Get or create section
-		if sectionName == "" {
-			sectionName = defaultSectionName
-		}
-		if len(sectionName) > MaxSectionNameLength {
-			sectionName = sectionName[:MaxSectionNameLength]
-		}
 		sectionKey := strings.ToLower(sectionName)
 		section, exists := createdSections[listKey][sectionKey]
+		if existing := mergeSections[listKey][sectionKey]; !exists && existing != nil {
+			section = &db.Section{ID: existing.ID, ListID: list.ID, Name: existing.Name}
+			createdSections[listKey][sectionKey] = section
+			itemOrders[section.ID] = existing.NextOrder
+			exists = true
+		}
 		if !exists {
-			newSection, err := db.CreateSectionForListTx(tx, list.ID, sectionName, sectionOrders[listKey])
+			sectionOrder := sectionOrders[listKey]
+			newSection, err := db.CreateSectionForListTx(run.tx, list.ID, sectionName, nextSortOrder(sectionSortOrder, &sectionOrder, mergeSections[listKey] == nil))
 			if err != nil {
+				run.warnings.add(ImportWarning{Row: rowNum, Field: "section_name", Reason: ImportWarningCreateFailed, Action: "skipped"})
 				continue
 			}
 			section = newSection
+			run.created(db.ImportRowSection, section.ID)
+			run.writer.SectionCreated(section)
 			createdSections[listKey][sectionKey] = section
-			sectionOrders[listKey]++
+			sectionOrders[listKey] = sectionOrder
 			itemOrders[section.ID] = 0
 		}
 
-		// Create item
-		if itemName != "" {
-			item, err := db.CreateItemTx(tx, section.ID, itemName, itemDescription, itemQuantity, itemOrders[section.ID])
-			if err != nil {
+		// Items the list already has take the imported flags instead of being added twice
+		if existing := mergeSections[listKey][sectionKey]; existing != nil && itemName != "" {
+			if id, ok := existing.Items[strings.ToLower(itemName)]; ok {
+				first, err := run.mergeItemFlags(id, itemCompleted, itemUncertain)
+				if err != nil {
+					return nil, run.fail(NewError(ErrCodeDB, "Failed to import items"))
+				}
+				if first {
+					run.counts.MergedItems++
+				}
 				continue
 			}
-			itemOrders[section.ID]++
+		}
 
-			if itemCompleted {
-				tx.Exec("UPDATE items SET completed = TRUE WHERE id = ?", item.ID)
+		// Create item
+		if itemName != "" {
+			itemOrder := itemOrders[section.ID]
+			added, err := run.addItem(db.ImportItem{
+				SectionID:   section.ID,
+				Name:        itemName,
+				Description: itemDescription,
+				Quantity:    itemQuantity,
+				SortOrder:   nextSortOrder(itemSortOrder, &itemOrder, mergeSections[listKey] == nil),
+				Completed:   itemCompleted,
+				Uncertain:   itemUncertain,
+				CreatedAt:   itemCreatedAt,
+				CompletedAt: itemCompletedAt,
+				PriceCents:  itemPriceCents,
+				Currency:    itemCurrency,
+				DueDate:     itemDueDate,
+			})
+			if err != nil {
+				return nil, run.fail(NewError(ErrCodeDB, "Failed to import items"))
 			}
-			if itemUncertain {
-				tx.Exec("UPDATE items SET uncertain = TRUE WHERE id = ?", item.ID)
+			if added {
+				itemOrders[section.ID] = itemOrder
+				run.counts.ImportedItems++
 			}
+		}
+	}
 
-			importedItems++
+	if run.rows == 0 {
+		return nil, empty
+	}
+	return run.finish()
+}
+
+// importRow is a list row of a CSV or XLSX file, cut to the length limits
+type importRow struct {
+	listName, listIcon, sectionName string
+	itemName, itemDescription       string
+	completed, uncertain            bool
+	quantity                        int
+	sectionSortOrder, itemSortOrder *int
+	createdAt, completedAt          time.Time
+	priceCents                      *int64
+	currency, dueDate               string
+}
+
+// parseImportRow reads a list row of a CSV or XLSX file, adding a warning for each value it changes
+// It reports false for rows that are skipped. Imports and previews share it, so previews warn alike
+func parseImportRow(row []string, rowNum int, warnings *importWarnings, defaultSectionName string, localize func(string) string) (importRow, bool) {
+	r := importRow{listName: strings.TrimSpace(row[0]), listIcon: "🛒"}
+
+	// Validate list name
+	r.listName = warnings.truncate(r.listName, MaxListNameLength, rowNum, "", "list_name")
+
+	if len(row) > 1 && row[1] != "" {
+		r.listIcon = row[1]
+		if len(r.listIcon) > MaxIconLength {
+			warnings.add(ImportWarning{Row: rowNum, Field: "list_icon", Value: warningValue(r.listIcon), Reason: ImportWarningTooLong, Action: "modified"})
+			r.listIcon = "🛒"
+		}
+	}
+	sectionName := column(row, 2)
+	r.itemName = strings.TrimSpace(row[3])
+	r.itemDescription = column(row, 4)
+	r.completed = parseImportFlag(row, 5, rowNum, warnings, "item_completed")
+	r.uncertain = parseImportFlag(row, 6, rowNum, warnings, "item_uncertain")
+	if qty, err := strconv.Atoi(column(row, 7)); err == nil && qty >= 0 {
+		r.quantity = qty
+	}
+	r.sectionSortOrder, r.itemSortOrder = parseSortOrder(row, 8), parseSortOrder(row, 9)
+	r.createdAt, r.completedAt = parseImportTime(column(row, 10)), parseImportTime(column(row, 11))
+	r.priceCents, r.currency = importPrice(column(row, 12), column(row, 13), warnings, rowNum, "", "item_")
+	r.dueDate = importDueDate(column(row, 14), warnings, rowNum, "", "item_due_date")
+
+	// Text broken by a wrong encoding is skipped rather than stored
+	if field := invalidTextField(r.listName, sectionName, r.itemName, r.itemDescription); field != "" {
+		warnings.add(ImportWarning{Row: rowNum, Field: field, Reason: ImportWarningEncoding, Action: "skipped"})
+		return r, false
+	}
+
+	// Validate item fields
+	r.itemName = warnings.truncate(r.itemName, MaxItemNameLength, rowNum, "", "item_name")
+	r.itemDescription = warnings.truncate(r.itemDescription, MaxDescriptionLength, rowNum, "", "item_description")
+
+	// Default sections from another language's export merge into this one's
+	if sectionName == "" {
+		sectionName = defaultSectionName
+	}
+	r.sectionName = warnings.truncate(localize(sectionName), MaxSectionNameLength, rowNum, "", "section_name")
+	return r, true
+}
+
+// invalidTextField returns the first of the list, section and item name and the description of a row
+// that is not valid text, see validText, or "" if they all are
+func invalidTextField(listName, sectionName, itemName, description string) string {
+	for i, value := range []string{listName, sectionName, itemName, description} {
+		if !validText(value) {
+			return []string{"list_name", "section_name", "item_name", "item_description"}[i]
+		}
+	}
+	return ""
+}
+
+// nextSortOrder returns the sort order of an imported section or item and advances next past it
+// The exported order is used if the file has one and useExported is set, lists merged into keep their own order.
+// Otherwise the order is next, so rows without one follow those before them
+func nextSortOrder(exported *int, next *int, useExported bool) int {
+	order := *next
+	if useExported && exported != nil && *exported >= 0 {
+		order = *exported
+	}
+	*next = max(*next, order+1)
+	return order
+}
+
+// parseSortOrder returns the sort order in column i of row, nil if the column is missing, empty or invalid
+func parseSortOrder(row []string, i int) *int {
+	order, err := strconv.Atoi(column(row, i))
+	if err != nil || order < 0 {
+		return nil
+	}
+	return &order
+}
+
+// parseImportFlag reads the completed or uncertain flag in column i of row, see importFlag
+// Other values read as false with a warning
+func parseImportFlag(row []string, i int, rowNum int, warnings *importWarnings, field string) bool {
+	value := column(row, i)
+	flag, ok := importFlag(value)
+	if !ok {
+		warnings.add(ImportWarning{Row: rowNum, Field: field, Value: warningValue(value), Reason: ImportWarningInvalidValue, Action: "modified"})
+	}
+	return flag
+}
+
+// importFlag reads a flag in any case as Excel and other apps write it: true/false, t/f, 1/0, yes/no, y/n,
+// or x, a check mark, done or checked against empty. ok is false for other values
+func importFlag(value string) (flag, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "t", "1", "yes", "y", "x", "✓", "✔", "done", "checked":
+		return true, true
+	case "", "false", "f", "0", "no", "n":
+		return false, true
+	}
+	return false, false
+}
+
+// parseImportTime parses an exported RFC3339 time, zero if it is empty or invalid so the import uses its own time
+func parseImportTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// column returns column i of row with spaces trimmed, empty if the row is shorter
+func column(row []string, i int) string {
+	if len(row) <= i {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// sectionLocalizer returns i18n.LocalizeSectionName for lang, cached since imports repeat a few section names on every row
+func sectionLocalizer(lang string) func(string) string {
+	cache := make(map[string]string)
+	return func(name string) string {
+		localized, ok := cache[name]
+		if !ok {
+			localized = i18n.LocalizeSectionName(lang, name)
+			cache[name] = localized
 		}
+		return localized
 	}
+}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to commit import"})
+// DefaultSection returns the translated name of the default section, used for rows without one
+func DefaultSection(lang string) string {
+	name := i18n.Get(lang, "sections.default")
+	if name == "sections.default" {
+		// Fallback if key not found
+		name = "General"
 	}
+	return name
+}
 
-	return c.JSON(fiber.Map{
-		"success":          true,
-		"imported_lists":   importedLists,
-		"imported_items":   importedItems,
-		"imported_history": importedHistory,
-		"skipped_lists":    skippedLists,
+// importSummary describes an import result with correct plural forms
+func importSummary(lang string, lists, items, skipped int) string {
+	summary := i18n.GetF(lang, "import.summary", map[string]any{
+		"lists": i18n.GetN(lang, "import.count_lists", lists),
+		"items": i18n.GetN(lang, "import.count_items", items),
 	})
+	if skipped > 0 {
+		summary += ", " + i18n.GetN(lang, "import.skipped_lists", skipped)
+	}
+	return summary
 }
 
-// findUniqueName finds a unique list name by adding suffix with incrementing number
-// It also updates existingNames map to prevent collisions within the same import
+// findUniqueName finds a unique list or template name by adding suffix with an incrementing number, and after
+// 100 numbers a random token. baseName is cut on a character boundary so the name fits MaxListNameLength.
+// The name is marked as used in existingNames, so later names of the same import avoid it
 func findUniqueName(baseName, suffix string, existingNames map[string]int64) string {
-	// First try with just the suffix
-	candidateName := fmt.Sprintf("%s (%s)", baseName, suffix)
-	candidateKey := strings.ToLower(candidateName)
-	if _, exists := existingNames[candidateKey]; !exists {
-		// Mark as used to prevent collision in same import batch
-		existingNames[candidateKey] = -1
-		return candidateName
-	}
-
-	// Try with incrementing numbers
-	for i := 2; i <= 100; i++ {
-		candidateName = fmt.Sprintf("%s (%s %d)", baseName, suffix, i)
-		candidateKey = strings.ToLower(candidateName)
+	for i := 1; ; i++ {
+		tag := suffix
+		switch {
+		case i > 100:
+			tag = suffix + " " + randomNameToken()
+		case i > 1:
+			tag = fmt.Sprintf("%s %d", suffix, i)
+		}
+		tail := " (" + tag + ")"
+		candidateName := truncateText(baseName, MaxListNameLength-TextLength(tail)) + tail
+		candidateKey := strings.ToLower(candidateName)
 		if _, exists := existingNames[candidateKey]; !exists {
 			// Mark as used to prevent collision in same import batch
 			existingNames[candidateKey] = -1
 			return candidateName
 		}
 	}
+}
 
-	// Fallback - return with timestamp
-	return fmt.Sprintf("%s (%s %d)", baseName, suffix, 9999)
+// randomNameToken returns a short random token for names when numbering runs out
+func randomNameToken() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// uploadRequest builds a multipart POST to path with data as the file and the given form fields
+func uploadRequest(t *testing.T, path, filename string, data []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+// listSections returns the sections of the list named name with their sorted item names
+func listSections(t *testing.T, name string) map[string][]string {
+	t.Helper()
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, list := range lists {
+		if list.Name != name {
+			continue
+		}
+		sections, err := db.GetSectionsByList(list.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[string][]string, len(sections))
+		for _, s := range sections {
+			items, err := db.GetItemsBySection(s.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, item := range items {
+				names = append(names, item.Name)
+			}
+			sort.Strings(names)
+			result[s.Name] = names
+		}
+		return result
+	}
+	t.Fatalf("no list named %q", name)
+	return nil
+}
+
+func TestImportMergesTranslatedDefaultSection(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	list, err := db.CreateList("Groceries", "🛒")
+	if err != nil {
+		t.Fatal(err)
+	}
+	general, err := db.CreateSectionForList(list.ID, "General")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateItem(general.ID, "Milk", "", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// A CSV exported from a Ukrainian instance, merged into the English list
+	csv := "list_name,list_icon,section_name,item_name,item_description,item_completed,item_uncertain\n" +
+		"Groceries,,Загальне,Bread,,false,false\n"
+	if _, err := Import(strings.NewReader(csv), ImportOptions{Filename: "list.csv", Lang: "en", ConflictResolution: "merge"}); err != nil {
+		t.Fatalf("CSV import: %v", err)
+	}
+	if got, want := listSections(t, "Groceries"), map[string][]string{"General": {"Bread", "Milk"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sections after the CSV merge = %v, want %v", got, want)
+	}
+
+	// A JSON export whose list has the default section under both names
+	export := ExportData{Version: ExportVersion, App: "koffan"}
+	export.Data.Lists = []ExportList{{Name: "Hardware", Sections: []ExportSection{
+		{Name: "Загальне", Items: []ExportItem{{Name: "Nails", Quantity: 1}}},
+		{Name: "general", Items: []ExportItem{{Name: "Glue", Quantity: 1}}},
+	}}}
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(strings.NewReader(string(data)), ImportOptions{Filename: "export.json", Lang: "en"}); err != nil {
+		t.Fatalf("JSON import: %v", err)
+	}
+	if got, want := listSections(t, "Hardware"), map[string][]string{"General": {"Glue", "Nails"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sections after the JSON import = %v, want %v", got, want)
+	}
+}
+
+func TestApplyTemplateMatchesTranslatedDefaultSection(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	list, err := db.CreateList("Groceries", "🛒")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateSectionForList(list.ID, "General"); err != nil {
+		t.Fatal(err)
+	}
+	template, err := db.CreateTemplate("Weekly", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range [][2]string{{"Загальне", "Bread"}, {"Ogólne", "Eggs"}, {"Dairy", "Milk"}} {
+		if _, err := db.AddTemplateItem(template.ID, item[0], item[1], ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.ApplyTemplateToList(template.ID, list.ID); err != nil {
+		t.Fatalf("apply template: %v", err)
+	}
+	want := map[string][]string{"General": {"Bread", "Eggs"}, "Dairy": {"Milk"}}
+	if got := listSections(t, "Groceries"); !reflect.DeepEqual(got, want) {
+		t.Errorf("sections after applying the template = %v, want %v", got, want)
+	}
+}
+
+func TestImportFlag(t *testing.T) {
+	cases := []struct {
+		value    string
+		flag, ok bool
+	}{
+		{"true", true, true},
+		{"TRUE", true, true},
+		{"True", true, true},
+		{"t", true, true},
+		{"T", true, true},
+		{"1", true, true},
+		{"yes", true, true},
+		{"YES", true, true},
+		{"y", true, true},
+		{"Y", true, true},
+		{"x", true, true},
+		{"X", true, true},
+		{"✓", true, true},
+		{"✔", true, true},
+		{"done", true, true},
+		{"Checked", true, true},
+		{" true ", true, true},
+		{"", false, true},
+		{"   ", false, true},
+		{"false", false, true},
+		{"FALSE", false, true},
+		{"f", false, true},
+		{"0", false, true},
+		{"no", false, true},
+		{"No", false, true},
+		{"n", false, true},
+		{"N", false, true},
+		{"maybe", false, false},
+		{"2", false, false},
+		{"-1", false, false},
+		{"on", false, false},
+		{"yess", false, false},
+		{"✗", false, false},
+	}
+	for _, tc := range cases {
+		if flag, ok := importFlag(tc.value); flag != tc.flag || ok != tc.ok {
+			t.Errorf("importFlag(%q) = %v, %v, want %v, %v", tc.value, flag, ok, tc.flag, tc.ok)
+		}
+	}
+}
+
+// flagsCSV has rows with the flag spellings of spreadsheets and other apps, and one unreadable value
+const flagsCSV = "list_name,list_icon,section_name,item_name,item_description,item_completed,item_uncertain\n" +
+	"Flags,,Dairy,Excel,,TRUE,FALSE\n" +
+	"Flags,,Dairy,Numbers,,1,0\n" +
+	"Flags,,Dairy,Letters,,y,N\n" +
+	"Flags,,Dairy,Ticked,,x,\n" +
+	"Flags,,Dairy,Check mark,,✓,yes\n" +
+	"Flags,,Dairy,Unsure,,maybe,no\n"
+
+func TestImportReadsFlagSpellings(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	result, err := Import(strings.NewReader(flagsCSV), ImportOptions{Filename: "flags.csv"})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	want := map[string][2]bool{
+		"Excel":      {true, false},
+		"Numbers":    {true, false},
+		"Letters":    {true, false},
+		"Ticked":     {true, false},
+		"Check mark": {true, true},
+		"Unsure":     {false, false},
+	}
+	lists, _ := db.GetAllLists()
+	sections, _ := db.GetSectionsByList(lists[0].ID)
+	items, err := db.GetItemsBySection(sections[0].ID)
+	if err != nil || len(items) != len(want) {
+		t.Fatalf("items = %+v, %v", items, err)
+	}
+	for _, item := range items {
+		if got := [2]bool{item.Completed, item.Uncertain}; got != want[item.Name] {
+			t.Errorf("%s completed, uncertain = %v, want %v", item.Name, got, want[item.Name])
+		}
+	}
+
+	wantWarnings := []ImportWarning{{Row: 7, Field: "item_completed", Value: "maybe", Reason: ImportWarningInvalidValue, Action: "modified"}}
+	if !reflect.DeepEqual(result.Warnings, wantWarnings) {
+		t.Errorf("warnings = %+v, want %+v", result.Warnings, wantWarnings)
+	}
+}
+
+func TestPreviewWarnsAboutFlagSpellings(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/import/preview", PreviewImport)
+
+	resp, err := app.Test(uploadRequest(t, "/import/preview", "flags.csv", []byte(flagsCSV), nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var preview ImportPreviewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Warnings) != 1 || preview.Warnings[0].Row != 7 || preview.Warnings[0].Field != "item_completed" ||
+		preview.Warnings[0].Reason != ImportWarningInvalidValue {
+		t.Errorf("preview warnings = %+v, want the unreadable flag on row 7", preview.Warnings)
+	}
+	if lists, _ := db.GetAllLists(); len(lists) != 0 {
+		t.Errorf("preview created %d lists", len(lists))
+	}
+}
+
+func TestFindUniqueName(t *testing.T) {
+	existing := map[string]int64{"groceries": 1, "groceries (copy)": 2}
+	if got := findUniqueName("Groceries", "copy", existing); got != "Groceries (copy 2)" {
+		t.Errorf("first free name = %q, want Groceries (copy 2)", got)
+	}
+	if got := findUniqueName("GROCERIES", "copy", existing); got != "GROCERIES (copy 3)" {
+		t.Errorf("name after one of the same import = %q, want GROCERIES (copy 3)", got)
+	}
+
+	// Cut on a character boundary so the suffix fits the limit
+	long := strings.Repeat("ä", MaxListNameLength)
+	name := findUniqueName(long, "copy", map[string]int64{})
+	if !utf8.ValidString(name) || TextLength(name) != MaxListNameLength || !strings.HasSuffix(name, " (copy)") {
+		t.Errorf("copy of a name at the limit = %q (%d characters)", name, TextLength(name))
+	}
+
+	// Once the numbers run out a random token keeps names unique
+	taken := map[string]int64{"milk (copy)": 1}
+	for i := 2; i <= 100; i++ {
+		taken[strings.ToLower(fmt.Sprintf("Milk (copy %d)", i))] = 1
+	}
+	first, second := findUniqueName("Milk", "copy", taken), findUniqueName("Milk", "copy", taken)
+	if first == second || !strings.HasPrefix(first, "Milk (copy ") || TextLength(first) > MaxListNameLength {
+		t.Errorf("names after 100 copies = %q, %q, want two distinct tokens", first, second)
+	}
+}
+
+func TestImportSameFileFiveTimesWithCopy(t *testing.T) {
+	initLocales(t)
+	longName := strings.Repeat("Ж", MaxListNameLength)
+	export := ExportData{Version: ExportVersion, App: "koffan"}
+	export.Data.Lists = []ExportList{
+		{Name: "Groceries", Sections: []ExportSection{{Name: "Dairy", Items: []ExportItem{{Name: "Milk", Quantity: 1}, {Name: "Cheese", Quantity: 1}}}}},
+		{Name: longName, Sections: []ExportSection{{Name: "Tools", Items: []ExportItem{{Name: "Hammer", Quantity: 1}}}}},
+	}
+	jsonData, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvData := "list_name,list_icon,section_name,item_name,item_description,item_completed,item_uncertain\n" +
+		"Groceries,,Dairy,Milk,,false,false\nGroceries,,Dairy,Cheese,,false,false\n" +
+		longName + ",,Tools,Hammer,,false,false\n"
+
+	for _, file := range []struct{ name, data string }{{"export.json", string(jsonData)}, {"export.csv", csvData}} {
+		t.Run(file.name, func(t *testing.T) {
+			setupTestDB(t)
+			for i := 0; i < 5; i++ {
+				result, err := Import(strings.NewReader(file.data), ImportOptions{Filename: file.name, ConflictResolution: "copy"})
+				if err != nil {
+					t.Fatalf("import %d: %v", i+1, err)
+				}
+				if result.ImportedLists != 2 || result.ImportedItems != 3 {
+					t.Errorf("import %d created %d lists and %d items, want 2 and 3", i+1, result.ImportedLists, result.ImportedItems)
+				}
+			}
+
+			lists, err := db.GetAllLists()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lists) != 10 {
+				t.Fatalf("%d lists after five imports, want 10", len(lists))
+			}
+			seen := make(map[string]bool)
+			groceries := 0
+			for _, list := range lists {
+				key := strings.ToLower(list.Name)
+				if seen[key] {
+					t.Errorf("name %q used twice", list.Name)
+				}
+				seen[key] = true
+				if TextLength(list.Name) > MaxListNameLength || !utf8.ValidString(list.Name) {
+					t.Errorf("name %q is not a valid name within the limit", list.Name)
+				}
+
+				items := 0
+				for _, names := range listSections(t, list.Name) {
+					items += len(names)
+				}
+				if strings.HasPrefix(list.Name, "Groceries") {
+					groceries++
+					if items != 2 {
+						t.Errorf("%s has %d items, want 2", list.Name, items)
+					}
+				} else if items != 1 {
+					t.Errorf("%s has %d items, want 1", list.Name, items)
+				}
+			}
+			if groceries != 5 {
+				t.Errorf("%d Groceries lists, want 5", groceries)
+			}
+		})
+	}
+}
+
+func TestImportDueDates(t *testing.T) {
+	setupTestDB(t)
+	csv := strings.Join(csvExportHeader, ",") + "\n" +
+		"Pharmacy,,Health,Prescription,,false,false,1,0,0,,,,,2030-05-31\n" +
+		"Pharmacy,,Health,Plasters,,false,false,1,0,1,,,,,31.05.2030\n" +
+		"Pharmacy,,Health,Vitamins,,false,false,1,0,2,,,,,\n"
+	result, err := Import(strings.NewReader(csv), ImportOptions{Filename: "due.csv"})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	// The unreadable date is dropped with a warning, the item is kept
+	if result.ImportedItems != 3 || len(result.Warnings) != 1 || result.Warnings[0].Row != 3 ||
+		result.Warnings[0].Field != "item_due_date" || result.Warnings[0].Reason != ImportWarningInvalidValue {
+		t.Errorf("imported %d items with warnings %+v, want 3 and an invalid item_due_date on row 3", result.ImportedItems, result.Warnings)
+	}
+
+	due := map[string]string{}
+	for _, list := range fullExport(t).Data.Lists {
+		for _, section := range list.Sections {
+			for _, item := range section.Items {
+				due[item.Name] = item.DueDate
+			}
+		}
+	}
+	if want := map[string]string{"Prescription": "2030-05-31", "Plasters": "", "Vitamins": ""}; !reflect.DeepEqual(due, want) {
+		t.Errorf("exported due dates = %v, want %v", due, want)
+	}
+}
+
+// largeImportFiles returns a CSV and a JSON export of 18000 items in 3 lists and 2000 history entries,
+// 20000 rows in all, and empties the database again
+func largeImportFiles(b *testing.B) (csvData, jsonData []byte) {
+	b.Helper()
+	seedLargeExport(b, 3, 6, 1000)
+	lists, err := db.GetAllLists()
+	if err != nil {
+		b.Fatal(err)
+	}
+	history := make([]ExportHistory, 2000)
+	for i := range history {
+		history[i] = ExportHistory{Name: fmt.Sprintf("Item %d", i), LastSection: fmt.Sprintf("Section %d", i%6), UsageCount: i%9 + 1}
+	}
+
+	var buf bytes.Buffer
+	if err := exportAllAsCSV(&buf, lists, ExportOptions{}, ','); err != nil {
+		b.Fatal(err)
+	}
+	writer := newCSVExportWriter(&buf, ',', ExportOptions{})
+	writeHistoryCSVRows(writer, history)
+	writer.Flush()
+	csvData = append([]byte(nil), buf.Bytes()...)
+
+	export := buildExport(lists, ExportOptions{})
+	export.Data.History = history
+	if jsonData, err = json.Marshal(export); err != nil {
+		b.Fatal(err)
+	}
+	clearImportedData(b)
+	return csvData, jsonData
+}
+
+// clearImportedData deletes every list and history entry
+func clearImportedData(b *testing.B) {
+	b.Helper()
+	for _, table := range []string{"items", "sections", "lists", "item_history"} {
+		if _, err := db.DB.Exec("DELETE FROM " + table); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkImport imports 20000 rows into an empty database, and over the lists it created with replace
+func BenchmarkImport(b *testing.B) {
+	setupTestDB(b)
+	csvData, jsonData := largeImportFiles(b)
+
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{{"export.csv", csvData}, {"export.json", jsonData}} {
+		for _, resolution := range []string{"skip", "replace"} {
+			b.Run(file.name+"/"+resolution, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(file.data)))
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					clearImportedData(b)
+					if resolution == "replace" {
+						if _, err := Import(bytes.NewReader(file.data), ImportOptions{Filename: file.name}); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.StartTimer()
+
+					result, err := Import(bytes.NewReader(file.data), ImportOptions{Filename: file.name, ConflictResolution: resolution})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if result.ImportedItems != 18000 || result.ImportedHistory != 2000 {
+						b.Fatalf("imported %d items and %d history entries, want 18000 and 2000", result.ImportedItems, result.ImportedHistory)
+					}
+				}
+			})
+		}
+	}
+}
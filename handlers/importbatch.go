@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shopping-list/db"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImportRollbackResult describes what rolling back an import deleted and restored
+type ImportRollbackResult struct {
+	Success           bool           `json:"success"`
+	Deleted           map[string]int `json:"deleted"` // Rows by kind, rows within deleted lists, sections and templates are not counted
+	RestoredLists     int            `json:"restored_lists"`
+	RestoredTemplates int            `json:"restored_templates"`
+}
+
+// GetImports returns the recorded imports, newest first
+func GetImports(c *fiber.Ctx) error {
+	batches, err := db.GetImportBatches()
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to fetch imports")
+	}
+	return c.JSON(batches)
+}
+
+// RollbackImport deletes the rows an import created and restores the lists and templates it replaced,
+// in one transaction. It refuses when rows of the import were changed afterwards, unless force=true.
+// Items an import merged into existing lists keep the flags it set
+func RollbackImport(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return Fail(c, ErrCodeInvalidID, "Invalid import ID")
+	}
+	force := c.Query("force") == "true" || c.FormValue("force") == "true"
+
+	end, err := BeginOperation(OperationImport)
+	var busy *OperationBusyError
+	if errors.As(err, &busy) {
+		return OperationConflict(c, busy)
+	}
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to start rollback")
+	}
+	defer func() { end(responseError(c)) }()
+
+	result, appErr := rollbackImport(id, force)
+	if appErr != nil {
+		return Fail(c, appErr.Code, appErr.Message)
+	}
+	return c.JSON(result)
+}
+
+func rollbackImport(id int64, force bool) (*ImportRollbackResult, *AppError) {
+	tx, err := db.BeginWrite()
+	if err != nil {
+		return nil, NewError(ErrCodeDB, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	batch, err := db.GetImportBatchTx(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewError(ErrCodeNotFound, "Import not found")
+	}
+	if err != nil {
+		return nil, NewError(ErrCodeDB, "Failed to fetch import")
+	}
+	if batch.Status == db.ImportBatchRolledBack {
+		return nil, NewError(ErrCodeAlreadyRolledBack, "Import was already rolled back")
+	}
+
+	if !force {
+		changes, err := db.ImportBatchChangesTx(tx, batch)
+		if err != nil {
+			return nil, NewError(ErrCodeDB, "Failed to check import")
+		}
+		if len(changes) > 0 {
+			return nil, NewError(ErrCodeImportModified, fmt.Sprintf("Rows of this import were changed after it (%s), pass force=true to roll it back anyway", describeChanges(changes)))
+		}
+	}
+
+	deleted, err := db.DeleteImportBatchRowsTx(tx, id)
+	if err != nil {
+		return nil, NewError(ErrCodeDeleteFailed, "Failed to delete imported rows")
+	}
+
+	result := &ImportRollbackResult{Success: true, Deleted: deleted}
+	if batch.Snapshot != "" {
+		var snapshot ExportBody
+		if err := json.Unmarshal([]byte(batch.Snapshot), &snapshot); err != nil {
+			return nil, NewError(ErrCodeInternal, "Failed to read the replaced lists of the import")
+		}
+		if err := restoreSnapshot(tx, &snapshot); err != nil {
+			return nil, NewError(ErrCodeRestoreFailed, "Failed to restore replaced lists")
+		}
+		result.RestoredLists, result.RestoredTemplates = len(snapshot.Lists), len(snapshot.Templates)
+	}
+
+	if err := db.MarkImportBatchRolledBackTx(tx, id); err != nil {
+		return nil, NewError(ErrCodeDB, "Failed to record rollback")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, NewError(ErrCodeCommitFailed, "Failed to commit rollback")
+	}
+	return result, nil
+}
+
+// describeChanges lists changed row counts by kind, like "item: 2, section: 1"
+func describeChanges(changes map[string]int) string {
+	parts := make([]string, 0, len(changes))
+	for kind, count := range changes {
+		parts = append(parts, fmt.Sprintf("%s: %d", kind, count))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// restoreSnapshot recreates the lists and templates an import replaced, lists get new IDs
+func restoreSnapshot(tx *sql.Tx, snapshot *ExportBody) error {
+	writer := db.NewImportWriter(tx)
+	for _, exportList := range snapshot.Lists {
+		list, err := db.CreateListTx(tx, exportList.Name, exportList.Icon)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+		if exportList.IsActive {
+			if _, err := tx.Exec("UPDATE lists SET is_active = (id = ?)", list.ID); err != nil {
+				writer.Close()
+				return err
+			}
+		}
+
+		for i, exportSection := range exportList.Sections {
+			sortOrder := i
+			if exportSection.SortOrder != nil {
+				sortOrder = *exportSection.SortOrder
+			}
+			section, err := db.CreateSectionForListTx(tx, list.ID, exportSection.Name, sortOrder)
+			if err != nil {
+				writer.Close()
+				return err
+			}
+			for j, exportItem := range exportSection.Items {
+				itemOrder := j
+				if exportItem.SortOrder != nil {
+					itemOrder = *exportItem.SortOrder
+				}
+				var priceCents *int64
+				if cents, err := ParsePrice(string(exportItem.Price)); err == nil {
+					priceCents = &cents
+				}
+				err := writer.AddItem(db.ImportItem{
+					SectionID:   section.ID,
+					Name:        exportItem.Name,
+					Description: exportItem.Description,
+					Quantity:    exportItem.Quantity,
+					SortOrder:   itemOrder,
+					Completed:   exportItem.Completed,
+					Uncertain:   exportItem.Uncertain,
+					CreatedAt:   parseImportTime(exportItem.CreatedAt),
+					CompletedAt: parseImportTime(exportItem.CompletedAt),
+					PriceCents:  priceCents,
+					Currency:    exportItem.Currency,
+					DueDate:     exportItem.DueDate,
+				})
+				if err != nil {
+					writer.Close()
+					return err
+				}
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	for _, exportTemplate := range snapshot.Templates {
+		templateID, err := db.CreateTemplateTx(tx, exportTemplate.Name, exportTemplate.Description)
+		if err != nil {
+			return err
+		}
+		for _, item := range exportTemplate.Items {
+			if _, err := db.AddTemplateItemTx(tx, templateID, item.SectionName, item.Name, item.Description); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"shopping-list/db"
+	"strconv"
+	"strings"
+)
+
+// ImportDuplicate is an item a file holds more than once in the same list and section
+// Names are compared case-insensitively and shown as they first appear
+type ImportDuplicate struct {
+	List    string `json:"list"`
+	Section string `json:"section"`
+	Item    string `json:"item"`
+	Count   int    `json:"count"`
+}
+
+// duplicateCounter counts the items of a previewed file by list, section and name
+type duplicateCounter struct {
+	index map[string]int // Lowercased "list\x00section\x00item" -> index in items
+	items []ImportDuplicate
+	total int
+}
+
+func newDuplicateCounter() *duplicateCounter {
+	return &duplicateCounter{index: make(map[string]int)}
+}
+
+// add counts an item, empty names are not items
+func (d *duplicateCounter) add(list, section, item string) {
+	if item == "" {
+		return
+	}
+	d.total++
+	key := strings.ToLower(list) + "\x00" + strings.ToLower(section) + "\x00" + strings.ToLower(item)
+	if i, ok := d.index[key]; ok {
+		d.items[i].Count++
+		return
+	}
+	d.index[key] = len(d.items)
+	d.items = append(d.items, ImportDuplicate{List: list, Section: section, Item: item, Count: 1})
+}
+
+// duplicates returns the items counted more than once, in the order they first appear
+func (d *duplicateCounter) duplicates() []ImportDuplicate {
+	var duplicates []ImportDuplicate
+	for _, item := range d.items {
+		if item.Count > 1 {
+			duplicates = append(duplicates, item)
+		}
+	}
+	return duplicates
+}
+
+// setPreview sets the duplicates and the item count without them on a preview
+func (d *duplicateCounter) setPreview(preview *ImportPreviewResponse) {
+	preview.Duplicates = d.duplicates()
+	preview.ItemsCountDeduplicated = preview.ItemsCount - (d.total - len(d.items))
+}
+
+// dedupedItem is the first of the items an import with DedupeItems collapses, with the flags of all of them
+type dedupedItem struct {
+	id        int64 // 0 until the item is written
+	completed bool
+	uncertain bool
+	changed   bool // Whether the flags changed after the item was queued, it is then in importRun.changed
+}
+
+// addItem queues an item of the import. With DedupeItems an item named like one already imported
+// to the same section is not added, its flags are OR-ed into that item's instead.
+// It reports whether the item was added
+func (r *importRun) addItem(item db.ImportItem) (bool, error) {
+	if !r.opts.DedupeItems {
+		return true, r.writer.AddItem(item)
+	}
+
+	key := strconv.FormatInt(item.SectionID, 10) + "\x00" + strings.ToLower(item.Name)
+	if first, ok := r.deduped[key]; ok {
+		if (item.Completed && !first.completed) || (item.Uncertain && !first.uncertain) {
+			first.completed = first.completed || item.Completed
+			first.uncertain = first.uncertain || item.Uncertain
+			if !first.changed {
+				first.changed = true
+				r.changed = append(r.changed, first)
+			}
+		}
+		r.counts.DedupedItems++
+		return false, nil
+	}
+
+	if err := r.writer.AddItem(item); err != nil {
+		return false, err
+	}
+	first := &dedupedItem{completed: item.Completed, uncertain: item.Uncertain}
+	r.deduped[key] = first
+	r.queued = append(r.queued, first)
+	return true, nil
+}
+
+// mergeItemFlags sets the flags of an existing item matched by merge and reports whether it was the first
+// match. With DedupeItems the flags of every matching item of the file are OR-ed, otherwise the last one wins
+func (r *importRun) mergeItemFlags(id int64, completed, uncertain bool) (bool, error) {
+	matched := false
+	if r.opts.DedupeItems {
+		key := "merged\x00" + strconv.FormatInt(id, 10)
+		if first, ok := r.deduped[key]; ok {
+			completed = completed || first.completed
+			uncertain = uncertain || first.uncertain
+			r.counts.DedupedItems++
+			matched = true
+		}
+		r.deduped[key] = &dedupedItem{id: id, completed: completed, uncertain: uncertain}
+	}
+	return !matched, r.writer.UpdateItemFlags(id, completed, uncertain)
+}
+
+// updateDeduped gives the items written since the last commit their ids and updates the flags of
+// collapsed items that changed, call it after the writer is closed
+func (r *importRun) updateDeduped(ids []int64) error {
+	if !r.opts.DedupeItems {
+		return nil
+	}
+	// Every item of the writer went through addItem, so the ids are in the order they were queued
+	for i, first := range r.queued {
+		if i < len(ids) {
+			first.id = ids[i]
+		}
+	}
+	r.queued = r.queued[:0]
+
+	for _, first := range r.changed {
+		if err := db.SetImportedItemFlagsTx(r.tx, first.id, first.completed, first.uncertain); err != nil {
+			return err
+		}
+		first.changed = false
+	}
+	r.changed = r.changed[:0]
+	return nil
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// mappedColumns are the columns a ColumnMapping can map, in the order of importColumns and the optional columns after them
+var mappedColumns = []string{"list_name", "list_icon", "section_name", "item_name", "item_description", "item_completed", "item_uncertain", "item_quantity",
+	"section_sort_order", "item_sort_order", "item_created_at", "item_completed_at", "item_price", "item_currency", "item_due_date"}
+
+// ColumnMapping maps the import columns to the columns of a CSV or XLSX file from another app
+// item_name must be mapped. Without list_name the items go to a list named after the file,
+// other columns left out are empty, giving the default icon and section and items that are not completed.
+// Values are header names, matched case-insensitively, or zero-based indices
+type ColumnMapping map[string]any
+
+// parseColumnMapping parses the column_mapping form field, nil if it is empty
+func parseColumnMapping(value string) (ColumnMapping, *AppError) {
+	if value == "" {
+		return nil, nil
+	}
+	var mapping ColumnMapping
+	if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+		return nil, NewError(ErrCodeValidation, "column_mapping must be a JSON object of column names to header names or zero-based indices")
+	}
+	return mapping, nil
+}
+
+// resolve returns the index in header of each of mappedColumns, -1 for those not mapped
+func (m ColumnMapping) resolve(header []string) ([]int, *AppError) {
+	for column := range m {
+		if columnIndex(column) < 0 {
+			return nil, NewError(ErrCodeValidation, fmt.Sprintf("Unknown column %q in column_mapping, use %s", column, strings.Join(mappedColumns, ", ")))
+		}
+	}
+	if _, ok := m["item_name"]; !ok {
+		return nil, NewError(ErrCodeValidation, "column_mapping must map item_name")
+	}
+
+	indices := make([]int, len(mappedColumns))
+	for i, column := range mappedColumns {
+		indices[i] = -1
+		switch ref := m[column].(type) {
+		case nil:
+		case float64:
+			if ref != float64(int(ref)) || ref < 0 || int(ref) >= len(header) {
+				return nil, NewError(ErrCodeValidation, fmt.Sprintf("Column %v of %s is out of range, the file has %d columns", ref, column, len(header)))
+			}
+			indices[i] = int(ref)
+		case string:
+			for j, name := range header {
+				if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(ref)) {
+					indices[i] = j
+					break
+				}
+			}
+			if indices[i] < 0 {
+				return nil, NewError(ErrCodeValidation, fmt.Sprintf("Column %q of %s is not in the header", ref, column))
+			}
+		default:
+			return nil, NewError(ErrCodeValidation, "The column of "+column+" must be a header name or a zero-based index")
+		}
+	}
+	return indices, nil
+}
+
+// headerMapping returns the mapping a header implies when it names the import columns in another order, leaves
+// some out or has other columns, so files edited in a spreadsheet still import. Names match case-insensitively.
+// It is nil for headers already in the import column layout and for those naming none of the columns,
+// which are read by position. list_name and item_name are required
+func headerMapping(header []string) (ColumnMapping, *AppError) {
+	mapping := ColumnMapping{}
+	inLayout := len(header) >= 7 && len(header) <= len(mappedColumns)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if inLayout && name != mappedColumns[i] {
+			inLayout = false
+		}
+		if _, seen := mapping[name]; !seen && columnIndex(name) >= 0 {
+			mapping[name] = float64(i)
+		}
+	}
+	if inLayout || len(mapping) == 0 {
+		return nil, nil
+	}
+
+	var missing []string
+	for _, column := range []string{"list_name", "item_name"} {
+		if _, ok := mapping[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, NewError(ErrCodeInvalidFile, "The header is missing the required column "+strings.Join(missing, " and "))
+	}
+	return mapping, nil
+}
+
+func columnIndex(column string) int {
+	for i, c := range mappedColumns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// mapRows returns next with its rows rearranged into the import column layout, header included
+// The header is read and resolved first, so a mapping that does not fit the file fails before anything is imported.
+// Without a mapping the header decides, see headerMapping
+func (m ColumnMapping) mapRows(next func() ([]string, error), filename string) (func() ([]string, error), error) {
+	header, err := next()
+	if err == io.EOF {
+		return next, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		var appErr *AppError
+		if m, appErr = headerMapping(header); appErr != nil {
+			return nil, appErr
+		}
+		if m == nil {
+			headerSent := false
+			return func() ([]string, error) {
+				if !headerSent {
+					headerSent = true
+					return header, nil
+				}
+				return next()
+			}, nil
+		}
+	}
+	indices, appErr := m.resolve(header)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	listName := mappedListName(filename)
+	headerSent := false
+	row := make([]string, len(mappedColumns))
+	return func() ([]string, error) {
+		if !headerSent {
+			headerSent = true
+			return mappedColumns, nil
+		}
+		record, err := next()
+		if err != nil {
+			return nil, err
+		}
+		return mapRecord(record, indices, listName, row), nil
+	}, nil
+}
+
+// mapRecords rearranges whole records, like mapRows, for previews
+func (m ColumnMapping) mapRecords(records [][]string, filename string) ([][]string, *AppError) {
+	if m == nil {
+		var appErr *AppError
+		if m, appErr = headerMapping(records[0]); m == nil {
+			return records, appErr
+		}
+	}
+	indices, appErr := m.resolve(records[0])
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	listName := mappedListName(filename)
+	mapped := make([][]string, 0, len(records))
+	mapped = append(mapped, mappedColumns)
+	for _, record := range records[1:] {
+		mapped = append(mapped, mapRecord(record, indices, listName, make([]string, len(mappedColumns))))
+	}
+	return mapped, nil
+}
+
+// mapRecord fills row with the columns of record at indices, see mapRows
+func mapRecord(record []string, indices []int, listName string, row []string) []string {
+	for i, index := range indices {
+		row[i] = ""
+		if index >= 0 && index < len(record) {
+			row[i] = record[index]
+		}
+	}
+	if strings.TrimSpace(strings.Join(record, "")) == "" {
+		// Empty rows stay empty, so they are skipped like in files without a mapping
+		return row
+	}
+	if marker := strings.TrimSpace(column(record, 0)); marker == "[TEMPLATE]" || marker == "[HISTORY]" {
+		// Template and history rows of an export keep their own layout
+		return record
+	}
+	if indices[0] < 0 {
+		row[0] = listName
+	}
+	return row
+}
+
+// mappedListName is the list of a mapped file without a list_name column, the file name without its extension
+func mappedListName(filename string) string {
+	name := strings.TrimSpace(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return "Import"
+	}
+	return truncateText(name, MaxListNameLength)
+}
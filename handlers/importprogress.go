@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+)
+
+// importProgressRows is how often an import with an ID broadcasts import_progress, in rows
+const importProgressRows = 250
+
+// ImportProgress is the data of import_progress events
+type ImportProgress struct {
+	ImportID          string `json:"import_id"`
+	Rows              int    `json:"rows"`            // CSV or XLSX rows, or items and history entries of an export, processed so far
+	Total             int    `json:"total,omitempty"` // total_items passed with the import, usually the items_count of its preview
+	ImportedLists     int    `json:"imported_lists"`
+	ImportedItems     int    `json:"imported_items"`
+	ImportedTemplates int    `json:"imported_templates"`
+	ImportedHistory   int    `json:"imported_history"`
+}
+
+// ImportFinished is the data of the import_finished event that ends every import with an ID
+type ImportFinished struct {
+	ImportID string        `json:"import_id"`
+	Success  bool          `json:"success"`
+	Result   *ImportResult `json:"result,omitempty"` // What was imported, or committed before a failure
+	Warnings int           `json:"warnings"`
+	Code     string        `json:"code,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// ImportAccepted is the response of an import started with async=true
+type ImportAccepted struct {
+	Success  bool   `json:"success"`
+	ImportID string `json:"import_id"`
+}
+
+// newImportID returns a random ID for the events of an import
+func newImportID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// progress broadcasts import_progress every importProgressRows rows of an import with an ID
+func (r *importRun) progress() {
+	if r.opts.ImportID == "" || r.rows%importProgressRows != 0 {
+		return
+	}
+	BroadcastUpdate("import_progress", ImportProgress{
+		ImportID:          r.opts.ImportID,
+		Rows:              r.rows,
+		Total:             r.opts.TotalRows,
+		ImportedLists:     r.counts.ImportedLists,
+		ImportedItems:     r.counts.ImportedItems,
+		ImportedTemplates: r.counts.ImportedTemplates,
+		ImportedHistory:   r.counts.ImportedHistory,
+	})
+}
+
+// runImport imports like Import and broadcasts import_finished when opts has an ImportID
+func runImport(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	result, err := Import(r, opts)
+	if result != nil {
+		result.ImportID = opts.ImportID
+	}
+	if opts.ImportID != "" {
+		BroadcastUpdate("import_finished", importFinished(opts.ImportID, result, err))
+	}
+	return result, err
+}
+
+// importFinished describes the outcome of an import for its import_finished event
+func importFinished(id string, result *ImportResult, err error) ImportFinished {
+	finished := ImportFinished{ImportID: id, Success: err == nil, Result: result}
+	if result != nil {
+		finished.Warnings = len(result.Warnings) + result.MoreWarnings
+	}
+	if err == nil {
+		return finished
+	}
+
+	finished.Code, finished.Error = ErrCodeInternal, "Failed to read file"
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		finished.Code, finished.Error = appErr.Code, appErr.Message
+	}
+	var rejected *ImportRejectedError
+	if errors.As(err, &rejected) {
+		finished.Warnings = len(rejected.Warnings) + rejected.MoreWarnings
+	}
+	var partial *ImportPartialError
+	if errors.As(err, &partial) {
+		committed := partial.Committed
+		finished.Result = &committed
+		finished.Warnings = len(committed.Warnings) + committed.MoreWarnings
+	}
+	return finished
+}
+
+// spoolImport copies an uploaded file to a temporary file that outlives the request, for async imports
+// The caller closes and removes it
+func spoolImport(file *multipart.FileHeader) (*os.File, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "koffan-import-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// importAsync runs an import in the background, holding the operation lock until it is done
+func importAsync(tmp *os.File, opts ImportOptions, end func(error)) {
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	_, err := runImport(tmp, opts)
+	if err != nil {
+		log.Printf("[IMPORT] Import %s of %s failed: %v", opts.ImportID, opts.Filename, err)
+	}
+	end(err)
+}
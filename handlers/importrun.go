@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"shopping-list/db"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// importChunkRows is the number of rows, or items and history entries of an export, committed at a time
+const importChunkRows = 500
+
+// MaxImportSize returns the largest file an import accepts, MAX_IMPORT_MB or 50MB
+// Imports are streamed, previews hold the whole file and keep the lower MaxImportFileSize
+func MaxImportSize() int64 {
+	if mb := getEnvInt("MAX_IMPORT_MB", 50); mb > 0 {
+		return int64(mb) << 20
+	}
+	return 50 << 20
+}
+
+// ImportPartialError is an import that failed after some of its rows were committed
+type ImportPartialError struct {
+	*AppError
+	Committed     ImportResult // Counts of what was committed
+	CommittedRows int
+}
+
+func (e *ImportPartialError) Unwrap() error {
+	return e.AppError
+}
+
+// ImportPartialResponse is the error body of an import that failed after some of its rows were committed
+type ImportPartialResponse struct {
+	ErrorResponse
+	Committed     ImportResult `json:"committed"`
+	CommittedRows int          `json:"committed_rows"` // CSV or XLSX rows, or items and history entries of an export
+}
+
+// ImportRejectedError is a strict import rejected because of its warnings, nothing was imported
+type ImportRejectedError struct {
+	*AppError
+	Warnings     []ImportWarning
+	MoreWarnings int
+}
+
+func (e *ImportRejectedError) Unwrap() error {
+	return e.AppError
+}
+
+// ImportRejectedResponse is the error body of a strict import rejected because of its warnings
+type ImportRejectedResponse struct {
+	ErrorResponse
+	Warnings     []ImportWarning `json:"warnings"`
+	MoreWarnings int             `json:"more_warnings,omitempty"`
+}
+
+// importFailed sends the error of a failed import, with what was committed if it failed part way
+// or the warnings that rejected a strict import
+func importFailed(c *fiber.Ctx, err error) error {
+	var rejected *ImportRejectedError
+	if errors.As(err, &rejected) {
+		return c.Status(StatusForCode(rejected.Code)).JSON(ImportRejectedResponse{
+			ErrorResponse: NewErrorResponse(c, rejected.Code, rejected.Message),
+			Warnings:      rejected.Warnings,
+			MoreWarnings:  rejected.MoreWarnings,
+		})
+	}
+	var partial *ImportPartialError
+	if errors.As(err, &partial) {
+		return c.Status(StatusForCode(partial.Code)).JSON(ImportPartialResponse{
+			ErrorResponse: NewErrorResponse(c, partial.Code, partial.Message),
+			Committed:     partial.Committed,
+			CommittedRows: partial.CommittedRows,
+		})
+	}
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return Fail(c, appErr.Code, appErr.Message)
+	}
+	return Fail(c, ErrCodeInternal, "Failed to read file")
+}
+
+// importRun holds the transaction, counts and warnings of an import
+// The transaction is committed every importChunkRows rows, so a large file is never held in one transaction.
+// A failure after a commit leaves the committed rows imported and is reported as *ImportPartialError.
+// Strict imports are committed at once, so their warnings can reject them whole
+type importRun struct {
+	opts     ImportOptions
+	tx       *sql.Tx
+	writer   *db.ImportWriter
+	counts   ImportResult
+	warnings importWarnings
+
+	rows          int
+	committedRows int
+	committed     ImportResult
+
+	batch    importBatch
+	finished bool
+
+	// deduped holds the first item of each section and name with DedupeItems, see addItem
+	deduped map[string]*dedupedItem
+	queued  []*dedupedItem // Items added since the last commit, in order
+	changed []*dedupedItem // Items whose flags changed since the last commit
+}
+
+// importBatch records what an import created and what it replaced, written with each commit so a rollback
+// through POST /api/imports/:id/rollback undoes what was committed
+type importBatch struct {
+	id       int64
+	created  map[string][]int64 // Row kind -> ids created since the last commit
+	snapshot ExportBody         // Lists and templates deleted by replace
+	replaced bool               // Whether snapshot changed since the last commit
+}
+
+// beginImport starts the first transaction of an import and records its batch
+func beginImport(opts ImportOptions) (*importRun, error) {
+	run := &importRun{opts: opts, deduped: make(map[string]*dedupedItem)}
+	if err := run.begin(); err != nil {
+		return nil, NewError(ErrCodeDB, "Failed to start transaction")
+	}
+	id, err := db.CreateImportBatchTx(run.tx, opts.Filename, opts.ConflictResolution)
+	if err != nil {
+		run.rollback()
+		return nil, NewError(ErrCodeDB, "Failed to record import")
+	}
+	run.batch = importBatch{id: id, created: make(map[string][]int64)}
+	return run, nil
+}
+
+// created records a row created by the import
+func (r *importRun) created(kind string, id int64) {
+	r.batch.created[kind] = append(r.batch.created[kind], id)
+}
+
+// replaceList snapshots an existing list before replace deletes it
+func (r *importRun) replaceList(id int64) error {
+	list, err := db.GetListByID(id)
+	if err != nil {
+		return err
+	}
+	sections, err := db.GetSectionsByList(id)
+	if err != nil {
+		return err
+	}
+	r.batch.snapshot.Lists = append(r.batch.snapshot.Lists, toExportList(list, sections))
+	r.batch.replaced = true
+	return nil
+}
+
+// replaceTemplate snapshots an existing template before replace deletes it
+func (r *importRun) replaceTemplate(id int64) error {
+	tmpl, err := db.GetTemplateByID(id)
+	if err != nil {
+		return err
+	}
+	r.batch.snapshot.Templates = append(r.batch.snapshot.Templates, toExportTemplate(tmpl))
+	r.batch.replaced = true
+	return nil
+}
+
+// recordBatch writes what was created and replaced since the last commit to the batch
+func (r *importRun) recordBatch() error {
+	items, history := r.writer.Created()
+	r.batch.created[db.ImportRowItem] = append(r.batch.created[db.ImportRowItem], items...)
+	r.batch.created[db.ImportRowHistory] = append(r.batch.created[db.ImportRowHistory], history...)
+	for kind, ids := range r.batch.created {
+		if err := db.AddImportBatchRowsTx(r.tx, r.batch.id, kind, ids); err != nil {
+			return err
+		}
+	}
+	if r.batch.replaced {
+		snapshot, err := json.Marshal(r.batch.snapshot)
+		if err != nil {
+			return err
+		}
+		if err := db.SetImportBatchSnapshotTx(r.tx, r.batch.id, string(snapshot)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *importRun) begin() error {
+	tx, err := db.BeginWrite()
+	if err != nil {
+		return err
+	}
+	r.tx, r.writer = tx, db.NewImportWriter(tx)
+	return nil
+}
+
+// row counts a processed row, committing and starting a new transaction every importChunkRows rows
+func (r *importRun) row() error {
+	r.rows++
+	r.progress()
+	if r.opts.Strict || r.rows-r.committedRows < importChunkRows {
+		return nil
+	}
+	if err := r.commit(); err != nil {
+		return r.fail(NewError(ErrCodeCommitFailed, "Failed to commit import"))
+	}
+	if err := r.begin(); err != nil {
+		return r.fail(NewError(ErrCodeDB, "Failed to start transaction"))
+	}
+	return nil
+}
+
+// commit writes the buffered items and the batch and commits the transaction
+func (r *importRun) commit() error {
+	if err := r.writer.Close(); err != nil {
+		return err
+	}
+	if err := r.recordBatch(); err != nil {
+		return err
+	}
+	items, _ := r.writer.Created()
+	if err := r.updateDeduped(items); err != nil {
+		return err
+	}
+	if err := r.tx.Commit(); err != nil {
+		return err
+	}
+	r.tx = nil
+	r.batch.created = make(map[string][]int64)
+	r.batch.replaced = false
+	r.committedRows = r.rows
+	r.committed = r.result()
+	return nil
+}
+
+// rollback discards the rows since the last commit, it does nothing after finish
+// The batch of an import that committed rows before failing is marked failed
+func (r *importRun) rollback() {
+	if r.tx != nil {
+		r.writer.Close()
+		r.tx.Rollback()
+		r.tx = nil
+	}
+	if r.committedRows > 0 && !r.finished {
+		db.FinishImportBatch(r.batch.id, db.ImportBatchFailed)
+		r.finished = true
+	}
+}
+
+// fail returns err, as *ImportPartialError if rows were committed before it
+func (r *importRun) fail(err *AppError) error {
+	if r.committedRows == 0 {
+		return err
+	}
+	committed := r.committed
+	committed.Success = false
+	return &ImportPartialError{AppError: err, Committed: committed, CommittedRows: r.committedRows}
+}
+
+// finish commits the rest of the import and returns its result
+func (r *importRun) finish() (*ImportResult, error) {
+	if r.opts.Strict && len(r.warnings.list) > 0 {
+		return nil, &ImportRejectedError{AppError: r.warnings.rejected(), Warnings: r.warnings.list, MoreWarnings: r.warnings.more}
+	}
+	if err := db.FinishImportBatchTx(r.tx, r.batch.id, db.ImportBatchCompleted); err != nil {
+		return nil, r.fail(NewError(ErrCodeCommitFailed, "Failed to commit import"))
+	}
+	if err := r.commit(); err != nil {
+		return nil, r.fail(NewError(ErrCodeCommitFailed, "Failed to commit import"))
+	}
+	r.finished = true
+	result := r.result()
+	return &result, nil
+}
+
+func (r *importRun) result() ImportResult {
+	result := r.counts
+	result.Success = true
+	result.Message = importSummary(r.opts.Lang, result.ImportedLists, result.ImportedItems, result.SkippedLists)
+	result.Warnings, result.MoreWarnings = r.warnings.list, r.warnings.more
+	return result
+}
+
+// importJSON imports a JSON export while decoding it, one list, template or history entry at a time
+// Keys are matched case-insensitively and unknown ones are skipped, like json.Unmarshal into ExportData
+func importJSON(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	imp, err := newExportImporter(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer imp.run.rollback()
+
+	// The version is checked when the data starts, exports write it first. A version after the data
+	// is checked when it is read, which fails the import after the rows before it
+	var version, appVersion string
+	var schema exportSchema
+	dataRead := false
+	checkVersion := func() error {
+		var appErr *AppError
+		if schema, appErr = exportSchemaFor(version, appVersion); appErr != nil {
+			return imp.run.fail(appErr)
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(r)
+	err = decodeJSONObject(dec, func(key string) error {
+		switch strings.ToLower(key) {
+		case "version":
+			if err := dec.Decode(&version); err != nil {
+				return err
+			}
+			if dataRead {
+				return checkVersion()
+			}
+			return nil
+		case "app_version":
+			return dec.Decode(&appVersion)
+		case "data":
+		default:
+			return skipJSONValue(dec)
+		}
+		if err := checkVersion(); err != nil {
+			return err
+		}
+		dataRead = true
+		return decodeJSONObject(dec, func(key string) error {
+			switch strings.ToLower(key) {
+			case "lists":
+				return decodeJSONArray(dec, func() error {
+					var list ExportList
+					if err := dec.Decode(&list); err != nil {
+						return err
+					}
+					schema.list(&list)
+					return imp.list(list)
+				})
+			case "templates":
+				return decodeJSONArray(dec, func() error {
+					var template ExportTemplate
+					if err := dec.Decode(&template); err != nil {
+						return err
+					}
+					schema.template(&template)
+					return imp.template(template)
+				})
+			case "history":
+				return decodeJSONArray(dec, func() error {
+					var history ExportHistory
+					if err := dec.Decode(&history); err != nil {
+						return err
+					}
+					schema.history(&history)
+					return imp.history(history)
+				})
+			}
+			return skipJSONValue(dec)
+		})
+	})
+	if err == nil && !dataRead {
+		err = checkVersion()
+	}
+	if err == nil {
+		// Only whitespace may follow the export
+		if _, err = dec.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = errors.New("data after the export")
+		}
+	}
+
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, imp.run.fail(NewError(ErrCodeInvalidFile, "Invalid JSON format"))
+	}
+	return imp.run.finish()
+}
+
+// decodeJSONObject reads an object or null from dec, calling field with each key before its value is read
+func decodeJSONObject(dec *json.Decoder, field func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return errors.New("expected an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := field(tok.(string)); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeJSONArray reads an array or null from dec, calling element for each element
+func decodeJSONArray(dec *json.Decoder, element func() error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return errors.New("expected an array")
+	}
+	for dec.More() {
+		if err := element(); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// skipJSONValue reads the next value of dec without keeping it
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"shopping-list/settings"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	settingAllowPrivateImportURLs = "allow_private_import_urls"
+
+	importURLTimeout      = 10 * time.Second
+	maxImportURLRedirects = 3
+)
+
+func init() {
+	settings.Register(settings.Def{Key: settingAllowPrivateImportURLs, Type: settings.TypeBool, Default: "false", Env: "ALLOW_PRIVATE_IMPORT_URLS"})
+}
+
+// ImportURLRequest is the body of an import or preview from a URL
+type ImportURLRequest struct {
+	URL                 string            `json:"url"`
+	ConflictResolution  string            `json:"conflict_resolution,omitempty"`  // "skip", "replace", "copy", "merge"
+	ConflictResolutions map[string]string `json:"conflict_resolutions,omitempty"` // List name -> resolution, overrides ConflictResolution
+	CopySuffix          string            `json:"copy_suffix,omitempty"`
+	Delimiter           string            `json:"delimiter,omitempty"`
+	ColumnMapping       ColumnMapping     `json:"column_mapping,omitempty"` // Import column -> header name or zero-based index
+	Encoding            string            `json:"encoding,omitempty"`       // utf-8, utf-16, windows-1252 or iso-8859-1, detected when empty
+	DedupeItems         bool              `json:"dedupe_items,omitempty"`   // Collapse items named alike within a section
+	Strict              bool              `json:"strict,omitempty"`         // Reject the import when it has warnings
+	TotalItems          int               `json:"total_items,omitempty"`    // Expected rows for import_progress events
+}
+
+// errPrivateAddress is returned when an import URL resolves to an address that may not be fetched
+var errPrivateAddress = errors.New("private address")
+
+// isPrivateAddress reports whether ip is loopback, private, link-local or otherwise not on the internet
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// newImportURLClient returns a client for fetching imports, refusing private addresses unless allowed
+// Addresses are checked when connecting, so redirects and DNS answers cannot reach them either.
+// Proxies are not used, as the address of the proxy is all that could be checked
+func newImportURLClient(allowPrivate bool) *http.Client {
+	client := NewOutboundClient(importURLTimeout)
+	transport := client.Transport.(*http.Transport)
+	transport.Proxy = nil
+
+	dialer := &net.Dialer{Timeout: importURLTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateAddress(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport.DialContext = dialer.DialContext
+
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxImportURLRedirects {
+			return fmt.Errorf("more than %d redirects", maxImportURLRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	}
+	return client
+}
+
+// fetchImportURL downloads an import file of at most limit bytes, returning its data and a filename for format detection
+// Failures are returned as *AppError with a message that says what went wrong
+func fetchImportURL(ctx context.Context, rawURL string, limit int64) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", NewError(ErrCodeValidation, "URL must be an http or https address")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", NewError(ErrCodeValidation, "Invalid URL")
+	}
+
+	resp, err := newImportURLClient(settings.Bool(settingAllowPrivateImportURLs)).Do(req)
+	if err != nil {
+		if errors.Is(err, errPrivateAddress) {
+			return nil, "", NewError(ErrCodeValidation, "URL points to a private address (set allow_private_import_urls to allow it)")
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, "", NewError(ErrCodeUpstream, "Timed out fetching URL")
+		}
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, "", NewError(ErrCodeUpstream, "Failed to fetch URL: "+err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", NewError(ErrCodeUpstream, "URL returned HTTP "+strconv.Itoa(resp.StatusCode))
+	}
+	tooLarge := NewError(ErrCodeValidation, fmt.Sprintf("File too large (max %dMB)", limit>>20))
+	if resp.ContentLength > limit {
+		return nil, "", tooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", NewError(ErrCodeUpstream, "Failed to read URL: "+err.Error())
+	}
+	if int64(len(data)) > limit {
+		return nil, "", tooLarge
+	}
+
+	// The name after redirects carries the extension, if any
+	return data, path.Base(resp.Request.URL.Path), nil
+}
+
+// PreviewImportURL fetches a file and returns the same preview as an upload
+func PreviewImportURL(c *fiber.Ctx) error {
+	var req ImportURLRequest
+	if err := c.BodyParser(&req); err != nil {
+		return previewError(c, ErrCodeInvalidJSON, "Invalid request")
+	}
+
+	data, filename, err := fetchImportURL(c.UserContext(), req.URL, MaxImportFileSize)
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return previewError(c, appErr.Code, appErr.Message)
+	}
+
+	return previewData(c, data, ImportOptions{
+		Filename:      filename,
+		Delimiter:     req.Delimiter,
+		ColumnMapping: req.ColumnMapping,
+		Encoding:      req.Encoding,
+		Strict:        req.Strict,
+	})
+}
+
+// ImportURL fetches a file and imports it like an upload
+func ImportURL(c *fiber.Ctx) error {
+	var req ImportURLRequest
+	if err := c.BodyParser(&req); err != nil {
+		return Fail(c, ErrCodeInvalidJSON, "Invalid request")
+	}
+
+	end, err := BeginOperation(OperationImport)
+	var busy *OperationBusyError
+	if errors.As(err, &busy) {
+		return OperationConflict(c, busy)
+	}
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to start import")
+	}
+	defer func() { end(responseError(c)) }()
+
+	data, filename, err := fetchImportURL(c.UserContext(), req.URL, MaxImportSize())
+	if err != nil {
+		return importFailed(c, err)
+	}
+
+	if req.Delimiter == "" {
+		req.Delimiter = ","
+	}
+	result, err := runImport(bytes.NewReader(data), ImportOptions{
+		Filename:            filename,
+		ConflictResolution:  req.ConflictResolution,
+		ConflictResolutions: req.ConflictResolutions,
+		CopySuffix:          req.CopySuffix,
+		Delimiter:           req.Delimiter,
+		ColumnMapping:       req.ColumnMapping,
+		Encoding:            req.Encoding,
+		Lang:                RequestLang(c),
+		DedupeItems:         req.DedupeItems,
+		Strict:              req.Strict,
+		ImportID:            newImportID(),
+		TotalRows:           req.TotalItems,
+	})
+	if err != nil {
+		return importFailed(c, err)
+	}
+	return c.JSON(result)
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"os"
+	"shopping-list/db"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultAdminRoutes are the routes restricted by ADMIN_ALLOWED_IPS unless ADMIN_ROUTES is set
+// A trailing "/*" matches any sub-path, a "*" segment matches exactly one path segment,
+// and a leading method such as "PUT " restricts only that method of the path
+var defaultAdminRoutes = []string{
+	"/api/database/clear",
+	"/api/backup/*",
+	"/api/imports/*",
+	"PUT /api/settings",
+	"POST /import/url",
+	"POST /api/admin/search/reindex",
+	"/api/v1/admin/restore",
+	"/api/v1/admin/*",
+	"/api/v1/lists/*/tokens",
+	"/api/v1/lists/*/tokens/*",
+}
+
+// AdminAllowlistConfig holds the IP allowlist for admin and destructive routes
+type AdminAllowlistConfig struct {
+	AllowedIPs []*net.IPNet
+	Routes     []string
+}
+
+// Singleton instance, nil when the allowlist is disabled
+var adminAllowlist *AdminAllowlistConfig
+
+// InitAdminAllowlist reads ADMIN_ALLOWED_IPS and ADMIN_ROUTES from env
+func InitAdminAllowlist() {
+	nets := parseCIDRList(os.Getenv("ADMIN_ALLOWED_IPS"))
+	if len(nets) == 0 {
+		return
+	}
+
+	routes := defaultAdminRoutes
+	if custom := os.Getenv("ADMIN_ROUTES"); custom != "" {
+		routes = nil
+		for _, r := range strings.Split(custom, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				routes = append(routes, r)
+			}
+		}
+	}
+
+	adminAllowlist = &AdminAllowlistConfig{
+		AllowedIPs: nets,
+		Routes:     routes,
+	}
+	log.Printf("[AUTH] Admin IP allowlist enabled: %d network(s), %d route(s), trusted proxy: %v",
+		len(nets), len(routes), isTrustedProxy())
+}
+
+// isTrustedProxy returns true if forwarding headers from a reverse proxy may be trusted
+func isTrustedProxy() bool {
+	return os.Getenv("TRUSTED_PROXY") == "true"
+}
+
+// ClientIP returns the client address of the request
+// X-Real-IP and X-Forwarded-For are only honored when TRUSTED_PROXY is enabled,
+// otherwise the socket address is used so clients cannot spoof their IP
+func ClientIP(c *fiber.Ctx) net.IP {
+	if isTrustedProxy() {
+		if ip := net.ParseIP(strings.TrimSpace(c.Get("X-Real-IP"))); ip != nil {
+			return ip
+		}
+		// The last entry is the one appended by our proxy, earlier ones are client-controlled
+		if xff := c.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := net.ParseIP(strings.TrimSpace(parts[len(parts)-1])); ip != nil {
+				return ip
+			}
+		}
+	}
+	return c.Context().RemoteIP()
+}
+
+// RoutePath returns the path of a request the way the router matches it: routing ignores case and
+// a trailing slash, so guards comparing paths must too or a differently written path slips past them
+func RoutePath(c *fiber.Ctx) string {
+	return normalizeRoutePath(c.Path())
+}
+
+// normalizeRoutePath lowercases path and strips trailing slashes, "/" stays as it is
+func normalizeRoutePath(path string) string {
+	path = strings.ToLower(path)
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		return trimmed
+	}
+	return "/"
+}
+
+// matchRoute reports whether path matches a route pattern, both compared like RoutePath
+func matchRoute(pattern, path string) bool {
+	pattern, path = strings.ToLower(pattern), normalizeRoutePath(path)
+	if strings.HasSuffix(pattern, "/*") {
+		prefix := strings.TrimSuffix(pattern, "/*")
+		if !strings.Contains(prefix, "*") {
+			return path == prefix || strings.HasPrefix(path, prefix+"/")
+		}
+	}
+
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return false
+	}
+	for i, p := range patternParts {
+		if p != "*" && p != pathParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitAdminRoute splits an admin route into its method, empty for any method, and its path pattern
+func splitAdminRoute(route string) (method, pattern string) {
+	if m, p, ok := strings.Cut(strings.TrimSpace(route), " "); ok {
+		return strings.ToUpper(m), strings.TrimSpace(p)
+	}
+	return "", strings.TrimSpace(route)
+}
+
+// matchAdminRoute reports whether a request matches an admin route, an empty method matches any route method
+func matchAdminRoute(route, method, path string) bool {
+	routeMethod, pattern := splitAdminRoute(route)
+	if routeMethod != "" && method != "" && routeMethod != strings.ToUpper(method) {
+		return false
+	}
+	return matchRoute(pattern, path)
+}
+
+// isAdminRoute reports whether the allowlist restricts a request
+func isAdminRoute(method, path string) bool {
+	for _, route := range adminAllowlist.Routes {
+		if matchAdminRoute(route, method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdminIPAllowed reports whether the request's client may use the given admin route with any method
+func IsAdminIPAllowed(c *fiber.Ctx, path string) bool {
+	if adminAllowlist == nil || !isAdminRoute("", path) {
+		return true
+	}
+	return ipInNets(ClientIP(c), adminAllowlist.AllowedIPs)
+}
+
+// UnmatchedAdminRoutes returns the admin routes that match no route registered on app
+func UnmatchedAdminRoutes(app *fiber.App) []string {
+	routes := defaultAdminRoutes
+	if adminAllowlist != nil {
+		routes = adminAllowlist.Routes
+	}
+
+	var unmatched []string
+	for _, route := range routes {
+		matched := false
+		for _, r := range app.GetRoutes(true) {
+			if matchAdminRoute(route, r.Method, samplePath(r.Path)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, route)
+		}
+	}
+	return unmatched
+}
+
+// samplePath returns a request path the registered route path matches, filling in its parameters
+func samplePath(routePath string) string {
+	parts := strings.Split(routePath, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") || strings.HasPrefix(p, "*") || strings.HasPrefix(p, "+") {
+			parts[i] = "1"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// AdminAllowlistMiddleware blocks admin routes for clients outside ADMIN_ALLOWED_IPS
+func AdminAllowlistMiddleware(c *fiber.Ctx) error {
+	if adminAllowlist == nil {
+		return c.Next()
+	}
+
+	path := RoutePath(c)
+	if !isAdminRoute(c.Method(), path) {
+		return c.Next()
+	}
+
+	ip := ClientIP(c)
+	if ipInNets(ip, adminAllowlist.AllowedIPs) {
+		return c.Next()
+	}
+
+	log.Printf("[AUTH] Blocked %s %s from %s (not in admin allowlist)", c.Method(), path, ip)
+	if err := db.AddAuditLog("ip_blocked", GetRemoteUser(c), ip.String(), c.Method()+" "+path, RequestID(c)); err != nil {
+		log.Printf("[AUTH] Failed to write audit log: %v", err)
+	}
+
+	return Fail(c, ErrCodeIPBlocked, "Access from this IP address is not allowed")
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newAllowlistApp enables the allowlist from env and returns an app guarded by it
+// Every route answers 200, so the status shows whether the middleware let the request through
+func newAllowlistApp(t *testing.T, allowed, trustedProxy string) *fiber.App {
+	t.Helper()
+	setupTestDB(t)
+	t.Setenv("ADMIN_ALLOWED_IPS", allowed)
+	t.Setenv("ADMIN_ROUTES", "")
+	t.Setenv("TRUSTED_PROXY", trustedProxy)
+	adminAllowlist = nil
+	InitAdminAllowlist()
+	t.Cleanup(func() { adminAllowlist = nil })
+
+	app := fiber.New()
+	app.Use(AdminAllowlistMiddleware)
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return app
+}
+
+func doRequest(t *testing.T, app *fiber.App, method, path string, headers map[string]string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/api/database/clear", "/api/database/clear", true},
+		{"/api/database/clear", "/api/database/clear/", true},
+		{"/api/database/clear", "/API/Database/Clear", true},
+		{"/api/database/clear", "/api/database/clearer", false},
+		{"/api/v1/admin/*", "/api/v1/admin", true},
+		{"/api/v1/admin/*", "/api/v1/admin/restore", true},
+		{"/api/v1/admin/*", "/api/v1/Admin/Restore/", true},
+		{"/api/v1/admin/*", "/api/v1/administrator", false},
+		{"/api/v1/lists/*/tokens", "/api/v1/lists/7/tokens", true},
+		{"/api/v1/lists/*/tokens", "/API/V1/LISTS/7/TOKENS", true},
+		{"/api/v1/lists/*/tokens", "/api/v1/lists/7/items", false},
+		{"/api/v1/lists/*/tokens", "/api/v1/lists/7/tokens/3", false},
+		{"/API/Backup/*", "/api/backup/download", true},
+	}
+	for _, tt := range tests {
+		if got := matchRoute(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRoute(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchAdminRoute(t *testing.T) {
+	tests := []struct {
+		route, method, path string
+		want                bool
+	}{
+		{"PUT /api/settings", "PUT", "/api/settings", true},
+		{"PUT /api/settings", "put", "/API/Settings/", true},
+		{"PUT /api/settings", "GET", "/api/settings", false},
+		{"PUT /api/settings", "PUT", "/api/settings/language", false},
+		{"PUT /api/settings", "", "/api/settings", true},
+		{"post /import/url", "POST", "/import/url", true},
+		{"POST /import/url", "POST", "/import/url/preview", false},
+		{"/api/database/clear", "GET", "/api/database/clear", true},
+		{" /api/database/clear ", "POST", "/api/database/clear", true},
+	}
+	for _, tt := range tests {
+		if got := matchAdminRoute(tt.route, tt.method, tt.path); got != tt.want {
+			t.Errorf("matchAdminRoute(%q, %q, %q) = %v, want %v", tt.route, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUnmatchedAdminRoutes(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("ADMIN_ALLOWED_IPS", "10.0.0.0/8")
+	t.Setenv("ADMIN_ROUTES", "PUT /api/settings, GET /api/settings/export, /api/v1/lists/*/tokens, /backups/*")
+	adminAllowlist = nil
+	InitAdminAllowlist()
+	t.Cleanup(func() { adminAllowlist = nil })
+
+	app := fiber.New()
+	app.Put("/api/settings", func(c *fiber.Ctx) error { return nil })
+	app.Post("/api/settings/export", func(c *fiber.Ctx) error { return nil })
+	app.Get("/api/v1/lists/:id/tokens", func(c *fiber.Ctx) error { return nil })
+
+	got := UnmatchedAdminRoutes(app)
+	if want := []string{"GET /api/settings/export", "/backups/*"}; !slices.Equal(got, want) {
+		t.Errorf("UnmatchedAdminRoutes() = %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeRoutePath(t *testing.T) {
+	tests := map[string]string{
+		"/":                      "/",
+		"//":                     "/",
+		"/Login":                 "/login",
+		"/api/v1/Admin/restore/": "/api/v1/admin/restore",
+		"/api/database/clear//":  "/api/database/clear",
+	}
+	for in, want := range tests {
+		if got := normalizeRoutePath(in); got != want {
+			t.Errorf("normalizeRoutePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAdminAllowlistIgnoresProxyHeadersWhenUntrusted(t *testing.T) {
+	// app.Test connections report 0.0.0.0 as the socket address
+	app := newAllowlistApp(t, "10.0.0.0/8", "false")
+
+	spoofed := map[string]string{"X-Real-IP": "10.0.0.5", "X-Forwarded-For": "10.0.0.6"}
+	if got := doRequest(t, app, "POST", "/api/database/clear", spoofed); got != fiber.StatusForbidden {
+		t.Errorf("spoofed proxy headers: got %d, want 403", got)
+	}
+	if got := doRequest(t, app, "GET", "/api/v1/lists", spoofed); got != fiber.StatusOK {
+		t.Errorf("unrestricted route: got %d, want 200", got)
+	}
+}
+
+func TestAdminAllowlistUsesSocketAddressWhenUntrusted(t *testing.T) {
+	app := newAllowlistApp(t, "0.0.0.0", "false")
+
+	headers := map[string]string{"X-Real-IP": "8.8.8.8"}
+	if got := doRequest(t, app, "POST", "/api/database/clear", headers); got != fiber.StatusOK {
+		t.Errorf("allowed socket address: got %d, want 200", got)
+	}
+}
+
+func TestAdminAllowlistTrustedProxy(t *testing.T) {
+	app := newAllowlistApp(t, "10.0.0.0/8, 192.168.1.10", "true")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"real ip in cidr", map[string]string{"X-Real-IP": "10.0.0.5"}, fiber.StatusOK},
+		{"real ip single address", map[string]string{"X-Real-IP": "192.168.1.10"}, fiber.StatusOK},
+		{"real ip next to single address", map[string]string{"X-Real-IP": "192.168.1.11"}, fiber.StatusForbidden},
+		{"real ip outside", map[string]string{"X-Real-IP": "8.8.8.8"}, fiber.StatusForbidden},
+		{"ipv4-mapped ipv6", map[string]string{"X-Real-IP": "::ffff:10.0.0.1"}, fiber.StatusOK},
+		// Only the last entry is added by the proxy, a client can prepend anything
+		{"forwarded spoofed first entry", map[string]string{"X-Forwarded-For": "10.1.1.1, 8.8.8.8"}, fiber.StatusForbidden},
+		{"forwarded last entry", map[string]string{"X-Forwarded-For": "8.8.8.8, 10.1.1.1"}, fiber.StatusOK},
+		{"no headers falls back to socket", nil, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := doRequest(t, app, "POST", "/api/v1/admin/restore", tt.headers); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAdminAllowlistIPv6(t *testing.T) {
+	app := newAllowlistApp(t, "fd00::/8,2001:db8::1", "true")
+
+	tests := []struct {
+		ip   string
+		want int
+	}{
+		{"fd00::1", fiber.StatusOK},
+		{"fdff:1234::abcd", fiber.StatusOK},
+		{"2001:db8::1", fiber.StatusOK},
+		{"2001:db8::2", fiber.StatusForbidden},
+		{"fe80::1", fiber.StatusForbidden},
+		{"10.0.0.1", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{"X-Real-IP": tt.ip}
+		if got := doRequest(t, app, "DELETE", "/api/v1/lists/3/tokens/9", headers); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAdminAllowlistMixedCasePaths(t *testing.T) {
+	app := newAllowlistApp(t, "10.0.0.0/8", "false")
+
+	// The router matches these to the admin handlers, so the guard has to as well
+	requests := []struct{ method, path string }{
+		{"POST", "/api/v1/Admin/restore"},
+		{"POST", "/API/V1/ADMIN/RESTORE"},
+		{"POST", "/API/database/clear"},
+		{"POST", "/api/database/clear/"},
+		{"POST", "/api/V1/lists/3/Tokens"},
+		{"POST", "/Api/Backup/Push/"},
+		{"PUT", "/API/Settings"},
+		{"POST", "/Import/URL/"},
+		{"POST", "/api/Admin/Search/Reindex"},
+	}
+	for _, r := range requests {
+		if got := doRequest(t, app, r.method, r.path, nil); got != fiber.StatusForbidden {
+			t.Errorf("%s %s: got %d, want 403", r.method, r.path, got)
+		}
+	}
+}
+
+func TestAdminAllowlistMethodRoutes(t *testing.T) {
+	app := newAllowlistApp(t, "10.0.0.0/8", "false")
+
+	// Reading the settings and previewing an import change nothing and stay open
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/settings", fiber.StatusOK},
+		{"PUT", "/api/settings", fiber.StatusForbidden},
+		{"PUT", "/api/settings/language", fiber.StatusOK},
+		{"POST", "/import/url/preview", fiber.StatusOK},
+		{"POST", "/import/url", fiber.StatusForbidden},
+		{"POST", "/api/admin/search/reindex", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := doRequest(t, app, tt.method, tt.path, nil); got != tt.want {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAdminAllowlistDenialEnvelope(t *testing.T) {
+	newAllowlistApp(t, "10.0.0.0/8", "false")
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(RequestIDMiddleware)
+	app.Use(AdminAllowlistMiddleware)
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	req := httptest.NewRequest("POST", "/api/v1/admin/clear", nil)
+	req.Header.Set(HeaderRequestID, "blocked-1")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusForbidden || errorCodeOf(t, string(data)) != ErrCodeIPBlocked {
+		t.Errorf("blocked request: %d %s, want 403 %s", resp.StatusCode, data, ErrCodeIPBlocked)
+	}
+
+	// The denial is audited with the request it belongs to
+	entries, err := db.GetAuditLog(10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("audit log = %+v, %v, want one entry", entries, err)
+	}
+	if e := entries[0]; e.Action != "ip_blocked" || e.Details != "POST /api/v1/admin/clear" || e.RequestID != "blocked-1" {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
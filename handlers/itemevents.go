@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"log"
+	"shopping-list/db"
+	"shopping-list/settings"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// HeaderDisplayName names the person behind a shared token or session in the item history
+	HeaderDisplayName = "X-Display-Name"
+
+	maxDisplayNameLength = 100
+
+	settingItemEventsRetentionDays = "item_events_retention_days"
+)
+
+func init() {
+	settings.Register(settings.Def{Key: settingItemEventsRetentionDays, Type: settings.TypeInt, Default: "90",
+		Env: "ITEM_EVENTS_RETENTION_DAYS", Min: 0, Max: 3650})
+}
+
+// ItemEventsRetentionDays returns how many days item events are kept, 0 keeps them forever
+func ItemEventsRetentionDays() int {
+	return settings.Int(settingItemEventsRetentionDays)
+}
+
+// PruneItemEvents removes the item events older than the retention and returns how many
+func PruneItemEvents(now time.Time) (int64, error) {
+	days := ItemEventsRetentionDays()
+	if days == 0 {
+		return 0, nil
+	}
+	return db.DeleteItemEventsBefore(now.AddDate(0, 0, -days).Unix())
+}
+
+// RequestActor returns who made a request for the item history: the X-Display-Name the client sent,
+// else the API token, else the user of proxy auth. tokenName is the API token, empty for the web UI
+func RequestActor(c *fiber.Ctx) (actor, tokenName string) {
+	tokenName, _ = c.Locals(LocalsTokenName).(string)
+	actor = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, c.Get(HeaderDisplayName))
+	actor = truncateText(strings.TrimSpace(actor), maxDisplayNameLength)
+	if actor == "" {
+		actor = tokenName
+	}
+	if actor == "" {
+		actor = GetRemoteUser(c)
+	}
+	return actor, tokenName
+}
+
+// RecordItemEvent records a change of an item made by the request, before is nil for creates and restores
+// and after for deletes. Updates that changed nothing are not recorded, and failures are only logged
+func RecordItemEvent(c *fiber.Ctx, action string, before, after *db.Item) {
+	event := ItemEventFor(c, action, before, after)
+	if event == nil {
+		return
+	}
+	if err := db.AddItemEvent(event); err != nil {
+		log.Printf("[HISTORY] Failed to record %s of item %d: %v", action, event.ItemID, err)
+	}
+}
+
+// ItemEventFor returns the event RecordItemEvent would record, nil when there is nothing to record
+func ItemEventFor(c *fiber.Ctx, action string, before, after *db.Item) *db.ItemEvent {
+	item := after
+	if item == nil {
+		item = before
+	}
+	changes := db.ItemChanges(before, after)
+	if len(changes) == 0 && before != nil && after != nil {
+		return nil
+	}
+	listID, err := db.GetSectionListID(item.SectionID)
+	if err != nil {
+		log.Printf("[HISTORY] Failed to record %s of item %d: %v", action, item.ID, err)
+		return nil
+	}
+	if before != nil && after != nil && before.SectionID != after.SectionID {
+		if fromListID, err := db.GetSectionListID(before.SectionID); err == nil && fromListID != listID {
+			changes["list_id"] = db.ItemChange{Old: fromListID, New: listID}
+		}
+	}
+
+	event := &db.ItemEvent{ItemID: item.ID, ListID: listID, ItemName: item.Name, Action: action, Changes: changes}
+	event.Actor, event.TokenName = RequestActor(c)
+	return event
+}
@@ -52,16 +52,30 @@ func CreateItem(c *fiber.Ctx) error {
 		}
 	}
 
-	item, err := db.CreateItem(sectionID, name, description, quantity)
+	priceCents, currency, _, err := formPrice(c, &db.Item{})
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	dueDate, _, err := formDueDate(c, "")
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+
+	// The item and its price and due date are written in one INSERT
+	item, err := db.CreateItemWithFields(sectionID, db.ItemFields{
+		Name: name, Description: description, Quantity: quantity,
+		Price: &db.ItemPrice{Cents: priceCents, Currency: currency}, DueDate: &dueDate,
+	})
 	if err != nil {
 		return c.Status(500).SendString("Failed to create item")
 	}
 
 	// Save to item history for auto-completion
 	db.SaveItemHistory(name, sectionID)
+	RecordItemEvent(c, db.ItemEventCreate, nil, item)
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_created", item)
+	BroadcastFrom(c, "item_created", item)
 
 	// Return the new item partial for HTMX
 	return c.Render("partials/item", fiber.Map{
@@ -70,7 +84,7 @@ func CreateItem(c *fiber.Ctx) error {
 	}, "")
 }
 
-// UpdateItem updates an item's name, description and quantity
+// UpdateItem updates an item's name, description, quantity and, when the form sends them, price, currency and due date
 func UpdateItem(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
@@ -98,13 +112,32 @@ func UpdateItem(c *fiber.Ctx) error {
 		}
 	}
 
-	item, err := db.UpdateItem(id, name, description, quantity)
+	priceCents, currency, priceChanged, err := formPrice(c, existing)
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	dueDate, dueChanged, err := formDueDate(c, existing.DueDate)
+	if err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+
+	// The fields are written in one UPDATE
+	fields := db.ItemFields{Name: name, Description: description, Quantity: quantity}
+	if priceChanged {
+		fields.Price = &db.ItemPrice{Cents: priceCents, Currency: currency}
+	}
+	if dueChanged {
+		fields.DueDate = &dueDate
+	}
+	item, err := db.UpdateItemWithFields(id, fields)
 	if err != nil {
 		return c.Status(500).SendString("Failed to update item")
 	}
 
+	RecordItemEvent(c, db.ItemEventUpdate, existing, item)
+
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_updated", item)
+	BroadcastFrom(c, "item_updated", item)
 
 	// Return updated item partial
 	return c.Render("partials/item", fiber.Map{
@@ -120,13 +153,18 @@ func DeleteItem(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid ID")
 	}
 
-	err = db.DeleteItem(id)
-	if err != nil {
+	// The event is recorded with the delete, in the same transaction
+	if existing, err := db.GetItemByID(id); err == nil {
+		err = db.DeleteItemWithEvent(id, ItemEventFor(c, db.ItemEventDelete, existing, nil))
+		if err != nil && err != sql.ErrNoRows {
+			return c.Status(500).SendString("Failed to delete item")
+		}
+	} else if err != sql.ErrNoRows {
 		return c.Status(500).SendString("Failed to delete item")
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_deleted", map[string]int64{"id": id})
+	BroadcastFrom(c, "item_deleted", map[string]int64{"id": id})
 
 	// Return empty string (HTMX will remove the element)
 	return c.SendString("")
@@ -140,7 +178,7 @@ func DeleteCompletedItems(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("completed_items_deleted", map[string]int64{"count": count})
+	BroadcastFrom(c, "completed_items_deleted", map[string]int64{"count": count})
 
 	return c.JSON(fiber.Map{"deleted": count})
 }
@@ -156,9 +194,12 @@ func ToggleItem(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).SendString("Failed to toggle item")
 	}
+	before := *item
+	before.Completed = !item.Completed
+	RecordItemEvent(c, db.ItemEventToggle, &before, item)
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_toggled", item)
+	BroadcastFrom(c, "item_toggled", item)
 
 	// Return the appropriate item partial based on completed status
 	if item.Completed {
@@ -184,9 +225,12 @@ func ToggleUncertain(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).SendString("Failed to toggle uncertain")
 	}
+	before := *item
+	before.Uncertain = !item.Uncertain
+	RecordItemEvent(c, db.ItemEventToggle, &before, item)
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_updated", item)
+	BroadcastFrom(c, "item_updated", item)
 
 	// Return the appropriate item partial based on completed status
 	if item.Completed {
@@ -214,6 +258,10 @@ func MoveItemToSection(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid section ID")
 	}
 
+	existing, err := db.GetItemByID(id)
+	if err != nil {
+		return c.Status(500).SendString("Failed to move item")
+	}
 	var item *db.Item
 
 	// Check if position parameter is provided (for cross-section drag-and-drop)
@@ -238,8 +286,10 @@ func MoveItemToSection(c *fiber.Ctx) error {
 		}
 	}
 
+	RecordItemEvent(c, db.ItemEventMove, existing, item)
+
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("item_moved", item)
+	BroadcastFrom(c, "item_moved", item)
 
 	// Trigger full refresh for simplicity (item moved between sections)
 	c.Set("HX-Trigger", "refreshList")
@@ -261,7 +311,7 @@ func MoveItemUp(c *fiber.Ctx) error {
 	// Get the item's section and return all items in that section
 	item, _ := db.GetItemByID(id)
 	if item != nil {
-		BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
+		BroadcastFrom(c, "items_reordered", map[string]int64{"section_id": item.SectionID})
 		return returnSectionItems(c, item.SectionID)
 	}
 
@@ -283,7 +333,7 @@ func MoveItemDown(c *fiber.Ctx) error {
 	// Get the item's section and return all items in that section
 	item, _ := db.GetItemByID(id)
 	if item != nil {
-		BroadcastUpdate("items_reordered", map[string]int64{"section_id": item.SectionID})
+		BroadcastFrom(c, "items_reordered", map[string]int64{"section_id": item.SectionID})
 		return returnSectionItems(c, item.SectionID)
 	}
 
@@ -313,16 +363,16 @@ func GetStats(c *fiber.Ctx) error {
 func GetItemVersion(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+		return Fail(c, ErrCodeInvalidID, "Invalid ID")
 	}
 
 	item, err := db.GetItemByID(id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+			return Fail(c, ErrCodeNotFound, "Item not found")
 		}
 		log.Printf("GetItemVersion database error for item %d: %v", id, err)
-		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+		return Fail(c, ErrCodeDB, "Database error")
 	}
 
 	return c.JSON(fiber.Map{
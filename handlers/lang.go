@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"shopping-list/i18n"
+	"shopping-list/settings"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// langLocalsKey holds the language resolved for the request
+const langLocalsKey = "lang"
+
+// ErrOverridesDisabled is returned when no translation override directory is configured
+var ErrOverridesDisabled = errors.New("I18N_OVERRIDES_DIR is not set")
+
+// LanguageMiddleware resolves the request language once for all handlers
+func LanguageMiddleware(c *fiber.Ctx) error {
+	c.Locals(langLocalsKey, resolveLang(c))
+	return c.Next()
+}
+
+// RequestLang returns the language for this request
+func RequestLang(c *fiber.Ctx) string {
+	if lang, ok := c.Locals(langLocalsKey).(string); ok {
+		return lang
+	}
+	return resolveLang(c)
+}
+
+// resolveLang picks ?lang=, then X-Language, then Accept-Language, then the server default
+func resolveLang(c *fiber.Ctx) string {
+	if lang := i18n.Resolve(c.Query("lang")); lang != "" {
+		return lang
+	}
+	if lang := i18n.Resolve(c.Get("X-Language")); lang != "" {
+		return lang
+	}
+	if lang := i18n.MatchAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage)); lang != "" {
+		return lang
+	}
+	return i18n.GetDefaultLang()
+}
+
+// settingDefaultLanguage is the language used when a request does not ask for one
+const settingDefaultLanguage = "default_language"
+
+func validateLanguage(value string) error {
+	if i18n.Resolve(value) != value {
+		return fmt.Errorf("must be an available language")
+	}
+	return nil
+}
+
+// InitLanguage applies the stored default language, overriding DEFAULT_LANG
+func InitLanguage() {
+	i18n.SetDefaultLang(settings.String(settingDefaultLanguage))
+}
+
+// GetLanguages returns the available languages with their translation completeness
+func GetLanguages(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"default":   i18n.GetDefaultLang(),
+		"languages": i18n.Languages(),
+	})
+}
+
+// SetDefaultLanguage changes the server default language without a restart
+func SetDefaultLanguage(c *fiber.Ctx) error {
+	var req struct {
+		Language string `json:"language" form:"language"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Fail(c, ErrCodeInvalidJSON, "Invalid request")
+	}
+
+	if err := settings.Update(map[string]any{settingDefaultLanguage: req.Language}); err != nil {
+		var invalid *settings.ValidationError
+		if errors.As(err, &invalid) {
+			return Fail(c, ErrCodeValidation, invalid.Error())
+		}
+		return err
+	}
+
+	return c.JSON(fiber.Map{"default": i18n.GetDefaultLang()})
+}
+
+// translationOverridesDir returns the directory of translation override files, "" if disabled
+func translationOverridesDir() string {
+	return os.Getenv("I18N_OVERRIDES_DIR")
+}
+
+// ReloadTranslationOverrides loads override files from I18N_OVERRIDES_DIR on top of the embedded translations
+func ReloadTranslationOverrides() (*i18n.OverrideReport, error) {
+	dir := translationOverridesDir()
+	if dir == "" {
+		return nil, ErrOverridesDisabled
+	}
+	report, err := i18n.LoadOverrides(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range report.Files {
+		if f.Error != "" {
+			log.Printf("[I18N] Skipped override file %s: %s", f.File, f.Error)
+		}
+		if len(f.UnknownKeys) > 0 {
+			log.Printf("[I18N] Ignored unknown keys in %s: %s", f.File, strings.Join(f.UnknownKeys, ", "))
+		}
+	}
+	return report, nil
+}
+
+// InitTranslationOverrides loads translation overrides at startup if a directory is configured
+func InitTranslationOverrides() {
+	if translationOverridesDir() == "" {
+		return
+	}
+	if _, err := ReloadTranslationOverrides(); err != nil {
+		log.Printf("[I18N] Failed to load translation overrides: %v", err)
+	}
+}
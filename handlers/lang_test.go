@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// initLocales loads the embedded translations with English as the default language
+func initLocales(t *testing.T) {
+	t.Helper()
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	i18n.SetDefaultLang("en")
+	t.Cleanup(func() { i18n.SetDefaultLang("en") })
+}
+
+func TestRequestLang(t *testing.T) {
+	initLocales(t)
+	app := fiber.New()
+	app.Use(LanguageMiddleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString(RequestLang(c)) })
+
+	cases := []struct {
+		name, query string
+		headers     map[string]string
+		want        string
+	}{
+		{"nothing asked", "", nil, "en"},
+		{"query", "?lang=uk", map[string]string{"X-Language": "pl", "Accept-Language": "de"}, "uk"},
+		{"X-Language over Accept-Language", "", map[string]string{"X-Language": "pl", "Accept-Language": "de"}, "pl"},
+		{"Accept-Language", "", map[string]string{"Accept-Language": "fr;q=0.3, uk-UA;q=0.9"}, "uk"},
+		{"unsupported query falls through", "?lang=ja", map[string]string{"Accept-Language": "sv"}, "sv"},
+		{"unsupported header uses the default", "", map[string]string{"X-Language": "ja", "Accept-Language": "zh-CN"}, "en"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tc.query, nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tc.want {
+				t.Errorf("language = %q, want %q", body, tc.want)
+			}
+		})
+	}
+
+	// Without a request preference the stored default applies
+	i18n.SetDefaultLang("pl")
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "pl" {
+		t.Errorf("language with a pl default = %q, want pl", body)
+	}
+}
+
+func TestImportNamesDefaultSectionInRequestLanguage(t *testing.T) {
+	initLocales(t)
+	for lang, want := range map[string]string{"en": "General", "uk": "Загальне"} {
+		t.Run(lang, func(t *testing.T) {
+			setupTestDB(t)
+			csv := "list_name,list_icon,section_name,item_name,item_description,item_completed,item_uncertain\n" +
+				"Groceries,,,Milk,,false,false\n"
+			if _, err := Import(strings.NewReader(csv), ImportOptions{Filename: "list.csv", Lang: lang}); err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			lists, err := db.GetAllLists()
+			if err != nil || len(lists) != 1 {
+				t.Fatalf("lists = %+v, %v", lists, err)
+			}
+			sections, err := db.GetSectionsByList(lists[0].ID)
+			if err != nil || len(sections) != 1 || sections[0].Name != want {
+				t.Errorf("sections = %+v, %v, want one named %q", sections, err, want)
+			}
+		})
+	}
+}
@@ -34,7 +34,7 @@ func GetListsPage(c *fiber.Ctx) error {
 		"Templates":    templates,
 		"Translations": i18n.GetAllLocales(),
 		"Locales":      i18n.AvailableLocales(),
-		"DefaultLang":  i18n.GetDefaultLang(),
+		"DefaultLang":  RequestLang(c),
 	})
 }
 
@@ -72,9 +72,10 @@ func GetListView(c *fiber.Ctx) error {
 		"Lists":        lists,
 		"Sections":     sections,
 		"Stats":        stats,
+		"Totals":       db.PriceTotals(sections),
 		"Translations": i18n.GetAllLocales(),
 		"Locales":      i18n.AvailableLocales(),
-		"DefaultLang":  i18n.GetDefaultLang(),
+		"DefaultLang":  RequestLang(c),
 	})
 }
 
@@ -100,7 +101,7 @@ func CreateList(c *fiber.Ctx) error {
 	if name == "" {
 		return c.Status(400).SendString("Name is required")
 	}
-	if len(name) > MaxListNameLength {
+	if TextLength(name) > MaxListNameLength {
 		return c.Status(400).SendString("Name too long (max 100 characters)")
 	}
 	if name == "[HISTORY]" {
@@ -130,7 +131,7 @@ func CreateList(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_created", list)
+	BroadcastFrom(c, "list_created", list)
 
 	// Return the new list item partial for HTMX
 	return c.Render("partials/list_item", fiber.Map{
@@ -149,7 +150,7 @@ func UpdateList(c *fiber.Ctx) error {
 	if name == "" {
 		return c.Status(400).SendString("Name is required")
 	}
-	if len(name) > MaxListNameLength {
+	if TextLength(name) > MaxListNameLength {
 		return c.Status(400).SendString("Name too long (max 100 characters)")
 	}
 	if name == "[HISTORY]" {
@@ -170,13 +171,13 @@ func UpdateList(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Icon too long")
 	}
 
-	list, err := db.UpdateList(id, name, icon)
+	list, err := db.UpdateList(id, name, icon, nil)
 	if err != nil {
 		return c.Status(500).SendString("Failed to update list")
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_updated", list)
+	BroadcastFrom(c, "list_updated", list)
 
 	// Return updated list item partial
 	return c.Render("partials/list_item", fiber.Map{
@@ -197,7 +198,7 @@ func DeleteList(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_deleted", map[string]int64{"id": id})
+	BroadcastFrom(c, "list_deleted", map[string]int64{"id": id})
 
 	// Return empty string (HTMX will remove the element)
 	return c.SendString("")
@@ -216,9 +217,9 @@ func SetActiveList(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("list_activated", map[string]int64{"id": id})
+	BroadcastFrom(c, "list_activated", map[string]int64{"id": id})
 
-	// For regular GET requests (not HTMX), redirect to selected list
+	// For regular form posts (not HTMX), redirect to selected list
 	if c.Get("HX-Request") == "" {
 		return c.Redirect(fmt.Sprintf("/lists/%d", id))
 	}
@@ -246,7 +247,7 @@ func MoveListUp(c *fiber.Ctx) error {
 	}
 
 	// Broadcast and return full lists
-	BroadcastUpdate("lists_reordered", nil)
+	BroadcastFrom(c, "lists_reordered", nil)
 	return returnAllLists(c)
 }
 
@@ -263,7 +264,7 @@ func MoveListDown(c *fiber.Ctx) error {
 	}
 
 	// Broadcast and return full lists
-	BroadcastUpdate("lists_reordered", nil)
+	BroadcastFrom(c, "lists_reordered", nil)
 	return returnAllLists(c)
 }
 
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"log"
+	"shopping-list/db"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	settingMaintenanceEnabled = "maintenance_enabled"
+	settingMaintenanceMessage = "maintenance_message"
+
+	// MaintenanceTogglePath is the only mutating route allowed during maintenance
+	MaintenanceTogglePath = "/api/v1/admin/maintenance"
+)
+
+// MaintenanceState describes the read-only maintenance mode
+type MaintenanceState struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+var (
+	maintenance   MaintenanceState
+	maintenanceMu sync.RWMutex
+)
+
+// InitMaintenance loads the persisted maintenance state
+func InitMaintenance() {
+	enabled, err := db.GetSetting(settingMaintenanceEnabled, "false")
+	if err != nil {
+		log.Printf("[MAINTENANCE] Failed to load state: %v", err)
+		return
+	}
+	message, _ := db.GetSetting(settingMaintenanceMessage, "")
+
+	maintenanceMu.Lock()
+	maintenance = MaintenanceState{Enabled: enabled == "true", Message: message}
+	maintenanceMu.Unlock()
+
+	if enabled == "true" {
+		log.Printf("[MAINTENANCE] Read-only mode is enabled: %s", message)
+	}
+}
+
+// GetMaintenance returns the current maintenance state
+func GetMaintenance() MaintenanceState {
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+	return maintenance
+}
+
+// SetMaintenance persists the maintenance state and notifies connected clients
+func SetMaintenance(enabled bool, message string) (MaintenanceState, error) {
+	value := "false"
+	if enabled {
+		value = "true"
+	}
+	if err := db.SetSetting(settingMaintenanceEnabled, value); err != nil {
+		return GetMaintenance(), err
+	}
+	if err := db.SetSetting(settingMaintenanceMessage, message); err != nil {
+		return GetMaintenance(), err
+	}
+
+	state := MaintenanceState{Enabled: enabled, Message: message}
+	maintenanceMu.Lock()
+	maintenance = state
+	maintenanceMu.Unlock()
+
+	log.Printf("[MAINTENANCE] Read-only mode set to %v", enabled)
+	BroadcastUpdate("maintenance_changed", state)
+	return state, nil
+}
+
+// MaintenanceMiddleware rejects mutating requests while maintenance mode is enabled
+// Reads, exports and the WebSocket stream keep working
+// While a database restore is swapping files every request is rejected
+func MaintenanceMiddleware(c *fiber.Ctx) error {
+	ok, release := restoreGuard(c)
+	if !ok {
+		return Fail(c, ErrCodeMaintenance, "A database restore is in progress")
+	}
+	defer release()
+
+	state := GetMaintenance()
+	if !state.Enabled || isSafeMethod(c.Method()) {
+		return c.Next()
+	}
+
+	switch RoutePath(c) {
+	case MaintenanceTogglePath, RestorePath, OptimizePath, "/login", "/logout":
+		return c.Next()
+	}
+
+	message := state.Message
+	if message == "" {
+		message = "The server is in read-only maintenance mode"
+	}
+	return Fail(c, ErrCodeMaintenance, message)
+}
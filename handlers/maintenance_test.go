@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+func newMaintenanceApp(t *testing.T) *fiber.App {
+	t.Helper()
+	setupTestDB(t)
+	if _, err := SetMaintenance(true, "Upgrading"); err != nil {
+		t.Fatalf("enable maintenance: %v", err)
+	}
+	t.Cleanup(func() { SetMaintenance(false, "") })
+
+	app := fiber.New()
+	app.Use(MaintenanceMiddleware)
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return app
+}
+
+func TestMaintenanceExemptPaths(t *testing.T) {
+	app := newMaintenanceApp(t)
+
+	// However the router is asked for them, the exempt routes must stay reachable
+	// or an admin who enabled maintenance could not log in again or turn it off
+	exempt := []string{
+		"/login",
+		"/Login",
+		"/LOGOUT/",
+		"/api/v1/admin/maintenance",
+		"/api/v1/admin/Maintenance",
+		"/API/V1/ADMIN/MAINTENANCE/",
+		"/api/v1/admin/optimize/",
+	}
+	for _, path := range exempt {
+		if got := doRequest(t, app, "POST", path, nil); got != fiber.StatusOK {
+			t.Errorf("POST %s: got %d, want 200", path, got)
+		}
+	}
+}
+
+func TestMaintenanceBlocksWrites(t *testing.T) {
+	app := newMaintenanceApp(t)
+
+	if got := doRequest(t, app, "POST", "/api/v1/lists", nil); got != fiber.StatusServiceUnavailable {
+		t.Errorf("POST during maintenance: got %d, want 503", got)
+	}
+	if got := doRequest(t, app, "POST", "/loginx", nil); got != fiber.StatusServiceUnavailable {
+		t.Errorf("POST /loginx during maintenance: got %d, want 503", got)
+	}
+	if got := doRequest(t, app, "GET", "/api/v1/lists", nil); got != fiber.StatusOK {
+		t.Errorf("GET during maintenance: got %d, want 200", got)
+	}
+
+	if _, err := SetMaintenance(false, ""); err != nil {
+		t.Fatalf("disable maintenance: %v", err)
+	}
+	if got := doRequest(t, app, "POST", "/api/v1/lists", nil); got != fiber.StatusOK {
+		t.Errorf("POST after maintenance: got %d, want 200", got)
+	}
+}
+
+func TestRestoreGuardSkipsRestorePath(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		ok, release := restoreGuard(c)
+		if !ok {
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
+		defer release()
+		// The restore handler takes the write lock, a read lock held here would deadlock it
+		if !restoreMu.TryLock() {
+			return c.SendStatus(fiber.StatusLocked)
+		}
+		restoreMu.Unlock()
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	for _, path := range []string{RestorePath, "/api/v1/Admin/Restore", "/API/V1/ADMIN/RESTORE/"} {
+		if got := doRequest(t, app, "POST", path, nil); got != fiber.StatusOK {
+			t.Errorf("POST %s: got %d, want 200", path, got)
+		}
+	}
+	if got := doRequest(t, app, "POST", "/api/v1/lists", nil); got != fiber.StatusLocked {
+		t.Errorf("other routes should hold the read lock: got %d", got)
+	}
+}
+
+// dialWebSocket serves WebSocketHandler on a local port and returns a client connected to it
+func dialWebSocket(t *testing.T) *fastws.Conn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", websocket.New(WebSocketHandler))
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	conn, _, err := fastws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// Broadcasts only reach clients the handler has registered
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		clientsMu.RLock()
+		n := len(clients)
+		clientsMu.RUnlock()
+		if n > 0 {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("WebSocket client was not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMaintenanceChangedBroadcast(t *testing.T) {
+	setupTestDB(t)
+	conn := dialWebSocket(t)
+	t.Cleanup(func() { SetMaintenance(false, "") })
+
+	for _, want := range []MaintenanceState{{Enabled: true, Message: "Upgrading"}, {Enabled: false, Message: ""}} {
+		if _, err := SetMaintenance(want.Enabled, want.Message); err != nil {
+			t.Fatalf("set maintenance: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read broadcast: %v", err)
+		}
+		var msg struct {
+			Type string           `json:"type"`
+			Data MaintenanceState `json:"data"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decode broadcast %s: %v", data, err)
+		}
+		if msg.Type != "maintenance_changed" || msg.Data != want {
+			t.Errorf("broadcast = %s, want maintenance_changed with %+v", data, want)
+		}
+	}
+}
+
+func TestMaintenanceToggleDuringRequest(t *testing.T) {
+	setupTestDB(t)
+	t.Cleanup(func() { SetMaintenance(false, "") })
+
+	started, release := make(chan struct{}), make(chan struct{})
+	app := fiber.New()
+	app.Use(MaintenanceMiddleware)
+	app.Post("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		<-release
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	done := make(chan int)
+	go func() { done <- doRequest(t, app, "POST", "/slow", nil) }()
+	<-started
+
+	// A write admitted before the toggle finishes, writes arriving after it are rejected
+	if _, err := SetMaintenance(true, "Upgrading"); err != nil {
+		t.Fatalf("enable maintenance: %v", err)
+	}
+	if got := doRequest(t, app, "POST", "/api/v1/lists", nil); got != fiber.StatusServiceUnavailable {
+		t.Errorf("POST after the toggle: got %d, want 503", got)
+	}
+	close(release)
+	if got := <-done; got != fiber.StatusOK {
+		t.Errorf("in-flight POST: got %d, want 200", got)
+	}
+	if got := doRequest(t, app, "POST", "/slow", nil); got != fiber.StatusServiceUnavailable {
+		t.Errorf("POST /slow after the toggle: got %d, want 503", got)
+	}
+}
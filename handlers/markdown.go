@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"shopping-list/db"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// markdownContentType is the media type of Markdown exports
+const markdownContentType = "text/markdown; charset=utf-8"
+
+// markdownEscaper escapes characters that would turn names into formatting or links
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, "\r\n", " ", "\n", " ", "\r", " ",
+)
+
+// writeMarkdownList renders a list as a heading with its icon, sections as sub-headings and items as checkboxes
+// Descriptions follow the name in italics after a dash and uncertain items end with (?)
+func writeMarkdownList(w *bufio.Writer, list ExportList) {
+	heading := markdownEscaper.Replace(list.Name)
+	if list.Icon != "" {
+		heading = list.Icon + " " + heading
+	}
+	fmt.Fprintf(w, "# %s\n", heading)
+
+	for _, section := range list.Sections {
+		// Empty sections only add noise to a pasted list
+		if len(section.Items) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n## %s\n\n", markdownEscaper.Replace(section.Name))
+		for _, item := range section.Items {
+			check := " "
+			if item.Completed {
+				check = "x"
+			}
+			fmt.Fprintf(w, "- [%s] %s", check, markdownEscaper.Replace(item.Name))
+			if item.Quantity > 0 {
+				fmt.Fprintf(w, " ×%d", item.Quantity)
+			}
+			if description := strings.TrimSpace(item.Description); description != "" {
+				fmt.Fprintf(w, " - *%s*", markdownEscaper.Replace(description))
+			}
+			if item.Uncertain {
+				w.WriteString(" (?)")
+			}
+			w.WriteString("\n")
+		}
+	}
+}
+
+// exportAllAsMarkdown writes every list, separated by blank lines
+func exportAllAsMarkdown(w io.Writer, lists []db.List, opts ExportOptions) error {
+	bw := bufio.NewWriter(w)
+	for i, list := range lists {
+		sections, err := exportSections(list.ID, opts)
+		if err != nil {
+			continue
+		}
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		writeMarkdownList(bw, toExportList(&list, sections))
+	}
+	return bw.Flush()
+}
+
+// exportListAsMarkdown sends a list as Markdown, with inline=true as plain text without a download filename
+func exportListAsMarkdown(c *fiber.Ctx, list *db.List, sections []db.Section) error {
+	if c.Query("inline") != "true" {
+		filename := fmt.Sprintf("koffan-%s-%s.md", sanitizeFilename(list.Name), time.Now().Format("2006-01-02"))
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	}
+	c.Set("Content-Type", markdownContentType)
+
+	bw := bufio.NewWriter(c.Response().BodyWriter())
+	writeMarkdownList(bw, toExportList(list, sections))
+	return bw.Flush()
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWriteMarkdownList(t *testing.T) {
+	list := ExportList{Name: "Weekend *party*", Icon: "🎉", Sections: []ExportSection{
+		{Name: "Drinks", Items: []ExportItem{
+			{Name: "Cola", Quantity: 2},
+			{Name: "Juice", Description: "orange_or_apple", Completed: true, Quantity: 1},
+			{Name: "Beer", Description: "  ", Uncertain: true},
+			{Name: "Ice [cubes]", Description: "two\nbags", Completed: true, Uncertain: true, Quantity: 3},
+		}},
+		{Name: "Empty"},
+		{Name: "Snacks <salty>", Items: []ExportItem{{Name: "Chips", Quantity: 1}}},
+	}}
+	want := "# 🎉 Weekend \\*party\\*\n" +
+		"\n## Drinks\n\n" +
+		"- [ ] Cola ×2\n" +
+		"- [x] Juice ×1 - *orange\\_or\\_apple*\n" +
+		"- [ ] Beer (?)\n" +
+		"- [x] Ice \\[cubes\\] ×3 - *two bags* (?)\n" +
+		"\n## Snacks \\<salty\\>\n\n" +
+		"- [ ] Chips ×1\n"
+
+	var out strings.Builder
+	w := bufio.NewWriter(&out)
+	writeMarkdownList(w, list)
+	w.Flush()
+	if out.String() != want {
+		t.Errorf("markdown:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// A list without an icon has a plain heading
+	out.Reset()
+	writeMarkdownList(w, ExportList{Name: "Plain"})
+	w.Flush()
+	if out.String() != "# Plain\n" {
+		t.Errorf("markdown without an icon = %q", out.String())
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	setupTestDB(t)
+	list, err := db.CreateList("Groceries/Week 1", "🛒")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dairy, err := db.CreateSectionForList(list.ID, "Dairy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateItem(dairy.ID, "Milk", "2L", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateList("Hardware", "🔧"); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/export", ExportAllData)
+	app.Get("/export/list/:id", ExportSingleList)
+	listPath := "/export/list/" + strconv.FormatInt(list.ID, 10) + "?format=markdown"
+	attachment := regexp.MustCompile(`^attachment; filename="koffan-[^"/]+-\d{4}-\d{2}-\d{2}\.md"$`)
+
+	cases := []struct {
+		name, path  string
+		disposition bool
+		body        string
+	}{
+		{"single list", listPath, true, "# 🛒 Groceries/Week 1\n\n## Dairy\n\n- [ ] Milk ×2 - *2L*\n"},
+		{"single list inline", listPath + "&inline=true", false, "# 🛒 Groceries/Week 1\n\n## Dairy\n\n- [ ] Milk ×2 - *2L*\n"},
+		{"all lists", "/export?format=markdown", true, "# 🛒 Groceries/Week 1\n\n## Dairy\n\n- [ ] Milk ×2 - *2L*\n\n# 🔧 Hardware\n"},
+		{"all lists inline", "/export?format=markdown&inline=true", false, "# 🛒 Groceries/Week 1\n\n## Dairy\n\n- [ ] Milk ×2 - *2L*\n\n# 🔧 Hardware\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tc.path, nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != markdownContentType {
+				t.Fatalf("got %d %q, want 200 %q: %s", resp.StatusCode, resp.Header.Get("Content-Type"), markdownContentType, body)
+			}
+			disposition := resp.Header.Get("Content-Disposition")
+			if tc.disposition && !attachment.MatchString(disposition) {
+				t.Errorf("Content-Disposition = %q, want a .md attachment without the slash", disposition)
+			}
+			if !tc.disposition && disposition != "" {
+				t.Errorf("inline export has Content-Disposition %q", disposition)
+			}
+			if string(body) != tc.body {
+				t.Errorf("body = %q, want %q", body, tc.body)
+			}
+		})
+	}
+}
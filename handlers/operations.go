@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"shopping-list/db"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// settingOperationLock persists the running operation so a crash leaves a visible trace
+	settingOperationLock = "operation_lock"
+
+	// maxRecentOperations is how many finished operations are kept for the status endpoint
+	maxRecentOperations = 20
+
+	// staleOperationAge is how long an operation may hold the lock before it can be force-cleared
+	staleOperationAge = 6 * time.Hour
+)
+
+// Operation names
+const (
+	OperationImport   = "import"
+	OperationRestore  = "restore"
+	OperationClear    = "clear"
+	OperationOptimize = "optimize"
+	OperationBackup   = "backup"
+)
+
+// Operation is a destructive or exclusive operation holding the process-wide lock
+type Operation struct {
+	Name      string `json:"name"`
+	StartedAt int64  `json:"started_at"`
+	PID       int    `json:"pid"`
+}
+
+// OperationRecord is a finished operation
+type OperationRecord struct {
+	Operation
+	FinishedAt int64  `json:"finished_at"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+}
+
+// OperationsStatus describes the lock holder and recent operations
+type OperationsStatus struct {
+	Current *Operation        `json:"current"`
+	Stale   *Operation        `json:"stale,omitempty"`
+	Recent  []OperationRecord `json:"recent"`
+}
+
+// OperationBusyError is returned when another operation holds the lock
+type OperationBusyError struct {
+	Current Operation
+}
+
+func (e *OperationBusyError) Error() string {
+	return fmt.Sprintf("%s in progress since %s", e.Current.Name, time.Unix(e.Current.StartedAt, 0).Format(time.RFC3339))
+}
+
+// OperationConflictResponse is the 409 body naming the running operation
+type OperationConflictResponse struct {
+	ErrorResponse
+	Operation Operation `json:"operation"`
+}
+
+var (
+	operationMu      sync.Mutex
+	currentOperation *Operation
+	staleOperation   *Operation
+	recentOperations []OperationRecord
+)
+
+// InitOperations detects a lock left behind by a crashed process
+// Unless another live process, such as an admin command, holds it, a persisted lock at startup is stale
+func InitOperations() {
+	value, err := db.GetSetting(settingOperationLock, "")
+	if err != nil || value == "" {
+		return
+	}
+
+	var op Operation
+	if err := json.Unmarshal([]byte(value), &op); err != nil {
+		log.Printf("[OPERATIONS] Ignoring unreadable operation lock: %v", err)
+		return
+	}
+	if op.PID != os.Getpid() && processAlive(op.PID) {
+		log.Printf("[OPERATIONS] %s is running in another process (pid %d)", op.Name, op.PID)
+		return
+	}
+	operationMu.Lock()
+	staleOperation = &op
+	operationMu.Unlock()
+	log.Printf("[OPERATIONS] WARNING: %s started at %s (pid %d) did not finish, the process probably crashed",
+		op.Name, time.Unix(op.StartedAt, 0).Format(time.RFC3339), op.PID)
+}
+
+// BeginOperation acquires the process-wide operation lock
+// It fails with *OperationBusyError if another operation is running, in this process or, going by the
+// persisted lock, in another one sharing the database like an admin command. The returned
+// function releases the lock and records the outcome, it must be called exactly once
+func BeginOperation(name string) (func(err error), error) {
+	op, err := acquireOperation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Persisted outside operationMu, so a request arriving during a slow write is refused at once
+	if data, err := json.Marshal(op); err == nil {
+		if err := db.SetSetting(settingOperationLock, string(data)); err != nil {
+			log.Printf("[OPERATIONS] Failed to persist lock for %s: %v", name, err)
+		}
+	}
+
+	return func(err error) { endOperation(op, err) }, nil
+}
+
+// acquireOperation makes a new operation the lock holder unless one is running
+func acquireOperation(name string) (*Operation, error) {
+	operationMu.Lock()
+	defer operationMu.Unlock()
+
+	if currentOperation != nil {
+		return nil, &OperationBusyError{Current: *currentOperation}
+	}
+	if op := foreignOperation(); op != nil {
+		return nil, &OperationBusyError{Current: *op}
+	}
+
+	currentOperation = &Operation{Name: name, StartedAt: time.Now().Unix(), PID: os.Getpid()}
+	return currentOperation, nil
+}
+
+// foreignOperation returns the persisted lock when another running process holds it
+func foreignOperation() *Operation {
+	value, err := db.GetSetting(settingOperationLock, "")
+	if err != nil || value == "" {
+		return nil
+	}
+	var op Operation
+	if err := json.Unmarshal([]byte(value), &op); err != nil {
+		return nil
+	}
+	if op.PID == os.Getpid() || !processAlive(op.PID) {
+		return nil
+	}
+	return &op
+}
+
+// processAlive reports whether a process with pid exists, signal 0 only checks for it
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// endOperation releases the lock held by op and records it as finished
+func endOperation(op *Operation, err error) {
+	operationMu.Lock()
+	defer operationMu.Unlock()
+
+	record := OperationRecord{Operation: *op, FinishedAt: time.Now().Unix(), Success: err == nil}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	recentOperations = append([]OperationRecord{record}, recentOperations...)
+	if len(recentOperations) > maxRecentOperations {
+		recentOperations = recentOperations[:maxRecentOperations]
+	}
+
+	// A force-cleared operation may finish after another one took the lock
+	if currentOperation != op {
+		return
+	}
+	currentOperation = nil
+	if err := db.SetSetting(settingOperationLock, ""); err != nil {
+		log.Printf("[OPERATIONS] Failed to clear persisted lock: %v", err)
+	}
+}
+
+// WaitForOperation waits until no operation holds the lock, it reports false on timeout
+// Used on shutdown so a running import or restore can commit before the database is closed
+func WaitForOperation(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	logged := false
+	for {
+		operationMu.Lock()
+		op := currentOperation
+		operationMu.Unlock()
+		if op == nil {
+			return true
+		}
+		if time.Now().After(deadline) {
+			log.Printf("[OPERATIONS] %s still running at shutdown, its transaction will be rolled back", op.Name)
+			return false
+		}
+		if !logged {
+			log.Printf("[OPERATIONS] Waiting for %s to finish before shutting down", op.Name)
+			logged = true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// GetOperations returns the current lock holder and recent operations
+func GetOperations() OperationsStatus {
+	operationMu.Lock()
+	defer operationMu.Unlock()
+
+	status := OperationsStatus{Recent: append([]OperationRecord{}, recentOperations...)}
+	if currentOperation != nil {
+		op := *currentOperation
+		status.Current = &op
+	}
+	if staleOperation != nil {
+		op := *staleOperation
+		status.Stale = &op
+	}
+	return status
+}
+
+// ClearStaleOperation removes a lock left by a crashed process, or one held longer than staleOperationAge
+// It returns the cleared operation, nil if nothing was stale
+func ClearStaleOperation() (*Operation, error) {
+	operationMu.Lock()
+	defer operationMu.Unlock()
+
+	var cleared *Operation
+	switch {
+	case staleOperation != nil:
+		cleared = staleOperation
+		staleOperation = nil
+	case currentOperation != nil && time.Since(time.Unix(currentOperation.StartedAt, 0)) > staleOperationAge:
+		cleared = currentOperation
+		currentOperation = nil
+	default:
+		return nil, nil
+	}
+
+	if err := db.SetSetting(settingOperationLock, ""); err != nil {
+		return nil, err
+	}
+	log.Printf("[OPERATIONS] Cleared stale lock held by %s since %s", cleared.Name,
+		time.Unix(cleared.StartedAt, 0).Format(time.RFC3339))
+	return cleared, nil
+}
+
+// OperationConflict sends a 409 naming the operation that holds the lock
+func OperationConflict(c *fiber.Ctx, busy *OperationBusyError) error {
+	return c.Status(fiber.StatusConflict).JSON(OperationConflictResponse{
+		ErrorResponse: NewErrorResponse(c, ErrCodeOperationInProgress, "Another operation is running: "+busy.Error()),
+		Operation:     busy.Current,
+	})
+}
+
+// responseError converts a failed response status into an error for the operation history
+func responseError(c *fiber.Ctx) error {
+	if status := c.Response().StatusCode(); status >= 400 {
+		return fmt.Errorf("HTTP %d", status)
+	}
+	return nil
+}
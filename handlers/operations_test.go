@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useOperationState runs the test without a held lock or operation history, and resets them afterwards
+func useOperationState(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		operationMu.Lock()
+		currentOperation, staleOperation, recentOperations = nil, nil, nil
+		operationMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+type raceResult struct {
+	operation string
+	status    int
+	body      []byte
+}
+
+func TestImportRacingClear(t *testing.T) {
+	initLocales(t)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/import", ImportData)
+	app.Post("/api/database/clear", ClearDatabase)
+
+	export := ExportData{Version: ExportVersion, App: "koffan"}
+	export.Data.Lists = []ExportList{{Name: "Imported", Sections: []ExportSection{{Name: "Dairy", Items: []ExportItem{{Name: "Milk", Quantity: 1}}}}}}
+	importData, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := map[string]func() *http.Request{
+		OperationImport: func() *http.Request {
+			return uploadRequest(t, "/import", "export.json", importData, nil)
+		},
+		OperationClear: func() *http.Request {
+			req := httptest.NewRequest("POST", "/api/database/clear", bytes.NewReader([]byte(`{"confirmation":"DELETE"}`)))
+			req.Header.Set("Content-Type", "application/json")
+			return req
+		},
+	}
+
+	// Which request wins is up to the scheduler, over a few rounds both usually do
+	for round := 0; round < 4; round++ {
+		setupTestDB(t)
+		useOperationState(t)
+		pantry, _ := db.CreateList("Pantry", "")
+		section, _ := db.CreateSectionForList(pantry.ID, "Shelf")
+		db.CreateItem(section.ID, "Rice", "", 1)
+
+		// Holding the only write connection keeps whichever request takes the lock from finishing,
+		// so the other one is refused while the first is still running
+		tx, err := db.BeginWrite()
+		if err != nil {
+			t.Fatal(err)
+		}
+		start, results := make(chan struct{}), make(chan raceResult, 2)
+		for name, newRequest := range requests {
+			req := newRequest()
+			go func(name string) {
+				<-start
+				resp, err := app.Test(req, -1)
+				if err != nil {
+					results <- raceResult{operation: name}
+					return
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				results <- raceResult{operation: name, status: resp.StatusCode, body: body}
+			}(name)
+		}
+		close(start)
+
+		var loser, winner raceResult
+		select {
+		case loser = <-results:
+		case <-time.After(5 * time.Second):
+			tx.Rollback()
+			t.Fatalf("round %d: neither request was refused while the other held the lock", round)
+		}
+		tx.Rollback()
+		winner = <-results
+		if loser.status != fiber.StatusConflict || winner.status != fiber.StatusOK {
+			t.Fatalf("round %d: %s got %d %s first, then %s got %d %s, want 409 then 200", round,
+				loser.operation, loser.status, loser.body, winner.operation, winner.status, winner.body)
+		}
+
+		// The refused request names the running operation
+		var conflict OperationConflictResponse
+		if err := json.Unmarshal(loser.body, &conflict); err != nil {
+			t.Fatal(err)
+		}
+		if conflict.Error != ErrCodeOperationInProgress || conflict.Operation.Name != winner.operation || conflict.Operation.StartedAt == 0 {
+			t.Errorf("round %d: conflict = %s, want %s named as running", round, loser.body, winner.operation)
+		}
+
+		// Only the winner changed the database
+		names := map[string]bool{}
+		for _, name := range listNamesOf(t) {
+			names[name] = true
+		}
+		if winner.operation == OperationImport && (!names["Imported"] || !names["Pantry"]) ||
+			winner.operation == OperationClear && (names["Imported"] || countRows(t, "items") != 0) {
+			t.Errorf("round %d: %s won, lists are %v", round, winner.operation, names)
+		}
+
+		status := GetOperations()
+		if status.Current != nil || len(status.Recent) != 1 || status.Recent[0].Name != winner.operation || !status.Recent[0].Success {
+			t.Errorf("round %d: operations = %+v, want only the finished %s", round, status, winner.operation)
+		}
+		if lock, _ := db.GetSetting(settingOperationLock, ""); lock != "" {
+			t.Errorf("round %d: persisted lock %q left behind", round, lock)
+		}
+
+		// Once the lock is released the refused operation can run
+		resp, err := app.Test(requests[loser.operation](), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != fiber.StatusOK {
+			t.Errorf("round %d: retried %s: %d, want 200", round, loser.operation, resp.StatusCode)
+		}
+	}
+}
+
+// listNamesOf returns the names of all lists
+func listNamesOf(t *testing.T) []string {
+	t.Helper()
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(lists))
+	for _, l := range lists {
+		names = append(names, l.Name)
+	}
+	return names
+}
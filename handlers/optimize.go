@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"shopping-list/db"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Optimize job states
+const (
+	OptimizeRunning   = "running"
+	OptimizeCompleted = "completed"
+	OptimizeFailed    = "failed"
+)
+
+// OptimizePath is allowed during maintenance, since large databases require it
+const OptimizePath = "/api/v1/admin/optimize"
+
+// DefaultOptimizeAsyncThresholdMB is the database size above which optimize runs in the background
+// Overridable via OPTIMIZE_ASYNC_THRESHOLD_MB
+const DefaultOptimizeAsyncThresholdMB = 50
+
+var (
+	// ErrMaintenanceRequired is returned when a large database is optimized outside maintenance mode
+	ErrMaintenanceRequired = errors.New("maintenance mode required")
+)
+
+// OptimizeJob describes a database optimize run
+type OptimizeJob struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Async      bool   `json:"async"`
+	SizeBefore int64  `json:"size_before"`
+	SizeAfter  int64  `json:"size_after,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	StartedAt  int64  `json:"started_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+var (
+	optimizeMu  sync.Mutex
+	optimizeJob *OptimizeJob
+)
+
+// optimizeAsyncThreshold returns the size in bytes above which optimize runs in the background
+func optimizeAsyncThreshold() int64 {
+	return int64(getEnvInt("OPTIMIZE_ASYNC_THRESHOLD_MB", DefaultOptimizeAsyncThresholdMB)) * 1024 * 1024
+}
+
+// GetOptimizeJob returns the most recent optimize job, nil if none ran since startup
+func GetOptimizeJob() *OptimizeJob {
+	optimizeMu.Lock()
+	defer optimizeMu.Unlock()
+	if optimizeJob == nil {
+		return nil
+	}
+	job := *optimizeJob
+	return &job
+}
+
+// StartOptimize vacuums the database, in the background when it exceeds the async threshold
+// Small databases finish within the busy timeout, so concurrent writes just wait for the lock.
+// Large ones could exceed it, so maintenance mode must be on to reject writes cleanly instead.
+// Fails with *OperationBusyError while another operation holds the lock
+func StartOptimize() (*OptimizeJob, error) {
+	size := db.FileSize()
+	async := size > optimizeAsyncThreshold()
+	if async && !GetMaintenance().Enabled {
+		return nil, ErrMaintenanceRequired
+	}
+
+	end, err := BeginOperation(OperationOptimize)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &OptimizeJob{
+		ID:         strconv.FormatInt(now.UnixNano(), 36),
+		Status:     OptimizeRunning,
+		Async:      async,
+		SizeBefore: size,
+		StartedAt:  now.Unix(),
+	}
+	optimizeMu.Lock()
+	optimizeJob = job
+	optimizeMu.Unlock()
+
+	if async {
+		go runOptimize(job, end)
+		return GetOptimizeJob(), nil
+	}
+	runOptimize(job, end)
+	return GetOptimizeJob(), nil
+}
+
+// runOptimize performs the optimize and records the outcome in job, then releases the operation lock
+func runOptimize(job *OptimizeJob, end func(error)) {
+	start := time.Now()
+	err := db.Optimize()
+	defer end(err)
+
+	optimizeMu.Lock()
+	defer optimizeMu.Unlock()
+	job.DurationMs = time.Since(start).Milliseconds()
+	job.FinishedAt = time.Now().Unix()
+	job.SizeAfter = db.FileSize()
+	if err != nil {
+		job.Status = OptimizeFailed
+		job.Error = err.Error()
+		log.Printf("[OPTIMIZE] Failed after %dms: %v", job.DurationMs, err)
+		return
+	}
+	job.Status = OptimizeCompleted
+	log.Printf("[OPTIMIZE] Completed in %dms, %d -> %d bytes", job.DurationMs, job.SizeBefore, job.SizeAfter)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"log"
+	"shopping-list/db"
+	"shopping-list/settings"
+)
+
+const (
+	settingRepairOrderingOnStartup = "repair_ordering_on_startup"
+
+	// OperationRepairOrdering is the operation name for sort_order repair
+	OperationRepairOrdering = "repair_ordering"
+)
+
+// OrderingReport describes the sort_order repair of sections and items
+type OrderingReport struct {
+	DryRun  bool                `json:"dry_run"`
+	Repairs []db.OrderingRepair `json:"repairs"`
+}
+
+// RepairOrdering rewrites broken sort_order sequences and notifies clients of changed sections and lists
+func RepairOrdering(dryRun bool) (report *OrderingReport, err error) {
+	end, err := BeginOperation(OperationRepairOrdering)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { end(err) }()
+
+	repairs, err := db.RepairOrdering(dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	report = &OrderingReport{DryRun: dryRun, Repairs: repairs}
+	if report.Repairs == nil {
+		report.Repairs = []db.OrderingRepair{}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	for _, r := range repairs {
+		switch r.Table {
+		case "items":
+			BroadcastUpdate("items_reordered", map[string]int64{"section_id": r.ParentID})
+		case "sections":
+			BroadcastUpdate("sections_reordered", map[string]int64{"list_id": r.ParentID})
+		}
+	}
+	return report, nil
+}
+
+// InitOrdering repairs sort_order at startup unless disabled in settings
+func InitOrdering() {
+	if !settings.Bool(settingRepairOrderingOnStartup) {
+		return
+	}
+
+	report, err := RepairOrdering(false)
+	if err != nil {
+		log.Printf("[ORDERING] Startup repair failed: %v", err)
+		return
+	}
+	for _, r := range report.Repairs {
+		log.Printf("[ORDERING] Renumbered %d %s in %d", r.Changed, r.Table, r.ParentID)
+	}
+}
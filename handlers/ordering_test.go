@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+	"shopping-list/settings"
+)
+
+// seedBrokenOrdering creates a list whose sections share a sort_order and whose first section has duplicate items
+// A second, well-formed section is left intact
+func seedBrokenOrdering(t *testing.T) (list *db.List, broken *db.Section) {
+	t.Helper()
+	list, _ = db.CreateList("Groceries", "")
+	broken, _ = db.CreateSectionForList(list.ID, "Dairy")
+	intact, _ := db.CreateSectionForList(list.ID, "Bakery")
+	db.CreateItem(broken.ID, "Milk", "", 1)
+	db.CreateItem(broken.ID, "Cheese", "", 1)
+	db.CreateItem(intact.ID, "Bread", "", 1)
+	if _, err := db.DB.Exec("UPDATE sections SET sort_order = 0 WHERE list_id = ?", list.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec("UPDATE items SET sort_order = 1 WHERE section_id = ?", broken.ID); err != nil {
+		t.Fatal(err)
+	}
+	return list, broken
+}
+
+func TestRepairOrderingBroadcastsChanges(t *testing.T) {
+	setupTestDB(t)
+	useOperationState(t)
+	list, broken := seedBrokenOrdering(t)
+	conn := dialWebSocket(t)
+
+	// A dry run reports the repairs and tells no one
+	report, err := RepairOrdering(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.Repairs) != 2 {
+		t.Errorf("dry run = %+v, want the sections and Dairy items", report)
+	}
+	// A read that times out leaves the connection unusable, so a marker shows nothing came before it
+	BroadcastUpdate("marker", nil)
+	if msg, ok := readBroadcast(t, conn, 2*time.Second); !ok || msg.Type != "marker" {
+		t.Fatalf("first broadcast after the dry run = %q (%v), want the marker", msg.Type, ok)
+	}
+
+	report, err = RepairOrdering(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DryRun || len(report.Repairs) != 2 {
+		t.Errorf("repair = %+v, want the sections and Dairy items", report)
+	}
+
+	// One event per changed parent, nothing for the intact section
+	want := map[string]map[string]int64{
+		"sections_reordered": {"list_id": list.ID},
+		"items_reordered":    {"section_id": broken.ID},
+	}
+	for len(want) > 0 {
+		msg, ok := readBroadcast(t, conn, 2*time.Second)
+		if !ok {
+			t.Fatalf("missing broadcast, still want %v", want)
+		}
+		var data map[string]int64
+		json.Unmarshal(msg.Data, &data)
+		wantData, expected := want[msg.Type]
+		if !expected || len(data) != 1 {
+			t.Fatalf("broadcast %s %s, want one of %v", msg.Type, msg.Data, want)
+		}
+		for key, id := range wantData {
+			if data[key] != id {
+				t.Errorf("broadcast %s %s, want %s %d", msg.Type, msg.Data, key, id)
+			}
+		}
+		delete(want, msg.Type)
+	}
+
+	// Nothing left to repair, so nothing is broadcast
+	if report, err := RepairOrdering(false); err != nil || len(report.Repairs) != 0 {
+		t.Errorf("second repair = %+v, %v, want nothing to do", report, err)
+	}
+	if msg, ok := readBroadcast(t, conn, 200*time.Millisecond); ok {
+		t.Errorf("unexpected broadcast %s %s", msg.Type, msg.Data)
+	}
+}
+
+func TestInitOrderingFollowsSetting(t *testing.T) {
+	setupTestDB(t)
+	useOperationState(t)
+	_, broken := seedBrokenOrdering(t)
+	repaired := func() bool {
+		items, err := db.GetItemsBySection(broken.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(items) == 2 && items[0].SortOrder == 0 && items[1].SortOrder == 1
+	}
+
+	if err := settings.Update(map[string]any{settingRepairOrderingOnStartup: false}); err != nil {
+		t.Fatal(err)
+	}
+	InitOrdering()
+	if repaired() {
+		t.Error("startup repair ran while disabled")
+	}
+
+	if err := settings.Update(map[string]any{settingRepairOrderingOnStartup: true}); err != nil {
+		t.Fatal(err)
+	}
+	InitOrdering()
+	if !repaired() {
+		t.Error("startup repair did not run")
+	}
+}
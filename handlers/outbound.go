@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+)
+
+// connectivityTargets are the hosts the connectivity check may contact
+var connectivityTargets = map[string]string{
+	"github": "https://api.github.com",
+}
+
+var insecureWarningOnce sync.Once
+
+// outboundTimeout returns OUTBOUND_TIMEOUT_SECONDS, or defaultTimeout if unset
+func outboundTimeout(defaultTimeout time.Duration) time.Duration {
+	if seconds := getEnvInt("OUTBOUND_TIMEOUT_SECONDS", 0); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultTimeout
+}
+
+// outboundTLSConfig builds the TLS config from OUTBOUND_CA_BUNDLE and OUTBOUND_INSECURE_SKIP_VERIFY
+func outboundTLSConfig() *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if path := os.Getenv("OUTBOUND_CA_BUNDLE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("[OUTBOUND] Failed to read CA bundle %s: %v", path, err)
+		} else {
+			pool, err := x509.SystemCertPool()
+			if err != nil || pool == nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				log.Printf("[OUTBOUND] No certificates found in CA bundle %s", path)
+			}
+			config.RootCAs = pool
+		}
+	}
+
+	if os.Getenv("OUTBOUND_INSECURE_SKIP_VERIFY") == "true" {
+		insecureWarningOnce.Do(func() {
+			log.Println("[OUTBOUND] WARNING: TLS certificate verification is DISABLED for outbound requests (OUTBOUND_INSECURE_SKIP_VERIFY=true)")
+		})
+		config.InsecureSkipVerify = true
+	}
+
+	return config
+}
+
+// NewOutboundClient returns an HTTP client for calls to external services
+// It honors HTTP_PROXY/HTTPS_PROXY/NO_PROXY and the OUTBOUND_* env settings
+func NewOutboundClient(defaultTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = outboundTLSConfig()
+
+	return &http.Client{
+		Timeout:   outboundTimeout(defaultTimeout),
+		Transport: transport,
+	}
+}
+
+// ConnectivityResult reports the timing of each stage of a diagnostic request
+type ConnectivityResult struct {
+	Target       string `json:"target"`
+	URL          string `json:"url"`
+	Success      bool   `json:"success"`
+	Status       int    `json:"status,omitempty"`
+	Proxy        string `json:"proxy,omitempty"`
+	DNSMs        int64  `json:"dns_ms,omitempty"`
+	ConnectMs    int64  `json:"connect_ms,omitempty"`
+	TLSMs        int64  `json:"tls_ms,omitempty"`
+	FirstByteMs  int64  `json:"first_byte_ms,omitempty"`
+	TotalMs      int64  `json:"total_ms"`
+	FailedStage  string `json:"failed_stage,omitempty"`
+	ErrorMessage string `json:"error,omitempty"`
+}
+
+// CheckConnectivity performs a diagnostic request to a known target
+func CheckConnectivity(target string) (*ConnectivityResult, error) {
+	url, ok := connectivityTargets[target]
+	if !ok {
+		return nil, fmt.Errorf("unknown target: %s", target)
+	}
+
+	result := &ConnectivityResult{Target: target, URL: url}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL, err := http.ProxyFromEnvironment(req); err == nil && proxyURL != nil {
+		result.Proxy = proxyURL.Redacted()
+	}
+
+	var dnsStart, connectStart, tlsStart time.Time
+	stage := "dns"
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			result.DNSMs = time.Since(dnsStart).Milliseconds()
+			stage = "connect"
+		},
+		ConnectStart: func(string, string) {
+			connectStart = time.Now()
+			stage = "connect"
+		},
+		ConnectDone: func(string, string, error) {
+			result.ConnectMs = time.Since(connectStart).Milliseconds()
+			stage = "tls"
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			result.TLSMs = time.Since(tlsStart).Milliseconds()
+			stage = "response"
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { stage = "response" },
+		GotFirstResponseByte: func() {
+			result.FirstByteMs = time.Since(start).Milliseconds()
+		},
+	}
+
+	ctx, cancel := context.WithCancel(httptrace.WithClientTrace(req.Context(), trace))
+	defer cancel()
+
+	resp, err := NewOutboundClient(10 * time.Second).Do(req.WithContext(ctx))
+	result.TotalMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.FailedStage = stage
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+	resp.Body.Close()
+
+	result.Success = true
+	result.Status = resp.StatusCode
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxPhotoSize bounds the size of an item photo
+const MaxPhotoSize = 5 << 20
+
+// photoTypes maps the sniffed content types of accepted photos to their file extension
+var photoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Errors of SavePhoto
+var (
+	ErrPhotoTooLarge = errors.New("photo is too large")
+	ErrPhotoType     = errors.New("photo is not a JPEG, PNG or WebP image")
+)
+
+// SavePhoto stores an uploaded photo under a random name in the photos directory and returns its path
+// relative to FilesDir. The type is sniffed from the content, the name and type the client sent are ignored
+func SavePhoto(src io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(src, MaxPhotoSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxPhotoSize {
+		return "", ErrPhotoTooLarge
+	}
+	ext, ok := photoTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", ErrPhotoType
+	}
+
+	dir := filepath.Join(db.FilesDir(), db.PhotosDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(b) + ext
+
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return db.PhotosDir + "/" + name, nil
+}
+
+// ManagedFilePath returns the absolute path of a file referenced relative to FilesDir,
+// false when the reference points outside the directory
+func ManagedFilePath(rel string) (string, bool) {
+	root, err := filepath.Abs(db.FilesDir())
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	return path, isWithinDir(root, path)
+}
+
+// RemoveReleasedFiles deletes the photos of deleted items and replaced photos, failures are only logged
+// The daily orphan cleanup removes whatever is left behind
+func RemoveReleasedFiles() {
+	paths, err := db.TakeReleasedFiles()
+	if err != nil {
+		log.Printf("[FILES] Failed to read released files: %v", err)
+		return
+	}
+	for _, rel := range paths {
+		path, ok := ManagedFilePath(rel)
+		if !ok {
+			log.Printf("[FILES] Refusing to remove %s outside the files directory", rel)
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[FILES] Failed to remove %s: %v", rel, err)
+		}
+	}
+}
+
+// ReleasedFilesMiddleware removes the files released by a write request once it is done, whichever
+// route deleted the items, sections or lists they belonged to
+func ReleasedFilesMiddleware(c *fiber.Ctx) error {
+	err := c.Next()
+	if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead && db.HasReleasedFiles() {
+		RemoveReleasedFiles()
+	}
+	return err
+}
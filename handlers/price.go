@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"shopping-list/db"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxPriceCents bounds item prices, 100 million in any currency
+const MaxPriceCents = 100_000_000_00
+
+var errInvalidPrice = errors.New("price must be a non-negative amount with at most 2 decimals, such as 3.49 or 3,49")
+
+// ParsePrice reads a price in cents from a decimal amount like 3.49, 3,49 or 1 234.50
+// With both a comma and a dot the last one separates the decimals, the other groups thousands
+func ParsePrice(s string) (int64, error) {
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(strings.TrimSpace(s))
+	if i := strings.LastIndexAny(s, ".,"); i >= 0 {
+		s = strings.NewReplacer(".", "", ",", "").Replace(s[:i]) + "." + s[i+1:]
+	}
+
+	units, fraction, _ := strings.Cut(s, ".")
+	if units == "" || len(fraction) > 2 || strings.Trim(units+fraction, "0123456789") != "" {
+		return 0, errInvalidPrice
+	}
+	cents, err := strconv.ParseInt(units+(fraction + "00")[:2], 10, 64)
+	if err != nil || cents > MaxPriceCents {
+		return 0, errInvalidPrice
+	}
+	return cents, nil
+}
+
+// FormatPrice writes cents as a decimal amount with a dot, 3.49
+func FormatPrice(cents int64) string {
+	return strconv.FormatInt(cents/100, 10) + "." + strconv.FormatInt(cents%100+100, 10)[1:]
+}
+
+// ParseCurrency normalizes a currency to an upper-case three-letter code like EUR, empty stays empty
+func ParseCurrency(s string) (string, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return "", nil
+	}
+	if len(s) != 3 || strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", errors.New("currency must be a three-letter code such as EUR or USD")
+	}
+	return s, nil
+}
+
+// ExportPrice is the price of an exported item as a decimal amount, "3.49"
+// Hand-edited JSON may also give it as a number
+type ExportPrice string
+
+func (p *ExportPrice) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] != '"' && string(data) != "null" {
+		*p = ExportPrice(data)
+		return nil
+	}
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*p = ""
+	if s != nil {
+		*p = ExportPrice(*s)
+	}
+	return nil
+}
+
+// exportPrice returns the price of an item for exports, empty without one
+func exportPrice(item *db.Item) ExportPrice {
+	if item.PriceCents == nil {
+		return ""
+	}
+	return ExportPrice(FormatPrice(*item.PriceCents))
+}
+
+// importPrice reads the price and currency of an imported item, fields named prefix+"price" and prefix+"currency"
+// Values that cannot be read are left out with an invalid_value warning, a currency without a price is dropped
+func importPrice(price, currency string, warnings *importWarnings, row int, path, prefix string) (*int64, string) {
+	price = strings.TrimSpace(price)
+	if price == "" {
+		return nil, ""
+	}
+	cents, err := ParsePrice(price)
+	if err != nil {
+		warnings.add(ImportWarning{Row: row, Path: path, Field: prefix + "price", Value: warningValue(price), Reason: ImportWarningInvalidValue, Action: "modified"})
+		return nil, ""
+	}
+	code, err := ParseCurrency(currency)
+	if err != nil {
+		warnings.add(ImportWarning{Row: row, Path: path, Field: prefix + "currency", Value: warningValue(currency), Reason: ImportWarningInvalidValue, Action: "modified"})
+	}
+	return &cents, code
+}
+
+// formPrice applies the price and currency form values to those of item, an empty price clears it
+// changed reports whether the form sent either, forms without the fields keep the price
+func formPrice(c *fiber.Ctx, item *db.Item) (priceCents *int64, currency string, changed bool, err error) {
+	priceCents, currency = item.PriceCents, item.Currency
+	if formHas(c, "price") {
+		changed = true
+		priceCents = nil
+		if value := strings.TrimSpace(c.FormValue("price")); value != "" {
+			cents, err := ParsePrice(value)
+			if err != nil {
+				return nil, "", false, err
+			}
+			priceCents = &cents
+		}
+	}
+	if formHas(c, "currency") {
+		changed = true
+		if currency, err = ParseCurrency(c.FormValue("currency")); err != nil {
+			return nil, "", false, err
+		}
+	}
+	return priceCents, currency, changed, nil
+}
+
+// formHas reports whether a url-encoded or multipart form sent a field, even an empty one
+func formHas(c *fiber.Ctx, key string) bool {
+	if c.Request().PostArgs().Has(key) {
+		return true
+	}
+	if form, err := c.MultipartForm(); err == nil {
+		_, ok := form.Value[key]
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"shopping-list/db"
+	"shopping-list/settings"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	settingProductLookupEnabled = "product_lookup_enabled"
+	settingProductLookupURL     = "product_lookup_url"
+
+	// Lookups are cached for a month, barcodes Open Food Facts did not know for a day as they may be added
+	productCacheTTL         = 30 * 24 * time.Hour
+	productNotFoundCacheTTL = 24 * time.Hour
+	// productCacheMaxAge is the age after which the daily cleanup drops a cached lookup, stale ones are
+	// served until then when Open Food Facts cannot be reached
+	productCacheMaxAge = 180 * 24 * time.Hour
+
+	maxProductResponseSize = 1 << 20
+)
+
+func init() {
+	settings.Register(
+		settings.Def{Key: settingProductLookupEnabled, Type: settings.TypeBool, Default: "true", Env: "PRODUCT_LOOKUP_ENABLED"},
+		settings.Def{Key: settingProductLookupURL, Type: settings.TypeString, Default: "https://world.openfoodfacts.org",
+			Env: "PRODUCT_LOOKUP_URL", Validate: func(value string) error {
+				if value == "" {
+					return fmt.Errorf("must be an http or https URL")
+				}
+				return validateBackupURL(value)
+			}},
+	)
+}
+
+// productHTTPClient performs product lookups, with a short timeout as a client waits for the answer
+var productHTTPClient httpDoer = NewOutboundClient(3 * time.Second)
+
+var (
+	errInvalidBarcode  = errors.New("barcode must be the 8, 12, 13 or 14 digits of an EAN, UPC or GTIN")
+	errBarcodeChecksum = errors.New("barcode check digit does not match")
+)
+
+// ParseBarcode checks an EAN-8, UPC-A, EAN-13 or GTIN-14 barcode including its check digit, empty stays empty
+func ParseBarcode(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	switch len(s) {
+	case 8, 12, 13, 14:
+	default:
+		return "", errInvalidBarcode
+	}
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			return "", errInvalidBarcode
+		}
+		digit := int(s[i] - '0')
+		// Weights alternate 1 and 3 from the check digit leftwards
+		if (len(s)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	if sum%10 != 0 {
+		return "", errBarcodeChecksum
+	}
+	return s, nil
+}
+
+// ProductLookup is the product behind a barcode, a suggested name and brand for a new item
+type ProductLookup struct {
+	Barcode   string `json:"barcode"`
+	Found     bool   `json:"found"`
+	Name      string `json:"name,omitempty"`
+	Brand     string `json:"brand,omitempty"`
+	Cached    bool   `json:"cached"`            // Answered from the cache without asking Open Food Facts
+	Offline   bool   `json:"offline,omitempty"` // Open Food Facts could not be reached, a cached answer may be outdated
+	FetchedAt int64  `json:"fetched_at,omitempty"`
+}
+
+// offProduct is the part of an Open Food Facts product response that is used
+type offProduct struct {
+	Status  int `json:"status"`
+	Product struct {
+		ProductName string `json:"product_name"`
+		GenericName string `json:"generic_name"`
+		Brands      string `json:"brands"`
+	} `json:"product"`
+}
+
+// ProductLookupEnabled reports whether barcodes may be looked up on Open Food Facts
+func ProductLookupEnabled() bool {
+	return settings.Bool(settingProductLookupEnabled)
+}
+
+// LookupProduct resolves a checked barcode to a product through the cache and Open Food Facts
+// When Open Food Facts cannot be reached a cached answer is returned however old, or one marked offline
+func LookupProduct(barcode string, now time.Time) (*ProductLookup, error) {
+	cached, err := db.GetCachedProduct(barcode)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if cached != nil {
+		ttl := productCacheTTL
+		if !cached.Found {
+			ttl = productNotFoundCacheTTL
+		}
+		if now.Sub(time.Unix(cached.FetchedAt, 0)) < ttl {
+			return cachedProductLookup(cached, false), nil
+		}
+	}
+
+	fetched, err := fetchProduct(barcode)
+	if err != nil {
+		log.Printf("[PRODUCTS] Lookup of %s failed: %v", barcode, err)
+		if cached != nil {
+			return cachedProductLookup(cached, true), nil
+		}
+		return &ProductLookup{Barcode: barcode, Offline: true}, nil
+	}
+	fetched.FetchedAt = now.Unix()
+	if err := db.SaveCachedProduct(*fetched); err != nil {
+		log.Printf("[PRODUCTS] Failed to cache %s: %v", barcode, err)
+	}
+	return &ProductLookup{Barcode: barcode, Found: fetched.Found, Name: fetched.Name, Brand: fetched.Brand, FetchedAt: fetched.FetchedAt}, nil
+}
+
+func cachedProductLookup(p *db.CachedProduct, offline bool) *ProductLookup {
+	return &ProductLookup{Barcode: p.Barcode, Found: p.Found, Name: p.Name, Brand: p.Brand, Cached: true, Offline: offline, FetchedAt: p.FetchedAt}
+}
+
+// fetchProduct asks Open Food Facts for a barcode, a product it does not know is not an error
+func fetchProduct(barcode string) (*db.CachedProduct, error) {
+	endpoint := strings.TrimRight(settings.String(settingProductLookupURL), "/") + "/api/v2/product/" + url.PathEscape(barcode) +
+		"?fields=product_name,generic_name,brands"
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	// Open Food Facts asks clients to identify themselves
+	req.Header.Set("User-Agent", "Koffan/"+AppVersion+" (https://github.com/"+defaultUpdateRepository+")")
+
+	resp, err := productHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body offProduct
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxProductResponseSize)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	product := &db.CachedProduct{Barcode: barcode}
+	if body.Status != 1 {
+		return product, nil
+	}
+	product.Name = strings.TrimSpace(body.Product.ProductName)
+	if product.Name == "" {
+		product.Name = strings.TrimSpace(body.Product.GenericName)
+	}
+	// Brands are a comma separated list, the first is the main one
+	product.Brand = strings.TrimSpace(strings.Split(body.Product.Brands, ",")[0])
+	product.Found = product.Name != "" || product.Brand != ""
+	return product, nil
+}
+
+// PruneProductCache removes cached product lookups too old to be served even offline and returns how many
+func PruneProductCache(now time.Time) (int64, error) {
+	return db.DeleteCachedProductsBefore(now.Add(-productCacheMaxAge).Unix())
+}
+
+// GetProductLookup resolves the barcode query parameter to a suggested item name and brand
+func GetProductLookup(c *fiber.Ctx) error {
+	if !ProductLookupEnabled() {
+		return Fail(c, ErrCodeNotConfigured, "Product lookup is disabled")
+	}
+	barcode, err := ParseBarcode(c.Query("barcode"))
+	if err != nil {
+		return Fail(c, ErrCodeValidation, err.Error())
+	}
+	if barcode == "" {
+		return Fail(c, ErrCodeValidation, "barcode is required")
+	}
+
+	product, err := LookupProduct(barcode, time.Now())
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Product lookup failed")
+	}
+	return c.JSON(product)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+)
+
+const (
+	testProductBarcode = "4006381333931"
+	testProductURL     = "https://world.openfoodfacts.org/api/v2/product/" + testProductBarcode + "?fields=product_name,generic_name,brands"
+)
+
+// useFakeProducts replaces the product lookup client for the test
+func useFakeProducts(t *testing.T, responses map[string]fakeResponse) *fakeDoer {
+	t.Helper()
+	doer := &fakeDoer{t: t, responses: responses}
+	previous := productHTTPClient
+	productHTTPClient = doer
+	t.Cleanup(func() { productHTTPClient = previous })
+	return doer
+}
+
+func TestParseBarcode(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+		err            error
+	}{
+		{"empty", "", "", nil},
+		{"blank", "   ", "", nil},
+		{"EAN-8", "96385074", "96385074", nil},
+		{"UPC-A", "036000291452", "036000291452", nil},
+		{"EAN-13", "4006381333931", "4006381333931", nil},
+		{"EAN-13 with a check digit of 7", "5901234123457", "5901234123457", nil},
+		{"GTIN-14", "10614141000415", "10614141000415", nil},
+		{"GTIN-14 with leading zeros", "00012345600012", "00012345600012", nil},
+		{"surrounding space", " 4006381333931\n", "4006381333931", nil},
+		{"EAN-8 wrong check digit", "96385075", "", errBarcodeChecksum},
+		{"UPC-A wrong check digit", "036000291453", "", errBarcodeChecksum},
+		{"EAN-13 wrong check digit", "4006381333932", "", errBarcodeChecksum},
+		{"swapped digits", "4006383133931", "", errBarcodeChecksum},
+		{"GTIN-14 wrong check digit", "10614141000416", "", errBarcodeChecksum},
+		{"7 digits", "9638507", "", errInvalidBarcode},
+		{"9 digits", "963850745", "", errInvalidBarcode},
+		{"11 digits", "03600029145", "", errInvalidBarcode},
+		{"15 digits", "106141410004150", "", errInvalidBarcode},
+		{"letter", "400638133393X", "", errInvalidBarcode},
+		{"inner space", "4006381 33931", "", errInvalidBarcode},
+		{"minus sign", "-4006381333931", "", errInvalidBarcode},
+		{"full-width digits", "９６３８５０７４", "", errInvalidBarcode},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseBarcode(tc.in)
+			if got != tc.want || !errors.Is(err, tc.err) {
+				t.Errorf("ParseBarcode(%q) = %q, %v, want %q, %v", tc.in, got, err, tc.want, tc.err)
+			}
+		})
+	}
+}
+
+func TestLookupProductFetchesAndCaches(t *testing.T) {
+	setupTestDB(t)
+	doer := useFakeProducts(t, map[string]fakeResponse{
+		testProductURL: {status: http.StatusOK, fixture: "off_product.json"},
+	})
+	now := time.Now()
+
+	product, err := LookupProduct(testProductBarcode, now)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if !product.Found || product.Name != "Boss Original" || product.Brand != "Stabilo" || product.Cached || product.Offline {
+		t.Errorf("fetched product = %+v, want Boss Original by Stabilo", product)
+	}
+
+	// Within the TTL the cache answers without asking Open Food Facts
+	product, err = LookupProduct(testProductBarcode, now.Add(productCacheTTL-time.Hour))
+	if err != nil {
+		t.Fatalf("cached lookup: %v", err)
+	}
+	if !product.Cached || product.Offline || product.Name != "Boss Original" || product.FetchedAt != now.Unix() {
+		t.Errorf("cached product = %+v", product)
+	}
+	if len(doer.requested) != 1 {
+		t.Errorf("requested %v, want one request", doer.requested)
+	}
+}
+
+func TestLookupProductOffline(t *testing.T) {
+	setupTestDB(t)
+	doer := useFakeProducts(t, nil)
+	doer.err = errors.New("dial tcp: no route to host")
+	now := time.Now()
+
+	// Never looked up: marked offline, and nothing is cached
+	product, err := LookupProduct(testProductBarcode, now)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if !product.Offline || product.Found || product.Cached {
+		t.Errorf("offline lookup = %+v, want offline and not found", product)
+	}
+	if cached, err := db.GetCachedProduct(testProductBarcode); cached != nil || err == nil {
+		t.Errorf("offline lookup was cached: %+v", cached)
+	}
+
+	// A lookup past its TTL is still served while offline, marked as possibly outdated
+	fetchedAt := now.Add(-productCacheTTL - 24*time.Hour).Unix()
+	if err := db.SaveCachedProduct(db.CachedProduct{Barcode: testProductBarcode, Found: true, Name: "Boss Original", Brand: "Stabilo", FetchedAt: fetchedAt}); err != nil {
+		t.Fatalf("seed cache: %v", err)
+	}
+	product, err = LookupProduct(testProductBarcode, now)
+	if err != nil {
+		t.Fatalf("stale lookup: %v", err)
+	}
+	if !product.Cached || !product.Offline || !product.Found || product.Name != "Boss Original" || product.FetchedAt != fetchedAt {
+		t.Errorf("stale offline lookup = %+v, want the cached product marked offline", product)
+	}
+	if len(doer.requested) != 2 {
+		t.Errorf("requested %v, want a refresh attempt for each lookup", doer.requested)
+	}
+
+	// Back online the stale lookup is refreshed
+	doer.err = nil
+	doer.responses = map[string]fakeResponse{testProductURL: {status: http.StatusOK, fixture: "off_product.json"}}
+	product, err = LookupProduct(testProductBarcode, now)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if product.Cached || product.Offline || product.FetchedAt != now.Unix() {
+		t.Errorf("refreshed lookup = %+v, want a fresh answer", product)
+	}
+}
+
+func TestLookupProductNotFoundIsCachedForADay(t *testing.T) {
+	setupTestDB(t)
+	const barcode = "5901234123457"
+	url := "https://world.openfoodfacts.org/api/v2/product/" + barcode + "?fields=product_name,generic_name,brands"
+	doer := useFakeProducts(t, map[string]fakeResponse{
+		url: {status: http.StatusNotFound, fixture: "off_product_unknown.json"},
+	})
+	now := time.Now()
+
+	for _, at := range []time.Time{now, now.Add(productNotFoundCacheTTL - time.Minute), now.Add(productNotFoundCacheTTL + time.Minute)} {
+		product, err := LookupProduct(barcode, at)
+		if err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+		if product.Found || product.Offline {
+			t.Errorf("lookup of an unknown barcode = %+v, want not found", product)
+		}
+	}
+	// The second lookup is answered from the cache, the third is past the day
+	if len(doer.requested) != 2 {
+		t.Errorf("requested %d times, want 2", len(doer.requested))
+	}
+}
+
+func TestPruneProductCache(t *testing.T) {
+	setupTestDB(t)
+	now := time.Now()
+	for barcode, age := range map[string]time.Duration{
+		"96385074":      productCacheMaxAge + time.Hour,
+		"4006381333931": productCacheMaxAge - time.Hour,
+	} {
+		if err := db.SaveCachedProduct(db.CachedProduct{Barcode: barcode, Found: true, Name: "x", FetchedAt: now.Add(-age).Unix()}); err != nil {
+			t.Fatalf("seed cache: %v", err)
+		}
+	}
+	pruned, err := PruneProductCache(now)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d lookups, want 1", pruned)
+	}
+	if _, err := db.GetCachedProduct("4006381333931"); err != nil {
+		t.Errorf("recent lookup was pruned: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RemoteUserLocalsKey is the fiber Locals key holding the proxy-authenticated username
+const RemoteUserLocalsKey = "remote_user"
+
+// ProxyAuthConfig holds configuration for trusted reverse-proxy authentication
+type ProxyAuthConfig struct {
+	Header     string
+	TrustedIPs []*net.IPNet
+}
+
+// Singleton instance, nil when proxy auth is disabled
+var proxyAuth *ProxyAuthConfig
+
+// InitProxyAuth reads AUTH_PROXY_HEADER and AUTH_PROXY_TRUSTED_IPS from env
+// Proxy auth stays disabled unless both are set and at least one CIDR is valid
+func InitProxyAuth() {
+	header := strings.TrimSpace(os.Getenv("AUTH_PROXY_HEADER"))
+	if header == "" {
+		return
+	}
+
+	nets := parseCIDRList(os.Getenv("AUTH_PROXY_TRUSTED_IPS"))
+	if len(nets) == 0 {
+		log.Println("[AUTH] AUTH_PROXY_HEADER is set but AUTH_PROXY_TRUSTED_IPS has no valid entries, proxy auth disabled")
+		return
+	}
+
+	proxyAuth = &ProxyAuthConfig{
+		Header:     header,
+		TrustedIPs: nets,
+	}
+	log.Printf("[AUTH] Proxy auth enabled: header=%s, trusted=%d network(s)", header, len(nets))
+}
+
+// parseCIDRList parses a comma-separated list of CIDRs or single IPs
+// Single addresses are treated as /32 (IPv4) or /128 (IPv6)
+func parseCIDRList(value string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("[AUTH] Ignoring invalid trusted IP: %s", entry)
+				continue
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("[AUTH] Ignoring invalid trusted CIDR: %s", entry)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// ipInNets reports whether ip is contained in any of the given networks
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	// Normalize IPv4-mapped IPv6 addresses so they match IPv4 CIDRs
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isProxyAuthEnabled returns true if trusted proxy header auth is configured
+func isProxyAuthEnabled() bool {
+	return proxyAuth != nil
+}
+
+// GetRemoteUser returns the proxy-authenticated username, empty if none
+func GetRemoteUser(c *fiber.Ctx) string {
+	user, _ := c.Locals(RemoteUserLocalsKey).(string)
+	return user
+}
+
+// proxyAuthenticate accepts the request if it comes from a trusted proxy with the auth header set
+// The peer address of the connection is used, never forwarded-for headers, so the
+// header cannot be spoofed by clients that reach the app directly
+func proxyAuthenticate(c *fiber.Ctx) error {
+	user := strings.TrimSpace(c.Get(proxyAuth.Header))
+	remoteIP := c.Context().RemoteIP()
+
+	if user == "" || !ipInNets(remoteIP, proxyAuth.TrustedIPs) {
+		log.Printf("[AUTH] Proxy auth rejected for %s %s from %s", c.Method(), c.Path(), remoteIP)
+		return Fail(c, ErrCodeUnauthorized, "Authentication required")
+	}
+
+	c.Locals(RemoteUserLocalsKey, user)
+	return c.Next()
+}
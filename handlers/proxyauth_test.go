@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// enableProxyAuth turns on proxy auth with the Remote-User header and the given trusted networks
+func enableProxyAuth(t *testing.T, trusted string) {
+	t.Helper()
+	t.Setenv("DISABLE_AUTH", "")
+	t.Setenv("AUTH_PROXY_HEADER", "Remote-User")
+	t.Setenv("AUTH_PROXY_TRUSTED_IPS", trusted)
+	proxyAuth = nil
+	InitProxyAuth()
+	t.Cleanup(func() { proxyAuth = nil })
+	if !isProxyAuthEnabled() {
+		t.Fatalf("proxy auth not enabled for %q", trusted)
+	}
+}
+
+// newProxyAuthApp enables proxy auth and returns an app behind AuthMiddleware that answers 200
+func newProxyAuthApp(t *testing.T, trusted string) *fiber.App {
+	t.Helper()
+	enableProxyAuth(t, trusted)
+	app := fiber.New()
+	app.Use(AuthMiddleware)
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return app
+}
+
+func TestParseCIDRList(t *testing.T) {
+	nets := parseCIDRList("10.0.0.0/8, 192.168.1.10,fd00::/8, 2001:db8::1, bogus, 300.1.1.1, 10.0.0.0/40")
+	want := []string{"10.0.0.0/8", "192.168.1.10/32", "fd00::/8", "2001:db8::1/128"}
+	if len(nets) != len(want) {
+		t.Fatalf("got %d networks %v, want %v", len(nets), nets, want)
+	}
+	for i, n := range nets {
+		if n.String() != want[i] {
+			t.Errorf("network %d = %s, want %s", i, n, want[i])
+		}
+	}
+}
+
+func TestProxyAuthTrustedPeer(t *testing.T) {
+	app := newProxyAuthApp(t, "10.0.0.0/8, fd00::/8")
+
+	tests := []struct {
+		name   string
+		peer   string
+		user   string
+		status int
+	}{
+		{"ipv4 trusted", "10.1.2.3", "alice", fiber.StatusOK},
+		{"ipv6 trusted", "fd00::1", "alice", fiber.StatusOK},
+		{"ipv6 trusted other subnet", "fdab:cd::42", "alice", fiber.StatusOK},
+		{"ipv4-mapped trusted", "::ffff:10.1.2.3", "alice", fiber.StatusOK},
+		{"trusted without header", "10.1.2.3", "", fiber.StatusUnauthorized},
+		{"trusted with blank header", "10.1.2.3", "   ", fiber.StatusUnauthorized},
+		{"ipv4 untrusted", "192.168.1.5", "alice", fiber.StatusUnauthorized},
+		{"ipv6 untrusted", "2001:db8::1", "alice", fiber.StatusUnauthorized},
+		{"ipv6 link-local", "fe80::1", "alice", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{}
+		if tt.user != "" {
+			headers["Remote-User"] = tt.user
+		}
+		if got := serveFrom(t, app, "GET", "/", tt.peer, headers); got != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.status)
+		}
+	}
+}
+
+func TestProxyAuthIgnoresForwardedHeaders(t *testing.T) {
+	// Forwarded headers are client-controlled from an untrusted peer, even with TRUSTED_PROXY on
+	t.Setenv("TRUSTED_PROXY", "true")
+	app := newProxyAuthApp(t, "10.0.0.0/8, fd00::/8")
+
+	spoofs := []map[string]string{
+		{"Remote-User": "admin", "X-Real-IP": "10.0.0.1"},
+		{"Remote-User": "admin", "X-Forwarded-For": "10.0.0.1"},
+		{"Remote-User": "admin", "X-Forwarded-For": "8.8.8.8, fd00::1"},
+		{"Remote-User": "admin", "X-Real-IP": "fd00::1", "X-Forwarded-For": "fd00::1"},
+	}
+	for _, peer := range []string{"203.0.113.7", "2001:db8::7"} {
+		for _, headers := range spoofs {
+			if got := serveFrom(t, app, "GET", "/", peer, headers); got != fiber.StatusUnauthorized {
+				t.Errorf("peer %s with %v: got %d, want 401", peer, headers, got)
+			}
+		}
+	}
+}
+
+func TestProxyAuthRecordsUser(t *testing.T) {
+	enableProxyAuth(t, "fd00::1")
+	app := fiber.New()
+	app.Use(AuthMiddleware)
+
+	var ctxUser string
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		ctxUser = GetRemoteUser(c)
+		return c.SendStatus(fiber.StatusOK)
+	})
+	if got := serveFrom(t, app, "GET", "/whoami", "fd00::1", map[string]string{"Remote-User": " bob "}); got != fiber.StatusOK {
+		t.Fatalf("got %d, want 200", got)
+	}
+	if ctxUser != "bob" {
+		t.Errorf("remote user = %q, want bob", ctxUser)
+	}
+}
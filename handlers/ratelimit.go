@@ -42,18 +42,22 @@ func InitLoginRateLimiter() {
 		LockoutDuration: time.Duration(getEnvInt("LOGIN_LOCKOUT_MINUTES", 30)) * time.Minute,
 	}
 
-	loginLimiter = &LoginRateLimiter{
-		config:   config,
-		attempts: make(map[string]*LoginAttempt),
-	}
-
-	// Start cleanup goroutine
-	go loginLimiter.cleanupRoutine()
+	loginLimiter = NewLoginRateLimiter(config)
 
 	log.Printf("[RATE LIMIT] Initialized: max=%d attempts per %v, lockout=%v",
 		config.MaxAttempts, config.WindowDuration, config.LockoutDuration)
 }
 
+// NewLoginRateLimiter creates a rate limiter and starts its cleanup goroutine
+func NewLoginRateLimiter(config RateLimitConfig) *LoginRateLimiter {
+	rl := &LoginRateLimiter{
+		config:   config,
+		attempts: make(map[string]*LoginAttempt),
+	}
+	go rl.cleanupRoutine()
+	return rl
+}
+
 func getEnvInt(key string, defaultVal int) int {
 	val := os.Getenv(key)
 	if val == "" {
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+const (
+	// HeaderRequestID carries the request ID, taken from the client when valid and always echoed back
+	HeaderRequestID = fiber.HeaderXRequestID
+
+	// LocalsTokenName is set by the REST API auth middleware to the name of the calling token
+	LocalsTokenName = "token_name"
+
+	localsRequestID = "requestid"
+
+	maxRequestIDLength = 128
+)
+
+// importBodyPaths are the upload endpoints whose body size is logged when LOG_IMPORT_BODY_SIZES is true
+// Only the size is ever logged, never the content
+var importBodyPaths = map[string]bool{
+	"/import":               true,
+	"/import/preview":       true,
+	"/api/v1/admin/restore": true,
+}
+
+var (
+	logLevel           = new(slog.LevelVar)
+	logImportBodySizes bool
+)
+
+// InitLogging makes slog, and the standard log package through it, write JSON lines to stdout
+// LOG_LEVEL picks the minimum level: debug, info (default), warn or error
+func InitLogging() {
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "warn", "warning":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	default:
+		logLevel.Set(slog.LevelInfo)
+	}
+	logImportBodySizes = os.Getenv("LOG_IMPORT_BODY_SIZES") == "true"
+	broadcastRequestIDs = os.Getenv("BROADCAST_REQUEST_IDS") == "true"
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})))
+}
+
+// RequestIDMiddleware assigns every request an ID, reusing a valid X-Request-ID sent by the client or a proxy
+// The ID is returned in X-Request-ID and appears in the request log, error bodies and audit log rows
+func RequestIDMiddleware(c *fiber.Ctx) error {
+	id := c.Get(HeaderRequestID)
+	if !validRequestID(id) {
+		id = utils.UUIDv4()
+	}
+	c.Locals(localsRequestID, id)
+	c.Set(HeaderRequestID, id)
+	return c.Next()
+}
+
+// validRequestID accepts short IDs of safe characters, anything else is replaced rather than logged
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestLogger logs one structured line per request once the response is known
+// Server errors log at error level, client errors at warn and everything else at info
+func RequestLogger(c *fiber.Ctx) error {
+	start := time.Now()
+
+	// Render errors here, so the logged status is the one the client gets
+	if err := c.Next(); err != nil {
+		if err := c.App().Config().ErrorHandler(c, err); err != nil {
+			_ = c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	status := c.Response().StatusCode()
+	level := slog.LevelInfo
+	switch {
+	case status >= fiber.StatusInternalServerError:
+		level = slog.LevelError
+	case status >= fiber.StatusBadRequest:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("request_id", RequestID(c)),
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.Int("status", status),
+		slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		slog.String("client_ip", ClientIP(c).String()),
+	}
+	if token, ok := c.Locals(LocalsTokenName).(string); ok && token != "" {
+		attrs = append(attrs, slog.String("token", token))
+	}
+	if logImportBodySizes && importBodyPaths[c.Path()] {
+		attrs = append(attrs, slog.Int("body_bytes", len(c.Request().Body())))
+	}
+
+	slog.LogAttrs(c.UserContext(), level, "request", attrs...)
+	return nil
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// newRequestLogApp returns an app with the request ID, logging and recover middleware in the order main uses
+// The returned buffer receives the JSON log lines
+func newRequestLogApp(t *testing.T) (*fiber.App, *bytes.Buffer) {
+	t.Helper()
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(RequestIDMiddleware)
+	app.Use(RequestLogger)
+	app.Use(recover.New())
+	app.Get("/ok", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/error", func(c *fiber.Ctx) error { return errors.New("disk on fire at /var/lib/koffan") })
+	app.Get("/panic", func(c *fiber.Ctx) error { panic("nil map in handler") })
+	return app, &logs
+}
+
+// logLines decodes the JSON lines written to logs
+func logLines(t *testing.T, logs *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestRequestIDRoundTrip(t *testing.T) {
+	app, logs := newRequestLogApp(t)
+	send := func(id string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/ok", nil)
+		if id != "" {
+			req.Header.Set(HeaderRequestID, id)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get(HeaderRequestID)
+	}
+
+	// A valid ID from the client or a proxy is kept
+	for _, id := range []string{"abc-123", "trace:9f.2_x", strings.Repeat("a", maxRequestIDLength)} {
+		if got := send(id); got != id {
+			t.Errorf("X-Request-ID %q came back as %q", id, got)
+		}
+	}
+
+	// Missing and unsafe IDs are replaced by a new one, never echoed
+	seen := map[string]bool{}
+	for _, id := range []string{"", "has spaces", "line\tbreak", "<script>", strings.Repeat("a", maxRequestIDLength+1)} {
+		got := send(id)
+		if got == id || !validRequestID(got) || len(got) != 36 || seen[got] {
+			t.Errorf("X-Request-ID %q came back as %q, want a new UUID", id, got)
+		}
+		seen[got] = true
+	}
+
+	// The log line of each request carries the ID it was answered with
+	lines := logLines(t, logs)
+	if len(lines) != 8 {
+		t.Fatalf("%d log lines, want one per request", len(lines))
+	}
+	if lines[0]["msg"] != "request" || lines[0]["request_id"] != "abc-123" || lines[0]["status"] != float64(200) || lines[0]["level"] != "INFO" {
+		t.Errorf("log line = %v, want the request with its ID", lines[0])
+	}
+}
+
+func TestRequestIDInServerErrors(t *testing.T) {
+	for _, path := range []string{"/error", "/panic"} {
+		t.Run(path, func(t *testing.T) {
+			app, logs := newRequestLogApp(t)
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set(HeaderRequestID, "support-ticket-42")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+
+			// The client gets the ID to report, but none of the details
+			var body ErrorResponse
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("decode %q: %v", data, err)
+			}
+			want := ErrorResponse{Error: ErrCodeInternal, Message: "Internal Server Error", RequestID: "support-ticket-42"}
+			if resp.StatusCode != fiber.StatusInternalServerError || body != want {
+				t.Errorf("got %d %+v, want 500 %+v", resp.StatusCode, body, want)
+			}
+			if resp.Header.Get(HeaderRequestID) != "support-ticket-42" {
+				t.Errorf("X-Request-ID = %q", resp.Header.Get(HeaderRequestID))
+			}
+
+			// The details are logged under the same ID, and the request line has the final status
+			var unhandled, request map[string]any
+			for _, line := range logLines(t, logs) {
+				switch line["msg"] {
+				case "unhandled error":
+					unhandled = line
+				case "request":
+					request = line
+				}
+			}
+			if unhandled == nil || unhandled["request_id"] != "support-ticket-42" || unhandled["level"] != "ERROR" {
+				t.Errorf("unhandled error line = %v, want it logged with the request ID", unhandled)
+			}
+			if request == nil || request["request_id"] != "support-ticket-42" || request["status"] != float64(500) || request["level"] != "ERROR" {
+				t.Errorf("request line = %v, want status 500 at error level", request)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"shopping-list/db"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// RestorePath is the route that swaps in an uploaded database
+const RestorePath = "/api/v1/admin/restore"
+
+// ErrInvalidBackup is returned when an uploaded file is not a usable database
+var ErrInvalidBackup = errors.New("invalid backup")
+
+var (
+	// restoring is set for the whole swap window, requests then get a 503
+	restoring atomic.Bool
+	// restoreMu is held for reading by every request, so a restore waits for in-flight requests
+	restoreMu sync.RWMutex
+)
+
+// RestoreResult describes a completed restore
+type RestoreResult struct {
+	db.RestoreCounts
+	PreviousPath string `json:"previous_path"`
+}
+
+// restoreGuard rejects requests during a restore and keeps it from starting mid-request
+func restoreGuard(c *fiber.Ctx) (bool, func()) {
+	if restoring.Load() {
+		return false, nil
+	}
+	// Long-lived WebSocket connections do not use the database and would block a restore forever
+	if RoutePath(c) == RestorePath || websocket.IsWebSocketUpgrade(c) {
+		return true, func() {}
+	}
+	restoreMu.RLock()
+	return true, restoreMu.RUnlock
+}
+
+// withDatabaseLock runs fn while no restore can close and swap the database
+// Background workers use it for each run: a restore waits for a running fn, and fn waits for a running restore
+func withDatabaseLock(fn func()) {
+	restoreMu.RLock()
+	defer restoreMu.RUnlock()
+	fn()
+}
+
+// RestoreDatabase validates the SQLite file at path and swaps it in as the live database
+// The original database is left untouched if validation fails
+func RestoreDatabase(path string) (result *RestoreResult, err error) {
+	if err := db.ValidateBackup(path); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	end, err := BeginOperation(OperationRestore)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { end(err) }()
+
+	restoring.Store(true)
+	defer restoring.Store(false)
+	restoreMu.Lock()
+	defer restoreMu.Unlock()
+
+	FlushShareHits()
+
+	previous, err := db.Restore(path)
+	if err != nil {
+		log.Printf("[RESTORE] Failed to restore database: %v", err)
+		return nil, err
+	}
+
+	// Reload state cached from the previous database
+	InitMaintenance()
+	invalidateVersionCache()
+	cleanupFilesAfter(OperationRestore)
+
+	counts, err := db.GetRestoreCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[RESTORE] Database restored (%d lists, %d items), previous database kept at %s",
+		counts.Lists, counts.Items, previous)
+	BroadcastUpdate("database_restored", counts)
+
+	return &RestoreResult{RestoreCounts: counts, PreviousPath: previous}, nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+)
+
+func TestWithDatabaseLockWaitsForRestore(t *testing.T) {
+	restoreMu.Lock()
+	var ran atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		withDatabaseLock(func() { ran.Store(true) })
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if ran.Load() {
+		t.Error("worker ran while a restore held the database")
+	}
+	restoreMu.Unlock()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not run after the restore finished")
+	}
+	if !ran.Load() {
+		t.Error("worker did not run")
+	}
+}
+
+func TestRestoreWithRunningWorkers(t *testing.T) {
+	setupTestDB(t)
+	if _, err := db.CreateList("Groceries", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Workers query the database in a loop the way the background routines do on every tick
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var failures atomic.Int64
+	var lastErr atomic.Value
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				withDatabaseLock(func() {
+					if _, err := db.GetAllLists(); err != nil {
+						failures.Add(1)
+						lastErr.Store(err)
+					}
+					FlushShareHits()
+				})
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		backup := filepath.Join(t.TempDir(), "backup.db")
+		if _, err := db.BackupTo(backup); err != nil {
+			t.Fatalf("backup: %v", err)
+		}
+		result, err := RestoreDatabase(backup)
+		if err != nil {
+			t.Fatalf("restore %d: %v", i, err)
+		}
+		if result.Lists != 1 {
+			t.Errorf("restore %d: %d lists, want 1", i, result.Lists)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if n := failures.Load(); n > 0 {
+		t.Errorf("%d worker queries failed during restores, last: %v", n, lastErr.Load())
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"shopping-list/db"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SearchReindexResponse reports the size of the rebuilt search index
+type SearchReindexResponse struct {
+	Engine  string `json:"engine"`
+	Indexed int    `json:"indexed"`
+}
+
+// GetSearch returns ranked matches across items, history, templates and lists
+// scope is a comma separated subset of db.SearchScopes, all scopes are searched by default
+func GetSearch(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return Fail(c, ErrCodeValidation, "Search text is required")
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	var types []string
+	scope := c.Query("scope")
+	if scope == "" {
+		for _, t := range db.SearchScopes {
+			types = append(types, t...)
+		}
+	} else {
+		for _, name := range strings.Split(scope, ",") {
+			t, ok := db.SearchScopes[strings.TrimSpace(name)]
+			if !ok {
+				return Fail(c, ErrCodeValidation, "Unknown search scope: "+name)
+			}
+			types = append(types, t...)
+		}
+	}
+
+	results, err := db.Search(query, types, limit)
+	if err != nil {
+		log.Printf("[SEARCH] Query failed: %v", err)
+		return Fail(c, ErrCodeDB, "Search failed")
+	}
+	return c.JSON(results)
+}
+
+// ItemSearchQuery reads the list_id, completed, limit and offset of an item search from the query
+// The error describes an invalid value, q is left to the caller to require
+func ItemSearchQuery(c *fiber.Ctx) (db.ItemSearchOptions, error) {
+	opts := db.ItemSearchOptions{Query: strings.TrimSpace(c.Query("q")), Limit: 20}
+	if value := c.Query("list_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			return opts, errors.New("list_id must be a list ID")
+		}
+		opts.ListID = id
+	}
+	if value := c.Query("completed"); value != "" {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, errors.New("completed must be true or false")
+		}
+		opts.Completed = &completed
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 100 {
+			return opts, errors.New("limit must be between 1 and 100")
+		}
+		opts.Limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return opts, errors.New("offset must not be negative")
+		}
+		opts.Offset = offset
+	}
+	return opts, nil
+}
+
+// SearchItems finds items by a part of their name or description across lists, see db.SearchItems
+func SearchItems(c *fiber.Ctx) error {
+	opts, err := ItemSearchQuery(c)
+	if err != nil {
+		return Fail(c, ErrCodeValidation, err.Error())
+	}
+	if opts.Query == "" {
+		return Fail(c, ErrCodeValidation, "Search text is required")
+	}
+
+	results, err := db.SearchItems(opts)
+	if err != nil {
+		log.Printf("[SEARCH] Item search failed: %v", err)
+		return Fail(c, ErrCodeDB, "Search failed")
+	}
+	return c.JSON(results)
+}
+
+// ReindexSearch rebuilds the full-text search index from the database
+func ReindexSearch(c *fiber.Ctx) error {
+	if db.SearchEngine() != db.SearchEngineFTS5 {
+		return Fail(c, ErrCodeNotConfigured, "Full-text search is not available, searches use LIKE")
+	}
+
+	count, err := db.RebuildSearchIndex()
+	if err != nil {
+		log.Printf("[SEARCH] Reindex failed: %v", err)
+		return Fail(c, ErrCodeDB, "Failed to rebuild the search index")
+	}
+	return c.JSON(SearchReindexResponse{Engine: db.SearchEngineFTS5, Indexed: count})
+}
@@ -28,7 +28,7 @@ func GetSections(c *fiber.Ctx) error {
 		"ActiveList":   activeList,
 		"Translations": i18n.GetAllLocales(),
 		"Locales":      i18n.AvailableLocales(),
-		"DefaultLang":  i18n.GetDefaultLang(),
+		"DefaultLang":  RequestLang(c),
 	})
 }
 
@@ -38,7 +38,7 @@ func CreateSection(c *fiber.Ctx) error {
 	if name == "" {
 		return c.Status(400).SendString("Name is required")
 	}
-	if len(name) > MaxSectionNameLength {
+	if TextLength(name) > MaxSectionNameLength {
 		return c.Status(400).SendString("Name too long (max 100 characters)")
 	}
 	if name == "[HISTORY]" {
@@ -51,7 +51,7 @@ func CreateSection(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("section_created", section)
+	BroadcastFrom(c, "section_created", section)
 
 	// Return the new section partial for HTMX
 	return c.Render("partials/section", fiber.Map{
@@ -71,7 +71,7 @@ func UpdateSection(c *fiber.Ctx) error {
 	if name == "" {
 		return c.Status(400).SendString("Name is required")
 	}
-	if len(name) > MaxSectionNameLength {
+	if TextLength(name) > MaxSectionNameLength {
 		return c.Status(400).SendString("Name too long (max 100 characters)")
 	}
 	if name == "[HISTORY]" {
@@ -84,7 +84,7 @@ func UpdateSection(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("section_updated", section)
+	BroadcastFrom(c, "section_updated", section)
 
 	// Return updated section partial
 	return c.Render("partials/section", fiber.Map{
@@ -106,7 +106,7 @@ func DeleteSection(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("section_deleted", map[string]int64{"id": id})
+	BroadcastFrom(c, "section_deleted", map[string]int64{"id": id})
 
 	// Return empty string (HTMX will remove the element)
 	return c.SendString("")
@@ -125,7 +125,7 @@ func MoveSectionUp(c *fiber.Ctx) error {
 	}
 
 	// Broadcast and return full sections list
-	BroadcastUpdate("sections_reordered", nil)
+	BroadcastFrom(c, "sections_reordered", nil)
 	return returnAllSections(c)
 }
 
@@ -142,7 +142,7 @@ func MoveSectionDown(c *fiber.Ctx) error {
 	}
 
 	// Broadcast and return full sections list
-	BroadcastUpdate("sections_reordered", nil)
+	BroadcastFrom(c, "sections_reordered", nil)
 	return returnAllSections(c)
 }
 
@@ -192,7 +192,7 @@ func BatchDeleteSections(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("sections_deleted", map[string]interface{}{"ids": ids})
+	BroadcastFrom(c, "sections_deleted", map[string]interface{}{"ids": ids})
 
 	// Return updated sections list for modal
 	return returnSectionsForModal(c)
@@ -254,7 +254,7 @@ func GetSectionsListForModal(c *fiber.Ctx) error {
 	if c.Query("format") == "json" {
 		sections, err := db.GetAllSections()
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch sections"})
+			return Fail(c, ErrCodeDB, "Failed to fetch sections")
 		}
 		// Return simplified JSON for select options
 		type SectionOption struct {
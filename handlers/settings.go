@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"shopping-list/i18n"
+	"shopping-list/settings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var repositoryPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// settingDefs lists all settings exposed through the settings API
+var settingDefs = []settings.Def{
+	{Key: settingUpdateCheckEnabled, Type: settings.TypeBool, Default: "true"},
+	{Key: settingUpdateCheckInterval, Type: settings.TypeInt, Default: "1", Min: 1, Max: 24 * 30},
+	{Key: settingIncludePrerelease, Type: settings.TypeBool, Default: "false", Env: "UPDATE_INCLUDE_PRERELEASE"},
+	{Key: settingUpdateRepository, Type: settings.TypeString, Default: defaultUpdateRepository, Validate: func(value string) error {
+		if !repositoryPattern.MatchString(value) {
+			return fmt.Errorf("must be in owner/name format")
+		}
+		return nil
+	}},
+	{Key: settingAutoCleanupEnabled, Type: settings.TypeBool, Default: "false"},
+	{Key: settingAutoCleanupDays, Type: settings.TypeInt, Default: "30", Min: 1, Max: 3650},
+	{Key: settingRepairOrderingOnStartup, Type: settings.TypeBool, Default: "true"},
+	{Key: settingIdempotencyTTLHours, Type: settings.TypeInt, Default: "24", Env: "IDEMPOTENCY_TTL_HOURS", Min: 1, Max: 24 * 30},
+	{Key: settingDefaultLanguage, Type: settings.TypeString, Default: "en", Env: "DEFAULT_LANG", Validate: validateLanguage, Apply: i18n.SetDefaultLang},
+}
+
+func init() {
+	settings.Register(settingDefs...)
+	settings.OnChange(func(changed map[string]any) {
+		// Settings that affect the update check take effect on the next request
+		invalidateVersionCache()
+		BroadcastUpdate("settings_changed", changed)
+	})
+}
+
+// SettingsValidationResponse is the error body of a rejected settings update, with the reason per key
+type SettingsValidationResponse struct {
+	ErrorResponse
+	Errors map[string]string `json:"errors"`
+}
+
+// GetSettings returns every server-side setting with its type, default and where its value comes from
+func GetSettings(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"settings": settings.List()})
+}
+
+// UpdateSettings changes one or more server-side settings, numbers and booleans may be sent as strings
+func UpdateSettings(c *fiber.Ctx) error {
+	var req map[string]any
+	if err := c.BodyParser(&req); err != nil {
+		return Fail(c, ErrCodeInvalidJSON, "Invalid request")
+	}
+	if len(req) == 0 {
+		return Fail(c, ErrCodeValidation, "No settings given")
+	}
+
+	if err := settings.Update(req); err != nil {
+		var invalid *settings.ValidationError
+		if errors.As(err, &invalid) {
+			return c.Status(fiber.StatusBadRequest).JSON(SettingsValidationResponse{
+				ErrorResponse: NewErrorResponse(c, ErrCodeValidation, "Invalid settings: "+invalid.Error()),
+				Errors:        invalid.Errors,
+			})
+		}
+		return err
+	}
+
+	return c.JSON(fiber.Map{"settings": settings.List()})
+}
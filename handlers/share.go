@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"shopping-list/db"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	shareHitFlushInterval = 30 * time.Second
+	shareSweepInterval    = time.Hour
+	// Expired and revoked shares are kept this long so they keep answering 410
+	shareRetention = 7 * 24 * time.Hour
+)
+
+var (
+	shareLimiter *LoginRateLimiter
+
+	// Pending hit counts, flushed to the database in batches
+	shareHits   = make(map[int64]int64)
+	shareHitsMu sync.Mutex
+)
+
+// InitShares initializes share link throttling
+func InitShares() {
+	shareLimiter = NewLoginRateLimiter(RateLimitConfig{
+		MaxAttempts:     getEnvInt("SHARE_MAX_ATTEMPTS", 10),
+		WindowDuration:  time.Duration(getEnvInt("SHARE_WINDOW_MINUTES", 15)) * time.Minute,
+		LockoutDuration: time.Duration(getEnvInt("SHARE_LOCKOUT_MINUTES", 30)) * time.Minute,
+	})
+}
+
+// StartShareMaintenance runs the background hit flush and expiry sweep until ctx is cancelled
+func StartShareMaintenance(ctx context.Context) {
+	goBackground(func() { shareMaintenanceRoutine(ctx) })
+}
+
+// shareMaintenanceRoutine periodically flushes hit counts and deletes stale shares
+// Pending hit counts are flushed once more when it stops
+func shareMaintenanceRoutine(ctx context.Context) {
+	flushTicker := time.NewTicker(shareHitFlushInterval)
+	defer flushTicker.Stop()
+	sweepTicker := time.NewTicker(shareSweepInterval)
+	defer sweepTicker.Stop()
+
+	withDatabaseLock(sweepShares)
+	for {
+		select {
+		case <-ctx.Done():
+			withDatabaseLock(FlushShareHits)
+			return
+		case <-flushTicker.C:
+			withDatabaseLock(FlushShareHits)
+		case <-sweepTicker.C:
+			withDatabaseLock(sweepShares)
+		}
+	}
+}
+
+func sweepShares() {
+	deleted, err := db.DeleteStaleShares(time.Now().Add(-shareRetention).Unix())
+	if err != nil {
+		log.Printf("[SHARE] Expiry sweep failed: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("[SHARE] Deleted %d stale share(s)", deleted)
+	}
+}
+
+func recordShareHit(id int64) {
+	shareHitsMu.Lock()
+	shareHits[id]++
+	shareHitsMu.Unlock()
+}
+
+// FlushShareHits writes pending hit counts to the database
+func FlushShareHits() {
+	shareHitsMu.Lock()
+	if len(shareHits) == 0 {
+		shareHitsMu.Unlock()
+		return
+	}
+	pending := shareHits
+	shareHits = make(map[int64]int64)
+	shareHitsMu.Unlock()
+
+	if err := db.AddShareHits(pending); err != nil {
+		log.Printf("[SHARE] Failed to flush hit counts: %v", err)
+		// Put the counts back so they are retried on the next flush
+		shareHitsMu.Lock()
+		for id, count := range pending {
+			shareHits[id] += count
+		}
+		shareHitsMu.Unlock()
+	}
+}
+
+// GetSharedList returns a read-only snapshot of a shared list (public, no auth)
+// Unknown tokens count as failed attempts, so guessing is throttled per IP
+func GetSharedList(c *fiber.Ctx) error {
+	ip := ClientIP(c).String()
+
+	if shareLimiter != nil {
+		if blocked, _ := shareLimiter.IsBlocked(ip); blocked {
+			return Fail(c, ErrCodeRateLimited, "Too many invalid share links, try again later")
+		}
+	}
+
+	share, err := db.GetShareByToken(c.Params("token"))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return Fail(c, ErrCodeDB, "Failed to fetch share")
+		}
+		if shareLimiter != nil {
+			shareLimiter.RecordAttempt(ip)
+		}
+		return Fail(c, ErrCodeNotFound, "Share link not found")
+	}
+
+	if share.IsRevoked() {
+		return Fail(c, ErrCodeShareRevoked, "This share link has been revoked")
+	}
+	if share.IsExpired() {
+		return Fail(c, ErrCodeShareExpired, "This share link has expired")
+	}
+
+	list, err := db.GetListByID(share.ListID)
+	if err != nil {
+		return Fail(c, ErrCodeNotFound, "List not found")
+	}
+	sections, err := db.GetSectionsByList(share.ListID)
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to fetch sections")
+	}
+
+	recordShareHit(share.ID)
+	return c.JSON(struct {
+		ExportList
+		Totals []db.PriceTotal `json:"totals"`
+	}{toExportList(list, sections), db.PriceTotals(sections)})
+}
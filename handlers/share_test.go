@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newShareApp serves GET /share/:token with a fresh limiter that locks an IP out after maxAttempts unknown tokens
+func newShareApp(t *testing.T, maxAttempts int) *fiber.App {
+	t.Helper()
+	setupTestDB(t)
+	previous := shareLimiter
+	shareLimiter = NewLoginRateLimiter(RateLimitConfig{MaxAttempts: maxAttempts, WindowDuration: time.Minute, LockoutDuration: time.Minute})
+	shareHitsMu.Lock()
+	shareHits = make(map[int64]int64)
+	shareHitsMu.Unlock()
+	t.Cleanup(func() { shareLimiter = previous })
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/share/:token", GetSharedList)
+	return app
+}
+
+// getShare fetches the share token and returns the status and body
+func getShare(t *testing.T, app *fiber.App, token string) (int, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", "/share/"+token, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+// createSharedList creates a list with one item and a share of it that expires at expiresAt
+func createSharedList(t *testing.T, token string, expiresAt int64) *db.Share {
+	t.Helper()
+	list, err := db.CreateList("Party", "🎉")
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, err := db.CreateSectionForList(list.ID, "Drinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateItem(section.ID, "Lemonade", "", 3); err != nil {
+		t.Fatal(err)
+	}
+	share, err := db.CreateShare(list.ID, token, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return share
+}
+
+func TestGetSharedList(t *testing.T) {
+	app := newShareApp(t, 10)
+	share := createSharedList(t, "valid-token", time.Now().Add(time.Hour).Unix())
+
+	status, body := getShare(t, app, "valid-token")
+	if status != fiber.StatusOK {
+		t.Fatalf("valid share: %d %s", status, body)
+	}
+	var list ExportList
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	if list.Name != "Party" || len(list.Sections) != 1 || len(list.Sections[0].Items) != 1 || list.Sections[0].Items[0].Name != "Lemonade" {
+		t.Errorf("shared list = %+v, want Party with its lemonade", list)
+	}
+
+	// Hits are counted in memory and written in one batch
+	getShare(t, app, "valid-token")
+	if got, _ := db.GetShareByID(share.ID); got.Hits != 0 {
+		t.Errorf("hits = %d before the flush, want 0", got.Hits)
+	}
+	FlushShareHits()
+	if got, _ := db.GetShareByID(share.ID); got.Hits != 2 || got.LastHitAt == 0 {
+		t.Errorf("share after the flush = %+v, want 2 hits", got)
+	}
+}
+
+func TestGetSharedListGone(t *testing.T) {
+	app := newShareApp(t, 10)
+	expired := createSharedList(t, "expired-token", time.Now().Add(time.Hour).Unix())
+	if _, err := db.DB.Exec("UPDATE shares SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Minute).Unix(), expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := db.CreateShare(expired.ListID, "revoked-token", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeShare(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeShare(revoked.ID); err == nil {
+		t.Error("revoking a share twice succeeded")
+	}
+
+	// Known but dead links answer 410 with their own code, and do not count as guesses
+	for i := 0; i < 20; i++ {
+		if status, body := getShare(t, app, "expired-token"); status != fiber.StatusGone || errorCodeOf(t, body) != ErrCodeShareExpired {
+			t.Fatalf("expired share: %d %s, want 410 %s", status, body, ErrCodeShareExpired)
+		}
+		if status, body := getShare(t, app, "revoked-token"); status != fiber.StatusGone || errorCodeOf(t, body) != ErrCodeShareRevoked {
+			t.Fatalf("revoked share: %d %s, want 410 %s", status, body, ErrCodeShareRevoked)
+		}
+	}
+	FlushShareHits()
+	if got, _ := db.GetShareByID(expired.ID); got.Hits != 0 {
+		t.Errorf("expired share counted %d hits", got.Hits)
+	}
+	if active, err := db.GetActiveShares(); err != nil || len(active) != 0 {
+		t.Errorf("active shares = %+v, %v, want none", active, err)
+	}
+
+	// The sweep only deletes them once the retention has passed
+	if deleted, err := db.DeleteStaleShares(time.Now().Add(-shareRetention).Unix()); err != nil || deleted != 0 {
+		t.Errorf("sweep deleted %d, %v, want the fresh ones kept", deleted, err)
+	}
+	if deleted, err := db.DeleteStaleShares(time.Now().Add(time.Minute).Unix()); err != nil || deleted != 2 {
+		t.Errorf("sweep deleted %d, %v, want both", deleted, err)
+	}
+	if status, _ := getShare(t, app, "expired-token"); status != fiber.StatusNotFound {
+		t.Errorf("swept share: %d, want 404", status)
+	}
+}
+
+func TestGetSharedListThrottlesUnknownTokens(t *testing.T) {
+	app := newShareApp(t, 3)
+	createSharedList(t, "valid-token", 0)
+	shareFrom := func(ip, token string) int {
+		t.Helper()
+		return serveFrom(t, app, "GET", "/share/"+token, ip, nil)
+	}
+
+	// Like logins, the attempt past the limit is answered and starts the lockout
+	for i := 0; i < 4; i++ {
+		if status := shareFrom("198.51.100.7", "guess"); status != fiber.StatusNotFound {
+			t.Fatalf("guess %d: %d, want 404", i+1, status)
+		}
+	}
+
+	// Once locked out, even a valid token is refused from that IP, other IPs are unaffected
+	if status := shareFrom("198.51.100.7", "guess"); status != fiber.StatusTooManyRequests {
+		t.Errorf("guess after the lockout: %d, want 429", status)
+	}
+	if status := shareFrom("198.51.100.7", "valid-token"); status != fiber.StatusTooManyRequests {
+		t.Errorf("valid token after the lockout: %d, want 429", status)
+	}
+	if status := shareFrom("203.0.113.9", "valid-token"); status != fiber.StatusOK {
+		t.Errorf("valid token from another IP: %d, want 200", status)
+	}
+
+	// Valid tokens are not attempts, however often they are fetched
+	for i := 0; i < 10; i++ {
+		if status := shareFrom("203.0.113.9", "valid-token"); status != fiber.StatusOK {
+			t.Fatalf("fetch %d of a valid token: %d, want 200", i+1, status)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// background tracks the workers started with goBackground, so shutdown can wait for them
+var background sync.WaitGroup
+
+// goBackground runs fn in a goroutine that WaitForBackground waits for
+// fn must return once the context it was started with is cancelled
+func goBackground(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// WaitForBackground waits until all background workers returned, it reports false on timeout
+func WaitForBackground(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		log.Printf("[SHUTDOWN] Background workers still running after %s", timeout)
+		return false
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+)
+
+// webhookReceiver records the updates posted to it and whether their signatures matched
+type webhookReceiver struct {
+	mu      sync.Mutex
+	types   []string
+	badSigs int
+}
+
+func newWebhookReceiver(t *testing.T, secret string) (*webhookReceiver, *httptest.Server) {
+	t.Helper()
+	r := &webhookReceiver{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		var message WebSocketMessage
+		json.Unmarshal(body, &message)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if req.Header.Get("X-Koffan-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			r.badSigs++
+		}
+		r.types = append(r.types, message.Type)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func TestWebhooksDrainOnShutdown(t *testing.T) {
+	setupTestDB(t)
+	receiver, srv := newWebhookReceiver(t, "s3cret")
+	t.Setenv("WEBHOOK_URL", srv.URL)
+	t.Setenv("WEBHOOK_SECRET", "s3cret")
+
+	// Updates broadcast before shutdown are still queued when the worker is told to stop
+	for _, eventType := range []string{"item_created", "item_updated", "import_completed"} {
+		BroadcastUpdate(eventType, map[string]int{"id": 1})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	StartWebhooks(ctx)
+	if !WaitForBackground(5 * time.Second) {
+		t.Fatal("webhook worker did not stop")
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if len(receiver.types) != 3 || receiver.types[0] != "item_created" || receiver.types[2] != "import_completed" {
+		t.Errorf("delivered %v, want the three queued updates in order", receiver.types)
+	}
+	if receiver.badSigs != 0 {
+		t.Errorf("%d deliveries had a wrong signature", receiver.badSigs)
+	}
+}
+
+func TestWebhooksDisabledQueueNothing(t *testing.T) {
+	setupTestDB(t)
+	BroadcastUpdate("item_created", nil)
+	if n := len(webhookQueue); n != 0 {
+		t.Errorf("%d updates queued without a webhook URL", n)
+	}
+}
+
+func TestScheduledBackupPushFinishesOnShutdown(t *testing.T) {
+	setupTestDB(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(io.Discard, req.Body)
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("BACKUP_PUSH_ENABLED", "true")
+	t.Setenv("BACKUP_PUSH_TARGET", "webdav")
+	t.Setenv("BACKUP_WEBDAV_URL", srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runBackupPush(ctx, time.Now(), nil)
+		close(done)
+	}()
+
+	// The signal arrives while the export is being uploaded
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled push did not stop")
+	}
+
+	if last, _ := db.GetSetting(settingBackupPushLast, "0"); last == "0" {
+		t.Error("the push in progress was cancelled instead of finished")
+	}
+}
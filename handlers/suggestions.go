@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"shopping-list/db"
+	"shopping-list/i18n"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -24,7 +26,7 @@ func GetSuggestions(c *fiber.Ctx) error {
 	if query == "" {
 		suggestions, err := db.GetAllItemSuggestions(limit)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch suggestions"})
+			return Fail(c, ErrCodeDB, "Failed to fetch suggestions")
 		}
 		if suggestions == nil {
 			suggestions = []db.ItemSuggestion{}
@@ -34,7 +36,7 @@ func GetSuggestions(c *fiber.Ctx) error {
 
 	suggestions, err := db.GetItemSuggestions(query, limit)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch suggestions"})
+		return Fail(c, ErrCodeDB, "Failed to fetch suggestions")
 	}
 
 	if suggestions == nil {
@@ -46,28 +48,48 @@ func GetSuggestions(c *fiber.Ctx) error {
 
 // GetHistory returns all history items for management UI
 func GetHistory(c *fiber.Ctx) error {
+	version, err := db.HistoryVersion()
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to fetch history")
+	}
+	lang := RequestLang(c)
+	if NotModified(c, version, lang) {
+		return NotModifiedResponse(c)
+	}
+
 	items, err := db.GetItemHistoryList()
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch history"})
+		return Fail(c, ErrCodeDB, "Failed to fetch history")
 	}
 
 	if items == nil {
 		items = []db.HistoryItem{}
 	}
 
+	LocalizeHistory(items, lang)
 	return c.JSON(items)
 }
 
+// LocalizeHistory fills in the display fields of history items for lang
+func LocalizeHistory(items []db.HistoryItem, lang string) {
+	now := time.Now()
+	for i := range items {
+		if items[i].LastUsedAt > 0 {
+			items[i].LastUsedAtDisplay = i18n.FormatRelative(lang, time.Unix(items[i].LastUsedAt, 0), now)
+		}
+	}
+}
+
 // DeleteHistoryItem deletes a single item from history
 func DeleteHistoryItem(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+		return Fail(c, ErrCodeInvalidID, "Invalid ID")
 	}
 
 	err = db.DeleteItemHistory(id)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete history item"})
+		return Fail(c, ErrCodeDeleteFailed, "Failed to delete history item")
 	}
 
 	return c.JSON(fiber.Map{"success": true})
@@ -77,12 +99,12 @@ func DeleteHistoryItem(c *fiber.Ctx) error {
 func BatchDeleteHistory(c *fiber.Ctx) error {
 	idsStr := c.FormValue("ids")
 	if idsStr == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "No IDs provided"})
+		return Fail(c, ErrCodeValidation, "No IDs provided")
 	}
 
 	idStrings := strings.Split(idsStr, ",")
 	if len(idStrings) > 100 {
-		return c.Status(400).JSON(fiber.Map{"error": "Too many IDs (max 100)"})
+		return Fail(c, ErrCodeValidation, "Too many IDs (max 100)")
 	}
 	ids := make([]int64, 0, len(idStrings))
 
@@ -95,12 +117,12 @@ func BatchDeleteHistory(c *fiber.Ctx) error {
 	}
 
 	if len(ids) == 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "No valid IDs provided"})
+		return Fail(c, ErrCodeValidation, "No valid IDs provided")
 	}
 
 	deleted, err := db.DeleteItemHistoryBatch(ids)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete history items"})
+		return Fail(c, ErrCodeDeleteFailed, "Failed to delete history items")
 	}
 
 	return c.JSON(fiber.Map{"deleted": deleted})
@@ -61,7 +61,7 @@ func CreateTemplate(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_created", template)
+	BroadcastFrom(c, "template_created", template)
 
 	// Return the new template partial
 	return c.Render("partials/template_item", fiber.Map{
@@ -89,7 +89,7 @@ func UpdateTemplate(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_updated", template)
+	BroadcastFrom(c, "template_updated", template)
 
 	// Return updated template partial
 	return c.Render("partials/template_item", fiber.Map{
@@ -110,7 +110,7 @@ func DeleteTemplate(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_deleted", map[string]int64{"id": id})
+	BroadcastFrom(c, "template_deleted", map[string]int64{"id": id})
 
 	return c.SendString("")
 }
@@ -207,7 +207,7 @@ func ApplyTemplate(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_applied", map[string]interface{}{
+	BroadcastFrom(c, "template_applied", map[string]interface{}{
 		"template_id": templateID,
 		"list_id":     activeList.ID,
 	})
@@ -237,7 +237,7 @@ func CreateTemplateFromList(c *fiber.Ctx) error {
 	}
 
 	// Broadcast to WebSocket clients
-	BroadcastUpdate("template_created", template)
+	BroadcastFrom(c, "template_created", template)
 
 	// Return the new template partial
 	return c.Render("partials/template_item", fiber.Map{
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// TextLength is the length of s in characters, as the length limits of names and descriptions count it
+func TextLength(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// truncateText shortens s to at most max characters, the limit the length checks of imports use.
+// It cuts between grapheme clusters, so emoji sequences and letters with combining marks stay whole
+func truncateText(s string, max int) string {
+	if TextLength(s) <= max {
+		return s
+	}
+	runes, end := 0, 0
+	graphemes := uniseg.NewGraphemes(s)
+	for graphemes.Next() {
+		runes += len(graphemes.Runes())
+		if runes > max {
+			break
+		}
+		_, end = graphemes.Positions()
+	}
+	return strings.TrimSpace(s[:end])
+}
+
+// abbreviateText is truncateText with "…" marking the cut, for text shown to users such as release notes
+// The result, ellipsis included, is at most max characters
+func abbreviateText(s string, max int) string {
+	if TextLength(s) <= max {
+		return s
+	}
+	return truncateText(s, max-1) + "…"
+}
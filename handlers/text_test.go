@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// Decomposed, emoji and multi-code-point test strings
+const (
+	decomposedApfel = "A\u0308pfel"                                // A and a combining diaeresis
+	thumbsUpTone    = "\U0001F44D\U0001F3FD"                       // Thumbs up with a skin tone
+	polishFlag      = "\U0001F1F5\U0001F1F1"                       // Two regional indicators
+	family          = "\U0001F469\u200d\U0001F469\u200d\U0001F467" // Joined with zero-width joiners
+)
+
+func TestTextLength(t *testing.T) {
+	cases := map[string]int{
+		"":              0,
+		"Milk":          4,
+		"Молоко":        6,
+		"Äpfel":         5,
+		decomposedApfel: 6,
+		thumbsUpTone:    2,
+		polishFlag:      2,
+		family:          5,
+	}
+	for s, want := range cases {
+		if got := TextLength(s); got != want {
+			t.Errorf("TextLength(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	cases := []struct {
+		name, s string
+		max     int
+		want    string
+	}{
+		{"short enough", "Milk", 4, "Milk"},
+		{"ascii", "Butter", 3, "But"},
+		{"cyrillic counts characters, not bytes", "Молоко", 4, "Моло"},
+		{"trailing space is trimmed", "Oat milk", 4, "Oat"},
+		{"combining mark stays with its letter", decomposedApfel, 1, ""},
+		{"combining mark fits", decomposedApfel, 2, "A\u0308"},
+		{"skin tone is not split", "Ok " + thumbsUpTone, 4, "Ok"},
+		{"skin tone fits", "Ok " + thumbsUpTone, 5, "Ok " + thumbsUpTone},
+		{"flag is not split", polishFlag + "\U0001F1E9\U0001F1EA", 3, polishFlag},
+		{"zwj sequence counts its joiners", family + "!!", 6, family + "!"},
+		{"zwj sequence is not split", "!" + family, 5, "!"},
+		{"zwj sequence dropped whole", "ab" + family, 6, "ab"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := truncateText(tc.s, tc.max)
+			if got != tc.want {
+				t.Errorf("truncateText(%q, %d) = %q, want %q", tc.s, tc.max, got, tc.want)
+			}
+			if TextLength(got) > tc.max {
+				t.Errorf("truncateText(%q, %d) = %q, over the limit", tc.s, tc.max, got)
+			}
+		})
+	}
+}
+
+func TestAbbreviateText(t *testing.T) {
+	if got := abbreviateText("Release notes", 13); got != "Release notes" {
+		t.Errorf("text within the limit changed to %q", got)
+	}
+	if got := abbreviateText("Release notes", 8); got != "Release…" {
+		t.Errorf("abbreviateText = %q, want %q", got, "Release…")
+	}
+	if got := abbreviateText("Fixed "+polishFlag+" flags", 8); got != "Fixed…" {
+		t.Errorf("flag split: abbreviateText = %q, want %q", got, "Fixed…")
+	}
+
+	// Cutting by code points would keep the thumbs up and drop its skin tone
+	prefix := strings.Repeat("a", maxReleaseNotesLength-2)
+	got := abbreviateText(prefix+thumbsUpTone+" more", maxReleaseNotesLength)
+	if got != prefix+"…" {
+		t.Errorf("abbreviated notes end in %q, want the skin tone sequence dropped whole", got[len(prefix):])
+	}
+}
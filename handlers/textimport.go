@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"shopping-list/db"
+	"shopping-list/i18n"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxPastedLines bounds the lines of a text import, so one paste cannot flood clients with events
+const MaxPastedLines = 1000
+
+// TextImportRequest is the body of a text import
+// Without ListID or ListName the items go to the active list
+type TextImportRequest struct {
+	Text     string `json:"text"`
+	ListID   int64  `json:"list_id,omitempty"`
+	ListName string `json:"list_name,omitempty"` // Creates a new list
+	ListIcon string `json:"list_icon,omitempty"`
+}
+
+// TextImportResponse counts what a text import created
+type TextImportResponse struct {
+	ListID          int64 `json:"list_id"`
+	ListCreated     bool  `json:"list_created"`
+	CreatedSections int   `json:"created_sections"`
+	CreatedItems    int   `json:"created_items"`
+}
+
+// checkMarks start lines of items that are done, or explicitly not done
+// Emoji variants come before the plain symbols they start with
+var checkMarks = []struct {
+	mark      string
+	completed bool
+}{{"✔️", true}, {"☑️", true}, {"✓", true}, {"✔", true}, {"☑", true}, {"✅", true}, {"☒", true}, {"☐", false}}
+
+// markdownUnescaper reverses markdownEscaper, so Markdown exports paste back unchanged
+var markdownUnescaper = strings.NewReplacer(`\\`, `\`, "\\`", "`", `\*`, `*`, `\_`, `_`, `\[`, `[`, `\]`, `]`, `\<`, `<`, `\>`, `>`)
+
+// ImportText adds items pasted as text, one per line, to an existing or a new list
+// "## Section" lines start a section, "- [x]" or a leading check mark marks an item completed.
+// The Markdown export format is understood, including quantities, descriptions and (?) for uncertain items
+func ImportText(c *fiber.Ctx) error {
+	var req TextImportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return Fail(c, ErrCodeInvalidJSON, "Invalid request")
+	}
+
+	sections, lines := parsePastedText(req.Text)
+	if lines > MaxPastedLines {
+		return Fail(c, ErrCodeValidation, "Too many lines (max "+strconv.Itoa(MaxPastedLines)+")")
+	}
+	if len(sections) == 0 {
+		return Fail(c, ErrCodeValidation, "No items found in the text")
+	}
+
+	name := strings.TrimSpace(req.ListName)
+	icon := req.ListIcon
+	if name != "" {
+		if TextLength(name) > MaxListNameLength {
+			return Fail(c, ErrCodeValidation, "List name too long (max 100 characters)")
+		}
+		if name == "[HISTORY]" {
+			return Fail(c, ErrCodeValidation, "This name is reserved for system use")
+		}
+		if len(icon) > MaxIconLength {
+			return Fail(c, ErrCodeValidation, "Icon too long")
+		}
+		exists, err := db.ListNameExists(name, 0)
+		if err != nil {
+			return Fail(c, ErrCodeDB, "Failed to check list name")
+		}
+		if exists {
+			return Fail(c, ErrCodeListNameExists, "A list with this name already exists")
+		}
+	}
+
+	listID := req.ListID
+	if name == "" && listID == 0 {
+		active, err := db.GetActiveList()
+		if err != nil {
+			return Fail(c, ErrCodeNotFound, "No active list")
+		}
+		listID = active.ID
+	} else if name == "" {
+		if _, err := db.GetListByID(listID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return Fail(c, ErrCodeNotFound, "List not found")
+			}
+			return Fail(c, ErrCodeDB, "Failed to fetch list")
+		}
+	}
+
+	// Items before the first heading go to the default section
+	defaultSection := i18n.Get(RequestLang(c), "sections.default")
+	if defaultSection == "sections.default" {
+		defaultSection = "General"
+	}
+	for i := range sections {
+		if sections[i].Name == "" {
+			sections[i].Name = defaultSection
+		}
+	}
+
+	tx, err := db.BeginWrite()
+	if err != nil {
+		return Fail(c, ErrCodeDB, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	var list *db.List
+	if name != "" {
+		list, err = db.CreateListTx(tx, name, icon)
+		if err != nil {
+			return Fail(c, ErrCodeCreateFailed, "Failed to create list")
+		}
+		listID = list.ID
+	}
+
+	createdSections, createdItems, err := db.AddPastedItemsTx(tx, listID, sections)
+	if err != nil {
+		return Fail(c, ErrCodeCreateFailed, "Failed to add items")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Fail(c, ErrCodeCommitFailed, "Failed to save items")
+	}
+
+	if list != nil {
+		BroadcastFrom(c, "list_created", list)
+	}
+	for i := range createdSections {
+		BroadcastFrom(c, "section_created", &createdSections[i])
+	}
+	for i := range createdItems {
+		BroadcastFrom(c, "item_created", &createdItems[i])
+	}
+
+	return c.JSON(TextImportResponse{
+		ListID:          listID,
+		ListCreated:     list != nil,
+		CreatedSections: len(createdSections),
+		CreatedItems:    len(createdItems),
+	})
+}
+
+// parsePastedText splits text into sections of items and counts its non-empty lines
+// Sections named "" hold the items before the first heading, "#" headings name the list and are skipped
+func parsePastedText(text string) ([]db.PastedSection, int) {
+	var sections []db.PastedSection
+	lines := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines++
+
+		if level := len(line) - len(strings.TrimLeft(line, "#")); level > 0 && level <= 6 && strings.HasPrefix(line[level:], " ") {
+			if level > 1 {
+				name := markdownUnescaper.Replace(strings.TrimSpace(line[level:]))
+				sections = append(sections, db.PastedSection{Name: truncateText(name, MaxSectionNameLength)})
+			}
+			continue
+		}
+
+		item, ok := parsePastedItem(line)
+		if !ok {
+			continue
+		}
+		if len(sections) == 0 {
+			sections = append(sections, db.PastedSection{})
+		}
+		last := &sections[len(sections)-1]
+		last.Items = append(last.Items, item)
+	}
+
+	// Headings without items add nothing
+	nonEmpty := sections[:0]
+	for _, s := range sections {
+		if len(s.Items) > 0 {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	return nonEmpty, lines
+}
+
+// parsePastedItem parses a line like "- [x] Milk ×2 - *low fat* (?)", ok is false if it names no item
+func parsePastedItem(line string) (db.PastedItem, bool) {
+	var item db.PastedItem
+
+	// List markers: -, *, +, • or a number
+	for _, bullet := range []string{"- ", "* ", "+ ", "• "} {
+		if strings.HasPrefix(line, bullet) {
+			line = strings.TrimSpace(line[len(bullet):])
+			break
+		}
+	}
+	if digits := len(line) - len(strings.TrimLeft(line, "0123456789")); digits > 0 && digits < len(line)-1 &&
+		(line[digits] == '.' || line[digits] == ')') && line[digits+1] == ' ' {
+		line = strings.TrimSpace(line[digits+2:])
+	}
+
+	switch {
+	case strings.HasPrefix(line, "[x]") || strings.HasPrefix(line, "[X]"):
+		item.Completed = true
+		line = strings.TrimSpace(line[3:])
+	case strings.HasPrefix(line, "[ ]"):
+		line = strings.TrimSpace(line[3:])
+	default:
+		for _, check := range checkMarks {
+			if strings.HasPrefix(line, check.mark) {
+				item.Completed = check.completed
+				line = strings.TrimSpace(line[len(check.mark):])
+				break
+			}
+		}
+	}
+
+	if rest, ok := strings.CutSuffix(line, "(?)"); ok {
+		item.Uncertain = true
+		line = strings.TrimSpace(rest)
+	}
+	if i := strings.LastIndex(line, " - *"); i >= 0 && strings.HasSuffix(line, "*") && len(line) > i+5 {
+		item.Description = truncateText(markdownUnescaper.Replace(line[i+4:len(line)-1]), MaxDescriptionLength)
+		line = strings.TrimSpace(line[:i])
+	}
+	if i := strings.LastIndex(line, " ×"); i >= 0 {
+		if qty, err := strconv.Atoi(line[i+len(" ×"):]); err == nil && qty >= 0 {
+			item.Quantity = qty
+			line = strings.TrimSpace(line[:i])
+		}
+	}
+
+	item.Name = truncateText(markdownUnescaper.Replace(line), MaxItemNameLength)
+	return item, item.Name != ""
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParsePastedText(t *testing.T) {
+	cases := []struct {
+		name  string
+		text  string
+		want  []db.PastedSection
+		lines int
+	}{
+		{
+			"plain lines and bullets",
+			"Milk\n\n  - Eggs  \n* Bread\n+ Jam\n• Tea\n1. Rice\n2) Beans\n",
+			[]db.PastedSection{{Items: []db.PastedItem{{Name: "Milk"}, {Name: "Eggs"}, {Name: "Bread"}, {Name: "Jam"}, {Name: "Tea"}, {Name: "Rice"}, {Name: "Beans"}}}},
+			7,
+		},
+		{
+			"checkboxes and check marks",
+			"- [x] Milk\n- [X] Eggs\n- [ ] Bread\n✓ Jam\n✔️ Tea\n✅ Rice\n☐ Beans\n",
+			[]db.PastedSection{{Items: []db.PastedItem{
+				{Name: "Milk", Completed: true}, {Name: "Eggs", Completed: true}, {Name: "Bread"},
+				{Name: "Jam", Completed: true}, {Name: "Tea", Completed: true}, {Name: "Rice", Completed: true}, {Name: "Beans"},
+			}}},
+			7,
+		},
+		{
+			"sections, the list title and empty headings",
+			"# 🛒 Groceries\nApples\n## Dairy\n- Milk\n## Empty\n### Bakery\n- Bread\n#hashtag\n",
+			[]db.PastedSection{
+				{Items: []db.PastedItem{{Name: "Apples"}}},
+				{Name: "Dairy", Items: []db.PastedItem{{Name: "Milk"}}},
+				{Name: "Bakery", Items: []db.PastedItem{{Name: "Bread"}, {Name: "#hashtag"}}},
+			},
+			8,
+		},
+		{
+			"the Markdown export format",
+			"## Snacks \\<salty\\>\n- [x] Ice \\[cubes\\] ×3 - *two\\_bags* (?)\n- [ ] Cola ×2\n- Beer (?)\n- Size ×L\n",
+			[]db.PastedSection{{Name: "Snacks <salty>", Items: []db.PastedItem{
+				{Name: "Ice [cubes]", Description: "two_bags", Quantity: 3, Completed: true, Uncertain: true},
+				{Name: "Cola", Quantity: 2},
+				{Name: "Beer", Uncertain: true},
+				{Name: "Size ×L"},
+			}}},
+			5,
+		},
+		{"no items", "# Title\n## Section\n\n   \n", nil, 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, lines := parsePastedText(tc.text)
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tc.want) || lines != tc.lines {
+				t.Errorf("parsePastedText = %+v, %d lines\nwant %+v, %d lines", got, lines, tc.want, tc.lines)
+			}
+		})
+	}
+}
+
+func TestParsePastedTextTruncatesLongLines(t *testing.T) {
+	name := strings.Repeat("Ж", MaxItemNameLength+20)
+	description := strings.Repeat("ą", MaxDescriptionLength+1)
+	section := strings.Repeat("ł", MaxSectionNameLength+1)
+	got, _ := parsePastedText("## " + section + "\n- " + name + " - *" + description + "*\n")
+	if len(got) != 1 || len(got[0].Items) != 1 {
+		t.Fatalf("parsePastedText = %+v, want one item", got)
+	}
+	item := got[0].Items[0]
+	if item.Name != strings.Repeat("Ж", MaxItemNameLength) {
+		t.Errorf("name has %d characters, want %d", TextLength(item.Name), MaxItemNameLength)
+	}
+	if item.Description != strings.Repeat("ą", MaxDescriptionLength) {
+		t.Errorf("description has %d characters, want %d", TextLength(item.Description), MaxDescriptionLength)
+	}
+	if got[0].Name != strings.Repeat("ł", MaxSectionNameLength) {
+		t.Errorf("section has %d characters, want %d", TextLength(got[0].Name), MaxSectionNameLength)
+	}
+}
+
+// postText sends a text import and decodes the response, or the error code of a failed one
+func postText(t *testing.T, app *fiber.App, req TextImportRequest) (int, TextImportResponse, string) {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq := httptest.NewRequest(http.MethodPost, "/import/text", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(httpReq, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var result TextImportResponse
+	var errResp ErrorResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+	} else {
+		json.Unmarshal(data, &errResp)
+	}
+	return resp.StatusCode, result, errResp.Error
+}
+
+func TestImportText(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	conn := dialWebSocket(t)
+	app := fiber.New()
+	app.Post("/import/text", ImportText)
+
+	// A new list, with items before the first heading in the default section
+	status, result, code := postText(t, app, TextImportRequest{
+		Text:     "Apples\n## Dairy\n- [x] Milk ×2 - *low fat*\n- Cheese (?)\n",
+		ListName: "Party",
+		ListIcon: "🎉",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("import into a new list: %d %s", status, code)
+	}
+	if !result.ListCreated || result.CreatedSections != 2 || result.CreatedItems != 3 {
+		t.Errorf("result = %+v, want a new list with 2 sections and 3 items", result)
+	}
+	if got, want := listSections(t, "Party"), map[string][]string{"General": {"Apples"}, "Dairy": {"Cheese", "Milk"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sections = %v, want %v", got, want)
+	}
+
+	// Open clients are told about the list, its sections and items
+	var events []string
+	for len(events) < 6 {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read broadcast after %v: %v", events, err)
+		}
+		var msg WebSocketMessage
+		json.Unmarshal(data, &msg)
+		events = append(events, msg.Type)
+	}
+	if want := []string{"list_created", "section_created", "section_created", "item_created", "item_created", "item_created"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("broadcasts = %v, want %v", events, want)
+	}
+
+	// Into the same list, Dairy is matched and only Bakery is created
+	status, result, code = postText(t, app, TextImportRequest{Text: "## dairy\nButter\n## Bakery\nBread\n", ListID: result.ListID})
+	if status != http.StatusOK || result.ListCreated || result.CreatedSections != 1 || result.CreatedItems != 2 {
+		t.Errorf("import into the list = %d %s %+v, want 1 section and 2 items", status, code, result)
+	}
+	if got := listSections(t, "Party")["Dairy"]; !reflect.DeepEqual(got, []string{"Butter", "Cheese", "Milk"}) {
+		t.Errorf("Dairy = %v, want the pasted Butter added", got)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    TextImportRequest
+		status int
+		code   string
+	}{
+		{"unknown list", TextImportRequest{Text: "Milk", ListID: 9999}, http.StatusNotFound, ErrCodeNotFound},
+		{"existing list name", TextImportRequest{Text: "Milk", ListName: "Party"}, http.StatusBadRequest, ErrCodeListNameExists},
+		{"reserved list name", TextImportRequest{Text: "Milk", ListName: "[HISTORY]"}, http.StatusBadRequest, ErrCodeValidation},
+		{"no items", TextImportRequest{Text: "# Title\n\n## Empty\n", ListName: "New"}, http.StatusBadRequest, ErrCodeValidation},
+		{"too many lines", TextImportRequest{Text: strings.Repeat("Milk\n", MaxPastedLines+1), ListName: "New"}, http.StatusBadRequest, ErrCodeValidation},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, _, code := postText(t, app, tc.req); status != tc.status || code != tc.code {
+				t.Errorf("got %d %q, want %d %q", status, code, tc.status, tc.code)
+			}
+		})
+	}
+	if lists, _ := db.GetAllLists(); len(lists) != 1 {
+		t.Errorf("rejected imports left %d lists, want 1", len(lists))
+	}
+}
+
+func TestImportTextReadsMarkdownExport(t *testing.T) {
+	initLocales(t)
+	setupTestDB(t)
+	app := fiber.New()
+	app.Post("/import/text", ImportText)
+
+	export := ExportList{Name: "Weekend", Icon: "🎉", Sections: []ExportSection{
+		{Name: "Drinks_*", Items: []ExportItem{
+			{Name: "Cola [light]", Quantity: 2},
+			{Name: "Juice", Description: "orange_or_apple", Completed: true, Quantity: 1},
+			{Name: "Beer", Uncertain: true, Quantity: 1},
+		}},
+	}}
+	var text strings.Builder
+	w := bufio.NewWriter(&text)
+	writeMarkdownList(w, export)
+	w.Flush()
+
+	status, _, code := postText(t, app, TextImportRequest{Text: text.String(), ListName: "Copy"})
+	if status != http.StatusOK {
+		t.Fatalf("import: %d %s", status, code)
+	}
+	lists, _ := db.GetAllLists()
+	sections, _ := db.GetSectionsByList(lists[0].ID)
+	if len(sections) != 1 || sections[0].Name != "Drinks_*" {
+		t.Fatalf("sections = %+v, want Drinks_*", sections)
+	}
+	items, _ := db.GetItemsBySection(sections[0].ID)
+	got := map[string]ExportItem{}
+	for _, item := range items {
+		got[item.Name] = ExportItem{Name: item.Name, Description: item.Description, Completed: item.Completed, Uncertain: item.Uncertain, Quantity: item.Quantity}
+	}
+	for _, want := range export.Sections[0].Items {
+		if got[want.Name] != want {
+			t.Errorf("%s = %+v, want %+v", want.Name, got[want.Name], want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"shopping-list/db"
+	"shopping-list/settings"
+	"time"
+)
+
+const settingTrashRetentionDays = "trash_retention_days"
+
+func init() {
+	settings.Register(settings.Def{Key: settingTrashRetentionDays, Type: settings.TypeInt, Default: "30",
+		Env: "TRASH_RETENTION_DAYS", Min: 1, Max: 3650})
+}
+
+// TrashRetentionDays returns how many days deleted items stay in the trash before they are purged
+func TrashRetentionDays() int {
+	return settings.Int(settingTrashRetentionDays)
+}
+
+// PurgeExpiredTrash deletes the items that have been in the trash longer than the retention and returns how many
+func PurgeExpiredTrash(now time.Time) (int64, error) {
+	purged, err := db.PurgeTrash(0, now.AddDate(0, 0, -TrashRetentionDays()).Unix())
+	if purged > 0 {
+		RemoveReleasedFiles()
+	}
+	return purged, err
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"shopping-list/db"
+)
+
+// exportedItemNames returns the names of the items in an export
+func exportedItemNames(data *ExportData) []string {
+	var names []string
+	for _, l := range data.Data.Lists {
+		for _, s := range l.Sections {
+			for _, i := range s.Items {
+				names = append(names, i.Name)
+			}
+		}
+	}
+	return names
+}
+
+// itemID returns the ID of the item with the given name
+func itemID(t *testing.T, name string) int64 {
+	t.Helper()
+	var id int64
+	if err := db.DB.QueryRow("SELECT id FROM items WHERE name = ?", name).Scan(&id); err != nil {
+		t.Fatalf("find item %q: %v", name, err)
+	}
+	return id
+}
+
+func TestExportSkipsTrashedItems(t *testing.T) {
+	setupTestDB(t)
+	seedExportData(t)
+	before := exportedItemNames(fullExport(t))
+
+	if err := db.DeleteItem(itemID(t, "Milk")); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	after := exportedItemNames(fullExport(t))
+	if len(after) != len(before)-1 {
+		t.Fatalf("export has %d items after a delete, want %d", len(after), len(before)-1)
+	}
+	for _, name := range after {
+		if name == "Milk" {
+			t.Errorf("export holds the deleted item: %v", after)
+		}
+	}
+
+	if _, err := db.RestoreItem(itemID(t, "Milk")); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored := exportedItemNames(fullExport(t)); len(restored) != len(before) {
+		t.Errorf("export has %d items after the restore, want %d", len(restored), len(before))
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	t.Setenv("TRASH_RETENTION_DAYS", "7")
+	setupTestDB(t)
+	seedExportData(t)
+	milk, cheese := itemID(t, "Milk"), itemID(t, "Gouda #1")
+	for _, id := range []int64{milk, cheese} {
+		if err := db.DeleteItem(id); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	// Milk was deleted 8 days ago, Gouda 6 days ago
+	now := time.Now()
+	for id, days := range map[int64]int{milk: 8, cheese: 6} {
+		if _, err := db.DB.Exec("UPDATE items SET deleted_at = ? WHERE id = ?", now.AddDate(0, 0, -days).Unix(), id); err != nil {
+			t.Fatalf("age item: %v", err)
+		}
+	}
+
+	purged, err := PurgeExpiredTrash(now)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d items, want only Milk", purged)
+	}
+	if _, err := db.RestoreItem(cheese); err != nil {
+		t.Errorf("Gouda is within the retention but cannot be restored: %v", err)
+	}
+	if _, err := db.RestoreItem(milk); err == nil {
+		t.Error("Milk is past the retention but was restored")
+	}
+}
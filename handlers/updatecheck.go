@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// updateCheckTick is how often the background checker wakes up
+// Actual GitHub requests are still limited by the cache interval setting
+const updateCheckTick = 10 * time.Minute
+
+var (
+	lastAnnouncedVersion string
+	announceMu           sync.Mutex
+)
+
+// StartUpdateChecker runs the periodic update check until ctx is cancelled
+func StartUpdateChecker(ctx context.Context) {
+	ticker := time.NewTicker(updateCheckTick)
+	goBackground(func() {
+		defer ticker.Stop()
+		runUpdateChecker(ctx, ticker.C)
+	})
+}
+
+// runUpdateChecker checks once immediately and then on every tick
+func runUpdateChecker(ctx context.Context, ticks <-chan time.Time) {
+	withDatabaseLock(checkForUpdate)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[VERSION] Update checker stopped")
+			return
+		case <-ticks:
+			withDatabaseLock(checkForUpdate)
+		}
+	}
+}
+
+// checkForUpdate broadcasts update_available once per newly detected version
+func checkForUpdate() {
+	if !updateCheckEnabled() {
+		return
+	}
+
+	latest := getCachedRelease()
+	if !isNewerVersion(latest.Version, AppVersion) {
+		return
+	}
+
+	announceMu.Lock()
+	if latest.Version == lastAnnouncedVersion {
+		announceMu.Unlock()
+		return
+	}
+	lastAnnouncedVersion = latest.Version
+	announceMu.Unlock()
+
+	log.Printf("[VERSION] New version available: %s (current: %s)", latest.Version, AppVersion)
+	BroadcastUpdate("update_available", versionResponse{
+		Current:         AppVersion,
+		Latest:          latest.Version,
+		UpdateAvailable: true,
+		ReleaseURL:      latest.URL,
+		ReleaseNotes:    abbreviateText(latest.Notes, maxReleaseNotesLength),
+	})
+}
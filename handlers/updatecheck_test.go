@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"shopping-list/settings"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeClock is a settable time source, safe to read from background goroutines
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) Advance(d time.Duration) { c.Set(c.Now().Add(d)) }
+
+// useVersionState runs the test against empty version and changelog caches, a fake clock and AppVersion v2.3.0
+// Everything is put back when the test ends
+func useVersionState(t *testing.T) *fakeClock {
+	t.Helper()
+	reset := func() {
+		versionMutex.Lock()
+		cachedRelease, cachedVersionTime, cachedETag, cachedETagURL, cachedRepository = nil, time.Time{}, "", "", ""
+		rateLimitedUntil = time.Time{}
+		versionMutex.Unlock()
+		announceMu.Lock()
+		lastAnnouncedVersion = ""
+		announceMu.Unlock()
+		changelogMutex.Lock()
+		changelogReleases, changelogRepo, changelogETag, changelogFetchedAt = nil, "", "", time.Time{}
+		changelogMutex.Unlock()
+	}
+	reset()
+	clock := &fakeClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	previousClock, previousVersion := versionClock, AppVersion
+	versionClock, AppVersion = clock.Now, "v2.3.0"
+	t.Cleanup(func() {
+		versionClock, AppVersion = previousClock, previousVersion
+		reset()
+	})
+	return clock
+}
+
+// newVersionApp serves the version endpoints the way main registers them
+func newVersionApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/api/version", GetVersion)
+	app.Post("/api/version/refresh", RefreshVersion)
+	return app
+}
+
+// getVersion requests path and decodes the version response
+func getVersion(t *testing.T, app *fiber.App, method, path string) versionResponse {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(method, path, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var v versionResponse
+	if resp.StatusCode != fiber.StatusOK || json.Unmarshal(data, &v) != nil {
+		t.Fatalf("%s %s: %d %s", method, path, resp.StatusCode, data)
+	}
+	return v
+}
+
+// readBroadcast waits up to wait for the next WebSocket message, ok is false if none arrives
+// A timeout breaks the connection, so a read expecting nothing must be the last one
+func readBroadcast(t *testing.T, conn *fastws.Conn, wait time.Duration) (msg struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}, ok bool) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(wait))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return msg, false
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("decode broadcast %s: %v", data, err)
+	}
+	return msg, true
+}
+
+const testLatestURL = testRepoAPI + "/releases/latest"
+
+func TestDisabledUpdateCheckMakesNoRequest(t *testing.T) {
+	setupTestDB(t)
+	useVersionState(t)
+	doer := useFakeGitHub(t, map[string]fakeResponse{
+		testLatestURL: {status: http.StatusOK, fixture: "github_release_latest.json"},
+	})
+	if err := settings.Update(map[string]any{settingUpdateCheckEnabled: false}); err != nil {
+		t.Fatal(err)
+	}
+	app := newVersionApp()
+
+	for _, path := range []string{"/api/version", "/api/version/refresh"} {
+		method := "GET"
+		if path == "/api/version/refresh" {
+			method = "POST"
+		}
+		if v := getVersion(t, app, method, path); v.Latest != "disabled" || v.Current != "v2.3.0" || v.UpdateAvailable {
+			t.Errorf("%s %s = %+v, want only the current version", method, path, v)
+		}
+	}
+	checkForUpdate()
+
+	// The background checker skips its checks as well, however often it ticks
+	ctx, cancel := context.WithCancel(context.Background())
+	ticks, done := make(chan time.Time), make(chan struct{})
+	go func() { runUpdateChecker(ctx, ticks); close(done) }()
+	ticks <- time.Now()
+	ticks <- time.Now()
+	cancel()
+	<-done
+
+	if len(doer.requested) != 0 {
+		t.Errorf("disabled update check requested %v", doer.requested)
+	}
+
+	// Enabling it again contacts GitHub on the next request
+	if err := settings.Update(map[string]any{settingUpdateCheckEnabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if v := getVersion(t, app, "GET", "/api/version"); v.Latest != "v2.4.0" || !v.UpdateAvailable || len(doer.requested) != 1 {
+		t.Errorf("enabled check = %+v after %v, want v2.4.0 from one request", v, doer.requested)
+	}
+}
+
+func TestVersionCacheConditionalRequests(t *testing.T) {
+	setupTestDB(t)
+	clock := useVersionState(t)
+	doer := useFakeGitHub(t, map[string]fakeResponse{
+		testLatestURL: {status: http.StatusOK, fixture: "github_release_latest.json", header: http.Header{"Etag": {`W/"abc"`}}},
+	})
+	ttl := versionCacheTTL()
+
+	if got := getCachedRelease(); got.Version != "v2.4.0" || len(doer.requested) != 1 {
+		t.Fatalf("first check = %+v after %d requests", got, len(doer.requested))
+	}
+	if h := doer.headers[0].Get("If-None-Match"); h != "" {
+		t.Errorf("first request sent If-None-Match %q", h)
+	}
+
+	// Within the interval the cache answers
+	clock.Advance(ttl - time.Minute)
+	getCachedRelease()
+	if len(doer.requested) != 1 {
+		t.Errorf("%d requests within the interval, want 1", len(doer.requested))
+	}
+
+	// After it the ETag is sent, and a 304 keeps the release and starts a new interval
+	clock.Advance(2 * time.Minute)
+	doer.responses[testLatestURL] = fakeResponse{status: http.StatusNotModified}
+	if got := getCachedRelease(); got.Version != "v2.4.0" || got.Notes == "" {
+		t.Errorf("check answered 304 = %+v, want the cached v2.4.0", got)
+	}
+	if len(doer.requested) != 2 || doer.headers[1].Get("If-None-Match") != `W/"abc"` {
+		t.Fatalf("revalidation: %d requests, If-None-Match %q", len(doer.requested), doer.headers[len(doer.headers)-1].Get("If-None-Match"))
+	}
+	clock.Advance(ttl - time.Minute)
+	getCachedRelease()
+	if len(doer.requested) != 2 {
+		t.Errorf("%d requests after a 304 within the interval, want 2", len(doer.requested))
+	}
+
+	// A network error keeps the previous answer, and is retried after the next interval rather than at once
+	clock.Advance(2 * time.Minute)
+	doer.err = errors.New("dial tcp: i/o timeout")
+	if got := getCachedRelease(); got.Version != "v2.4.0" {
+		t.Errorf("check during a network error = %+v, want the cached v2.4.0", got)
+	}
+	getCachedRelease()
+	if len(doer.requested) != 3 {
+		t.Errorf("%d requests after a network error, want 3", len(doer.requested))
+	}
+	clock.Advance(ttl)
+	doer.err = nil
+	doer.responses[testLatestURL] = fakeResponse{status: http.StatusOK, fixture: "github_release_next.json"}
+	if got := getCachedRelease(); got.Version != "v2.5.0" {
+		t.Errorf("check after the network came back = %+v, want v2.5.0", got)
+	}
+}
+
+func TestVersionCacheWithoutReachableGitHub(t *testing.T) {
+	setupTestDB(t)
+	useVersionState(t)
+	doer := useFakeGitHub(t, nil)
+	doer.err = errors.New("dial tcp: lookup api.github.com: no such host")
+
+	// Without an earlier answer the version is unknown, not an error, and no update is offered
+	v := getVersion(t, newVersionApp(), "GET", "/api/version")
+	if v.Latest != "unknown" || v.UpdateAvailable || v.ReleaseURL != "" {
+		t.Errorf("version without GitHub = %+v, want latest unknown", v)
+	}
+}
+
+func TestVersionCacheBacksOffWhenRateLimited(t *testing.T) {
+	setupTestDB(t)
+	clock := useVersionState(t)
+	reset := clock.Now().Add(3 * time.Hour)
+	doer := useFakeGitHub(t, map[string]fakeResponse{
+		testLatestURL: {status: http.StatusForbidden, header: http.Header{
+			"X-Ratelimit-Remaining": {"0"},
+			"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+		}},
+	})
+
+	if got := getCachedRelease(); got.Version != "unknown" {
+		t.Errorf("rate limited check = %+v, want unknown", got)
+	}
+	// Until the reset no request is made, however often the version is asked for
+	clock.Advance(versionCacheTTL() + time.Minute)
+	getCachedRelease()
+	if len(doer.requested) != 1 {
+		t.Errorf("%d requests before the reset, want 1", len(doer.requested))
+	}
+	clock.Set(reset.Add(time.Second))
+	doer.responses[testLatestURL] = fakeResponse{status: http.StatusOK, fixture: "github_release_latest.json"}
+	if got := getCachedRelease(); got.Version != "v2.4.0" || len(doer.requested) != 2 {
+		t.Errorf("check after the reset = %+v after %d requests, want v2.4.0", got, len(doer.requested))
+	}
+}
+
+func TestUpdateCheckerAnnouncesEachVersionOnce(t *testing.T) {
+	setupTestDB(t)
+	clock := useVersionState(t)
+	doer := useFakeGitHub(t, map[string]fakeResponse{
+		testLatestURL: {status: http.StatusOK, fixture: "github_release_latest.json"},
+	})
+	conn := dialWebSocket(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticks, done := make(chan time.Time), make(chan struct{})
+	go func() { runUpdateChecker(ctx, ticks); close(done) }()
+	// A tick is only received once the check before it finished, so a second tick waits for the first
+	// The second one finds the cache fresh and does not ask GitHub, so the fake may be changed after it
+	tick := func() {
+		clock.Advance(versionCacheTTL())
+		ticks <- clock.Now()
+		ticks <- clock.Now()
+	}
+
+	// The check at start announces the newer release
+	msg, ok := readBroadcast(t, conn, 2*time.Second)
+	var payload versionResponse
+	if ok {
+		json.Unmarshal(msg.Data, &payload)
+	}
+	if !ok || msg.Type != "update_available" || payload.Latest != "v2.4.0" || payload.Current != "v2.3.0" || !payload.UpdateAvailable || payload.ReleaseURL == "" {
+		t.Fatalf("broadcast = %+v (%v), want update_available for v2.4.0", msg, ok)
+	}
+
+	// Later checks finding the same release stay quiet, the next broadcast is the newer release
+	tick()
+	tick()
+	doer.responses[testLatestURL] = fakeResponse{status: http.StatusOK, fixture: "github_release_next.json"}
+	tick()
+	tick()
+	msg, ok = readBroadcast(t, conn, 2*time.Second)
+	if ok {
+		json.Unmarshal(msg.Data, &payload)
+	}
+	if !ok || msg.Type != "update_available" || payload.Latest != "v2.5.0" {
+		t.Errorf("broadcast = %+v (%v), want update_available for v2.5.0", msg, ok)
+	}
+
+	// Shutdown stops the checker
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("update checker did not stop")
+	}
+	if len(doer.requested) != 5 {
+		t.Errorf("%d requests over five checks, want each to ask GitHub", len(doer.requested))
+	}
+	if msg, ok := readBroadcast(t, conn, 100*time.Millisecond); ok {
+		t.Errorf("release announced again: %+v", msg)
+	}
+}
@@ -2,7 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"shopping-list/settings"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,88 +20,402 @@ import (
 var AppVersion = "dev"
 
 const (
-	githubTagsURL   = "https://api.github.com/repos/PanSalut/Koffan/tags"
-	versionCacheTTL = 1 * time.Hour
+	defaultUpdateRepository = "PanSalut/Koffan"
+	maxReleaseNotesLength   = 2000
+
+	settingUpdateCheckEnabled  = "update_check_enabled"
+	settingUpdateCheckInterval = "update_check_interval_hours"
+	settingUpdateRepository    = "update_repository"
+	settingIncludePrerelease   = "update_include_prerelease"
 )
 
 var (
-	cachedVersion     string
+	cachedRelease     *releaseInfo
 	cachedVersionTime time.Time
+	cachedETag        string
+	cachedETagURL     string
+	cachedRepository  string
+	rateLimitedUntil  time.Time
 	versionMutex      sync.RWMutex
 )
 
+// httpDoer is the subset of *http.Client used for update checks
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// versionHTTPClient performs update check requests, replaceable in tests
+var versionHTTPClient httpDoer = NewOutboundClient(5 * time.Second)
+
+// versionClock is the time source of the version cache and the rate limit backoff, replaceable in tests
+var versionClock = time.Now
+
+// fetchResult is the outcome of a single update check
+type fetchResult struct {
+	release          releaseInfo
+	etag             string
+	url              string
+	notModified      bool
+	rateLimitedUntil time.Time
+	err              error
+}
+
+// releaseInfo is the latest known release, cached between checks
+type releaseInfo struct {
+	Version    string
+	URL        string
+	Notes      string
+	Prerelease bool
+}
+
 type githubTag struct {
 	Name string `json:"name"`
 }
 
+type githubRelease struct {
+	TagName     string `json:"tag_name"`
+	HTMLURL     string `json:"html_url"`
+	Body        string `json:"body"`
+	Prerelease  bool   `json:"prerelease"`
+	Draft       bool   `json:"draft"`
+	PublishedAt string `json:"published_at"`
+}
+
 type versionResponse struct {
-	Current         string `json:"current"`
-	Latest          string `json:"latest"`
-	UpdateAvailable bool   `json:"update_available"`
-	ReleaseURL      string `json:"release_url,omitempty"`
+	Current         string    `json:"current"`
+	Latest          string    `json:"latest"`
+	UpdateAvailable bool      `json:"update_available"`
+	ReleaseURL      string    `json:"release_url,omitempty"`
+	ReleaseNotes    string    `json:"release_notes,omitempty"`
+	Build           BuildInfo `json:"build"`
 }
 
+var unknownRelease = releaseInfo{Version: "unknown"}
+
 // GetVersion returns current version and checks for updates
 func GetVersion(c *fiber.Ctx) error {
-	latest := getCachedVersion()
-	updateAvailable := isNewerVersion(latest, AppVersion)
+	if !updateCheckEnabled() {
+		return c.JSON(versionResponse{
+			Current: AppVersion,
+			Latest:  "disabled",
+			Build:   GetBuildInfo(),
+		})
+	}
+
+	latest := getCachedRelease()
+	updateAvailable := isNewerVersion(latest.Version, AppVersion)
 
 	response := versionResponse{
 		Current:         AppVersion,
-		Latest:          latest,
+		Latest:          latest.Version,
 		UpdateAvailable: updateAvailable,
+		Build:           GetBuildInfo(),
 	}
 
-	if updateAvailable && latest != "unknown" {
-		response.ReleaseURL = "https://github.com/PanSalut/Koffan/releases/tag/" + latest
+	if updateAvailable && latest.Version != "unknown" {
+		response.ReleaseURL = latest.URL
+		response.ReleaseNotes = abbreviateText(latest.Notes, maxReleaseNotesLength)
 	}
 
 	return c.JSON(response)
 }
 
-func getCachedVersion() string {
+// RefreshVersion bypasses the version cache once and returns the fresh result
+func RefreshVersion(c *fiber.Ctx) error {
+	if updateCheckEnabled() {
+		invalidateVersionCache()
+	}
+	return GetVersion(c)
+}
+
+// updateCheckEnabled returns false if the user opted out of contacting GitHub
+func updateCheckEnabled() bool {
+	return settings.Bool(settingUpdateCheckEnabled)
+}
+
+// versionCacheTTL returns the configured interval between update checks
+func versionCacheTTL() time.Duration {
+	return time.Duration(settings.Int(settingUpdateCheckInterval)) * time.Hour
+}
+
+// updateRepository returns the owner/name of the repository to check, for forks
+func updateRepository() string {
+	return settings.String(settingUpdateRepository)
+}
+
+// invalidateVersionCache forces the next update check to contact GitHub
+func invalidateVersionCache() {
+	versionMutex.Lock()
+	cachedVersionTime = time.Time{}
+	versionMutex.Unlock()
+}
+
+func getCachedRelease() releaseInfo {
+	repo := updateRepository()
+	ttl := versionCacheTTL()
+
 	versionMutex.RLock()
-	if cachedVersion != "" && time.Since(cachedVersionTime) < versionCacheTTL {
-		v := cachedVersion
+	if cachedRelease != nil && cachedRepository == repo && versionClock().Sub(cachedVersionTime) < ttl {
+		r := *cachedRelease
+		versionMutex.RUnlock()
+		return r
+	}
+	// While rate limited, keep serving whatever we have
+	if versionClock().Before(rateLimitedUntil) {
+		r := unknownRelease
+		if cachedRelease != nil {
+			r = *cachedRelease
+		}
 		versionMutex.RUnlock()
-		return v
+		return r
 	}
+	etag, etagURL := cachedETag, cachedETagURL
+	sameRepo := cachedRepository == repo
 	versionMutex.RUnlock()
 
-	// Fetch fresh version
-	version := fetchLatestVersion()
+	// Fetch fresh release
+	result := fetchLatestRelease(repo, includePrereleases(), etag, etagURL)
 
 	versionMutex.Lock()
-	cachedVersion = version
-	cachedVersionTime = time.Now()
-	versionMutex.Unlock()
+	defer versionMutex.Unlock()
+
+	if !sameRepo {
+		cachedRelease = nil
+	}
+
+	switch {
+	case result.notModified && cachedRelease != nil:
+		// Cache still valid
+	case !result.rateLimitedUntil.IsZero():
+		rateLimitedUntil = result.rateLimitedUntil
+		log.Printf("[VERSION] GitHub rate limit reached, next check after %s", rateLimitedUntil.Format(time.RFC3339))
+		if cachedRelease == nil {
+			return unknownRelease
+		}
+		return *cachedRelease
+	case result.err != nil:
+		// Keep the previous answer on transient errors
+		if cachedRelease == nil {
+			cachedRelease = &unknownRelease
+		}
+	default:
+		release := result.release
+		cachedRelease = &release
+		cachedETag = result.etag
+		cachedETagURL = result.url
+	}
+	cachedRepository = repo
+	cachedVersionTime = versionClock()
 
-	return version
+	return *cachedRelease
 }
 
-func fetchLatestVersion() string {
-	client := &http.Client{Timeout: 5 * time.Second}
+// includePrereleases returns true if update checks should consider prereleases
+// The persisted setting wins over the UPDATE_INCLUDE_PRERELEASE env var
+func includePrereleases() bool {
+	return settings.Bool(settingIncludePrerelease)
+}
+
+// githubRepoAPI returns the GitHub API base URL for a repository
+func githubRepoAPI(repo string) string {
+	return "https://api.github.com/repos/" + repo
+}
 
-	resp, err := client.Get(githubTagsURL)
+// githubReleaseURL returns the web URL of a release tag
+func githubReleaseURL(repo, tag string) string {
+	return "https://github.com/" + repo + "/releases/tag/" + tag
+}
+
+// newGitHubRequest builds a GitHub API request, authenticated if GITHUB_TOKEN is set
+func newGitHubRequest(url, etag string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return "unknown"
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	return req, nil
+}
+
+// rateLimitReset returns the reset time if the response signals an exhausted rate limit
+func rateLimitReset(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return versionClock().Add(time.Hour), true
+	}
+	return time.Unix(reset, 0), true
+}
+
+// fetchLatestRelease queries the GitHub releases API, falling back to tags if there are no releases
+// etag is sent as If-None-Match when it belongs to the same URL
+func fetchLatestRelease(repo string, withPrereleases bool, etag, etagURL string) fetchResult {
+	repoAPI := githubRepoAPI(repo)
+
+	// releases/latest never returns prereleases, so list releases when they are wanted
+	url := repoAPI + "/releases/latest"
+	if withPrereleases {
+		url = repoAPI + "/releases?per_page=10"
+	}
+	if etagURL != url {
+		etag = ""
+	}
+
+	req, err := newGitHubRequest(url, etag)
+	if err != nil {
+		return fetchResult{err: err}
+	}
+	resp, err := versionHTTPClient.Do(req)
+	if err != nil {
+		return fetchResult{err: err}
 	}
 	defer resp.Body.Close()
 
+	if reset, limited := rateLimitReset(resp); limited {
+		return fetchResult{rateLimitedUntil: reset}
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return fetchResult{notModified: true}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fetchLatestTag(repo, withPrereleases)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "unknown"
+		return fetchResult{err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fetchResult{err: err}
+	}
+
+	var release *githubRelease
+	if withPrereleases {
+		release, err = parseReleaseList(body)
+	} else {
+		release, err = parseRelease(body)
+	}
+	if err != nil || release == nil {
+		return fetchLatestTag(repo, withPrereleases)
+	}
+
+	return fetchResult{
+		release: releaseFromGitHub(repo, release),
+		etag:    resp.Header.Get("ETag"),
+		url:     url,
+	}
+}
+
+// parseRelease decodes a single release object
+func parseRelease(data []byte) (*githubRelease, error) {
+	var release githubRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, err
+	}
+	if release.TagName == "" {
+		return nil, nil
+	}
+	return &release, nil
+}
+
+// parseReleaseList decodes a release list and returns the newest published release
+func parseReleaseList(data []byte) (*githubRelease, error) {
+	var releases []githubRelease
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if !releases[i].Draft && releases[i].TagName != "" {
+			return &releases[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func releaseFromGitHub(repo string, r *githubRelease) releaseInfo {
+	url := r.HTMLURL
+	if url == "" {
+		url = githubReleaseURL(repo, r.TagName)
+	}
+	return releaseInfo{
+		Version:    r.TagName,
+		URL:        url,
+		Notes:      r.Body,
+		Prerelease: r.Prerelease,
+	}
+}
+
+// fetchLatestTag is the fallback for repositories without published releases
+func fetchLatestTag(repo string, withPrereleases bool) fetchResult {
+	req, err := newGitHubRequest(githubRepoAPI(repo)+"/tags?per_page=100", "")
+	if err != nil {
+		return fetchResult{err: err}
+	}
+	resp, err := versionHTTPClient.Do(req)
+	if err != nil {
+		return fetchResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	if reset, limited := rateLimitReset(resp); limited {
+		return fetchResult{rateLimitedUntil: reset}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fetchResult{err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
 	}
 
 	var tags []githubTag
 	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
-		return "unknown"
+		return fetchResult{err: err}
 	}
 
-	if len(tags) == 0 {
-		return "unknown"
+	tag := latestTag(tags, withPrereleases)
+	if tag == "" {
+		return fetchResult{release: unknownRelease}
 	}
 
-	return tags[0].Name
+	return fetchResult{
+		release: releaseInfo{
+			Version:    tag,
+			URL:        githubReleaseURL(repo, tag),
+			Prerelease: len(parseVersion(tag).prerelease) > 0,
+		},
+	}
+}
+
+// latestTag returns the highest version among the tags, prereleases only count if wanted
+// The tags endpoint sorts names as strings, so the first tag is not necessarily the newest,
+// and tags that are not versions, such as "nightly", are skipped
+func latestTag(tags []githubTag, withPrereleases bool) string {
+	latest := ""
+	for _, tag := range tags {
+		if !isVersionTag(tag.Name) {
+			continue
+		}
+		if !withPrereleases && len(parseVersion(tag.Name).prerelease) > 0 {
+			continue
+		}
+		if latest == "" || compareVersions(tag.Name, latest) > 0 {
+			latest = tag.Name
+		}
+	}
+	return latest
+}
+
+// isVersionTag returns true if a tag name is a version number, with or without a "v" prefix
+func isVersionTag(name string) bool {
+	name = strings.TrimPrefix(name, "v")
+	return name != "" && name[0] >= '0' && name[0] <= '9'
 }
 
 // isNewerVersion compares semver strings, returns true if latest > current
@@ -103,35 +423,95 @@ func isNewerVersion(latest, current string) bool {
 	if latest == "unknown" || latest == "" || current == "dev" {
 		return false
 	}
+	return compareVersions(latest, current) > 0
+}
+
+// semver is a parsed semantic version, build metadata is dropped
+type semver struct {
+	core       [3]int
+	prerelease []string
+}
+
+// parseVersion parses a semantic version, tolerating a "v" prefix and missing components
+// A git describe suffix is dropped so development builds compare as their base release
+func parseVersion(v string) semver {
+	v = stripDescribeSuffix(strings.TrimPrefix(strings.TrimSpace(v), "v"))
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+
+	var result semver
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		result.prerelease = strings.Split(v[i+1:], ".")
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, ".")
+	for i := 0; i < 3 && i < len(parts); i++ {
+		n, _ := strconv.Atoi(parts[i])
+		result.core[i] = n
+	}
+	return result
+}
 
-	latestParts := parseVersion(latest)
-	currentParts := parseVersion(current)
+// compareVersions returns -1, 0 or 1 following semver precedence rules
+func compareVersions(a, b string) int {
+	va, vb := parseVersion(a), parseVersion(b)
 
 	for i := 0; i < 3; i++ {
-		if latestParts[i] > currentParts[i] {
-			return true
+		if va.core[i] != vb.core[i] {
+			if va.core[i] > vb.core[i] {
+				return 1
+			}
+			return -1
 		}
-		if latestParts[i] < currentParts[i] {
-			return false
+	}
+
+	// A version without prerelease has higher precedence than one with
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0
+	case len(va.prerelease) == 0:
+		return 1
+	case len(vb.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrereleaseIdentifier(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c
 		}
 	}
-	return false
+
+	// A larger set of prerelease fields has higher precedence
+	switch {
+	case len(va.prerelease) > len(vb.prerelease):
+		return 1
+	case len(va.prerelease) < len(vb.prerelease):
+		return -1
+	}
+	return 0
 }
 
-func parseVersion(v string) [3]int {
-	v = strings.TrimPrefix(v, "v")
-	parts := strings.Split(v, ".")
-	var result [3]int
-	for i := 0; i < 3 && i < len(parts); i++ {
-		var n int
-		for _, c := range parts[i] {
-			if c >= '0' && c <= '9' {
-				n = n*10 + int(c-'0')
-			} else {
-				break
-			}
+// comparePrereleaseIdentifier compares numeric identifiers numerically and others lexically
+// Numeric identifiers always have lower precedence than alphanumeric ones
+func comparePrereleaseIdentifier(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+
+	switch {
+	case errA == nil && errB == nil:
+		if na > nb {
+			return 1
 		}
-		result[i] = n
+		if na < nb {
+			return -1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
 	}
-	return result
+	return strings.Compare(a, b)
 }
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeResponse is a canned reply of fakeDoer
+type fakeResponse struct {
+	status  int
+	fixture string // File in testdata holding the body
+	header  http.Header
+}
+
+// fakeDoer answers requests by URL from canned responses and records the URLs it was asked for
+// With err set every request fails with it, as when the server cannot be reached
+type fakeDoer struct {
+	t         *testing.T
+	responses map[string]fakeResponse
+	requested []string
+	headers   []http.Header // Headers of each request, in the order of requested
+	err       error
+}
+
+func (d *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	d.requested = append(d.requested, url)
+	d.headers = append(d.headers, req.Header.Clone())
+	if d.err != nil {
+		return nil, d.err
+	}
+	r, ok := d.responses[url]
+	if !ok {
+		r = fakeResponse{status: http.StatusNotFound}
+	}
+	body := ""
+	if r.fixture != "" {
+		data, err := os.ReadFile(filepath.Join("testdata", r.fixture))
+		if err != nil {
+			d.t.Fatalf("read fixture: %v", err)
+		}
+		body = string(data)
+	}
+	header := r.header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: r.status, Header: header, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+// useFakeGitHub replaces the update check client for the test
+func useFakeGitHub(t *testing.T, responses map[string]fakeResponse) *fakeDoer {
+	t.Helper()
+	doer := &fakeDoer{t: t, responses: responses}
+	previous := versionHTTPClient
+	versionHTTPClient = doer
+	t.Cleanup(func() { versionHTTPClient = previous })
+	return doer
+}
+
+const testRepoAPI = "https://api.github.com/repos/PanSalut/Koffan"
+
+func TestFetchLatestRelease(t *testing.T) {
+	useFakeGitHub(t, map[string]fakeResponse{
+		testRepoAPI + "/releases/latest": {status: http.StatusOK, fixture: "github_release_latest.json", header: http.Header{"Etag": {`W/"abc"`}}},
+	})
+
+	result := fetchLatestRelease("PanSalut/Koffan", false, "", "")
+	if result.err != nil {
+		t.Fatalf("fetch: %v", result.err)
+	}
+	r := result.release
+	if r.Version != "v2.4.0" || r.Prerelease {
+		t.Errorf("release = %+v, want stable v2.4.0", r)
+	}
+	if r.URL != "https://github.com/PanSalut/Koffan/releases/tag/v2.4.0" {
+		t.Errorf("URL = %q, want the html_url of the release", r.URL)
+	}
+	if !strings.HasPrefix(r.Notes, "## What's new") || !strings.Contains(r.Notes, "Trash for deleted items") {
+		t.Errorf("notes = %q, want the release body", r.Notes)
+	}
+	if result.etag != `W/"abc"` || result.url != testRepoAPI+"/releases/latest" {
+		t.Errorf("etag %q for %q, want the ETag of the releases/latest response", result.etag, result.url)
+	}
+}
+
+func TestFetchLatestReleaseWithPrereleases(t *testing.T) {
+	useFakeGitHub(t, map[string]fakeResponse{
+		testRepoAPI + "/releases?per_page=10": {status: http.StatusOK, fixture: "github_releases.json"},
+	})
+
+	// The draft is skipped, the release candidate is the newest published release
+	result := fetchLatestRelease("PanSalut/Koffan", true, "", "")
+	if result.err != nil {
+		t.Fatalf("fetch: %v", result.err)
+	}
+	if r := result.release; r.Version != "v2.5.0-rc.1" || !r.Prerelease || r.Notes != "Release candidate for 2.5.0" {
+		t.Errorf("release = %+v, want prerelease v2.5.0-rc.1", r)
+	}
+}
+
+func TestFetchLatestReleaseFallsBackToTags(t *testing.T) {
+	doer := useFakeGitHub(t, map[string]fakeResponse{
+		testRepoAPI + "/tags?per_page=100": {status: http.StatusOK, fixture: "github_tags.json"},
+	})
+
+	// releases/latest answers 404 for repositories without releases
+	result := fetchLatestRelease("PanSalut/Koffan", false, "", "")
+	if result.err != nil {
+		t.Fatalf("fetch: %v", result.err)
+	}
+	if len(doer.requested) != 2 || doer.requested[1] != testRepoAPI+"/tags?per_page=100" {
+		t.Fatalf("requested %v, want releases/latest then tags", doer.requested)
+	}
+	r := result.release
+	if r.Version != "v2.10.0" || r.Prerelease {
+		t.Errorf("release = %+v, want the highest stable tag v2.10.0", r)
+	}
+	if r.URL != "https://github.com/PanSalut/Koffan/releases/tag/v2.10.0" {
+		t.Errorf("URL = %q", r.URL)
+	}
+
+	result = fetchLatestRelease("PanSalut/Koffan", true, "", "")
+	if r := result.release; r.Version != "v2.11.0-beta" || !r.Prerelease {
+		t.Errorf("with prereleases: release = %+v, want v2.11.0-beta", r)
+	}
+}
+
+func TestFetchLatestReleaseEmptyReleaseList(t *testing.T) {
+	useFakeGitHub(t, map[string]fakeResponse{
+		testRepoAPI + "/releases?per_page=10": {status: http.StatusOK, fixture: ""},
+		testRepoAPI + "/tags?per_page=100":    {status: http.StatusOK, fixture: "github_tags.json"},
+	})
+
+	// An unparseable or empty release list also falls back to the tags
+	if r := fetchLatestRelease("PanSalut/Koffan", true, "", "").release; r.Version != "v2.11.0-beta" {
+		t.Errorf("release = %+v, want v2.11.0-beta from the tags", r)
+	}
+}
+
+func TestFetchLatestReleaseRateLimited(t *testing.T) {
+	useFakeGitHub(t, map[string]fakeResponse{
+		testRepoAPI + "/releases/latest": {status: http.StatusForbidden, header: http.Header{
+			"X-Ratelimit-Remaining": {"0"},
+			"X-Ratelimit-Reset":     {"1900000000"},
+		}},
+	})
+
+	result := fetchLatestRelease("PanSalut/Koffan", false, "", "")
+	if result.rateLimitedUntil.Unix() != 1900000000 {
+		t.Errorf("rateLimitedUntil = %v, want the X-RateLimit-Reset time", result.rateLimitedUntil)
+	}
+}
+
+func TestLatestTag(t *testing.T) {
+	tags := func(names ...string) []githubTag {
+		var result []githubTag
+		for _, n := range names {
+			result = append(result, githubTag{Name: n})
+		}
+		return result
+	}
+	tests := []struct {
+		name            string
+		tags            []githubTag
+		withPrereleases bool
+		want            string
+	}{
+		{"empty", nil, false, ""},
+		{"string order is not version order", tags("v1.9.0", "v1.10.0", "v1.2.0"), false, "v1.10.0"},
+		{"prerelease skipped", tags("v2.0.0-rc.1", "v1.9.0"), false, "v1.9.0"},
+		{"prerelease wanted", tags("v2.0.0-rc.1", "v1.9.0"), true, "v2.0.0-rc.1"},
+		{"final beats its prerelease", tags("v2.0.0-rc.1", "v2.0.0"), true, "v2.0.0"},
+		{"only prereleases", tags("v2.0.0-rc.1"), false, ""},
+		{"non-version tags ignored", tags("latest", "nightly", "v0.1.0"), false, "v0.1.0"},
+		{"without v prefix", tags("1.4.0", "v1.3.0"), false, "1.4.0"},
+	}
+	for _, tt := range tests {
+		if got := latestTag(tt.tags, tt.withPrereleases); got != tt.want {
+			t.Errorf("%s: latestTag = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersionsPrecedence(t *testing.T) {
+	// The precedence chain from semver.org section 11, each lower than the next
+	chain := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"2.0.0",
+		"2.1.0",
+		"2.1.1",
+	}
+	for i := range chain {
+		for j := range chain {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := compareVersions(chain[i], chain[j]); got != want {
+				t.Errorf("compareVersions(%q, %q) = %d, want %d", chain[i], chain[j], got, want)
+			}
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"1", "1.0.0", 0},
+		{" v1.2.3 ", "1.2.3", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.9.10", "1.9.9", 1},
+		{"v1.2.0", "v1.2.0-rc.1", 1},
+		{"1.3.0-rc.2+build.5", "1.3.0", -1},
+		{"1.3.0-rc.2+build.5", "1.3.0-rc.2+build.9", 0},
+		{"1.3.0+build.5", "1.3.0", 0},
+		{"1.3.0-rc.2", "1.2.9", 1},
+		{"1.0.0-2", "1.0.0-10", -1},
+		{"1.0.0-rc.1", "1.0.0-1", 1},
+		// git describe builds compare as their base release
+		{"1.5.0-12-gabcdef", "1.5.0", 0},
+		{"1.5.0-dirty", "1.5.0", 0},
+		{"1.5.0-rc.1-3-gabc123-dirty", "1.5.0-rc.1", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIsNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.2.0", "v1.2.0-rc.1", true},
+		{"v1.2.0", "1.3.0-rc.2+build.5", false},
+		{"v1.3.0", "1.3.0-rc.2+build.5", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.9.0", "v1.10.0", false},
+		{"v1.2.0", "v1.2.0", false},
+		// Development builds never report updates
+		{"v9.9.9", "dev", false},
+		{"unknown", "v1.0.0", false},
+		{"", "v1.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := isNewerVersion(tt.latest, tt.current); got != tt.want {
+			t.Errorf("isNewerVersion(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
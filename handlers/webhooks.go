@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"shopping-list/settings"
+	"time"
+)
+
+const (
+	settingWebhookURL    = "webhook_url"
+	settingWebhookSecret = "webhook_secret"
+
+	webhookTimeout = 10 * time.Second
+	// webhookQueueSize is how many updates wait for delivery before further ones are dropped
+	webhookQueueSize = 256
+)
+
+func init() {
+	settings.Register(
+		settings.Def{Key: settingWebhookURL, Type: settings.TypeString, Env: "WEBHOOK_URL", Validate: validateBackupURL},
+		settings.Def{Key: settingWebhookSecret, Type: settings.TypeString, Env: "WEBHOOK_SECRET", Secret: true},
+	)
+}
+
+var (
+	// webhookHTTPClient delivers webhooks
+	webhookHTTPClient httpDoer = NewOutboundClient(webhookTimeout)
+
+	// webhookQueue holds the encoded updates waiting for delivery
+	webhookQueue = make(chan []byte, webhookQueueSize)
+)
+
+// queueWebhook hands an encoded update to the webhook worker when a webhook URL is set
+// It never blocks a broadcast, a full queue drops the update
+func queueWebhook(payload []byte) {
+	if settings.String(settingWebhookURL) == "" {
+		return
+	}
+	select {
+	case webhookQueue <- payload:
+	default:
+		log.Printf("[WEBHOOK] Queue full, dropping an update")
+	}
+}
+
+// StartWebhooks posts the updates sent to WebSocket clients to the webhook URL until ctx is cancelled
+// Updates still queued then are delivered before it returns. main cancels ctx only after requests and
+// a running import finished, so their last updates are not lost
+func StartWebhooks(ctx context.Context) {
+	goBackground(func() { runWebhooks(ctx, webhookQueue) })
+}
+
+func runWebhooks(ctx context.Context, queue <-chan []byte) {
+	for {
+		select {
+		case payload := <-queue:
+			deliverWebhook(payload)
+		case <-ctx.Done():
+			drainWebhooks(queue)
+			return
+		}
+	}
+}
+
+// drainWebhooks delivers what is left in the queue
+func drainWebhooks(queue <-chan []byte) {
+	delivered := 0
+	for {
+		select {
+		case payload := <-queue:
+			deliverWebhook(payload)
+			delivered++
+		default:
+			log.Printf("[WEBHOOK] Webhooks stopped, delivered %d queued update(s)", delivered)
+			return
+		}
+	}
+}
+
+// deliverWebhook posts one update, signed with HMAC-SHA256 in X-Koffan-Signature when a secret is set
+// Failures are logged, updates are not retried
+func deliverWebhook(payload []byte) {
+	url := settings.String(settingWebhookURL)
+	if url == "" {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("[WEBHOOK] Invalid webhook URL: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := settings.String(settingWebhookSecret); secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		req.Header.Set("X-Koffan-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		log.Printf("[WEBHOOK] Delivery failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Printf("[WEBHOOK] Delivery failed: HTTP %d", resp.StatusCode)
+	}
+}
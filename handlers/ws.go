@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 )
 
@@ -12,18 +14,30 @@ import (
 var (
 	clients   = make(map[*websocket.Conn]bool)
 	clientsMu sync.RWMutex
+
+	// clientsClosed is set by CloseWebSockets, later connections are closed right away
+	clientsClosed bool
+
+	// broadcastRequestIDs adds the ID of the causing request to broadcasts, see InitLogging
+	broadcastRequestIDs bool
 )
 
 // WebSocketMessage represents a message sent to clients
 type WebSocketMessage struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	RequestID string      `json:"request_id,omitempty"`
 }
 
 // WebSocketHandler handles WebSocket connections
 func WebSocketHandler(c *websocket.Conn) {
 	// Register client
 	clientsMu.Lock()
+	if clientsClosed {
+		clientsMu.Unlock()
+		closeWebSocket(c, "server_shutdown")
+		return
+	}
 	clients[c] = true
 	clientsMu.Unlock()
 
@@ -62,16 +76,27 @@ func WebSocketHandler(c *websocket.Conn) {
 
 // BroadcastUpdate sends an update to all connected WebSocket clients
 func BroadcastUpdate(eventType string, data interface{}) {
-	message := WebSocketMessage{
-		Type: eventType,
-		Data: data,
+	broadcast(WebSocketMessage{Type: eventType, Data: data})
+}
+
+// BroadcastFrom sends an update caused by a request, tagged with its request ID when BROADCAST_REQUEST_IDS is true
+func BroadcastFrom(c *fiber.Ctx, eventType string, data interface{}) {
+	message := WebSocketMessage{Type: eventType, Data: data}
+	if broadcastRequestIDs {
+		message.RequestID = RequestID(c)
 	}
+	broadcast(message)
+}
+
+func broadcast(message WebSocketMessage) {
+	eventType := message.Type
 
 	messageBytes, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Failed to marshal WebSocket message: %v", err)
 		return
 	}
+	queueWebhook(messageBytes)
 
 	clientsMu.RLock()
 	clientCount := len(clients)
@@ -92,6 +117,27 @@ func BroadcastUpdate(eventType string, data interface{}) {
 	log.Printf("Broadcast %s completed: %d/%d clients received", eventType, successCount, clientCount)
 }
 
+// CloseWebSockets sends every client a going-away close frame with reason and closes the connection
+// Called on shutdown after the last broadcast, clients reconnect with their usual backoff
+func CloseWebSockets(reason string) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clientsClosed = true
+	for client := range clients {
+		closeWebSocket(client, reason)
+	}
+	log.Printf("Closed %d WebSocket clients: %s", len(clients), reason)
+}
+
+func closeWebSocket(c *websocket.Conn, reason string) {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	if err := c.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		log.Printf("Failed to send WebSocket close frame: %v", err)
+	}
+	c.Close()
+}
+
 // WebSocketUpgrade middleware to upgrade HTTP to WebSocket
 func WebSocketUpgrade(c *websocket.Conn) error {
 	return nil
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// zipMagic starts every ZIP archive, and so every XLSX file
+var zipMagic = []byte("PK\x03\x04")
+
+const (
+	// xlsxMaxPartSize bounds each uncompressed part read from an XLSX file, against ZIP bombs
+	xlsxMaxPartSize = 64 * 1024 * 1024
+	// xlsxMaxRows and xlsxMaxColumns are the size limits of a worksheet
+	xlsxMaxRows    = 1048576
+	xlsxMaxColumns = 16384
+)
+
+func previewXLSXImport(c *fiber.Ctx, data []byte, opts ImportOptions) error {
+	records, err := readXLSXRows(data)
+	if err != nil {
+		return previewError(c, ErrCodeInvalidFile, "Invalid XLSX file: "+err.Error())
+	}
+
+	if len(records) < 2 {
+		return previewError(c, ErrCodeInvalidFile, "Spreadsheet is empty or has no data rows")
+	}
+
+	var appErr *AppError
+	if records, appErr = opts.ColumnMapping.mapRecords(records, opts.Filename); appErr != nil {
+		return previewError(c, appErr.Code, appErr.Message)
+	}
+
+	if len(records[0]) < 7 {
+		return previewError(c, ErrCodeInvalidFile, "Invalid spreadsheet header. Expected: "+importColumns)
+	}
+
+	return previewRows(c, "xlsx", "", records, opts)
+}
+
+func importXLSXImport(data []byte, opts ImportOptions) (*ImportResult, error) {
+	records, err := readXLSXRows(data)
+	if err != nil {
+		return nil, NewError(ErrCodeInvalidFile, "Invalid XLSX file")
+	}
+
+	if len(records) < 2 {
+		return nil, NewError(ErrCodeInvalidFile, "Spreadsheet is empty")
+	}
+
+	rows := records
+	return importRows(func() ([]string, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}, "XLSX", opts)
+}
+
+// readXLSXRows returns the cells of the first worksheet as text, like csv.Reader.ReadAll
+// Missing rows and cells read as empty, so row i is row i+1 in Excel and every row is as wide as the widest.
+// Formula and error cells read as empty, booleans as "true" and "false"
+func readXLSXRows(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("not a ZIP archive")
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := xlsxFirstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	sharedStrings, err := xlsxSharedStrings(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R      string    `xml:"r,attr"`
+				T      string    `xml:"t,attr"`
+				F      *struct{} `xml:"f"`
+				V      string    `xml:"v"`
+				Inline xlsxText  `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xlsxDecode(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	width := 0
+	for _, row := range sheet.Rows {
+		// Rows without r follow the previous one
+		number := row.R
+		if number <= len(records) || number > xlsxMaxRows {
+			number = len(records) + 1
+		}
+		for len(records) < number-1 {
+			records = append(records, nil)
+		}
+
+		var record []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.R != "" {
+				col = xlsxColumn(cell.R)
+				if col < len(record) {
+					col = len(record)
+				}
+			}
+			for len(record) < col {
+				record = append(record, "")
+			}
+
+			value := ""
+			switch {
+			case cell.F != nil:
+				// Formula results are whatever the editor last computed, they are not imported
+			case cell.T == "s":
+				if n, err := strconv.Atoi(strings.TrimSpace(cell.V)); err == nil && n >= 0 && n < len(sharedStrings) {
+					value = sharedStrings[n]
+				}
+			case cell.T == "inlineStr":
+				value = cell.Inline.String()
+			case cell.T == "b":
+				value = strconv.FormatBool(strings.TrimSpace(cell.V) == "1")
+			case cell.T == "e":
+			default:
+				value = cell.V
+			}
+			record = append(record, value)
+		}
+		records = append(records, record)
+		if len(record) > width {
+			width = len(record)
+		}
+	}
+
+	// Pad rows so short and missing rows skip like empty CSV rows, empty rows share one slice
+	blank := make([]string, width)
+	for i, record := range records {
+		if len(record) == 0 {
+			records[i] = blank
+			continue
+		}
+		for len(records[i]) < width {
+			records[i] = append(records[i], "")
+		}
+	}
+	return records, nil
+}
+
+// xlsxText is a shared or inline string, either plain or split into formatted runs
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, run := range t.Runs {
+		sb.WriteString(run.T)
+	}
+	return sb.String()
+}
+
+// xlsxFirstSheet returns the path of the first worksheet in workbook order
+func xlsxFirstSheet(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xlsxDecode(files, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("workbook has no worksheets")
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if _, ok := files["xl/_rels/workbook.xml.rels"]; !ok {
+		return fallback, nil
+	}
+	if err := xlsxDecode(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+// xlsxSharedStrings returns the shared string table, files without strings have none
+func xlsxSharedStrings(files map[string]*zip.File) ([]string, error) {
+	if _, ok := files["xl/sharedStrings.xml"]; !ok {
+		return nil, nil
+	}
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if err := xlsxDecode(files, "xl/sharedStrings.xml", &sst); err != nil {
+		return nil, err
+	}
+	strs := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		strs[i] = item.String()
+	}
+	return strs, nil
+}
+
+// xlsxDecode unmarshals a part of the archive
+func xlsxDecode(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, xlsxMaxPartSize+1))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if len(data) > xlsxMaxPartSize {
+		return fmt.Errorf("%s is too large", name)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// xlsxColumn returns the zero-based column of a cell reference like "C12"
+func xlsxColumn(ref string) int {
+	col := 0
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		if col > xlsxMaxColumns {
+			return xlsxMaxColumns - 1
+		}
+	}
+	if col == 0 {
+		return 0
+	}
+	return col - 1
+}
+
+// xlsxContentType is the media type of XLSX files
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// xlsxSheet is a worksheet to write, cells are strings, bools or ints
+type xlsxSheet struct {
+	Name string
+	Rows [][]any
+}
+
+// xlsxSheetName makes name a valid worksheet name that differs from used, ignoring case, and records it
+// Excel limits names to 31 UTF-16 units without []:*?/\ and leading or trailing apostrophes
+func xlsxSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+
+	candidate := xlsxTruncate(name, 31)
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		candidate = xlsxTruncate(name, 31-len(suffix)) + suffix
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// xlsxTruncate cuts s to at most max UTF-16 units without splitting a character
+func xlsxTruncate(s string, max int) string {
+	units := 0
+	for i, r := range s {
+		n := 1
+		if r >= 0x10000 {
+			n = 2 // Surrogate pair
+		}
+		if units+n > max {
+			return s[:i]
+		}
+		units += n
+	}
+	return s
+}
+
+// xlsxColumnName returns the letters of a zero-based column, 0 is A
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// writeXLSX writes a workbook with sheets in order, there must be at least one
+// Strings are written inline, so no shared string table is needed
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	zw := zip.NewWriter(w)
+
+	var types, rels, entries strings.Builder
+	for i := range sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&entries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sheets[i].Name), i+1, i+1)
+	}
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + entries.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, xml.Header+part.body); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		f, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeXLSXSheet(f, sheet.Rows); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeXLSXSheet(w io.Writer, rows [][]any) error {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&sb, `<row r="%d">`, r+1)
+		for col, value := range row {
+			ref := xlsxColumnName(col) + strconv.Itoa(r+1)
+			switch v := value.(type) {
+			case bool:
+				b := 0
+				if v {
+					b = 1
+				}
+				fmt.Fprintf(&sb, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+			case int:
+				fmt.Fprintf(&sb, `<c r="%s"><v>%d</v></c>`, ref, v)
+			case float64:
+				fmt.Fprintf(&sb, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+			case string:
+				if v == "" {
+					continue
+				}
+				fmt.Fprintf(&sb, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xlsxEscape(v))
+			}
+		}
+		sb.WriteString(`</row>`)
+
+		// Flush now and then so large exports are not built in memory twice
+		if sb.Len() > 64*1024 {
+			if _, err := io.WriteString(w, sb.String()); err != nil {
+				return err
+			}
+			sb.Reset()
+		}
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// xlsxEscape escapes text for XML, characters XML cannot hold become U+FFFD
+func xlsxEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
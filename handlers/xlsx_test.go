@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// zipParts returns an archive of the named parts, to build workbooks the way other apps write them
+func zipParts(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const xlsxMain = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"`
+
+func TestReadXLSXExcelWorkbook(t *testing.T) {
+	// The first sheet in workbook order lives in data.xml, sheet1.xml is the second one
+	data := zipParts(t, map[string]string{
+		"xl/workbook.xml": `<workbook ` + xlsxMain + ` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+			`<sheet name="Family" sheetId="2" r:id="rId7"/><sheet name="Other" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId7" Target="/xl/worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst ` + xlsxMain + `><si><t>list_name</t></si><si><t>item_name</t></si>` +
+			`<si><r><t>Groc</t></r><r><rPr><b/></rPr><t>eries</t></r></si><si><t xml:space="preserve"> Milk &amp; more </t></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet ` + xlsxMain + `><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+			// Row 2 is missing, row 3 skips column B and has a formula, a bool and an error cell
+			`<row r="3"><c r="A3" t="s"><v>2</v></c><c r="C3"><f>1+1</f><v>2</v></c><c r="D3" t="b"><v>1</v></c><c r="E3" t="e"><v>#N/A</v></c></row>` +
+			// Rows and cells without references follow the previous ones
+			`<row><c t="s"><v>2</v></c><c t="s"><v>3</v></c><c><v>4.5</v></c></row>` +
+			`<row r="6"><c r="B6" t="inlineStr"><is><t>Ü 🍎</t></is></c><c r="C6" t="s"><v>99</v></c></row>` +
+			`</sheetData></worksheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet ` + xlsxMain + `><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>wrong sheet</t></is></c></row></sheetData></worksheet>`,
+	})
+
+	got, err := readXLSXRows(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"list_name", "item_name", "", "", ""},
+		{"", "", "", "", ""},
+		{"Groceries", "", "", "true", ""},
+		{"Groceries", " Milk & more ", "4.5", "", ""},
+		{"", "", "", "", ""},
+		{"", "Ü 🍎", "", "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestReadXLSXRejectsBrokenFiles(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"not a zip":   []byte("list_name,item_name\n"),
+		"no workbook": zipParts(t, map[string]string{"xl/worksheets/sheet1.xml": "<worksheet/>"}),
+		"no sheets":   zipParts(t, map[string]string{"xl/workbook.xml": `<workbook ` + xlsxMain + `><sheets/></workbook>`}),
+		"bad xml": zipParts(t, map[string]string{
+			"xl/workbook.xml":          `<workbook ` + xlsxMain + `><sheets><sheet name="A" sheetId="1"/></sheets></workbook>`,
+			"xl/worksheets/sheet1.xml": "<worksheet><sheetData><row>",
+		}),
+	} {
+		if _, err := readXLSXRows(data); err == nil {
+			t.Errorf("%s: read without an error", name)
+		}
+	}
+}
+
+// xlsxImportRow is the import columns of one spreadsheet row
+func xlsxImportRow(list, section, item, description string, completed any, quantity any) []any {
+	return []any{list, "🛒", section, item, description, completed, false, quantity}
+}
+
+// familyWorkbook returns a workbook in the import columns, with an empty row and a second sheet that is not read
+func familyWorkbook(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := writeXLSX(&buf, []xlsxSheet{
+		{Name: "Family", Rows: [][]any{
+			{"list_name", "list_icon", "section_name", "item_name", "item_description", "item_completed", "item_uncertain", "item_quantity"},
+			xlsxImportRow("Family", "Dairy", "Milk", "2L <fresh> & cold", true, 2),
+			{},
+			xlsxImportRow("Family", "Dairy", "Käse 🧀", "line one\nline two", "TRUE", "3"),
+			xlsxImportRow("Family", "Bakery", "Bread", "", false, 1),
+		}},
+		{Name: "Ignored", Rows: [][]any{{"list_name"}, {"Not imported"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPreviewXLSX(t *testing.T) {
+	setupTestDB(t)
+	if _, err := db.CreateList("family", ""); err != nil {
+		t.Fatal(err)
+	}
+	data := familyWorkbook(t)
+
+	app := fiber.New()
+	app.Post("/preview", func(c *fiber.Ctx) error {
+		return previewData(c, data, ImportOptions{Filename: "family.xlsx"})
+	})
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/preview", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var preview ImportPreviewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		t.Fatal(err)
+	}
+	if !preview.Valid || preview.Format != "xlsx" || preview.ListsCount != 1 || preview.ItemsCount != 3 {
+		t.Errorf("preview = %+v", preview)
+	}
+	if len(preview.Lists) != 1 || preview.Lists[0].Sections != 2 || !preview.Lists[0].HasConflict ||
+		!reflect.DeepEqual(preview.ConflictingLists, []string{"Family"}) {
+		t.Errorf("lists = %+v, conflicting %v", preview.Lists, preview.ConflictingLists)
+	}
+}
+
+func TestImportXLSX(t *testing.T) {
+	setupTestDB(t)
+	data := familyWorkbook(t)
+
+	// Uploads are recognized by their content as well as their name
+	if got := detectFormat("family", data); got != "xlsx" {
+		t.Fatalf("detected as %q", got)
+	}
+	result, err := Import(bytes.NewReader(data), ImportOptions{Filename: "family.xlsx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ImportedLists != 1 || result.ImportedItems != 3 || len(result.Warnings) != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+
+	lists, err := db.GetAllLists()
+	if err != nil || len(lists) != 1 || lists[0].Name != "Family" {
+		t.Fatalf("lists = %+v, %v", lists, err)
+	}
+	sections, err := db.GetSectionsByList(lists[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type row struct {
+		Section, Name, Description string
+		Completed                  bool
+		Quantity                   int
+	}
+	var got []row
+	for _, s := range sections {
+		for _, i := range s.Items {
+			got = append(got, row{s.Name, i.Name, i.Description, i.Completed, i.Quantity})
+		}
+	}
+	want := []row{
+		{"Dairy", "Milk", "2L <fresh> & cold", true, 2},
+		{"Dairy", "Käse 🧀", "line one\nline two", true, 3},
+		{"Bakery", "Bread", "", false, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("items\ngot  %+v\nwant %+v", got, want)
+	}
+
+	// Importing the same workbook again follows the conflict resolution like CSV
+	result, err = Import(bytes.NewReader(data), ImportOptions{Filename: "family.xlsx", ConflictResolution: "copy", CopySuffix: "Excel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ImportedLists != 1 || result.ImportedItems != 3 || !listExists(t, "Family (Excel)") {
+		t.Errorf("copy import = %+v", result)
+	}
+	if lists, _ := db.GetAllLists(); len(lists) != 2 {
+		t.Errorf("%d lists after the copy import, want 2", len(lists))
+	}
+}
+
+func TestXLSXWriteReadRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeXLSX(&buf, []xlsxSheet{
+		{Name: "First", Rows: [][]any{
+			{"<tag> & \"quotes\" 'apos'", "  spaced  ", "line\nbreak\r\nand\ttab", "Äpfel 🍎 👩‍👩‍👧", "]]>"},
+			{true, false, 0, -42, 3.49},
+			{"", nil, "after gaps"},
+			{},
+			{"nul\x00and\x1fcontrol"},
+		}},
+		{Name: "Second", Rows: [][]any{{"not read"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readXLSXRows(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"<tag> & \"quotes\" 'apos'", "  spaced  ", "line\nbreak\r\nand\ttab", "Äpfel 🍎 👩‍👩‍👧", "]]>"},
+		{"true", "false", "0", "-42", "3.49"},
+		{"", "", "after gaps", "", ""},
+		{"", "", "", "", ""},
+		// XML cannot hold these characters at all
+		{"nul\ufffdand\ufffdcontrol", "", "", "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	used := map[string]bool{"item history": true}
+	for _, tt := range []struct{ name, want string }{
+		{"Groceries", "Groceries"},
+		{"groceries", "groceries (2)"},
+		{"GROCERIES", "GROCERIES (3)"},
+		{"Item History", "Item History (2)"},
+		{"a/b\\c?d*e[f]g:h", "a_b_c_d_e_f_g_h"},
+		{"  'quoted'  ", "quoted"},
+		{"''", "Sheet"},
+		{"A very long list name that Excel will not accept", "A very long list name that Exce"},
+		{"A very long list name that Excel would refuse too", "A very long list name that  (2)"},
+		// Emoji take two of the 31 UTF-16 units and are never split
+		{"🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎", "🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎🍎"},
+	} {
+		if got := xlsxSheetName(tt.name, used); got != tt.want {
+			t.Errorf("xlsxSheetName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// xlsxSheetNames returns the sheet names of a workbook in order
+func xlsxSheetNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xlsxDecode(files, "xl/workbook.xml", &workbook); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range workbook.Sheets {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestExportXLSX(t *testing.T) {
+	setupTestDB(t)
+	seedExportData(t)
+	want := fullExport(t)
+
+	var buf bytes.Buffer
+	if err := Export(&buf, ExportOptions{Format: "xlsx", IncludeHistory: true}); err != nil {
+		t.Fatal(err)
+	}
+	if names := xlsxSheetNames(t, buf.Bytes()); !reflect.DeepEqual(names, []string{"Groceries", "Hardware_ store", "Item history"}) {
+		t.Errorf("sheets = %q", names)
+	}
+
+	// The first sheet holds the first list, one row per item in export order
+	rows, err := readXLSXRows(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{{"section_name", "item_name", "item_description", "item_completed", "item_uncertain", "item_quantity", "item_price", "item_currency", "item_due_date"}}
+	for _, section := range want.Data.Lists[0].Sections {
+		for _, item := range section.Items {
+			expected = append(expected, []string{section.Name, item.Name, item.Description, strconv.FormatBool(item.Completed),
+				strconv.FormatBool(item.Uncertain), strconv.Itoa(item.Quantity), string(item.Price), item.Currency, item.DueDate})
+		}
+	}
+	if len(expected) != 5 {
+		t.Fatalf("seeded Groceries has %d items", len(expected)-1)
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("rows\ngot  %q\nwant %q", rows, expected)
+	}
+}
+
+func TestExportSingleListXLSX(t *testing.T) {
+	setupTestDB(t)
+	seedExportData(t)
+	lists, _ := db.GetAllLists()
+	hardware := lists[1]
+
+	app := fiber.New()
+	app.Get("/export/list/:id", ExportSingleList)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/export/list/"+strconv.FormatInt(hardware.ID, 10)+"?format=xlsx", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(fiber.HeaderContentType) != xlsxContentType {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+	}
+	if cd := resp.Header.Get(fiber.HeaderContentDisposition); !strings.Contains(cd, "koffan-"+sanitizeFilename(hardware.Name)+"-") || !strings.HasSuffix(cd, `.xlsx"`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if names := xlsxSheetNames(t, data); !reflect.DeepEqual(names, []string{"Hardware_ store"}) {
+		t.Errorf("sheets = %q", names)
+	}
+	rows, err := readXLSXRows(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][1] != "null" || rows[2][1] != "123" || rows[2][2] != "key: value" || rows[2][5] != "4" {
+		t.Errorf("rows = %q", rows)
+	}
+}
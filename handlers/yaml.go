@@ -0,0 +1,741 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlContentType is the media type of YAML exports
+const yamlContentType = "application/yaml; charset=utf-8"
+
+// The YAML support covers what exports need: block mappings and sequences, plain and quoted scalars,
+// empty and single-line flow collections, literal and folded block scalars and comments.
+// Anchors, tags and multi-line flow or quoted scalars are rejected with the line they start on
+
+// encodeYAML writes v, a struct, as a YAML document with keys named and ordered like its JSON encoding
+func encodeYAML(w io.Writer, v any) error {
+	bw := bufio.NewWriter(w)
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("yaml: cannot encode %s", rv.Type())
+	}
+	yamlWriteFields(bw, rv, 0, false)
+	return bw.Flush()
+}
+
+// yamlField is a struct field with its JSON name
+type yamlField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// yamlFields returns the fields of a struct type that encoding/json would use
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, yamlField{name: name, index: i, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+	}
+	return fields
+}
+
+// yamlWriteFields writes the fields of a struct at indent, the first line's indent is already written when inline
+func yamlWriteFields(w *bufio.Writer, v reflect.Value, indent int, inline bool) {
+	written := false
+	for _, f := range yamlFields(v.Type()) {
+		fv := v.Field(f.index)
+		if f.omitEmpty && fv.IsZero() || f.omitEmpty && fv.Kind() == reflect.Slice && fv.Len() == 0 {
+			continue
+		}
+		if !inline || written {
+			w.WriteString(strings.Repeat(" ", indent))
+		}
+		written = true
+		w.WriteString(yamlScalar(f.name) + ":")
+		yamlWriteValue(w, fv, indent)
+	}
+	if !written {
+		w.WriteString("{}\n")
+	}
+}
+
+// yamlWriteValue writes the value of a key at indent, after the colon
+func yamlWriteValue(w *bufio.Writer, v reflect.Value, indent int) {
+	switch v.Kind() {
+	case reflect.Struct:
+		w.WriteString("\n")
+		yamlWriteFields(w, v, indent+2, false)
+	case reflect.Slice:
+		if v.Len() == 0 {
+			w.WriteString(" []\n")
+			return
+		}
+		w.WriteString("\n")
+		for i := 0; i < v.Len(); i++ {
+			w.WriteString(strings.Repeat(" ", indent+2) + "-")
+			elem := reflect.Indirect(v.Index(i))
+			if elem.Kind() == reflect.Struct {
+				w.WriteString(" ")
+				yamlWriteFields(w, elem, indent+4, true)
+				continue
+			}
+			yamlWriteValue(w, elem, indent+2)
+		}
+	default:
+		w.WriteString(" " + yamlFormatScalar(v) + "\n")
+	}
+}
+
+func yamlFormatScalar(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return yamlScalar(v.String())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return "null"
+		}
+		return yamlFormatScalar(v.Elem())
+	}
+	return yamlScalar(fmt.Sprint(v.Interface()))
+}
+
+// yamlScalar returns s plain when it reads back as the same string, double-quoted otherwise
+func yamlScalar(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "null", "~", "yes", "no", "on", "off", "y", "n", ".inf", "-.inf", ".nan":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f || r == utf8.RuneError || r == '\u0085' || r == '\u00a0' || r == '\u2028' || r == '\u2029' || r == '\ufeff' {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// yamlNode is a parsed YAML value
+type yamlNode struct {
+	kind   byte // 's' scalar, 'm' mapping, 'l' sequence
+	value  string
+	isNull bool // An empty value, null or ~
+	keys   []string
+	nodes  []*yamlNode // Values of keys, or items
+	line   int
+}
+
+// yamlParser parses block YAML line by line
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// decodeYAML parses a YAML document into v, a pointer to a struct, matching keys by JSON name
+// Unknown keys are ignored like encoding/json does
+func decodeYAML(data []byte, v any) error {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")}
+
+	// Directives and the document start marker
+	for p.pos < len(p.lines) {
+		line := strings.TrimSpace(yamlStripComment(p.lines[p.pos]))
+		if line != "" && line != "---" && !strings.HasPrefix(line, "%") {
+			break
+		}
+		p.pos++
+		if line == "---" {
+			break
+		}
+	}
+
+	node := &yamlNode{kind: 's', isNull: true}
+	if indent, _, ok, err := p.peek(); err != nil {
+		return err
+	} else if ok {
+		node, err = p.parseBlock(indent)
+		if err != nil {
+			return err
+		}
+	}
+	if _, _, ok, err := p.peek(); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("yaml: line %d: unexpected content", p.pos+1)
+	}
+
+	// peek stopped at the end of the document, only comments may follow
+	for p.pos++; p.pos < len(p.lines); p.pos++ {
+		if line := strings.TrimSpace(yamlStripComment(p.lines[p.pos])); line != "" && line != "..." {
+			return fmt.Errorf("yaml: line %d: only one document is supported", p.pos+1)
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("yaml: cannot decode into %T", v)
+	}
+	return yamlDecodeValue(node, rv.Elem())
+}
+
+// peek returns the next line that is not blank or a comment, without its indent and comment
+// ok is false at the end of the document
+func (p *yamlParser) peek() (int, string, bool, error) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos]
+		content := strings.TrimLeft(raw, " ")
+		indent := len(raw) - len(content)
+		content = strings.TrimSpace(yamlStripComment(content))
+		if content == "" {
+			continue
+		}
+		if indent == 0 && (content == "---" || content == "...") {
+			// The document ends
+			return 0, "", false, nil
+		}
+		if strings.HasPrefix(raw[indent:], "\t") {
+			return 0, "", false, fmt.Errorf("yaml: line %d: tabs cannot indent", p.pos+1)
+		}
+		return indent, content, true, nil
+	}
+	return 0, "", false, nil
+}
+
+// yamlStripComment removes a # comment outside quotes, which must follow whitespace
+func yamlStripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" [{,:-", rune(s[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func yamlIsSeqItem(line string) bool {
+	return line == "-" || strings.HasPrefix(line, "- ")
+}
+
+// parseBlock parses the node whose first line is the next one, at indent
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	_, line, _, _ := p.peek()
+	if yamlIsSeqItem(line) {
+		return p.parseSeq(indent)
+	}
+	if _, _, ok := yamlSplitKey(line); ok {
+		return p.parseMap(indent)
+	}
+	if line[0] == '|' || line[0] == '>' {
+		// Only sequence items start a block with a block scalar, its lines are indented deeper than the dash
+		p.pos++
+		return p.parseBlockScalar(line, indent-2, p.pos)
+	}
+	node, err := p.parseInline(line, p.pos)
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+	return node, nil
+}
+
+func (p *yamlParser) parseSeq(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: 'l', line: p.pos + 1}
+	for {
+		lineIndent, line, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent {
+			return node, nil
+		}
+		if lineIndent > indent || !yamlIsSeqItem(line) {
+			if lineIndent == indent {
+				return node, nil
+			}
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", p.pos+1)
+		}
+
+		content := strings.TrimLeft(line[1:], " ")
+		if content == "" {
+			p.pos++
+			childIndent, _, ok, err := p.peek()
+			if err != nil {
+				return nil, err
+			}
+			if !ok || childIndent <= indent {
+				node.nodes = append(node.nodes, &yamlNode{kind: 's', isNull: true, line: p.pos})
+				continue
+			}
+			child, err := p.parseBlock(childIndent)
+			if err != nil {
+				return nil, err
+			}
+			node.nodes = append(node.nodes, child)
+			continue
+		}
+
+		// The item's content continues at its own column, parse it as if it started the line
+		childIndent := lineIndent + len(line) - len(content)
+		p.lines[p.pos] = strings.Repeat(" ", childIndent) + content
+		child, err := p.parseBlock(childIndent)
+		if err != nil {
+			return nil, err
+		}
+		node.nodes = append(node.nodes, child)
+	}
+}
+
+func (p *yamlParser) parseMap(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: 'm', line: p.pos + 1}
+	seen := make(map[string]bool)
+	for {
+		lineIndent, line, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent || (lineIndent == indent && yamlIsSeqItem(line)) {
+			return node, nil
+		}
+		if lineIndent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", p.pos+1)
+		}
+
+		key, rest, ok := yamlSplitKey(line)
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected a key", p.pos+1)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key %q", p.pos+1, key)
+		}
+		seen[key] = true
+		keyLine := p.pos + 1
+		p.pos++
+
+		var value *yamlNode
+		switch {
+		case rest == "":
+			childIndent, child, ok, err := p.peek()
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case ok && childIndent > indent:
+				value, err = p.parseBlock(childIndent)
+			case ok && childIndent == indent && yamlIsSeqItem(child):
+				// Sequences may sit at the indent of their key
+				value, err = p.parseSeq(indent)
+			default:
+				value = &yamlNode{kind: 's', isNull: true, line: keyLine}
+			}
+			if err != nil {
+				return nil, err
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			value, err = p.parseBlockScalar(rest, indent, keyLine)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			value, err = p.parseInline(rest, keyLine-1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		node.keys = append(node.keys, key)
+		node.nodes = append(node.nodes, value)
+	}
+}
+
+// yamlSplitKey splits "key: value" at the first colon outside quotes that ends the line or precedes a space
+func yamlSplitKey(line string) (string, string, bool) {
+	if line[0] == '"' || line[0] == '\'' {
+		end := yamlQuoteEnd(line)
+		if end < 0 || end+1 >= len(line) || line[end+1] != ':' {
+			return "", "", false
+		}
+		key, err := yamlUnquote(line[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		rest := line[end+2:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest), true
+	}
+	if strings.ContainsAny(line[:1], "[{") {
+		return "", "", false
+	}
+	for i := 0; i < len(line); i++ {
+		if line[i] == ':' && (i+1 == len(line) || line[i+1] == ' ') {
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseBlockScalar reads a | or > scalar whose lines are indented deeper than the key at indent
+func (p *yamlParser) parseBlockScalar(header string, indent, line int) (*yamlNode, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	for _, c := range header[1:] {
+		switch {
+		case c == '-' || c == '+':
+			chomp = byte(c)
+		case c >= '1' && c <= '9':
+			// Explicit indentation, the first line's indent is used anyway
+		default:
+			return nil, fmt.Errorf("yaml: line %d: invalid block scalar header %q", line, header)
+		}
+	}
+
+	var lines []string
+	contentIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := strings.TrimRight(p.lines[p.pos], " ")
+		content := strings.TrimLeft(raw, " ")
+		lineIndent := len(raw) - len(content)
+		if content == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if lineIndent <= indent {
+			break
+		}
+		if contentIndent < 0 {
+			contentIndent = lineIndent
+		}
+		if lineIndent < contentIndent {
+			return nil, fmt.Errorf("yaml: line %d: block scalar is less indented than its first line", p.pos+1)
+		}
+		lines = append(lines, raw[contentIndent:])
+	}
+
+	// Trailing blank lines belong to the scalar only with +, and the next node must see them otherwise
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var sb strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case !folded || l == "":
+				sb.WriteString("\n")
+			case prev == "":
+				// The blank lines before were written as newlines
+			case strings.HasPrefix(l, " ") || strings.HasPrefix(prev, " "):
+				// More indented lines keep their line breaks
+				sb.WriteString("\n")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(l)
+	}
+	value := sb.String()
+	switch {
+	case len(lines) == 0:
+	case chomp == '-':
+	case chomp == '+':
+		value += strings.Repeat("\n", trailing+1)
+	default:
+		value += "\n"
+	}
+	return &yamlNode{kind: 's', value: value, line: line}, nil
+}
+
+// parseInline parses a scalar or single-line flow collection, line is the zero-based line it is on
+func (p *yamlParser) parseInline(s string, line int) (*yamlNode, error) {
+	switch s[0] {
+	case '&', '*', '!':
+		return nil, fmt.Errorf("yaml: line %d: anchors, aliases and tags are not supported", line+1)
+	case '[', '{':
+		node, rest, err := yamlParseFlow(s, line+1)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("yaml: line %d: unexpected %q after flow collection", line+1, rest)
+		}
+		return node, nil
+	case '"', '\'':
+		end := yamlQuoteEnd(s)
+		if end < 0 {
+			return nil, fmt.Errorf("yaml: line %d: unterminated or multi-line quoted string", line+1)
+		}
+		if strings.TrimSpace(s[end+1:]) != "" {
+			return nil, fmt.Errorf("yaml: line %d: unexpected %q after quoted string", line+1, s[end+1:])
+		}
+		value, err := yamlUnquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: %v", line+1, err)
+		}
+		return &yamlNode{kind: 's', value: value, line: line + 1}, nil
+	}
+	return yamlPlain(s, line+1), nil
+}
+
+func yamlPlain(s string, line int) *yamlNode {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return &yamlNode{kind: 's', isNull: true, line: line}
+	}
+	return &yamlNode{kind: 's', value: s, line: line}
+}
+
+// yamlParseFlow parses a [..] or {..} collection at the start of s and returns what follows it
+func yamlParseFlow(s string, line int) (*yamlNode, string, error) {
+	open := s[0]
+	closing := byte(']')
+	node := &yamlNode{kind: 'l', line: line}
+	if open == '{' {
+		closing = '}'
+		node.kind = 'm'
+	}
+	s = strings.TrimLeft(s[1:], " ")
+
+	for {
+		if s == "" {
+			return nil, "", fmt.Errorf("yaml: line %d: unterminated flow collection", line)
+		}
+		if s[0] == closing {
+			return node, s[1:], nil
+		}
+
+		var key string
+		if open == '{' {
+			i := strings.IndexByte(s, ':')
+			if i < 0 {
+				return nil, "", fmt.Errorf("yaml: line %d: expected a key in flow mapping", line)
+			}
+			k, err := yamlFlowScalar(strings.TrimSpace(s[:i]))
+			if err != nil {
+				return nil, "", fmt.Errorf("yaml: line %d: %v", line, err)
+			}
+			key = k.value
+			s = strings.TrimLeft(s[i+1:], " ")
+		}
+
+		var value *yamlNode
+		if s != "" && (s[0] == '[' || s[0] == '{') {
+			var err error
+			value, s, err = yamlParseFlow(s, line)
+			if err != nil {
+				return nil, "", err
+			}
+		} else {
+			end := 0
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				end = yamlQuoteEnd(s) + 1
+				if end == 0 {
+					return nil, "", fmt.Errorf("yaml: line %d: unterminated quoted string", line)
+				}
+			}
+			for end < len(s) && s[end] != ',' && s[end] != closing {
+				end++
+			}
+			var err error
+			value, err = yamlFlowScalar(strings.TrimSpace(s[:end]))
+			if err != nil {
+				return nil, "", fmt.Errorf("yaml: line %d: %v", line, err)
+			}
+			value.line = line
+			s = s[end:]
+		}
+
+		if open == '{' {
+			node.keys = append(node.keys, key)
+		}
+		node.nodes = append(node.nodes, value)
+
+		s = strings.TrimLeft(s, " ")
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimLeft(s[1:], " ")
+		}
+	}
+}
+
+func yamlFlowScalar(s string) (*yamlNode, error) {
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		value, err := yamlUnquote(s)
+		if err != nil {
+			return nil, err
+		}
+		return &yamlNode{kind: 's', value: value}, nil
+	}
+	return yamlPlain(s, 0), nil
+}
+
+// yamlQuoteEnd returns the index of the quote closing the string s starts with, -1 if it is not closed
+func yamlQuoteEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlEscapes are the single-character escapes of double-quoted scalars
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f", 'r': "\r",
+	'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\", 'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// yamlUnquote decodes a single- or double-quoted scalar
+func yamlUnquote(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+
+	var sb strings.Builder
+	body := s[1 : len(s)-1]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(body) {
+			return "", fmt.Errorf("invalid escape at end of string")
+		}
+		if r, ok := yamlEscapes[body[i]]; ok {
+			sb.WriteString(r)
+			continue
+		}
+		digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[body[i]]
+		if digits == 0 || i+1+digits > len(body) {
+			return "", fmt.Errorf("invalid escape \\%c", body[i])
+		}
+		n, err := strconv.ParseUint(body[i+1:i+1+digits], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape \\%s", body[i:i+1+digits])
+		}
+		sb.WriteRune(rune(n))
+		i += digits
+	}
+	return sb.String(), nil
+}
+
+// yamlDecodeValue stores node in v, scalars convert to strings, bools and numbers as v needs
+func yamlDecodeValue(node *yamlNode, v reflect.Value) error {
+	if node.isNull {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	fail := func(want string) error {
+		return fmt.Errorf("yaml: line %d: expected %s", node.line, want)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if node.kind != 's' {
+			return fail("a string")
+		}
+		v.SetString(node.value)
+	case reflect.Bool:
+		if node.kind != 's' {
+			return fail("true or false")
+		}
+		switch strings.ToLower(node.value) {
+		case "true":
+			v.SetBool(true)
+		case "false":
+			v.SetBool(false)
+		default:
+			return fail("true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(node.value, 10, 64)
+		if node.kind != 's' || err != nil || v.OverflowInt(n) {
+			return fail("a whole number")
+		}
+		v.SetInt(n)
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := yamlDecodeValue(node, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice:
+		if node.kind != 'l' {
+			return fail("a list")
+		}
+		s := reflect.MakeSlice(v.Type(), len(node.nodes), len(node.nodes))
+		for i, item := range node.nodes {
+			if err := yamlDecodeValue(item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Struct:
+		if node.kind != 'm' {
+			return fail("a mapping")
+		}
+		fields := yamlFields(v.Type())
+		for i, key := range node.keys {
+			for _, f := range fields {
+				if strings.EqualFold(f.name, key) {
+					if err := yamlDecodeValue(node.nodes[i], v.Field(f.index)); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("yaml: cannot decode into %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"shopping-list/db"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestYAMLRoundTrip(t *testing.T) {
+	tricky := []string{
+		"", " ", "plain", "true", "False", "null", "~", "yes", "off", "123", "-1.5", "1e3", ".inf",
+		"key: value", "ends with colon:", "a #hash", "#comment", "- dash", "? question", "[flow]", "{map}",
+		`"double"`, "'single'", "|literal", ">folded", "&anchor", "*alias", "!tag", "%directive", "@at", "`tick",
+		"  leading", "trailing  ", "line\nbreak", "tab\there", "cr\rlf", "nul\x00byte", "bell\x07",
+		"Äpfel 🍎 – 1 kg", "Молоко", "👩‍👩‍👧", "nbsp\u00a0space", "bom\ufeff", "line\u2028sep", "back\\slash",
+	}
+
+	for _, s := range tricky {
+		in := ExportData{
+			Version: ExportVersion,
+			App:     "koffan",
+			Data: ExportBody{Lists: []ExportList{{
+				Name: s,
+				Icon: s,
+				Sections: []ExportSection{{
+					Name:      s,
+					SortOrder: intPtr(3),
+					Items:     []ExportItem{{Name: s, Description: s, Completed: true, Quantity: 2, Price: "3.49", Currency: "EUR"}},
+				}},
+			}}, Templates: []ExportTemplate{{Name: s, Description: s, Items: []ExportTemplateItem{{SectionName: s, Name: s, Description: s}}}},
+				History: []ExportHistory{{Name: s, LastSection: s, UsageCount: 7}}},
+		}
+
+		var buf bytes.Buffer
+		if err := encodeYAML(&buf, &in); err != nil {
+			t.Fatalf("encode %q: %v", s, err)
+		}
+		var out ExportData
+		if err := decodeYAML(buf.Bytes(), &out); err != nil {
+			t.Fatalf("decode %q: %v\n%s", s, err, buf.String())
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%q did not round-trip:\n%s\ngot %+v", s, buf.String(), out)
+		}
+	}
+}
+
+func TestYAMLDecodesHandEditedFile(t *testing.T) {
+	data := `---
+# Edited by hand
+version: "1.5"
+app: koffan
+data:
+  lists:
+    - name: 'It''s a list'   # single-quoted
+      icon: 🛒
+      is_active: true
+      sections:
+        - name: Dairy
+          items:
+            - name: Milk
+              description: |
+                first line
+                second line
+              quantity: 2
+            - {name: Eggs, description: "", quantity: 12}
+        - name: Empty
+          items: []
+  templates: []
+`
+	var got ExportData
+	if err := decodeYAML([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := ExportData{Version: "1.5", App: "koffan", Data: ExportBody{
+		Lists: []ExportList{{Name: "It's a list", Icon: "🛒", IsActive: true, Sections: []ExportSection{
+			{Name: "Dairy", Items: []ExportItem{
+				{Name: "Milk", Description: "first line\nsecond line\n", Quantity: 2},
+				{Name: "Eggs", Quantity: 12},
+			}},
+			{Name: "Empty", Items: []ExportItem{}},
+		}}},
+		Templates: []ExportTemplate{},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestYAMLRejectsUnsupportedSyntax(t *testing.T) {
+	for _, data := range []string{
+		"version: &v 1.5\n",
+		"version: !!str 1.5\n",
+		"version: \"1.5\nlists: []\n",
+	} {
+		var got ExportData
+		if err := decodeYAML([]byte(data), &got); err == nil {
+			t.Errorf("decodeYAML(%q) succeeded", data)
+		} else if !strings.Contains(err.Error(), "line") {
+			t.Errorf("decodeYAML(%q) error %q does not name the line", data, err)
+		}
+	}
+}
+
+// fullExport returns what a full export of the database holds, with a fixed export time
+func fullExport(t *testing.T) *ExportData {
+	t.Helper()
+	lists, err := db.GetAllLists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buildExport(lists, ExportOptions{IncludeTemplates: true, IncludeHistory: true})
+	data.ExportedAt = ""
+	return data
+}
+
+func TestYAMLExportImportsBack(t *testing.T) {
+	setupTestDB(t)
+	seedExportData(t)
+	want := fullExport(t)
+	if len(want.Data.Lists) != 2 || len(want.Data.Templates) != 1 || len(want.Data.History) != 2 {
+		t.Fatalf("seeded export has %d lists, %d templates, %d history entries", len(want.Data.Lists), len(want.Data.Templates), len(want.Data.History))
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, ExportOptions{Format: "yaml", IncludeTemplates: true, IncludeHistory: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := detectFormat("", buf.Bytes()); got != "yaml" {
+		t.Fatalf("export detected as %q", got)
+	}
+
+	setupTestDB(t)
+	result, err := Import(bytes.NewReader(buf.Bytes()), ImportOptions{Filename: "koffan.yaml"})
+	if err != nil {
+		t.Fatalf("import: %v\n%s", err, buf.String())
+	}
+	items := 0
+	for _, l := range want.Data.Lists {
+		for _, s := range l.Sections {
+			items += len(s.Items)
+		}
+	}
+	if result.ImportedLists != len(want.Data.Lists) || result.ImportedItems != items ||
+		result.ImportedTemplates != len(want.Data.Templates) || result.ImportedHistory != len(want.Data.History) {
+		t.Errorf("imported %+v, want %d lists, %d items, %d templates, %d history entries",
+			result, len(want.Data.Lists), items, len(want.Data.Templates), len(want.Data.History))
+	}
+
+	if got := fullExport(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("database after import differs:\ngot  %+v\nwant %+v", got, want)
+	}
+}
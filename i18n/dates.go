@@ -0,0 +1,54 @@
+package i18n
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date styles for FormatDate
+const (
+	DateShort = "short" // 01/15/2024
+	DateLong  = "long"  // January 15, 2024
+	DateFull  = "full"  // Monday, January 15, 2024
+)
+
+// FormatDate formats t with the language's pattern for style, unknown styles use DateShort
+func FormatDate(lang string, t time.Time, style string) string {
+	if style != DateLong && style != DateFull {
+		style = DateShort
+	}
+	replacer := strings.NewReplacer(
+		"{{day}}", strconv.Itoa(t.Day()),
+		"{{day2}}", fmt.Sprintf("%02d", t.Day()),
+		"{{month}}", Get(lang, "dates.months."+strconv.Itoa(int(t.Month()))),
+		"{{month2}}", fmt.Sprintf("%02d", int(t.Month())),
+		"{{year}}", strconv.Itoa(t.Year()),
+		"{{weekday}}", Get(lang, "dates.weekdays."+strconv.Itoa(int(t.Weekday()))),
+	)
+	return replacer.Replace(Get(lang, "dates.format_"+style))
+}
+
+// FormatRelative describes how long before now t was, e.g. "3 weeks ago"
+// Times in the future or less than a minute ago are "just now"
+func FormatRelative(lang string, t, now time.Time) string {
+	d := now.Sub(t)
+	days := int(d.Hours() / 24)
+	switch {
+	case d < time.Minute:
+		return Get(lang, "dates.just_now")
+	case d < time.Hour:
+		return GetN(lang, "dates.minutes_ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return GetN(lang, "dates.hours_ago", int(d.Hours()))
+	case days < 7:
+		return GetN(lang, "dates.days_ago", days)
+	case days < 30:
+		return GetN(lang, "dates.weeks_ago", days/7)
+	case days < 365:
+		return GetN(lang, "dates.months_ago", max(days/30, 1))
+	default:
+		return GetN(lang, "dates.years_ago", days/365)
+	}
+}
@@ -0,0 +1,73 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	resetLocales(t)
+	date := time.Date(2026, time.March, 5, 18, 30, 0, 0, time.UTC)
+	cases := []struct{ lang, style, want string }{
+		{"en", DateShort, "03/05/2026"},
+		{"en", DateLong, "March 5, 2026"},
+		{"en", DateFull, "Thursday, March 5, 2026"},
+		{"en", "unknown", "03/05/2026"},
+		{"uk", DateShort, "05.03.2026"},
+		{"uk", DateLong, "5 березня 2026 р."},
+		{"uk", DateFull, "четвер, 5 березня 2026 р."},
+		{"pl", DateLong, "5 marca 2026"},
+		{"pl", DateFull, "czwartek, 5 marca 2026"},
+		{"de", DateLong, "5. März 2026"},
+		{"de", DateFull, "Donnerstag, 5. März 2026"},
+	}
+	for _, tc := range cases {
+		if got := FormatDate(tc.lang, date, tc.style); got != tc.want {
+			t.Errorf("FormatDate(%s, %s) = %q, want %q", tc.lang, tc.style, got, tc.want)
+		}
+	}
+}
+
+func TestFormatRelative(t *testing.T) {
+	resetLocales(t)
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	cases := []struct {
+		lang string
+		ago  time.Duration
+		want string
+	}{
+		{"en", 0, "just now"},
+		{"en", -time.Hour, "just now"},
+		{"en", 30 * time.Second, "just now"},
+		{"en", time.Minute, "1 minute ago"},
+		{"en", 5 * time.Hour, "5 hours ago"},
+		{"en", day, "1 day ago"},
+		{"en", 3 * day, "3 days ago"},
+		{"en", 15 * day, "2 weeks ago"},
+		{"en", 45 * day, "1 month ago"},
+		{"en", 800 * day, "2 years ago"},
+		{"uk", 10 * time.Second, "щойно"},
+		{"uk", day, "1 день тому"},
+		{"uk", 2 * day, "2 дні тому"},
+		{"uk", 4 * day, "4 дні тому"},
+		{"uk", 5 * day, "5 днів тому"},
+		{"uk", 6 * day, "6 днів тому"},
+		{"uk", 21 * time.Minute, "21 хвилину тому"},
+		{"uk", 3 * 7 * day, "3 тижні тому"},
+		{"uk", 5 * 365 * day, "5 років тому"},
+		{"pl", day, "1 dzień temu"},
+		{"pl", 2 * day, "2 dni temu"},
+		{"pl", 5 * day, "5 dni temu"},
+		{"pl", 22 * time.Minute, "22 minuty temu"},
+		{"pl", 12 * time.Hour, "12 godzin temu"},
+		{"pl", 2 * 365 * day, "2 lata temu"},
+		{"de", day, "vor 1 Tag"},
+		{"de", 3 * day, "vor 3 Tagen"},
+	}
+	for _, tc := range cases {
+		if got := FormatRelative(tc.lang, now.Add(-tc.ago), now); got != tc.want {
+			t.Errorf("FormatRelative(%s, %v ago) = %q, want %q", tc.lang, tc.ago, got, tc.want)
+		}
+	}
+}
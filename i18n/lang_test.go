@@ -0,0 +1,54 @@
+package i18n
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ tag, want string }{
+		{"uk", "uk"},
+		{" PL ", "pl"},
+		{"pt-br", "pt-BR"},
+		{"pt_BR", "pt-BR"},
+		{"pt-AO", "pt"},
+		{"de-CH-1996", "de"},
+		{"nb", "no"},
+		{"nn-NO", "no"},
+		{"ja", ""},
+		{"", ""},
+		{"*", ""},
+	}
+	for _, tc := range cases {
+		if got := Resolve(tc.tag); got != tc.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tc.tag, got, tc.want)
+		}
+	}
+}
+
+func TestMatchAcceptLanguage(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ name, header, want string }{
+		{"single", "uk", "uk"},
+		{"region falls back to language", "uk-UA,uk;q=0.9", "uk"},
+		{"highest quality wins", "en;q=0.5, pl;q=0.8, de;q=0.7", "pl"},
+		{"quality without spaces", "en;q=0.1,uk;q=0.9", "uk"},
+		{"missing quality is 1", "fr;q=0.9, de", "de"},
+		{"ties keep header order", "sv;q=0.7, lt;q=0.7", "sv"},
+		{"unsupported skipped", "ja, zh-CN;q=0.9, sk;q=0.1", "sk"},
+		{"only unsupported", "ja, zh-CN;q=0.9", ""},
+		{"zero quality refuses", "pl;q=0", ""},
+		{"malformed quality skipped", "pl;q=high, de;q=0.2", "de"},
+		{"wildcard ignored", "*;q=0.5, el;q=0.4", "el"},
+		{"empty", "", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MatchAcceptLanguage(tc.header); got != tc.want {
+				t.Errorf("MatchAcceptLanguage(%q) = %q, want %q", tc.header, got, tc.want)
+			}
+		})
+	}
+}
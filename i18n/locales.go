@@ -4,6 +4,9 @@ import (
 	"embed"
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -21,13 +24,18 @@ type LocaleMeta struct {
 // Locale represents a complete set of translations
 type Locale struct {
 	Meta LocaleMeta
-	Raw  map[string]interface{}
+	// Raw is the embedded catalog with overrides applied
+	Raw map[string]interface{}
+	// Embedded is the catalog shipped with the binary
+	Embedded map[string]interface{}
 }
 
 var (
 	locales     = make(map[string]*Locale)
 	localesMu   sync.RWMutex
 	defaultLang = "en"
+	// overrides holds override values per language, keyed by "section.key"
+	overrides = make(map[string]map[string]string)
 )
 
 // SetDefaultLang sets the default language (must be called after Init)
@@ -68,7 +76,7 @@ func Init() error {
 			return fmt.Errorf("failed to parse %s: %w", file.Name(), err)
 		}
 
-		locale := &Locale{Raw: raw}
+		locale := &Locale{Raw: raw, Embedded: raw}
 
 		// Parse meta
 		if meta, ok := raw["meta"].(map[string]interface{}); ok {
@@ -88,46 +96,116 @@ func Init() error {
 		localesMu.Unlock()
 	}
 
+	localesMu.Lock()
+	rebuildLocked()
+	localesMu.Unlock()
 	return nil
 }
 
-// Get retrieves a translation for a key in format "section.key"
-func Get(lang, key string) string {
+// rebuildLocked sets each locale's Raw to its parents' translations, its own and its overrides
+// so a regional locale such as pt-BR only needs the strings that differ from pt
+func rebuildLocked() {
+	for code, locale := range locales {
+		var merged map[string]interface{}
+		for _, parent := range parentCodes(code) {
+			if p, ok := locales[parent]; ok {
+				merged = mergeTree(merged, p.Embedded)
+			}
+		}
+		merged = mergeTree(merged, locale.Embedded)
+		locale.Raw = applyOverrides(merged, overrides[code])
+	}
+}
+
+// parentCodes returns the more general codes of a BCP-47 code, most general first ("pt" for "pt-BR")
+func parentCodes(code string) []string {
+	parts := strings.Split(code, "-")
+	parents := make([]string, 0, len(parts)-1)
+	for i := 1; i < len(parts); i++ {
+		parents = append(parents, strings.Join(parts[:i], "-"))
+	}
+	return parents
+}
+
+// mergeTree returns a copy of base with the values of top set on it, nil base returns top itself
+func mergeTree(base, top map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		return top
+	}
+	merged := copyTree(base)
+	for k, v := range top {
+		if child, ok := v.(map[string]interface{}); ok {
+			if existing, ok := merged[k].(map[string]interface{}); ok {
+				merged[k] = mergeTree(existing, child)
+				continue
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// Chain returns the locales consulted for lang, most specific first, ending with the default language
+func Chain(lang string) []string {
 	localesMu.RLock()
-	locale, ok := locales[lang]
-	if !ok {
-		locale = locales[defaultLang]
+	defer localesMu.RUnlock()
+
+	var chain []string
+	seen := make(map[string]bool)
+	add := func(code string) {
+		if _, ok := locales[code]; ok && !seen[code] {
+			seen[code] = true
+			chain = append(chain, code)
+		}
+	}
+	add(lang)
+	parents := parentCodes(lang)
+	for i := len(parents) - 1; i >= 0; i-- {
+		add(parents[i])
 	}
-	localesMu.RUnlock()
+	add(defaultLang)
+	return chain
+}
+
+// Get retrieves a translation for a key in format "section.key"
+// Lookup walks Chain(lang), overrides first within each locale, and returns the key itself if nothing matches
+func Get(lang, key string) string {
+	for _, code := range Chain(lang) {
+		localesMu.RLock()
+		locale := locales[code]
+		localesMu.RUnlock()
 
-	if locale == nil {
-		return key
+		if str, ok := lookup(locale.Raw, key); ok {
+			return str
+		}
 	}
+	return key
+}
 
+// lookup finds the string at a "section.key" path
+func lookup(raw map[string]interface{}, key string) (string, bool) {
 	parts := strings.Split(key, ".")
-	current := locale.Raw
+	current := raw
 
 	for i, part := range parts {
 		val, exists := current[part]
 		if !exists {
-			return key
+			return "", false
 		}
 
 		if i == len(parts)-1 {
-			if str, ok := val.(string); ok {
-				return str
-			}
-			return key
+			str, ok := val.(string)
+			return str, ok
 		}
 
-		if next, ok := val.(map[string]interface{}); ok {
-			current = next
-		} else {
-			return key
+		next, ok := val.(map[string]interface{})
+		if !ok {
+			return "", false
 		}
+		current = next
 	}
 
-	return key
+	return "", false
 }
 
 // GetWithParams retrieves a translation with parameter substitution {{param}}
@@ -181,3 +259,134 @@ func AvailableLocales() []LocaleMeta {
 func T(lang, key string) string {
 	return Get(lang, key)
 }
+
+// langAliases maps language tags to the locale that covers them
+var langAliases = map[string]string{
+	"nb": "no",
+	"nn": "no",
+}
+
+// Resolve returns the available locale for a language tag, or "" if none matches
+// Tags are matched case-insensitively and shortened until a locale exists, so "pt-br" finds pt-BR
+// and "pt-AO" finds pt
+func Resolve(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return ""
+	}
+	parts := strings.Split(tag, "-")
+	if alias, ok := langAliases[strings.ToLower(parts[0])]; ok {
+		parts[0] = alias
+	}
+
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+
+	for i := len(parts); i > 0; i-- {
+		candidate := strings.Join(parts[:i], "-")
+		for code := range locales {
+			if strings.EqualFold(code, candidate) {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// MatchAcceptLanguage returns the best available locale for an Accept-Language header, or "" if none matches
+// Entries are tried by descending quality, ties keep header order
+func MatchAcceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= bestQ {
+			continue
+		}
+		if lang := Resolve(tag); lang != "" {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// referenceLang is the locale every other locale is measured against
+const referenceLang = "en"
+
+// LanguageInfo describes an available language and how much of it is translated
+type LanguageInfo struct {
+	LocaleMeta
+	Completeness float64 `json:"completeness"`
+	// Fallback lists the locales used for keys this one does not translate
+	Fallback []string `json:"fallback,omitempty"`
+}
+
+// Keys returns the translation keys of a language in "section.key" form, nil if it does not exist
+func Keys(lang string) []string {
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+
+	locale, ok := locales[lang]
+	if !ok {
+		return nil
+	}
+	var keys []string
+	collectKeys(locale.Raw, "", &keys)
+	sort.Strings(keys)
+	return keys
+}
+
+// collectKeys appends the keys of all non-empty string values below prefix
+func collectKeys(node map[string]interface{}, prefix string, keys *[]string) {
+	for k, v := range node {
+		if prefix == "" && k == "meta" {
+			continue
+		}
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case string:
+			if val != "" {
+				*keys = append(*keys, key)
+			}
+		case map[string]interface{}:
+			collectKeys(val, key, keys)
+		}
+	}
+}
+
+// Languages returns the available languages with the percentage of reference keys they translate
+func Languages() []LanguageInfo {
+	reference := Keys(referenceLang)
+	metas := AvailableLocales()
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Code < metas[j].Code })
+
+	result := make([]LanguageInfo, 0, len(metas))
+	for _, meta := range metas {
+		info := LanguageInfo{LocaleMeta: meta, Completeness: 100, Fallback: Chain(meta.Code)[1:]}
+		if len(reference) > 0 {
+			translated := make(map[string]bool)
+			for _, k := range Keys(meta.Code) {
+				translated[k] = true
+			}
+			found := 0
+			for _, k := range reference {
+				if translated[k] {
+					found++
+				}
+			}
+			info.Completeness = math.Round(float64(found)*1000/float64(len(reference))) / 10
+		}
+		result = append(result, info)
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package i18n
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// pluralCategories are the object keys a plural translation may use, which vary by language
+var pluralCategories = map[string]bool{PluralOne: true, PluralFew: true, PluralMany: true, PluralOther: true}
+
+// keySet returns the keys of lang with plural variants folded into their plural key
+func keySet(t *testing.T, lang string) map[string]bool {
+	t.Helper()
+	keys := Keys(lang)
+	if keys == nil {
+		t.Fatalf("locale %s not loaded", lang)
+	}
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if i := strings.LastIndex(k, "."); i >= 0 && pluralCategories[k[i+1:]] {
+			k = k[:i]
+		}
+		set[k] = true
+	}
+	return set
+}
+
+// difference returns the sorted keys of a that are not in b
+func difference(a, b map[string]bool) []string {
+	var out []string
+	for k := range a {
+		if !b[k] {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestLocalesMatchReference(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	reference := keySet(t, referenceLang)
+
+	for _, meta := range AvailableLocales() {
+		code := meta.Code
+		if code == referenceLang {
+			continue
+		}
+		t.Run(code, func(t *testing.T) {
+			// A regional variant only carries what differs from its language, the rest comes from the parent
+			if parents := parentCodes(code); len(parents) > 0 {
+				if Keys(parents[len(parents)-1]) == nil {
+					t.Fatalf("regional locale %s has no %s parent", code, parents[len(parents)-1])
+				}
+			}
+			keys := keySet(t, code)
+			if missing := difference(reference, keys); len(missing) > 0 {
+				t.Errorf("%d keys missing from %s: %s", len(missing), code, strings.Join(missing, ", "))
+			}
+			if extra := difference(keys, reference); len(extra) > 0 {
+				t.Errorf("%d keys in %s but not in %s: %s", len(extra), code, referenceLang, strings.Join(extra, ", "))
+			}
+		})
+	}
+}
+
+func TestRegionalVariantFallsBackToLanguage(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Chain("pt-BR"); len(got) < 2 || got[0] != "pt-BR" || got[1] != "pt" {
+		t.Fatalf("Chain(pt-BR) = %v", got)
+	}
+	if Get("pt-BR", "meta.code") != "pt-BR" {
+		t.Errorf("pt-BR does not use its own strings")
+	}
+}
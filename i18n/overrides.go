@@ -0,0 +1,166 @@
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OverrideFile reports how one override file was applied
+type OverrideFile struct {
+	File        string   `json:"file"`
+	Lang        string   `json:"lang"`
+	Applied     int      `json:"applied"`
+	UnknownKeys []string `json:"unknown_keys,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// OverrideReport describes a load of the override directory
+type OverrideReport struct {
+	Dir   string         `json:"dir"`
+	Files []OverrideFile `json:"files"`
+}
+
+// LoadOverrides replaces all overrides with the <lang>.json files in dir
+// Files use the same nested layout as the embedded locales. Unknown languages,
+// malformed files and keys missing from the embedded catalog are reported and skipped.
+// A missing directory clears all overrides
+func LoadOverrides(dir string) (*OverrideReport, error) {
+	report := &OverrideReport{Dir: dir, Files: []OverrideFile{}}
+	loaded := make(map[string]map[string]string)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		file := OverrideFile{File: entry.Name(), Lang: strings.TrimSuffix(entry.Name(), ".json")}
+		values, err := readOverrideFile(filepath.Join(dir, entry.Name()), file.Lang, &file)
+		if err != nil {
+			file.Error = err.Error()
+		} else {
+			loaded[file.Lang] = values
+			file.Applied = len(values)
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	overrides = loaded
+	rebuildLocked()
+	return report, nil
+}
+
+// readOverrideFile parses an override file and returns its known keys, unknown ones are added to file
+func readOverrideFile(path, lang string, file *OverrideFile) (map[string]string, error) {
+	localesMu.RLock()
+	locale, ok := locales[lang]
+	reference := locales[referenceLang]
+	localesMu.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown language")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]string)
+	flattenStrings(raw, "", flat)
+
+	values := make(map[string]string, len(flat))
+	for key, value := range flat {
+		_, known := lookup(locale.Raw, key)
+		if !known && reference != nil {
+			_, known = lookup(reference.Embedded, key)
+		}
+		if !known {
+			file.UnknownKeys = append(file.UnknownKeys, key)
+			continue
+		}
+		values[key] = value
+	}
+	sort.Strings(file.UnknownKeys)
+	return values, nil
+}
+
+// flattenStrings collects string values below prefix as "section.key", other values are ignored
+func flattenStrings(node map[string]interface{}, prefix string, out map[string]string) {
+	for k, v := range node {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case string:
+			out[key] = val
+		case map[string]interface{}:
+			flattenStrings(val, key, out)
+		}
+	}
+}
+
+// applyOverrides returns a copy of embedded with the override values set, embedded itself is not modified
+func applyOverrides(embedded map[string]interface{}, values map[string]string) map[string]interface{} {
+	if len(values) == 0 {
+		return embedded
+	}
+	merged := copyTree(embedded)
+	for key, value := range values {
+		parts := strings.Split(key, ".")
+		node := merged
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := node[part].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				node[part] = next
+			}
+			node = next
+		}
+		node[parts[len(parts)-1]] = value
+	}
+	return merged
+}
+
+func copyTree(node map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(node))
+	for k, v := range node {
+		if child, ok := v.(map[string]interface{}); ok {
+			out[k] = copyTree(child)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Overrides returns the overridden keys per language
+func Overrides() map[string][]string {
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+
+	result := make(map[string][]string, len(overrides))
+	for lang, values := range overrides {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		result[lang] = keys
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeOverrides writes override files named by language into a new directory
+func writeOverrides(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// resetLocales reloads the embedded catalog without overrides once the test is done
+func resetLocales(t *testing.T) {
+	t.Helper()
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		LoadOverrides(filepath.Join(t.TempDir(), "none"))
+		Init()
+	})
+}
+
+// dropEmbeddedKey removes key from the embedded catalog of lang, as if it was never translated
+func dropEmbeddedKey(t *testing.T, lang, key string) {
+	t.Helper()
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	embedded := copyTree(locales[lang].Embedded)
+	parts := strings.Split(key, ".")
+	node := embedded
+	for _, part := range parts[:len(parts)-1] {
+		node = node[part].(map[string]interface{})
+	}
+	delete(node, parts[len(parts)-1])
+	locales[lang].Embedded = embedded
+	rebuildLocked()
+}
+
+func TestOverrideFallbackOrder(t *testing.T) {
+	resetLocales(t)
+	dir := writeOverrides(t, map[string]string{
+		"uk.json": `{"actions": {"uncertain": "Спитати спершу"}}`,
+		"en.json": `{"items": {"no_items": "Nothing to buy"}}`,
+	})
+	if _, err := LoadOverrides(dir); err != nil {
+		t.Fatal(err)
+	}
+	dropEmbeddedKey(t, "uk", "items.new_product")
+
+	cases := []struct{ name, lang, key, want string }{
+		{"override", "uk", "actions.uncertain", "Спитати спершу"},
+		{"embedded locale", "uk", "items.no_items", "Немає продуктів"},
+		{"embedded default", "uk", "items.new_product", "New product"},
+		{"override of the default", "en", "items.no_items", "Nothing to buy"},
+		{"key itself", "uk", "items.no_such_key", "items.no_such_key"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Get(tc.lang, tc.key); got != tc.want {
+				t.Errorf("Get(%s, %s) = %q, want %q", tc.lang, tc.key, got, tc.want)
+			}
+		})
+	}
+	if Get("pl", "actions.uncertain") == "Спитати спершу" {
+		t.Error("the uk override leaked into pl")
+	}
+}
+
+func TestLoadOverridesReport(t *testing.T) {
+	resetLocales(t)
+	dir := writeOverrides(t, map[string]string{
+		"uk.json":   `{"actions": {"uncertain": "Спитати спершу"}, "actions.typo": "x", "nope": {"key": "y"}}`,
+		"pl.json":   `{"actions": {"uncertain": `,
+		"xx.json":   `{"actions": {"uncertain": "?"}}`,
+		"notes.txt": `not an override`,
+		"en.json":   `{"items": {"no_items": "Nothing to buy", "new_product": "Add something"}}`,
+	})
+	report, err := LoadOverrides(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]OverrideFile)
+	for _, f := range report.Files {
+		files[f.File] = f
+	}
+	if len(files) != 4 {
+		t.Errorf("reported files %v, want the four JSON files", report.Files)
+	}
+	if f := files["uk.json"]; f.Applied != 1 || !reflect.DeepEqual(f.UnknownKeys, []string{"actions.typo", "nope.key"}) || f.Error != "" {
+		t.Errorf("uk.json = %+v, want one key applied and two unknown", f)
+	}
+	if f := files["pl.json"]; f.Error == "" || f.Applied != 0 {
+		t.Errorf("pl.json = %+v, want a parse error", f)
+	}
+	if f := files["xx.json"]; f.Error != "unknown language" {
+		t.Errorf("xx.json = %+v, want an unknown language", f)
+	}
+	if got := Get("pl", "actions.uncertain"); got == "" || got == "actions.uncertain" {
+		t.Errorf("a malformed pl override broke the embedded string: %q", got)
+	}
+
+	want := map[string][]string{"uk": {"actions.uncertain"}, "en": {"items.new_product", "items.no_items"}}
+	if got := Overrides(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Overrides() = %v, want %v", got, want)
+	}
+
+	// Reloading replaces the overrides, a missing directory removes them
+	if _, err := LoadOverrides(filepath.Join(dir, "missing")); err != nil {
+		t.Fatal(err)
+	}
+	if len(Overrides()) != 0 || Get("uk", "actions.uncertain") != "Під питанням" {
+		t.Errorf("overrides after reloading a missing directory: %v, %q", Overrides(), Get("uk", "actions.uncertain"))
+	}
+}
@@ -0,0 +1,136 @@
+package i18n
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Plural categories as defined by CLDR
+const (
+	PluralOne   = "one"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+// pluralRules maps a language to its CLDR cardinal rule for integers
+// Languages without an entry use the English rule
+var pluralRules = map[string]func(n int) string{
+	"fr": pluralZeroOne,
+	"pt": pluralZeroOne,
+	"pl": pluralPolish,
+	"uk": pluralEastSlavic,
+	"sk": pluralCzechSlovak,
+	"lt": pluralLithuanian,
+}
+
+// PluralCategory returns the plural category of n in a language, regional variants use their language's rule
+func PluralCategory(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	if rule, ok := pluralRules[base]; ok {
+		return rule(n)
+	}
+	if n == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+func pluralZeroOne(n int) string {
+	if n == 0 || n == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+func pluralPolish(n int) string {
+	switch {
+	case n == 1:
+		return PluralOne
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return PluralFew
+	default:
+		return PluralMany
+	}
+}
+
+func pluralEastSlavic(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return PluralOne
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return PluralFew
+	default:
+		return PluralMany
+	}
+}
+
+func pluralCzechSlovak(n int) string {
+	switch {
+	case n == 1:
+		return PluralOne
+	case n >= 2 && n <= 4:
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+func pluralLithuanian(n int) string {
+	switch {
+	case n%10 == 1 && (n%100 < 11 || n%100 > 19):
+		return PluralOne
+	case n%10 >= 2 && (n%100 < 11 || n%100 > 19):
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+// GetN retrieves the plural form of key for n and replaces {{count}} with n
+// Plural keys hold an object of CLDR categories ("one", "few", "many", "other").
+// A missing category falls back to "other", then to the default language, then to the key
+func GetN(lang, key string, n int) string {
+	text, ok := pluralForm(lang, key, n)
+	if !ok {
+		text, ok = pluralForm(GetDefaultLang(), key, n)
+	}
+	if !ok {
+		return key
+	}
+	return strings.ReplaceAll(text, "{{count}}", strconv.Itoa(n))
+}
+
+// pluralForm picks the variant of key for n in one language
+func pluralForm(lang, key string, n int) (string, bool) {
+	localesMu.RLock()
+	locale := locales[lang]
+	localesMu.RUnlock()
+	if locale == nil {
+		return "", false
+	}
+
+	// Plain strings are used for every count
+	if str, ok := lookup(locale.Raw, key); ok {
+		return str, true
+	}
+	for _, category := range []string{PluralCategory(lang, n), PluralOther} {
+		if str, ok := lookup(locale.Raw, key+"."+category); ok {
+			return str, true
+		}
+	}
+	return "", false
+}
+
+// GetF retrieves a translation and replaces {{name}} placeholders with the given values
+func GetF(lang, key string, args map[string]any) string {
+	text := Get(lang, key)
+	for k, v := range args {
+		text = strings.ReplaceAll(text, "{{"+k+"}}", fmt.Sprint(v))
+	}
+	return text
+}
@@ -0,0 +1,108 @@
+package i18n
+
+import "testing"
+
+func TestPluralCategory(t *testing.T) {
+	cases := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{"en", 0, PluralOther},
+		{"en", 1, PluralOne},
+		{"en", 2, PluralOther},
+		{"en", 21, PluralOther},
+		{"uk", 1, PluralOne},
+		{"uk", 2, PluralFew},
+		{"uk", 4, PluralFew},
+		{"uk", 5, PluralMany},
+		{"uk", 11, PluralMany},
+		{"uk", 12, PluralMany},
+		{"uk", 21, PluralOne},
+		{"uk", 22, PluralFew},
+		{"uk", 25, PluralMany},
+		{"uk", 111, PluralMany},
+		{"uk", 0, PluralMany},
+		{"uk", -21, PluralOne},
+		{"pl", 1, PluralOne},
+		{"pl", 2, PluralFew},
+		{"pl", 5, PluralMany},
+		{"pl", 12, PluralMany},
+		{"pl", 21, PluralMany},
+		{"pl", 22, PluralFew},
+		{"pl", 112, PluralMany},
+		{"pl", 0, PluralMany},
+		{"pt-BR", 0, PluralOne},
+		{"pt-BR", 2, PluralOther},
+	}
+	for _, tc := range cases {
+		if got := PluralCategory(tc.lang, tc.n); got != tc.want {
+			t.Errorf("PluralCategory(%s, %d) = %s, want %s", tc.lang, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	resetLocales(t)
+	cases := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{"en", 1, "1 day ago"},
+		{"en", 2, "2 days ago"},
+		{"en", 21, "21 days ago"},
+		{"uk", 1, "1 день тому"},
+		{"uk", 3, "3 дні тому"},
+		{"uk", 5, "5 днів тому"},
+		{"uk", 11, "11 днів тому"},
+		{"uk", 21, "21 день тому"},
+		{"uk", 24, "24 дні тому"},
+		{"pl", 1, "1 dzień temu"},
+		{"pl", 2, "2 dni temu"},
+		{"pl", 5, "5 dni temu"},
+		{"pl", 22, "22 dni temu"},
+	}
+	for _, tc := range cases {
+		if got := GetN(tc.lang, "dates.days_ago", tc.n); got != tc.want {
+			t.Errorf("GetN(%s, dates.days_ago, %d) = %q, want %q", tc.lang, tc.n, got, tc.want)
+		}
+	}
+
+	// A plain string serves every count
+	if got := GetN("en", "items.no_items", 3); got != "No products" {
+		t.Errorf("GetN of a plain string = %q", got)
+	}
+}
+
+func TestGetNMissingVariant(t *testing.T) {
+	resetLocales(t)
+
+	// A missing category falls back to "other" in the same language
+	dropEmbeddedKey(t, "uk", "dates.days_ago.many")
+	if got := GetN("uk", "dates.days_ago", 5); got != "5 дня тому" {
+		t.Errorf("uk without a many form = %q, want the other form", got)
+	}
+	if got := GetN("uk", "dates.days_ago", 3); got != "3 дні тому" {
+		t.Errorf("uk few form = %q, want it untouched", got)
+	}
+
+	// A language without the key falls back to the default language, then to the key itself
+	dropEmbeddedKey(t, "pl", "dates.days_ago")
+	if got := GetN("pl", "dates.days_ago", 5); got != "5 days ago" {
+		t.Errorf("pl without the key = %q, want the English form", got)
+	}
+	if got := GetN("pl", "dates.no_such_key", 5); got != "dates.no_such_key" {
+		t.Errorf("unknown key = %q, want the key", got)
+	}
+}
+
+func TestGetF(t *testing.T) {
+	resetLocales(t)
+	if got := GetF("uk", "api_errors.validation_error.required", map[string]any{"field": "name"}); got != "name є обов'язковим" {
+		t.Errorf("GetF(uk) = %q", got)
+	}
+	if got := GetF("en", "api_errors.validation_error.required", nil); got != "{{field}} is required" {
+		t.Errorf("GetF without arguments = %q, want the placeholder kept", got)
+	}
+}
@@ -0,0 +1,47 @@
+package i18n
+
+import "strings"
+
+// wellKnownSectionKeys are sections the app names itself, recognized in every language
+var wellKnownSectionKeys = []string{"sections.default"}
+
+// SectionKey returns the translation key of a well-known section named in any language
+func SectionKey(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", false
+	}
+
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+
+	for _, key := range wellKnownSectionKeys {
+		for _, locale := range locales {
+			for _, raw := range []map[string]interface{}{locale.Raw, locale.Embedded} {
+				if str, ok := lookup(raw, key); ok && strings.EqualFold(str, name) {
+					return key, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// LocalizeSectionName returns a well-known section's name in lang, other names are returned unchanged
+func LocalizeSectionName(lang, name string) string {
+	if key, ok := SectionKey(name); ok {
+		return Get(lang, key)
+	}
+	return name
+}
+
+// SameSection reports whether two section names refer to the same section,
+// ignoring case and the language of well-known sections
+func SameSection(a, b string) bool {
+	if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b)) {
+		return true
+	}
+	keyA, okA := SectionKey(a)
+	keyB, okB := SectionKey(b)
+	return okA && okB && keyA == keyB
+}
@@ -0,0 +1,41 @@
+package i18n
+
+import "testing"
+
+func TestSameSection(t *testing.T) {
+	resetLocales(t)
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"General", "Загальне", true},
+		{"Загальне", "ogólne", true},
+		{" general ", "GENERAL", true},
+		{"Dairy", "dairy", true},
+		{"General", "Dairy", false},
+		{"Загальне", "Молочне", false},
+		{"", "General", false},
+	}
+	for _, tc := range cases {
+		if got := SameSection(tc.a, tc.b); got != tc.want {
+			t.Errorf("SameSection(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestLocalizeSectionName(t *testing.T) {
+	resetLocales(t)
+	cases := []struct{ lang, name, want string }{
+		{"en", "Загальне", "General"},
+		{"en", "ogólne", "General"},
+		{"uk", "General", "Загальне"},
+		{"pl", " Загальне ", "Ogólne"},
+		{"en", "Dairy", "Dairy"},
+		{"uk", "Dairy", "Dairy"},
+	}
+	for _, tc := range cases {
+		if got := LocalizeSectionName(tc.lang, tc.name); got != tc.want {
+			t.Errorf("LocalizeSectionName(%s, %q) = %q, want %q", tc.lang, tc.name, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"html/template"
@@ -8,14 +9,17 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"shopping-list/api"
 	"shopping-list/db"
 	"shopping-list/handlers"
 	"shopping-list/i18n"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/template/html/v2"
 	"github.com/gofiber/websocket/v2"
@@ -28,6 +32,14 @@ var embeddedTemplatesFS embed.FS
 var embeddedStaticFS embed.FS
 
 func main() {
+	// Admin commands work on the database directly, without starting the server
+	if isCLICommand(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	// Structured JSON logs, everything logged below goes through slog
+	handlers.InitLogging()
+
 	// Initialize i18n first (before db, so migrations can use translations)
 	if err := i18n.Init(); err != nil {
 		log.Fatal("Failed to initialize i18n:", err)
@@ -38,16 +50,43 @@ func main() {
 		i18n.SetDefaultLang(lang)
 	}
 
+	// Custom translations from I18N_OVERRIDES_DIR (optional)
+	handlers.InitTranslationOverrides()
+
 	// Initialize database
 	db.Init()
 	defer db.Close()
 
+	// A default language stored in settings overrides DEFAULT_LANG
+	handlers.InitLanguage()
+
 	// Clean expired sessions on startup
 	db.CleanExpiredSessions()
 
 	// Initialize login rate limiter
 	handlers.InitLoginRateLimiter()
 
+	// Initialize trusted reverse-proxy auth (optional)
+	handlers.InitProxyAuth()
+
+	// Initialize IP allowlist for admin routes (optional)
+	handlers.InitAdminAllowlist()
+
+	// Load persisted maintenance mode state
+	handlers.InitMaintenance()
+
+	// Report operations interrupted by a crash
+	handlers.InitOperations()
+
+	// Fix duplicate or gapped sort_order left by interrupted writes
+	handlers.InitOrdering()
+
+	// Initialize share link throttling and background maintenance
+	handlers.InitShares()
+
+	// Load or generate the secret signing export download links
+	handlers.InitExportLinks()
+
 	// Initialize template engine
 	templatesRootFS, err := fs.Sub(embeddedTemplatesFS, "templates")
 	if err != nil {
@@ -112,14 +151,81 @@ func main() {
 	})
 
 	// Initialize Fiber app
+	// Request bodies are not streamed: fasthttp skips BodyLimit for streamed bodies, and multipart
+	// uploads are already parsed as they arrive, keeping 16MB in memory and the rest in a temporary file
 	app := fiber.New(fiber.Config{
-		Views:       engine,
-		ViewsLayout: "layout",
+		Views:        engine,
+		ViewsLayout:  "layout",
+		BodyLimit:    bodyLimit(),
+		ErrorHandler: handlers.ErrorHandler,
 	})
 
+	registerRoutes(app)
+
+	for _, route := range api.UndocumentedRoutes(app) {
+		log.Printf("[API] Route missing from the OpenAPI document: %s", route)
+	}
+	for _, route := range api.UnregisteredRoutes(app) {
+		log.Printf("[API] Documented route is not registered: %s", route)
+	}
+	for _, route := range handlers.UnmatchedAdminRoutes(app) {
+		log.Printf("[AUTH] Admin route matches no registered route: %s", route)
+	}
+
+	// Get port from env or default to 3000
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "3000"
+	}
+
+	// Stop background workers and the server on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Periodic update check, broadcasts update_available to clients
+	handlers.StartUpdateChecker(ctx)
+	handlers.StartAutoCleanup(ctx)
+	handlers.StartShareMaintenance(ctx)
+	handlers.StartBackupPush(ctx)
+
+	// Webhooks stop last, after the updates of running requests and imports were queued
+	webhooks, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	handlers.StartWebhooks(webhooks)
+
+	listenErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on port %s", port)
+		listenErr <- app.Listen(":" + port)
+	}()
+
+	select {
+	case err := <-listenErr:
+		if err != nil {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		// A second signal kills the process without waiting
+		stop()
+		shutdown(app, stopWebhooks)
+	}
+}
+
+// registerRoutes adds the middleware and every route of the server to app, in order
+func registerRoutes(app *fiber.App) {
+	// Probes answer before any middleware, so they skip logging, auth and rate limits
+	app.Get("/healthz", handlers.Healthz)
+	app.Get("/readyz", handlers.Readyz)
+
 	// Middleware
-	app.Use(logger.New())
-	app.Use(recover.New())
+	// The request ID is logged and returned in X-Request-ID and in every error body
+	app.Use(handlers.RequestIDMiddleware)
+	app.Use(handlers.RequestLogger)
+	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
+	app.Use(handlers.LanguageMiddleware)
+	app.Use(handlers.AdminAllowlistMiddleware)
+	app.Use(handlers.MaintenanceMiddleware)
+	app.Use(handlers.ReleasedFilesMiddleware)
 
 	// Service Worker at root path
 	app.Get("/sw.js", func(c *fiber.Ctx) error {
@@ -139,19 +245,35 @@ func main() {
 		Browse: false,
 	}))
 
+	// CSRF protection for state-changing UI requests, ahead of every route a session cookie can reach
+	app.Use(handlers.CSRFMiddleware)
+
 	// Auth routes (before middleware)
 	app.Get("/login", handlers.LoginPage)
 	app.Post("/login", handlers.LoginRateLimitMiddleware, handlers.Login)
 	app.Post("/logout", handlers.Logout)
 
+	// Public share links (token in URL, no session)
+	app.Get("/share/:token", handlers.GetSharedList)
+
+	// Signed export download links (signature in URL, no session)
+	app.Get(handlers.ExportDownloadPath, handlers.DownloadExport)
+
 	// i18n API (before auth middleware - needed for login page)
 	app.Get("/locales", handlers.GetLocales)
+	app.Get("/api/languages", handlers.GetLanguages)
+
+	// API documentation (public)
+	app.Get("/api/openapi.json", api.GetOpenAPI)
+	app.Get("/api/docs", api.GetAPIDocs)
 
 	// REST API (before auth middleware - uses token auth)
 	api.Register(app)
 
 	// Public endpoints (no auth required)
 	app.Get("/api/version", handlers.GetVersion)
+	app.Get("/api/version/changelog", handlers.GetChangelog)
+	app.Get("/api/version/build", handlers.GetVersionBuild)
 
 	// Auth middleware for all other routes
 	app.Use(handlers.AuthMiddleware)
@@ -188,7 +310,6 @@ func main() {
 	app.Put("/lists/:id", handlers.UpdateList)
 	app.Delete("/lists/:id", handlers.DeleteList)
 	app.Post("/lists/:id/activate", handlers.SetActiveList)
-	app.Get("/lists/:id/activate", handlers.SetActiveList)
 	app.Post("/lists/:id/move-up", handlers.MoveListUp)
 	app.Post("/lists/:id/move-down", handlers.MoveListDown)
 
@@ -217,12 +338,31 @@ func main() {
 
 	// Stats API
 	app.Get("/stats", handlers.GetStats)
+	app.Get("/api/stats/overview", handlers.GetStatsOverview)
+	app.Get("/api/stats/timeseries", handlers.GetStatsTimeseries)
+
+	// Server-side settings
+	app.Get("/api/settings", handlers.GetSettings)
+	app.Put("/api/settings", handlers.UpdateSettings)
+	// Server default language
+	app.Put("/api/settings/language", handlers.SetDefaultLanguage)
+
+	// Force an update check, bypassing the cache
+	app.Post("/api/version/refresh", handlers.RefreshVersion)
 
 	// Offline data API
 	app.Get("/api/data", handlers.GetAllData)
 	app.Get("/api/item/:id/version", handlers.GetItemVersion)
 	app.Get("/api/suggestions", handlers.GetSuggestions)
 
+	// Full-text search
+	app.Get("/api/search", handlers.GetSearch)
+	app.Get("/api/search/items", handlers.SearchItems)
+
+	// Product names for scanned barcodes
+	app.Get("/api/products/lookup", handlers.GetProductLookup)
+	app.Post("/api/admin/search/reindex", handlers.ReindexSearch)
+
 	// History management API
 	app.Get("/api/history", handlers.GetHistory)
 	app.Delete("/api/history/:id", handlers.DeleteHistoryItem)
@@ -234,19 +374,63 @@ func main() {
 	// Import/Export
 	app.Get("/export", handlers.ExportAllData)
 	app.Get("/export/list/:id", handlers.ExportSingleList)
+	app.Get("/export/templates/:id", handlers.ExportSingleTemplate)
+	app.Get("/export/history", handlers.ExportAllHistory)
 	app.Get("/export/preview", handlers.GetExportPreview)
-	app.Post("/import", handlers.ImportData)
+	app.Post("/import", handlers.Idempotent(handlers.SessionIdempotencyScope), handlers.ImportData)
 	app.Post("/import/preview", handlers.PreviewImport)
+	app.Post("/import/url", handlers.Idempotent(handlers.SessionIdempotencyScope), handlers.ImportURL)
+	app.Post("/import/url/preview", handlers.PreviewImportURL)
+	app.Post("/import/text", handlers.Idempotent(handlers.SessionIdempotencyScope), handlers.ImportText)
+	app.Post("/import/history", handlers.Idempotent(handlers.SessionIdempotencyScope), handlers.ImportHistory)
+	app.Get("/api/imports", handlers.GetImports)
+	app.Post("/api/imports/:id/rollback", handlers.RollbackImport)
+
+	// Remote backups to S3-compatible or WebDAV storage
+	app.Post("/api/backup/push", handlers.PushBackup)
+	app.Post("/api/backup/test", handlers.TestBackupPush)
 
 	// Database management
+	app.Get("/api/database/clear-challenge", handlers.GetClearChallenge)
 	app.Post("/api/database/clear", handlers.ClearDatabase)
+}
 
-	// Get port from env or default to 3000
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3000"
+// shutdown stops the server within SHUTDOWN_TIMEOUT_SECONDS
+// WebSocket clients are told first, then in-flight requests and a running import or restore get the
+// rest of the grace period. Webhooks are stopped after them, so their updates are still delivered,
+// and the background workers are waited for last. The database is closed by main afterwards
+func shutdown(app *fiber.App, stopWebhooks context.CancelFunc) {
+	grace := shutdownTimeout()
+	deadline := time.Now().Add(grace)
+	log.Printf("Shutting down server, waiting up to %s...", grace)
+
+	handlers.CloseWebSockets("server_shutdown")
+	if err := app.ShutdownWithTimeout(grace); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
+	}
+	handlers.WaitForOperation(time.Until(deadline))
+	stopWebhooks()
+	handlers.WaitForBackground(time.Until(deadline))
+	log.Println("Server stopped")
+}
+
+// maxUploadMB returns the request body limit from MAX_UPLOAD_MB, large enough for database restores
+func maxUploadMB() int {
+	if mb, err := strconv.Atoi(os.Getenv("MAX_UPLOAD_MB")); err == nil && mb > 0 {
+		return mb
 	}
+	return 32
+}
 
-	log.Printf("Starting server on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+// bodyLimit is the larger of MAX_UPLOAD_MB and the import limit, with room for the multipart encoding of an import
+func bodyLimit() int {
+	return max(maxUploadMB()*1024*1024, int(handlers.MaxImportSize())+1024*1024)
+}
+
+// shutdownTimeout returns the grace period from SHUTDOWN_TIMEOUT_SECONDS, long enough for a large import
+func shutdownTimeout() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 30 * time.Second
 }
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"shopping-list/api"
+	"shopping-list/db"
+	"shopping-list/handlers"
+	"shopping-list/i18n"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newRoutedApp returns an app with every route of the server, the REST API enabled
+func newRoutedApp(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("API_TOKEN", "test-token")
+	app := fiber.New()
+	registerRoutes(app)
+	return app
+}
+
+func TestEveryAPIRouteIsDocumented(t *testing.T) {
+	app := newRoutedApp(t)
+	for _, route := range api.UndocumentedRoutes(app) {
+		t.Errorf("route missing from the OpenAPI document: %s", route)
+	}
+}
+
+func TestEveryDocumentedRouteIsRegistered(t *testing.T) {
+	app := newRoutedApp(t)
+	for _, route := range api.UnregisteredRoutes(app) {
+		t.Errorf("documented route is not registered: %s", route)
+	}
+}
+
+func TestEveryAdminRouteIsRegistered(t *testing.T) {
+	app := newRoutedApp(t)
+	for _, route := range handlers.UnmatchedAdminRoutes(app) {
+		t.Errorf("admin route matches no registered route: %s", route)
+	}
+}
+
+// routedError sends req to app and returns the status and the error code of the response
+func routedError(t *testing.T, app *fiber.App, req *http.Request) (int, string) {
+	t.Helper()
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(data, &body)
+	return resp.StatusCode, body.Error
+}
+
+func TestCSRFCoversRoutesBeforeAuth(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	db.Init()
+	t.Cleanup(db.Close)
+	app := newRoutedApp(t)
+
+	// A session cookie alone cannot log the user out or create an export link
+	for _, path := range []string{"/logout", "/api/export/link"} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.AddCookie(&http.Cookie{Name: handlers.CSRFCookieName, Value: "cookie-token"})
+		req.AddCookie(&http.Cookie{Name: "session", Value: "session-id"})
+		if status, code := routedError(t, app, req); status != fiber.StatusForbidden || code != handlers.ErrCodeCSRFInvalid {
+			t.Errorf("POST %s without a CSRF token: got %d %q, want 403 %q", path, status, code, handlers.ErrCodeCSRFInvalid)
+		}
+	}
+
+	// A bearer token cannot be sent cross-site, so the export link needs no CSRF token
+	req := httptest.NewRequest("POST", "/api/export/link", strings.NewReader("{"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer test-token")
+	if status, code := routedError(t, app, req); status != fiber.StatusBadRequest || code != handlers.ErrCodeInvalidJSON {
+		t.Errorf("POST /api/export/link with a bearer token: got %d %q, want 400 %q", status, code, handlers.ErrCodeInvalidJSON)
+	}
+}
+
+func TestListActivationIsBlockedDuringMaintenance(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("DISABLE_AUTH", "true")
+	db.Init()
+	t.Cleanup(db.Close)
+	app := newRoutedApp(t)
+
+	first, err := db.CreateList("First", "")
+	if err != nil {
+		t.Fatalf("create list: %v", err)
+	}
+	second, err := db.CreateList("Second", "")
+	if err != nil {
+		t.Fatalf("create list: %v", err)
+	}
+	if err := db.SetActiveList(first.ID); err != nil {
+		t.Fatalf("activate list: %v", err)
+	}
+	if _, err := handlers.SetMaintenance(true, "Upgrading"); err != nil {
+		t.Fatalf("enable maintenance: %v", err)
+	}
+	t.Cleanup(func() { handlers.SetMaintenance(false, "") })
+
+	// Activating a list changes state, so it is a POST and maintenance rejects it
+	path := "/lists/" + strconv.FormatInt(second.ID, 10) + "/activate"
+	get := httptest.NewRequest("GET", path, nil)
+	post := httptest.NewRequest("POST", path, nil)
+	post.AddCookie(&http.Cookie{Name: handlers.CSRFCookieName, Value: "csrf-token"})
+	post.Header.Set("X-CSRF-Token", "csrf-token")
+	if status, code := routedError(t, app, post); status != fiber.StatusServiceUnavailable || code != handlers.ErrCodeMaintenance {
+		t.Errorf("POST %s: got %d %q, want 503 %q", path, status, code, handlers.ErrCodeMaintenance)
+	}
+	routedError(t, app, get)
+	if active, err := db.GetActiveList(); err != nil || active.ID != first.ID {
+		t.Errorf("active list = %+v, %v, want %q to stay active", active, err, first.Name)
+	}
+}
+
+func TestSwitchingLanguageChangesMessages(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("DISABLE_AUTH", "true")
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db.Init()
+	t.Cleanup(db.Close)
+	t.Cleanup(func() { i18n.SetDefaultLang("en") })
+	app := newRoutedApp(t)
+
+	// A list without a name, from a client that asks for no language
+	createList := func() string {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/v1/lists", strings.NewReader(`{"name":""}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != fiber.StatusBadRequest || body.Error != handlers.ErrCodeValidation {
+			t.Fatalf("create list without a name: got %d %+v, want 400 %q", resp.StatusCode, body, handlers.ErrCodeValidation)
+		}
+		return body.Message
+	}
+	setLanguage := func(language string) int {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/api/settings/language", strings.NewReader(`{"language":"`+language+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(handlers.CSRFHeaderName, "csrf-token")
+		req.AddCookie(&http.Cookie{Name: handlers.CSRFCookieName, Value: "csrf-token"})
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := createList(); got != "name is required" {
+		t.Errorf("message before the switch = %q, want the English one", got)
+	}
+	if status := setLanguage("uk"); status != fiber.StatusOK {
+		t.Fatalf("switch to uk: status %d", status)
+	}
+	if got := createList(); got != "name є обов'язковим" {
+		t.Errorf("message after the switch = %q, want the Ukrainian one", got)
+	}
+	if lang, _ := db.GetSetting("default_language", ""); lang != "uk" {
+		t.Errorf("stored default language = %q, want uk", lang)
+	}
+
+	// An unknown language is rejected and the default stays
+	if status := setLanguage("xx"); status != fiber.StatusBadRequest {
+		t.Errorf("switch to xx: status %d, want 400", status)
+	}
+	if got := i18n.GetDefaultLang(); got != "uk" {
+		t.Errorf("default language after a rejected switch = %q, want uk", got)
+	}
+}
+
+func TestShutdownWaitsForRunningImport(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("DISABLE_AUTH", "true")
+	db.Init()
+	t.Cleanup(db.Close)
+	app := newRoutedApp(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go app.Listener(ln)
+
+	// An import large enough to still be writing when the signal arrives
+	const items = 40000
+	export := handlers.ExportData{Version: handlers.ExportVersion, App: "koffan"}
+	section := handlers.ExportSection{Name: "Imported", Items: make([]handlers.ExportItem, items)}
+	for i := range section.Items {
+		section.Items[i] = handlers.ExportItem{Name: "Item " + strconv.Itoa(i), Quantity: 1}
+	}
+	export.Data.Lists = []handlers.ExportList{{Name: "Slow import", Sections: []handlers.ExportSection{section}}}
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "export.json")
+	part.Write(data)
+	w.Close()
+
+	req, _ := http.NewRequest("POST", "http://"+ln.Addr().String()+"/import", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set(handlers.CSRFHeaderName, "csrf-token")
+	req.AddCookie(&http.Cookie{Name: handlers.CSRFCookieName, Value: "csrf-token"})
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	for deadline := time.Now().Add(10 * time.Second); handlers.GetOperations().Current == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("import never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// SIGTERM as main receives it, then the same shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+	<-ctx.Done()
+	shutdown(app, func() {})
+
+	if handlers.GetOperations().Current != nil {
+		t.Fatal("shutdown returned while the import was running")
+	}
+	var imported int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM items i JOIN sections s ON s.id = i.section_id
+		JOIN lists l ON l.id = s.list_id WHERE l.name = 'Slow import'`).Scan(&imported); err != nil {
+		t.Fatalf("count items: %v", err)
+	}
+	// The import either committed fully or left nothing behind
+	switch code := <-status; {
+	case code == http.StatusOK && imported != items:
+		t.Errorf("import answered 200 with %d of %d items committed", imported, items)
+	case code != http.StatusOK && imported != 0:
+		t.Errorf("import answered %d but left %d partial items", code, imported)
+	}
+}
+
+func TestErrorEnvelopeShape(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("DISABLE_AUTH", "true")
+	if err := i18n.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db.Init()
+	t.Cleanup(db.Close)
+	t.Setenv("API_TOKEN", "test-token")
+	app := fiber.New(fiber.Config{ErrorHandler: handlers.ErrorHandler})
+	registerRoutes(app)
+
+	// One failing request per file that writes errors, UI requests carry the CSRF token, API requests the bearer token
+	cases := []struct {
+		file, method, path, body, code string
+	}{
+		{"handlers/errors.go", "GET", "/no-such-page", "", handlers.ErrCodeNotFound},
+		{"handlers/csrf.go", "POST", "/lists", "", handlers.ErrCodeCSRFInvalid},
+		{"handlers/dashboard.go", "GET", "/api/stats/timeseries?metric=bogus", "", handlers.ErrCodeValidation},
+		{"handlers/database.go", "POST", "/api/database/clear", "{", handlers.ErrCodeInvalidJSON},
+		{"handlers/export.go", "GET", "/export/list/9999", "", handlers.ErrCodeNotFound},
+		{"handlers/exportlink.go", "GET", handlers.ExportDownloadPath + "?sig=forged", "", handlers.ErrCodeInvalidSignature},
+		{"handlers/historyio.go", "GET", "/export/history?format=xml", "", handlers.ErrCodeValidation},
+		{"handlers/import.go", "POST", "/import", "", handlers.ErrCodeValidation},
+		{"handlers/importbatch.go", "POST", "/api/imports/abc/rollback", "", handlers.ErrCodeInvalidID},
+		{"handlers/importurl.go", "POST", "/import/url", `{"url":"ftp://example.com/list.json"}`, handlers.ErrCodeValidation},
+		{"handlers/items.go", "GET", "/api/item/abc/version", "", handlers.ErrCodeInvalidID},
+		{"handlers/lang.go", "PUT", "/api/settings/language", `{"language":"xx"}`, handlers.ErrCodeValidation},
+		{"handlers/search.go", "GET", "/api/search", "", handlers.ErrCodeValidation},
+		{"handlers/settings.go", "PUT", "/api/settings", "{}", handlers.ErrCodeValidation},
+		{"handlers/share.go", "GET", "/share/unknown-token", "", handlers.ErrCodeNotFound},
+		{"handlers/textimport.go", "POST", "/import/text", `{"text":""}`, handlers.ErrCodeValidation},
+		{"api/middleware.go", "GET", "/api/v1/lists", "", handlers.ErrCodeMissingToken},
+		{"api/lists.go", "GET", "/api/v1/lists/abc", "", handlers.ErrCodeInvalidID},
+		{"api/sections.go", "POST", "/api/v1/sections", "{}", handlers.ErrCodeValidation},
+		{"api/items.go", "GET", "/api/v1/items/9999", "", handlers.ErrCodeNotFound},
+		{"api/batch.go", "POST", "/api/v1/batch", "{", handlers.ErrCodeInvalidJSON},
+		{"api/history.go", "DELETE", "/api/v1/history/abc", "", handlers.ErrCodeInvalidID},
+		{"api/photos.go", "GET", "/api/v1/items/9999/photo", "", handlers.ErrCodeNotFound},
+		{"api/trash.go", "POST", "/api/v1/items/9999/restore", "", handlers.ErrCodeNotFound},
+		{"api/activity.go", "GET", "/api/v1/lists/abc/activity", "", handlers.ErrCodeInvalidID},
+		{"api/tokens.go", "POST", "/api/v1/lists/9999/tokens", `{"name":"Phone","scope":"read"}`, handlers.ErrCodeNotFound},
+		{"api/shares.go", "POST", "/api/v1/admin/shares", "{}", handlers.ErrCodeValidation},
+	}
+	for _, tc := range cases {
+		t.Run(tc.file, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			switch {
+			case tc.file == "api/middleware.go":
+			case strings.HasPrefix(tc.file, "api/"):
+				req.Header.Set("Authorization", "Bearer test-token")
+			case tc.file != "handlers/csrf.go":
+				req.Header.Set(handlers.CSRFHeaderName, "csrf-token")
+				req.AddCookie(&http.Cookie{Name: handlers.CSRFCookieName, Value: "csrf-token"})
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+
+			// Exactly the three fields, the request ID matching the header
+			var body map[string]string
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("%s %s: body %q is not an error envelope: %v", tc.method, tc.path, data, err)
+			}
+			if len(body) != 3 || body["error"] != tc.code || body["message"] == "" || body["request_id"] == "" {
+				t.Errorf("%s %s: body %s, want error %q with a message and request_id", tc.method, tc.path, data, tc.code)
+			}
+			if id := resp.Header.Get(handlers.HeaderRequestID); body["request_id"] != id {
+				t.Errorf("request_id %q, X-Request-ID %q", body["request_id"], id)
+			}
+			if resp.StatusCode != handlers.StatusForCode(tc.code) {
+				t.Errorf("%s %s: status %d, want %d for %s", tc.method, tc.path, resp.StatusCode, handlers.StatusForCode(tc.code), tc.code)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, fiber.MIMEApplicationJSON) {
+				t.Errorf("Content-Type %q, want JSON", ct)
+			}
+		})
+	}
+}
+
+func TestProbesSkipAuthAndMaintenance(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	db.Init()
+	t.Cleanup(db.Close)
+	app := newRoutedApp(t)
+	if _, err := handlers.SetMaintenance(true, "Upgrading"); err != nil {
+		t.Fatalf("enable maintenance: %v", err)
+	}
+	t.Cleanup(func() { handlers.SetMaintenance(false, "") })
+	if err := db.DB.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a session or token, during maintenance and with the database closed the probes still answer for themselves
+	for path, want := range map[string]int{"/healthz": fiber.StatusOK, "/readyz": fiber.StatusServiceUnavailable} {
+		start := time.Now()
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		took := time.Since(start)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != want || resp.Header.Get(handlers.HeaderRequestID) != "" || !json.Valid(body) || bytes.Contains(body, []byte(handlers.ErrCodeMaintenance)) {
+			t.Errorf("GET %s: %d %s, want %d before any middleware", path, resp.StatusCode, body, want)
+		}
+		if took >= time.Second {
+			t.Errorf("GET %s took %v, want well under a second", path, took)
+		}
+	}
+	if status, code := routedError(t, app, httptest.NewRequest("GET", "/api/v1/lists", nil)); status == fiber.StatusOK {
+		t.Errorf("GET /api/v1/lists without a token: %d %q, want it refused like every route after the probes", status, code)
+	}
+}
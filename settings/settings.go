@@ -0,0 +1,374 @@
+// Package settings stores server-side settings in the settings table and reads them back typed
+// Every read goes to the database, so a change takes effect for all consumers without a restart
+// Consumers must read through the getters instead of keeping values from startup
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"shopping-list/db"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the type of a setting's value
+type Type string
+
+const (
+	TypeString Type = "string"
+	TypeInt    Type = "int"
+	TypeBool   Type = "bool"
+	TypeJSON   Type = "json"
+)
+
+// Source tells where the effective value of a setting comes from
+type Source string
+
+const (
+	SourceStored  Source = "stored"  // Changed through the settings API
+	SourceEnv     Source = "env"     // Taken from the setting's environment variable
+	SourceDefault Source = "default" // Built-in default
+)
+
+// Mask is returned instead of the value of a secret that is set
+// Writing Mask back leaves the secret unchanged, so forms can send it untouched
+const Mask = "********"
+
+// Def describes a setting, values are stored as strings in the form the getters parse
+type Def struct {
+	Key     string
+	Type    Type
+	Default string
+	// Env names an environment variable that replaces Default, so deployments can bootstrap a value
+	// A stored value always wins, the variable only applies until the setting is changed
+	Env string
+	// Secret settings are write-only, reads return Mask
+	Secret bool
+	// Min and Max bound TypeInt settings
+	Min, Max int
+	// Validate runs extra checks on the stored form, it is optional
+	Validate func(value string) error
+	// Apply makes a stored value take effect in state that is not read through the getters, it is optional
+	Apply func(value string)
+}
+
+// Info describes a setting and its effective value for the settings API
+type Info struct {
+	Key     string `json:"key"`
+	Type    Type   `json:"type"`
+	Value   any    `json:"value"` // Mask for secrets that are set, null for secrets that are not
+	Default any    `json:"default"`
+	Source  Source `json:"source"`
+	Env     string `json:"env,omitempty"`
+	Secret  bool   `json:"secret,omitempty"`
+	Min     *int   `json:"min,omitempty"`
+	Max     *int   `json:"max,omitempty"`
+}
+
+// ValidationError lists the rejected keys of an update with the reason for each
+type ValidationError struct {
+	Errors map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + " " + e.Errors[key]
+	}
+	return strings.Join(parts, ", ")
+}
+
+var (
+	mu       sync.RWMutex
+	defs     []Def
+	onChange []func(changed map[string]any)
+)
+
+// Register adds settings, keys must be unique
+func Register(list ...Def) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, def := range list {
+		for _, existing := range defs {
+			if existing.Key == def.Key {
+				panic("settings: duplicate key " + def.Key)
+			}
+		}
+		defs = append(defs, def)
+	}
+}
+
+// OnChange registers a function called after every successful update with the changed public values
+func OnChange(fn func(changed map[string]any)) {
+	mu.Lock()
+	defer mu.Unlock()
+	onChange = append(onChange, fn)
+}
+
+func lookup(key string) (Def, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, def := range defs {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return Def{}, false
+}
+
+// fallback returns the value used while the setting is not stored: a valid Env value, else Default
+func (d Def) fallback() (string, Source) {
+	if d.Env != "" {
+		if value := os.Getenv(d.Env); value != "" {
+			err := d.check(value)
+			if err == nil {
+				return value, SourceEnv
+			}
+			log.Printf("[SETTINGS] Ignoring %s=%q: %v", d.Env, value, err)
+		}
+	}
+	return d.Default, SourceDefault
+}
+
+// check validates the stored form of a value
+func (d Def) check(value string) error {
+	switch d.Type {
+	case TypeInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		if d.Max > d.Min && (n < d.Min || n > d.Max) {
+			return fmt.Errorf("must be a number between %d and %d", d.Min, d.Max)
+		}
+	case TypeBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("must be true or false")
+		}
+	case TypeJSON:
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("must be valid JSON")
+		}
+	}
+	if d.Validate != nil {
+		return d.Validate(value)
+	}
+	return nil
+}
+
+// raw returns the effective stored form of key and where it comes from
+// Unknown keys read as "", database errors fall back like an unset setting
+func raw(key string) (string, Source, Def) {
+	def, ok := lookup(key)
+	if !ok {
+		log.Printf("[SETTINGS] Unknown setting %s", key)
+		return "", SourceDefault, def
+	}
+	value, ok, err := db.LookupSetting(key)
+	if err == nil && ok && !(def.Secret && value == "") && def.check(value) == nil {
+		return value, SourceStored, def
+	}
+	value, source := def.fallback()
+	return value, source, def
+}
+
+// String returns the value of a setting
+func String(key string) string {
+	value, _, _ := raw(key)
+	return value
+}
+
+// Int returns the value of a TypeInt setting
+func Int(key string) int {
+	value, _, def := raw(key)
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	n, _ := strconv.Atoi(def.Default)
+	return n
+}
+
+// Bool returns the value of a TypeBool setting
+func Bool(key string) bool {
+	return String(key) == "true"
+}
+
+// JSON decodes the value of a TypeJSON setting into v
+func JSON(key string, v any) error {
+	return json.Unmarshal([]byte(String(key)), v)
+}
+
+// coerce converts a value from a request to the stored form of def
+// Strings holding a number or boolean are accepted for TypeInt and TypeBool, JSON values for TypeJSON
+func coerce(def Def, value any) (string, error) {
+	switch def.Type {
+	case TypeInt:
+		switch v := value.(type) {
+		case float64:
+			if v != math.Trunc(v) || math.Abs(v) > math.MaxInt32 {
+				return "", fmt.Errorf("must be a whole number")
+			}
+			return strconv.Itoa(int(v)), nil
+		case int:
+			return strconv.Itoa(v), nil
+		case json.Number:
+			return v.String(), nil
+		case string:
+			return strings.TrimSpace(v), nil
+		}
+		return "", fmt.Errorf("must be a whole number")
+	case TypeBool:
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			return strings.ToLower(strings.TrimSpace(v)), nil
+		}
+		return "", fmt.Errorf("must be true or false")
+	case TypeJSON:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("must be valid JSON")
+		}
+		return string(data), nil
+	}
+	v, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("must be a string")
+	}
+	return v, nil
+}
+
+// typed converts a stored form to the value returned by the settings API
+func typed(def Def, value string) any {
+	switch def.Type {
+	case TypeInt:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	case TypeBool:
+		return value == "true"
+	case TypeJSON:
+		return json.RawMessage(value)
+	}
+	return value
+}
+
+// public returns the value of a setting as the API shows it, secrets masked
+func public(def Def, value string) any {
+	if def.Secret {
+		if value == "" {
+			return nil
+		}
+		return Mask
+	}
+	return typed(def, value)
+}
+
+// Update validates and stores the given settings, then applies them and notifies OnChange listeners
+// Nothing is stored if any key is unknown or any value is invalid, the error is a *ValidationError
+func Update(values map[string]any) error {
+	stored := make(map[string]string, len(values))
+	invalid := make(map[string]string)
+	for key, value := range values {
+		def, ok := lookup(key)
+		if !ok {
+			invalid[key] = "is not a known setting"
+			continue
+		}
+		if def.Secret && value == Mask {
+			continue
+		}
+		s, err := coerce(def, value)
+		if err == nil && !(def.Secret && s == "") {
+			err = def.check(s)
+		}
+		if err != nil {
+			invalid[key] = err.Error()
+			continue
+		}
+		stored[key] = s
+	}
+	if len(invalid) > 0 {
+		return &ValidationError{Errors: invalid}
+	}
+
+	changed := make(map[string]any, len(stored))
+	for key, value := range stored {
+		if err := db.SetSetting(key, value); err != nil {
+			return err
+		}
+		def, _ := lookup(key)
+		if def.Apply != nil {
+			def.Apply(value)
+		}
+		if value == "" {
+			// Cleared secrets read as unset
+			value, _ = def.fallback()
+		}
+		changed[key] = public(def, value)
+	}
+
+	mu.RLock()
+	listeners := onChange
+	mu.RUnlock()
+	for _, fn := range listeners {
+		fn(changed)
+	}
+	return nil
+}
+
+// List describes every registered setting with its effective value, secrets masked
+func List() []Info {
+	mu.RLock()
+	all := append([]Def(nil), defs...)
+	mu.RUnlock()
+
+	infos := make([]Info, 0, len(all))
+	for _, def := range all {
+		value, source, _ := raw(def.Key)
+		fallback, _ := def.fallback()
+		info := Info{
+			Key:     def.Key,
+			Type:    def.Type,
+			Value:   public(def, value),
+			Default: public(def, fallback),
+			Source:  source,
+			Env:     def.Env,
+			Secret:  def.Secret,
+		}
+		if def.Type == TypeInt && def.Max > def.Min {
+			min, max := def.Min, def.Max
+			info.Min, info.Max = &min, &max
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Values returns the effective value of every setting in its stored form, secrets masked
+func Values() map[string]string {
+	mu.RLock()
+	all := append([]Def(nil), defs...)
+	mu.RUnlock()
+
+	values := make(map[string]string, len(all))
+	for _, def := range all {
+		value, _, _ := raw(def.Key)
+		if def.Secret && value != "" {
+			value = Mask
+		}
+		values[def.Key] = value
+	}
+	return values
+}
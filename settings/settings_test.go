@@ -0,0 +1,187 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"shopping-list/db"
+)
+
+func init() {
+	Register(
+		Def{Key: "test_name", Type: TypeString, Default: "Koffan", Env: "TEST_NAME", Validate: func(value string) error {
+			if len(value) > 10 {
+				return errors.New("must be at most 10 characters")
+			}
+			return nil
+		}},
+		Def{Key: "test_hours", Type: TypeInt, Default: "24", Env: "TEST_HOURS", Min: 1, Max: 168},
+		Def{Key: "test_count", Type: TypeInt, Default: "3"},
+		Def{Key: "test_enabled", Type: TypeBool, Default: "false", Env: "TEST_ENABLED"},
+		Def{Key: "test_tags", Type: TypeJSON, Default: `[]`},
+		Def{Key: "test_password", Type: TypeString, Env: "TEST_PASSWORD", Secret: true},
+	)
+}
+
+// setupTestDB opens a fresh migrated database in a temp directory for the test
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	db.Init()
+	t.Cleanup(db.Close)
+}
+
+func TestUpdateCoercesValues(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		value any
+		want  string
+	}{
+		{"int from a JSON number", "test_hours", float64(48), "48"},
+		{"int from a Go int", "test_hours", 12, "12"},
+		{"int from json.Number", "test_hours", json.Number("6"), "6"},
+		{"int from a string", "test_hours", " 72 ", "72"},
+		{"bool", "test_enabled", true, "true"},
+		{"bool from a string", "test_enabled", " TRUE ", "true"},
+		{"JSON array", "test_tags", []any{"a", "b"}, `["a","b"]`},
+		{"JSON object", "test_tags", map[string]any{"x": float64(1)}, `{"x":1}`},
+		{"JSON string", "test_tags", "text", `"text"`},
+		{"string", "test_name", "Shop", "Shop"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDB(t)
+			if err := Update(map[string]any{tc.key: tc.value}); err != nil {
+				t.Fatalf("Update(%s=%v): %v", tc.key, tc.value, err)
+			}
+			if got := String(tc.key); got != tc.want {
+				t.Errorf("stored %s = %q, want %q", tc.key, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRejectsInvalidValues(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		value any
+	}{
+		{"unknown key", "test_unknown", "x"},
+		{"fractional int", "test_hours", 1.5},
+		{"int out of range", "test_hours", float64(169)},
+		{"int below range", "test_hours", float64(0)},
+		{"int from text", "test_hours", "soon"},
+		{"int from a bool", "test_hours", true},
+		{"bool from text", "test_enabled", "yes please"},
+		{"bool from a number", "test_enabled", float64(1)},
+		{"string from a number", "test_name", float64(1)},
+		{"custom validation", "test_name", "far too long a name"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDB(t)
+			// A valid key in the same update is not stored either
+			err := Update(map[string]any{tc.key: tc.value, "test_count": float64(9)})
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Update(%s=%v) = %v, want a validation error", tc.key, tc.value, err)
+			}
+			if len(invalid.Errors) != 1 || invalid.Errors[tc.key] == "" {
+				t.Errorf("errors = %v, want one for %s", invalid.Errors, tc.key)
+			}
+			if Int("test_count") != 3 {
+				t.Errorf("test_count = %d, the rejected update stored the valid key", Int("test_count"))
+			}
+		})
+	}
+}
+
+func TestEnvPrecedence(t *testing.T) {
+	setupTestDB(t)
+	source := func(key string) Source {
+		t.Helper()
+		for _, info := range List() {
+			if info.Key == key {
+				return info.Source
+			}
+		}
+		t.Fatalf("%s not listed", key)
+		return ""
+	}
+
+	// The default without the variable
+	if Int("test_hours") != 24 || source("test_hours") != SourceDefault {
+		t.Errorf("test_hours = %d from %s, want the default 24", Int("test_hours"), source("test_hours"))
+	}
+
+	// The variable replaces the default
+	t.Setenv("TEST_HOURS", "36")
+	if Int("test_hours") != 36 || source("test_hours") != SourceEnv {
+		t.Errorf("test_hours = %d from %s, want 36 from the environment", Int("test_hours"), source("test_hours"))
+	}
+
+	// A stored value wins over the variable
+	if err := Update(map[string]any{"test_hours": float64(48)}); err != nil {
+		t.Fatal(err)
+	}
+	if Int("test_hours") != 48 || source("test_hours") != SourceStored {
+		t.Errorf("test_hours = %d from %s, want the stored 48", Int("test_hours"), source("test_hours"))
+	}
+
+	// An invalid variable is ignored
+	t.Setenv("TEST_ENABLED", "maybe")
+	if Bool("test_enabled") || source("test_enabled") != SourceDefault {
+		t.Errorf("test_enabled = %v from %s, want the default with an invalid variable", Bool("test_enabled"), source("test_enabled"))
+	}
+	t.Setenv("TEST_NAME", "much too long for it")
+	if String("test_name") != "Koffan" {
+		t.Errorf("test_name = %q, want the default when the variable fails validation", String("test_name"))
+	}
+
+	// An invalid stored value, for example from an older version, falls back as well
+	if err := db.SetSetting("test_name", "way past ten characters"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_NAME", "Env")
+	if String("test_name") != "Env" {
+		t.Errorf("test_name = %q, want the variable over an invalid stored value", String("test_name"))
+	}
+}
+
+func TestSecretsAreWriteOnly(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("TEST_PASSWORD", "from-env")
+	var changes []map[string]any
+	OnChange(func(changed map[string]any) { changes = append(changes, changed) })
+
+	if err := Update(map[string]any{"test_password": "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+	if String("test_password") != "hunter2" || Values()["test_password"] != Mask {
+		t.Errorf("secret = %q, listed as %q", String("test_password"), Values()["test_password"])
+	}
+
+	// Sending the mask back keeps the secret, clearing it falls back to the variable
+	if err := Update(map[string]any{"test_password": Mask}); err != nil {
+		t.Fatal(err)
+	}
+	if String("test_password") != "hunter2" {
+		t.Errorf("secret after writing the mask = %q", String("test_password"))
+	}
+	if err := Update(map[string]any{"test_password": ""}); err != nil {
+		t.Fatal(err)
+	}
+	if String("test_password") != "from-env" {
+		t.Errorf("cleared secret = %q, want the variable", String("test_password"))
+	}
+
+	want := []map[string]any{{"test_password": Mask}, {}, {"test_password": Mask}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
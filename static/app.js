@@ -694,6 +694,22 @@ function shoppingList() {
                         }
                         this.refreshStats();
                         break;
+                    case 'items_deleted':
+                        // Carries each deleted item with its section, remove the ones shown
+                        (message.data?.items || []).forEach(item => document.getElementById('item-' + item.id)?.remove());
+                        this.refreshStats();
+                        break;
+                    case 'items_completed':
+                        // Several items were checked off or back at once
+                        this.refreshList();
+                        this.refreshStats();
+                        break;
+                    case 'completed_items_cleared':
+                        // The completed items of one list were cleared, drop them and any pruned sections
+                        (message.data?.item_ids || []).forEach(id => document.getElementById('item-' + id)?.remove());
+                        (message.data?.pruned_sections || []).forEach(id => document.getElementById('section-' + id)?.remove());
+                        this.refreshStats();
+                        break;
                     case 'items_reordered':
                         // If local action - HTMX already updated order
                         // If remote - refresh list to sync
@@ -723,6 +739,44 @@ function shoppingList() {
                         this.refreshList();
                         this.refreshStats();
                         break;
+                    case 'update_available':
+                        window.dispatchEvent(new CustomEvent('update-available', { detail: message.data }));
+                        window.Toast.show(t('settings.update_available') + ': ' + message.data.latest, 'info', 6000);
+                        break;
+                    case 'maintenance_changed':
+                        if (message.data && message.data.enabled) {
+                            window.Toast.show(message.data.message || t('maintenance.enabled'), 'warning');
+                        } else {
+                            window.Toast.show(t('maintenance.disabled'), 'success');
+                        }
+                        break;
+                    case 'items_cleared':
+                        // Old completed items were removed by the cleanup job
+                        this.refreshList();
+                        this.refreshStats();
+                        break;
+                    case 'batch_applied':
+                        // Sections and items of several kinds may have changed at once
+                        this.refreshSectionsAndSelects();
+                        this.refreshList();
+                        this.refreshStats();
+                        break;
+                    case 'integrity_repaired':
+                    case 'data_cleared':
+                        // Lists, items or history may be gone, refresh what is shown
+                        this.refreshList();
+                        this.refreshStats();
+                        break;
+                    case 'database_restored':
+                        // Everything may have changed, reload the whole page
+                        window.location.reload();
+                        break;
+                    case 'settings_changed':
+                        // Re-render in the new default language unless the user picked their own
+                        if (message.data && message.data.default_language && !localStorage.getItem('language')) {
+                            window.location.reload();
+                        }
+                        break;
                     case 'pong':
                         break;
                     default:
@@ -1121,7 +1175,7 @@ function shoppingList() {
             if (!this.isOnline) return;
 
             try {
-                const response = await fetch('/api/history');
+                const response = await fetch('/api/history?lang=' + encodeURIComponent(window.currentLang));
                 if (response.ok) {
                     this.historyItems = await response.json();
                 }
@@ -2074,8 +2128,8 @@ function shoppingList() {
             }
 
             // Validate file type
-            const validTypes = ['application/json', 'text/csv'];
-            const validExtensions = ['.json', '.csv'];
+            const validTypes = ['application/json', 'text/csv', 'application/vnd.openxmlformats-officedocument.spreadsheetml.sheet'];
+            const validExtensions = ['.json', '.yaml', '.yml', '.csv', '.xlsx'];
             const hasValidType = validTypes.includes(file.type) || validExtensions.some(ext => file.name.toLowerCase().endsWith(ext));
 
             if (!hasValidType) {
@@ -2092,7 +2146,7 @@ function shoppingList() {
             formData.append('file', file);
 
             try {
-                const response = await fetch('/import/preview', {
+                const response = await fetch('/import/preview?lang=' + encodeURIComponent(window.currentLang), {
                     method: 'POST',
                     body: formData
                 });
@@ -2127,7 +2181,7 @@ function shoppingList() {
             formData.append('copy_suffix', this.t('import.copy_suffix'));
 
             try {
-                const response = await fetch('/import', {
+                const response = await fetch('/import?lang=' + encodeURIComponent(window.currentLang), {
                     method: 'POST',
                     body: formData
                 });
@@ -2137,13 +2191,13 @@ function shoppingList() {
                 if (result.success) {
                     this.showImportPreview = false;
                     if (window.Toast) {
-                        window.Toast.show(t('import.success'), 'success');
+                        window.Toast.show(result.message || t('import.success'), 'success');
                     }
                     // Reload to show imported data
                     window.location.reload();
                 } else {
                     if (window.Toast) {
-                        window.Toast.show(result.error || t('import.error'), 'warning');
+                        window.Toast.show(result.message || t('import.error'), 'warning');
                     }
                 }
             } catch (error) {